@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/epoch"
+	usersauth "github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/auth"
+	"github.com/vaaxooo/xbackend/internal/platform/config"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+	usersdb "github.com/vaaxooo/xbackend/internal/platform/db/users"
+)
+
+// invalidate-tokens starts a new token epoch: every access token issued and
+// session created before now stops working, for one user (-user) or for
+// everyone. Running instances drop their session caches through NOTIFY.
+func main() {
+	var userID, reason, actor string
+	flag.StringVar(&userID, "user", "", "User ID to invalidate; empty invalidates everyone")
+	flag.StringVar(&reason, "reason", "", "Why, for the audit log (required)")
+	flag.StringVar(&actor, "actor", os.Getenv("USER"), "Who is running this, for the audit log")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := pdb.OpenPostgres(cfg.DB.DSN, 2, 2, cfg.DB.ConnMaxLife)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	epochs := usersauth.NewEpochNotifier(usersdb.NewTokenEpochRepo(db), usersdb.NewSessionNotifier(db), nil)
+	uc := epoch.New(epochs, usersdb.NewUserRepo(db), usersdb.NewAuditLogRepo(db))
+
+	var out epoch.Output
+	err = pdb.NewUnitOfWork(db).Do(ctx, func(ctx context.Context) error {
+		out, err = uc.Invalidate(ctx, epoch.InvalidateInput{UserID: userID, Reason: reason, Actor: "cli:" + actor})
+		return err
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if out.UserID == "" {
+		fmt.Printf("all tokens issued before %s are invalid\n", out.NotBefore.Format(time.RFC3339))
+		return
+	}
+	fmt.Printf("tokens of user %s issued before %s are invalid\n", out.UserID, out.NotBefore.Format(time.RFC3339))
+}
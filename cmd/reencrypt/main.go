@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	usersevents "github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/events"
+	"github.com/vaaxooo/xbackend/internal/platform/config"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+	usersdb "github.com/vaaxooo/xbackend/internal/platform/db/users"
+	"github.com/vaaxooo/xbackend/internal/platform/secrets"
+)
+
+// reencrypt rewrites encrypted columns with the current primary key. Run it
+// after adding a new key and making it primary; once it reports zero rows the
+// retired key can be removed from the keyring.
+func main() {
+	var batchSize int
+	flag.IntVar(&batchSize, "batch", 500, "Rows to load per batch")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keyring, err := secrets.LoadKeyring(cfg.Encryption.PrimaryKeyID, cfg.Encryption.Keys, cfg.Encryption.KeysDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if keyring == nil {
+		log.Fatal("ENCRYPTION_KEYS or ENCRYPTION_KEYS_DIR is required")
+	}
+
+	db, err := pdb.OpenPostgres(cfg.DB.DSN, 2, 2, cfg.DB.ConnMaxLife)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	identities := usersdb.NewIdentityRepo(db, keyring)
+	n, err := identities.ReencryptTOTPSecrets(ctx, keyring, batchSize)
+	if err != nil {
+		log.Fatalf("auth_identities.totp_secret: %d rows re-encrypted before error: %v", n, err)
+	}
+	fmt.Printf("auth_identities.totp_secret: %d rows re-encrypted with key %q\n", n, keyring.PrimaryKeyID())
+
+	outbox := usersevents.NewOutboxRepository(db, keyring)
+	n, err = outbox.ReencryptSensitivePayloads(ctx, keyring, batchSize)
+	if err != nil {
+		log.Fatalf("user_events_outbox.sensitive_payload: %d rows re-encrypted before error: %v", n, err)
+	}
+	fmt.Printf("user_events_outbox.sensitive_payload: %d rows re-encrypted with key %q\n", n, keyring.PrimaryKeyID())
+}
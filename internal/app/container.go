@@ -15,19 +15,23 @@ import (
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
 	usersevents "github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/events"
 	pconfig "github.com/vaaxooo/xbackend/internal/platform/config"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+	usersdb "github.com/vaaxooo/xbackend/internal/platform/db/users"
 	phttp "github.com/vaaxooo/xbackend/internal/platform/http"
 	plog "github.com/vaaxooo/xbackend/internal/platform/log"
 	"github.com/vaaxooo/xbackend/internal/platform/outbox"
+	"github.com/vaaxooo/xbackend/internal/platform/secrets"
 )
 
 type Container struct {
 	cfg    *pconfig.Config
 	logger plog.Logger
 
-	db      *sql.DB
-	modules *Modules
-	server  *phttp.Server
-	worker  *outbox.Worker
+	db       *sql.DB
+	modules  *Modules
+	server   *phttp.Server
+	worker   *outbox.Worker
+	listener *pdb.Listener
 }
 
 type Deps struct {
@@ -37,15 +41,40 @@ type Deps struct {
 }
 
 func NewContainer(deps Deps) (*Container, error) {
+	keyring, err := secrets.LoadKeyring(
+		deps.Config.Encryption.PrimaryKeyID,
+		deps.Config.Encryption.Keys,
+		deps.Config.Encryption.KeysDir,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var cipher secrets.Cipher = secrets.Plaintext{}
+	if keyring != nil {
+		cipher = keyring
+	} else {
+		deps.Logger.Warn(context.Background(), "encryption keys are not configured; sensitive columns are stored in plaintext")
+	}
+
+	// One LISTEN connection per instance feeds every challenge event stream
+	// and the session cache.
+	listener, err := pdb.NewListener(deps.Config.DB.DSN, usersdb.ChallengeEventsChannel, deps.Logger)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize all modules (bounded contexts).
 	mods, err := InitModules(
 		ModuleDeps{
-			DB:     deps.DB,
-			Logger: deps.Logger,
+			DB:              deps.DB,
+			Logger:          deps.Logger,
+			Cipher:          cipher,
+			Listener:        listener,
 		},
 		ModulesConfig{Users: UsersConfig(deps.Config)},
 	)
 	if err != nil {
+		_ = listener.Close()
 		return nil, err
 	}
 
@@ -56,7 +85,7 @@ func NewContainer(deps Deps) (*Container, error) {
                         Timeout:           30 * time.Second,
                         CORSAllowedOrigins: deps.Config.HTTP.CORSAllowedOrigins,
                 },
-                func(r chi.Router) { RegisterAPIV1(r, mods) },
+                func(r chi.Router) { RegisterAPIV1(r, mods, deps.Config) },
         )
 
 	server := phttp.NewServer(
@@ -91,12 +120,13 @@ func NewContainer(deps Deps) (*Container, error) {
 	worker := outbox.NewWorker(mods.Users.Outbox, domainPublisher, deps.Logger, outbox.Config{})
 
 	return &Container{
-		cfg:     deps.Config,
-		logger:  deps.Logger,
-		db:      deps.DB,
-		modules: mods,
-		server:  server,
-		worker:  worker,
+		cfg:      deps.Config,
+		logger:   deps.Logger,
+		db:       deps.DB,
+		modules:  mods,
+		server:   server,
+		worker:   worker,
+		listener: listener,
 	}, nil
 }
 
@@ -116,6 +146,10 @@ func (c *Container) Run() error {
 	if c.worker != nil {
 		go c.worker.Run(ctx)
 	}
+	if c.listener != nil {
+		go c.listener.Run(ctx)
+		defer c.listener.Close()
+	}
 
 	select {
 	case <-ctx.Done():
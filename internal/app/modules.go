@@ -3,9 +3,12 @@ package app
 import (
 	"database/sql"
 
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/challenge"
 	usersbootstrap "github.com/vaaxooo/xbackend/internal/modules/users/bootstrap"
 	"github.com/vaaxooo/xbackend/internal/modules/users/public"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
 	plog "github.com/vaaxooo/xbackend/internal/platform/log"
+	"github.com/vaaxooo/xbackend/internal/platform/secrets"
 )
 
 // Modules is a registry of all initialized bounded contexts (modules).
@@ -20,6 +23,10 @@ type Modules struct {
 type ModuleDeps struct {
 	DB     *sql.DB
 	Logger plog.Logger
+	Cipher secrets.Cipher
+	// Listener is the LISTEN/NOTIFY fan-out for challenge and session
+	// changes.
+	Listener *pdb.Listener
 }
 
 type ModulesConfig struct {
@@ -27,7 +34,7 @@ type ModulesConfig struct {
 }
 
 func InitModules(deps ModuleDeps, cfg ModulesConfig) (*Modules, error) {
-	users, err := usersbootstrap.Init(usersbootstrap.Dependencies{DB: deps.DB}, cfg.Users)
+	users, err := usersbootstrap.Init(usersbootstrap.Dependencies{DB: deps.DB, Logger: deps.Logger, Cipher: deps.Cipher, ChallengeEvents: challengeEvents(deps.Listener), SessionEvents: sessionEvents(deps.Listener)}, cfg.Users)
 	if err != nil {
 		return nil, err
 	}
@@ -36,3 +43,19 @@ func InitModules(deps ModuleDeps, cfg ModulesConfig) (*Modules, error) {
 		Users: users,
 	}, nil
 }
+
+// challengeEvents keeps a nil listener a nil interface, so the module falls
+// back to polling instead of calling methods on a nil pointer.
+func challengeEvents(l *pdb.Listener) challenge.Subscriber {
+	if l == nil {
+		return nil
+	}
+	return l
+}
+
+func sessionEvents(l *pdb.Listener) usersbootstrap.Notifications {
+	if l == nil {
+		return nil
+	}
+	return l
+}
@@ -10,14 +10,57 @@ import (
 func UsersConfig(cfg *pconfig.Config) userspublic.Config {
 	return userspublic.Config{
 		Auth: userspublic.AuthConfig{
-			JWTSecret:                cfg.Auth.JWTSecret,
-			AccessTTL:                cfg.Auth.AccessTTL,
-			RefreshTTL:               cfg.Auth.RefreshTTL,
-			RefreshRetentionTTL:      cfg.Auth.RefreshRetentionTTL,
-			RequireEmailConfirmation: cfg.Auth.RequireEmailConfirmation,
-			VerificationTTL:          cfg.Auth.VerificationTTL,
-			PasswordResetTTL:         cfg.Auth.PasswordResetTTL,
-			TwoFactorIssuer:          cfg.Auth.TwoFactorIssuer,
+			JWTSecret:                   cfg.Auth.JWTSecret,
+			TokenHashKey:                cfg.Auth.TokenHashKey,
+			JWTSigningKeyFile:           cfg.Auth.JWTSigningKeyFile,
+			AccessTTL:                   cfg.Auth.AccessTTL,
+			RefreshTTL:                  cfg.Auth.RefreshTTL,
+			RefreshRetentionTTL:         cfg.Auth.RefreshRetentionTTL,
+			RequireEmailConfirmation:    cfg.Auth.RequireEmailConfirmation,
+			VerificationTTL:             cfg.Auth.VerificationTTL,
+			PasswordResetTTL:            cfg.Auth.PasswordResetTTL,
+			TwoFactorIssuer:             cfg.Auth.TwoFactorIssuer,
+			TrustedDeviceTTL:            cfg.Auth.TrustedDeviceTTL,
+			ReauthMaxAge:                cfg.Auth.ReauthMaxAge,
+			MaxSessions:                 cfg.Auth.MaxSessions,
+			MaxSessionsPerClient:        cfg.Auth.MaxSessionsPerClient,
+			SessionLimitPolicy:          cfg.Auth.SessionLimitPolicy,
+			SessionAbsoluteTTL:          cfg.Auth.SessionAbsoluteTTL,
+			SessionIdleTTLPerClient:     cfg.Auth.SessionIdleTTLPerClient,
+			SessionAbsoluteTTLPerClient: cfg.Auth.SessionAbsoluteTTLPerClient,
+			SessionCacheSize:            cfg.Auth.SessionCacheSize,
+			SessionCacheTTL:             cfg.Auth.SessionCacheTTL,
+			AccessTokenMaxTTL:           cfg.Auth.AccessTokenMaxTTL,
+			OAuthIssuer:                 cfg.Auth.OAuthIssuer,
+			OIDCSigningKeyFile:          cfg.Auth.OIDCSigningKeyFile,
+			OIDCLoginURL:                cfg.Auth.OIDCLoginURL,
+			DeviceVerificationURL:       cfg.Auth.DeviceVerificationURL,
+		},
+		Risk: userspublic.RiskConfig{
+			Enabled:                cfg.Risk.Enabled,
+			NewIPWeight:            cfg.Risk.NewIPWeight,
+			NewUserAgentWeight:     cfg.Risk.NewUserAgentWeight,
+			NewCountryWeight:       cfg.Risk.NewCountryWeight,
+			ImpossibleTravelWeight: cfg.Risk.ImpossibleTravelWeight,
+			FailureWeight:          cfg.Risk.FailureWeight,
+			MaxFailures:            cfg.Risk.MaxFailures,
+			FailureWindow:          cfg.Risk.FailureWindow,
+			MaxTravelSpeed:         float64(cfg.Risk.MaxTravelSpeed),
+			CaptchaScore:           cfg.Risk.CaptchaScore,
+			EmailOTPScore:          cfg.Risk.EmailOTPScore,
+			DenyScore:              cfg.Risk.DenyScore,
+		},
+		GeoIP: userspublic.GeoIPConfig{
+			DatabasePath: cfg.GeoIP.DatabasePath,
+		},
+		Captcha: userspublic.CaptchaConfig{
+			VerifyURL: cfg.Captcha.VerifyURL,
+			Secret:    cfg.Captcha.Secret,
+		},
+		Recovery: userspublic.RecoveryConfig{
+			Delay:     cfg.Recovery.Delay,
+			Window:    cfg.Recovery.Window,
+			CancelURL: cfg.Recovery.CancelURL,
 		},
 		Telegram: userspublic.TelegramConfig{
 			BotToken:    cfg.Telegram.BotToken,
@@ -1,13 +1,49 @@
 package app
 
 import (
+	"net/http"
+	"strings"
+
 	"github.com/go-chi/chi/v5"
 
+	pconfig "github.com/vaaxooo/xbackend/internal/platform/config"
 	usershttp "github.com/vaaxooo/xbackend/internal/platform/http/users"
 )
 
 // RegisterAPIV1 registers all HTTP routes for API v1.
 // Versioning is done at the router boundary to keep handlers clean.
-func RegisterAPIV1(r chi.Router, modules *Modules) {
-	usershttp.RegisterV1(r, modules.Users.Service, modules.Users.Auth)
+func RegisterAPIV1(r chi.Router, modules *Modules, cfg *pconfig.Config) {
+	usershttp.RegisterV1(r, modules.Users.Service, modules.Users.Auth, usershttp.Options{
+		Geo:                 modules.Users.Geo,
+		Cookies:             UsersCookies(cfg),
+		RevocationFeedToken: cfg.Auth.RevocationFeedToken,
+		AdminToken:          cfg.Auth.AdminToken,
+		OAuthClients:        cfg.Auth.OAuthClientsEnabled,
+		OIDC:                cfg.Auth.OIDCSigningKeyFile != "",
+		AccessTokenKeys:     cfg.Auth.JWTSigningKeyFile != "",
+		DeviceFlow:          cfg.Auth.DeviceVerificationURL != "",
+	})
+}
+
+// UsersCookies builds the cookie mode settings of the users routes. Origins
+// allowed by CORS are trusted for CSRF checks.
+func UsersCookies(cfg *pconfig.Config) usershttp.CookieConfig {
+	sameSite := http.SameSiteStrictMode
+	switch strings.ToLower(cfg.Cookie.SameSite) {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+	return usershttp.CookieConfig{
+		Enabled:        cfg.Cookie.Enabled,
+		Name:           cfg.Cookie.Name,
+		CSRFName:       cfg.Cookie.CSRFName,
+		Domain:         cfg.Cookie.Domain,
+		Path:           cfg.Cookie.Path,
+		SameSite:       sameSite,
+		Secure:         cfg.Cookie.Secure,
+		MaxAge:         cfg.Auth.RefreshTTL,
+		TrustedOrigins: cfg.HTTP.CORSAllowedOrigins,
+	}
 }
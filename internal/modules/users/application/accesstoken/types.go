@@ -0,0 +1,45 @@
+package accesstoken
+
+import "time"
+
+// CreateInput names a new personal access token. ExpiresIn defaults to
+// DefaultTTL; AuthTime is when the caller's session last authenticated.
+type CreateInput struct {
+	UserID    string
+	Name      string
+	Scopes    []string
+	ExpiresIn time.Duration
+	AuthTime  time.Time
+}
+
+// CreateOutput carries the token itself, which is not stored and cannot be
+// shown again.
+type CreateOutput struct {
+	Token       string
+	AccessToken AccessToken
+}
+
+type ListInput struct {
+	UserID string
+}
+
+type RevokeInput struct {
+	UserID  string
+	TokenID string
+}
+
+// AccessToken describes a personal access token without the token itself;
+// Prefix is its start.
+type AccessToken struct {
+	ID         string
+	Name       string
+	Prefix     string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type Output struct {
+	Tokens []AccessToken
+}
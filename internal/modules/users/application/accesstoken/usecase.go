@@ -0,0 +1,129 @@
+package accesstoken
+
+import (
+	"context"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+const (
+	// DefaultTTL is how long a token lives when the user does not say.
+	DefaultTTL = 30 * 24 * time.Hour
+	// DefaultMaxTTL bounds the lifetime users may ask for when no bound is
+	// configured.
+	DefaultMaxTTL = 365 * 24 * time.Hour
+	// shownPrefixLength is how much of a token is kept to tell it apart.
+	shownPrefixLength = len(domain.PersonalAccessTokenPrefix) + 6
+)
+
+// UseCase manages the personal access tokens of a user. Creating one is
+// as sensitive as linking a provider, so it needs a recent login.
+type UseCase struct {
+	tokens       domain.PersonalAccessTokenRepository
+	reauthMaxAge time.Duration
+	maxTTL       time.Duration
+}
+
+func New(tokens domain.PersonalAccessTokenRepository, reauthMaxAge, maxTTL time.Duration) *UseCase {
+	if reauthMaxAge <= 0 {
+		reauthMaxAge = common.DefaultReauthMaxAge
+	}
+	if maxTTL <= 0 {
+		maxTTL = DefaultMaxTTL
+	}
+	return &UseCase{tokens: tokens, reauthMaxAge: reauthMaxAge, maxTTL: maxTTL}
+}
+
+func (uc *UseCase) Create(ctx context.Context, in CreateInput) (CreateOutput, error) {
+	userID, err := domain.ParseUserID(in.UserID)
+	if err != nil {
+		return CreateOutput{}, err
+	}
+	if err := common.RequireRecentAuth(in.AuthTime, uc.reauthMaxAge); err != nil {
+		return CreateOutput{}, err
+	}
+	ttl := in.ExpiresIn
+	if ttl == 0 {
+		ttl = min(DefaultTTL, uc.maxTTL)
+	}
+	if ttl < 0 || ttl > uc.maxTTL {
+		return CreateOutput{}, domain.ErrInvalidTokenExpiry
+	}
+
+	active, err := uc.tokens.ListByUser(ctx, userID)
+	if err != nil {
+		return CreateOutput{}, common.NormalizeError(err)
+	}
+	if len(active) >= domain.MaxPersonalAccessTokens {
+		return CreateOutput{}, domain.ErrTokenLimitReached
+	}
+
+	secret, err := common.NewRefreshToken()
+	if err != nil {
+		return CreateOutput{}, common.NormalizeError(err)
+	}
+	raw := domain.PersonalAccessTokenPrefix + secret
+	token, err := domain.NewPersonalAccessToken(userID, in.Name, raw[:shownPrefixLength], common.HashToken(raw), in.Scopes, time.Now().UTC(), ttl)
+	if err != nil {
+		return CreateOutput{}, err
+	}
+	if err := uc.tokens.Create(ctx, token); err != nil {
+		return CreateOutput{}, common.NormalizeError(err)
+	}
+	return CreateOutput{Token: raw, AccessToken: toAccessToken(token)}, nil
+}
+
+func (uc *UseCase) List(ctx context.Context, in ListInput) (Output, error) {
+	userID, err := domain.ParseUserID(in.UserID)
+	if err != nil {
+		return Output{}, err
+	}
+
+	tokens, err := uc.tokens.ListByUser(ctx, userID)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+
+	now := time.Now().UTC()
+	out := Output{Tokens: make([]AccessToken, 0, len(tokens))}
+	for _, t := range tokens {
+		if t.IsValid(now) {
+			out.Tokens = append(out.Tokens, toAccessToken(t))
+		}
+	}
+	return out, nil
+}
+
+func (uc *UseCase) Revoke(ctx context.Context, in RevokeInput) (struct{}, error) {
+	userID, err := domain.ParseUserID(in.UserID)
+	if err != nil {
+		return struct{}{}, err
+	}
+
+	token, found, err := uc.tokens.GetByID(ctx, in.TokenID)
+	if err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	if !found || token.UserID != userID {
+		return struct{}{}, domain.ErrUnauthorized
+	}
+
+	if err := uc.tokens.Revoke(ctx, token.ID); err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	return struct{}{}, nil
+}
+
+func toAccessToken(t domain.PersonalAccessToken) AccessToken {
+	return AccessToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
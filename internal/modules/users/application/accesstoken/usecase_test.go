@@ -0,0 +1,123 @@
+package accesstoken
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+type tokenRepoStub struct {
+	tokens  []domain.PersonalAccessToken
+	revoked string
+}
+
+func (s *tokenRepoStub) Create(_ context.Context, t domain.PersonalAccessToken) error {
+	s.tokens = append(s.tokens, t)
+	return nil
+}
+
+func (s *tokenRepoStub) GetByHash(context.Context, string) (domain.PersonalAccessToken, bool, error) {
+	return domain.PersonalAccessToken{}, false, nil
+}
+
+func (s *tokenRepoStub) GetByID(_ context.Context, id string) (domain.PersonalAccessToken, bool, error) {
+	for _, t := range s.tokens {
+		if t.ID == id {
+			return t, true, nil
+		}
+	}
+	return domain.PersonalAccessToken{}, false, nil
+}
+
+func (s *tokenRepoStub) ListByUser(_ context.Context, userID domain.UserID) ([]domain.PersonalAccessToken, error) {
+	var out []domain.PersonalAccessToken
+	for _, t := range s.tokens {
+		if t.UserID == userID {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (s *tokenRepoStub) Touch(context.Context, string, time.Time) error { return nil }
+
+func (s *tokenRepoStub) Revoke(_ context.Context, id string) error {
+	s.revoked = id
+	return nil
+}
+
+func (s *tokenRepoStub) RevokeByUser(context.Context, domain.UserID) error { return nil }
+
+func TestCreateStoresOnlyTheHash(t *testing.T) {
+	repo := &tokenRepoStub{}
+	uc := New(repo, time.Minute, 90*24*time.Hour)
+	userID := domain.NewUserID()
+
+	out, err := uc.Create(context.Background(), CreateInput{
+		UserID:   userID.String(),
+		Name:     " ci ",
+		Scopes:   []string{domain.ScopeSessionsRead, domain.ScopeProfileRead, domain.ScopeProfileRead},
+		AuthTime: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if !strings.HasPrefix(out.Token, domain.PersonalAccessTokenPrefix) || !strings.HasPrefix(out.Token, out.AccessToken.Prefix) {
+		t.Fatalf("unexpected token %q prefix %q", out.Token, out.AccessToken.Prefix)
+	}
+	stored := repo.tokens[0]
+	if stored.TokenHash != common.HashToken(out.Token) || strings.Contains(stored.TokenHash, out.Token) {
+		t.Fatalf("expected only the hash to be stored")
+	}
+	if stored.Name != "ci" || len(stored.Scopes) != 2 || stored.Scopes[0] != domain.ScopeProfileRead {
+		t.Fatalf("unexpected token: %+v", stored)
+	}
+	if got := stored.ExpiresAt.Sub(stored.CreatedAt); got != DefaultTTL {
+		t.Fatalf("expected the default lifetime, got %v", got)
+	}
+
+	list, err := uc.List(context.Background(), ListInput{UserID: userID.String()})
+	if err != nil || len(list.Tokens) != 1 || list.Tokens[0].ID != stored.ID {
+		t.Fatalf("unexpected list %+v err=%v", list, err)
+	}
+
+	if _, err := uc.Revoke(context.Background(), RevokeInput{UserID: domain.NewUserID().String(), TokenID: stored.ID}); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected other users' tokens to be out of reach, got %v", err)
+	}
+	if _, err := uc.Revoke(context.Background(), RevokeInput{UserID: userID.String(), TokenID: stored.ID}); err != nil || repo.revoked != stored.ID {
+		t.Fatalf("expected the token to be revoked, got %v", err)
+	}
+}
+
+func TestCreateRejectsBadInput(t *testing.T) {
+	repo := &tokenRepoStub{}
+	uc := New(repo, time.Minute, 90*24*time.Hour)
+	userID := domain.NewUserID().String()
+	valid := CreateInput{UserID: userID, Name: "ci", Scopes: []string{domain.ScopeProfileRead}, AuthTime: time.Now()}
+
+	cases := map[string]struct {
+		mutate func(*CreateInput)
+		want   error
+	}{
+		"stale login":   {func(in *CreateInput) { in.AuthTime = time.Now().Add(-time.Hour) }, domain.ErrReauthenticationRequired},
+		"no name":       {func(in *CreateInput) { in.Name = " " }, domain.ErrInvalidTokenName},
+		"unknown scope": {func(in *CreateInput) { in.Scopes = []string{"admin"} }, domain.ErrInvalidScope},
+		"no scope":      {func(in *CreateInput) { in.Scopes = nil }, domain.ErrInvalidScope},
+		"too long":      {func(in *CreateInput) { in.ExpiresIn = 91 * 24 * time.Hour }, domain.ErrInvalidTokenExpiry},
+	}
+	for name, tc := range cases {
+		in := valid
+		tc.mutate(&in)
+		if _, err := uc.Create(context.Background(), in); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+	if len(repo.tokens) != 0 {
+		t.Fatalf("expected nothing to be stored")
+	}
+}
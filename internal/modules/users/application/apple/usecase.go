@@ -29,13 +29,13 @@ type tokenVerifier interface {
 }
 
 type UseCase struct {
-	users      domain.UserRepository
-	identities domain.IdentityRepository
-	refresh    domain.RefreshTokenRepository
-	access     common.AccessTokenIssuer
-	accessTTL  time.Duration
-	refreshTTL time.Duration
-	verifier   tokenVerifier
+	users         domain.UserRepository
+	identities    domain.IdentityRepository
+	refresh       domain.RefreshTokenRepository
+	access        common.AccessTokenIssuer
+	accessTTL     time.Duration
+	sessionPolicy common.SessionPolicy
+	verifier      tokenVerifier
 }
 
 func New(
@@ -45,22 +45,19 @@ func New(
 	access common.AccessTokenIssuer,
 	verifier tokenVerifier,
 	accessTTL time.Duration,
-	refreshTTL time.Duration,
+	sessionPolicy common.SessionPolicy,
 ) *UseCase {
 	if accessTTL == 0 {
 		accessTTL = 15 * time.Minute
 	}
-	if refreshTTL == 0 {
-		refreshTTL = 30 * 24 * time.Hour
-	}
 	return &UseCase{
-		users:      users,
-		identities: identities,
-		refresh:    refresh,
-		access:     access,
-		verifier:   verifier,
-		accessTTL:  accessTTL,
-		refreshTTL: refreshTTL,
+		users:         users,
+		identities:    identities,
+		refresh:       refresh,
+		access:        access,
+		verifier:      verifier,
+		accessTTL:     accessTTL,
+		sessionPolicy: sessionPolicy,
 	}
 }
 
@@ -140,12 +137,12 @@ func (uc *UseCase) issueTokens(ctx context.Context, user domain.User) (login.Out
 	}
 	refreshHash := common.HashToken(refreshRaw)
 	now := time.Now().UTC()
-	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, user.ID, refreshHash, now, uc.refreshTTL)
+	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, user.ID, refreshHash, now, uc.sessionPolicy, domain.LoginMethodApple, domain.AMRFederated)
 	if err != nil {
 		return login.Output{}, common.NormalizeError(err)
 	}
 
-	accessToken, err := uc.access.Issue(user.ID.String(), refreshRecord.ID, uc.accessTTL)
+	accessToken, err := uc.access.Issue(common.SessionClaims(refreshRecord), uc.accessTTL)
 	if err != nil {
 		return login.Output{}, common.NormalizeError(err)
 	}
@@ -158,15 +155,16 @@ func (uc *UseCase) issueTokens(ctx context.Context, user domain.User) (login.Out
 	}
 
 	return login.Output{
-		UserID:       user.ID.String(),
-		Email:        user.Email,
-		FirstName:    user.FirstName,
-		LastName:     user.LastName,
-		MiddleName:   user.MiddleName,
-		DisplayName:  user.DisplayName,
-		AvatarURL:    user.AvatarURL,
-		AccessToken:  accessToken,
-		RefreshToken: refreshRaw,
+		UserID:           user.ID.String(),
+		Email:            user.Email,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		MiddleName:       user.MiddleName,
+		DisplayName:      user.DisplayName,
+		AvatarURL:        user.AvatarURL,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshRaw,
+		RefreshExpiresAt: refreshRecord.ExpiresAt,
 	}, nil
 }
 
@@ -0,0 +1,155 @@
+package challenge
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/login"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// Notifier announces that a challenge changed. Implementations must deliver
+// the announcement to every instance (Postgres NOTIFY), not just this one.
+type Notifier interface {
+	Notify(ctx context.Context, challengeID string) error
+}
+
+// Subscriber delivers change announcements for one challenge. The returned
+// channel may coalesce several announcements into one wake-up; the cancel
+// function releases the subscription.
+type Subscriber interface {
+	Subscribe(challengeID string) (<-chan struct{}, func())
+}
+
+type WatchInput struct {
+	ChallengeID string
+	// LastEventID is the id of the last event the client received. The
+	// current state is sent first unless it is exactly that event.
+	LastEventID string
+}
+
+// Event is a snapshot of the challenge pushed to watchers. It never carries
+// tokens: those are returned to whoever completes the last step.
+type Event struct {
+	ID             string
+	Status         string
+	RequiredSteps  []string
+	CompletedSteps []string
+	ExpiresIn      int64
+	Steps          []login.StepInfo
+}
+
+// Done reports whether no further events will follow.
+func (e Event) Done() bool {
+	return e.Status != string(domain.ChallengeStatusPending)
+}
+
+// Watcher streams challenge changes. Without a subscriber it falls back to
+// polling the repository.
+type Watcher struct {
+	challenges   domain.ChallengeRepository
+	subscriber   Subscriber
+	pollInterval time.Duration
+}
+
+func NewWatcher(challenges domain.ChallengeRepository, subscriber Subscriber, pollInterval time.Duration) *Watcher {
+	if pollInterval <= 0 {
+		pollInterval = 2 * time.Second
+	}
+	return &Watcher{challenges: challenges, subscriber: subscriber, pollInterval: pollInterval}
+}
+
+// Watch sends the challenge state whenever it changes until the challenge
+// is completed or expired, or ctx is done. The channel is closed afterwards.
+func (w *Watcher) Watch(ctx context.Context, in WatchInput) (<-chan Event, error) {
+	// Subscribe before the first read so no change slips in between.
+	var wake <-chan struct{}
+	cancel := func() {}
+	if w.subscriber != nil {
+		wake, cancel = w.subscriber.Subscribe(in.ChallengeID)
+	}
+	challenge, ok, err := w.challenges.GetByID(ctx, in.ChallengeID)
+	if err != nil || !ok {
+		cancel()
+		return nil, domain.ErrUnauthorized
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer cancel()
+
+		var poll <-chan time.Time
+		if wake == nil {
+			ticker := time.NewTicker(w.pollInterval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+		last := in.LastEventID
+		for {
+			now := time.Now().UTC()
+			event := newEvent(challenge, now)
+			if event.ID != last {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+				last = event.ID
+			}
+			if event.Done() {
+				return
+			}
+
+			expiry := time.NewTimer(challenge.ExpiresAt.Sub(now))
+			select {
+			case <-ctx.Done():
+				expiry.Stop()
+				return
+			case <-wake:
+			case <-poll:
+			case <-expiry.C:
+			}
+			expiry.Stop()
+
+			next, ok, err := w.challenges.GetByID(ctx, in.ChallengeID)
+			if err != nil || !ok {
+				return
+			}
+			challenge = next
+		}
+	}()
+	return events, nil
+}
+
+// newEvent projects the stored challenge. A consumed challenge is stored as
+// expired, so a challenge with every step done is reported as completed.
+// The id changes with every stored update and once the challenge times out.
+func newEvent(challenge domain.Challenge, now time.Time) Event {
+	id := challenge.UpdatedAt
+	status := domain.ChallengeStatusPending
+	switch {
+	case len(challenge.CompletedSteps) >= len(challenge.RequiredSteps):
+		status = domain.ChallengeStatusCompleted
+	case challenge.Status != domain.ChallengeStatusPending:
+		status = challenge.Status
+	case challenge.IsExpired(now):
+		status = domain.ChallengeStatusExpired
+		if challenge.ExpiresAt.After(id) {
+			id = challenge.ExpiresAt
+		}
+	}
+	expiresIn := int64(challenge.ExpiresAt.Sub(now).Seconds())
+	if expiresIn < 0 || status != domain.ChallengeStatusPending {
+		expiresIn = 0
+	}
+	return Event{
+		ID:             strconv.FormatInt(id.UnixMicro(), 10),
+		Status:         string(status),
+		RequiredSteps:  stepsToString(challenge.RequiredSteps),
+		CompletedSteps: stepsToString(challenge.CompletedSteps),
+		ExpiresIn:      expiresIn,
+		Steps:          stepInfos(challenge),
+	}
+}
@@ -0,0 +1,114 @@
+package challenge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestWatchStreamsChangesUntilCompleted(t *testing.T) {
+	now := time.Now().UTC()
+	ch := domain.NewChallenge(domain.NewUserID(), "auth_challenge", []domain.ChallengeStep{domain.ChallengeStepEmailVerification}, now.Add(time.Minute))
+	repo := &challengeRepoMock{challenge: ch}
+	sub := &subscriberMock{wake: make(chan struct{}, 1)}
+	w := NewWatcher(repo, sub, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := w.Watch(ctx, WatchInput{ChallengeID: ch.ID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first := <-events
+	if first.Status != string(domain.ChallengeStatusPending) || first.ExpiresIn <= 0 {
+		t.Fatalf("expected pending snapshot, got %+v", first)
+	}
+
+	// A consumed challenge is stored as expired with every step done.
+	done := ch.WithCompleted(domain.ChallengeStepEmailVerification, now.Add(time.Second))
+	repo.challenge = done.WithStatus(domain.ChallengeStatusExpired, now.Add(2*time.Second))
+	sub.wake <- struct{}{}
+
+	second, ok := <-events
+	if !ok || second.Status != string(domain.ChallengeStatusCompleted) || second.ID == first.ID {
+		t.Fatalf("expected completed event with a new id, got %+v", second)
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("expected the stream to close after completion")
+	}
+	if !sub.cancelled {
+		t.Fatal("expected the subscription to be released")
+	}
+}
+
+func TestWatchResumesFromLastEventID(t *testing.T) {
+	now := time.Now().UTC()
+	ch := domain.NewChallenge(domain.NewUserID(), "auth_challenge", []domain.ChallengeStep{domain.ChallengeStepTOTP}, now.Add(time.Minute))
+	repo := &challengeRepoMock{challenge: ch}
+	sub := &subscriberMock{wake: make(chan struct{}, 1)}
+	w := NewWatcher(repo, sub, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	seen := newEvent(ch, now).ID
+	events, err := w.Watch(ctx, WatchInput{ChallengeID: ch.ID, LastEventID: seen})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	repo.challenge = ch.WithStepState(domain.ChallengeStepTOTP, domain.StepState{AttemptsLeft: 2}, now.Add(time.Second))
+	sub.wake <- struct{}{}
+
+	event := <-events
+	if event.ID == seen || len(event.Steps) != 1 || event.Steps[0].AttemptsLeft != 2 {
+		t.Fatalf("expected only the change after the last event, got %+v", event)
+	}
+}
+
+func TestWatchUnknownChallenge(t *testing.T) {
+	sub := &subscriberMock{wake: make(chan struct{})}
+	w := NewWatcher(&challengeRepoMock{}, sub, 0)
+	if _, err := w.Watch(context.Background(), WatchInput{ChallengeID: "missing"}); err != domain.ErrUnauthorized {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+	if !sub.cancelled {
+		t.Fatal("expected the subscription to be released")
+	}
+}
+
+func TestVerifyStepNotifiesWatchers(t *testing.T) {
+	ch := domain.NewChallenge(domain.NewUserID(), "auth_challenge", []domain.ChallengeStep{domain.ChallengeStepTOTP}, time.Now().UTC().Add(time.Minute))
+	notifier := &notifierMock{}
+	uc := &UseCase{
+		challenges: &challengeRepoMock{challenge: ch},
+		identities: &identityRepoMock{},
+		users:      &userRepoMock{user: domain.NewUser(ch.UserID, "", mustDisplayName(t, "user"), time.Now().UTC())},
+		notifier:   notifier,
+	}
+	uc.RegisterStep(domain.ChallengeStepTOTP, stepMock{answer: "123456"}, StepPolicy{Attempts: 3, Lock: time.Minute})
+
+	if _, err := uc.VerifyStep(context.Background(), VerifyStepInput{ChallengeID: ch.ID, Step: "totp", Value: "000000"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(notifier.ids) != 1 || notifier.ids[0] != ch.ID {
+		t.Fatalf("expected a notification for the failed attempt, got %v", notifier.ids)
+	}
+}
+
+type subscriberMock struct {
+	wake      chan struct{}
+	cancelled bool
+}
+
+func (m *subscriberMock) Subscribe(string) (<-chan struct{}, func()) {
+	return m.wake, func() { m.cancelled = true }
+}
+
+type notifierMock struct{ ids []string }
+
+func (m *notifierMock) Notify(_ context.Context, id string) error {
+	m.ids = append(m.ids, id)
+	return nil
+}
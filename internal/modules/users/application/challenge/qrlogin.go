@@ -0,0 +1,301 @@
+package challenge
+
+import (
+	"context"
+	"crypto/subtle"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+const (
+	// qrLoginTTL bounds how long a QR code can be scanned and approved.
+	qrLoginTTL = 2 * time.Minute
+	// qrSessionWait is how long a desktop poll waits for the approval
+	// before it is answered with the pending challenge.
+	qrSessionWait = 25 * time.Second
+)
+
+// Answers of the mobile app to a scanned QR code.
+const (
+	QRConsentApprove = "approve"
+	QRConsentDeny    = "deny"
+)
+
+type StartQRLoginInput struct{}
+
+// StartQRLoginOutput is shown by the desktop: Code as the QR code, while
+// ChallengeID and LoginToken stay with it to pick up the session.
+type StartQRLoginOutput struct {
+	ChallengeID string
+	Code        string
+	LoginToken  string
+	ExpiresIn   time.Duration
+}
+
+// ScanQRLoginInput is sent by the mobile app, first without Consent to show
+// the desktop to the user, then with QRConsentApprove or QRConsentDeny.
+type ScanQRLoginInput struct {
+	UserID    string
+	SessionID string
+	Code      string
+	Consent   string
+}
+
+// ScanQRLoginOutput describes the desktop that shows the QR code. Status is
+// the challenge status once answered.
+type ScanQRLoginOutput struct {
+	Status      string
+	IP          string
+	UserAgent   string
+	Country     string
+	City        string
+	RequestedAt time.Time
+}
+
+type QRSessionInput struct {
+	ChallengeID string
+	LoginToken  string
+}
+
+// StartQRLogin opens a QR login for the desktop of the request. Its
+// challenge has no user until a mobile app approves it.
+func (uc *UseCase) StartQRLogin(ctx context.Context, _ StartQRLoginInput) (StartQRLoginOutput, error) {
+	if uc.qrLogins == nil {
+		return StartQRLoginOutput{}, domain.ErrUnauthorized
+	}
+	code, err := common.NewRefreshToken()
+	if err != nil {
+		return StartQRLoginOutput{}, common.NormalizeError(err)
+	}
+	loginToken, err := common.NewRefreshToken()
+	if err != nil {
+		return StartQRLoginOutput{}, common.NormalizeError(err)
+	}
+
+	now := time.Now().UTC()
+	challenge := domain.NewChallenge("", domain.ChallengeTypeQRLogin, []domain.ChallengeStep{domain.ChallengeStepQRApproval}, now.Add(qrLoginTTL))
+	q := domain.NewQRLogin(challenge.ID, common.HashToken(code), common.HashToken(loginToken), now, qrLoginTTL)
+	meta, _ := common.RequestMetaFromContext(ctx)
+	q.IP = meta.IP
+	q.UserAgent = meta.UserAgent
+	q.Country = meta.Country
+	q.City = meta.City
+	if err := uc.challenges.Create(ctx, challenge); err != nil {
+		return StartQRLoginOutput{}, common.NormalizeError(err)
+	}
+	if err := uc.qrLogins.Create(ctx, q); err != nil {
+		return StartQRLoginOutput{}, common.NormalizeError(err)
+	}
+	return StartQRLoginOutput{
+		ChallengeID: challenge.ID,
+		Code:        code,
+		LoginToken:  loginToken,
+		ExpiresIn:   qrLoginTTL,
+	}, nil
+}
+
+// ScanQRLogin looks up the desktop of a scanned QR code for the signed in
+// user, and approves or denies it once the user answered. Approval
+// completes the challenge of the QR login with the authentication of the
+// approving session; watchers of the challenge hear about either answer.
+func (uc *UseCase) ScanQRLogin(ctx context.Context, in ScanQRLoginInput) (ScanQRLoginOutput, error) {
+	if uc.qrLogins == nil {
+		return ScanQRLoginOutput{}, domain.ErrInvalidQRCode
+	}
+	now := time.Now().UTC()
+	session, found, err := uc.refresh.GetByID(ctx, in.SessionID)
+	if err != nil {
+		return ScanQRLoginOutput{}, common.NormalizeError(err)
+	}
+	if !found || session.UserID.String() != in.UserID || !session.IsValid(now) {
+		return ScanQRLoginOutput{}, domain.ErrUnauthorized
+	}
+
+	if in.Code == "" {
+		return ScanQRLoginOutput{}, domain.ErrInvalidQRCode
+	}
+	q, found, err := uc.qrLogins.GetByCode(ctx, common.HashToken(in.Code))
+	if err != nil {
+		return ScanQRLoginOutput{}, common.NormalizeError(err)
+	}
+	if !found || !q.IsPending(now) {
+		return ScanQRLoginOutput{}, domain.ErrInvalidQRCode
+	}
+	challenge, found, err := uc.challenges.GetByID(ctx, q.ChallengeID)
+	if err != nil {
+		return ScanQRLoginOutput{}, common.NormalizeError(err)
+	}
+	if !found || challenge.Type != domain.ChallengeTypeQRLogin || challenge.Status != domain.ChallengeStatusPending || challenge.IsExpired(now) {
+		return ScanQRLoginOutput{}, domain.ErrInvalidQRCode
+	}
+
+	switch in.Consent {
+	case "":
+	case QRConsentApprove:
+		q = q.Approve(session.UserID, session.AMR, now)
+		challenge.UserID = session.UserID
+		challenge = challenge.WithCompleted(domain.ChallengeStepQRApproval, now)
+	case QRConsentDeny:
+		q = q.Deny(session.UserID, now)
+		challenge = challenge.WithStatus(domain.ChallengeStatusCancelled, now)
+	default:
+		return ScanQRLoginOutput{}, domain.ErrInvalidQRCode
+	}
+	if in.Consent != "" {
+		decided, err := uc.qrLogins.Decide(ctx, q)
+		if err != nil {
+			return ScanQRLoginOutput{}, common.NormalizeError(err)
+		}
+		if !decided {
+			return ScanQRLoginOutput{}, domain.ErrInvalidQRCode
+		}
+		if err := uc.update(ctx, challenge); err != nil {
+			return ScanQRLoginOutput{}, common.NormalizeError(err)
+		}
+	}
+
+	return ScanQRLoginOutput{
+		Status:      string(challenge.Status),
+		IP:          q.IP,
+		UserAgent:   q.UserAgent,
+		Country:     q.Country,
+		City:        q.City,
+		RequestedAt: q.CreatedAt,
+	}, nil
+}
+
+// ClaimQRLogin answers a poll of the desktop that started a QR login: with
+// a session once the mobile app approved it, otherwise with the challenge.
+// The session is opened for the desktop of the request, signed in with the
+// authentication methods of the approving session, and only once.
+func (uc *UseCase) ClaimQRLogin(ctx context.Context, in QRSessionInput) (Output, error) {
+	q, err := uc.qrLogin(ctx, in)
+	if err != nil {
+		return Output{}, err
+	}
+	challenge, ok, err := uc.challenges.GetByID(ctx, in.ChallengeID)
+	if err != nil || !ok || challenge.Type != domain.ChallengeTypeQRLogin {
+		return Output{}, domain.ErrUnauthorized
+	}
+	now := time.Now().UTC()
+	info, status := challengeInfo(challenge, now)
+	if challenge.Status != domain.ChallengeStatusCompleted || challenge.IsExpired(now) {
+		return Output{Status: status, Challenge: info}, nil
+	}
+
+	user, ok, err := uc.users.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if !ok || q.UserID != user.ID || user.Suspended || (user.BlockedUntil != nil && user.BlockedUntil.After(now)) {
+		return Output{}, domain.ErrUnauthorized
+	}
+	if err := uc.consumeChallenge(ctx, challenge); err != nil {
+		return Output{}, err
+	}
+
+	refreshRaw, err := common.NewRefreshToken()
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	session := common.NewHandedOverRecord(ctx, user.ID, common.HashToken(refreshRaw), now, uc.sessionPolicy, domain.LoginMethodQR, q.AMR)
+	claimed, err := uc.qrLogins.Claim(ctx, q.ChallengeID, session.ID, now)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if !claimed {
+		return Output{}, domain.ErrUnauthorized
+	}
+	if err := uc.refresh.Create(ctx, session); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	accessToken, err := uc.access.Issue(common.SessionClaims(session), uc.accessTTL)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+
+	return Output{
+		UserID:           user.ID.String(),
+		Email:            user.Email,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		MiddleName:       user.MiddleName,
+		DisplayName:      user.DisplayName,
+		AvatarURL:        user.AvatarURL,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshRaw,
+		RefreshExpiresAt: session.ExpiresAt,
+		Status:           string(domain.ChallengeStatusCompleted),
+		Challenge:        info,
+	}, nil
+}
+
+// qrLogin returns the QR login of the challenge if the login token is the
+// one it was started with. Claimed logins are gone.
+func (uc *UseCase) qrLogin(ctx context.Context, in QRSessionInput) (domain.QRLogin, error) {
+	if uc.qrLogins == nil || in.ChallengeID == "" || in.LoginToken == "" {
+		return domain.QRLogin{}, domain.ErrUnauthorized
+	}
+	q, found, err := uc.qrLogins.GetByChallenge(ctx, in.ChallengeID)
+	if err != nil {
+		return domain.QRLogin{}, common.NormalizeError(err)
+	}
+	if !found || q.ClaimedAt != nil || subtle.ConstantTimeCompare([]byte(q.LoginTokenHash), []byte(common.HashToken(in.LoginToken))) != 1 {
+		return domain.QRLogin{}, domain.ErrUnauthorized
+	}
+	return q, nil
+}
+
+// QRSessions long-polls QR logins for the desktop: a poll waits until the
+// challenge is answered or times out, then claims the session in a unit of
+// work of its own, so that the wait holds no transaction.
+type QRSessions struct {
+	uc      *UseCase
+	watcher *Watcher
+	uow     common.UnitOfWork
+	wait    time.Duration
+}
+
+func NewQRSessions(uc *UseCase, watcher *Watcher, uow common.UnitOfWork, wait time.Duration) *QRSessions {
+	if wait <= 0 {
+		wait = qrSessionWait
+	}
+	return &QRSessions{uc: uc, watcher: watcher, uow: uow, wait: wait}
+}
+
+// Session waits at most the configured time, and ends early enough before
+// the deadline of ctx to still claim the session.
+func (s *QRSessions) Session(ctx context.Context, in QRSessionInput) (Output, error) {
+	if _, err := s.uc.qrLogin(ctx, in); err != nil {
+		return Output{}, err
+	}
+
+	wait := s.wait
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline) * 9 / 10; left < wait {
+			wait = left
+		}
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	events, err := s.watcher.Watch(waitCtx, WatchInput{ChallengeID: in.ChallengeID})
+	if err != nil {
+		cancel()
+		return Output{}, err
+	}
+	for event := range events {
+		if event.Done() {
+			break
+		}
+	}
+	cancel()
+
+	var out Output
+	err = s.uow.Do(ctx, func(ctx context.Context) error {
+		var err error
+		out, err = s.uc.ClaimQRLogin(ctx, in)
+		return err
+	})
+	return out, err
+}
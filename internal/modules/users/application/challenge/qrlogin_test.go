@@ -0,0 +1,166 @@
+package challenge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestQRLoginIssuesSessionToDesktop(t *testing.T) {
+	userID := domain.NewUserID()
+	authTime := time.Now().UTC().Add(-time.Hour)
+	phone := domain.RefreshToken{ID: "phone", UserID: userID, ExpiresAt: time.Now().UTC().Add(time.Hour), AuthTime: authTime, AMR: []string{domain.AMRPassword, domain.AMROTP}}
+	sessions := &qrSessionRepo{stepUpSessionRepo: stepUpSessionRepo{session: phone}}
+	challenges := &challengeRepoMock{}
+	logins := &qrLoginRepoMock{}
+	access := &stepUpIssuer{}
+	uc := &UseCase{
+		challenges:    challenges,
+		users:         &userRepoMock{user: domain.NewUser(userID, "", mustDisplayName(t, "user"), time.Now().UTC())},
+		refresh:       sessions,
+		access:        access,
+		accessTTL:     time.Minute,
+		sessionPolicy: common.SessionPolicy{IdleTimeout: time.Hour},
+		qrLogins:      logins,
+	}
+	desktop := common.WithRequestMeta(context.Background(), common.RequestMeta{IP: "198.51.100.7", UserAgent: "Desktop", Country: "NL"})
+
+	start, err := uc.StartQRLogin(desktop, StartQRLoginInput{})
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if challenges.created.Type != domain.ChallengeTypeQRLogin || challenges.created.UserID != "" || start.Code == "" || start.LoginToken == "" {
+		t.Fatalf("expected a QR challenge without a user, got %+v / %+v", challenges.created, start)
+	}
+	in := QRSessionInput{ChallengeID: start.ChallengeID, LoginToken: start.LoginToken}
+
+	out, err := uc.ClaimQRLogin(desktop, in)
+	if err != nil {
+		t.Fatalf("pending claim failed: %v", err)
+	}
+	if out.Status != "challenge_required" || out.AccessToken != "" {
+		t.Fatalf("expected the pending challenge, got %+v", out)
+	}
+	if _, err := uc.ClaimQRLogin(desktop, QRSessionInput{ChallengeID: start.ChallengeID, LoginToken: "guess"}); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected a wrong login token to be rejected, got %v", err)
+	}
+
+	scan := ScanQRLoginInput{UserID: userID.String(), SessionID: "phone", Code: start.Code}
+	device, err := uc.ScanQRLogin(context.Background(), scan)
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if device.Status != string(domain.ChallengeStatusPending) || device.IP != "198.51.100.7" || device.UserAgent != "Desktop" || device.Country != "NL" {
+		t.Fatalf("expected the desktop to be shown, got %+v", device)
+	}
+	if _, err := uc.ScanQRLogin(context.Background(), ScanQRLoginInput{UserID: userID.String(), SessionID: "phone", Code: "unknown"}); !errors.Is(err, domain.ErrInvalidQRCode) {
+		t.Fatalf("expected an unknown code to be rejected, got %v", err)
+	}
+
+	scan.Consent = QRConsentApprove
+	if device, err = uc.ScanQRLogin(context.Background(), scan); err != nil {
+		t.Fatalf("approve failed: %v", err)
+	}
+	if device.Status != string(domain.ChallengeStatusCompleted) || challenges.challenge.UserID != userID {
+		t.Fatalf("expected the challenge to be completed by the user, got %+v", challenges.challenge)
+	}
+	if _, err := uc.ScanQRLogin(context.Background(), scan); !errors.Is(err, domain.ErrInvalidQRCode) {
+		t.Fatalf("expected a second answer to be rejected, got %v", err)
+	}
+
+	out, err = NewQRSessions(uc, NewWatcher(challenges, nil, 0), directUnitOfWork{}, time.Second).Session(desktop, in)
+	if err != nil {
+		t.Fatalf("session failed: %v", err)
+	}
+	if out.Status != string(domain.ChallengeStatusCompleted) || out.AccessToken == "" || out.RefreshToken == "" || out.UserID != userID.String() {
+		t.Fatalf("expected tokens for the desktop, got %+v", out)
+	}
+	created := sessions.createdSession
+	if created.LoginMethod != domain.LoginMethodQR || created.IP != "198.51.100.7" || !created.AuthTime.IsZero() || len(created.AMR) != 2 {
+		t.Fatalf("expected a QR session of the desktop with the phone's authentication, got %+v", created)
+	}
+	if logins.login.SessionID != created.ID {
+		t.Fatalf("expected the login to be claimed by the session, got %+v", logins.login)
+	}
+	if _, err := uc.ClaimQRLogin(desktop, in); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected a claimed login to be gone, got %v", err)
+	}
+}
+
+func TestQRLoginDenied(t *testing.T) {
+	userID := domain.NewUserID()
+	phone := domain.RefreshToken{ID: "phone", UserID: userID, ExpiresAt: time.Now().UTC().Add(time.Hour)}
+	challenges := &challengeRepoMock{}
+	uc := &UseCase{challenges: challenges, refresh: &stepUpSessionRepo{session: phone}, qrLogins: &qrLoginRepoMock{}}
+
+	start, err := uc.StartQRLogin(context.Background(), StartQRLoginInput{})
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if _, err := uc.ScanQRLogin(context.Background(), ScanQRLoginInput{UserID: domain.NewUserID().String(), SessionID: "phone", Code: start.Code}); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected another user's session to be rejected, got %v", err)
+	}
+	if _, err := uc.ScanQRLogin(context.Background(), ScanQRLoginInput{UserID: userID.String(), SessionID: "phone", Code: start.Code, Consent: QRConsentDeny}); err != nil {
+		t.Fatalf("deny failed: %v", err)
+	}
+
+	out, err := uc.ClaimQRLogin(context.Background(), QRSessionInput{ChallengeID: start.ChallengeID, LoginToken: start.LoginToken})
+	if err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	if out.Status != string(domain.ChallengeStatusCancelled) || out.AccessToken != "" {
+		t.Fatalf("expected a cancelled login without tokens, got %+v", out)
+	}
+}
+
+// --- test doubles ---
+
+type qrLoginRepoMock struct {
+	login domain.QRLogin
+}
+
+func (m *qrLoginRepoMock) Create(_ context.Context, q domain.QRLogin) error {
+	m.login = q
+	return nil
+}
+func (m *qrLoginRepoMock) GetByCode(_ context.Context, codeHash string) (domain.QRLogin, bool, error) {
+	return m.login, m.login.CodeHash == codeHash, nil
+}
+func (m *qrLoginRepoMock) GetByChallenge(_ context.Context, challengeID string) (domain.QRLogin, bool, error) {
+	return m.login, m.login.ChallengeID == challengeID, nil
+}
+func (m *qrLoginRepoMock) Decide(_ context.Context, q domain.QRLogin) (bool, error) {
+	if m.login.DecidedAt != nil {
+		return false, nil
+	}
+	m.login = q
+	return true, nil
+}
+func (m *qrLoginRepoMock) Claim(_ context.Context, _ string, sessionID string, at time.Time) (bool, error) {
+	if m.login.ClaimedAt != nil {
+		return false, nil
+	}
+	m.login.ClaimedAt = &at
+	m.login.SessionID = sessionID
+	return true, nil
+}
+
+type qrSessionRepo struct {
+	stepUpSessionRepo
+	createdSession domain.RefreshToken
+}
+
+func (s *qrSessionRepo) Create(_ context.Context, token domain.RefreshToken) error {
+	s.createdSession = token
+	return nil
+}
+
+type directUnitOfWork struct{}
+
+func (directUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,208 @@
+package challenge
+
+import (
+	"context"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/totp"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// StepHandler verifies the user's answer to one kind of challenge step.
+//
+// Verify reports false for a wrong answer; errors are reserved for failures
+// that should abort the request. Side effects of a correct answer (marking
+// a code as used, confirming an email) belong in Verify: it runs in the same
+// transaction that completes the step.
+type StepHandler interface {
+	Verify(ctx context.Context, req StepRequest) (bool, error)
+}
+
+// StepSender is implemented by steps that deliver something to the user
+// (an emailed code). The challenge calls it when the user asks for a resend.
+type StepSender interface {
+	Send(ctx context.Context, challenge domain.Challenge) error
+}
+
+type StepRequest struct {
+	Challenge domain.Challenge
+	Value     string
+	Meta      common.RequestMeta
+}
+
+// StepPolicy limits wrong answers per step. Zero Attempts means failures are
+// not counted (e.g. captcha, which the provider rate-limits itself).
+type StepPolicy struct {
+	Attempts int
+	Lock     time.Duration
+}
+
+// Step is a handler together with the limit on its wrong answers.
+type Step struct {
+	Handler StepHandler
+	Policy  StepPolicy
+}
+
+// Attempt answers step of challenge with value. Wrong answers count against
+// the policy, and a step locked by them is not checked until the lock ends.
+// The returned challenge carries the new state of the step, and the step
+// completed if passed; storing it is up to the caller.
+func (s Step) Attempt(ctx context.Context, challenge domain.Challenge, step domain.ChallengeStep, value string, now time.Time) (domain.Challenge, bool, error) {
+	state, seen := challenge.StepState(step)
+	if !seen {
+		state = domain.StepState{AttemptsLeft: s.Policy.Attempts}
+	}
+	if state.IsLocked(now) {
+		return challenge, false, nil
+	}
+	if state.LockUntil != nil {
+		state = domain.StepState{AttemptsLeft: s.Policy.Attempts}
+		challenge = challenge.WithStepState(step, state, now)
+	}
+
+	meta, _ := common.RequestMetaFromContext(ctx)
+	passed, err := s.Handler.Verify(ctx, StepRequest{Challenge: challenge, Value: value, Meta: meta})
+	if err != nil {
+		return challenge, false, err
+	}
+	if !passed {
+		if s.Policy.Attempts > 0 {
+			state.AttemptsLeft--
+			if state.AttemptsLeft <= 0 {
+				state.AttemptsLeft = 0
+				lock := now.Add(s.Policy.Lock)
+				state.LockUntil = &lock
+			}
+			challenge = challenge.WithStepState(step, state, now)
+		}
+		return challenge, false, nil
+	}
+
+	challenge = challenge.WithCompleted(step, now)
+	if s.Policy.Attempts > 0 {
+		challenge = challenge.WithStepState(step, domain.StepState{AttemptsLeft: s.Policy.Attempts}, now)
+	}
+	return challenge, true, nil
+}
+
+// RegisterStep installs or replaces the handler for step. Use it to add
+// factors without changing the challenge flow; the step still has to be
+// required by the login (e.g. through a risk policy).
+func (uc *UseCase) RegisterStep(step domain.ChallengeStep, handler StepHandler, policy StepPolicy) {
+	if uc.steps == nil {
+		uc.steps = make(map[domain.ChallengeStep]Step)
+	}
+	uc.steps[step] = Step{Handler: handler, Policy: policy}
+}
+
+type totpStep struct {
+	identities domain.IdentityRepository
+}
+
+func (s totpStep) Verify(ctx context.Context, req StepRequest) (bool, error) {
+	ident, err := emailIdentity(ctx, s.identities, req.Challenge.UserID)
+	if err != nil {
+		return false, err
+	}
+	return totp.Validate(req.Value, ident.TOTPSecret), nil
+}
+
+// codeStep checks an emailed code of the given token type and marks it used.
+type codeStep struct {
+	identities domain.IdentityRepository
+	tokens     domain.VerificationTokenRepository
+	codes      domain.VerificationCodeHasher
+	tokenType  domain.TokenType
+	send       func(context.Context, domain.Identity) error
+	// onVerified runs after the code has been accepted.
+	onVerified func(context.Context, domain.Identity, time.Time) error
+}
+
+// NewCodeStep checks emailed codes of tokenType outside login challenges,
+// e.g. the code that proves the account email during a recovery.
+func NewCodeStep(identities domain.IdentityRepository, tokens domain.VerificationTokenRepository, codes domain.VerificationCodeHasher, tokenType domain.TokenType) StepHandler {
+	return codeStep{identities: identities, tokens: tokens, codes: codes, tokenType: tokenType}
+}
+
+func (s codeStep) Verify(ctx context.Context, req StepRequest) (bool, error) {
+	ident, err := emailIdentity(ctx, s.identities, req.Challenge.UserID)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	codeHash := s.codes.Hash(req.Value)
+	token, found, err := s.tokens.GetByCode(ctx, ident.ID, s.tokenType, codeHash)
+	if err != nil {
+		return false, common.NormalizeError(err)
+	}
+	if !found || !token.IsValid(codeHash, now) {
+		return false, nil
+	}
+	if err := s.tokens.MarkUsed(ctx, token.ID, now); err != nil {
+		return false, common.NormalizeError(err)
+	}
+	if s.onVerified != nil {
+		if err := s.onVerified(ctx, ident, now); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s codeStep) Send(ctx context.Context, challenge domain.Challenge) error {
+	if s.send == nil {
+		return nil
+	}
+	ident, err := emailIdentity(ctx, s.identities, challenge.UserID)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, ident)
+}
+
+// passwordStep checks the password of the user's email identity. No login
+// requires it; step-up challenges of users without TOTP do.
+type passwordStep struct {
+	identities domain.IdentityRepository
+	hasher     domain.PasswordHasher
+}
+
+func (s passwordStep) Verify(ctx context.Context, req StepRequest) (bool, error) {
+	ident, err := emailIdentity(ctx, s.identities, req.Challenge.UserID)
+	if err != nil {
+		return false, err
+	}
+	return ident.Authenticate(ctx, s.hasher, req.Value) == nil, nil
+}
+
+type captchaStep struct {
+	verifier CaptchaVerifier
+}
+
+func (s captchaStep) Verify(ctx context.Context, req StepRequest) (bool, error) {
+	valid, err := s.verifier.Verify(ctx, req.Value, req.Meta.IP)
+	if err != nil {
+		return false, common.NormalizeError(err)
+	}
+	return valid, nil
+}
+
+func emailIdentity(ctx context.Context, identities domain.IdentityRepository, userID domain.UserID) (domain.Identity, error) {
+	ident, found, err := identities.GetByUserAndProvider(ctx, userID, "email")
+	if err != nil {
+		return domain.Identity{}, common.NormalizeError(err)
+	}
+	if !found {
+		return domain.Identity{}, domain.ErrUnauthorized
+	}
+	return ident, nil
+}
+
+var (
+	_ StepHandler = totpStep{}
+	_ StepHandler = codeStep{}
+	_ StepSender  = codeStep{}
+	_ StepHandler = passwordStep{}
+	_ StepHandler = captchaStep{}
+)
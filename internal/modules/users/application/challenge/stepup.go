@@ -0,0 +1,123 @@
+package challenge
+
+import (
+	"context"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// stepUpTTL bounds how long a step-up challenge can be answered.
+const stepUpTTL = 5 * time.Minute
+
+type StartStepUpInput struct {
+	UserID    string
+	SessionID string
+}
+
+type VerifyStepUpInput struct {
+	UserID      string
+	SessionID   string
+	ChallengeID string
+	Step        string
+	Value       string
+}
+
+// StartStepUp opens a challenge that re-authenticates the caller's session.
+// Users with TOTP answer a TOTP code, others their password; accounts
+// without a password get a code by email. Accounts without an email
+// identity (provider logins only) have to sign in again.
+func (uc *UseCase) StartStepUp(ctx context.Context, in StartStepUpInput) (Output, error) {
+	userID, err := domain.ParseUserID(in.UserID)
+	if err != nil {
+		return Output{}, err
+	}
+	now := time.Now().UTC()
+	session, found, err := uc.refresh.GetByID(ctx, in.SessionID)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if !found || session.UserID != userID || !session.IsValid(now) {
+		return Output{}, domain.ErrUnauthorized
+	}
+
+	ident, found, err := uc.identities.GetByUserAndProvider(ctx, userID, "email")
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if !found {
+		return Output{}, domain.ErrStepUpUnavailable
+	}
+	step := domain.ChallengeStepEmailOTP
+	switch {
+	case ident.IsTwoFactorEnabled():
+		step = domain.ChallengeStepTOTP
+	case ident.SecretHash != "":
+		step = domain.ChallengeStepPassword
+	}
+	registered, known := uc.steps[step]
+	if !known {
+		return Output{}, domain.ErrStepUpUnavailable
+	}
+
+	challenge := domain.NewChallenge(userID, domain.ChallengeTypeStepUp, []domain.ChallengeStep{step}, now.Add(stepUpTTL))
+	challenge.SessionFingerprint = session.ID
+	if err := uc.challenges.Create(ctx, challenge); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if sender, ok := registered.Handler.(StepSender); ok {
+		if err := sender.Send(ctx, challenge); err != nil {
+			return Output{}, common.NormalizeError(err)
+		}
+	}
+	return uc.challengeResponse(ctx, challenge, &ident)
+}
+
+// VerifyStepUp answers a step of a step-up challenge. Only the session that
+// started the challenge can answer it.
+func (uc *UseCase) VerifyStepUp(ctx context.Context, in VerifyStepUpInput) (Output, error) {
+	step := domain.ChallengeStep(in.Step)
+	if _, known := uc.steps[step]; !known {
+		return Output{}, domain.ErrUnknownChallengeStep
+	}
+	challenge, ok, err := uc.challenges.GetByID(ctx, in.ChallengeID)
+	if err != nil || !ok || challenge.Type != domain.ChallengeTypeStepUp {
+		return Output{}, domain.ErrUnauthorized
+	}
+	if challenge.UserID.String() != in.UserID || challenge.SessionFingerprint != in.SessionID {
+		return Output{}, domain.ErrUnauthorized
+	}
+	return uc.verify(ctx, challenge, step, in.Value, false)
+}
+
+// stepUp records the re-authentication on the session the challenge belongs
+// to and returns a new access token for it. The refresh token is unchanged.
+func (uc *UseCase) stepUp(ctx context.Context, challenge domain.Challenge) (string, error) {
+	session, found, err := uc.refresh.GetByID(ctx, challenge.SessionFingerprint)
+	if err != nil {
+		return "", common.NormalizeError(err)
+	}
+	now := time.Now().UTC()
+	if !found || session.UserID != challenge.UserID || !session.IsValid(now) {
+		return "", domain.ErrUnauthorized
+	}
+	session = session.WithAuthentication(now, challengeAMR(challenge)...)
+	if err := uc.refresh.Update(ctx, session); err != nil {
+		return "", common.NormalizeError(err)
+	}
+	accessToken, err := uc.access.Issue(common.SessionClaims(session), uc.accessTTL)
+	if err != nil {
+		return "", common.NormalizeError(err)
+	}
+	return accessToken, nil
+}
+
+// challengeAMR lists the authentication methods proven by completed steps.
+func challengeAMR(challenge domain.Challenge) []string {
+	methods := make([]string, 0, len(challenge.CompletedSteps))
+	for _, step := range challenge.CompletedSteps {
+		methods = append(methods, step.AMR())
+	}
+	return methods
+}
@@ -0,0 +1,149 @@
+package challenge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestStepUpRefreshesSessionAuthTime(t *testing.T) {
+	userID := domain.NewUserID()
+	authTime := time.Now().UTC().Add(-time.Hour)
+	session := domain.RefreshToken{ID: "sess", UserID: userID, ExpiresAt: time.Now().UTC().Add(time.Hour), AuthTime: authTime, AMR: []string{domain.AMRPassword}}
+	sessions := &stepUpSessionRepo{session: session}
+	challenges := &challengeRepoMock{}
+	access := &stepUpIssuer{}
+	uc := &UseCase{
+		challenges: challenges,
+		identities: stepUpIdentityRepo{identity: domain.Identity{ID: "ident", UserID: userID, Provider: "email", ProviderUserID: "user@example.com", SecretHash: "hashed:secret"}},
+		users:      &userRepoMock{user: domain.NewUser(userID, "", mustDisplayName(t, "user"), time.Now().UTC())},
+		refresh:    sessions,
+		access:     access,
+		accessTTL:  time.Minute,
+	}
+	uc.RegisterStep(domain.ChallengeStepPassword, passwordStep{identities: uc.identities, hasher: stepUpHasher{}}, StepPolicy{Attempts: 3, Lock: time.Minute})
+
+	out, err := uc.StartStepUp(context.Background(), StartStepUpInput{UserID: userID.String(), SessionID: "sess"})
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	challengeID := out.Challenge.ID
+	if challenges.created.Type != domain.ChallengeTypeStepUp || len(out.Challenge.RequiredSteps) != 1 || out.Challenge.RequiredSteps[0] != "password" {
+		t.Fatalf("expected a password step-up challenge, got %+v", out.Challenge)
+	}
+
+	if _, err := uc.VerifyStepUp(context.Background(), VerifyStepUpInput{UserID: userID.String(), SessionID: "other", ChallengeID: challengeID, Step: "password", Value: "secret"}); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected another session to be rejected, got %v", err)
+	}
+
+	out, err = uc.VerifyStepUp(context.Background(), VerifyStepUpInput{UserID: userID.String(), SessionID: "sess", ChallengeID: challengeID, Step: "password", Value: "secret"})
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if out.Status != string(domain.ChallengeStatusCompleted) || out.AccessToken == "" || out.RefreshToken != "" {
+		t.Fatalf("expected only a new access token, got %+v", out)
+	}
+	if !sessions.updated.AuthTime.After(authTime) {
+		t.Fatalf("expected auth_time to move forward, got %v", sessions.updated.AuthTime)
+	}
+	if access.claims.SessionID != "sess" || !access.claims.AuthTime.Equal(sessions.updated.AuthTime) {
+		t.Fatalf("expected the token to carry the same session and new auth_time, got %+v", access.claims)
+	}
+	if sessions.created {
+		t.Fatal("step-up must not create a session")
+	}
+}
+
+func TestStepUpPrefersTOTP(t *testing.T) {
+	userID := domain.NewUserID()
+	ident := domain.Identity{ID: "ident", UserID: userID, Provider: "email", SecretHash: "hashed:secret"}.
+		WithTOTPSecret("SECRET").
+		WithTOTPConfirmed(time.Now().UTC())
+	uc := &UseCase{
+		challenges: &challengeRepoMock{},
+		identities: stepUpIdentityRepo{identity: ident},
+		users:      &userRepoMock{user: domain.NewUser(userID, "", mustDisplayName(t, "user"), time.Now().UTC())},
+		refresh:    &stepUpSessionRepo{session: domain.RefreshToken{ID: "sess", UserID: userID, ExpiresAt: time.Now().UTC().Add(time.Hour)}},
+	}
+	uc.RegisterStep(domain.ChallengeStepTOTP, stepMock{answer: "123456"}, StepPolicy{})
+	uc.RegisterStep(domain.ChallengeStepPassword, stepMock{answer: "secret"}, StepPolicy{})
+
+	out, err := uc.StartStepUp(context.Background(), StartStepUpInput{UserID: userID.String(), SessionID: "sess"})
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if out.Challenge.RequiredSteps[0] != "totp" {
+		t.Fatalf("expected totp step, got %v", out.Challenge.RequiredSteps)
+	}
+}
+
+func TestStepUpUnavailableWithoutEmailIdentity(t *testing.T) {
+	userID := domain.NewUserID()
+	uc := &UseCase{
+		challenges: &challengeRepoMock{},
+		identities: identityRepoMock{},
+		refresh:    &stepUpSessionRepo{session: domain.RefreshToken{ID: "sess", UserID: userID, ExpiresAt: time.Now().UTC().Add(time.Hour)}},
+	}
+	if _, err := uc.StartStepUp(context.Background(), StartStepUpInput{UserID: userID.String(), SessionID: "sess"}); !errors.Is(err, domain.ErrStepUpUnavailable) {
+		t.Fatalf("expected step_up_unavailable, got %v", err)
+	}
+}
+
+// --- test doubles ---
+
+type stepUpIdentityRepo struct {
+	identityRepoMock
+	identity domain.Identity
+}
+
+func (s stepUpIdentityRepo) GetByUserAndProvider(context.Context, domain.UserID, string) (domain.Identity, bool, error) {
+	return s.identity, true, nil
+}
+
+type stepUpHasher struct{}
+
+func (stepUpHasher) Hash(_ context.Context, password string) (string, error) {
+	return "hashed:" + password, nil
+}
+func (stepUpHasher) Compare(_ context.Context, hash, password string) error {
+	if hash != "hashed:"+password {
+		return errors.New("mismatch")
+	}
+	return nil
+}
+
+type stepUpSessionRepo struct {
+	refreshRepoMock
+	session domain.RefreshToken
+	updated domain.RefreshToken
+	created bool
+}
+
+func (s *stepUpSessionRepo) Create(context.Context, domain.RefreshToken) error {
+	s.created = true
+	return nil
+}
+func (s *stepUpSessionRepo) Update(_ context.Context, token domain.RefreshToken) error {
+	s.updated = token
+	s.session = token
+	return nil
+}
+func (s *stepUpSessionRepo) GetByID(_ context.Context, id string) (domain.RefreshToken, bool, error) {
+	if s.session.ID == id {
+		return s.session, true, nil
+	}
+	return domain.RefreshToken{}, false, nil
+}
+
+type stepUpIssuer struct {
+	claims common.AccessClaims
+}
+
+func (s *stepUpIssuer) Issue(claims common.AccessClaims, _ time.Duration) (string, error) {
+	s.claims = claims
+	return "access", nil
+}
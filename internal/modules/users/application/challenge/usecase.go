@@ -7,7 +7,6 @@ import (
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/login"
-	"github.com/vaaxooo/xbackend/internal/modules/users/application/totp"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
@@ -16,19 +15,51 @@ type UseCase struct {
 	identities domain.IdentityRepository
 	users      domain.UserRepository
 	refresh    domain.RefreshTokenRepository
-	tokens     domain.VerificationTokenRepository
+	codes      domain.VerificationCodeHasher
+	devices    domain.TrustedDeviceRepository
 	access     common.AccessTokenIssuer
 
-	accessTTL      time.Duration
-	refreshTTL     time.Duration
-	totpAttempts   int
-	totpLock       time.Duration
-	requestEmailFn func(context.Context, domain.Identity) error
+	accessTTL        time.Duration
+	sessionPolicy    common.SessionPolicy
+	trustedDeviceTTL time.Duration
+	steps            map[domain.ChallengeStep]Step
+	notifier         Notifier
+	qrLogins         domain.QRLoginRepository
+	attempts         domain.LoginAttemptRepository
+}
+
+// CaptchaVerifier checks a captcha response token with the provider.
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// VerifyStepInput answers any registered step. Value carries the step's
+// answer: a TOTP or emailed code, a confirmation token, a captcha token.
+type VerifyStepInput struct {
+	ChallengeID string
+	Step        string
+	Value       string
+	TrustDevice bool
 }
 
 type VerifyTOTPInput struct {
 	ChallengeID string
 	Code        string
+	// TrustDevice asks for a device token that skips TOTP on later logins.
+	TrustDevice bool
+}
+
+// VerifyEmailOTPInput completes the email_otp step with the code mailed when
+// the login was flagged as risky.
+type VerifyEmailOTPInput struct {
+	ChallengeID string
+	Code        string
+	TrustDevice bool
+}
+
+type VerifyCaptchaInput struct {
+	ChallengeID string
+	Token       string
 }
 
 type ResendEmailInput struct {
@@ -42,16 +73,29 @@ type StatusInput struct {
 type ConfirmEmailInput struct {
 	ChallengeID string
 	Token       string
+	TrustDevice bool
 }
 
 type Output = login.Output
 
-func NewUseCase(challenges domain.ChallengeRepository, identities domain.IdentityRepository, users domain.UserRepository, refresh domain.RefreshTokenRepository, tokens domain.VerificationTokenRepository, access common.AccessTokenIssuer, accessTTL, refreshTTL time.Duration, totpAttempts int, totpLock time.Duration, requestEmailFn func(context.Context, domain.Identity) error) *UseCase {
+// Dependencies holds the optional collaborators of the challenge flow. A nil
+// field turns off the feature it backs.
+type Dependencies struct {
+	// LoginAttempts records a successful login once a login challenge is
+	// completed, for risk scoring. The password check alone does not count.
+	LoginAttempts domain.LoginAttemptRepository
+	// Notifier makes every challenge update announce itself to watchers.
+	Notifier Notifier
+	// QRLogins enables QR logins.
+	QRLogins domain.QRLoginRepository
+}
+
+func NewUseCase(challenges domain.ChallengeRepository, identities domain.IdentityRepository, users domain.UserRepository, refresh domain.RefreshTokenRepository, tokens domain.VerificationTokenRepository, codes domain.VerificationCodeHasher, devices domain.TrustedDeviceRepository, hasher domain.PasswordHasher, captcha CaptchaVerifier, access common.AccessTokenIssuer, accessTTL time.Duration, sessionPolicy common.SessionPolicy, trustedDeviceTTL time.Duration, totpAttempts int, totpLock time.Duration, requestEmailFn, requestCodeFn func(context.Context, domain.Identity) error, deps Dependencies) *UseCase {
 	if accessTTL == 0 {
 		accessTTL = 15 * time.Minute
 	}
-	if refreshTTL == 0 {
-		refreshTTL = 30 * 24 * time.Hour
+	if trustedDeviceTTL == 0 {
+		trustedDeviceTTL = 30 * 24 * time.Hour
 	}
 	if totpAttempts <= 0 {
 		totpAttempts = 3
@@ -59,132 +103,149 @@ func NewUseCase(challenges domain.ChallengeRepository, identities domain.Identit
 	if totpLock == 0 {
 		totpLock = 5 * time.Minute
 	}
-	return &UseCase{
-		challenges:     challenges,
-		identities:     identities,
-		users:          users,
-		refresh:        refresh,
-		tokens:         tokens,
-		access:         access,
-		accessTTL:      accessTTL,
-		refreshTTL:     refreshTTL,
-		totpAttempts:   totpAttempts,
-		totpLock:       totpLock,
-		requestEmailFn: requestEmailFn,
-	}
+	uc := &UseCase{
+		challenges:       challenges,
+		identities:       identities,
+		users:            users,
+		refresh:          refresh,
+		codes:            codes,
+		devices:          devices,
+		access:           access,
+		accessTTL:        accessTTL,
+		sessionPolicy:    sessionPolicy,
+		trustedDeviceTTL: trustedDeviceTTL,
+		notifier:         deps.Notifier,
+		qrLogins:         deps.QRLogins,
+		attempts:         deps.LoginAttempts,
+	}
+	attempts := StepPolicy{Attempts: totpAttempts, Lock: totpLock}
+	uc.RegisterStep(domain.ChallengeStepTOTP, totpStep{identities: identities}, attempts)
+	uc.RegisterStep(domain.ChallengeStepEmailVerification, codeStep{
+		identities: identities,
+		tokens:     tokens,
+		codes:      codes,
+		tokenType:  domain.TokenTypeEmailConfirmation,
+		send:       requestEmailFn,
+		onVerified: func(ctx context.Context, ident domain.Identity, now time.Time) error {
+			return common.NormalizeError(identities.Update(ctx, ident.WithEmailVerified(now)))
+		},
+	}, attempts)
+	uc.RegisterStep(domain.ChallengeStepEmailOTP, codeStep{
+		identities: identities,
+		tokens:     tokens,
+		codes:      codes,
+		tokenType:  domain.TokenTypeLoginOTP,
+		send:       requestCodeFn,
+	}, attempts)
+	if hasher != nil {
+		uc.RegisterStep(domain.ChallengeStepPassword, passwordStep{identities: identities, hasher: hasher}, attempts)
+	}
+	if captcha != nil {
+		uc.RegisterStep(domain.ChallengeStepCaptcha, captchaStep{verifier: captcha}, StepPolicy{})
+	}
+	return uc
 }
 
+// Status reports a login challenge. Other challenge types (account
+// recovery, step-up) are unknown here, since completing a challenge issues a
+// session.
 func (uc *UseCase) Status(ctx context.Context, in StatusInput) (Output, error) {
 	challenge, ok, err := uc.challenges.GetByID(ctx, in.ChallengeID)
-	if err != nil || !ok {
+	if err != nil || !ok || challenge.Type != domain.ChallengeTypeLogin {
 		return Output{}, domain.ErrUnauthorized
 	}
 	now := time.Now().UTC()
 	if challenge.IsExpired(now) && challenge.Status != domain.ChallengeStatusExpired {
 		challenge = challenge.WithStatus(domain.ChallengeStatusExpired, now)
 		challenge = challenge.WithAttemptsLeft(0, now)
-		_ = uc.challenges.Update(ctx, challenge)
+		_ = uc.update(ctx, challenge)
 	}
 	return uc.challengeResponse(ctx, challenge, nil)
 }
 
+// ResendEmail asks every pending step that delivers something (email
+// confirmation, login code) to send it again.
 func (uc *UseCase) ResendEmail(ctx context.Context, in ResendEmailInput) (Output, error) {
 	challenge, ok, err := uc.challenges.GetByID(ctx, in.ChallengeID)
-	if err != nil || !ok {
+	if err != nil || !ok || challenge.Type != domain.ChallengeTypeLogin {
 		return Output{}, domain.ErrUnauthorized
 	}
-	if !challenge.NeedsStep(domain.ChallengeStepEmailVerification) {
-		return uc.challengeResponse(ctx, challenge, nil)
-	}
-	ident, err := uc.identityForUser(ctx, challenge.UserID)
-	if err != nil {
-		return Output{}, err
-	}
-	if uc.requestEmailFn != nil {
-		_ = uc.requestEmailFn(ctx, ident)
+	for _, step := range challenge.RequiredSteps {
+		if !challenge.NeedsStep(step) {
+			continue
+		}
+		if sender, ok := uc.steps[step].Handler.(StepSender); ok {
+			_ = sender.Send(ctx, challenge)
+		}
 	}
-	return uc.challengeResponse(ctx, challenge, &ident)
+	return uc.challengeResponse(ctx, challenge, uc.maskedIdentity(ctx, challenge.UserID))
 }
 
 func (uc *UseCase) VerifyTOTP(ctx context.Context, in VerifyTOTPInput) (Output, error) {
+	return uc.VerifyStep(ctx, VerifyStepInput{ChallengeID: in.ChallengeID, Step: string(domain.ChallengeStepTOTP), Value: in.Code, TrustDevice: in.TrustDevice})
+}
+
+func (uc *UseCase) ConfirmEmail(ctx context.Context, in ConfirmEmailInput) (Output, error) {
+	return uc.VerifyStep(ctx, VerifyStepInput{ChallengeID: in.ChallengeID, Step: string(domain.ChallengeStepEmailVerification), Value: in.Token, TrustDevice: in.TrustDevice})
+}
+
+func (uc *UseCase) VerifyEmailOTP(ctx context.Context, in VerifyEmailOTPInput) (Output, error) {
+	return uc.VerifyStep(ctx, VerifyStepInput{ChallengeID: in.ChallengeID, Step: string(domain.ChallengeStepEmailOTP), Value: in.Code, TrustDevice: in.TrustDevice})
+}
+
+func (uc *UseCase) VerifyCaptcha(ctx context.Context, in VerifyCaptchaInput) (Output, error) {
+	return uc.VerifyStep(ctx, VerifyStepInput{ChallengeID: in.ChallengeID, Step: string(domain.ChallengeStepCaptcha), Value: in.Token})
+}
+
+// VerifyStep dispatches the answer to the handler registered for the step
+// and keeps attempt and lock state separately for every step.
+func (uc *UseCase) VerifyStep(ctx context.Context, in VerifyStepInput) (Output, error) {
+	step := domain.ChallengeStep(in.Step)
+	if _, known := uc.steps[step]; !known {
+		return Output{}, domain.ErrUnknownChallengeStep
+	}
 	challenge, ok, err := uc.challenges.GetByID(ctx, in.ChallengeID)
-	if err != nil || !ok {
+	if err != nil || !ok || challenge.Type != domain.ChallengeTypeLogin {
 		return Output{}, domain.ErrUnauthorized
 	}
+	return uc.verify(ctx, challenge, step, in.Value, in.TrustDevice)
+}
+
+func (uc *UseCase) verify(ctx context.Context, challenge domain.Challenge, step domain.ChallengeStep, value string, trustDevice bool) (Output, error) {
+	registered := uc.steps[step]
 	now := time.Now().UTC()
 	if challenge.IsExpired(now) {
 		challenge = challenge.WithStatus(domain.ChallengeStatusExpired, now)
 		challenge = challenge.WithAttemptsLeft(0, now)
-		_ = uc.challenges.Update(ctx, challenge)
+		_ = uc.update(ctx, challenge)
 		return uc.challengeResponse(ctx, challenge, nil)
 	}
-	if challenge.LockUntil != nil && challenge.LockUntil.After(now) {
+	if !challenge.NeedsStep(step) {
 		return uc.challengeResponse(ctx, challenge, nil)
 	}
-	if challenge.LockUntil != nil && challenge.LockUntil.Before(now) {
-		challenge = challenge.WithLockUntil(nil, now)
-		challenge = challenge.WithAttemptsLeft(uc.totpAttempts, now)
-		_ = uc.challenges.Update(ctx, challenge)
-	}
-	if !challenge.NeedsStep(domain.ChallengeStepTOTP) {
+
+	if state, _ := challenge.StepState(step); state.IsLocked(now) {
 		return uc.challengeResponse(ctx, challenge, nil)
 	}
-	ident, err := uc.identityForUser(ctx, challenge.UserID)
+	challenge, passed, err := registered.Attempt(ctx, challenge, step, value, now)
 	if err != nil {
 		return Output{}, err
 	}
-	if !totp.Validate(in.Code, ident.TOTPSecret) {
-		left := challenge.AttemptsLeft - 1
-		if left < 0 {
-			left = 0
+	if !passed {
+		if registered.Policy.Attempts > 0 {
+			_ = uc.update(ctx, challenge)
 		}
-		challenge = challenge.WithAttemptsLeft(left, now)
-		if left == 0 {
-			lock := now.Add(uc.totpLock)
-			challenge = challenge.WithLockUntil(&lock, now)
-		}
-		_ = uc.challenges.Update(ctx, challenge)
-		return uc.challengeResponse(ctx, challenge, &ident)
+		return uc.challengeResponse(ctx, challenge, uc.maskedIdentity(ctx, challenge.UserID))
 	}
-	challenge = challenge.WithCompleted(domain.ChallengeStepTOTP, now)
-	challenge = challenge.WithAttemptsLeft(uc.totpAttempts, now)
-	if err := uc.challenges.Update(ctx, challenge); err != nil {
-		return Output{}, common.NormalizeError(err)
-	}
-	return uc.challengeResponse(ctx, challenge, &ident)
-}
 
-func (uc *UseCase) ConfirmEmail(ctx context.Context, in ConfirmEmailInput) (Output, error) {
-	challenge, ok, err := uc.challenges.GetByID(ctx, in.ChallengeID)
-	if err != nil || !ok {
-		return Output{}, domain.ErrUnauthorized
-	}
-	now := time.Now().UTC()
-	if challenge.IsExpired(now) {
-		challenge = challenge.WithStatus(domain.ChallengeStatusExpired, now)
-		_ = uc.challenges.Update(ctx, challenge)
-		return uc.challengeResponse(ctx, challenge, nil)
-	}
-	ident, err := uc.identityForUser(ctx, challenge.UserID)
-	if err != nil {
-		return Output{}, err
-	}
-	token, found, err := uc.tokens.GetByCode(ctx, ident.ID, domain.TokenTypeEmailConfirmation, in.Token)
-	if err != nil || !found || !token.IsValid(in.Token, now) {
-		return Output{}, domain.ErrUnauthorized
-	}
-	if err := uc.tokens.MarkUsed(ctx, token.ID, now); err != nil {
-		return Output{}, common.NormalizeError(err)
-	}
-	ident = ident.WithEmailVerified(now)
-	if err := uc.identities.Update(ctx, ident); err != nil {
+	if err := uc.update(ctx, challenge); err != nil {
 		return Output{}, common.NormalizeError(err)
 	}
-	challenge = challenge.WithCompleted(domain.ChallengeStepEmailVerification, now)
-	if err := uc.challenges.Update(ctx, challenge); err != nil {
-		return Output{}, common.NormalizeError(err)
+	out, err := uc.challengeResponse(ctx, challenge, uc.maskedIdentity(ctx, challenge.UserID))
+	if err != nil || !trustDevice {
+		return out, err
 	}
-	return uc.challengeResponse(ctx, challenge, &ident)
+	return uc.trustDevice(ctx, challenge, out)
 }
 
 func (uc *UseCase) challengeResponse(ctx context.Context, challenge domain.Challenge, ident *domain.Identity) (Output, error) {
@@ -195,7 +256,46 @@ func (uc *UseCase) challengeResponse(ctx context.Context, challenge domain.Chall
 	if !ok {
 		return Output{}, domain.ErrUnauthorized
 	}
-	now := time.Now().UTC()
+	info, statusText := challengeInfo(challenge, time.Now().UTC())
+	if ident != nil {
+		info.MaskedEmail = maskEmail(ident.ProviderUserID)
+	}
+	out := Output{
+		UserID:      user.ID.String(),
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		MiddleName:  user.MiddleName,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		Status:      statusText,
+		Challenge:   info,
+	}
+	if challenge.Status == domain.ChallengeStatusCompleted {
+		if err := uc.consumeChallenge(ctx, challenge); err != nil {
+			return Output{}, err
+		}
+		var accessToken, refreshToken string
+		var refreshExpiresAt time.Time
+		if challenge.Type == domain.ChallengeTypeStepUp {
+			accessToken, err = uc.stepUp(ctx, challenge)
+		} else {
+			accessToken, refreshToken, refreshExpiresAt, err = uc.issueTokens(ctx, user, challenge)
+		}
+		if err != nil {
+			return Output{}, err
+		}
+		out.AccessToken = accessToken
+		out.RefreshToken = refreshToken
+		out.RefreshExpiresAt = refreshExpiresAt
+		out.Status = string(domain.ChallengeStatusCompleted)
+	}
+	return out, nil
+}
+
+// challengeInfo describes the challenge to its client, along with the
+// login status it stands for: challenge_required while it can be answered.
+func challengeInfo(challenge domain.Challenge, now time.Time) (*login.ChallengeInfo, string) {
 	expiresIn := int64(challenge.ExpiresAt.Sub(now).Seconds())
 	if expiresIn < 0 {
 		expiresIn = 0
@@ -215,80 +315,117 @@ func (uc *UseCase) challengeResponse(ctx context.Context, challenge domain.Chall
 		ExpiresIn:      expiresIn,
 		AttemptsLeft:   attempts,
 		LockUntil:      challenge.LockUntil,
-	}
-	if ident != nil {
-		info.MaskedEmail = maskEmail(ident.ProviderUserID)
+		Steps:          stepInfos(challenge),
 	}
 	statusText := "challenge_required"
 	if status != domain.ChallengeStatusPending {
 		statusText = string(status)
 	}
-	out := Output{
-		UserID:      user.ID.String(),
-		Email:       user.Email,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		MiddleName:  user.MiddleName,
-		DisplayName: user.DisplayName,
-		AvatarURL:   user.AvatarURL,
-		Status:      statusText,
-		Challenge:   info,
+	return info, statusText
+}
+
+// trustDevice issues a trusted-device token once a challenge that included
+// the TOTP step has been completed. Other challenges are left untouched.
+func (uc *UseCase) trustDevice(ctx context.Context, challenge domain.Challenge, out Output) (Output, error) {
+	if uc.devices == nil || challenge.Status != domain.ChallengeStatusCompleted || !requiresStep(challenge, domain.ChallengeStepTOTP) {
+		return out, nil
 	}
-	if challenge.Status == domain.ChallengeStatusCompleted {
-		if err := uc.consumeChallenge(ctx, challenge); err != nil {
-			return Output{}, err
-		}
-		accessToken, refreshToken, err := uc.issueTokens(ctx, user)
-		if err != nil {
-			return Output{}, err
-		}
-		out.AccessToken = accessToken
-		out.RefreshToken = refreshToken
-		out.Status = string(domain.ChallengeStatusCompleted)
+	token, err := domain.NewDeviceToken(challenge.UserID, uc.codes)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	device := domain.NewTrustedDevice(challenge.UserID, uc.codes.Hash(token), time.Now().UTC(), uc.trustedDeviceTTL)
+	if meta, ok := common.RequestMetaFromContext(ctx); ok {
+		device.UserAgent = meta.UserAgent
+		device.IP = meta.IP
 	}
+	if err := uc.devices.Create(ctx, device); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	out.DeviceToken = token
 	return out, nil
 }
 
+func requiresStep(challenge domain.Challenge, step domain.ChallengeStep) bool {
+	for _, required := range challenge.RequiredSteps {
+		if required == step {
+			return true
+		}
+	}
+	return false
+}
+
+// update stores the challenge and tells watchers it changed. The notifier
+// runs in the caller's transaction, so watchers hear about the change only
+// once it is committed.
+func (uc *UseCase) update(ctx context.Context, challenge domain.Challenge) error {
+	if err := uc.challenges.Update(ctx, challenge); err != nil {
+		return err
+	}
+	if uc.notifier == nil {
+		return nil
+	}
+	return uc.notifier.Notify(ctx, challenge.ID)
+}
+
 func (uc *UseCase) consumeChallenge(ctx context.Context, challenge domain.Challenge) error {
 	expired := challenge.WithStatus(domain.ChallengeStatusExpired, time.Now().UTC())
-	return common.NormalizeError(uc.challenges.Update(ctx, expired))
+	return common.NormalizeError(uc.update(ctx, expired))
 }
 
-func (uc *UseCase) issueTokens(ctx context.Context, user domain.User) (string, string, error) {
+// issueTokens opens a session for a completed login challenge. Login
+// challenges follow a password check, so pwd is always among the methods.
+func (uc *UseCase) issueTokens(ctx context.Context, user domain.User, challenge domain.Challenge) (string, string, time.Time, error) {
 	refreshRaw, err := common.NewRefreshToken()
 	if err != nil {
-		return "", "", common.NormalizeError(err)
+		return "", "", time.Time{}, common.NormalizeError(err)
 	}
 	refreshHash := common.HashToken(refreshRaw)
 	now := time.Now().UTC()
-	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, user.ID, refreshHash, now, uc.refreshTTL)
+	methods := append([]string{domain.AMRPassword}, challengeAMR(challenge)...)
+	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, user.ID, refreshHash, now, uc.sessionPolicy, domain.LoginMethodPassword, methods...)
 	if err != nil {
-		return "", "", common.NormalizeError(err)
+		return "", "", time.Time{}, common.NormalizeError(err)
 	}
 
-	accessToken, err := uc.access.Issue(user.ID.String(), refreshRecord.ID, uc.accessTTL)
+	accessToken, err := uc.access.Issue(common.SessionClaims(refreshRecord), uc.accessTTL)
 	if err != nil {
-		return "", "", common.NormalizeError(err)
+		return "", "", time.Time{}, common.NormalizeError(err)
 	}
 	if reuse {
 		if err := uc.refresh.Update(ctx, refreshRecord); err != nil {
-			return "", "", common.NormalizeError(err)
+			return "", "", time.Time{}, common.NormalizeError(err)
 		}
 	} else if err := uc.refresh.Create(ctx, refreshRecord); err != nil {
-		return "", "", common.NormalizeError(err)
+		return "", "", time.Time{}, common.NormalizeError(err)
+	}
+	if uc.attempts != nil {
+		meta, _ := common.RequestMetaFromContext(ctx)
+		_ = uc.attempts.Record(ctx, domain.NewLoginAttempt(user.ID, meta.IP, meta.UserAgent, true, now))
 	}
-	return accessToken, refreshRaw, nil
+	return accessToken, refreshRaw, refreshRecord.ExpiresAt, nil
 }
 
-func (uc *UseCase) identityForUser(ctx context.Context, userID domain.UserID) (domain.Identity, error) {
+// maskedIdentity returns the email identity used to show a masked address
+// in responses, or nil when the user has none.
+func (uc *UseCase) maskedIdentity(ctx context.Context, userID domain.UserID) *domain.Identity {
 	ident, found, err := uc.identities.GetByUserAndProvider(ctx, userID, "email")
-	if err != nil {
-		return domain.Identity{}, common.NormalizeError(err)
+	if err != nil || !found {
+		return nil
 	}
-	if !found {
-		return domain.Identity{}, domain.ErrUnauthorized
+	return &ident
+}
+
+func stepInfos(challenge domain.Challenge) []login.StepInfo {
+	var infos []login.StepInfo
+	for _, step := range challenge.RequiredSteps {
+		state, ok := challenge.StepState(step)
+		if !ok {
+			continue
+		}
+		infos = append(infos, login.StepInfo{Step: string(step), AttemptsLeft: state.AttemptsLeft, LockUntil: state.LockUntil})
 	}
-	return ident, nil
+	return infos
 }
 
 func stepsToString(steps []domain.ChallengeStep) []string {
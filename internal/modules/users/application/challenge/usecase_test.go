@@ -2,9 +2,11 @@ package challenge
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
@@ -15,16 +17,13 @@ func TestStatusClampsExpiredChallenge(t *testing.T) {
 
 	repo := &challengeRepoMock{challenge: ch}
 	uc := &UseCase{
-		challenges:   repo,
-		identities:   &identityRepoMock{},
-		users:        &userRepoMock{user: domain.NewUser(ch.UserID, "", mustDisplayName(t, "user"), time.Now().UTC())},
-		refresh:      &refreshRepoMock{},
-		tokens:       &verificationRepoMock{},
-		access:       &accessIssuerMock{},
-		accessTTL:    time.Minute,
-		refreshTTL:   time.Hour,
-		totpAttempts: 3,
-		totpLock:     time.Minute,
+		challenges:    repo,
+		identities:    &identityRepoMock{},
+		users:         &userRepoMock{user: domain.NewUser(ch.UserID, "", mustDisplayName(t, "user"), time.Now().UTC())},
+		refresh:       &refreshRepoMock{},
+		access:        &accessIssuerMock{},
+		accessTTL:     time.Minute,
+		sessionPolicy: common.SessionPolicy{IdleTimeout: time.Hour},
 	}
 
 	out, err := uc.Status(context.Background(), StatusInput{ChallengeID: ch.ID})
@@ -45,14 +44,117 @@ func TestStatusClampsExpiredChallenge(t *testing.T) {
 	}
 }
 
+func TestRecoveryChallengeCannotIssueSession(t *testing.T) {
+	ch := domain.NewChallenge(domain.NewUserID(), domain.ChallengeTypeRecovery, []domain.ChallengeStep{domain.ChallengeStepEmailOTP}, time.Now().UTC().Add(time.Minute))
+	uc := &UseCase{challenges: &challengeRepoMock{challenge: ch}}
+	uc.RegisterStep(domain.ChallengeStepEmailOTP, stepMock{answer: "123456"}, StepPolicy{Attempts: 3, Lock: time.Minute})
+
+	if _, err := uc.Status(context.Background(), StatusInput{ChallengeID: ch.ID}); err != domain.ErrUnauthorized {
+		t.Fatalf("expected unauthorized status, got %v", err)
+	}
+	if _, err := uc.VerifyStep(context.Background(), VerifyStepInput{ChallengeID: ch.ID, Step: "email_otp", Value: "123456"}); err != domain.ErrUnauthorized {
+		t.Fatalf("expected unauthorized step, got %v", err)
+	}
+}
+
+func TestVerifyCaptchaCompletesStep(t *testing.T) {
+	ch := domain.NewChallenge(domain.NewUserID(), "auth_challenge", []domain.ChallengeStep{domain.ChallengeStepCaptcha, domain.ChallengeStepTOTP}, time.Now().UTC().Add(time.Minute))
+	repo := &challengeRepoMock{challenge: ch}
+	captcha := &captchaMock{valid: false}
+	uc := &UseCase{
+		challenges: repo,
+		identities: &identityRepoMock{},
+		users:      &userRepoMock{user: domain.NewUser(ch.UserID, "", mustDisplayName(t, "user"), time.Now().UTC())},
+	}
+	uc.RegisterStep(domain.ChallengeStepCaptcha, captchaStep{verifier: captcha}, StepPolicy{})
+
+	out, err := uc.VerifyCaptcha(context.Background(), VerifyCaptchaInput{ChallengeID: ch.ID, Token: "bad"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(out.Challenge.CompletedSteps) != 0 {
+		t.Fatalf("expected captcha step to stay open, got %+v", out.Challenge)
+	}
+
+	captcha.valid = true
+	out, err = uc.VerifyCaptcha(context.Background(), VerifyCaptchaInput{ChallengeID: ch.ID, Token: "good"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(out.Challenge.CompletedSteps) != 1 || out.Challenge.CompletedSteps[0] != string(domain.ChallengeStepCaptcha) {
+		t.Fatalf("expected captcha step completed, got %+v", out.Challenge)
+	}
+	if out.Status != "challenge_required" || out.AccessToken != "" {
+		t.Fatalf("expected remaining TOTP step, got %+v", out)
+	}
+}
+
+func TestVerifyStepKeepsAttemptsPerStep(t *testing.T) {
+	ch := domain.NewChallenge(domain.NewUserID(), "auth_challenge", []domain.ChallengeStep{domain.ChallengeStepTOTP, domain.ChallengeStepEmailOTP}, time.Now().UTC().Add(time.Minute))
+	repo := &challengeRepoMock{challenge: ch}
+	uc := &UseCase{
+		challenges: repo,
+		identities: &identityRepoMock{},
+		users:      &userRepoMock{user: domain.NewUser(ch.UserID, "", mustDisplayName(t, "user"), time.Now().UTC())},
+		refresh:    &refreshRepoMock{},
+		access:     &accessIssuerMock{},
+	}
+	policy := StepPolicy{Attempts: 1, Lock: time.Minute}
+	uc.RegisterStep(domain.ChallengeStepTOTP, stepMock{answer: "111111"}, policy)
+	uc.RegisterStep(domain.ChallengeStepEmailOTP, stepMock{answer: "222222"}, policy)
+
+	out, err := uc.VerifyStep(context.Background(), VerifyStepInput{ChallengeID: ch.ID, Step: "totp", Value: "000000"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state, _ := repo.challenge.StepState(domain.ChallengeStepTOTP); !state.IsLocked(time.Now().UTC()) {
+		t.Fatalf("expected totp step locked, got %+v", state)
+	}
+	if len(out.Challenge.Steps) != 1 || out.Challenge.Steps[0].Step != "totp" || out.Challenge.Steps[0].LockUntil == nil {
+		t.Fatalf("expected per-step state in output, got %+v", out.Challenge.Steps)
+	}
+
+	out, _ = uc.VerifyStep(context.Background(), VerifyStepInput{ChallengeID: ch.ID, Step: "totp", Value: "111111"})
+	if len(out.Challenge.CompletedSteps) != 0 {
+		t.Fatalf("expected locked step to reject even a correct answer, got %+v", out.Challenge)
+	}
+
+	out, err = uc.VerifyStep(context.Background(), VerifyStepInput{ChallengeID: ch.ID, Step: "email_otp", Value: "222222"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(out.Challenge.CompletedSteps) != 1 || out.Challenge.CompletedSteps[0] != "email_otp" {
+		t.Fatalf("expected email_otp to complete despite totp lock, got %+v", out.Challenge)
+	}
+
+	if _, err := uc.VerifyStep(context.Background(), VerifyStepInput{ChallengeID: ch.ID, Step: "webauthn", Value: "x"}); !errors.Is(err, domain.ErrUnknownChallengeStep) {
+		t.Fatalf("expected unknown step error, got %v", err)
+	}
+}
+
 // --- test doubles ---
 
+type stepMock struct{ answer string }
+
+func (m stepMock) Verify(_ context.Context, req StepRequest) (bool, error) {
+	return req.Value == m.answer, nil
+}
+
+type captchaMock struct{ valid bool }
+
+func (m *captchaMock) Verify(context.Context, string, string) (bool, error) { return m.valid, nil }
+
 type challengeRepoMock struct {
 	challenge   domain.Challenge
+	created     domain.Challenge
 	lastUpdated domain.Challenge
 }
 
-func (m *challengeRepoMock) Create(ctx context.Context, challenge domain.Challenge) error { return nil }
+func (m *challengeRepoMock) Create(ctx context.Context, challenge domain.Challenge) error {
+	m.created = challenge
+	m.challenge = challenge
+	return nil
+}
 func (m *challengeRepoMock) Update(ctx context.Context, challenge domain.Challenge) error {
 	m.lastUpdated = challenge
 	m.challenge = challenge
@@ -102,11 +204,16 @@ func (refreshRepoMock) GetByID(context.Context, string) (domain.RefreshToken, bo
 func (refreshRepoMock) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
 	return nil, nil
 }
+func (refreshRepoMock) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
+	return nil, nil
+}
 func (refreshRepoMock) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
 	return domain.RefreshToken{}, false, nil
 }
-func (refreshRepoMock) Revoke(context.Context, string) error                           { return nil }
-func (refreshRepoMock) RevokeAllExcept(context.Context, domain.UserID, []string) error { return nil }
+func (refreshRepoMock) Revoke(context.Context, string) error { return nil }
+func (refreshRepoMock) RevokeAllExcept(context.Context, domain.UserID, []string) ([]string, error) {
+	return nil, nil
+}
 
 type verificationRepoMock struct{}
 
@@ -114,9 +221,6 @@ func (verificationRepoMock) Create(context.Context, domain.VerificationToken) er
 func (verificationRepoMock) GetLatest(context.Context, string, domain.TokenType) (domain.VerificationToken, bool, error) {
 	return domain.VerificationToken{}, false, nil
 }
-func (verificationRepoMock) GetByID(context.Context, string) (domain.VerificationToken, bool, error) {
-	return domain.VerificationToken{}, false, nil
-}
 func (verificationRepoMock) GetByCode(context.Context, string, domain.TokenType, string) (domain.VerificationToken, bool, error) {
 	return domain.VerificationToken{}, false, nil
 }
@@ -124,7 +228,7 @@ func (verificationRepoMock) MarkUsed(context.Context, string, time.Time) error {
 
 type accessIssuerMock struct{}
 
-func (accessIssuerMock) Issue(userID, sessionID string, ttl time.Duration) (string, error) {
+func (accessIssuerMock) Issue(common.AccessClaims, time.Duration) (string, error) {
 	return "", nil
 }
 
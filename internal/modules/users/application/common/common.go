@@ -1,15 +1,121 @@
 package common
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
+// AccessClaims describes the session an access token is issued for, or
+// the OAuth client and scopes of a client token, which has no user.
+type AccessClaims struct {
+	UserID    string
+	SessionID string
+	AuthTime  time.Time
+	AMR       []string
+	ClientID  string
+	Scopes    []string
+}
+
+// SessionClaims returns the access token claims for a session record.
+func SessionClaims(session domain.RefreshToken) AccessClaims {
+	return AccessClaims{
+		UserID:    session.UserID.String(),
+		SessionID: session.ID,
+		AuthTime:  session.AuthTime,
+		AMR:       session.AMR,
+	}
+}
+
+// GrantClaims returns the access token claims for a session a user granted
+// to an OAuth client, which is limited to the granted scopes. Such sessions
+// are handed over (see NewHandedOverRecord), so the claims carry no
+// auth_time.
+func GrantClaims(session domain.RefreshToken, grant domain.OAuthGrant) AccessClaims {
+	return AccessClaims{
+		UserID:    session.UserID.String(),
+		SessionID: session.ID,
+		AMR:       session.AMR,
+		ClientID:  grant.ClientID,
+		Scopes:    grant.Scopes,
+	}
+}
+
+// NewHandedOverRecord returns a session that was signed in on another
+// session's behalf: an OAuth client, a device or a desktop approved from a
+// session where the user had authenticated. It keeps the authentication
+// methods of that login but has no auth time, so that whoever received it
+// must step up before sensitive operations instead of passing for a recent
+// login.
+func NewHandedOverRecord(ctx context.Context, userID domain.UserID, tokenHash string, now time.Time, policy SessionPolicy, loginMethod string, amr []string) domain.RefreshToken {
+	record := NewRefreshRecord(ctx, userID, tokenHash, now, policy)
+	record.LoginMethod = loginMethod
+	record.AMR = amr
+	record.AuthTime = time.Time{}
+	return record
+}
+
 type AccessTokenIssuer interface {
-	Issue(userID, sessionID string, ttl time.Duration) (string, error)
+	Issue(claims AccessClaims, ttl time.Duration) (string, error)
+}
+
+// AccessTokenInfo is what a valid access token carries: the session or
+// personal access token of a user, or a client, and its lifetime.
+type AccessTokenInfo struct {
+	UserID    string
+	SessionID string
+	TokenID   string
+	ClientID  string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// AccessTokenInspector checks access tokens as authenticated routes do;
+// tokens that routes would refuse fail.
+type AccessTokenInspector interface {
+	Inspect(ctx context.Context, token string) (AccessTokenInfo, error)
+}
+
+// DefaultReauthMaxAge is how long after a login or step-up sensitive
+// operations are allowed when no window is configured.
+const DefaultReauthMaxAge = 10 * time.Minute
+
+// RequireRecentAuth rejects callers whose session authenticated more than
+// maxAge ago. A zero authTime (tokens issued before auth_time was recorded)
+// is never recent.
+func RequireRecentAuth(authTime time.Time, maxAge time.Duration) error {
+	if authTime.IsZero() || time.Since(authTime) > maxAge {
+		return domain.ErrReauthenticationRequired
+	}
+	return nil
+}
+
+// RevokeTrustedDevices drops the user's trusted devices, so that none of
+// them skips a TOTP enrolled after it was trusted. A nil devices does
+// nothing.
+func RevokeTrustedDevices(ctx context.Context, devices domain.TrustedDeviceRepository, userID domain.UserID, now time.Time) error {
+	if devices == nil {
+		return nil
+	}
+	trusted, err := devices.ListByUser(ctx, userID)
+	if err != nil {
+		return NormalizeError(err)
+	}
+	for _, device := range trusted {
+		if !device.IsValid(now) {
+			continue
+		}
+		if err := devices.Revoke(ctx, device.ID); err != nil {
+			return NormalizeError(err)
+		}
+	}
+	return nil
 }
 
 func NewRefreshToken() (string, error) {
@@ -12,3 +12,12 @@ import "context"
 type DomainEventPublisher interface {
 	Publish(ctx context.Context, eventID string, eventType string, payload []byte) error
 }
+
+// SensitiveDomainEventPublisher is implemented by trusted delivery channels
+// (e.g. the mailer) that need the sensitive fields of an event. Sensitive is
+// a JSON object holding only those fields; it is kept out of payload so that
+// generic publishers (loggers, webhooks) never see it.
+type SensitiveDomainEventPublisher interface {
+	DomainEventPublisher
+	PublishSensitive(ctx context.Context, eventID string, eventType string, payload []byte, sensitive []byte) error
+}
@@ -27,10 +27,42 @@ func isDomainError(err error) bool {
 		errors.Is(err, domain.ErrEmailAlreadyUsed),
 		errors.Is(err, domain.ErrInvalidDisplayName),
 		errors.Is(err, domain.ErrInvalidAvatarURL),
+		errors.Is(err, domain.ErrInvalidDeviceName),
 		errors.Is(err, domain.ErrInvalidCredentials),
 		errors.Is(err, domain.ErrUnauthorized),
 		errors.Is(err, domain.ErrIdentityAlreadyLinked),
-		errors.Is(err, domain.ErrRefreshTokenInvalid):
+		errors.Is(err, domain.ErrRefreshTokenInvalid),
+		errors.Is(err, domain.ErrUnknownChallengeStep),
+		errors.Is(err, domain.ErrRecoveryNotReady),
+		errors.Is(err, domain.ErrReauthenticationRequired),
+		errors.Is(err, domain.ErrStepUpUnavailable),
+		errors.Is(err, domain.ErrSessionLimitReached),
+		errors.Is(err, domain.ErrInvalidCursor),
+		errors.Is(err, domain.ErrUserNotFound),
+		errors.Is(err, domain.ErrReasonRequired),
+		errors.Is(err, domain.ErrInvalidScope),
+		errors.Is(err, domain.ErrInvalidTokenName),
+		errors.Is(err, domain.ErrInvalidTokenExpiry),
+		errors.Is(err, domain.ErrTokenLimitReached),
+		errors.Is(err, domain.ErrInvalidClient),
+		errors.Is(err, domain.ErrClientNotFound),
+		errors.Is(err, domain.ErrInvalidClientName),
+		errors.Is(err, domain.ErrInvalidClientAuthMethod),
+		errors.Is(err, domain.ErrInvalidClientKey),
+		errors.Is(err, domain.ErrInvalidOAuthRequest),
+		errors.Is(err, domain.ErrUnsupportedGrantType),
+		errors.Is(err, domain.ErrUnauthorizedClient),
+		errors.Is(err, domain.ErrInvalidRedirectURI),
+		errors.Is(err, domain.ErrUnsupportedResponseType),
+		errors.Is(err, domain.ErrInvalidGrant),
+		errors.Is(err, domain.ErrInsufficientScope),
+		errors.Is(err, domain.ErrUnsupportedTokenType),
+		errors.Is(err, domain.ErrAuthorizationPending),
+		errors.Is(err, domain.ErrSlowDown),
+		errors.Is(err, domain.ErrAccessDenied),
+		errors.Is(err, domain.ErrExpiredToken),
+		errors.Is(err, domain.ErrInvalidUserCode),
+		errors.Is(err, domain.ErrInvalidQRCode):
 		return true
 	default:
 		return false
@@ -2,8 +2,10 @@ package common
 
 import (
 	"context"
+	"time"
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
 // EventPublisher defines outbound integration events produced by the Users bounded context.
@@ -12,6 +14,12 @@ type EventPublisher interface {
 	PublishUserRegistered(ctx context.Context, event events.UserRegistered) error
 	PublishEmailConfirmationRequested(ctx context.Context, event events.EmailConfirmationRequested) error
 	PublishPasswordResetRequested(ctx context.Context, event events.PasswordResetRequested) error
+	PublishLoginCodeRequested(ctx context.Context, event events.LoginCodeRequested) error
+	PublishAccountRecoveryRequested(ctx context.Context, event events.AccountRecoveryRequested) error
+	PublishAccountRecoveryScheduled(ctx context.Context, event events.AccountRecoveryScheduled) error
+	PublishAccountRecoveryCompleted(ctx context.Context, event events.AccountRecoveryCompleted) error
+	PublishSessionRevoked(ctx context.Context, event events.SessionRevoked) error
+	PublishPasswordChanged(ctx context.Context, event events.PasswordChanged) error
 }
 
 // NopEventPublisher is useful for tests or environments where outbound delivery is disabled.
@@ -28,3 +36,59 @@ func (NopEventPublisher) PublishEmailConfirmationRequested(_ context.Context, _
 func (NopEventPublisher) PublishPasswordResetRequested(_ context.Context, _ events.PasswordResetRequested) error {
 	return nil
 }
+
+func (NopEventPublisher) PublishLoginCodeRequested(_ context.Context, _ events.LoginCodeRequested) error {
+	return nil
+}
+
+func (NopEventPublisher) PublishAccountRecoveryRequested(_ context.Context, _ events.AccountRecoveryRequested) error {
+	return nil
+}
+
+func (NopEventPublisher) PublishAccountRecoveryScheduled(_ context.Context, _ events.AccountRecoveryScheduled) error {
+	return nil
+}
+
+func (NopEventPublisher) PublishAccountRecoveryCompleted(_ context.Context, _ events.AccountRecoveryCompleted) error {
+	return nil
+}
+
+func (NopEventPublisher) PublishSessionRevoked(_ context.Context, _ events.SessionRevoked) error {
+	return nil
+}
+
+func (NopEventPublisher) PublishPasswordChanged(_ context.Context, _ events.PasswordChanged) error {
+	return nil
+}
+
+// PublishSessionsRevoked emits a SessionRevoked event for each session id.
+func PublishSessionsRevoked(ctx context.Context, publisher EventPublisher, userID domain.UserID, sessionIDs []string, reason string, now time.Time) error {
+	for _, id := range sessionIDs {
+		if err := publisher.PublishSessionRevoked(ctx, events.SessionRevoked{
+			UserID:     userID.String(),
+			SessionID:  id,
+			Reason:     reason,
+			OccurredAt: now,
+		}); err != nil {
+			return NormalizeError(err)
+		}
+	}
+	return nil
+}
+
+// PublishPasswordChanged notifies the owner of ident that its password was
+// replaced by method, with the client that did it.
+func PublishPasswordChanged(ctx context.Context, publisher EventPublisher, ident domain.Identity, method string, now time.Time) error {
+	meta, _ := RequestMetaFromContext(ctx)
+	return NormalizeError(publisher.PublishPasswordChanged(ctx, events.PasswordChanged{
+		UserID:     ident.UserID.String(),
+		IdentityID: ident.ID,
+		Email:      ident.ProviderUserID,
+		Method:     method,
+		IP:         meta.IP,
+		UserAgent:  meta.UserAgent,
+		Country:    meta.Country,
+		City:       meta.City,
+		OccurredAt: now,
+	}))
+}
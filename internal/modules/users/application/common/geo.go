@@ -0,0 +1,16 @@
+package common
+
+// Location is the coarse position of an IP address. Country is an ISO 3166-1
+// alpha-2 code; City is its English name. Either may be empty.
+type Location struct {
+	Country   string
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoLocator resolves IP addresses without leaving the process. It is
+// optional everywhere; without it locations are simply left empty.
+type GeoLocator interface {
+	Locate(ip string) (Location, bool)
+}
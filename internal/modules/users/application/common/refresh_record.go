@@ -8,26 +8,43 @@ import (
 )
 
 // NewRefreshRecord builds a refresh token record enriched with request metadata
-// (user agent, IP) when available in the context.
-func NewRefreshRecord(ctx context.Context, userID domain.UserID, tokenHash string, now time.Time, ttl time.Duration) domain.RefreshToken {
+// (user agent, IP) when available in the context. Its lifetime is the one
+// policy sets for the client type of the request.
+func NewRefreshRecord(ctx context.Context, userID domain.UserID, tokenHash string, now time.Time, policy SessionPolicy) domain.RefreshToken {
 	meta, _ := RequestMetaFromContext(ctx)
-	record := domain.NewRefreshTokenRecord(userID, tokenHash, now, ttl)
+	clientType := domain.NormalizeClientType(meta.ClientType)
+	lifetime := policy.For(clientType)
+	record := domain.NewRefreshTokenRecord(userID, tokenHash, now, lifetime.IdleTimeout)
+	if lifetime.AbsoluteLifetime > 0 {
+		record = record.WithAbsoluteExpiry(now.Add(lifetime.AbsoluteLifetime))
+	}
 	record.UserAgent = meta.UserAgent
 	record.IP = meta.IP
+	record.LastIP = meta.IP
+	record.Country = meta.Country
+	record.City = meta.City
+	record.ClientType = clientType
 	return record
 }
 
 // PrepareRefreshRecord returns a refresh record and whether it should reuse an existing session row.
-// It reuses an active session when the same user agent and IP are already stored.
+// It reuses an active session when the same user agent and IP are already stored,
+// keeping what was recorded when that session was first created.
+// loginMethod is a domain.LoginMethod* value; methods are the authentication
+// method references (domain.AMR*) of the login.
 func PrepareRefreshRecord(
 	ctx context.Context,
 	repo domain.RefreshTokenRepository,
 	userID domain.UserID,
 	tokenHash string,
 	now time.Time,
-	ttl time.Duration,
+	policy SessionPolicy,
+	loginMethod string,
+	methods ...string,
 ) (domain.RefreshToken, bool, error) {
-	record := NewRefreshRecord(ctx, userID, tokenHash, now, ttl)
+	record := NewRefreshRecord(ctx, userID, tokenHash, now, policy)
+	record.LoginMethod = loginMethod
+	record.AMR = domain.NewAMR(methods...)
 	if record.UserAgent == "" && record.IP == "" {
 		return record, false, nil
 	}
@@ -38,6 +55,11 @@ func PrepareRefreshRecord(
 	}
 	if found {
 		record.ID = existing.ID
+		record.CreatedAt = existing.CreatedAt
+		if existing.LoginMethod != "" {
+			record.LoginMethod = existing.LoginMethod
+		}
+		record.DeviceName = existing.DeviceName
 		return record, true, nil
 	}
 	return record, false, nil
@@ -4,9 +4,15 @@ import "context"
 
 type requestMetaKey struct{}
 
+// RequestMeta describes the client of a request. Country and City are
+// resolved from IP when a GeoLocator is configured. ClientType is what the
+// client announced itself as; see domain.NormalizeClientType.
 type RequestMeta struct {
-	UserAgent string
-	IP        string
+	UserAgent  string
+	IP         string
+	Country    string
+	City       string
+	ClientType string
 }
 
 func WithRequestMeta(ctx context.Context, meta RequestMeta) context.Context {
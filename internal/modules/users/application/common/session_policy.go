@@ -0,0 +1,41 @@
+package common
+
+import "time"
+
+// DefaultIdleTimeout is how long an unused session lasts when no idle
+// timeout is configured.
+const DefaultIdleTimeout = 30 * 24 * time.Hour
+
+// SessionLifetime bounds a session. IdleTimeout is sliding: every refresh
+// extends the session by it. AbsoluteLifetime counts from the login and ends
+// the session however active it is; zero means no hard limit.
+type SessionLifetime struct {
+	IdleTimeout      time.Duration
+	AbsoluteLifetime time.Duration
+}
+
+// SessionPolicy is the default SessionLifetime with overrides per client
+// type (domain.ClientType*). Zero fields of an override fall back to the
+// default.
+type SessionPolicy struct {
+	IdleTimeout      time.Duration
+	AbsoluteLifetime time.Duration
+	PerClientType    map[string]SessionLifetime
+}
+
+// For returns the lifetime of sessions created by clientType.
+func (p SessionPolicy) For(clientType string) SessionLifetime {
+	l := SessionLifetime{IdleTimeout: p.IdleTimeout, AbsoluteLifetime: p.AbsoluteLifetime}
+	if o, ok := p.PerClientType[clientType]; ok && clientType != "" {
+		if o.IdleTimeout > 0 {
+			l.IdleTimeout = o.IdleTimeout
+		}
+		if o.AbsoluteLifetime > 0 {
+			l.AbsoluteLifetime = o.AbsoluteLifetime
+		}
+	}
+	if l.IdleTimeout <= 0 {
+		l.IdleTimeout = DefaultIdleTimeout
+	}
+	return l
+}
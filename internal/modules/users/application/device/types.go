@@ -0,0 +1,25 @@
+package device
+
+import "time"
+
+type ListInput struct {
+	UserID string
+}
+
+type RevokeInput struct {
+	UserID   string
+	DeviceID string
+}
+
+type Device struct {
+	ID         string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type Output struct {
+	Devices []Device
+}
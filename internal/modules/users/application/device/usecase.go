@@ -0,0 +1,74 @@
+package device
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// UseCase manages the devices a user marked as trusted while completing a
+// two-factor challenge.
+type UseCase struct {
+	devices domain.TrustedDeviceRepository
+}
+
+func New(devices domain.TrustedDeviceRepository) *UseCase {
+	return &UseCase{devices: devices}
+}
+
+func (uc *UseCase) List(ctx context.Context, in ListInput) (Output, error) {
+	userID, err := domain.ParseUserID(in.UserID)
+	if err != nil {
+		return Output{}, err
+	}
+
+	devices, err := uc.devices.ListByUser(ctx, userID)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+
+	now := time.Now().UTC()
+	out := Output{Devices: make([]Device, 0, len(devices))}
+	for _, d := range devices {
+		if !d.IsValid(now) {
+			continue
+		}
+		out.Devices = append(out.Devices, Device{
+			ID:         d.ID,
+			UserAgent:  d.UserAgent,
+			IP:         d.IP,
+			CreatedAt:  d.CreatedAt,
+			ExpiresAt:  d.ExpiresAt,
+			LastUsedAt: d.LastUsedAt,
+		})
+	}
+	return out, nil
+}
+
+func (uc *UseCase) Revoke(ctx context.Context, in RevokeInput) (struct{}, error) {
+	userID, err := domain.ParseUserID(in.UserID)
+	if err != nil {
+		return struct{}{}, err
+	}
+
+	// Device ids come from the request body; anything but a UUID cannot
+	// name a device and would fail the lookup's cast.
+	if _, err := uuid.Parse(in.DeviceID); err != nil {
+		return struct{}{}, domain.ErrUnauthorized
+	}
+	device, found, err := uc.devices.GetByID(ctx, in.DeviceID)
+	if err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	if !found || device.UserID != userID {
+		return struct{}{}, domain.ErrUnauthorized
+	}
+
+	if err := uc.devices.Revoke(ctx, device.ID); err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	return struct{}{}, nil
+}
@@ -0,0 +1,96 @@
+package epoch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+type epochRepoStub struct{ set []domain.TokenEpoch }
+
+func (s *epochRepoStub) Set(_ context.Context, e domain.TokenEpoch) error {
+	s.set = append(s.set, e)
+	return nil
+}
+
+func (s *epochRepoStub) NotBefore(context.Context, domain.UserID) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (s *epochRepoStub) ListAfter(context.Context, time.Time) ([]domain.TokenEpoch, error) {
+	return nil, nil
+}
+
+type userRepoStub struct{ users map[domain.UserID]domain.User }
+
+func (s userRepoStub) Create(context.Context, domain.User) error { return nil }
+
+func (s userRepoStub) GetByID(_ context.Context, id domain.UserID) (domain.User, bool, error) {
+	u, ok := s.users[id]
+	return u, ok, nil
+}
+
+func (s userRepoStub) UpdateProfile(_ context.Context, u domain.User) (domain.User, error) {
+	return u, nil
+}
+
+type auditStub struct{ records []domain.AuditRecord }
+
+func (s *auditStub) Record(_ context.Context, r domain.AuditRecord) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func TestInvalidateStartsAnAuditedEpoch(t *testing.T) {
+	userID := domain.NewUserID()
+	epochs, audit := &epochRepoStub{}, &auditStub{}
+	uc := New(epochs, userRepoStub{users: map[domain.UserID]domain.User{userID: {ID: userID}}}, audit)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 500, time.UTC)
+	uc.now = func() time.Time { return now }
+
+	ctx := common.WithRequestMeta(context.Background(), common.RequestMeta{IP: "10.0.0.1"})
+	out, err := uc.Invalidate(ctx, InvalidateInput{UserID: userID.String(), Reason: "stolen laptop", Actor: "ops"})
+	if err != nil {
+		t.Fatalf("invalidate failed: %v", err)
+	}
+	// Tokens issued within the current second carry the same iat.
+	if !out.NotBefore.Equal(now.Truncate(time.Second).Add(time.Second)) || out.UserID != userID.String() {
+		t.Fatalf("unexpected epoch: %+v", out)
+	}
+	if len(epochs.set) != 1 || epochs.set[0].UserID != userID {
+		t.Fatalf("expected the user's epoch to be set, got %+v", epochs.set)
+	}
+	if len(audit.records) != 1 {
+		t.Fatalf("expected one audit record, got %d", len(audit.records))
+	}
+	rec := audit.records[0]
+	if rec.Action != domain.AuditActionTokensInvalidated || rec.Actor != "ops" || rec.UserID != userID || rec.IP != "10.0.0.1" || rec.Reason != "stolen laptop" {
+		t.Fatalf("unexpected audit record: %+v", rec)
+	}
+
+	out, err = uc.Invalidate(context.Background(), InvalidateInput{Reason: "key leak"})
+	if err != nil || out.UserID != "" || !epochs.set[1].Global() || audit.records[1].Actor != "unknown" {
+		t.Fatalf("expected a global epoch, got %+v err=%v", out, err)
+	}
+}
+
+func TestInvalidateRejectsBadInput(t *testing.T) {
+	epochs, audit := &epochRepoStub{}, &auditStub{}
+	uc := New(epochs, userRepoStub{}, audit)
+
+	if _, err := uc.Invalidate(context.Background(), InvalidateInput{Reason: " "}); !errors.Is(err, domain.ErrReasonRequired) {
+		t.Fatalf("expected a reason to be required, got %v", err)
+	}
+	for _, id := range []string{"not-a-uuid", domain.NewUserID().String()} {
+		if _, err := uc.Invalidate(context.Background(), InvalidateInput{UserID: id, Reason: "x"}); !errors.Is(err, domain.ErrUserNotFound) {
+			t.Fatalf("expected user %q not to be found, got %v", id, err)
+		}
+	}
+	if len(epochs.set) != 0 || len(audit.records) != 0 {
+		t.Fatalf("expected nothing to be written")
+	}
+}
@@ -11,11 +11,15 @@ type UserRegistered struct {
 	OccurredAt  time.Time `json:"occurred_at"`
 }
 
+// Fields tagged `sensitive:"true"` carry secrets meant only for the user
+// (verification codes, reset tokens). The outbox stores them encrypted,
+// scrubs them once delivered and hands them only to trusted publishers.
+
 type EmailConfirmationRequested struct {
 	UserID     string    `json:"user_id"`
 	IdentityID string    `json:"identity_id"`
 	Email      string    `json:"email"`
-	Code       string    `json:"code"`
+	Code       string    `json:"code" sensitive:"true"`
 	ExpiresAt  time.Time `json:"expires_at"`
 	OccurredAt time.Time `json:"occurred_at"`
 }
@@ -24,7 +28,111 @@ type PasswordResetRequested struct {
 	UserID     string    `json:"user_id"`
 	IdentityID string    `json:"identity_id"`
 	Email      string    `json:"email"`
-	Token      string    `json:"token"`
+	Token      string    `json:"token" sensitive:"true"`
 	ExpiresAt  time.Time `json:"expires_at"`
 	OccurredAt time.Time `json:"occurred_at"`
 }
+
+// LoginCodeRequested is emitted when a risky login must be confirmed with a
+// one-time code sent to the account email.
+type LoginCodeRequested struct {
+	UserID     string    `json:"user_id"`
+	IdentityID string    `json:"identity_id"`
+	Email      string    `json:"email"`
+	Code       string    `json:"code" sensitive:"true"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	City       string    `json:"city,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// AccountRecoveryRequested carries the code that proves email ownership at
+// the start of an account recovery.
+type AccountRecoveryRequested struct {
+	UserID      string    `json:"user_id"`
+	IdentityID  string    `json:"identity_id"`
+	ChallengeID string    `json:"challenge_id"`
+	Email       string    `json:"email"`
+	Code        string    `json:"code" sensitive:"true"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// AccountRecoveryScheduled warns the account owner that the second factor
+// will be reset at ReadyAt unless they follow the cancel link.
+type AccountRecoveryScheduled struct {
+	UserID      string    `json:"user_id"`
+	IdentityID  string    `json:"identity_id"`
+	ChallengeID string    `json:"challenge_id"`
+	Email       string    `json:"email"`
+	CancelToken string    `json:"cancel_token" sensitive:"true"`
+	CancelURL   string    `json:"cancel_url,omitempty" sensitive:"true"`
+	IP          string    `json:"ip,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	City        string    `json:"city,omitempty"`
+	ReadyAt     time.Time `json:"ready_at"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// AccountRecoveryCompleted is emitted after the second factor was reset and
+// all sessions were revoked.
+type AccountRecoveryCompleted struct {
+	UserID      string    `json:"user_id"`
+	IdentityID  string    `json:"identity_id"`
+	ChallengeID string    `json:"challenge_id"`
+	Email       string    `json:"email"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// Reasons reported by SessionRevoked.
+const (
+	SessionRevokedLogout    = "logout"
+	SessionRevokedLogoutAll = "logout_all"
+	SessionRevokedByUser    = "revoked"
+	SessionRevokedOthers    = "revoked_others"
+	// SessionRevokedPasswordChange and SessionRevokedPasswordReset end
+	// sessions after the password was changed or reset.
+	SessionRevokedPasswordChange = "password_changed"
+	SessionRevokedPasswordReset  = "password_reset"
+	// SessionRevokedEvicted ends the oldest or least recently used session
+	// to make room for a new login over the session limit.
+	SessionRevokedEvicted = "evicted"
+	// SessionRevokedRecovery ends every session once an account recovery
+	// reset the second factor.
+	SessionRevokedRecovery = "account_recovery"
+	// SessionRevokedByClient ends a session whose refresh token an OAuth
+	// client revoked.
+	SessionRevokedByClient = "client_revoked"
+)
+
+// SessionRevoked is emitted for every session that was revoked, so that
+// services caching access tokens can drop them before they expire.
+type SessionRevoked struct {
+	UserID     string    `json:"user_id"`
+	SessionID  string    `json:"session_id"`
+	Reason     string    `json:"reason"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// How the password was replaced, reported by PasswordChanged.
+const (
+	PasswordChangedByUser  = "change"
+	PasswordChangedByReset = "reset"
+)
+
+// PasswordChanged notifies the account owner that the password was replaced
+// and the other sessions were signed out.
+type PasswordChanged struct {
+	UserID     string    `json:"user_id"`
+	IdentityID string    `json:"identity_id"`
+	Email      string    `json:"email"`
+	Method     string    `json:"method"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	City       string    `json:"city,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
@@ -1,9 +1,13 @@
 package link
 
+import "time"
+
 type Input struct {
 	UserID         string
 	Provider       string
 	ProviderUserID string
+	// AuthTime is when the caller's session last authenticated.
+	AuthTime time.Time
 }
 
 type Output struct {
@@ -9,11 +9,15 @@ import (
 )
 
 type UseCase struct {
-	identities domain.IdentityRepository
+	identities   domain.IdentityRepository
+	reauthMaxAge time.Duration
 }
 
-func New(identities domain.IdentityRepository) *UseCase {
-	return &UseCase{identities: identities}
+func New(identities domain.IdentityRepository, reauthMaxAge time.Duration) *UseCase {
+	if reauthMaxAge <= 0 {
+		reauthMaxAge = common.DefaultReauthMaxAge
+	}
+	return &UseCase{identities: identities, reauthMaxAge: reauthMaxAge}
 }
 
 func (uc *UseCase) Execute(ctx context.Context, in Input) (Output, error) {
@@ -21,6 +25,9 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (Output, error) {
 	if err != nil {
 		return Output{}, err
 	}
+	if err := common.RequireRecentAuth(in.AuthTime, uc.reauthMaxAge); err != nil {
+		return Output{}, err
+	}
 
 	if err := domain.EnsureIdentityAvailable(ctx, uc.identities, userID, in.Provider, in.ProviderUserID); err != nil {
 		return Output{}, common.NormalizeError(err)
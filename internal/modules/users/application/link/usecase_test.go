@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
@@ -33,9 +34,9 @@ func (m *linkIdentityRepoMock) GetByUserAndProvider(context.Context, domain.User
 
 func TestLinkProvider(t *testing.T) {
 	repo := &linkIdentityRepoMock{available: true}
-	uc := New(repo)
+	uc := New(repo, 0)
 
-	out, err := uc.Execute(context.Background(), Input{UserID: "user", Provider: "github", ProviderUserID: "gh-1"})
+	out, err := uc.Execute(context.Background(), Input{UserID: "user", Provider: "github", ProviderUserID: "gh-1", AuthTime: time.Now()})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -46,9 +47,9 @@ func TestLinkProvider(t *testing.T) {
 
 func TestLinkProviderUnavailable(t *testing.T) {
 	repo := &linkIdentityRepoMock{}
-	uc := New(repo)
+	uc := New(repo, 0)
 
-	_, err := uc.Execute(context.Background(), Input{UserID: "user", Provider: "github", ProviderUserID: "gh-1"})
+	_, err := uc.Execute(context.Background(), Input{UserID: "user", Provider: "github", ProviderUserID: "gh-1", AuthTime: time.Now()})
 	if !errors.Is(err, domain.ErrIdentityAlreadyLinked) {
 		t.Fatalf("expected conflict error, got %v", err)
 	}
@@ -6,6 +6,9 @@ type Input struct {
 	Email    string
 	Password string
 	OTP      string
+	// DeviceToken is a trusted-device token from an earlier challenge; when
+	// valid the TOTP step is skipped.
+	DeviceToken string
 }
 
 type ChallengeInfo struct {
@@ -18,6 +21,14 @@ type ChallengeInfo struct {
 	AttemptsLeft   int
 	LockUntil      *time.Time
 	MaskedEmail    string
+	// Steps holds attempt and lock state per step once any was attempted.
+	Steps []StepInfo
+}
+
+type StepInfo struct {
+	Step         string
+	AttemptsLeft int
+	LockUntil    *time.Time
 }
 type Output struct {
 	UserID       string
@@ -29,6 +40,12 @@ type Output struct {
 	AvatarURL    string
 	AccessToken  string
 	RefreshToken string
+	// RefreshExpiresAt is when the refresh token lapses if it is not used,
+	// as set by the session lifetime of the client type.
+	RefreshExpiresAt time.Time
+	// DeviceToken is set only when the user asked to trust this device while
+	// completing a challenge. It is shown once.
+	DeviceToken string
 
 	Status    string
 	Challenge *ChallengeInfo
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/risk"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
@@ -15,16 +16,21 @@ type UseCase struct {
 	refresh    domain.RefreshTokenRepository
 	challenges domain.ChallengeRepository
 	hasher     domain.PasswordHasher
+	devices    domain.TrustedDeviceRepository
+	codes      domain.VerificationCodeHasher
+	attempts   domain.LoginAttemptRepository
 
 	access                   common.AccessTokenIssuer
+	risk                     risk.Assessor
 	accessTTL                time.Duration
-	refreshTTL               time.Duration
+	sessionPolicy            common.SessionPolicy
 	requireEmailVerification bool
 
 	challengeTTL       time.Duration
 	totpAttempts       int
 	totpLockDuration   time.Duration
 	requestEmailVerify func(context.Context, domain.Identity) error
+	requestLoginCode   func(context.Context, domain.Identity) error
 }
 
 func New(
@@ -33,21 +39,23 @@ func New(
 	refresh domain.RefreshTokenRepository,
 	challenges domain.ChallengeRepository,
 	hasher domain.PasswordHasher,
+	devices domain.TrustedDeviceRepository,
+	codes domain.VerificationCodeHasher,
+	attempts domain.LoginAttemptRepository,
 	access common.AccessTokenIssuer,
+	assessor risk.Assessor,
 	accessTTL time.Duration,
-	refreshTTL time.Duration,
+	sessionPolicy common.SessionPolicy,
 	requireEmailVerification bool,
 	challengeTTL time.Duration,
 	totpAttempts int,
 	totpLockDuration time.Duration,
 	requestEmailVerify func(context.Context, domain.Identity) error,
+	requestLoginCode func(context.Context, domain.Identity) error,
 ) *UseCase {
 	if accessTTL == 0 {
 		accessTTL = 15 * time.Minute
 	}
-	if refreshTTL == 0 {
-		refreshTTL = 30 * 24 * time.Hour
-	}
 	if challengeTTL == 0 {
 		challengeTTL = 5 * time.Minute
 	}
@@ -63,14 +71,19 @@ func New(
 		refresh:                  refresh,
 		challenges:               challenges,
 		hasher:                   hasher,
+		devices:                  devices,
+		codes:                    codes,
+		attempts:                 attempts,
 		access:                   access,
+		risk:                     assessor,
 		accessTTL:                accessTTL,
-		refreshTTL:               refreshTTL,
+		sessionPolicy:            sessionPolicy,
 		requireEmailVerification: requireEmailVerification,
 		challengeTTL:             challengeTTL,
 		totpAttempts:             totpAttempts,
 		totpLockDuration:         totpLockDuration,
 		requestEmailVerify:       requestEmailVerify,
+		requestLoginCode:         requestLoginCode,
 	}
 }
 
@@ -88,7 +101,20 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (Output, error) {
 		return Output{}, domain.ErrInvalidCredentials
 	}
 
+	// The risk engine decides before the password is checked, so that a
+	// denied client cannot tell a right password from a wrong one.
+	now := time.Now().UTC()
+	trusted, err := uc.isTrustedDevice(ctx, ident.UserID, in.DeviceToken, now)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	riskSteps, err := uc.assessRisk(ctx, ident.UserID, trusted, now)
+	if err != nil {
+		return Output{}, err
+	}
+
 	if err := ident.Authenticate(ctx, uc.hasher, in.Password); err != nil {
+		uc.recordAttempt(ctx, ident.UserID, false)
 		return Output{}, domain.ErrInvalidCredentials
 	}
 
@@ -101,7 +127,6 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (Output, error) {
 	}
 
 	requiredSteps := make([]domain.ChallengeStep, 0)
-	now := time.Now().UTC()
 	if u.Suspended || (u.BlockedUntil != nil && u.BlockedUntil.After(now)) {
 		requiredSteps = append(requiredSteps, domain.ChallengeStepAccountBlocked)
 	}
@@ -113,12 +138,29 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (Output, error) {
 		}
 	}
 
-	if ident.IsTwoFactorEnabled() {
+	if ident.IsTwoFactorEnabled() && !trusted {
 		requiredSteps = append(requiredSteps, domain.ChallengeStepTOTP)
 	}
 
+	for _, step := range riskSteps {
+		if step == domain.ChallengeStepEmailOTP && containsStep(requiredSteps, domain.ChallengeStepEmailVerification) {
+			// Confirming the email address already proves access to the inbox.
+			continue
+		}
+		// A login code that could not be sent would leave the step
+		// unanswerable, so the login fails instead.
+		if step == domain.ChallengeStepEmailOTP && uc.requestLoginCode != nil {
+			if err := uc.requestLoginCode(ctx, ident); err != nil {
+				return Output{}, common.NormalizeError(err)
+			}
+		}
+		requiredSteps = append(requiredSteps, step)
+	}
+
+	// A login that still needs a challenge has not succeeded yet; the
+	// challenge records the success once it is completed.
 	if len(requiredSteps) > 0 {
-		challenge := domain.NewChallenge(u.ID, "auth_challenge", requiredSteps, now.Add(uc.challengeTTL))
+		challenge := domain.NewChallenge(u.ID, domain.ChallengeTypeLogin, requiredSteps, now.Add(uc.challengeTTL))
 		challenge.AttemptsLeft = uc.totpAttempts
 		if len(requiredSteps) == 1 && requiredSteps[0] == domain.ChallengeStepAccountBlocked {
 			challenge.Status = domain.ChallengeStatusBlocked
@@ -155,12 +197,13 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (Output, error) {
 	}
 	refreshHash := common.HashToken(refreshRaw)
 
+	uc.recordAttempt(ctx, u.ID, true)
 	now = time.Now().UTC()
-	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, u.ID, refreshHash, now, uc.refreshTTL)
+	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, u.ID, refreshHash, now, uc.sessionPolicy, domain.LoginMethodPassword, domain.AMRPassword)
 	if err != nil {
 		return Output{}, common.NormalizeError(err)
 	}
-	accessToken, err := uc.access.Issue(u.ID.String(), refreshRecord.ID, uc.accessTTL)
+	accessToken, err := uc.access.Issue(common.SessionClaims(refreshRecord), uc.accessTTL)
 	if err != nil {
 		return Output{}, common.NormalizeError(err)
 	}
@@ -174,18 +217,79 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (Output, error) {
 	}
 
 	return Output{
-		UserID:       u.ID.String(),
-		Email:        ident.ProviderUserID,
-		FirstName:    u.FirstName,
-		LastName:     u.LastName,
-		MiddleName:   u.MiddleName,
-		DisplayName:  u.DisplayName,
-		AvatarURL:    u.AvatarURL,
-		AccessToken:  accessToken,
-		RefreshToken: refreshRaw,
+		UserID:           u.ID.String(),
+		Email:            ident.ProviderUserID,
+		FirstName:        u.FirstName,
+		LastName:         u.LastName,
+		MiddleName:       u.MiddleName,
+		DisplayName:      u.DisplayName,
+		AvatarURL:        u.AvatarURL,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshRaw,
+		RefreshExpiresAt: refreshRecord.ExpiresAt,
 	}, nil
 }
 
+// assessRisk consults the risk engine and returns the extra steps it asks
+// for. A denial is answered like a wrong password but not recorded: the
+// password was never checked, and counting it would keep the score up for
+// as long as the denied client retries.
+func (uc *UseCase) assessRisk(ctx context.Context, userID domain.UserID, trusted bool, now time.Time) ([]domain.ChallengeStep, error) {
+	if uc.risk == nil {
+		return nil, nil
+	}
+	meta, _ := common.RequestMetaFromContext(ctx)
+	decision, err := uc.risk.Assess(ctx, risk.Input{UserID: userID, Meta: meta, KnownDevice: trusted, Now: now})
+	if err != nil {
+		return nil, common.NormalizeError(err)
+	}
+	if decision.Deny {
+		return nil, domain.ErrInvalidCredentials
+	}
+	return decision.Steps, nil
+}
+
+// recordAttempt stores the outcome for later risk scoring. Failures to write
+// the history must not change the login result.
+func (uc *UseCase) recordAttempt(ctx context.Context, userID domain.UserID, succeeded bool) {
+	if uc.attempts == nil {
+		return
+	}
+	meta, _ := common.RequestMetaFromContext(ctx)
+	_ = uc.attempts.Record(ctx, domain.NewLoginAttempt(userID, meta.IP, meta.UserAgent, succeeded, time.Now().UTC()))
+}
+
+func containsStep(steps []domain.ChallengeStep, step domain.ChallengeStep) bool {
+	for _, s := range steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrustedDevice reports whether token is a live trusted-device token of
+// userID and records its use.
+func (uc *UseCase) isTrustedDevice(ctx context.Context, userID domain.UserID, token string, now time.Time) (bool, error) {
+	if token == "" || uc.devices == nil || uc.codes == nil {
+		return false, nil
+	}
+	if !domain.VerifyDeviceToken(token, userID, uc.codes) {
+		return false, nil
+	}
+	device, found, err := uc.devices.GetByHash(ctx, userID, uc.codes.Hash(token))
+	if err != nil {
+		return false, err
+	}
+	if !found || !device.IsValid(now) {
+		return false, nil
+	}
+	if err := uc.devices.Touch(ctx, device.ID, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func stepsToString(steps []domain.ChallengeStep) []string {
 	result := make([]string, 0, len(steps))
 	for _, step := range steps {
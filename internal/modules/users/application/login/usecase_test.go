@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/risk"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
@@ -57,7 +58,10 @@ func (m *loginIdentityRepoMock) GetByUserAndProvider(context.Context, domain.Use
 }
 func (m *loginIdentityRepoMock) Update(context.Context, domain.Identity) error { return nil }
 
-type loginRefreshRepoMock struct{ created []domain.RefreshToken }
+type loginRefreshRepoMock struct {
+	created  []domain.RefreshToken
+	sessions []domain.RefreshToken
+}
 
 func (m *loginRefreshRepoMock) Create(_ context.Context, token domain.RefreshToken) error {
 	m.created = append(m.created, token)
@@ -73,14 +77,17 @@ func (m *loginRefreshRepoMock) GetByID(context.Context, string) (domain.RefreshT
 	return domain.RefreshToken{}, false, errors.New("not implemented")
 }
 func (m *loginRefreshRepoMock) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
+	return m.sessions, nil
+}
+func (m *loginRefreshRepoMock) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
 	return nil, errors.New("not implemented")
 }
 func (m *loginRefreshRepoMock) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
 	return domain.RefreshToken{}, false, nil
 }
 func (m *loginRefreshRepoMock) Revoke(context.Context, string) error { return nil }
-func (m *loginRefreshRepoMock) RevokeAllExcept(context.Context, domain.UserID, []string) error {
-	return errors.New("not implemented")
+func (m *loginRefreshRepoMock) RevokeAllExcept(context.Context, domain.UserID, []string) ([]string, error) {
+	return nil, errors.New("not implemented")
 }
 
 type loginHasherMock struct{ compareErr error }
@@ -92,7 +99,9 @@ func (m *loginHasherMock) Compare(context.Context, string, string) error { retur
 
 type loginIssuerMock struct{ token string }
 
-func (m *loginIssuerMock) Issue(_, _ string, _ time.Duration) (string, error) { return m.token, nil }
+func (m *loginIssuerMock) Issue(common.AccessClaims, time.Duration) (string, error) {
+	return m.token, nil
+}
 
 type loginChallengeRepoMock struct {
 	created []domain.Challenge
@@ -118,7 +127,7 @@ func TestLoginSuccess(t *testing.T) {
 	identity := domain.Identity{UserID: user.ID, SecretHash: "hash"}
 
 	uow := &loginUnitOfWorkMock{}
-	uc := common.NewTransactionalUseCase(uow, New(&loginUsersRepoMock{user: user}, &loginIdentityRepoMock{identity: identity, found: true}, &loginRefreshRepoMock{}, &loginChallengeRepoMock{}, &loginHasherMock{}, &loginIssuerMock{token: "access"}, time.Minute, time.Hour, false, 0, 0, 0, nil))
+	uc := common.NewTransactionalUseCase(uow, New(&loginUsersRepoMock{user: user}, &loginIdentityRepoMock{identity: identity, found: true}, &loginRefreshRepoMock{}, &loginChallengeRepoMock{}, &loginHasherMock{}, nil, nil, nil, &loginIssuerMock{token: "access"}, nil, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, false, 0, 0, 0, nil, nil))
 
 	out, err := uc.Execute(context.Background(), Input{Email: "user@example.com", Password: "password123"})
 	if err != nil {
@@ -132,15 +141,243 @@ func TestLoginSuccess(t *testing.T) {
 	}
 }
 
+func TestLoginAppliesSessionLifetimeOfClientType(t *testing.T) {
+	user := domain.User{ID: "user-1", DisplayName: "User"}
+	identity := domain.Identity{UserID: user.ID, SecretHash: "hash"}
+	refresh := &loginRefreshRepoMock{}
+	policy := common.SessionPolicy{
+		IdleTimeout:      time.Hour,
+		AbsoluteLifetime: 24 * time.Hour,
+		PerClientType:    map[string]common.SessionLifetime{domain.ClientTypeMobile: {IdleTimeout: 7 * 24 * time.Hour, AbsoluteLifetime: 90 * 24 * time.Hour}},
+	}
+	uc := New(&loginUsersRepoMock{user: user}, &loginIdentityRepoMock{identity: identity, found: true}, refresh, &loginChallengeRepoMock{}, &loginHasherMock{}, nil, nil, nil, &loginIssuerMock{token: "access"}, nil, time.Minute, policy, false, 0, 0, 0, nil, nil)
+
+	ctx := common.WithRequestMeta(context.Background(), common.RequestMeta{ClientType: "Mobile"})
+	before := time.Now().UTC()
+	out, err := uc.Execute(ctx, Input{Email: "user@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	session := refresh.created[0]
+	if session.ClientType != domain.ClientTypeMobile {
+		t.Fatalf("expected a mobile session, got %q", session.ClientType)
+	}
+	if !out.RefreshExpiresAt.Equal(session.ExpiresAt) {
+		t.Fatalf("expected the session expiry in the output, got %v", out.RefreshExpiresAt)
+	}
+	if idle := session.ExpiresAt.Sub(before); idle < 7*24*time.Hour || idle > 7*24*time.Hour+time.Minute {
+		t.Fatalf("expected the mobile idle timeout, got %v", idle)
+	}
+	if absolute := session.AbsoluteExpiresAt.Sub(before); absolute < 90*24*time.Hour || absolute > 90*24*time.Hour+time.Minute {
+		t.Fatalf("expected the mobile absolute lifetime, got %v", absolute)
+	}
+}
+
 func TestLoginInvalidCredentials(t *testing.T) {
-	uc := common.NewTransactionalUseCase(&loginUnitOfWorkMock{}, New(&loginUsersRepoMock{}, &loginIdentityRepoMock{}, &loginRefreshRepoMock{}, &loginChallengeRepoMock{}, &loginHasherMock{}, &loginIssuerMock{}, 0, 0, false, 0, 0, 0, nil))
+	uc := common.NewTransactionalUseCase(&loginUnitOfWorkMock{}, New(&loginUsersRepoMock{}, &loginIdentityRepoMock{}, &loginRefreshRepoMock{}, &loginChallengeRepoMock{}, &loginHasherMock{}, nil, nil, nil, &loginIssuerMock{}, nil, 0, common.SessionPolicy{}, false, 0, 0, 0, nil, nil))
 
 	if _, err := uc.Execute(context.Background(), Input{Email: "bad", Password: "pw"}); !errors.Is(err, domain.ErrInvalidCredentials) {
 		t.Fatalf("expected invalid credentials for bad email, got %v", err)
 	}
 
-	uc = common.NewTransactionalUseCase(&loginUnitOfWorkMock{}, New(&loginUsersRepoMock{}, &loginIdentityRepoMock{found: true, identity: domain.Identity{UserID: "user"}}, &loginRefreshRepoMock{}, &loginChallengeRepoMock{}, &loginHasherMock{compareErr: errors.New("fail")}, &loginIssuerMock{}, 0, 0, false, 0, 0, 0, nil))
+	uc = common.NewTransactionalUseCase(&loginUnitOfWorkMock{}, New(&loginUsersRepoMock{}, &loginIdentityRepoMock{found: true, identity: domain.Identity{UserID: "user"}}, &loginRefreshRepoMock{}, &loginChallengeRepoMock{}, &loginHasherMock{compareErr: errors.New("fail")}, nil, nil, nil, &loginIssuerMock{}, nil, 0, common.SessionPolicy{}, false, 0, 0, 0, nil, nil))
 	if _, err := uc.Execute(context.Background(), Input{Email: "user@example.com", Password: "pw"}); !errors.Is(err, domain.ErrInvalidCredentials) {
 		t.Fatalf("expected invalid credentials for compare failure, got %v", err)
 	}
 }
+
+type loginDeviceRepoMock struct {
+	device  domain.TrustedDevice
+	touched bool
+}
+
+func (m *loginDeviceRepoMock) Create(context.Context, domain.TrustedDevice) error { return nil }
+func (m *loginDeviceRepoMock) GetByHash(_ context.Context, userID domain.UserID, hash string) (domain.TrustedDevice, bool, error) {
+	if m.device.UserID != userID || m.device.TokenHash != hash {
+		return domain.TrustedDevice{}, false, nil
+	}
+	return m.device, true, nil
+}
+func (m *loginDeviceRepoMock) GetByID(context.Context, string) (domain.TrustedDevice, bool, error) {
+	return domain.TrustedDevice{}, false, nil
+}
+func (m *loginDeviceRepoMock) ListByUser(context.Context, domain.UserID) ([]domain.TrustedDevice, error) {
+	return nil, nil
+}
+func (m *loginDeviceRepoMock) Touch(context.Context, string, time.Time) error {
+	m.touched = true
+	return nil
+}
+func (m *loginDeviceRepoMock) Revoke(context.Context, string) error { return nil }
+
+type loginCodeHasherMock struct{}
+
+func (loginCodeHasherMock) Hash(raw string) string { return "hashed:" + raw }
+
+func TestLoginSkipsTOTPForTrustedDevice(t *testing.T) {
+	user := domain.User{ID: "user-1", DisplayName: "User"}
+	confirmed := time.Now().UTC()
+	identity := domain.Identity{UserID: user.ID, SecretHash: "hash", TOTPSecret: "secret", TOTPConfirmedAt: &confirmed}
+
+	token, err := domain.NewDeviceToken(user.ID, loginCodeHasherMock{})
+	if err != nil {
+		t.Fatalf("token error: %v", err)
+	}
+	devices := &loginDeviceRepoMock{device: domain.NewTrustedDevice(user.ID, loginCodeHasherMock{}.Hash(token), time.Now().UTC(), time.Hour)}
+	challenges := &loginChallengeRepoMock{}
+	newUC := func() *UseCase {
+		return New(&loginUsersRepoMock{user: user}, &loginIdentityRepoMock{identity: identity, found: true}, &loginRefreshRepoMock{}, challenges, &loginHasherMock{}, devices, loginCodeHasherMock{}, nil, &loginIssuerMock{token: "access"}, nil, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, false, 0, 0, 0, nil, nil)
+	}
+
+	out, err := newUC().Execute(context.Background(), Input{Email: "user@example.com", Password: "password123", DeviceToken: token})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.AccessToken != "access" || out.Challenge != nil || len(challenges.created) != 0 {
+		t.Fatalf("expected direct login on trusted device, got %+v", out)
+	}
+	if !devices.touched {
+		t.Fatalf("expected trusted device last use to be recorded")
+	}
+
+	out, err = newUC().Execute(context.Background(), Input{Email: "user@example.com", Password: "password123", DeviceToken: "forged.token"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Status != "challenge_required" || len(challenges.created) != 1 {
+		t.Fatalf("expected TOTP challenge for unknown device, got %+v", out)
+	}
+}
+
+type loginAttemptRepoMock struct{ recorded []domain.LoginAttempt }
+
+func (m *loginAttemptRepoMock) Record(_ context.Context, a domain.LoginAttempt) error {
+	m.recorded = append(m.recorded, a)
+	return nil
+}
+
+func (m *loginAttemptRepoMock) CountFailures(_ context.Context, userID domain.UserID, ip string, since time.Time) (int, error) {
+	n := 0
+	for _, a := range m.recorded {
+		switch {
+		case a.UserID != userID || a.CreatedAt.Before(since):
+		case a.Succeeded:
+			n = 0
+		case a.IP == ip:
+			n++
+		}
+	}
+	return n, nil
+}
+
+type loginRiskMock struct{ decision risk.Decision }
+
+func (m loginRiskMock) Assess(context.Context, risk.Input) (risk.Decision, error) {
+	return m.decision, nil
+}
+
+func TestLoginAddsRiskSteps(t *testing.T) {
+	user := domain.User{ID: "user-1", DisplayName: "User"}
+	identity := domain.Identity{UserID: user.ID, Provider: "email", ProviderUserID: "user@example.com", SecretHash: "hash"}
+	challenges := &loginChallengeRepoMock{}
+	attempts := &loginAttemptRepoMock{}
+	codesSent := 0
+	assessor := loginRiskMock{decision: risk.Decision{Score: 50, Steps: []domain.ChallengeStep{domain.ChallengeStepCaptcha, domain.ChallengeStepEmailOTP}}}
+	uc := New(&loginUsersRepoMock{user: user}, &loginIdentityRepoMock{identity: identity, found: true}, &loginRefreshRepoMock{}, challenges, &loginHasherMock{}, nil, nil, attempts, &loginIssuerMock{token: "access"}, assessor, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, false, 0, 0, 0, nil,
+		func(context.Context, domain.Identity) error {
+			codesSent++
+			return nil
+		})
+
+	out, err := uc.Execute(context.Background(), Input{Email: "user@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.AccessToken != "" || out.Challenge == nil || len(out.Challenge.RequiredSteps) != 2 {
+		t.Fatalf("expected risk challenge, got %+v", out)
+	}
+	if codesSent != 1 {
+		t.Fatalf("expected login code to be sent once, got %d", codesSent)
+	}
+	if len(attempts.recorded) != 0 {
+		t.Fatalf("expected no attempt recorded before the challenge is completed, got %+v", attempts.recorded)
+	}
+}
+
+func TestLoginFailsWhenLoginCodeCannotBeSent(t *testing.T) {
+	user := domain.User{ID: "user-1", DisplayName: "User"}
+	identity := domain.Identity{UserID: user.ID, SecretHash: "hash"}
+	challenges := &loginChallengeRepoMock{}
+	assessor := loginRiskMock{decision: risk.Decision{Score: 50, Steps: []domain.ChallengeStep{domain.ChallengeStepEmailOTP}}}
+	uc := New(&loginUsersRepoMock{user: user}, &loginIdentityRepoMock{identity: identity, found: true}, &loginRefreshRepoMock{}, challenges, &loginHasherMock{}, nil, nil, nil, &loginIssuerMock{token: "access"}, assessor, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, false, 0, 0, 0, nil,
+		func(context.Context, domain.Identity) error {
+			return errors.New("mail down")
+		})
+
+	if _, err := uc.Execute(context.Background(), Input{Email: "user@example.com", Password: "password123"}); err == nil {
+		t.Fatalf("expected the login to fail without a login code")
+	}
+}
+
+func TestLoginDeniedByRiskPolicy(t *testing.T) {
+	user := domain.User{ID: "user-1", DisplayName: "User"}
+	identity := domain.Identity{UserID: user.ID, SecretHash: "hash"}
+	attempts := &loginAttemptRepoMock{}
+	refresh := &loginRefreshRepoMock{}
+	uc := New(&loginUsersRepoMock{user: user}, &loginIdentityRepoMock{identity: identity, found: true}, refresh, &loginChallengeRepoMock{}, &loginHasherMock{}, nil, nil, attempts, &loginIssuerMock{token: "access"}, loginRiskMock{decision: risk.Decision{Score: 100, Deny: true}}, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, false, 0, 0, 0, nil, nil)
+
+	if _, err := uc.Execute(context.Background(), Input{Email: "user@example.com", Password: "password123"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("expected a denied login to look like a wrong password, got %v", err)
+	}
+	if len(refresh.created) != 0 {
+		t.Fatalf("expected no session for denied login")
+	}
+	if len(attempts.recorded) != 0 {
+		t.Fatalf("expected a denied attempt not to count as a failure, got %+v", attempts.recorded)
+	}
+}
+
+func TestLoginAllowsOwnerAfterSomeoneElsesFailures(t *testing.T) {
+	user := domain.User{ID: "user-1", DisplayName: "User"}
+	identity := domain.Identity{UserID: user.ID, SecretHash: "hash"}
+	attempts := &loginAttemptRepoMock{}
+	refresh := &loginRefreshRepoMock{sessions: []domain.RefreshToken{{IP: "198.51.100.7", UserAgent: "firefox", CreatedAt: time.Now().UTC().Add(-time.Hour)}}}
+	hasher := &loginHasherMock{compareErr: errors.New("mismatch")}
+	history := risk.NewHistoryEvaluator(refresh, attempts, nil, risk.HistoryConfig{NewIPWeight: 20, NewUserAgentWeight: 10, FailureWeight: 10, MaxFailures: 5})
+	engine := risk.NewEngine(history, risk.ThresholdPolicy{DenyScore: 50}, nil)
+	uc := New(&loginUsersRepoMock{user: user}, &loginIdentityRepoMock{identity: identity, found: true}, refresh, &loginChallengeRepoMock{}, hasher, nil, nil, attempts, &loginIssuerMock{token: "access"}, engine, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, false, 0, 0, 0, nil, nil)
+
+	// Someone else keeps guessing from a new network until they are denied,
+	// and goes on trying.
+	stranger := common.WithRequestMeta(context.Background(), common.RequestMeta{IP: "203.0.113.9", UserAgent: "curl"})
+	for i := 0; i < 10; i++ {
+		if _, err := uc.Execute(stranger, Input{Email: "user@example.com", Password: "guess"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("expected guesses to fail, got %v", err)
+		}
+	}
+	if len(attempts.recorded) != 2 {
+		t.Fatalf("expected only the guesses before the denial to count, got %d", len(attempts.recorded))
+	}
+
+	hasher.compareErr = nil
+	owner := common.WithRequestMeta(context.Background(), common.RequestMeta{IP: "198.51.100.7", UserAgent: "firefox"})
+	out, err := uc.Execute(owner, Input{Email: "user@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("expected the owner to sign in from a known device, got %v", err)
+	}
+	if out.AccessToken == "" {
+		t.Fatalf("expected a session for the owner, got %+v", out)
+	}
+}
+
+func TestLoginRecordsFailedPassword(t *testing.T) {
+	attempts := &loginAttemptRepoMock{}
+	uc := New(&loginUsersRepoMock{}, &loginIdentityRepoMock{found: true, identity: domain.Identity{UserID: "user"}}, &loginRefreshRepoMock{}, &loginChallengeRepoMock{}, &loginHasherMock{compareErr: errors.New("fail")}, nil, nil, attempts, &loginIssuerMock{}, nil, 0, common.SessionPolicy{}, false, 0, 0, 0, nil, nil)
+
+	if _, err := uc.Execute(context.Background(), Input{Email: "user@example.com", Password: "bad"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+	if len(attempts.recorded) != 1 || attempts.recorded[0].Succeeded {
+		t.Fatalf("expected failed attempt recorded, got %+v", attempts.recorded)
+	}
+}
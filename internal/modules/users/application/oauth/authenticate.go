@@ -0,0 +1,142 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+const (
+	// maxAssertionLifetime bounds how far ahead a client assertion may
+	// expire, and so how long its id is remembered.
+	maxAssertionLifetime = time.Hour
+	// assertionLeeway absorbs clock skew between clients and this server.
+	assertionLeeway = 30 * time.Second
+)
+
+// ClientAuthenticator tells which client a request of the token,
+// device authorization and introspection endpoints comes from. Clients
+// authenticate with their secret or with an assertion signed by their key
+// (private_key_jwt, RFC 7523), whose audience must be the issuer or its
+// token endpoint; without an issuer, assertions are refused. Public clients
+// only send their id.
+type ClientAuthenticator struct {
+	clients    domain.OAuthClientRepository
+	assertions domain.ClientAssertionRepository
+	issuer     string
+	now        func() time.Time
+}
+
+func NewClientAuthenticator(clients domain.OAuthClientRepository, assertions domain.ClientAssertionRepository, issuer string) *ClientAuthenticator {
+	return &ClientAuthenticator{
+		clients:    clients,
+		assertions: assertions,
+		issuer:     strings.TrimSuffix(strings.TrimSpace(issuer), "/"),
+		now:        time.Now,
+	}
+}
+
+// Authenticate returns the active client that creds prove to be. Every
+// failure is ErrInvalidClient, so that callers learn nothing about which
+// clients exist.
+func (a *ClientAuthenticator) Authenticate(ctx context.Context, creds ClientCredentials) (domain.OAuthClient, error) {
+	if creds.Assertion != "" || creds.AssertionType != "" {
+		if creds.AssertionType != AssertionTypeJWTBearer || creds.Assertion == "" || creds.ClientSecret != "" {
+			return domain.OAuthClient{}, domain.ErrInvalidOAuthRequest
+		}
+		return a.authenticateAssertion(ctx, creds)
+	}
+
+	if creds.ClientSecret == "" {
+		// Public clients cannot prove who they are; PKCE protects what they
+		// redeem.
+		return a.client(ctx, creds.ClientID, domain.ClientAuthNone)
+	}
+	client, err := a.client(ctx, creds.ClientID, domain.ClientAuthSecret)
+	if err != nil {
+		return domain.OAuthClient{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(common.HashToken(creds.ClientSecret)), []byte(client.SecretHash)) != 1 {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	return client, nil
+}
+
+func (a *ClientAuthenticator) authenticateAssertion(ctx context.Context, creds ClientCredentials) (domain.OAuthClient, error) {
+	if a.issuer == "" {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	// The issuer names the client, whose key then verifies the signature.
+	var unverified jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(creds.Assertion, &unverified); err != nil {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	if creds.ClientID != "" && creds.ClientID != unverified.Issuer {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	client, err := a.client(ctx, unverified.Issuer, domain.ClientAuthPrivateKeyJWT)
+	if err != nil {
+		return domain.OAuthClient{}, err
+	}
+	key, err := parsePublicKey(client.PublicKey)
+	if err != nil {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+
+	var claims jwt.RegisteredClaims
+	_, err = jwt.ParseWithClaims(creds.Assertion, &claims, func(*jwt.Token) (any, error) {
+		return key, nil
+	},
+		jwt.WithValidMethods(signingMethods(key)),
+		jwt.WithIssuer(client.ID),
+		jwt.WithSubject(client.ID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(assertionLeeway),
+		jwt.WithTimeFunc(a.now),
+	)
+	if err != nil {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	now := a.now().UTC()
+	if claims.ID == "" || claims.ExpiresAt.Time.After(now.Add(maxAssertionLifetime)) || !a.audienceMatches(claims.Audience) {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+
+	fresh, err := a.assertions.Use(ctx, client.ID, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return domain.OAuthClient{}, common.NormalizeError(err)
+	}
+	if !fresh {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	return client, nil
+}
+
+func (a *ClientAuthenticator) client(ctx context.Context, id, method string) (domain.OAuthClient, error) {
+	if id == "" {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	client, found, err := a.clients.GetByID(ctx, id)
+	if err != nil {
+		return domain.OAuthClient{}, common.NormalizeError(err)
+	}
+	if !found || !client.IsActive() || client.AuthMethod != method {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	return client, nil
+}
+
+func (a *ClientAuthenticator) audienceMatches(audience jwt.ClaimStrings) bool {
+	for _, aud := range audience {
+		if aud == a.issuer || aud == a.issuer+TokenPath {
+			return true
+		}
+	}
+	return false
+}
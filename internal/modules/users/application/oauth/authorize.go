@@ -0,0 +1,291 @@
+package oauth
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// Paths of the provider's endpoints under the issuer.
+const (
+	AuthorizePath = "/oauth/authorize"
+	UserInfoPath  = "/oauth/userinfo"
+	KeysPath      = "/oauth/jwks"
+)
+
+// authorizationCodeTTL is how long a client has to redeem a code.
+const authorizationCodeTTL = 5 * time.Minute
+
+// maxParamLength bounds state and nonce, which are echoed back.
+const maxParamLength = 512
+
+// Error codes sent back to the client's redirect URI (RFC 6749 section
+// 4.1.2.1, OpenID Connect Core section 3.1.2.6).
+const (
+	errorInvalidRequest          = "invalid_request"
+	errorInvalidScope            = "invalid_scope"
+	errorUnsupportedResponseType = "unsupported_response_type"
+	errorAccessDenied            = "access_denied"
+	errorLoginRequired           = "login_required"
+	errorConsentRequired         = "consent_required"
+)
+
+// Prompt values of authorization requests.
+const (
+	promptNone    = "none"
+	promptLogin   = "login"
+	promptConsent = "consent"
+)
+
+// codeChallengePattern matches an S256 code challenge: the unpadded
+// base64url encoding of a SHA-256 digest.
+var codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// Authorizer serves the authorization endpoint of the authorization code
+// flow. Users sign in on the login page, which goes through the usual
+// login and its challenges; the page then asks Authorize for the response
+// with the session it got, shows the consent screen when needed and sends
+// the browser where Authorize says. Every client must use PKCE with S256.
+type Authorizer struct {
+	clients  domain.OAuthClientRepository
+	codes    domain.AuthorizationCodeRepository
+	consents domain.OAuthConsentRepository
+	sessions domain.RefreshTokenRepository
+	issuer   string
+	loginURL string
+	now      func() time.Time
+}
+
+func NewAuthorizer(clients domain.OAuthClientRepository, codes domain.AuthorizationCodeRepository, consents domain.OAuthConsentRepository, sessions domain.RefreshTokenRepository, issuer, loginURL string) *Authorizer {
+	return &Authorizer{
+		clients:  clients,
+		codes:    codes,
+		consents: consents,
+		sessions: sessions,
+		issuer:   strings.TrimSuffix(strings.TrimSpace(issuer), "/"),
+		loginURL: strings.TrimSpace(loginURL),
+		now:      time.Now,
+	}
+}
+
+// Start answers an authorization request from the client by sending the
+// browser to the login page with the request's parameters, or back to
+// the client when the request is invalid. An unknown client or redirect
+// URI fails instead, as the browser must not be sent to an unverified
+// address.
+func (uc *Authorizer) Start(ctx context.Context, in StartAuthorizationInput) (RedirectOutput, error) {
+	if _, err := uc.client(ctx, in.Request); err != nil {
+		return RedirectOutput{}, err
+	}
+	if _, code := parseAuthorization(in.Request); code != "" {
+		return RedirectOutput{RedirectTo: uc.errorRedirect(in.Request, code)}, nil
+	}
+	return RedirectOutput{RedirectTo: withQuery(uc.loginURL, in.Request.values())}, nil
+}
+
+// Authorize answers an authorization request for the signed in user. It
+// issues a code once the user consented to the client and scopes, either
+// now or before, and the session is recent enough for max_age. prompt=login
+// is left to the login page, which sees the request first.
+func (uc *Authorizer) Authorize(ctx context.Context, in AuthorizeInput) (AuthorizeOutput, error) {
+	client, err := uc.client(ctx, in.Request)
+	if err != nil {
+		return AuthorizeOutput{}, err
+	}
+	auth, code := parseAuthorization(in.Request)
+	if code != "" {
+		return uc.redirectError(in.Request, code), nil
+	}
+
+	now := uc.now().UTC()
+	session, found, err := uc.sessions.GetByID(ctx, in.SessionID)
+	if err != nil {
+		return AuthorizeOutput{}, common.NormalizeError(err)
+	}
+	if !found || session.UserID.String() != in.UserID || !session.IsValid(now) {
+		return AuthorizeOutput{}, domain.ErrUnauthorized
+	}
+
+	if auth.maxAge >= 0 && now.Sub(session.AuthTime) > auth.maxAge {
+		if auth.prompt[promptNone] {
+			return uc.redirectError(in.Request, errorLoginRequired), nil
+		}
+		return AuthorizeOutput{Status: AuthorizationLoginRequired}, nil
+	}
+
+	consent, found, err := uc.consents.Get(ctx, session.UserID, client.ID)
+	if err != nil {
+		return AuthorizeOutput{}, common.NormalizeError(err)
+	}
+	switch in.Consent {
+	case ConsentDeny:
+		return uc.redirectError(in.Request, errorAccessDenied), nil
+	case ConsentApprove:
+		if !found {
+			consent = domain.OAuthConsent{UserID: session.UserID, ClientID: client.ID}
+		}
+		if err := uc.consents.Save(ctx, consent.Grant(auth.scopes, now)); err != nil {
+			return AuthorizeOutput{}, common.NormalizeError(err)
+		}
+	case "":
+		if !found || !consent.Covers(auth.scopes) || auth.prompt[promptConsent] {
+			if auth.prompt[promptNone] {
+				return uc.redirectError(in.Request, errorConsentRequired), nil
+			}
+			return AuthorizeOutput{
+				Status: AuthorizationConsentRequired,
+				Consent: &ConsentRequest{
+					ClientID:   client.ID,
+					ClientName: client.Name,
+					Scopes:     auth.scopes,
+				},
+			}, nil
+		}
+	default:
+		return AuthorizeOutput{}, domain.ErrInvalidOAuthRequest
+	}
+
+	raw, err := common.NewRefreshToken()
+	if err != nil {
+		return AuthorizeOutput{}, common.NormalizeError(err)
+	}
+	authCode := domain.NewAuthorizationCode(common.HashToken(raw), client.ID, session.UserID, in.Request.RedirectURI, auth.scopes, in.Request.Nonce, in.Request.CodeChallenge, now, authorizationCodeTTL)
+	authCode.AuthTime = session.AuthTime
+	authCode.AMR = session.AMR
+	authCode.LoginMethod = session.LoginMethod
+	if err := uc.codes.Create(ctx, authCode); err != nil {
+		return AuthorizeOutput{}, common.NormalizeError(err)
+	}
+
+	params := url.Values{"code": {raw}}
+	return AuthorizeOutput{Status: AuthorizationRedirect, RedirectTo: uc.clientRedirect(in.Request, params)}, nil
+}
+
+// client returns the active client of the request once the redirect URI
+// is one of its own.
+func (uc *Authorizer) client(ctx context.Context, req AuthorizationRequest) (domain.OAuthClient, error) {
+	id := strings.TrimSpace(req.ClientID)
+	if id == "" {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	client, found, err := uc.clients.GetByID(ctx, id)
+	if err != nil {
+		return domain.OAuthClient{}, common.NormalizeError(err)
+	}
+	if !found || !client.IsActive() {
+		return domain.OAuthClient{}, domain.ErrInvalidClient
+	}
+	if !client.AllowsRedirect(req.RedirectURI) {
+		return domain.OAuthClient{}, domain.ErrInvalidRedirectURI
+	}
+	return client, nil
+}
+
+func (uc *Authorizer) redirectError(req AuthorizationRequest, code string) AuthorizeOutput {
+	return AuthorizeOutput{Status: AuthorizationRedirect, RedirectTo: uc.errorRedirect(req, code)}
+}
+
+func (uc *Authorizer) errorRedirect(req AuthorizationRequest, code string) string {
+	return uc.clientRedirect(req, url.Values{"error": {code}})
+}
+
+// clientRedirect adds params, the state of the request and the issuer
+// (RFC 9207) to the redirect URI of the request.
+func (uc *Authorizer) clientRedirect(req AuthorizationRequest, params url.Values) string {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	if uc.issuer != "" {
+		params.Set("iss", uc.issuer)
+	}
+	return withQuery(req.RedirectURI, params)
+}
+
+// authorization is what parseAuthorization reads from a request. maxAge
+// is negative when not set.
+type authorization struct {
+	scopes []string
+	prompt map[string]bool
+	maxAge time.Duration
+}
+
+// parseAuthorization checks the parameters of a request other than the
+// client and redirect URI. It returns the error code to send back to the
+// client when they are invalid.
+func parseAuthorization(req AuthorizationRequest) (authorization, string) {
+	auth := authorization{prompt: map[string]bool{}, maxAge: -1}
+	if req.ResponseType != "code" {
+		return auth, errorUnsupportedResponseType
+	}
+	if req.CodeChallengeMethod != "S256" || !codeChallengePattern.MatchString(req.CodeChallenge) {
+		return auth, errorInvalidRequest
+	}
+	if len(req.State) > maxParamLength || len(req.Nonce) > maxParamLength {
+		return auth, errorInvalidRequest
+	}
+	for _, p := range strings.Fields(req.Prompt) {
+		switch p {
+		case promptNone, promptLogin, promptConsent:
+			auth.prompt[p] = true
+		default:
+			return auth, errorInvalidRequest
+		}
+	}
+	if auth.prompt[promptNone] && len(auth.prompt) > 1 {
+		return auth, errorInvalidRequest
+	}
+	if req.MaxAge != "" {
+		seconds, err := strconv.Atoi(req.MaxAge)
+		if err != nil || seconds < 0 {
+			return auth, errorInvalidRequest
+		}
+		auth.maxAge = time.Duration(seconds) * time.Second
+	}
+	scopes, err := domain.NormalizeOIDCScopes(strings.Fields(req.Scope))
+	if err != nil {
+		return auth, errorInvalidScope
+	}
+	auth.scopes = scopes
+	return auth, ""
+}
+
+// values encodes the request as query parameters.
+func (r AuthorizationRequest) values() url.Values {
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("response_type", r.ResponseType)
+	set("client_id", r.ClientID)
+	set("redirect_uri", r.RedirectURI)
+	set("scope", r.Scope)
+	set("state", r.State)
+	set("nonce", r.Nonce)
+	set("code_challenge", r.CodeChallenge)
+	set("code_challenge_method", r.CodeChallengeMethod)
+	set("prompt", r.Prompt)
+	set("max_age", r.MaxAge)
+	return v
+}
+
+// withQuery adds params to the query of target, keeping what it has.
+func withQuery(target string, params url.Values) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	q := u.Query()
+	for key, values := range params {
+		q[key] = values
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,255 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/refresh"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// Lengths a PKCE code verifier may have (RFC 7636 section 4.1).
+const (
+	minCodeVerifierLength = 43
+	maxCodeVerifierLength = 128
+)
+
+// idTokenTTL is how long an ID token is valid. Clients check it once,
+// right after the code exchange.
+const idTokenTTL = 5 * time.Minute
+
+// IDTokenClaims are the claims of an ID token. User holds the subject and
+// the claims released by the granted scopes; AccessToken is the access
+// token issued along, which the signer hashes into at_hash.
+type IDTokenClaims struct {
+	Issuer      string
+	Audience    string
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+	AuthTime    time.Time
+	Nonce       string
+	AMR         []string
+	SessionID   string
+	AccessToken string
+	User        UserInfoOutput
+}
+
+// IDTokenSigner signs ID tokens with the provider's key and publishes its
+// public half.
+type IDTokenSigner interface {
+	SignIDToken(claims IDTokenClaims) (string, error)
+	Algorithm() string
+	PublicKeys() []JSONWebKey
+}
+
+// CodeGrant redeems authorization codes for sessions and refreshes the
+// sessions it created. Each code opens a new session, named after the
+// client so that users can tell it apart, and records which client and
+// scopes it was issued for; its access tokens are limited to those scopes.
+// A code used a second time ends the session it was exchanged for (RFC 6749
+// section 4.1.2); as the request fails, that runs in a unit of work of its
+// own.
+type CodeGrant struct {
+	codes    domain.AuthorizationCodeRepository
+	grants   domain.OAuthGrantRepository
+	sessions domain.RefreshTokenRepository
+	claims   *UserInfo
+	access   common.AccessTokenIssuer
+	idTokens IDTokenSigner
+	refresh  func(context.Context, refresh.Input) (refresh.Output, error)
+	uow      common.UnitOfWork
+
+	accessTTL     time.Duration
+	sessionPolicy common.SessionPolicy
+	issuer        string
+	now           func() time.Time
+}
+
+func NewCodeGrant(
+	codes domain.AuthorizationCodeRepository,
+	grants domain.OAuthGrantRepository,
+	sessions domain.RefreshTokenRepository,
+	claims *UserInfo,
+	access common.AccessTokenIssuer,
+	idTokens IDTokenSigner,
+	refresh func(context.Context, refresh.Input) (refresh.Output, error),
+	uow common.UnitOfWork,
+	accessTTL time.Duration,
+	sessionPolicy common.SessionPolicy,
+	issuer string,
+) *CodeGrant {
+	if accessTTL == 0 {
+		accessTTL = 15 * time.Minute
+	}
+	return &CodeGrant{
+		codes:         codes,
+		grants:        grants,
+		sessions:      sessions,
+		claims:        claims,
+		access:        access,
+		idTokens:      idTokens,
+		refresh:       refresh,
+		uow:           uow,
+		accessTTL:     accessTTL,
+		sessionPolicy: sessionPolicy,
+		issuer:        strings.TrimSuffix(strings.TrimSpace(issuer), "/"),
+		now:           time.Now,
+	}
+}
+
+// Exchange redeems an authorization code for the client that it was
+// issued to, with the redirect URI and PKCE verifier of the request.
+func (g *CodeGrant) Exchange(ctx context.Context, client domain.OAuthClient, in TokenInput) (TokenOutput, error) {
+	if in.Code == "" || in.RedirectURI == "" || in.CodeVerifier == "" {
+		return TokenOutput{}, domain.ErrInvalidOAuthRequest
+	}
+	code, found, err := g.codes.GetByHash(ctx, common.HashToken(in.Code))
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	now := g.now().UTC()
+	if !found || code.ClientID != client.ID {
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+	if code.UsedAt != nil {
+		g.revokeReplayed(ctx, code.SessionID)
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+	if !code.IsUsable(now) || code.RedirectURI != in.RedirectURI || !verifyCodeChallenge(in.CodeVerifier, code.CodeChallenge) {
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+
+	user, err := g.claims.claims(ctx, code.UserID, code.Scopes)
+	if errors.Is(err, domain.ErrUnauthorized) {
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+	if err != nil {
+		return TokenOutput{}, err
+	}
+
+	refreshRaw, err := common.NewRefreshToken()
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	loginMethod := code.LoginMethod
+	if loginMethod == "" {
+		loginMethod = domain.LoginMethodOIDC
+	}
+	session := common.NewHandedOverRecord(ctx, code.UserID, common.HashToken(refreshRaw), now, g.sessionPolicy, loginMethod, code.AMR)
+	if session, err = session.WithDeviceName(client.Name); err != nil {
+		return TokenOutput{}, err
+	}
+
+	used, err := g.codes.MarkUsed(ctx, code.ID, session.ID, now)
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	if !used {
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+	if err := g.sessions.Create(ctx, session); err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	grant := domain.OAuthGrant{SessionID: session.ID, ClientID: client.ID, Scopes: code.Scopes, CreatedAt: now}
+	if err := g.grants.Create(ctx, grant); err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+
+	accessToken, err := g.access.Issue(common.GrantClaims(session, grant), g.accessTTL)
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	idToken, err := g.idTokens.SignIDToken(IDTokenClaims{
+		Issuer:      g.issuer,
+		Audience:    client.ID,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(idTokenTTL),
+		AuthTime:    code.AuthTime,
+		Nonce:       code.Nonce,
+		AMR:         session.AMR,
+		SessionID:   session.ID,
+		AccessToken: accessToken,
+		User:        user,
+	})
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+
+	return TokenOutput{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    g.accessTTL,
+		Scope:        strings.Join(code.Scopes, " "),
+		RefreshToken: refreshRaw,
+		IDToken:      idToken,
+	}, nil
+}
+
+// Refresh rotates the refresh token of a session issued to the client, as
+// the refresh endpoint does. A narrower scope may be asked for, but the
+// session keeps the scopes it was granted.
+func (g *CodeGrant) Refresh(ctx context.Context, client domain.OAuthClient, in TokenInput) (TokenOutput, error) {
+	if in.RefreshToken == "" {
+		return TokenOutput{}, domain.ErrInvalidOAuthRequest
+	}
+	session, found, err := g.sessions.GetByHash(ctx, common.HashToken(in.RefreshToken))
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	if !found {
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+	grant, found, err := g.grants.GetBySession(ctx, session.ID)
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	if !found || grant.ClientID != client.ID {
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+	for _, s := range strings.Fields(in.Scope) {
+		if !slices.Contains(grant.Scopes, s) {
+			return TokenOutput{}, domain.ErrInvalidScope
+		}
+	}
+
+	out, err := g.refresh(ctx, refresh.Input{RefreshToken: in.RefreshToken})
+	if errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+	if err != nil {
+		return TokenOutput{}, err
+	}
+	return TokenOutput{
+		AccessToken:  out.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    g.accessTTL,
+		Scope:        strings.Join(grant.Scopes, " "),
+		RefreshToken: out.RefreshToken,
+	}, nil
+}
+
+func (g *CodeGrant) revokeReplayed(ctx context.Context, sessionID string) {
+	if sessionID == "" {
+		return
+	}
+	_ = g.uow.Do(ctx, func(ctx context.Context) error {
+		return g.sessions.Revoke(ctx, sessionID)
+	})
+}
+
+// verifyCodeChallenge checks a PKCE verifier against its S256 challenge.
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < minCodeVerifierLength || len(verifier) > maxCodeVerifierLength {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
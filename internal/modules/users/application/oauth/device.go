@@ -0,0 +1,285 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// DeviceAuthorizationPath is where devices start the device authorization
+// grant under the issuer.
+const DeviceAuthorizationPath = "/oauth/device_authorization"
+
+const (
+	// deviceCodeTTL is how long the user has to enter the user code.
+	deviceCodeTTL = 10 * time.Minute
+	// devicePollInterval is how long devices wait between polls, until
+	// they are told to slow down.
+	devicePollInterval = 5 * time.Second
+)
+
+// User codes are typed by hand from a TV screen or terminal, so they are
+// short, case insensitive and drawn from consonants that are hard to mix up
+// and spell no words (RFC 8628 section 6.1). Eight of them give about 34
+// bits, against guesses that must come from signed in, rate limited users.
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// DeviceGrant serves the device authorization grant (RFC 8628) to devices
+// that cannot show the login page, such as TVs and CLIs. The device gets a
+// device code and a user code; the user enters the user code on a page of
+// a signed in browser, which looks the device up and approves or denies it
+// through Verify; meanwhile the device polls the token endpoint. Once
+// approved, the device gets a session of its own, named after the client
+// and refreshed like any other. Polls that fail still record when they
+// happened, so they run in a unit of work of their own.
+type DeviceGrant struct {
+	clients  *ClientAuthenticator
+	devices  domain.DeviceAuthorizationRepository
+	grants   domain.OAuthGrantRepository
+	sessions domain.RefreshTokenRepository
+	access   common.AccessTokenIssuer
+	uow      common.UnitOfWork
+
+	accessTTL       time.Duration
+	sessionPolicy   common.SessionPolicy
+	verificationURI string
+	now             func() time.Time
+}
+
+func NewDeviceGrant(
+	clients *ClientAuthenticator,
+	devices domain.DeviceAuthorizationRepository,
+	grants domain.OAuthGrantRepository,
+	sessions domain.RefreshTokenRepository,
+	access common.AccessTokenIssuer,
+	uow common.UnitOfWork,
+	accessTTL time.Duration,
+	sessionPolicy common.SessionPolicy,
+	verificationURI string,
+) *DeviceGrant {
+	if accessTTL == 0 {
+		accessTTL = 15 * time.Minute
+	}
+	return &DeviceGrant{
+		clients:         clients,
+		devices:         devices,
+		grants:          grants,
+		sessions:        sessions,
+		access:          access,
+		uow:             uow,
+		accessTTL:       accessTTL,
+		sessionPolicy:   sessionPolicy,
+		verificationURI: strings.TrimSpace(verificationURI),
+		now:             time.Now,
+	}
+}
+
+// Authorize starts a device authorization for the client. The device of
+// the request is recorded to be shown to the user.
+func (g *DeviceGrant) Authorize(ctx context.Context, in DeviceAuthorizationInput) (DeviceAuthorizationOutput, error) {
+	client, err := g.clients.Authenticate(ctx, in.Credentials)
+	if err != nil {
+		return DeviceAuthorizationOutput{}, err
+	}
+
+	deviceCode, err := common.NewRefreshToken()
+	if err != nil {
+		return DeviceAuthorizationOutput{}, common.NormalizeError(err)
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		return DeviceAuthorizationOutput{}, common.NormalizeError(err)
+	}
+
+	now := g.now().UTC()
+	d := domain.NewDeviceAuthorization(common.HashToken(deviceCode), common.HashToken(normalizeUserCode(userCode)), client.ID, now, deviceCodeTTL, devicePollInterval)
+	meta, _ := common.RequestMetaFromContext(ctx)
+	d.IP = meta.IP
+	d.UserAgent = meta.UserAgent
+	d.Country = meta.Country
+	d.City = meta.City
+	if err := g.devices.Create(ctx, d); err != nil {
+		return DeviceAuthorizationOutput{}, common.NormalizeError(err)
+	}
+
+	return DeviceAuthorizationOutput{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         g.verificationURI,
+		VerificationURIComplete: withQuery(g.verificationURI, url.Values{"user_code": {userCode}}),
+		ExpiresIn:               deviceCodeTTL,
+		Interval:                devicePollInterval,
+	}, nil
+}
+
+// Verify looks up the device of a user code for the signed in user, and
+// approves or denies it once the user answered. An approved device is
+// signed in with the authentication methods of the approving session.
+func (g *DeviceGrant) Verify(ctx context.Context, in VerifyDeviceInput) (VerifyDeviceOutput, error) {
+	now := g.now().UTC()
+	session, found, err := g.sessions.GetByID(ctx, in.SessionID)
+	if err != nil {
+		return VerifyDeviceOutput{}, common.NormalizeError(err)
+	}
+	if !found || session.UserID.String() != in.UserID || !session.IsValid(now) {
+		return VerifyDeviceOutput{}, domain.ErrUnauthorized
+	}
+
+	code := normalizeUserCode(in.UserCode)
+	if len(code) != userCodeLength {
+		return VerifyDeviceOutput{}, domain.ErrInvalidUserCode
+	}
+	d, found, err := g.devices.GetByUserCode(ctx, common.HashToken(code))
+	if err != nil {
+		return VerifyDeviceOutput{}, common.NormalizeError(err)
+	}
+	if !found || !d.IsPending(now) {
+		return VerifyDeviceOutput{}, domain.ErrInvalidUserCode
+	}
+	client, found, err := g.clients.clients.GetByID(ctx, d.ClientID)
+	if err != nil {
+		return VerifyDeviceOutput{}, common.NormalizeError(err)
+	}
+	if !found || !client.IsActive() {
+		return VerifyDeviceOutput{}, domain.ErrInvalidUserCode
+	}
+
+	switch in.Consent {
+	case "":
+	case ConsentApprove:
+		d = d.Approve(session.UserID, session.AMR, now)
+	case ConsentDeny:
+		d = d.Deny(session.UserID, now)
+	default:
+		return VerifyDeviceOutput{}, domain.ErrInvalidOAuthRequest
+	}
+	if in.Consent != "" {
+		decided, err := g.devices.Decide(ctx, d)
+		if err != nil {
+			return VerifyDeviceOutput{}, common.NormalizeError(err)
+		}
+		if !decided {
+			return VerifyDeviceOutput{}, domain.ErrInvalidUserCode
+		}
+	}
+
+	return VerifyDeviceOutput{
+		Status:      d.Status,
+		ClientID:    client.ID,
+		ClientName:  client.Name,
+		IP:          d.IP,
+		UserAgent:   d.UserAgent,
+		Country:     d.Country,
+		City:        d.City,
+		RequestedAt: d.CreatedAt,
+	}, nil
+}
+
+// Exchange answers a poll of the client's device: with its session once
+// the user approved it, otherwise with why it has none yet.
+func (g *DeviceGrant) Exchange(ctx context.Context, client domain.OAuthClient, in TokenInput) (TokenOutput, error) {
+	if in.DeviceCode == "" {
+		return TokenOutput{}, domain.ErrInvalidOAuthRequest
+	}
+	d, found, err := g.devices.GetByDeviceCode(ctx, common.HashToken(in.DeviceCode))
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	if !found || d.ClientID != client.ID || d.UsedAt != nil {
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+	now := g.now().UTC()
+	if d.IsExpired(now) {
+		return TokenOutput{}, domain.ErrExpiredToken
+	}
+
+	d, tooFast := d.Poll(now)
+	if err := g.uow.Do(ctx, func(ctx context.Context) error {
+		return g.devices.Poll(ctx, d.ID, now, d.Interval)
+	}); err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	if tooFast {
+		return TokenOutput{}, domain.ErrSlowDown
+	}
+	switch d.Status {
+	case domain.DeviceAuthorizationPending:
+		return TokenOutput{}, domain.ErrAuthorizationPending
+	case domain.DeviceAuthorizationDenied:
+		return TokenOutput{}, domain.ErrAccessDenied
+	}
+
+	refreshRaw, err := common.NewRefreshToken()
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	session := common.NewHandedOverRecord(ctx, d.UserID, common.HashToken(refreshRaw), now, g.sessionPolicy, domain.LoginMethodDevice, d.AMR)
+	if session, err = session.WithDeviceName(client.Name); err != nil {
+		return TokenOutput{}, err
+	}
+
+	used, err := g.devices.MarkUsed(ctx, d.ID, session.ID, now)
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	if !used {
+		return TokenOutput{}, domain.ErrInvalidGrant
+	}
+	if err := g.sessions.Create(ctx, session); err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	if err := g.grants.Create(ctx, domain.OAuthGrant{SessionID: session.ID, ClientID: client.ID, CreatedAt: now}); err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+
+	accessToken, err := g.access.Issue(common.SessionClaims(session), g.accessTTL)
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	return TokenOutput{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    g.accessTTL,
+		RefreshToken: refreshRaw,
+	}, nil
+}
+
+// newUserCode returns a user code grouped in halves, as in BCDF-GHJK.
+func newUserCode() (string, error) {
+	var b strings.Builder
+	limit := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeUserCode drops the separators and case users may type a code
+// with.
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,81 @@
+package oauth
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// DiscoveryPath is where the discovery document is served under the
+// issuer.
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+// Discovery publishes the provider's metadata and signing keys, whose
+// endpoints are found under the issuer. idTokens is nil when only access
+// tokens are signed with a published key.
+type Discovery struct {
+	issuer    string
+	idTokens  IDTokenSigner
+	devices   bool
+	tokenKeys []JSONWebKey
+}
+
+func NewDiscovery(issuer string, idTokens IDTokenSigner) *Discovery {
+	return &Discovery{issuer: strings.TrimSuffix(strings.TrimSpace(issuer), "/"), idTokens: idTokens}
+}
+
+// AdvertiseDeviceGrant adds the device authorization grant to the
+// metadata.
+func (uc *Discovery) AdvertiseDeviceGrant() {
+	uc.devices = true
+}
+
+// PublishAccessTokenKeys adds the keys that sign access tokens to the key
+// set, for services that verify access tokens themselves.
+func (uc *Discovery) PublishAccessTokenKeys(keys ...JSONWebKey) {
+	uc.tokenKeys = append(uc.tokenKeys, keys...)
+}
+
+func (uc *Discovery) Metadata(context.Context, DiscoveryInput) (ProviderMetadata, error) {
+	out := ProviderMetadata{
+		Issuer:                            uc.issuer,
+		AuthorizationEndpoint:             uc.issuer + AuthorizePath,
+		TokenEndpoint:                     uc.issuer + TokenPath,
+		UserinfoEndpoint:                  uc.issuer + UserInfoPath,
+		JWKSURI:                           uc.issuer + KeysPath,
+		IntrospectionEndpoint:             uc.issuer + IntrospectPath,
+		RevocationEndpoint:                uc.issuer + RevokePath,
+		ScopesSupported:                   domain.KnownOIDCScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{uc.idTokens.Algorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", domain.ClientAuthPrivateKeyJWT, domain.ClientAuthNone},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "amr", "sid",
+			"name", "given_name", "family_name", "middle_name", "picture", "email", "email_verified",
+		},
+	}
+	if uc.devices {
+		out.DeviceAuthorizationEndpoint = uc.issuer + DeviceAuthorizationPath
+		out.GrantTypesSupported = append(out.GrantTypesSupported, GrantTypeDeviceCode)
+	}
+	return out, nil
+}
+
+func (uc *Discovery) Keys(context.Context, KeysInput) (KeySet, error) {
+	var keys []JSONWebKey
+	if uc.idTokens != nil {
+		keys = append(keys, uc.idTokens.PublicKeys()...)
+	}
+	for _, key := range uc.tokenKeys {
+		// The same key may sign both kinds of token.
+		if !slices.ContainsFunc(keys, func(k JSONWebKey) bool { return k.KeyID == key.KeyID }) {
+			keys = append(keys, key)
+		}
+	}
+	return KeySet{Keys: keys}, nil
+}
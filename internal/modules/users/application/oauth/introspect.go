@@ -0,0 +1,181 @@
+package oauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// Paths of the introspection and revocation endpoints under the issuer.
+const (
+	IntrospectPath = "/oauth/introspect"
+	RevokePath     = "/oauth/revoke"
+)
+
+// Introspection serves token introspection (RFC 7662) and revocation (RFC
+// 7009) to confidential clients, such as resource servers and gateways.
+// Public clients are refused, as anyone can use their id. Access tokens
+// are checked as authenticated routes check them; refresh tokens are
+// looked up with their session. Only refresh tokens can be revoked, which
+// ends their session and with it its access tokens.
+type Introspection struct {
+	clients  *ClientAuthenticator
+	access   common.AccessTokenInspector
+	sessions domain.RefreshTokenRepository
+	grants   domain.OAuthGrantRepository
+	// epochs may be nil, in which case refresh tokens are not checked
+	// against token epochs.
+	epochs domain.TokenEpochRepository
+	events common.EventPublisher
+	issuer string
+	now    func() time.Time
+}
+
+func NewIntrospection(
+	clients *ClientAuthenticator,
+	access common.AccessTokenInspector,
+	sessions domain.RefreshTokenRepository,
+	grants domain.OAuthGrantRepository,
+	epochs domain.TokenEpochRepository,
+	events common.EventPublisher,
+) *Introspection {
+	return &Introspection{
+		clients:  clients,
+		access:   access,
+		sessions: sessions,
+		grants:   grants,
+		epochs:   epochs,
+		events:   events,
+		issuer:   clients.issuer,
+		now:      time.Now,
+	}
+}
+
+// Introspect describes token. Tokens that are unknown, expired, revoked or
+// otherwise refused are reported as inactive rather than as an error.
+func (uc *Introspection) Introspect(ctx context.Context, in IntrospectInput) (IntrospectOutput, error) {
+	if err := uc.authenticate(ctx, in.Credentials); err != nil {
+		return IntrospectOutput{}, err
+	}
+	if in.Token == "" {
+		return IntrospectOutput{}, domain.ErrInvalidOAuthRequest
+	}
+
+	lookups := []func(context.Context, string) (IntrospectOutput, error){uc.accessToken, uc.refreshToken}
+	if in.TokenTypeHint == TokenTypeRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+	for _, lookup := range lookups {
+		out, err := lookup(ctx, in.Token)
+		if err != nil || out.Active {
+			return out, err
+		}
+	}
+	return IntrospectOutput{}, nil
+}
+
+// Revoke ends the session of a refresh token. Unknown and already revoked
+// tokens succeed, as the client's goal is met (RFC 7009 section 2.2);
+// access tokens fail with ErrUnsupportedTokenType.
+func (uc *Introspection) Revoke(ctx context.Context, in RevokeInput) (struct{}, error) {
+	if err := uc.authenticate(ctx, in.Credentials); err != nil {
+		return struct{}{}, err
+	}
+	if in.Token == "" {
+		return struct{}{}, domain.ErrInvalidOAuthRequest
+	}
+
+	session, found, err := uc.sessions.GetByHash(ctx, common.HashToken(in.Token))
+	if err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	if !found {
+		if _, err := uc.access.Inspect(ctx, in.Token); err == nil {
+			return struct{}{}, domain.ErrUnsupportedTokenType
+		}
+		return struct{}{}, nil
+	}
+	if session.RevokedAt != nil {
+		return struct{}{}, nil
+	}
+	if err := uc.sessions.Revoke(ctx, session.ID); err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	return struct{}{}, common.PublishSessionsRevoked(ctx, uc.events, session.UserID, []string{session.ID}, events.SessionRevokedByClient, uc.now().UTC())
+}
+
+func (uc *Introspection) authenticate(ctx context.Context, creds ClientCredentials) error {
+	client, err := uc.clients.Authenticate(ctx, creds)
+	if err != nil {
+		return err
+	}
+	if client.AuthMethod == domain.ClientAuthNone {
+		return domain.ErrInvalidClient
+	}
+	return nil
+}
+
+func (uc *Introspection) accessToken(ctx context.Context, token string) (IntrospectOutput, error) {
+	info, err := uc.access.Inspect(ctx, token)
+	if err != nil {
+		return IntrospectOutput{}, nil
+	}
+	out := IntrospectOutput{
+		Active:    true,
+		TokenType: TokenTypeAccessToken,
+		Subject:   info.UserID,
+		SessionID: info.SessionID,
+		ClientID:  info.ClientID,
+		Scopes:    info.Scopes,
+		IssuedAt:  info.IssuedAt,
+		ExpiresAt: info.ExpiresAt,
+		Issuer:    uc.issuer,
+	}
+	if info.SessionID != "" {
+		return uc.withGrant(ctx, out)
+	}
+	return out, nil
+}
+
+func (uc *Introspection) refreshToken(ctx context.Context, token string) (IntrospectOutput, error) {
+	session, found, err := uc.sessions.GetByHash(ctx, common.HashToken(token))
+	if err != nil {
+		return IntrospectOutput{}, common.NormalizeError(err)
+	}
+	if !found || !session.IsValid(uc.now().UTC()) {
+		return IntrospectOutput{}, nil
+	}
+	if uc.epochs != nil {
+		notBefore, err := uc.epochs.NotBefore(ctx, session.UserID)
+		if err != nil {
+			return IntrospectOutput{}, common.NormalizeError(err)
+		}
+		if session.CreatedAt.Before(notBefore) {
+			return IntrospectOutput{}, nil
+		}
+	}
+	return uc.withGrant(ctx, IntrospectOutput{
+		Active:    true,
+		TokenType: TokenTypeRefreshToken,
+		Subject:   session.UserID.String(),
+		SessionID: session.ID,
+		ExpiresAt: session.ExpiresAt,
+		Issuer:    uc.issuer,
+	})
+}
+
+// withGrant adds the client and scopes of sessions issued to a client.
+func (uc *Introspection) withGrant(ctx context.Context, out IntrospectOutput) (IntrospectOutput, error) {
+	grant, found, err := uc.grants.GetBySession(ctx, out.SessionID)
+	if err != nil {
+		return IntrospectOutput{}, common.NormalizeError(err)
+	}
+	if found {
+		out.ClientID = grant.ClientID
+		out.Scopes = grant.Scopes
+	}
+	return out, nil
+}
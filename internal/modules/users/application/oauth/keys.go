@@ -0,0 +1,57 @@
+package oauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for client assertions.
+const minRSAKeyBits = 2048
+
+// parsePublicKey reads a PEM encoded PKIX public key: RSA of at least
+// minRSAKeyBits, ECDSA on P-256 or Ed25519.
+func parsePublicKey(raw string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(raw))
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, errors.New("rsa key too short")
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("unsupported curve")
+		}
+	case ed25519.PublicKey:
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+	return key, nil
+}
+
+// signingMethods lists the algorithms assertions may be signed with by key.
+func signingMethods(key crypto.PublicKey) []string {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodPS256.Alg()}
+	case *ecdsa.PublicKey:
+		return []string{jwt.SigningMethodES256.Alg()}
+	case ed25519.PublicKey:
+		return []string{jwt.SigningMethodEdDSA.Alg()}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package oauth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// TokenPath is where the token endpoint is mounted under the issuer.
+const TokenPath = "/oauth/token"
+
+// TokenUseCase serves the token endpoint: the client credentials grant
+// (RFC 6749 section 4.4) and, when given the grants that serve them,
+// authorization codes, refresh tokens and device codes. Clients prove who
+// they are through a ClientAuthenticator.
+type TokenUseCase struct {
+	clients   *ClientAuthenticator
+	access    common.AccessTokenIssuer
+	codes     *CodeGrant
+	devices   *DeviceGrant
+	accessTTL time.Duration
+}
+
+// NewTokenUseCase serves the authorization code and refresh token grants
+// through codes and the device code grant through devices, unless they are
+// nil.
+func NewTokenUseCase(clients *ClientAuthenticator, access common.AccessTokenIssuer, accessTTL time.Duration, codes *CodeGrant, devices *DeviceGrant) *TokenUseCase {
+	if accessTTL == 0 {
+		accessTTL = 15 * time.Minute
+	}
+	return &TokenUseCase{
+		clients:   clients,
+		access:    access,
+		codes:     codes,
+		devices:   devices,
+		accessTTL: accessTTL,
+	}
+}
+
+func (uc *TokenUseCase) Token(ctx context.Context, in TokenInput) (TokenOutput, error) {
+	switch in.GrantType {
+	case GrantTypeClientCredentials:
+	case GrantTypeAuthorizationCode, GrantTypeRefreshToken:
+		if uc.codes == nil {
+			return TokenOutput{}, domain.ErrUnsupportedGrantType
+		}
+	case GrantTypeDeviceCode:
+		if uc.devices == nil {
+			return TokenOutput{}, domain.ErrUnsupportedGrantType
+		}
+	case "":
+		return TokenOutput{}, domain.ErrInvalidOAuthRequest
+	default:
+		return TokenOutput{}, domain.ErrUnsupportedGrantType
+	}
+
+	client, err := uc.clients.Authenticate(ctx, in.Credentials)
+	if err != nil {
+		return TokenOutput{}, err
+	}
+	switch in.GrantType {
+	case GrantTypeAuthorizationCode:
+		return uc.codes.Exchange(ctx, client, in)
+	case GrantTypeRefreshToken:
+		return uc.codes.Refresh(ctx, client, in)
+	case GrantTypeDeviceCode:
+		return uc.devices.Exchange(ctx, client, in)
+	}
+
+	scopes, err := client.GrantScopes(strings.Fields(in.Scope))
+	if err != nil {
+		return TokenOutput{}, err
+	}
+
+	token, err := uc.access.Issue(common.AccessClaims{ClientID: client.ID, Scopes: scopes}, uc.accessTTL)
+	if err != nil {
+		return TokenOutput{}, common.NormalizeError(err)
+	}
+	return TokenOutput{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   uc.accessTTL,
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
@@ -0,0 +1,304 @@
+package oauth
+
+import "time"
+
+// Grants the token endpoint serves. Authorization codes and refresh tokens
+// are only served when the OpenID Connect provider is enabled, device codes
+// when the device authorization grant is.
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// AssertionTypeJWTBearer is the client_assertion_type of private_key_jwt
+// (RFC 7523).
+const AssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// RegisterClientInput registers a client. AuthMethod defaults to
+// domain.ClientAuthSecret; domain.ClientAuthPrivateKeyJWT needs the PEM
+// encoded PublicKey. Clients that sign users in list their RedirectURIs.
+// Actor goes to the audit log.
+type RegisterClientInput struct {
+	Name         string
+	AuthMethod   string
+	PublicKey    string
+	Scopes       []string
+	RedirectURIs []string
+	Actor        string
+}
+
+// RegisterClientOutput carries the client secret, which is not stored and
+// cannot be shown again; it is empty for private_key_jwt and public clients.
+type RegisterClientOutput struct {
+	Client Client
+	Secret string
+}
+
+type ListClientsInput struct{}
+
+type DisableClientInput struct {
+	ClientID string
+	Actor    string
+}
+
+// Client describes a registered client without its credentials.
+type Client struct {
+	ID           string
+	Name         string
+	AuthMethod   string
+	Scopes       []string
+	RedirectURIs []string
+	CreatedAt    time.Time
+	DisabledAt   *time.Time
+}
+
+type ClientsOutput struct {
+	Clients []Client
+}
+
+// ClientCredentials are what a client presents to authenticate: its id and
+// secret, or a signed assertion (private_key_jwt), whose issuer is the
+// client id. Public clients send their id alone.
+type ClientCredentials struct {
+	ClientID      string
+	ClientSecret  string
+	AssertionType string
+	Assertion     string
+}
+
+// TokenInput is a token request. Scope is space separated and defaults to
+// every scope of the client. Code, RedirectURI and CodeVerifier redeem an
+// authorization code; RefreshToken continues a session issued to the
+// client; DeviceCode polls for the session of a device authorization.
+type TokenInput struct {
+	GrantType    string
+	Scope        string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	DeviceCode   string
+	Credentials  ClientCredentials
+}
+
+// TokenOutput is a token response. Grants that sign a user in add a
+// refresh token, and the ID token when redeeming an authorization code.
+type TokenOutput struct {
+	AccessToken  string
+	TokenType    string
+	ExpiresIn    time.Duration
+	Scope        string
+	RefreshToken string
+	IDToken      string
+}
+
+// AuthorizationRequest carries the parameters of an authorization request
+// (OpenID Connect Core section 3.1.2.1) as the client sent them.
+// CodeChallengeMethod must be S256: every client uses PKCE. MaxAge is in
+// seconds and empty when not set.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+	MaxAge              string
+}
+
+// StartAuthorizationInput is an authorization request arriving from the
+// client through the user's browser.
+type StartAuthorizationInput struct {
+	Request AuthorizationRequest
+}
+
+// RedirectOutput is where to send the user's browser next.
+type RedirectOutput struct {
+	RedirectTo string
+}
+
+// Consent decisions of the user on the consent screen.
+const (
+	ConsentApprove = "approve"
+	ConsentDeny    = "deny"
+)
+
+// AuthorizeInput asks, on behalf of the signed in user, for the response
+// to an authorization request. Consent is empty until the user answered
+// the consent screen, then ConsentApprove or ConsentDeny.
+type AuthorizeInput struct {
+	Request   AuthorizationRequest
+	UserID    string
+	SessionID string
+	Consent   string
+}
+
+// Statuses of an authorization.
+const (
+	// AuthorizationRedirect sends the browser back to the client, with a
+	// code or an error.
+	AuthorizationRedirect = "redirect"
+	// AuthorizationConsentRequired asks the user to approve the client and
+	// scopes in Consent.
+	AuthorizationConsentRequired = "consent_required"
+	// AuthorizationLoginRequired means the session authenticated longer ago
+	// than the client's max_age allows; a step-up refreshes it.
+	AuthorizationLoginRequired = "login_required"
+)
+
+type AuthorizeOutput struct {
+	Status     string
+	RedirectTo string
+	Consent    *ConsentRequest
+}
+
+// ConsentRequest is what the consent screen shows.
+type ConsentRequest struct {
+	ClientID   string
+	ClientName string
+	Scopes     []string
+}
+
+// UserInfoInput identifies the session whose access token asks for the
+// claims of its user.
+type UserInfoInput struct {
+	UserID    string
+	SessionID string
+}
+
+// UserInfoOutput holds the claims of a user (OpenID Connect Core section
+// 5.1) released by the scopes of the session; empty claims are omitted by
+// transports.
+type UserInfoOutput struct {
+	Subject       string
+	Name          string
+	GivenName     string
+	FamilyName    string
+	MiddleName    string
+	Picture       string
+	Email         string
+	EmailVerified *bool
+}
+
+type DiscoveryInput struct{}
+
+// ProviderMetadata is the discovery document of the provider (OpenID
+// Connect Discovery section 3).
+type ProviderMetadata struct {
+	Issuer                            string
+	AuthorizationEndpoint             string
+	TokenEndpoint                     string
+	UserinfoEndpoint                  string
+	JWKSURI                           string
+	IntrospectionEndpoint             string
+	RevocationEndpoint                string
+	DeviceAuthorizationEndpoint       string
+	ScopesSupported                   []string
+	ResponseTypesSupported            []string
+	GrantTypesSupported               []string
+	SubjectTypesSupported             []string
+	IDTokenSigningAlgValuesSupported  []string
+	TokenEndpointAuthMethodsSupported []string
+	CodeChallengeMethodsSupported     []string
+	ClaimsSupported                   []string
+}
+
+type KeysInput struct{}
+
+// JSONWebKey is a public key of the provider (RFC 7517).
+type JSONWebKey struct {
+	KeyType   string
+	Use       string
+	KeyID     string
+	Algorithm string
+	N         string
+	E         string
+}
+
+type KeySet struct {
+	Keys []JSONWebKey
+}
+
+// Token type hints of introspection and revocation requests (RFC 7009
+// section 2.1).
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+// IntrospectInput asks about Token on behalf of the authenticated client.
+// TokenTypeHint says which kind of token to look for first.
+type IntrospectInput struct {
+	Token         string
+	TokenTypeHint string
+	Credentials   ClientCredentials
+}
+
+// IntrospectOutput describes an active token; inactive tokens only report
+// Active false. ClientID and Scopes are those of the client the token or
+// its session was issued to, if any.
+type IntrospectOutput struct {
+	Active    bool
+	TokenType string
+	Subject   string
+	SessionID string
+	ClientID  string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Issuer    string
+}
+
+// RevokeInput revokes Token on behalf of the authenticated client.
+type RevokeInput struct {
+	Token         string
+	TokenTypeHint string
+	Credentials   ClientCredentials
+}
+
+// DeviceAuthorizationInput starts a device authorization for the
+// authenticated client.
+type DeviceAuthorizationInput struct {
+	Credentials ClientCredentials
+}
+
+// DeviceAuthorizationOutput tells the device what to show the user and how
+// often to poll the token endpoint with DeviceCode (RFC 8628 section 3.2).
+// VerificationURIComplete carries the user code, for QR codes.
+type DeviceAuthorizationOutput struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// VerifyDeviceInput answers, on behalf of the signed in user, the device
+// authorization of UserCode. Consent is empty to only look the device up,
+// then ConsentApprove or ConsentDeny.
+type VerifyDeviceInput struct {
+	UserCode  string
+	UserID    string
+	SessionID string
+	Consent   string
+}
+
+// VerifyDeviceOutput describes the device waiting for the user. Status is
+// domain.DeviceAuthorizationPending until the user answers, then
+// domain.DeviceAuthorizationApproved or domain.DeviceAuthorizationDenied.
+type VerifyDeviceOutput struct {
+	Status      string
+	ClientID    string
+	ClientName  string
+	IP          string
+	UserAgent   string
+	Country     string
+	City        string
+	RequestedAt time.Time
+}
@@ -0,0 +1,715 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/refresh"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+const testIssuer = "https://api.example.com/api/v1"
+
+type clientRepoStub struct {
+	clients map[string]domain.OAuthClient
+}
+
+func (s *clientRepoStub) Create(_ context.Context, c domain.OAuthClient) error {
+	s.clients[c.ID] = c
+	return nil
+}
+
+func (s *clientRepoStub) GetByID(_ context.Context, id string) (domain.OAuthClient, bool, error) {
+	c, ok := s.clients[id]
+	return c, ok, nil
+}
+
+func (s *clientRepoStub) List(context.Context) ([]domain.OAuthClient, error) {
+	out := make([]domain.OAuthClient, 0, len(s.clients))
+	for _, c := range s.clients {
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (s *clientRepoStub) Disable(_ context.Context, id string, at time.Time) error {
+	c := s.clients[id]
+	c.DisabledAt = &at
+	s.clients[id] = c
+	return nil
+}
+
+type assertionRepoStub struct {
+	used map[string]bool
+}
+
+func (s *assertionRepoStub) Use(_ context.Context, clientID, jti string, _ time.Time) (bool, error) {
+	key := clientID + "/" + jti
+	if s.used[key] {
+		return false, nil
+	}
+	s.used[key] = true
+	return true, nil
+}
+
+type auditStub struct {
+	records []domain.AuditRecord
+}
+
+func (s *auditStub) Record(_ context.Context, r domain.AuditRecord) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+type issuerStub struct {
+	claims common.AccessClaims
+}
+
+func (s *issuerStub) Issue(claims common.AccessClaims, _ time.Duration) (string, error) {
+	s.claims = claims
+	return "access", nil
+}
+
+func newTestUseCases() (*Clients, *TokenUseCase, *clientRepoStub, *issuerStub, *auditStub) {
+	repo := &clientRepoStub{clients: map[string]domain.OAuthClient{}}
+	audit := &auditStub{}
+	issuer := &issuerStub{}
+	return NewClients(repo, audit), NewTokenUseCase(NewClientAuthenticator(repo, &assertionRepoStub{used: map[string]bool{}}, testIssuer+"/"), issuer, time.Minute, nil, nil), repo, issuer, audit
+}
+
+func TestClientCredentialsGrantWithSecret(t *testing.T) {
+	clients, tokens, repo, issuer, audit := newTestUseCases()
+	ctx := context.Background()
+
+	reg, err := clients.Register(ctx, RegisterClientInput{Name: "billing", Scopes: []string{domain.ScopeRevocationsRead}, Actor: "admin_api"})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if !strings.HasPrefix(reg.Secret, domain.OAuthClientSecretPrefix) || reg.Client.AuthMethod != domain.ClientAuthSecret {
+		t.Fatalf("unexpected registration: %+v", reg)
+	}
+	if stored := repo.clients[reg.Client.ID]; stored.SecretHash == reg.Secret || stored.SecretHash != common.HashToken(reg.Secret) {
+		t.Fatalf("expected only the hash of the secret to be stored")
+	}
+	if len(audit.records) != 1 || audit.records[0].Action != domain.AuditActionClientRegistered {
+		t.Fatalf("expected the registration to be audited, got %+v", audit.records)
+	}
+
+	out, err := tokens.Token(ctx, TokenInput{GrantType: GrantTypeClientCredentials, Credentials: ClientCredentials{ClientID: reg.Client.ID, ClientSecret: reg.Secret}})
+	if err != nil {
+		t.Fatalf("token failed: %v", err)
+	}
+	if out.AccessToken != "access" || out.TokenType != "Bearer" || out.Scope != domain.ScopeRevocationsRead {
+		t.Fatalf("unexpected token: %+v", out)
+	}
+	if issuer.claims.ClientID != reg.Client.ID || issuer.claims.UserID != "" || issuer.claims.SessionID != "" {
+		t.Fatalf("expected a client principal, got %+v", issuer.claims)
+	}
+
+	cases := []struct {
+		name string
+		in   TokenInput
+		want error
+	}{
+		{"wrong secret", TokenInput{GrantType: GrantTypeClientCredentials, Credentials: ClientCredentials{ClientID: reg.Client.ID, ClientSecret: "xbs_wrong"}}, domain.ErrInvalidClient},
+		{"unknown client", TokenInput{GrantType: GrantTypeClientCredentials, Credentials: ClientCredentials{ClientID: "nope", ClientSecret: reg.Secret}}, domain.ErrInvalidClient},
+		{"other grant", TokenInput{GrantType: "password", Credentials: ClientCredentials{ClientID: reg.Client.ID, ClientSecret: reg.Secret}}, domain.ErrUnsupportedGrantType},
+		{"no grant", TokenInput{Credentials: ClientCredentials{ClientID: reg.Client.ID, ClientSecret: reg.Secret}}, domain.ErrInvalidOAuthRequest},
+		{"scope not granted", TokenInput{GrantType: GrantTypeClientCredentials, Scope: domain.ScopeProfileRead, Credentials: ClientCredentials{ClientID: reg.Client.ID, ClientSecret: reg.Secret}}, domain.ErrInvalidScope},
+	}
+	for _, tc := range cases {
+		if _, err := tokens.Token(ctx, tc.in); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	if _, err := clients.Disable(ctx, DisableClientInput{ClientID: reg.Client.ID, Actor: "admin_api"}); err != nil {
+		t.Fatalf("disable failed: %v", err)
+	}
+	if _, err := tokens.Token(ctx, TokenInput{GrantType: GrantTypeClientCredentials, Credentials: ClientCredentials{ClientID: reg.Client.ID, ClientSecret: reg.Secret}}); !errors.Is(err, domain.ErrInvalidClient) {
+		t.Fatalf("expected a disabled client to be refused, got %v", err)
+	}
+	if _, err := clients.Disable(ctx, DisableClientInput{ClientID: "nope"}); !errors.Is(err, domain.ErrClientNotFound) {
+		t.Fatalf("expected an unknown client to be reported, got %v", err)
+	}
+}
+
+func TestClientCredentialsGrantWithPrivateKeyJWT(t *testing.T) {
+	clients, tokens, _, _, _ := newTestUseCases()
+	ctx := context.Background()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	if _, err := clients.Register(ctx, RegisterClientInput{Name: "bad", AuthMethod: domain.ClientAuthPrivateKeyJWT, PublicKey: "not a key", Scopes: []string{domain.ScopeRevocationsRead}}); !errors.Is(err, domain.ErrInvalidClientKey) {
+		t.Fatalf("expected an invalid key to be rejected, got %v", err)
+	}
+	reg, err := clients.Register(ctx, RegisterClientInput{Name: "search", AuthMethod: domain.ClientAuthPrivateKeyJWT, PublicKey: pemKey, Scopes: []string{domain.ScopeRevocationsRead}})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if reg.Secret != "" {
+		t.Fatalf("expected no secret for a private_key_jwt client")
+	}
+
+	sign := func(aud, jti string, ttl time.Duration) string {
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{
+			Issuer:    reg.Client.ID,
+			Subject:   reg.Client.ID,
+			Audience:  jwt.ClaimStrings{aud},
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		})
+		raw, err := token.SignedString(priv)
+		if err != nil {
+			t.Fatalf("sign failed: %v", err)
+		}
+		return raw
+	}
+	grant := func(assertion string) error {
+		_, err := tokens.Token(ctx, TokenInput{GrantType: GrantTypeClientCredentials, Credentials: ClientCredentials{AssertionType: AssertionTypeJWTBearer, Assertion: assertion}})
+		return err
+	}
+
+	assertion := sign(testIssuer+TokenPath, "1", time.Minute)
+	if err := grant(assertion); err != nil {
+		t.Fatalf("grant failed: %v", err)
+	}
+	if err := grant(assertion); !errors.Is(err, domain.ErrInvalidClient) {
+		t.Fatalf("expected a replayed assertion to be refused, got %v", err)
+	}
+	if err := grant(sign(testIssuer, "2", time.Minute)); err != nil {
+		t.Fatalf("expected the issuer as audience to pass, got %v", err)
+	}
+	if err := grant(sign("https://elsewhere.example.com", "3", time.Minute)); !errors.Is(err, domain.ErrInvalidClient) {
+		t.Fatalf("expected a foreign audience to be refused, got %v", err)
+	}
+	if err := grant(sign(testIssuer, "4", 2*time.Hour)); !errors.Is(err, domain.ErrInvalidClient) {
+		t.Fatalf("expected a long-lived assertion to be refused, got %v", err)
+	}
+	if _, err := tokens.Token(ctx, TokenInput{GrantType: GrantTypeClientCredentials, Credentials: ClientCredentials{AssertionType: "urn:other", Assertion: sign(testIssuer, "5", time.Minute)}}); !errors.Is(err, domain.ErrInvalidOAuthRequest) {
+		t.Fatalf("expected an unknown assertion type to be refused, got %v", err)
+	}
+}
+
+type codeRepoStub struct {
+	codes map[string]domain.AuthorizationCode
+}
+
+func (s *codeRepoStub) Create(_ context.Context, c domain.AuthorizationCode) error {
+	s.codes[c.CodeHash] = c
+	return nil
+}
+
+func (s *codeRepoStub) GetByHash(_ context.Context, hash string) (domain.AuthorizationCode, bool, error) {
+	c, ok := s.codes[hash]
+	return c, ok, nil
+}
+
+func (s *codeRepoStub) MarkUsed(_ context.Context, id, sessionID string, at time.Time) (bool, error) {
+	for hash, c := range s.codes {
+		if c.ID == id && c.UsedAt == nil {
+			c.UsedAt, c.SessionID = &at, sessionID
+			s.codes[hash] = c
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type consentRepoStub struct {
+	consents map[string]domain.OAuthConsent
+}
+
+func (s *consentRepoStub) Get(_ context.Context, userID domain.UserID, clientID string) (domain.OAuthConsent, bool, error) {
+	c, ok := s.consents[userID.String()+"/"+clientID]
+	return c, ok, nil
+}
+
+func (s *consentRepoStub) Save(_ context.Context, c domain.OAuthConsent) error {
+	s.consents[c.UserID.String()+"/"+c.ClientID] = c
+	return nil
+}
+
+type grantRepoStub struct {
+	grants map[string]domain.OAuthGrant
+}
+
+func (s *grantRepoStub) Create(_ context.Context, g domain.OAuthGrant) error {
+	s.grants[g.SessionID] = g
+	return nil
+}
+
+func (s *grantRepoStub) GetBySession(_ context.Context, sessionID string) (domain.OAuthGrant, bool, error) {
+	g, ok := s.grants[sessionID]
+	return g, ok, nil
+}
+
+type sessionRepoStub struct {
+	domain.RefreshTokenRepository
+	sessions map[string]domain.RefreshToken
+}
+
+func (s *sessionRepoStub) Create(_ context.Context, t domain.RefreshToken) error {
+	s.sessions[t.ID] = t
+	return nil
+}
+
+func (s *sessionRepoStub) GetByID(_ context.Context, id string) (domain.RefreshToken, bool, error) {
+	t, ok := s.sessions[id]
+	return t, ok, nil
+}
+
+func (s *sessionRepoStub) GetByHash(_ context.Context, hash string) (domain.RefreshToken, bool, error) {
+	for _, t := range s.sessions {
+		if t.TokenHash == hash {
+			return t, true, nil
+		}
+	}
+	return domain.RefreshToken{}, false, nil
+}
+
+func (s *sessionRepoStub) Revoke(_ context.Context, id string) error {
+	t := s.sessions[id]
+	now := time.Now()
+	t.RevokedAt = &now
+	s.sessions[id] = t
+	return nil
+}
+
+type userRepoStub struct {
+	domain.UserRepository
+	user domain.User
+}
+
+func (s *userRepoStub) GetByID(_ context.Context, id domain.UserID) (domain.User, bool, error) {
+	return s.user, id == s.user.ID, nil
+}
+
+type identityRepoStub struct {
+	domain.IdentityRepository
+	identity domain.Identity
+}
+
+func (s *identityRepoStub) GetByUserAndProvider(_ context.Context, userID domain.UserID, provider string) (domain.Identity, bool, error) {
+	return s.identity, userID == s.identity.UserID && provider == s.identity.Provider, nil
+}
+
+type signerStub struct {
+	claims IDTokenClaims
+}
+
+func (s *signerStub) SignIDToken(c IDTokenClaims) (string, error) {
+	s.claims = c
+	return "id-token", nil
+}
+
+func (s *signerStub) Algorithm() string        { return "RS256" }
+func (s *signerStub) PublicKeys() []JSONWebKey { return nil }
+
+type uowStub struct{}
+
+func (uowStub) Do(ctx context.Context, fn func(ctx context.Context) error) error { return fn(ctx) }
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	clients, _, repo, _, _ := newTestUseCases()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	reg, err := clients.Register(ctx, RegisterClientInput{Name: "Web", AuthMethod: domain.ClientAuthNone, RedirectURIs: []string{"https://app.example.com/callback"}})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if reg.Secret != "" {
+		t.Fatalf("expected no secret for a public client")
+	}
+
+	verified := now
+	userID := domain.UserID("3f1e7a52-7f6c-4a4e-9a86-7d3f2b8c1e01")
+	users := &userRepoStub{user: domain.User{ID: userID, Email: "user@example.com", DisplayName: "User"}}
+	identities := &identityRepoStub{identity: domain.Identity{UserID: userID, Provider: "email", ProviderUserID: "user@example.com", EmailVerifiedAt: &verified}}
+	sessions := &sessionRepoStub{sessions: map[string]domain.RefreshToken{}}
+	login := domain.NewRefreshTokenRecord(userID, "login-hash", now, time.Hour).WithAuthentication(now.Add(-time.Minute), domain.AMRPassword)
+	sessions.sessions[login.ID] = login
+
+	codes := &codeRepoStub{codes: map[string]domain.AuthorizationCode{}}
+	grants := &grantRepoStub{grants: map[string]domain.OAuthGrant{}}
+	signer := &signerStub{}
+	userInfo := NewUserInfo(grants, users, identities)
+	var refreshed refresh.Input
+	access := &issuerStub{}
+	tokens := NewTokenUseCase(NewClientAuthenticator(repo, &assertionRepoStub{used: map[string]bool{}}, testIssuer), &issuerStub{}, time.Minute, NewCodeGrant(codes, grants, sessions, userInfo, access, signer, func(_ context.Context, in refresh.Input) (refresh.Output, error) {
+		refreshed = in
+		return refresh.Output{AccessToken: "rotated", RefreshToken: "next"}, nil
+	}, uowStub{}, time.Minute, common.SessionPolicy{}, testIssuer), nil)
+	authorizer := NewAuthorizer(repo, codes, &consentRepoStub{consents: map[string]domain.OAuthConsent{}}, sessions, testIssuer, "https://login.example.com/authorize")
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	req := AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            reg.Client.ID,
+		RedirectURI:         "https://app.example.com/callback",
+		Scope:               "openid email",
+		State:               "xyz",
+		Nonce:               "n-1",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+	}
+
+	start, err := authorizer.Start(ctx, StartAuthorizationInput{Request: req})
+	if err != nil || !strings.HasPrefix(start.RedirectTo, "https://login.example.com/authorize?") {
+		t.Fatalf("expected a redirect to the login page, got %+v %v", start, err)
+	}
+	foreign := req
+	foreign.RedirectURI = "https://evil.example.com/callback"
+	if _, err := authorizer.Start(ctx, StartAuthorizationInput{Request: foreign}); !errors.Is(err, domain.ErrInvalidRedirectURI) {
+		t.Fatalf("expected an unregistered redirect URI to be refused, got %v", err)
+	}
+	plain := req
+	plain.CodeChallengeMethod = "plain"
+	if out, _ := authorizer.Start(ctx, StartAuthorizationInput{Request: plain}); !strings.Contains(out.RedirectTo, "error=invalid_request") {
+		t.Fatalf("expected a request without S256 to be sent back with an error, got %q", out.RedirectTo)
+	}
+
+	in := AuthorizeInput{Request: req, UserID: userID.String(), SessionID: login.ID}
+	out, err := authorizer.Authorize(ctx, in)
+	if err != nil || out.Status != AuthorizationConsentRequired || out.Consent == nil || out.Consent.ClientName != "Web" {
+		t.Fatalf("expected the consent screen first, got %+v %v", out, err)
+	}
+	in.Consent = ConsentApprove
+	out, err = authorizer.Authorize(ctx, in)
+	if err != nil || out.Status != AuthorizationRedirect {
+		t.Fatalf("authorize failed: %+v %v", out, err)
+	}
+	redirect, _ := url.Parse(out.RedirectTo)
+	code := redirect.Query().Get("code")
+	if code == "" || redirect.Query().Get("state") != "xyz" || redirect.Query().Get("iss") != testIssuer {
+		t.Fatalf("unexpected redirect: %s", out.RedirectTo)
+	}
+	in.Consent = ""
+	if again, _ := authorizer.Authorize(ctx, in); again.Status != AuthorizationRedirect {
+		t.Fatalf("expected the consent to be remembered, got %+v", again)
+	}
+
+	exchange := TokenInput{GrantType: GrantTypeAuthorizationCode, Code: code, RedirectURI: req.RedirectURI, CodeVerifier: verifier, Credentials: ClientCredentials{ClientID: reg.Client.ID}}
+	wrong := exchange
+	wrong.CodeVerifier = strings.Repeat("w", 43)
+	if _, err := tokens.Token(ctx, wrong); !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Fatalf("expected a wrong verifier to be refused, got %v", err)
+	}
+
+	tok, err := tokens.Token(ctx, exchange)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if tok.IDToken != "id-token" || tok.RefreshToken == "" || tok.Scope != "email openid" {
+		t.Fatalf("unexpected token response: %+v", tok)
+	}
+	if c := signer.claims; c.Audience != reg.Client.ID || c.Nonce != "n-1" || !c.AuthTime.Equal(login.AuthTime) || c.User.Email != "user@example.com" || c.User.EmailVerified == nil || !*c.User.EmailVerified || c.User.Name != "" {
+		t.Fatalf("unexpected ID token claims: %+v", c)
+	}
+	session := sessions.sessions[signer.claims.SessionID]
+	if session.UserID != userID || session.DeviceName != "Web" || !session.AuthTime.IsZero() {
+		t.Fatalf("expected a new session for the client without an auth time, got %+v", session)
+	}
+	if c := access.claims; c.SessionID != session.ID || c.ClientID != reg.Client.ID || strings.Join(c.Scopes, " ") != "email openid" || !c.AuthTime.IsZero() {
+		t.Fatalf("expected an access token limited to the granted scopes, got %+v", c)
+	}
+
+	info, err := userInfo.Get(ctx, UserInfoInput{UserID: userID.String(), SessionID: session.ID})
+	if err != nil || info.Subject != userID.String() || info.Email != "user@example.com" {
+		t.Fatalf("unexpected userinfo: %+v %v", info, err)
+	}
+	if _, err := userInfo.Get(ctx, UserInfoInput{UserID: userID.String(), SessionID: login.ID}); !errors.Is(err, domain.ErrInsufficientScope) {
+		t.Fatalf("expected first-party sessions to be refused, got %v", err)
+	}
+
+	refreshIn := TokenInput{GrantType: GrantTypeRefreshToken, RefreshToken: tok.RefreshToken, Credentials: ClientCredentials{ClientID: reg.Client.ID}}
+	rotated, err := tokens.Token(ctx, refreshIn)
+	if err != nil || rotated.RefreshToken != "next" || refreshed.RefreshToken != tok.RefreshToken {
+		t.Fatalf("unexpected refresh: %+v %v", rotated, err)
+	}
+	refreshIn.Scope = "openid profile"
+	if _, err := tokens.Token(ctx, refreshIn); !errors.Is(err, domain.ErrInvalidScope) {
+		t.Fatalf("expected a wider scope to be refused, got %v", err)
+	}
+
+	if _, err := tokens.Token(ctx, exchange); !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Fatalf("expected a used code to be refused, got %v", err)
+	}
+	if s := sessions.sessions[session.ID]; s.RevokedAt == nil {
+		t.Fatalf("expected a replayed code to end its session")
+	}
+}
+
+type inspectorStub struct {
+	tokens map[string]common.AccessTokenInfo
+}
+
+func (s *inspectorStub) Inspect(_ context.Context, token string) (common.AccessTokenInfo, error) {
+	info, ok := s.tokens[token]
+	if !ok {
+		return common.AccessTokenInfo{}, errors.New("invalid token")
+	}
+	return info, nil
+}
+
+type revocationPublisherStub struct {
+	common.NopEventPublisher
+	revoked []events.SessionRevoked
+}
+
+func (s *revocationPublisherStub) PublishSessionRevoked(_ context.Context, e events.SessionRevoked) error {
+	s.revoked = append(s.revoked, e)
+	return nil
+}
+
+func TestIntrospectionAndRevocation(t *testing.T) {
+	clients, tokens, _, _, _ := newTestUseCases()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	confidential, err := clients.Register(ctx, RegisterClientInput{Name: "gateway", Scopes: []string{domain.ScopeRevocationsRead}})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	publicClient, err := clients.Register(ctx, RegisterClientInput{Name: "app", AuthMethod: domain.ClientAuthNone, RedirectURIs: []string{"https://app.example.com/callback"}})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	creds := ClientCredentials{ClientID: confidential.Client.ID, ClientSecret: confidential.Secret}
+
+	userID := domain.UserID("3f1e7a52-7f6c-4a4e-9a86-7d3f2b8c1e01")
+	sessions := &sessionRepoStub{sessions: map[string]domain.RefreshToken{}}
+	granted := domain.NewRefreshTokenRecord(userID, common.HashToken("refresh-1"), now, time.Hour)
+	sessions.sessions[granted.ID] = granted
+	grants := &grantRepoStub{grants: map[string]domain.OAuthGrant{granted.ID: {SessionID: granted.ID, ClientID: publicClient.Client.ID, Scopes: []string{"openid"}}}}
+	access := &inspectorStub{tokens: map[string]common.AccessTokenInfo{
+		"access-1": {UserID: userID.String(), SessionID: granted.ID, IssuedAt: now, ExpiresAt: now.Add(time.Minute)},
+	}}
+	publisher := &revocationPublisherStub{}
+	uc := NewIntrospection(tokens.clients, access, sessions, grants, nil, publisher)
+
+	out, err := uc.Introspect(ctx, IntrospectInput{Token: "access-1", Credentials: creds})
+	if err != nil {
+		t.Fatalf("introspect failed: %v", err)
+	}
+	if !out.Active || out.TokenType != TokenTypeAccessToken || out.Subject != userID.String() || out.ClientID != publicClient.Client.ID || out.Issuer != testIssuer {
+		t.Fatalf("unexpected access token introspection: %+v", out)
+	}
+	out, err = uc.Introspect(ctx, IntrospectInput{Token: "refresh-1", TokenTypeHint: TokenTypeRefreshToken, Credentials: creds})
+	if err != nil || !out.Active || out.TokenType != TokenTypeRefreshToken || out.SessionID != granted.ID || !out.ExpiresAt.Equal(granted.ExpiresAt) {
+		t.Fatalf("unexpected refresh token introspection: %+v %v", out, err)
+	}
+	if out, err := uc.Introspect(ctx, IntrospectInput{Token: "unknown", Credentials: creds}); err != nil || out.Active {
+		t.Fatalf("expected an unknown token to be inactive, got %+v %v", out, err)
+	}
+	if _, err := uc.Introspect(ctx, IntrospectInput{Token: "access-1", Credentials: ClientCredentials{ClientID: publicClient.Client.ID}}); !errors.Is(err, domain.ErrInvalidClient) {
+		t.Fatalf("expected public clients to be refused, got %v", err)
+	}
+
+	if _, err := uc.Revoke(ctx, RevokeInput{Token: "access-1", Credentials: creds}); !errors.Is(err, domain.ErrUnsupportedTokenType) {
+		t.Fatalf("expected access tokens not to be revocable, got %v", err)
+	}
+	if _, err := uc.Revoke(ctx, RevokeInput{Token: "unknown", Credentials: creds}); err != nil {
+		t.Fatalf("expected unknown tokens to be ignored, got %v", err)
+	}
+	if _, err := uc.Revoke(ctx, RevokeInput{Token: "refresh-1", Credentials: creds}); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if sessions.sessions[granted.ID].RevokedAt == nil || len(publisher.revoked) != 1 || publisher.revoked[0].Reason != events.SessionRevokedByClient {
+		t.Fatalf("expected the session to end, got %+v", publisher.revoked)
+	}
+	if _, err := uc.Revoke(ctx, RevokeInput{Token: "refresh-1", Credentials: creds}); err != nil || len(publisher.revoked) != 1 {
+		t.Fatalf("expected revoking again to succeed quietly, got %v", err)
+	}
+	if out, _ := uc.Introspect(ctx, IntrospectInput{Token: "refresh-1", Credentials: creds}); out.Active {
+		t.Fatalf("expected a revoked refresh token to be inactive")
+	}
+}
+
+type deviceRepoStub struct {
+	devices map[string]domain.DeviceAuthorization
+}
+
+func (s *deviceRepoStub) Create(_ context.Context, d domain.DeviceAuthorization) error {
+	s.devices[d.ID] = d
+	return nil
+}
+
+func (s *deviceRepoStub) GetByDeviceCode(_ context.Context, hash string) (domain.DeviceAuthorization, bool, error) {
+	for _, d := range s.devices {
+		if d.DeviceCodeHash == hash {
+			return d, true, nil
+		}
+	}
+	return domain.DeviceAuthorization{}, false, nil
+}
+
+func (s *deviceRepoStub) GetByUserCode(_ context.Context, hash string) (domain.DeviceAuthorization, bool, error) {
+	for _, d := range s.devices {
+		if d.UserCodeHash == hash {
+			return d, true, nil
+		}
+	}
+	return domain.DeviceAuthorization{}, false, nil
+}
+
+func (s *deviceRepoStub) Poll(_ context.Context, id string, at time.Time, interval time.Duration) error {
+	d := s.devices[id]
+	d.LastPolledAt = &at
+	d.Interval = interval
+	s.devices[id] = d
+	return nil
+}
+
+func (s *deviceRepoStub) Decide(_ context.Context, d domain.DeviceAuthorization) (bool, error) {
+	if s.devices[d.ID].Status != domain.DeviceAuthorizationPending {
+		return false, nil
+	}
+	s.devices[d.ID] = d
+	return true, nil
+}
+
+func (s *deviceRepoStub) MarkUsed(_ context.Context, id, sessionID string, at time.Time) (bool, error) {
+	d := s.devices[id]
+	if d.UsedAt != nil {
+		return false, nil
+	}
+	d.UsedAt = &at
+	d.SessionID = sessionID
+	s.devices[id] = d
+	return true, nil
+}
+
+func TestDeviceAuthorizationGrant(t *testing.T) {
+	clients, tokens, _, _, _ := newTestUseCases()
+	ctx := common.WithRequestMeta(context.Background(), common.RequestMeta{IP: "203.0.113.7", UserAgent: "tv/1.0"})
+	now := time.Now().UTC()
+
+	reg, err := clients.Register(ctx, RegisterClientInput{Name: "TV", AuthMethod: domain.ClientAuthNone})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	creds := ClientCredentials{ClientID: reg.Client.ID}
+	if _, err := tokens.Token(ctx, TokenInput{GrantType: GrantTypeDeviceCode, DeviceCode: "x", Credentials: creds}); !errors.Is(err, domain.ErrUnsupportedGrantType) {
+		t.Fatalf("expected device codes to be refused while the grant is off, got %v", err)
+	}
+
+	userID := domain.UserID("3f1e7a52-7f6c-4a4e-9a86-7d3f2b8c1e01")
+	sessions := &sessionRepoStub{sessions: map[string]domain.RefreshToken{}}
+	login := domain.NewRefreshTokenRecord(userID, "login-hash", now, time.Hour).WithAuthentication(now.Add(-time.Minute), domain.AMRPassword)
+	sessions.sessions[login.ID] = login
+	devices := &deviceRepoStub{devices: map[string]domain.DeviceAuthorization{}}
+	grants := &grantRepoStub{grants: map[string]domain.OAuthGrant{}}
+	issuer := &issuerStub{}
+	grant := NewDeviceGrant(tokens.clients, devices, grants, sessions, issuer, uowStub{}, time.Minute, common.SessionPolicy{}, "https://example.com/device")
+	clock := now
+	grant.now = func() time.Time { return clock }
+	tokens = NewTokenUseCase(tokens.clients, issuer, time.Minute, nil, grant)
+
+	start, err := grant.Authorize(ctx, DeviceAuthorizationInput{Credentials: creds})
+	if err != nil {
+		t.Fatalf("device authorization failed: %v", err)
+	}
+	if len(start.UserCode) != 9 || start.UserCode[4] != '-' || strings.ContainsAny(start.UserCode, "AEIOUY0123456789") {
+		t.Fatalf("unexpected user code %q", start.UserCode)
+	}
+	if start.VerificationURIComplete != "https://example.com/device?user_code="+start.UserCode || start.Interval != 5*time.Second {
+		t.Fatalf("unexpected device authorization: %+v", start)
+	}
+
+	poll := TokenInput{GrantType: GrantTypeDeviceCode, DeviceCode: start.DeviceCode, Credentials: creds}
+	if _, err := tokens.Token(ctx, poll); !errors.Is(err, domain.ErrAuthorizationPending) {
+		t.Fatalf("expected authorization_pending, got %v", err)
+	}
+	if _, err := tokens.Token(ctx, poll); !errors.Is(err, domain.ErrSlowDown) {
+		t.Fatalf("expected slow_down for a poll within the interval, got %v", err)
+	}
+
+	verify := VerifyDeviceInput{UserCode: "BBBB-BBBB", UserID: userID.String(), SessionID: login.ID}
+	if _, err := grant.Verify(ctx, verify); !errors.Is(err, domain.ErrInvalidUserCode) {
+		t.Fatalf("expected an unknown user code to be refused, got %v", err)
+	}
+	verify.UserCode = strings.ToLower(strings.ReplaceAll(start.UserCode, "-", " "))
+	if _, err := grant.Verify(ctx, VerifyDeviceInput{UserCode: verify.UserCode, UserID: "someone-else", SessionID: login.ID}); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected another user's session to be refused, got %v", err)
+	}
+	device, err := grant.Verify(ctx, verify)
+	if err != nil || device.Status != domain.DeviceAuthorizationPending || device.ClientName != "TV" || device.IP != "203.0.113.7" || device.UserAgent != "tv/1.0" {
+		t.Fatalf("unexpected device lookup: %+v %v", device, err)
+	}
+	verify.Consent = ConsentApprove
+	if device, err = grant.Verify(ctx, verify); err != nil || device.Status != domain.DeviceAuthorizationApproved {
+		t.Fatalf("approve failed: %+v %v", device, err)
+	}
+	if _, err := grant.Verify(ctx, verify); !errors.Is(err, domain.ErrInvalidUserCode) {
+		t.Fatalf("expected an answered code to be refused, got %v", err)
+	}
+
+	// The device was slowed down to 10 seconds, and each early poll adds 5
+	// more.
+	clock = clock.Add(6 * time.Second)
+	if _, err := tokens.Token(ctx, poll); !errors.Is(err, domain.ErrSlowDown) {
+		t.Fatalf("expected the slower interval to hold, got %v", err)
+	}
+	clock = clock.Add(15 * time.Second)
+	tok, err := tokens.Token(ctx, poll)
+	if err != nil || tok.AccessToken == "" || tok.RefreshToken == "" || tok.IDToken != "" {
+		t.Fatalf("unexpected token response: %+v %v", tok, err)
+	}
+	session := sessions.sessions[issuer.claims.SessionID]
+	if session.UserID != userID || session.DeviceName != "TV" || session.LoginMethod != domain.LoginMethodDevice || session.IP != "203.0.113.7" || !session.AuthTime.IsZero() {
+		t.Fatalf("expected a new session for the device, got %+v", session)
+	}
+	if g := grants.grants[session.ID]; g.ClientID != reg.Client.ID || len(g.Scopes) != 0 {
+		t.Fatalf("expected the session to be tied to the client, got %+v", g)
+	}
+	clock = clock.Add(time.Minute)
+	if _, err := tokens.Token(ctx, poll); !errors.Is(err, domain.ErrInvalidGrant) {
+		t.Fatalf("expected a used device code to be refused, got %v", err)
+	}
+
+	denied, err := grant.Authorize(ctx, DeviceAuthorizationInput{Credentials: creds})
+	if err != nil {
+		t.Fatalf("device authorization failed: %v", err)
+	}
+	if _, err := grant.Verify(ctx, VerifyDeviceInput{UserCode: denied.UserCode, UserID: userID.String(), SessionID: login.ID, Consent: ConsentDeny}); err != nil {
+		t.Fatalf("deny failed: %v", err)
+	}
+	poll.DeviceCode = denied.DeviceCode
+	if _, err := tokens.Token(ctx, poll); !errors.Is(err, domain.ErrAccessDenied) {
+		t.Fatalf("expected access_denied, got %v", err)
+	}
+
+	expired, err := grant.Authorize(ctx, DeviceAuthorizationInput{Credentials: creds})
+	if err != nil {
+		t.Fatalf("device authorization failed: %v", err)
+	}
+	clock = clock.Add(deviceCodeTTL)
+	poll.DeviceCode = expired.DeviceCode
+	if _, err := tokens.Token(ctx, poll); !errors.Is(err, domain.ErrExpiredToken) {
+		t.Fatalf("expected expired_token, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package oauth
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// UserInfo serves the userinfo endpoint to the access tokens of sessions
+// issued to clients: the claims released by the scopes the user granted.
+// The tokens of the user's own sessions are refused, as they were granted
+// no scopes.
+type UserInfo struct {
+	grants     domain.OAuthGrantRepository
+	users      domain.UserRepository
+	identities domain.IdentityRepository
+	now        func() time.Time
+}
+
+func NewUserInfo(grants domain.OAuthGrantRepository, users domain.UserRepository, identities domain.IdentityRepository) *UserInfo {
+	return &UserInfo{grants: grants, users: users, identities: identities, now: time.Now}
+}
+
+func (uc *UserInfo) Get(ctx context.Context, in UserInfoInput) (UserInfoOutput, error) {
+	grant, found, err := uc.grants.GetBySession(ctx, in.SessionID)
+	if err != nil {
+		return UserInfoOutput{}, common.NormalizeError(err)
+	}
+	if !found || !grant.HasScope(domain.ScopeOpenID) {
+		return UserInfoOutput{}, domain.ErrInsufficientScope
+	}
+	return uc.claims(ctx, domain.UserID(in.UserID), grant.Scopes)
+}
+
+// claims returns the claims of the user that scopes release. Users who are
+// gone, suspended or blocked get ErrUnauthorized.
+func (uc *UserInfo) claims(ctx context.Context, userID domain.UserID, scopes []string) (UserInfoOutput, error) {
+	u, found, err := uc.users.GetByID(ctx, userID)
+	if err != nil {
+		return UserInfoOutput{}, common.NormalizeError(err)
+	}
+	if !found || u.Suspended || (u.BlockedUntil != nil && u.BlockedUntil.After(uc.now())) {
+		return UserInfoOutput{}, domain.ErrUnauthorized
+	}
+
+	out := UserInfoOutput{Subject: u.ID.String()}
+	if slices.Contains(scopes, domain.ScopeProfile) {
+		out.Name = u.DisplayName
+		out.GivenName = u.FirstName
+		out.FamilyName = u.LastName
+		out.MiddleName = u.MiddleName
+		out.Picture = u.AvatarURL
+	}
+	if slices.Contains(scopes, domain.ScopeEmail) && u.Email != "" {
+		out.Email = u.Email
+		ident, found, err := uc.identities.GetByUserAndProvider(ctx, u.ID, "email")
+		if err != nil {
+			return UserInfoOutput{}, common.NormalizeError(err)
+		}
+		if found && ident.ProviderUserID == u.Email {
+			verified := ident.IsEmailVerified()
+			out.EmailVerified = &verified
+		}
+	}
+	return out, nil
+}
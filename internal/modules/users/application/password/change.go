@@ -2,24 +2,40 @@ package password
 
 import (
 	"context"
+	"time"
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
 type ChangeInput struct {
-	UserID          string
+	UserID string
+	// SessionID is the caller's session; it stays signed in while every
+	// other session is revoked.
+	SessionID       string
 	CurrentPassword string
 	NewPassword     string
+	// AuthTime is when the caller's session last authenticated.
+	AuthTime time.Time
 }
 
 type ChangeUseCase struct {
-	identities domain.IdentityRepository
-	hasher     domain.PasswordHasher
+	identities   domain.IdentityRepository
+	hasher       domain.PasswordHasher
+	refresh      domain.RefreshTokenRepository
+	events       common.EventPublisher
+	reauthMaxAge time.Duration
 }
 
-func NewChange(identities domain.IdentityRepository, hasher domain.PasswordHasher) *ChangeUseCase {
-	return &ChangeUseCase{identities: identities, hasher: hasher}
+func NewChange(identities domain.IdentityRepository, hasher domain.PasswordHasher, refresh domain.RefreshTokenRepository, publisher common.EventPublisher, reauthMaxAge time.Duration) *ChangeUseCase {
+	if publisher == nil {
+		publisher = common.NopEventPublisher{}
+	}
+	if reauthMaxAge <= 0 {
+		reauthMaxAge = common.DefaultReauthMaxAge
+	}
+	return &ChangeUseCase{identities: identities, hasher: hasher, refresh: refresh, events: publisher, reauthMaxAge: reauthMaxAge}
 }
 
 func (uc *ChangeUseCase) Execute(ctx context.Context, in ChangeInput) (struct{}, error) {
@@ -27,6 +43,9 @@ func (uc *ChangeUseCase) Execute(ctx context.Context, in ChangeInput) (struct{},
 	if err != nil {
 		return struct{}{}, err
 	}
+	if err := common.RequireRecentAuth(in.AuthTime, uc.reauthMaxAge); err != nil {
+		return struct{}{}, err
+	}
 
 	ident, found, err := uc.identities.GetByUserAndProvider(ctx, userID, "email")
 	if err != nil {
@@ -50,5 +69,21 @@ func (uc *ChangeUseCase) Execute(ctx context.Context, in ChangeInput) (struct{},
 		return struct{}{}, common.NormalizeError(err)
 	}
 
+	var keep []string
+	if in.SessionID != "" {
+		keep = []string{in.SessionID}
+	}
+	revoked, err := uc.refresh.RevokeAllExcept(ctx, userID, keep)
+	if err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	now := time.Now().UTC()
+	if err := common.PublishSessionsRevoked(ctx, uc.events, userID, revoked, events.SessionRevokedPasswordChange, now); err != nil {
+		return struct{}{}, err
+	}
+	if err := common.PublishPasswordChanged(ctx, uc.events, ident, events.PasswordChangedByUser, now); err != nil {
+		return struct{}{}, err
+	}
+
 	return struct{}{}, nil
 }
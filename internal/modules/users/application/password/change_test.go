@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
@@ -45,24 +48,35 @@ func (stubPasswordHasher) Compare(_ context.Context, hash string, password strin
 
 func TestChangePasswordSuccess(t *testing.T) {
 	userID := domain.NewUserID()
-	repo := &stubIdentityRepo{identity: domain.Identity{UserID: userID, Provider: "email", SecretHash: "hashed:old"}, found: true}
-	uc := NewChange(repo, stubPasswordHasher{})
+	repo := &stubIdentityRepo{identity: domain.Identity{UserID: userID, Provider: "email", ProviderUserID: "user@example.com", SecretHash: "hashed:old"}, found: true}
+	sessions := &stubRefreshRepo{revoked: []string{"other"}}
+	publisher := &stubPublisher{}
+	uc := NewChange(repo, stubPasswordHasher{}, sessions, publisher, 0)
 
-	if _, err := uc.Execute(context.Background(), ChangeInput{UserID: userID.String(), CurrentPassword: "old", NewPassword: "newpassword"}); err != nil {
+	if _, err := uc.Execute(context.Background(), ChangeInput{UserID: userID.String(), SessionID: "current", CurrentPassword: "old", NewPassword: "newpassword", AuthTime: time.Now()}); err != nil {
 		t.Fatalf("expected success, got %v", err)
 	}
 
 	if repo.updated.SecretHash.String() != "hashed:newpassword" {
 		t.Fatalf("expected new hash saved, got %s", repo.updated.SecretHash)
 	}
+	if len(sessions.kept) != 1 || sessions.kept[0] != "current" {
+		t.Fatalf("expected only the current session to be kept, got %v", sessions.kept)
+	}
+	if len(publisher.revoked) != 1 || publisher.revoked[0].Reason != events.SessionRevokedPasswordChange {
+		t.Fatalf("expected session_revoked events, got %+v", publisher.revoked)
+	}
+	if publisher.changed.Method != events.PasswordChangedByUser || publisher.changed.Email != "user@example.com" {
+		t.Fatalf("expected a password_changed event, got %+v", publisher.changed)
+	}
 }
 
 func TestChangePasswordInvalidCurrent(t *testing.T) {
 	userID := domain.NewUserID()
 	repo := &stubIdentityRepo{identity: domain.Identity{UserID: userID, Provider: "email", SecretHash: "hashed:old"}, found: true}
-	uc := NewChange(repo, stubPasswordHasher{})
+	uc := NewChange(repo, stubPasswordHasher{}, &stubRefreshRepo{}, nil, 0)
 
-	if _, err := uc.Execute(context.Background(), ChangeInput{UserID: userID.String(), CurrentPassword: "wrong", NewPassword: "newpassword"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+	if _, err := uc.Execute(context.Background(), ChangeInput{UserID: userID.String(), CurrentPassword: "wrong", NewPassword: "newpassword", AuthTime: time.Now()}); !errors.Is(err, domain.ErrInvalidCredentials) {
 		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
 	}
 }
@@ -70,18 +84,76 @@ func TestChangePasswordInvalidCurrent(t *testing.T) {
 func TestChangePasswordWeak(t *testing.T) {
 	userID := domain.NewUserID()
 	repo := &stubIdentityRepo{identity: domain.Identity{UserID: userID, Provider: "email", SecretHash: "hashed:old"}, found: true}
-	uc := NewChange(repo, stubPasswordHasher{})
+	uc := NewChange(repo, stubPasswordHasher{}, &stubRefreshRepo{}, nil, 0)
 
-	if _, err := uc.Execute(context.Background(), ChangeInput{UserID: userID.String(), CurrentPassword: "old", NewPassword: "weak"}); !errors.Is(err, domain.ErrWeakPassword) {
+	if _, err := uc.Execute(context.Background(), ChangeInput{UserID: userID.String(), CurrentPassword: "old", NewPassword: "weak", AuthTime: time.Now()}); !errors.Is(err, domain.ErrWeakPassword) {
 		t.Fatalf("expected ErrWeakPassword, got %v", err)
 	}
 }
 
+func TestChangePasswordRequiresRecentAuth(t *testing.T) {
+	userID := domain.NewUserID()
+	repo := &stubIdentityRepo{identity: domain.Identity{UserID: userID, Provider: "email", SecretHash: "hashed:old"}, found: true}
+	uc := NewChange(repo, stubPasswordHasher{}, &stubRefreshRepo{}, nil, time.Minute)
+
+	in := ChangeInput{UserID: userID.String(), CurrentPassword: "old", NewPassword: "newpassword", AuthTime: time.Now().Add(-2 * time.Minute)}
+	if _, err := uc.Execute(context.Background(), in); !errors.Is(err, domain.ErrReauthenticationRequired) {
+		t.Fatalf("expected ErrReauthenticationRequired, got %v", err)
+	}
+	if repo.updated.SecretHash != "" {
+		t.Fatal("password must not change without recent authentication")
+	}
+}
+
 func TestChangePasswordUnauthorized(t *testing.T) {
 	repo := &stubIdentityRepo{found: false}
-	uc := NewChange(repo, stubPasswordHasher{})
+	uc := NewChange(repo, stubPasswordHasher{}, &stubRefreshRepo{}, nil, 0)
 
 	if _, err := uc.Execute(context.Background(), ChangeInput{UserID: " ", CurrentPassword: "old", NewPassword: "newpassword"}); !errors.Is(err, domain.ErrUnauthorized) {
 		t.Fatalf("expected ErrUnauthorized, got %v", err)
 	}
 }
+
+type stubRefreshRepo struct {
+	revoked []string
+	kept    []string
+}
+
+func (s *stubRefreshRepo) Create(context.Context, domain.RefreshToken) error { return nil }
+func (s *stubRefreshRepo) Update(context.Context, domain.RefreshToken) error { return nil }
+func (s *stubRefreshRepo) GetByHash(context.Context, string) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *stubRefreshRepo) GetByID(context.Context, string) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *stubRefreshRepo) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
+	return nil, nil
+}
+func (s *stubRefreshRepo) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
+	return nil, nil
+}
+func (s *stubRefreshRepo) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *stubRefreshRepo) Revoke(context.Context, string) error { return nil }
+func (s *stubRefreshRepo) RevokeAllExcept(_ context.Context, _ domain.UserID, keep []string) ([]string, error) {
+	s.kept = keep
+	return s.revoked, nil
+}
+
+type stubPublisher struct {
+	common.NopEventPublisher
+	revoked []events.SessionRevoked
+	changed events.PasswordChanged
+}
+
+func (s *stubPublisher) PublishSessionRevoked(_ context.Context, evt events.SessionRevoked) error {
+	s.revoked = append(s.revoked, evt)
+	return nil
+}
+
+func (s *stubPublisher) PublishPasswordChanged(_ context.Context, evt events.PasswordChanged) error {
+	s.changed = evt
+	return nil
+}
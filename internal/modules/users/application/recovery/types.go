@@ -0,0 +1,32 @@
+package recovery
+
+import "time"
+
+type StartInput struct {
+	Email string
+}
+
+type ConfirmInput struct {
+	ChallengeID string
+	Code        string
+}
+
+type CancelInput struct {
+	ChallengeID string
+	Token       string
+}
+
+type CompleteInput struct {
+	ChallengeID string
+}
+
+// Output describes the recovery challenge. ReadyAt is set once the email
+// has been proven and the waiting period is running.
+type Output struct {
+	ChallengeID  string
+	Status       string
+	ExpiresIn    int64
+	AttemptsLeft int
+	LockUntil    *time.Time
+	ReadyAt      *time.Time
+}
@@ -0,0 +1,365 @@
+package recovery
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	challengeapp "github.com/vaaxooo/xbackend/internal/modules/users/application/challenge"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// Statuses reported while a recovery challenge is pending.
+const (
+	StatusEmailRequired = "email_required"
+	StatusWaiting       = "waiting"
+	StatusReady         = "ready"
+)
+
+// UseCase lets an owner who lost their second factor get it reset: they
+// prove the account email, wait out a delay during which the owner can
+// cancel, and then TOTP is cleared and every session and personal access
+// token is revoked. The flow is
+// an account_recovery challenge whose steps are email_otp and recovery_delay.
+type UseCase struct {
+	identities domain.IdentityRepository
+	challenges domain.ChallengeRepository
+	tokens     domain.VerificationTokenRepository
+	codes      domain.VerificationCodeHasher
+	refresh    domain.RefreshTokenRepository
+	pats       domain.PersonalAccessTokenRepository
+	devices    domain.TrustedDeviceRepository
+	events     common.EventPublisher
+
+	// step checks the emailed code like the email_otp step of a login.
+	step      challengeapp.Step
+	codeTTL   time.Duration
+	delay     time.Duration
+	window    time.Duration
+	cancelURL string
+}
+
+// New builds the recovery flow. delay is the waiting period after the email
+// is proven; window is how long after that the reset can still be completed.
+// cancelURL, if set, is the page the cancel link in the notification opens;
+// challenge_id and token are added to its query.
+func New(identities domain.IdentityRepository, challenges domain.ChallengeRepository, tokens domain.VerificationTokenRepository, codes domain.VerificationCodeHasher, refresh domain.RefreshTokenRepository, pats domain.PersonalAccessTokenRepository, devices domain.TrustedDeviceRepository, publisher common.EventPublisher, codeTTL, delay, window time.Duration, attempts int, lock time.Duration, cancelURL string) *UseCase {
+	if codeTTL == 0 {
+		codeTTL = 15 * time.Minute
+	}
+	if delay == 0 {
+		delay = 72 * time.Hour
+	}
+	if window == 0 {
+		window = 7 * 24 * time.Hour
+	}
+	if attempts <= 0 {
+		attempts = 3
+	}
+	if lock == 0 {
+		lock = 5 * time.Minute
+	}
+	return &UseCase{
+		identities: identities,
+		challenges: challenges,
+		tokens:     tokens,
+		codes:      codes,
+		refresh:    refresh,
+		pats:       pats,
+		devices:    devices,
+		events:     publisher,
+		step: challengeapp.Step{
+			Handler: challengeapp.NewCodeStep(identities, tokens, codes, domain.TokenTypeRecovery),
+			Policy:  challengeapp.StepPolicy{Attempts: attempts, Lock: lock},
+		},
+		codeTTL:   codeTTL,
+		delay:     delay,
+		window:    window,
+		cancelURL: cancelURL,
+	}
+}
+
+// Start opens a recovery challenge and mails a code to the account email.
+// Anyone can call it, so it answers the same whether or not the account
+// exists and has a second factor: otherwise the challenge has no user, no
+// code is sent and no code answers it. Within a minute of the last code no
+// new one is sent; the earlier code answers the new challenge as well.
+func (uc *UseCase) Start(ctx context.Context, in StartInput) (Output, error) {
+	email, err := domain.NewEmail(in.Email)
+	if err != nil {
+		return Output{}, domain.ErrInvalidCredentials
+	}
+	ident, found, err := uc.identities.GetByProvider(ctx, email.Provider(), email.String())
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	var userID domain.UserID
+	if found && ident.IsTwoFactorEnabled() {
+		userID = ident.UserID
+	}
+
+	now := time.Now().UTC()
+	challenge := domain.NewChallenge(userID, domain.ChallengeTypeRecovery, []domain.ChallengeStep{
+		domain.ChallengeStepEmailOTP,
+		domain.ChallengeStepRecoveryDelay,
+	}, now.Add(uc.codeTTL))
+	if err := uc.challenges.Create(ctx, challenge); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if userID == "" {
+		return uc.output(challenge, now), nil
+	}
+	latest, found, err := uc.tokens.GetLatest(ctx, ident.ID, domain.TokenTypeRecovery)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if found && now.Sub(latest.CreatedAt) < time.Minute {
+		return uc.output(challenge, now), nil
+	}
+
+	code, err := domain.GenerateNumericCode(6)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	token := domain.NewVerificationToken(ident.ID, domain.TokenTypeRecovery, uc.codes.Hash(code), now, uc.codeTTL)
+	if err := uc.tokens.Create(ctx, token); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if err := uc.events.PublishAccountRecoveryRequested(ctx, events.AccountRecoveryRequested{
+		UserID:      ident.UserID.String(),
+		IdentityID:  ident.ID,
+		ChallengeID: challenge.ID,
+		Email:       ident.ProviderUserID,
+		Code:        code,
+		ExpiresAt:   token.ExpiresAt,
+		OccurredAt:  now,
+	}); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	return uc.output(challenge, now), nil
+}
+
+// Confirm checks the emailed code. A correct code starts the waiting period
+// and notifies the owner with a link to cancel it.
+func (uc *UseCase) Confirm(ctx context.Context, in ConfirmInput) (Output, error) {
+	challenge, err := uc.load(ctx, in.ChallengeID)
+	if err != nil {
+		return Output{}, err
+	}
+	now := time.Now().UTC()
+	if challenge.Status != domain.ChallengeStatusPending || challenge.IsExpired(now) || !challenge.NeedsStep(domain.ChallengeStepEmailOTP) {
+		return uc.output(challenge, now), nil
+	}
+	step := uc.step
+	if challenge.UserID == "" {
+		// Started for an account that cannot be recovered: every code is
+		// wrong, and counted like one.
+		step.Handler = noCode{}
+	}
+	challenge, passed, err := step.Attempt(ctx, challenge, domain.ChallengeStepEmailOTP, in.Code, now)
+	if err != nil {
+		return Output{}, err
+	}
+	if !passed {
+		if err := uc.challenges.Update(ctx, challenge); err != nil {
+			return Output{}, common.NormalizeError(err)
+		}
+		return uc.output(challenge, now), nil
+	}
+
+	ident, err := uc.emailIdentity(ctx, challenge.UserID)
+	if err != nil {
+		return Output{}, err
+	}
+	readyAt := now.Add(uc.delay)
+	challenge = challenge.WithStepState(domain.ChallengeStepRecoveryDelay, domain.StepState{LockUntil: &readyAt}, now)
+	challenge.ExpiresAt = readyAt.Add(uc.window)
+
+	cancelToken, err := domain.GenerateSecretToken()
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	cancel := domain.NewVerificationToken(ident.ID, domain.TokenTypeRecoveryCancel, uc.codes.Hash(cancelToken), now, challenge.ExpiresAt.Sub(now))
+	if err := uc.tokens.Create(ctx, cancel); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if err := uc.challenges.Update(ctx, challenge); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+
+	meta, _ := common.RequestMetaFromContext(ctx)
+	if err := uc.events.PublishAccountRecoveryScheduled(ctx, events.AccountRecoveryScheduled{
+		UserID:      ident.UserID.String(),
+		IdentityID:  ident.ID,
+		ChallengeID: challenge.ID,
+		Email:       ident.ProviderUserID,
+		CancelToken: cancelToken,
+		CancelURL:   uc.cancelLink(challenge.ID, cancelToken),
+		IP:          meta.IP,
+		UserAgent:   meta.UserAgent,
+		Country:     meta.Country,
+		City:        meta.City,
+		ReadyAt:     readyAt,
+		OccurredAt:  now,
+	}); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	return uc.output(challenge, now), nil
+}
+
+// Cancel stops a pending recovery with the token from the notification.
+// Cancelling twice is not an error.
+func (uc *UseCase) Cancel(ctx context.Context, in CancelInput) error {
+	challenge, err := uc.load(ctx, in.ChallengeID)
+	if err != nil {
+		return err
+	}
+	if challenge.Status == domain.ChallengeStatusCancelled {
+		return nil
+	}
+	if challenge.Status != domain.ChallengeStatusPending {
+		return domain.ErrUnauthorized
+	}
+	ident, err := uc.emailIdentity(ctx, challenge.UserID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	tokenHash := uc.codes.Hash(in.Token)
+	token, found, err := uc.tokens.GetByCode(ctx, ident.ID, domain.TokenTypeRecoveryCancel, tokenHash)
+	if err != nil {
+		return common.NormalizeError(err)
+	}
+	if !found || !token.IsValid(tokenHash, now) {
+		return domain.ErrUnauthorized
+	}
+	if err := uc.tokens.MarkUsed(ctx, token.ID, now); err != nil {
+		return common.NormalizeError(err)
+	}
+	return common.NormalizeError(uc.challenges.Update(ctx, challenge.WithStatus(domain.ChallengeStatusCancelled, now)))
+}
+
+// Complete resets the second factor once the waiting period is over: TOTP
+// is cleared, and trusted devices, all sessions and personal access tokens
+// are revoked. The user then signs in with the password alone.
+func (uc *UseCase) Complete(ctx context.Context, in CompleteInput) (Output, error) {
+	challenge, err := uc.load(ctx, in.ChallengeID)
+	if err != nil {
+		return Output{}, err
+	}
+	now := time.Now().UTC()
+	if challenge.Status != domain.ChallengeStatusPending || challenge.IsExpired(now) {
+		return uc.output(challenge, now), nil
+	}
+	readyAt := challenge.RecoveryReadyAt()
+	if challenge.NeedsStep(domain.ChallengeStepEmailOTP) || readyAt == nil || now.Before(*readyAt) {
+		return Output{}, domain.ErrRecoveryNotReady
+	}
+
+	ident, err := uc.emailIdentity(ctx, challenge.UserID)
+	if err != nil {
+		return Output{}, err
+	}
+	if err := uc.identities.Update(ctx, ident.ClearTOTP()); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	revoked, err := uc.refresh.RevokeAllExcept(ctx, challenge.UserID, nil)
+	if err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if err := common.PublishSessionsRevoked(ctx, uc.events, challenge.UserID, revoked, events.SessionRevokedRecovery, now); err != nil {
+		return Output{}, err
+	}
+	if err := uc.pats.RevokeByUser(ctx, challenge.UserID); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if err := common.RevokeTrustedDevices(ctx, uc.devices, challenge.UserID, now); err != nil {
+		return Output{}, err
+	}
+
+	challenge = challenge.WithCompleted(domain.ChallengeStepRecoveryDelay, now)
+	if err := uc.challenges.Update(ctx, challenge); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	if err := uc.events.PublishAccountRecoveryCompleted(ctx, events.AccountRecoveryCompleted{
+		UserID:      ident.UserID.String(),
+		IdentityID:  ident.ID,
+		ChallengeID: challenge.ID,
+		Email:       ident.ProviderUserID,
+		OccurredAt:  now,
+	}); err != nil {
+		return Output{}, common.NormalizeError(err)
+	}
+	return uc.output(challenge, now), nil
+}
+
+type noCode struct{}
+
+func (noCode) Verify(context.Context, challengeapp.StepRequest) (bool, error) {
+	return false, nil
+}
+
+func (uc *UseCase) load(ctx context.Context, id string) (domain.Challenge, error) {
+	challenge, found, err := uc.challenges.GetByID(ctx, id)
+	if err != nil || !found || challenge.Type != domain.ChallengeTypeRecovery {
+		return domain.Challenge{}, domain.ErrUnauthorized
+	}
+	return challenge, nil
+}
+
+func (uc *UseCase) emailIdentity(ctx context.Context, userID domain.UserID) (domain.Identity, error) {
+	ident, found, err := uc.identities.GetByUserAndProvider(ctx, userID, "email")
+	if err != nil {
+		return domain.Identity{}, common.NormalizeError(err)
+	}
+	if !found {
+		return domain.Identity{}, domain.ErrUnauthorized
+	}
+	return ident, nil
+}
+
+func (uc *UseCase) cancelLink(challengeID, token string) string {
+	if uc.cancelURL == "" {
+		return ""
+	}
+	link, err := url.Parse(uc.cancelURL)
+	if err != nil {
+		return ""
+	}
+	q := link.Query()
+	q.Set("challenge_id", challengeID)
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+	return link.String()
+}
+
+func (uc *UseCase) output(challenge domain.Challenge, now time.Time) Output {
+	out := Output{
+		ChallengeID: challenge.ID,
+		Status:      string(challenge.Status),
+		ReadyAt:     challenge.RecoveryReadyAt(),
+	}
+	if state, ok := challenge.StepState(domain.ChallengeStepEmailOTP); ok {
+		out.AttemptsLeft = state.AttemptsLeft
+		out.LockUntil = state.LockUntil
+	}
+	if challenge.Status != domain.ChallengeStatusPending {
+		return out
+	}
+	if challenge.IsExpired(now) {
+		out.Status = string(domain.ChallengeStatusExpired)
+		return out
+	}
+	out.ExpiresIn = int64(challenge.ExpiresAt.Sub(now).Seconds())
+	switch {
+	case challenge.NeedsStep(domain.ChallengeStepEmailOTP):
+		out.Status = StatusEmailRequired
+	case out.ReadyAt != nil && now.Before(*out.ReadyAt):
+		out.Status = StatusWaiting
+	default:
+		out.Status = StatusReady
+	}
+	return out
+}
@@ -0,0 +1,320 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestRecoveryResetsTwoFactorAfterDelay(t *testing.T) {
+	ident := totpIdentity()
+	identities := &identityRepoStub{identity: ident}
+	challenges := &challengeRepoStub{}
+	refresh := &refreshRepoStub{}
+	devices := &deviceRepoStub{devices: []domain.TrustedDevice{domain.NewTrustedDevice(ident.UserID, "hash", time.Now().UTC(), time.Hour)}}
+	publisher := &publisherStub{}
+	pats := &accessTokenRepoStub{}
+	uc := New(identities, challenges, &tokenRepoStub{}, codeHasherStub{}, refresh, pats, devices, publisher, time.Minute, time.Hour, time.Hour, 3, time.Minute, "https://app.example.com/recovery/cancel")
+
+	out, err := uc.Start(context.Background(), StartInput{Email: ident.ProviderUserID})
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if out.Status != StatusEmailRequired || challenges.challenge.Type != domain.ChallengeTypeRecovery {
+		t.Fatalf("expected a recovery challenge waiting for the email code, got %+v", out)
+	}
+
+	out, err = uc.Confirm(context.Background(), ConfirmInput{ChallengeID: out.ChallengeID, Code: "000000"})
+	if err != nil || out.Status != StatusEmailRequired || out.AttemptsLeft != 2 {
+		t.Fatalf("expected a counted wrong code, got %+v, %v", out, err)
+	}
+	out, err = uc.Confirm(context.Background(), ConfirmInput{ChallengeID: out.ChallengeID, Code: publisher.requested.Code})
+	if err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	if out.Status != StatusWaiting || out.ReadyAt == nil {
+		t.Fatalf("expected the waiting period to start, got %+v", out)
+	}
+	link, err := url.Parse(publisher.scheduled.CancelURL)
+	if err != nil || link.Query().Get("challenge_id") != out.ChallengeID || link.Query().Get("token") != publisher.scheduled.CancelToken {
+		t.Fatalf("expected a cancel link with challenge and token, got %q", publisher.scheduled.CancelURL)
+	}
+
+	if _, err := uc.Complete(context.Background(), CompleteInput{ChallengeID: out.ChallengeID}); !errors.Is(err, domain.ErrRecoveryNotReady) {
+		t.Fatalf("expected recovery to wait for the delay, got %v", err)
+	}
+	if identities.updated.TOTPSecret == "" && identities.updated.ID != "" {
+		t.Fatal("TOTP must not be reset before the delay")
+	}
+
+	past := time.Now().UTC().Add(-time.Second)
+	challenges.challenge = challenges.challenge.WithStepState(domain.ChallengeStepRecoveryDelay, domain.StepState{LockUntil: &past}, past)
+	out, err = uc.Complete(context.Background(), CompleteInput{ChallengeID: out.ChallengeID})
+	if err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if out.Status != string(domain.ChallengeStatusCompleted) {
+		t.Fatalf("expected completed recovery, got %+v", out)
+	}
+	if identities.updated.IsTwoFactorEnabled() {
+		t.Fatal("expected TOTP to be cleared")
+	}
+	if !refresh.revokedAll {
+		t.Fatal("expected all sessions to be revoked")
+	}
+	if pats.revokedFor != ident.UserID {
+		t.Fatalf("expected the personal access tokens to be revoked, got %q", pats.revokedFor)
+	}
+	if len(publisher.revoked) != 1 || publisher.revoked[0].SessionID != "session-1" || publisher.revoked[0].Reason != events.SessionRevokedRecovery {
+		t.Fatalf("expected a revocation event, got %+v", publisher.revoked)
+	}
+	if len(devices.revoked) != 1 {
+		t.Fatalf("expected trusted devices to be revoked, got %v", devices.revoked)
+	}
+	if publisher.completed.ChallengeID != out.ChallengeID {
+		t.Fatalf("expected a completion event, got %+v", publisher.completed)
+	}
+}
+
+func TestRecoveryCancelStopsReset(t *testing.T) {
+	ident := totpIdentity()
+	identities := &identityRepoStub{identity: ident}
+	challenges := &challengeRepoStub{}
+	refresh := &refreshRepoStub{}
+	publisher := &publisherStub{}
+	pats := &accessTokenRepoStub{}
+	uc := New(identities, challenges, &tokenRepoStub{}, codeHasherStub{}, refresh, pats, nil, publisher, time.Minute, time.Hour, time.Hour, 3, time.Minute, "")
+
+	out, err := uc.Start(context.Background(), StartInput{Email: ident.ProviderUserID})
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if _, err := uc.Confirm(context.Background(), ConfirmInput{ChallengeID: out.ChallengeID, Code: publisher.requested.Code}); err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	if publisher.scheduled.CancelURL != "" || publisher.scheduled.CancelToken == "" {
+		t.Fatalf("expected only a cancel token without a configured URL, got %+v", publisher.scheduled)
+	}
+
+	if err := uc.Cancel(context.Background(), CancelInput{ChallengeID: out.ChallengeID, Token: "wrong"}); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected a wrong cancel token to be rejected, got %v", err)
+	}
+	if err := uc.Cancel(context.Background(), CancelInput{ChallengeID: out.ChallengeID, Token: publisher.scheduled.CancelToken}); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+
+	past := time.Now().UTC().Add(-time.Second)
+	challenges.challenge = challenges.challenge.WithStepState(domain.ChallengeStepRecoveryDelay, domain.StepState{LockUntil: &past}, past)
+	out, err = uc.Complete(context.Background(), CompleteInput{ChallengeID: out.ChallengeID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Status != string(domain.ChallengeStatusCancelled) || refresh.revokedAll || pats.revokedFor != "" || identities.updated.ID != "" {
+		t.Fatalf("expected a cancelled recovery to change nothing, got %+v", out)
+	}
+}
+
+func TestRecoveryStartDoesNotRevealAccounts(t *testing.T) {
+	ident := totpIdentity().ClearTOTP()
+	for _, email := range []string{ident.ProviderUserID, "nobody@example.com"} {
+		challenges := &challengeRepoStub{}
+		tokens := &tokenRepoStub{}
+		publisher := &publisherStub{}
+		uc := New(&identityRepoStub{identity: ident}, challenges, tokens, codeHasherStub{}, &refreshRepoStub{}, &accessTokenRepoStub{}, nil, publisher, 0, 0, 0, 0, 0, "")
+
+		out, err := uc.Start(context.Background(), StartInput{Email: email})
+		if err != nil || out.Status != StatusEmailRequired || out.ChallengeID == "" {
+			t.Fatalf("%s: expected the usual answer, got %+v, %v", email, out, err)
+		}
+		if len(tokens.tokens) != 0 || publisher.requested.Code != "" {
+			t.Fatalf("%s: expected no code to be sent", email)
+		}
+		out, err = uc.Confirm(context.Background(), ConfirmInput{ChallengeID: out.ChallengeID, Code: "000000"})
+		if err != nil || out.Status != StatusEmailRequired || out.AttemptsLeft != 2 {
+			t.Fatalf("%s: expected a counted wrong code, got %+v, %v", email, out, err)
+		}
+	}
+}
+
+func totpIdentity() domain.Identity {
+	return domain.Identity{ID: "identity", UserID: domain.NewUserID(), Provider: "email", ProviderUserID: "user@example.com"}.
+		WithTOTPSecret("SECRET").
+		WithTOTPConfirmed(time.Now().UTC())
+}
+
+// --- test doubles ---
+
+type identityRepoStub struct {
+	identity domain.Identity
+	updated  domain.Identity
+}
+
+func (s *identityRepoStub) Create(context.Context, domain.Identity) error { return nil }
+func (s *identityRepoStub) GetByProvider(_ context.Context, provider, providerUserID string) (domain.Identity, bool, error) {
+	if s.identity.Provider == provider && s.identity.ProviderUserID == providerUserID {
+		return s.identity, true, nil
+	}
+	return domain.Identity{}, false, nil
+}
+func (s *identityRepoStub) GetByUserAndProvider(context.Context, domain.UserID, string) (domain.Identity, bool, error) {
+	return s.identity, true, nil
+}
+func (s *identityRepoStub) Update(_ context.Context, identity domain.Identity) error {
+	s.updated = identity
+	s.identity = identity
+	return nil
+}
+
+type challengeRepoStub struct {
+	challenge domain.Challenge
+}
+
+func (s *challengeRepoStub) Create(_ context.Context, challenge domain.Challenge) error {
+	s.challenge = challenge
+	return nil
+}
+func (s *challengeRepoStub) Update(_ context.Context, challenge domain.Challenge) error {
+	s.challenge = challenge
+	return nil
+}
+func (s *challengeRepoStub) GetByID(_ context.Context, id string) (domain.Challenge, bool, error) {
+	if s.challenge.ID == id {
+		return s.challenge, true, nil
+	}
+	return domain.Challenge{}, false, nil
+}
+func (s *challengeRepoStub) GetPendingByUser(context.Context, domain.UserID) (domain.Challenge, bool, error) {
+	return domain.Challenge{}, false, nil
+}
+
+type tokenRepoStub struct {
+	tokens []domain.VerificationToken
+}
+
+func (s *tokenRepoStub) Create(_ context.Context, token domain.VerificationToken) error {
+	s.tokens = append(s.tokens, token)
+	return nil
+}
+func (s *tokenRepoStub) GetLatest(context.Context, string, domain.TokenType) (domain.VerificationToken, bool, error) {
+	return domain.VerificationToken{}, false, nil
+}
+func (s *tokenRepoStub) GetByCode(_ context.Context, identityID string, tokenType domain.TokenType, codeHash string) (domain.VerificationToken, bool, error) {
+	for _, token := range s.tokens {
+		if token.IdentityID == identityID && token.Type == tokenType && token.MatchesHash(codeHash) {
+			return token, true, nil
+		}
+	}
+	return domain.VerificationToken{}, false, nil
+}
+func (s *tokenRepoStub) MarkUsed(_ context.Context, id string, usedAt time.Time) error {
+	for i, token := range s.tokens {
+		if token.ID == id {
+			s.tokens[i] = token.MarkUsed(usedAt)
+		}
+	}
+	return nil
+}
+
+type codeHasherStub struct{}
+
+func (codeHasherStub) Hash(raw string) string { return "hashed:" + raw }
+
+type accessTokenRepoStub struct {
+	revokedFor domain.UserID
+}
+
+func (s *accessTokenRepoStub) Create(context.Context, domain.PersonalAccessToken) error { return nil }
+func (s *accessTokenRepoStub) GetByHash(context.Context, string) (domain.PersonalAccessToken, bool, error) {
+	return domain.PersonalAccessToken{}, false, nil
+}
+func (s *accessTokenRepoStub) GetByID(context.Context, string) (domain.PersonalAccessToken, bool, error) {
+	return domain.PersonalAccessToken{}, false, nil
+}
+func (s *accessTokenRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.PersonalAccessToken, error) {
+	return nil, nil
+}
+func (s *accessTokenRepoStub) Touch(context.Context, string, time.Time) error { return nil }
+func (s *accessTokenRepoStub) Revoke(context.Context, string) error           { return nil }
+func (s *accessTokenRepoStub) RevokeByUser(_ context.Context, userID domain.UserID) error {
+	s.revokedFor = userID
+	return nil
+}
+
+type refreshRepoStub struct {
+	revokedAll bool
+}
+
+func (s *refreshRepoStub) Create(context.Context, domain.RefreshToken) error { return nil }
+func (s *refreshRepoStub) Update(context.Context, domain.RefreshToken) error { return nil }
+func (s *refreshRepoStub) GetByHash(context.Context, string) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *refreshRepoStub) GetByID(context.Context, string) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *refreshRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
+	return nil, nil
+}
+func (s *refreshRepoStub) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
+	return nil, nil
+}
+func (s *refreshRepoStub) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *refreshRepoStub) Revoke(context.Context, string) error { return nil }
+func (s *refreshRepoStub) RevokeAllExcept(_ context.Context, _ domain.UserID, keep []string) ([]string, error) {
+	s.revokedAll = len(keep) == 0
+	return []string{"session-1"}, nil
+}
+
+type deviceRepoStub struct {
+	devices []domain.TrustedDevice
+	revoked []string
+}
+
+func (s *deviceRepoStub) Create(context.Context, domain.TrustedDevice) error { return nil }
+func (s *deviceRepoStub) GetByHash(context.Context, domain.UserID, string) (domain.TrustedDevice, bool, error) {
+	return domain.TrustedDevice{}, false, nil
+}
+func (s *deviceRepoStub) GetByID(context.Context, string) (domain.TrustedDevice, bool, error) {
+	return domain.TrustedDevice{}, false, nil
+}
+func (s *deviceRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.TrustedDevice, error) {
+	return s.devices, nil
+}
+func (s *deviceRepoStub) Touch(context.Context, string, time.Time) error { return nil }
+func (s *deviceRepoStub) Revoke(_ context.Context, id string) error {
+	s.revoked = append(s.revoked, id)
+	return nil
+}
+
+type publisherStub struct {
+	common.NopEventPublisher
+	requested events.AccountRecoveryRequested
+	scheduled events.AccountRecoveryScheduled
+	completed events.AccountRecoveryCompleted
+	revoked   []events.SessionRevoked
+}
+
+func (s *publisherStub) PublishAccountRecoveryRequested(_ context.Context, evt events.AccountRecoveryRequested) error {
+	s.requested = evt
+	return nil
+}
+func (s *publisherStub) PublishAccountRecoveryScheduled(_ context.Context, evt events.AccountRecoveryScheduled) error {
+	s.scheduled = evt
+	return nil
+}
+func (s *publisherStub) PublishAccountRecoveryCompleted(_ context.Context, evt events.AccountRecoveryCompleted) error {
+	s.completed = evt
+	return nil
+}
+func (s *publisherStub) PublishSessionRevoked(_ context.Context, evt events.SessionRevoked) error {
+	s.revoked = append(s.revoked, evt)
+	return nil
+}
@@ -1,9 +1,18 @@
 package refresh
 
+import "time"
+
 type Input struct {
 	RefreshToken string
 }
+
+// Output carries the rotated tokens. RefreshExpiresAt is when the new
+// refresh token lapses if it is not used; ReloginAt is when the session
+// ends regardless and the user has to sign in again (nil when it never
+// does).
 type Output struct {
-	AccessToken  string
-	RefreshToken string
+	AccessToken      string
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	ReloginAt        *time.Time
 }
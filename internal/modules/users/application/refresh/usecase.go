@@ -10,29 +10,37 @@ import (
 
 type UseCase struct {
 	refreshRepo domain.RefreshTokenRepository
+	// epochs may be nil, in which case sessions are not checked against
+	// token epochs.
+	epochs domain.TokenEpochRepository
+	// grants may be nil, in which case no session is taken for one granted
+	// to an OAuth client. Otherwise refreshed tokens of sessions granted
+	// with scopes keep to those scopes, as the code exchange issued them.
+	grants domain.OAuthGrantRepository
 
-	access     common.AccessTokenIssuer
-	accessTTL  time.Duration
-	refreshTTL time.Duration
+	access        common.AccessTokenIssuer
+	accessTTL     time.Duration
+	sessionPolicy common.SessionPolicy
 }
 
 func New(
 	refreshRepo domain.RefreshTokenRepository,
+	epochs domain.TokenEpochRepository,
+	grants domain.OAuthGrantRepository,
 	access common.AccessTokenIssuer,
 	accessTTL time.Duration,
-	refreshTTL time.Duration,
+	sessionPolicy common.SessionPolicy,
 ) *UseCase {
 	if accessTTL == 0 {
 		accessTTL = 15 * time.Minute
 	}
-	if refreshTTL == 0 {
-		refreshTTL = 30 * 24 * time.Hour
-	}
 	return &UseCase{
-		refreshRepo: refreshRepo,
-		access:      access,
-		accessTTL:   accessTTL,
-		refreshTTL:  refreshTTL,
+		refreshRepo:   refreshRepo,
+		epochs:        epochs,
+		grants:        grants,
+		access:        access,
+		accessTTL:     accessTTL,
+		sessionPolicy: sessionPolicy,
 	}
 }
 
@@ -53,21 +61,39 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (Output, error) {
 		}
 		return Output{}, domain.ErrRefreshTokenInvalid
 	}
+	if uc.epochs != nil {
+		notBefore, err := uc.epochs.NotBefore(ctx, stored.UserID)
+		if err != nil {
+			return Output{}, common.NormalizeError(err)
+		}
+		// Sessions started before the epoch end for good, like revoked ones.
+		if stored.CreatedAt.Before(notBefore) {
+			_ = uc.refreshRepo.Revoke(ctx, stored.ID)
+			return Output{}, domain.ErrRefreshTokenInvalid
+		}
+	}
 
 	newRefresh, err := common.NewRefreshToken()
 	if err != nil {
 		return Output{}, common.NormalizeError(err)
 	}
 	newHash := common.HashToken(newRefresh)
-	refreshRecord := common.NewRefreshRecord(ctx, stored.UserID, newHash, now, uc.refreshTTL)
-	refreshRecord.ID = stored.ID
-	if refreshRecord.UserAgent == "" {
-		refreshRecord.UserAgent = stored.UserAgent
+	meta, _ := common.RequestMetaFromContext(ctx)
+	lifetime := uc.sessionPolicy.For(stored.ClientType)
+	if stored.AbsoluteExpiresAt.IsZero() && lifetime.AbsoluteLifetime > 0 {
+		// Sessions from before absolute lifetimes count from their creation.
+		stored = stored.WithAbsoluteExpiry(stored.CreatedAt.Add(lifetime.AbsoluteLifetime))
+		if !stored.IsValid(now) {
+			_ = uc.refreshRepo.Revoke(ctx, stored.ID)
+			return Output{}, domain.ErrRefreshTokenInvalid
+		}
 	}
-	if refreshRecord.IP == "" {
-		refreshRecord.IP = stored.IP
+	refreshRecord := stored.Rotate(newHash, now, lifetime.IdleTimeout, meta.IP)
+	claims, err := uc.claims(ctx, refreshRecord)
+	if err != nil {
+		return Output{}, err
 	}
-	accessToken, err := uc.access.Issue(stored.UserID.String(), refreshRecord.ID, uc.accessTTL)
+	accessToken, err := uc.access.Issue(claims, uc.accessTTL)
 	if err != nil {
 		return Output{}, common.NormalizeError(err)
 	}
@@ -75,8 +101,30 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (Output, error) {
 		return Output{}, common.NormalizeError(err)
 	}
 
-	return Output{
-		AccessToken:  accessToken,
-		RefreshToken: newRefresh,
-	}, nil
+	out := Output{
+		AccessToken:      accessToken,
+		RefreshToken:     newRefresh,
+		RefreshExpiresAt: refreshRecord.ExpiresAt,
+	}
+	if !refreshRecord.AbsoluteExpiresAt.IsZero() {
+		reloginAt := refreshRecord.AbsoluteExpiresAt
+		out.ReloginAt = &reloginAt
+	}
+	return out, nil
+}
+
+// claims returns the claims of the session's access token; sessions granted
+// to a client with scopes are limited to them.
+func (uc *UseCase) claims(ctx context.Context, session domain.RefreshToken) (common.AccessClaims, error) {
+	if uc.grants == nil {
+		return common.SessionClaims(session), nil
+	}
+	grant, found, err := uc.grants.GetBySession(ctx, session.ID)
+	if err != nil {
+		return common.AccessClaims{}, common.NormalizeError(err)
+	}
+	if !found || len(grant.Scopes) == 0 {
+		return common.SessionClaims(session), nil
+	}
+	return common.GrantClaims(session, grant), nil
 }
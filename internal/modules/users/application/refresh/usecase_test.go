@@ -50,6 +50,9 @@ func (m *refreshRepoMock) GetByID(_ context.Context, id string) (domain.RefreshT
 func (m *refreshRepoMock) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
 	return []domain.RefreshToken{m.stored}, m.err
 }
+func (m *refreshRepoMock) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
+	return []domain.RefreshToken{m.stored}, m.err
+}
 
 func (m *refreshRepoMock) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
 	return domain.RefreshToken{}, false, m.err
@@ -60,19 +63,25 @@ func (m *refreshRepoMock) Revoke(_ context.Context, id string) error {
 	return m.err
 }
 
-func (m *refreshRepoMock) RevokeAllExcept(context.Context, domain.UserID, []string) error {
-	return m.err
+func (m *refreshRepoMock) RevokeAllExcept(context.Context, domain.UserID, []string) ([]string, error) {
+	return nil, m.err
 }
 
-type refreshIssuerMock struct{ token string }
+type refreshIssuerMock struct {
+	token  string
+	claims common.AccessClaims
+}
 
-func (m *refreshIssuerMock) Issue(_, _ string, _ time.Duration) (string, error) { return m.token, nil }
+func (m *refreshIssuerMock) Issue(claims common.AccessClaims, _ time.Duration) (string, error) {
+	m.claims = claims
+	return m.token, nil
+}
 
 func TestRefreshSuccess(t *testing.T) {
 	now := time.Now().UTC()
 	repo := &refreshRepoMock{stored: domain.RefreshToken{ID: "id", UserID: "user", TokenHash: common.HashToken("old"), ExpiresAt: now.Add(time.Hour)}, found: true}
 	uow := &refreshUnitOfWorkMock{}
-	uc := common.NewTransactionalUseCase(uow, New(repo, &refreshIssuerMock{token: "access"}, time.Minute, time.Hour))
+	uc := common.NewTransactionalUseCase(uow, New(repo, nil, nil, &refreshIssuerMock{token: "access"}, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}))
 
 	out, err := uc.Execute(context.Background(), Input{RefreshToken: "old"})
 	if err != nil {
@@ -86,16 +95,42 @@ func TestRefreshSuccess(t *testing.T) {
 	}
 }
 
+func TestRefreshKeepsSessionDetails(t *testing.T) {
+	created := time.Now().UTC().Add(-time.Hour)
+	stored := domain.NewRefreshTokenRecord("user", common.HashToken("old"), created, 2*time.Hour)
+	stored.UserAgent = "agent"
+	stored.IP = "1.1.1.1"
+	stored.LoginMethod = domain.LoginMethodPassword
+	stored.DeviceName = "Laptop"
+	repo := &refreshRepoMock{stored: stored, found: true}
+	uc := common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, nil, nil, &refreshIssuerMock{token: "access"}, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}))
+
+	ctx := common.WithRequestMeta(context.Background(), common.RequestMeta{UserAgent: "other", IP: "2.2.2.2"})
+	if _, err := uc.Execute(ctx, Input{RefreshToken: "old"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated := repo.updated[0]
+	if updated.ID != stored.ID || !updated.CreatedAt.Equal(created) || updated.UserAgent != "agent" || updated.IP != "1.1.1.1" {
+		t.Fatalf("expected the login details to be kept, got %+v", updated)
+	}
+	if updated.LoginMethod != domain.LoginMethodPassword || updated.DeviceName != "Laptop" {
+		t.Fatalf("expected login method and device name to be kept, got %+v", updated)
+	}
+	if updated.LastIP != "2.2.2.2" || !updated.LastUsedAt.After(created) {
+		t.Fatalf("expected last use to be recorded, got %+v", updated)
+	}
+}
+
 func TestRefreshInvalid(t *testing.T) {
 	repo := &refreshRepoMock{found: false}
-	uc := common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, &refreshIssuerMock{}, 0, 0))
+	uc := common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, nil, nil, &refreshIssuerMock{}, 0, common.SessionPolicy{}))
 
 	if _, err := uc.Execute(context.Background(), Input{RefreshToken: ""}); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
 		t.Fatalf("expected invalid token on empty input, got %v", err)
 	}
 
 	repo = &refreshRepoMock{stored: domain.RefreshToken{ID: "id", ExpiresAt: time.Now().Add(-time.Hour)}, found: true}
-	uc = common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, &refreshIssuerMock{}, 0, 0))
+	uc = common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, nil, nil, &refreshIssuerMock{}, 0, common.SessionPolicy{}))
 	if _, err := uc.Execute(context.Background(), Input{RefreshToken: "expired"}); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
 		t.Fatalf("expected invalid token on expired, got %v", err)
 	}
@@ -103,3 +138,113 @@ func TestRefreshInvalid(t *testing.T) {
 		t.Fatalf("expected expired token to be revoked")
 	}
 }
+
+func TestRefreshAppliesClientLifetime(t *testing.T) {
+	now := time.Now().UTC()
+	stored := domain.NewRefreshTokenRecord("user", common.HashToken("old"), now.Add(-time.Hour), 2*time.Hour)
+	stored.ClientType = domain.ClientTypeMobile
+	stored = stored.WithAbsoluteExpiry(now.Add(3 * time.Hour))
+	repo := &refreshRepoMock{stored: stored, found: true}
+	policy := common.SessionPolicy{
+		IdleTimeout:   time.Hour,
+		PerClientType: map[string]common.SessionLifetime{domain.ClientTypeMobile: {IdleTimeout: 24 * time.Hour}},
+	}
+	uc := common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, nil, nil, &refreshIssuerMock{token: "access"}, time.Minute, policy))
+
+	out, err := uc.Execute(context.Background(), Input{RefreshToken: "old"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The mobile idle timeout reaches past the absolute expiry set at login.
+	if out.ReloginAt == nil || !out.ReloginAt.Equal(stored.AbsoluteExpiresAt) || !out.RefreshExpiresAt.Equal(stored.AbsoluteExpiresAt) {
+		t.Fatalf("expected the session to end at its absolute expiry, got %+v", out)
+	}
+	if !repo.updated[0].ExpiresAt.Equal(stored.AbsoluteExpiresAt) {
+		t.Fatalf("expected the stored expiry to be capped, got %v", repo.updated[0].ExpiresAt)
+	}
+}
+
+func TestRefreshEndsSessionsPastAbsoluteLifetime(t *testing.T) {
+	now := time.Now().UTC()
+	// A session stored before absolute lifetimes existed counts from its creation.
+	stored := domain.NewRefreshTokenRecord("user", common.HashToken("old"), now.Add(-48*time.Hour), 72*time.Hour)
+	repo := &refreshRepoMock{stored: stored, found: true}
+	uc := common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, nil, nil, &refreshIssuerMock{token: "access"}, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour, AbsoluteLifetime: 24 * time.Hour}))
+
+	if _, err := uc.Execute(context.Background(), Input{RefreshToken: "old"}); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		t.Fatalf("expected the session to be over, got %v", err)
+	}
+	if repo.revoked != stored.ID || len(repo.updated) != 0 {
+		t.Fatalf("expected the session to be revoked, got revoked=%q updated=%d", repo.revoked, len(repo.updated))
+	}
+
+	repo = &refreshRepoMock{stored: stored, found: true}
+	uc = common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, nil, nil, &refreshIssuerMock{token: "access"}, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}))
+	out, err := uc.Execute(context.Background(), Input{RefreshToken: "old"})
+	if err != nil || out.ReloginAt != nil {
+		t.Fatalf("expected a session without absolute lifetime to slide, got %+v err=%v", out, err)
+	}
+}
+
+type epochRepoStub struct{ notBefore time.Time }
+
+func (s epochRepoStub) Set(context.Context, domain.TokenEpoch) error { return nil }
+
+func (s epochRepoStub) NotBefore(context.Context, domain.UserID) (time.Time, error) {
+	return s.notBefore, nil
+}
+
+func (s epochRepoStub) ListAfter(context.Context, time.Time) ([]domain.TokenEpoch, error) {
+	return nil, nil
+}
+
+func TestRefreshEndsSessionsBeforeTheEpoch(t *testing.T) {
+	now := time.Now().UTC()
+	stored := domain.NewRefreshTokenRecord("user", common.HashToken("old"), now.Add(-time.Hour), 2*time.Hour)
+	repo := &refreshRepoMock{stored: stored, found: true}
+	uc := common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, epochRepoStub{notBefore: now.Add(-time.Minute)}, nil, &refreshIssuerMock{token: "access"}, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}))
+
+	if _, err := uc.Execute(context.Background(), Input{RefreshToken: "old"}); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		t.Fatalf("expected the session to be over, got %v", err)
+	}
+	if repo.revoked != stored.ID || len(repo.updated) != 0 {
+		t.Fatalf("expected the session to be revoked, got revoked=%q updated=%d", repo.revoked, len(repo.updated))
+	}
+
+	repo = &refreshRepoMock{stored: stored, found: true}
+	uc = common.NewTransactionalUseCase(&refreshUnitOfWorkMock{}, New(repo, epochRepoStub{notBefore: now.Add(-2 * time.Hour)}, nil, &refreshIssuerMock{token: "access"}, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}))
+	if _, err := uc.Execute(context.Background(), Input{RefreshToken: "old"}); err != nil {
+		t.Fatalf("expected sessions after the epoch to refresh, got %v", err)
+	}
+}
+
+type grantRepoStub struct{ grant domain.OAuthGrant }
+
+func (s grantRepoStub) Create(context.Context, domain.OAuthGrant) error { return nil }
+
+func (s grantRepoStub) GetBySession(_ context.Context, sessionID string) (domain.OAuthGrant, bool, error) {
+	return s.grant, s.grant.SessionID == sessionID, nil
+}
+
+func TestRefreshKeepsGrantedSessionsToTheirScopes(t *testing.T) {
+	now := time.Now().UTC()
+	stored := domain.NewRefreshTokenRecord("user", common.HashToken("old"), now, time.Hour)
+	repo := &refreshRepoMock{stored: stored, found: true}
+	issuer := &refreshIssuerMock{token: "access"}
+	uc := New(repo, nil, grantRepoStub{grant: domain.OAuthGrant{SessionID: stored.ID, ClientID: "client", Scopes: []string{domain.ScopeOpenID}}}, issuer, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour})
+
+	if _, err := uc.Execute(context.Background(), Input{RefreshToken: "old"}); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if c := issuer.claims; c.ClientID != "client" || len(c.Scopes) != 1 || !c.AuthTime.IsZero() {
+		t.Fatalf("expected a token limited to the grant, got %+v", c)
+	}
+
+	uc = New(repo, nil, grantRepoStub{grant: domain.OAuthGrant{SessionID: stored.ID, ClientID: "device"}}, issuer, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour})
+	if _, err := uc.Execute(context.Background(), Input{RefreshToken: "old"}); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if c := issuer.claims; c.ClientID != "" || c.SessionID != stored.ID {
+		t.Fatalf("expected grants without scopes to keep session tokens, got %+v", c)
+	}
+}
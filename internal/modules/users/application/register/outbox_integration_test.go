@@ -25,13 +25,13 @@ func TestRegisterUseCaseWritesOutboxInsideTransaction(t *testing.T) {
 
 	uow := pdb.NewUnitOfWork(db)
 	usersRepo := usersdb.NewUserRepo(db)
-	identitiesRepo := usersdb.NewIdentityRepo(db)
+	identitiesRepo := usersdb.NewIdentityRepo(db, nil)
 	refreshRepo := usersdb.NewRefreshRepo(db, -1)
 	tokensRepo := usersdb.NewVerificationTokenRepo(db)
-	outboxRepo := events.NewOutboxRepository(db)
+	outboxRepo := events.NewOutboxRepository(db, nil)
 
 	publisher := events.NewOutboxPublisher(outboxRepo)
-	uc := common.NewTransactionalUseCase(uow, New(usersRepo, identitiesRepo, refreshRepo, tokensRepo, stubHasher{}, stubTokenIssuer{}, publisher, time.Minute, time.Hour, time.Minute, false))
+	uc := common.NewTransactionalUseCase(uow, New(usersRepo, identitiesRepo, refreshRepo, tokensRepo, stubCodeHasher{}, stubHasher{}, stubTokenIssuer{}, publisher, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, time.Minute, false))
 
 	mock.ExpectBegin()
 	mock.ExpectQuery(`SELECT\s+id::text,\s+user_id::text,\s+provider,\s+provider_user_id,\s+COALESCE\(secret_hash, ''\),\s+email_confirmed_at,\s+COALESCE\(totp_secret, ''\),\s+totp_confirmed_at,\s+created_at\s+FROM auth_identities\s+WHERE provider = \$1 AND provider_user_id = \$2\s+LIMIT 1`).
@@ -53,11 +53,16 @@ func TestRegisterUseCaseWritesOutboxInsideTransaction(t *testing.T) {
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO auth_identities")).
 		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "email", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil, nil, sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	// RefreshRepo.Create binds one argument per column of the session.
+	sessionArgs := make([]any, 18)
+	for i := range sessionArgs {
+		sessionArgs[i] = sqlmock.AnyArg()
+	}
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO auth_refresh_tokens")).
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sessionArgs...).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_events_outbox")).
-		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -16,11 +16,12 @@ type UseCase struct {
 	identities domain.IdentityRepository
 	refresh    domain.RefreshTokenRepository
 	tokens     domain.VerificationTokenRepository
+	codes      domain.VerificationCodeHasher
 	hasher     domain.PasswordHasher
 
 	access                   common.AccessTokenIssuer
 	accessTTL                time.Duration
-	refreshTTL               time.Duration
+	sessionPolicy            common.SessionPolicy
 	verificationTTL          time.Duration
 	requireEmailConfirmation bool
 
@@ -32,20 +33,18 @@ func New(
 	identities domain.IdentityRepository,
 	refresh domain.RefreshTokenRepository,
 	tokens domain.VerificationTokenRepository,
+	codes domain.VerificationCodeHasher,
 	hasher domain.PasswordHasher,
 	access common.AccessTokenIssuer,
 	events common.EventPublisher,
 	accessTTL time.Duration,
-	refreshTTL time.Duration,
+	sessionPolicy common.SessionPolicy,
 	verificationTTL time.Duration,
 	requireEmailConfirmation bool,
 ) *UseCase {
 	if accessTTL == 0 {
 		accessTTL = 15 * time.Minute
 	}
-	if refreshTTL == 0 {
-		refreshTTL = 30 * 24 * time.Hour
-	}
 	if verificationTTL == 0 {
 		verificationTTL = 15 * time.Minute
 	}
@@ -54,11 +53,12 @@ func New(
 		identities:               identities,
 		refresh:                  refresh,
 		tokens:                   tokens,
+		codes:                    codes,
 		hasher:                   hasher,
 		access:                   access,
 		events:                   eventsOrNop(events),
 		accessTTL:                accessTTL,
-		refreshTTL:               refreshTTL,
+		sessionPolicy:            sessionPolicy,
 		verificationTTL:          verificationTTL,
 		requireEmailConfirmation: requireEmailConfirmation,
 	}
@@ -102,12 +102,12 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (login.Output, error)
 			return login.Output{}, common.NormalizeError(err)
 		}
 		refreshHash := common.HashToken(refreshRaw)
-		refreshRecord, refreshReuse, err = common.PrepareRefreshRecord(ctx, uc.refresh, userID, refreshHash, now, uc.refreshTTL)
+		refreshRecord, refreshReuse, err = common.PrepareRefreshRecord(ctx, uc.refresh, userID, refreshHash, now, uc.sessionPolicy, domain.LoginMethodPassword, domain.AMRPassword)
 		if err != nil {
 			return login.Output{}, common.NormalizeError(err)
 		}
 
-		accessToken, err = uc.access.Issue(userID.String(), refreshRecord.ID, uc.accessTTL)
+		accessToken, err = uc.access.Issue(common.SessionClaims(refreshRecord), uc.accessTTL)
 		if err != nil {
 			return login.Output{}, common.NormalizeError(err)
 		}
@@ -155,6 +155,8 @@ func (uc *UseCase) Execute(ctx context.Context, in Input) (login.Output, error)
 		AvatarURL:    "",
 		AccessToken:  accessToken,
 		RefreshToken: refreshRaw,
+		// Zero when no session was opened.
+		RefreshExpiresAt: refreshRecord.ExpiresAt,
 	}
 
 	return out, nil
@@ -175,7 +177,7 @@ func (uc *UseCase) createEmailConfirmation(ctx context.Context, identity domain.
 	if err != nil {
 		return err
 	}
-	token := domain.NewVerificationToken(identity.ID, domain.TokenTypeEmailConfirmation, code, now, uc.verificationTTL)
+	token := domain.NewVerificationToken(identity.ID, domain.TokenTypeEmailConfirmation, uc.codes.Hash(code), now, uc.verificationTTL)
 	if err := uc.tokens.Create(ctx, token); err != nil {
 		return err
 	}
@@ -21,7 +21,7 @@ func TestUseCase_PublishesEventOnSuccess(t *testing.T) {
 	tokenIssuer := &stubTokenIssuer{}
 	publisher := &stubEventPublisher{}
 
-	uc := common.NewTransactionalUseCase(uow, New(users, identities, refresh, tokens, hasher, tokenIssuer, publisher, time.Minute, time.Hour, time.Minute, true))
+	uc := common.NewTransactionalUseCase(uow, New(users, identities, refresh, tokens, stubCodeHasher{}, hasher, tokenIssuer, publisher, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, time.Minute, true))
 
 	_, err := uc.Execute(context.Background(), Input{Email: "john@example.com", Password: "verystrong", DisplayName: "John"})
 	if err != nil {
@@ -46,7 +46,7 @@ func TestUseCase_InvalidDisplayName(t *testing.T) {
 	tokenIssuer := &stubTokenIssuer{}
 	publisher := &stubEventPublisher{}
 
-	uc := common.NewTransactionalUseCase(uow, New(users, identities, refresh, tokens, hasher, tokenIssuer, publisher, time.Minute, time.Hour, time.Minute, true))
+	uc := common.NewTransactionalUseCase(uow, New(users, identities, refresh, tokens, stubCodeHasher{}, hasher, tokenIssuer, publisher, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, time.Minute, true))
 
 	_, err := uc.Execute(context.Background(), Input{Email: "john@example.com", Password: "verystrong", DisplayName: "a"})
 	if !errors.Is(err, domain.ErrInvalidDisplayName) {
@@ -64,7 +64,7 @@ func TestUseCase_DefaultDisplayNameWhenMissing(t *testing.T) {
 	tokenIssuer := &stubTokenIssuer{}
 	publisher := &stubEventPublisher{}
 
-	uc := common.NewTransactionalUseCase(uow, New(users, identities, refresh, tokens, hasher, tokenIssuer, publisher, time.Minute, time.Hour, time.Minute, true))
+	uc := common.NewTransactionalUseCase(uow, New(users, identities, refresh, tokens, stubCodeHasher{}, hasher, tokenIssuer, publisher, time.Minute, common.SessionPolicy{IdleTimeout: time.Hour}, time.Minute, true))
 
 	out, err := uc.Execute(context.Background(), Input{Email: "john@example.com", Password: "verystrong", DisplayName: ""})
 	if err != nil {
@@ -118,12 +118,15 @@ func (stubRefreshRepo) GetByID(context.Context, string) (domain.RefreshToken, bo
 func (stubRefreshRepo) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
 	return nil, errors.New("not implemented")
 }
+func (stubRefreshRepo) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
+	return nil, errors.New("not implemented")
+}
 func (stubRefreshRepo) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
 	return domain.RefreshToken{}, false, nil
 }
 func (stubRefreshRepo) Revoke(context.Context, string) error { return errors.New("not implemented") }
-func (stubRefreshRepo) RevokeAllExcept(context.Context, domain.UserID, []string) error {
-	return errors.New("not implemented")
+func (stubRefreshRepo) RevokeAllExcept(context.Context, domain.UserID, []string) ([]string, error) {
+	return nil, errors.New("not implemented")
 }
 
 type stubHasher struct{}
@@ -131,9 +134,13 @@ type stubHasher struct{}
 func (stubHasher) Hash(context.Context, string) (string, error)  { return "hash", nil }
 func (stubHasher) Compare(context.Context, string, string) error { return nil }
 
+type stubCodeHasher struct{}
+
+func (stubCodeHasher) Hash(raw string) string { return "hashed:" + raw }
+
 type stubTokenIssuer struct{}
 
-func (stubTokenIssuer) Issue(string, string, time.Duration) (string, error) { return "token", nil }
+func (stubTokenIssuer) Issue(common.AccessClaims, time.Duration) (string, error) { return "token", nil }
 
 type stubEventPublisher struct {
 	called bool
@@ -154,15 +161,36 @@ func (stubEventPublisher) PublishPasswordResetRequested(context.Context, events.
 	return nil
 }
 
+func (stubEventPublisher) PublishLoginCodeRequested(context.Context, events.LoginCodeRequested) error {
+	return nil
+}
+
+func (stubEventPublisher) PublishAccountRecoveryRequested(context.Context, events.AccountRecoveryRequested) error {
+	return nil
+}
+
+func (stubEventPublisher) PublishAccountRecoveryScheduled(context.Context, events.AccountRecoveryScheduled) error {
+	return nil
+}
+
+func (stubEventPublisher) PublishAccountRecoveryCompleted(context.Context, events.AccountRecoveryCompleted) error {
+	return nil
+}
+
+func (stubEventPublisher) PublishSessionRevoked(context.Context, events.SessionRevoked) error {
+	return nil
+}
+
+func (stubEventPublisher) PublishPasswordChanged(context.Context, events.PasswordChanged) error {
+	return nil
+}
+
 type stubVerificationTokenRepo struct{}
 
 func (stubVerificationTokenRepo) Create(context.Context, domain.VerificationToken) error { return nil }
 func (stubVerificationTokenRepo) GetLatest(context.Context, string, domain.TokenType) (domain.VerificationToken, bool, error) {
 	return domain.VerificationToken{}, false, nil
 }
-func (stubVerificationTokenRepo) GetByID(context.Context, string) (domain.VerificationToken, bool, error) {
-	return domain.VerificationToken{}, false, nil
-}
 func (stubVerificationTokenRepo) GetByCode(context.Context, string, domain.TokenType, string) (domain.VerificationToken, bool, error) {
 	return domain.VerificationToken{}, false, nil
 }
@@ -0,0 +1,40 @@
+package risk
+
+import (
+	"context"
+)
+
+// Engine runs an evaluator and a policy and logs every decision together
+// with the reasons behind it.
+type Engine struct {
+	evaluator Evaluator
+	policy    Policy
+	logger    Logger
+}
+
+func NewEngine(evaluator Evaluator, policy Policy, logger Logger) *Engine {
+	return &Engine{evaluator: evaluator, policy: policy, logger: logger}
+}
+
+func (e *Engine) Assess(ctx context.Context, in Input) (Decision, error) {
+	assessment, err := e.evaluator.Evaluate(ctx, in)
+	if err != nil {
+		return Decision{}, err
+	}
+	decision := e.policy.Decide(assessment)
+	if e.logger != nil {
+		e.logger.Info(ctx, "login risk decision",
+			"user_id", in.UserID.String(),
+			"ip", in.Meta.IP,
+			"user_agent", in.Meta.UserAgent,
+			"country", in.Meta.Country,
+			"score", decision.Score,
+			"reasons", decision.Reasons,
+			"steps", decision.Steps,
+			"deny", decision.Deny,
+		)
+	}
+	return decision, nil
+}
+
+var _ Assessor = (*Engine)(nil)
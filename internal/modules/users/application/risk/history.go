@@ -0,0 +1,183 @@
+package risk
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// HistoryConfig weights the signals of HistoryEvaluator.
+type HistoryConfig struct {
+	NewIPWeight            int
+	NewUserAgentWeight     int
+	NewCountryWeight       int
+	ImpossibleTravelWeight int
+	// FailureWeight is added per failed attempt in FailureWindow, counting
+	// at most MaxFailures attempts.
+	FailureWeight int
+	MaxFailures   int
+	FailureWindow time.Duration
+	// MaxTravelSpeed in km/h; faster movement between the previous session
+	// and this login is treated as impossible travel.
+	MaxTravelSpeed float64
+}
+
+// HistoryEvaluator scores a login against the user's active sessions and
+// recent failed attempts from the same IP.
+type HistoryEvaluator struct {
+	sessions domain.RefreshTokenRepository
+	attempts domain.LoginAttemptRepository
+	geo      GeoLocator
+	cfg      HistoryConfig
+}
+
+func NewHistoryEvaluator(sessions domain.RefreshTokenRepository, attempts domain.LoginAttemptRepository, geo GeoLocator, cfg HistoryConfig) *HistoryEvaluator {
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = 5
+	}
+	if cfg.FailureWindow == 0 {
+		cfg.FailureWindow = time.Hour
+	}
+	if cfg.MaxTravelSpeed == 0 {
+		cfg.MaxTravelSpeed = 1000
+	}
+	return &HistoryEvaluator{sessions: sessions, attempts: attempts, geo: geo, cfg: cfg}
+}
+
+func (e *HistoryEvaluator) Evaluate(ctx context.Context, in Input) (Assessment, error) {
+	var a Assessment
+
+	sessions, err := e.sessions.ListByUser(ctx, in.UserID)
+	if err != nil {
+		return Assessment{}, err
+	}
+	// Without any session history there is nothing to compare against, so a
+	// first login is not penalised for being "new".
+	if len(sessions) > 0 && !in.KnownDevice {
+		if in.Meta.IP != "" && !seen(sessions, func(s domain.RefreshToken) bool { return s.IP == in.Meta.IP || s.LastIP == in.Meta.IP }) {
+			a.add(ReasonNewIP, e.cfg.NewIPWeight)
+		}
+		if in.Meta.UserAgent != "" && !seen(sessions, func(s domain.RefreshToken) bool { return s.UserAgent == in.Meta.UserAgent }) {
+			a.add(ReasonNewUserAgent, e.cfg.NewUserAgentWeight)
+		}
+	}
+	if e.newCountry(sessions, in) {
+		a.add(ReasonNewCountry, e.cfg.NewCountryWeight)
+	}
+	if e.impossibleTravel(sessions, in) {
+		a.add(ReasonImpossibleTravel, e.cfg.ImpossibleTravelWeight)
+	}
+
+	if e.attempts != nil {
+		failures, err := e.attempts.CountFailures(ctx, in.UserID, in.Meta.IP, in.Now.Add(-e.cfg.FailureWindow))
+		if err != nil {
+			return Assessment{}, err
+		}
+		if failures > 0 {
+			a.add(ReasonRecentFailures, e.cfg.FailureWeight*min(failures, e.cfg.MaxFailures))
+		}
+	}
+	return a, nil
+}
+
+// newCountry reports a login from a country none of the active sessions
+// was created in. Sessions without a stored country are located by IP when
+// a GeoLocator is set; if no session has a known country there is nothing to
+// compare against.
+func (e *HistoryEvaluator) newCountry(sessions []domain.RefreshToken, in Input) bool {
+	here := e.country(in.Meta.Country, in.Meta.IP)
+	if here == "" {
+		return false
+	}
+	known := false
+	for _, s := range sessions {
+		there := e.country(s.Country, s.IP)
+		if there == "" {
+			continue
+		}
+		if there == here {
+			return false
+		}
+		known = true
+	}
+	return known
+}
+
+func (e *HistoryEvaluator) country(stored, ip string) string {
+	if stored != "" || e.geo == nil || ip == "" {
+		return stored
+	}
+	loc, _ := e.geo.Locate(ip)
+	return loc.Country
+}
+
+// impossibleTravel compares the login location with where each session
+// from a different, locatable IP was last used.
+func (e *HistoryEvaluator) impossibleTravel(sessions []domain.RefreshToken, in Input) bool {
+	if e.geo == nil || in.Meta.IP == "" {
+		return false
+	}
+	here, ok := e.geo.Locate(in.Meta.IP)
+	if !ok {
+		return false
+	}
+	for _, s := range sessions {
+		ip, at := lastSeen(s)
+		if ip == "" || ip == in.Meta.IP {
+			continue
+		}
+		there, ok := e.geo.Locate(ip)
+		if !ok {
+			continue
+		}
+		hours := in.Now.Sub(at).Hours()
+		if hours < 1.0/60 {
+			hours = 1.0 / 60
+		}
+		if distanceKm(here, there)/hours > e.cfg.MaxTravelSpeed {
+			return true
+		}
+	}
+	return false
+}
+
+// lastSeen returns where and when a session was last used: its latest
+// refresh, or its login when it was never refreshed from a known IP.
+func lastSeen(s domain.RefreshToken) (string, time.Time) {
+	if s.LastIP != "" && !s.LastUsedAt.IsZero() {
+		return s.LastIP, s.LastUsedAt
+	}
+	return s.IP, s.CreatedAt
+}
+
+func (a *Assessment) add(reason Reason, weight int) {
+	if weight <= 0 {
+		return
+	}
+	a.Score += weight
+	a.Reasons = append(a.Reasons, reason)
+}
+
+func seen(sessions []domain.RefreshToken, match func(domain.RefreshToken) bool) bool {
+	for _, s := range sessions {
+		if match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// distanceKm is the great-circle distance between two locations.
+func distanceKm(a, b Location) float64 {
+	const earthRadiusKm = 6371
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(b.Latitude - a.Latitude)
+	dLon := rad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+var _ Evaluator = (*HistoryEvaluator)(nil)
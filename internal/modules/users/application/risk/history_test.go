@@ -0,0 +1,161 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+type sessionsStub struct{ sessions []domain.RefreshToken }
+
+func (s sessionsStub) Create(context.Context, domain.RefreshToken) error { return nil }
+func (s sessionsStub) Update(context.Context, domain.RefreshToken) error { return nil }
+func (s sessionsStub) GetByHash(context.Context, string) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, errors.New("not implemented")
+}
+func (s sessionsStub) GetByID(context.Context, string) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, errors.New("not implemented")
+}
+func (s sessionsStub) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
+	return s.sessions, nil
+}
+func (s sessionsStub) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
+	return s.sessions, nil
+}
+func (s sessionsStub) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s sessionsStub) Revoke(context.Context, string) error { return nil }
+func (s sessionsStub) RevokeAllExcept(context.Context, domain.UserID, []string) ([]string, error) {
+	return nil, nil
+}
+
+type attemptsStub struct{ failures int }
+
+func (a attemptsStub) Record(context.Context, domain.LoginAttempt) error { return nil }
+func (a attemptsStub) CountFailures(context.Context, domain.UserID, string, time.Time) (int, error) {
+	return a.failures, nil
+}
+
+type geoStub map[string]Location
+
+func (g geoStub) Locate(ip string) (Location, bool) {
+	loc, ok := g[ip]
+	return loc, ok
+}
+
+var testWeights = HistoryConfig{NewIPWeight: 20, NewUserAgentWeight: 10, ImpossibleTravelWeight: 60, FailureWeight: 10, MaxFailures: 3}
+
+func TestHistoryEvaluatorScoresNewDeviceAndFailures(t *testing.T) {
+	now := time.Now().UTC()
+	sessions := sessionsStub{sessions: []domain.RefreshToken{{IP: "10.0.0.1", UserAgent: "firefox", CreatedAt: now.Add(-time.Hour)}}}
+	e := NewHistoryEvaluator(sessions, attemptsStub{failures: 7}, nil, testWeights)
+
+	a, err := e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "10.0.0.2", UserAgent: "curl"}, Now: now})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.Score != 20+10+30 {
+		t.Fatalf("unexpected score %d (%v)", a.Score, a.Reasons)
+	}
+	want := []Reason{ReasonNewIP, ReasonNewUserAgent, ReasonRecentFailures}
+	if len(a.Reasons) != len(want) {
+		t.Fatalf("unexpected reasons %v", a.Reasons)
+	}
+	for i := range want {
+		if a.Reasons[i] != want[i] {
+			t.Fatalf("unexpected reasons %v", a.Reasons)
+		}
+	}
+
+	a, _ = e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "10.0.0.2", UserAgent: "curl"}, KnownDevice: true, Now: now})
+	if a.Score != 30 {
+		t.Fatalf("expected trusted device to skip novelty signals, got %d", a.Score)
+	}
+}
+
+func TestHistoryEvaluatorIgnoresFirstLogin(t *testing.T) {
+	e := NewHistoryEvaluator(sessionsStub{}, attemptsStub{}, nil, testWeights)
+	a, err := e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "10.0.0.2", UserAgent: "curl"}, Now: time.Now()})
+	if err != nil || a.Score != 0 {
+		t.Fatalf("expected zero score for first login, got %d %v", a.Score, err)
+	}
+}
+
+func TestHistoryEvaluatorDetectsNewCountry(t *testing.T) {
+	now := time.Now().UTC()
+	weights := HistoryConfig{NewCountryWeight: 30}
+	geo := geoStub{"1.1.1.1": {Country: "DE"}}
+	sessions := sessionsStub{sessions: []domain.RefreshToken{
+		{IP: "1.1.1.1", CreatedAt: now.Add(-time.Hour)},
+		{IP: "3.3.3.3", Country: "FR", CreatedAt: now.Add(-time.Hour)},
+	}}
+	e := NewHistoryEvaluator(sessions, nil, geo, weights)
+
+	a, _ := e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "2.2.2.2", Country: "US"}, Now: now})
+	if a.Score != 30 || len(a.Reasons) != 1 || a.Reasons[0] != ReasonNewCountry {
+		t.Fatalf("expected a new country, got %d %v", a.Score, a.Reasons)
+	}
+	for _, country := range []string{"DE", "FR"} {
+		a, _ = e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "2.2.2.2", Country: country}, Now: now})
+		if a.Score != 0 {
+			t.Fatalf("expected %s to be known, got %d %v", country, a.Score, a.Reasons)
+		}
+	}
+
+	a, _ = e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "2.2.2.2"}, Now: now})
+	if a.Score != 0 {
+		t.Fatalf("expected an unknown location to be ignored, got %d %v", a.Score, a.Reasons)
+	}
+}
+
+func TestHistoryEvaluatorDetectsImpossibleTravel(t *testing.T) {
+	now := time.Now().UTC()
+	geo := geoStub{
+		"1.1.1.1": {Country: "DE", Latitude: 52.52, Longitude: 13.40},  // Berlin
+		"2.2.2.2": {Country: "US", Latitude: 40.71, Longitude: -74.00}, // New York
+	}
+	sessions := sessionsStub{sessions: []domain.RefreshToken{{IP: "1.1.1.1", UserAgent: "ua", CreatedAt: now.Add(-2 * time.Hour)}}}
+	e := NewHistoryEvaluator(sessions, nil, geo, testWeights)
+
+	a, _ := e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "2.2.2.2", UserAgent: "ua"}, Now: now})
+	if a.Score != 20+60 {
+		t.Fatalf("expected impossible travel, got %d %v", a.Score, a.Reasons)
+	}
+
+	sessions.sessions[0].CreatedAt = now.Add(-24 * time.Hour)
+	e = NewHistoryEvaluator(sessions, nil, geo, testWeights)
+	a, _ = e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "2.2.2.2", UserAgent: "ua"}, Now: now})
+	if a.Score != 20 {
+		t.Fatalf("expected plausible travel after a day, got %d %v", a.Score, a.Reasons)
+	}
+}
+
+func TestHistoryEvaluatorUsesWhereSessionsWereLastUsed(t *testing.T) {
+	now := time.Now().UTC()
+	geo := geoStub{
+		"1.1.1.1": {Country: "DE", Latitude: 52.52, Longitude: 13.40},  // Berlin
+		"2.2.2.2": {Country: "US", Latitude: 40.71, Longitude: -74.00}, // New York
+	}
+	// The first session is unremarkable; the second was logged in from New
+	// York a day ago and has since been refreshed from Berlin.
+	sessions := sessionsStub{sessions: []domain.RefreshToken{
+		{IP: "9.9.9.9", UserAgent: "ua", CreatedAt: now.Add(-time.Hour)},
+		{IP: "2.2.2.2", UserAgent: "ua", CreatedAt: now.Add(-24 * time.Hour), LastIP: "1.1.1.1", LastUsedAt: now.Add(-time.Hour)},
+	}}
+	e := NewHistoryEvaluator(sessions, nil, geo, testWeights)
+
+	a, _ := e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "2.2.2.2", UserAgent: "ua"}, Now: now})
+	if a.Score != 60 || len(a.Reasons) != 1 || a.Reasons[0] != ReasonImpossibleTravel {
+		t.Fatalf("expected impossible travel from the last refresh, got %d %v", a.Score, a.Reasons)
+	}
+
+	a, _ = e.Evaluate(context.Background(), Input{Meta: common.RequestMeta{IP: "1.1.1.1", UserAgent: "ua"}, Now: now})
+	if a.Score != 0 {
+		t.Fatalf("expected the IP of the last refresh to be known, got %d %v", a.Score, a.Reasons)
+	}
+}
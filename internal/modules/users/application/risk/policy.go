@@ -0,0 +1,36 @@
+package risk
+
+import "github.com/vaaxooo/xbackend/internal/modules/users/domain"
+
+// ThresholdPolicy maps a score to steps by fixed thresholds. A zero
+// threshold disables the corresponding outcome. When captcha is not
+// available, scores in the captcha band escalate to an email code instead.
+type ThresholdPolicy struct {
+	CaptchaScore   int
+	EmailOTPScore  int
+	DenyScore      int
+	CaptchaEnabled bool
+}
+
+func (p ThresholdPolicy) Decide(a Assessment) Decision {
+	d := Decision{Score: a.Score, Reasons: a.Reasons}
+	if p.DenyScore > 0 && a.Score >= p.DenyScore {
+		d.Deny = true
+		return d
+	}
+
+	captcha := p.CaptchaScore > 0 && a.Score >= p.CaptchaScore
+	emailOTP := p.EmailOTPScore > 0 && a.Score >= p.EmailOTPScore
+	if captcha && !p.CaptchaEnabled {
+		captcha, emailOTP = false, true
+	}
+	if captcha {
+		d.Steps = append(d.Steps, domain.ChallengeStepCaptcha)
+	}
+	if emailOTP {
+		d.Steps = append(d.Steps, domain.ChallengeStepEmailOTP)
+	}
+	return d
+}
+
+var _ Policy = ThresholdPolicy{}
@@ -0,0 +1,69 @@
+package risk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestThresholdPolicy(t *testing.T) {
+	p := ThresholdPolicy{CaptchaScore: 30, EmailOTPScore: 50, DenyScore: 100, CaptchaEnabled: true}
+
+	if d := p.Decide(Assessment{Score: 10}); d.Deny || len(d.Steps) != 0 {
+		t.Fatalf("expected no extra steps, got %+v", d)
+	}
+	if d := p.Decide(Assessment{Score: 30}); len(d.Steps) != 1 || d.Steps[0] != domain.ChallengeStepCaptcha {
+		t.Fatalf("expected captcha, got %+v", d)
+	}
+	if d := p.Decide(Assessment{Score: 60}); len(d.Steps) != 2 {
+		t.Fatalf("expected captcha and email otp, got %+v", d)
+	}
+	if d := p.Decide(Assessment{Score: 100}); !d.Deny {
+		t.Fatalf("expected denial, got %+v", d)
+	}
+
+	p.CaptchaEnabled = false
+	if d := p.Decide(Assessment{Score: 30}); len(d.Steps) != 1 || d.Steps[0] != domain.ChallengeStepEmailOTP {
+		t.Fatalf("expected email otp instead of captcha, got %+v", d)
+	}
+}
+
+type loggerStub struct {
+	msgs []string
+	args [][]any
+}
+
+func (l *loggerStub) Info(_ context.Context, msg string, args ...any) {
+	l.msgs = append(l.msgs, msg)
+	l.args = append(l.args, args)
+}
+
+type fixedEvaluator Assessment
+
+func (f fixedEvaluator) Evaluate(context.Context, Input) (Assessment, error) {
+	return Assessment(f), nil
+}
+
+func TestEngineLogsEveryDecision(t *testing.T) {
+	logger := &loggerStub{}
+	e := NewEngine(fixedEvaluator{Score: 20, Reasons: []Reason{ReasonNewIP}}, ThresholdPolicy{EmailOTPScore: 50}, logger)
+
+	d, err := e.Assess(context.Background(), Input{UserID: domain.NewUserID()})
+	if err != nil || d.Deny || len(d.Steps) != 0 {
+		t.Fatalf("unexpected decision %+v %v", d, err)
+	}
+	if len(logger.msgs) != 1 {
+		t.Fatalf("expected one log entry, got %d", len(logger.msgs))
+	}
+	found := false
+	for i := 0; i+1 < len(logger.args[0]); i += 2 {
+		if logger.args[0][i] == "reasons" {
+			reasons, _ := logger.args[0][i+1].([]Reason)
+			found = len(reasons) == 1 && reasons[0] == ReasonNewIP
+		}
+	}
+	if !found {
+		t.Fatalf("expected reasons in log entry: %v", logger.args[0])
+	}
+}
@@ -0,0 +1,74 @@
+// Package risk scores password logins and turns the score into extra
+// challenge steps or a denial.
+//
+// An Evaluator collects signals (unknown IP, user agent or country, impossible
+// travel, recent failures) into an Assessment; a Policy maps the assessment to a
+// Decision. Both are interfaces so deployments can plug in their own scoring
+// (e.g. an external fraud service) without touching the login flow.
+package risk
+
+import (
+	"context"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// Reason names a signal that contributed to the score.
+type Reason string
+
+const (
+	ReasonNewIP            Reason = "new_ip"
+	ReasonNewUserAgent     Reason = "new_user_agent"
+	ReasonNewCountry       Reason = "new_country"
+	ReasonImpossibleTravel Reason = "impossible_travel"
+	ReasonRecentFailures   Reason = "recent_failures"
+)
+
+type Input struct {
+	UserID domain.UserID
+	Meta   common.RequestMeta
+	// KnownDevice is set when the client presented a valid trusted-device
+	// token, so device novelty signals are skipped.
+	KnownDevice bool
+	Now         time.Time
+}
+
+type Assessment struct {
+	Score   int
+	Reasons []Reason
+}
+
+type Decision struct {
+	Score   int
+	Reasons []Reason
+	Steps   []domain.ChallengeStep
+	Deny    bool
+}
+
+type Evaluator interface {
+	Evaluate(ctx context.Context, in Input) (Assessment, error)
+}
+
+type Policy interface {
+	Decide(a Assessment) Decision
+}
+
+// Assessor is what the login flow depends on.
+type Assessor interface {
+	Assess(ctx context.Context, in Input) (Decision, error)
+}
+
+// Logger is the subset of the platform logger used to record decisions.
+type Logger interface {
+	Info(ctx context.Context, msg string, args ...any)
+}
+
+// Location is the coarse position of an IP address.
+type Location = common.Location
+
+// GeoLocator resolves IP addresses. It is optional; without it the
+// impossible-travel signal is not evaluated and new-country only uses the
+// locations stored on sessions.
+type GeoLocator = common.GeoLocator
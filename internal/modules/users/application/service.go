@@ -3,13 +3,18 @@ package application
 import (
 	"context"
 
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/accesstoken"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/apple"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/challenge"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/device"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/epoch"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/google"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/link"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/login"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/oauth"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/password"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/profile"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/recovery"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/refresh"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/register"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/session"
@@ -41,7 +46,73 @@ type Service interface {
 	VerifyChallengeTOTP(ctx context.Context, in challenge.VerifyTOTPInput) (login.Output, error)
 	ResendChallengeEmail(ctx context.Context, in challenge.ResendEmailInput) (login.Output, error)
 	ConfirmChallengeEmail(ctx context.Context, in challenge.ConfirmEmailInput) (login.Output, error)
+	VerifyChallengeEmailOTP(ctx context.Context, in challenge.VerifyEmailOTPInput) (login.Output, error)
+	VerifyChallengeCaptcha(ctx context.Context, in challenge.VerifyCaptchaInput) (login.Output, error)
+	VerifyChallengeStep(ctx context.Context, in challenge.VerifyStepInput) (login.Output, error)
+	// WatchChallenge streams challenge changes until it is completed or
+	// expired, or ctx is done.
+	WatchChallenge(ctx context.Context, in challenge.WatchInput) (<-chan challenge.Event, error)
+	StartRecovery(ctx context.Context, in recovery.StartInput) (recovery.Output, error)
+	ConfirmRecovery(ctx context.Context, in recovery.ConfirmInput) (recovery.Output, error)
+	CancelRecovery(ctx context.Context, in recovery.CancelInput) error
+	CompleteRecovery(ctx context.Context, in recovery.CompleteInput) (recovery.Output, error)
+	// StartStepUp and VerifyStepUp re-authenticate the caller's session; on
+	// completion they return a new access token for the same session.
+	StartStepUp(ctx context.Context, in challenge.StartStepUpInput) (login.Output, error)
+	VerifyStepUp(ctx context.Context, in challenge.VerifyStepUpInput) (login.Output, error)
 	ListSessions(ctx context.Context, in session.ListInput) (session.Output, error)
 	RevokeSession(ctx context.Context, in session.RevokeInput) error
+	// RenameSession sets the device name the user gave one of their sessions.
+	RenameSession(ctx context.Context, in session.RenameInput) (session.Session, error)
 	RevokeOtherSessions(ctx context.Context, in session.RevokeOthersInput) error
+	Logout(ctx context.Context, in session.LogoutInput) error
+	LogoutAll(ctx context.Context, in session.LogoutAllInput) error
+	// ListRevocations pages through revoked sessions for services that
+	// verify access tokens themselves.
+	ListRevocations(ctx context.Context, in session.FeedInput) (session.FeedOutput, error)
+	// InvalidateTokens starts a new token epoch for one user or everyone.
+	InvalidateTokens(ctx context.Context, in epoch.InvalidateInput) (epoch.Output, error)
+	ListTrustedDevices(ctx context.Context, in device.ListInput) (device.Output, error)
+	RevokeTrustedDevice(ctx context.Context, in device.RevokeInput) error
+	// CreateAccessToken returns a new personal access token, the only time
+	// the token itself is shown.
+	CreateAccessToken(ctx context.Context, in accesstoken.CreateInput) (accesstoken.CreateOutput, error)
+	ListAccessTokens(ctx context.Context, in accesstoken.ListInput) (accesstoken.Output, error)
+	RevokeAccessToken(ctx context.Context, in accesstoken.RevokeInput) error
+	// RegisterClient registers an OAuth client; its secret, if any, is only
+	// shown here.
+	RegisterClient(ctx context.Context, in oauth.RegisterClientInput) (oauth.RegisterClientOutput, error)
+	ListClients(ctx context.Context, in oauth.ListClientsInput) (oauth.ClientsOutput, error)
+	DisableClient(ctx context.Context, in oauth.DisableClientInput) error
+	// ClientToken serves the token endpoint: the client credentials grant
+	// and, with the OpenID Connect provider, authorization codes and refresh
+	// tokens.
+	ClientToken(ctx context.Context, in oauth.TokenInput) (oauth.TokenOutput, error)
+	// StartAuthorization sends the browser of an authorization request to
+	// the login page, or back to the client when the request is invalid.
+	StartAuthorization(ctx context.Context, in oauth.StartAuthorizationInput) (oauth.RedirectOutput, error)
+	// Authorize answers an authorization request for the signed in user:
+	// a redirect back to the client, or the consent screen to show.
+	Authorize(ctx context.Context, in oauth.AuthorizeInput) (oauth.AuthorizeOutput, error)
+	UserInfo(ctx context.Context, in oauth.UserInfoInput) (oauth.UserInfoOutput, error)
+	// ProviderMetadata and ProviderKeys publish the discovery document and
+	// the keys ID tokens are signed with.
+	ProviderMetadata(ctx context.Context, in oauth.DiscoveryInput) (oauth.ProviderMetadata, error)
+	ProviderKeys(ctx context.Context, in oauth.KeysInput) (oauth.KeySet, error)
+	// IntrospectToken and RevokeToken serve token introspection and
+	// revocation to confidential clients.
+	IntrospectToken(ctx context.Context, in oauth.IntrospectInput) (oauth.IntrospectOutput, error)
+	RevokeToken(ctx context.Context, in oauth.RevokeInput) error
+	// StartDeviceAuthorization hands a device the codes of the device
+	// authorization grant; VerifyDevice lets the signed in user look the
+	// device up by its user code and approve or deny it.
+	StartDeviceAuthorization(ctx context.Context, in oauth.DeviceAuthorizationInput) (oauth.DeviceAuthorizationOutput, error)
+	VerifyDevice(ctx context.Context, in oauth.VerifyDeviceInput) (oauth.VerifyDeviceOutput, error)
+	// StartQRLogin shows a desktop a QR code to scan with the mobile app;
+	// ScanQRLogin lets the signed in mobile user look the desktop up and
+	// approve or deny it; QRLoginSession waits for the answer and hands the
+	// desktop its session.
+	StartQRLogin(ctx context.Context, in challenge.StartQRLoginInput) (challenge.StartQRLoginOutput, error)
+	ScanQRLogin(ctx context.Context, in challenge.ScanQRLoginInput) (challenge.ScanQRLoginOutput, error)
+	QRLoginSession(ctx context.Context, in challenge.QRSessionInput) (login.Output, error)
 }
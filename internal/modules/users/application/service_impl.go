@@ -3,14 +3,19 @@ package application
 import (
 	"context"
 
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/accesstoken"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/apple"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/challenge"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/device"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/epoch"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/google"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/link"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/login"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/oauth"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/password"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/profile"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/recovery"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/refresh"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/register"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/session"
@@ -37,6 +42,18 @@ type service struct {
 	challengeVerifyTOTP    common.Handler[challenge.VerifyTOTPInput, login.Output]
 	challengeResendEmail   common.Handler[challenge.ResendEmailInput, login.Output]
 	challengeConfirmEmail  common.Handler[challenge.ConfirmEmailInput, login.Output]
+	challengeEmailOTP      common.Handler[challenge.VerifyEmailOTPInput, login.Output]
+	challengeCaptcha       common.Handler[challenge.VerifyCaptchaInput, login.Output]
+	challengeStep          common.Handler[challenge.VerifyStepInput, login.Output]
+	challengeWatch         common.Handler[challenge.WatchInput, <-chan challenge.Event]
+
+	recoveryStartUC    common.Handler[recovery.StartInput, recovery.Output]
+	recoveryConfirmUC  common.Handler[recovery.ConfirmInput, recovery.Output]
+	recoveryCancelUC   common.Handler[recovery.CancelInput, struct{}]
+	recoveryCompleteUC common.Handler[recovery.CompleteInput, recovery.Output]
+
+	stepUpStartUC  common.Handler[challenge.StartStepUpInput, login.Output]
+	stepUpVerifyUC common.Handler[challenge.VerifyStepUpInput, login.Output]
 
 	meUC       common.Handler[profile.GetInput, profile.Output]
 	profileUC  common.Handler[profile.UpdateInput, profile.Output]
@@ -45,7 +62,36 @@ type service struct {
 
 	sessionsListUC  common.Handler[session.ListInput, session.Output]
 	sessionRevokeUC common.Handler[session.RevokeInput, struct{}]
+	sessionRenameUC common.Handler[session.RenameInput, session.Session]
 	sessionsPurgeUC common.Handler[session.RevokeOthersInput, struct{}]
+	logoutUC        common.Handler[session.LogoutInput, struct{}]
+	logoutAllUC     common.Handler[session.LogoutAllInput, struct{}]
+	revocationsUC   common.Handler[session.FeedInput, session.FeedOutput]
+	invalidateUC    common.Handler[epoch.InvalidateInput, epoch.Output]
+
+	devicesListUC  common.Handler[device.ListInput, device.Output]
+	deviceRevokeUC common.Handler[device.RevokeInput, struct{}]
+
+	accessTokenCreateUC common.Handler[accesstoken.CreateInput, accesstoken.CreateOutput]
+	accessTokenListUC   common.Handler[accesstoken.ListInput, accesstoken.Output]
+	accessTokenRevokeUC common.Handler[accesstoken.RevokeInput, struct{}]
+
+	clientRegisterUC common.Handler[oauth.RegisterClientInput, oauth.RegisterClientOutput]
+	clientListUC     common.Handler[oauth.ListClientsInput, oauth.ClientsOutput]
+	clientDisableUC  common.Handler[oauth.DisableClientInput, struct{}]
+	clientTokenUC    common.Handler[oauth.TokenInput, oauth.TokenOutput]
+	authorizeStartUC common.Handler[oauth.StartAuthorizationInput, oauth.RedirectOutput]
+	authorizeUC      common.Handler[oauth.AuthorizeInput, oauth.AuthorizeOutput]
+	userInfoUC       common.Handler[oauth.UserInfoInput, oauth.UserInfoOutput]
+	discoveryUC      common.Handler[oauth.DiscoveryInput, oauth.ProviderMetadata]
+	keysUC           common.Handler[oauth.KeysInput, oauth.KeySet]
+	introspectUC     common.Handler[oauth.IntrospectInput, oauth.IntrospectOutput]
+	revokeTokenUC    common.Handler[oauth.RevokeInput, struct{}]
+	deviceStartUC    common.Handler[oauth.DeviceAuthorizationInput, oauth.DeviceAuthorizationOutput]
+	deviceVerifyUC   common.Handler[oauth.VerifyDeviceInput, oauth.VerifyDeviceOutput]
+	qrStartUC        common.Handler[challenge.StartQRLoginInput, challenge.StartQRLoginOutput]
+	qrScanUC         common.Handler[challenge.ScanQRLoginInput, challenge.ScanQRLoginOutput]
+	qrSessionUC      common.Handler[challenge.QRSessionInput, login.Output]
 }
 
 func NewService(
@@ -66,13 +112,49 @@ func NewService(
 	challengeVerifyTOTP common.Handler[challenge.VerifyTOTPInput, login.Output],
 	challengeResendEmail common.Handler[challenge.ResendEmailInput, login.Output],
 	challengeConfirmEmail common.Handler[challenge.ConfirmEmailInput, login.Output],
+	challengeEmailOTP common.Handler[challenge.VerifyEmailOTPInput, login.Output],
+	challengeCaptcha common.Handler[challenge.VerifyCaptchaInput, login.Output],
+	challengeStep common.Handler[challenge.VerifyStepInput, login.Output],
+	challengeWatch common.Handler[challenge.WatchInput, <-chan challenge.Event],
+	recoveryStartUC common.Handler[recovery.StartInput, recovery.Output],
+	recoveryConfirmUC common.Handler[recovery.ConfirmInput, recovery.Output],
+	recoveryCancelUC common.Handler[recovery.CancelInput, struct{}],
+	recoveryCompleteUC common.Handler[recovery.CompleteInput, recovery.Output],
+	stepUpStartUC common.Handler[challenge.StartStepUpInput, login.Output],
+	stepUpVerifyUC common.Handler[challenge.VerifyStepUpInput, login.Output],
 	meUC common.Handler[profile.GetInput, profile.Output],
 	profileUC common.Handler[profile.UpdateInput, profile.Output],
 	passwordUC common.Handler[password.ChangeInput, struct{}],
 	linkUC common.Handler[link.Input, link.Output],
 	sessionsListUC common.Handler[session.ListInput, session.Output],
 	sessionRevokeUC common.Handler[session.RevokeInput, struct{}],
+	sessionRenameUC common.Handler[session.RenameInput, session.Session],
 	sessionsPurgeUC common.Handler[session.RevokeOthersInput, struct{}],
+	logoutUC common.Handler[session.LogoutInput, struct{}],
+	logoutAllUC common.Handler[session.LogoutAllInput, struct{}],
+	revocationsUC common.Handler[session.FeedInput, session.FeedOutput],
+	invalidateUC common.Handler[epoch.InvalidateInput, epoch.Output],
+	devicesListUC common.Handler[device.ListInput, device.Output],
+	deviceRevokeUC common.Handler[device.RevokeInput, struct{}],
+	accessTokenCreateUC common.Handler[accesstoken.CreateInput, accesstoken.CreateOutput],
+	accessTokenListUC common.Handler[accesstoken.ListInput, accesstoken.Output],
+	accessTokenRevokeUC common.Handler[accesstoken.RevokeInput, struct{}],
+	clientRegisterUC common.Handler[oauth.RegisterClientInput, oauth.RegisterClientOutput],
+	clientListUC common.Handler[oauth.ListClientsInput, oauth.ClientsOutput],
+	clientDisableUC common.Handler[oauth.DisableClientInput, struct{}],
+	clientTokenUC common.Handler[oauth.TokenInput, oauth.TokenOutput],
+	authorizeStartUC common.Handler[oauth.StartAuthorizationInput, oauth.RedirectOutput],
+	authorizeUC common.Handler[oauth.AuthorizeInput, oauth.AuthorizeOutput],
+	userInfoUC common.Handler[oauth.UserInfoInput, oauth.UserInfoOutput],
+	discoveryUC common.Handler[oauth.DiscoveryInput, oauth.ProviderMetadata],
+	keysUC common.Handler[oauth.KeysInput, oauth.KeySet],
+	introspectUC common.Handler[oauth.IntrospectInput, oauth.IntrospectOutput],
+	revokeTokenUC common.Handler[oauth.RevokeInput, struct{}],
+	deviceStartUC common.Handler[oauth.DeviceAuthorizationInput, oauth.DeviceAuthorizationOutput],
+	deviceVerifyUC common.Handler[oauth.VerifyDeviceInput, oauth.VerifyDeviceOutput],
+	qrStartUC common.Handler[challenge.StartQRLoginInput, challenge.StartQRLoginOutput],
+	qrScanUC common.Handler[challenge.ScanQRLoginInput, challenge.ScanQRLoginOutput],
+	qrSessionUC common.Handler[challenge.QRSessionInput, login.Output],
 ) Service {
 	return &service{
 		registerUC:             registerUC,
@@ -92,13 +174,49 @@ func NewService(
 		challengeVerifyTOTP:    challengeVerifyTOTP,
 		challengeResendEmail:   challengeResendEmail,
 		challengeConfirmEmail:  challengeConfirmEmail,
+		challengeEmailOTP:      challengeEmailOTP,
+		challengeCaptcha:       challengeCaptcha,
+		challengeStep:          challengeStep,
+		challengeWatch:         challengeWatch,
+		recoveryStartUC:        recoveryStartUC,
+		recoveryConfirmUC:      recoveryConfirmUC,
+		recoveryCancelUC:       recoveryCancelUC,
+		recoveryCompleteUC:     recoveryCompleteUC,
+		stepUpStartUC:          stepUpStartUC,
+		stepUpVerifyUC:         stepUpVerifyUC,
 		meUC:                   meUC,
 		profileUC:              profileUC,
 		passwordUC:             passwordUC,
 		linkUC:                 linkUC,
 		sessionsListUC:         sessionsListUC,
 		sessionRevokeUC:        sessionRevokeUC,
+		sessionRenameUC:        sessionRenameUC,
 		sessionsPurgeUC:        sessionsPurgeUC,
+		logoutUC:               logoutUC,
+		logoutAllUC:            logoutAllUC,
+		revocationsUC:          revocationsUC,
+		invalidateUC:           invalidateUC,
+		devicesListUC:          devicesListUC,
+		deviceRevokeUC:         deviceRevokeUC,
+		accessTokenCreateUC:    accessTokenCreateUC,
+		accessTokenListUC:      accessTokenListUC,
+		accessTokenRevokeUC:    accessTokenRevokeUC,
+		clientRegisterUC:       clientRegisterUC,
+		clientListUC:           clientListUC,
+		clientDisableUC:        clientDisableUC,
+		clientTokenUC:          clientTokenUC,
+		authorizeStartUC:       authorizeStartUC,
+		authorizeUC:            authorizeUC,
+		userInfoUC:             userInfoUC,
+		discoveryUC:            discoveryUC,
+		keysUC:                 keysUC,
+		introspectUC:           introspectUC,
+		revokeTokenUC:          revokeTokenUC,
+		deviceStartUC:          deviceStartUC,
+		deviceVerifyUC:         deviceVerifyUC,
+		qrStartUC:              qrStartUC,
+		qrScanUC:               qrScanUC,
+		qrSessionUC:            qrSessionUC,
 	}
 }
 
@@ -175,6 +293,47 @@ func (s *service) ConfirmChallengeEmail(ctx context.Context, in challenge.Confir
 	return s.challengeConfirmEmail.Handle(ctx, in)
 }
 
+func (s *service) VerifyChallengeEmailOTP(ctx context.Context, in challenge.VerifyEmailOTPInput) (login.Output, error) {
+	return s.challengeEmailOTP.Handle(ctx, in)
+}
+
+func (s *service) VerifyChallengeCaptcha(ctx context.Context, in challenge.VerifyCaptchaInput) (login.Output, error) {
+	return s.challengeCaptcha.Handle(ctx, in)
+}
+
+func (s *service) VerifyChallengeStep(ctx context.Context, in challenge.VerifyStepInput) (login.Output, error) {
+	return s.challengeStep.Handle(ctx, in)
+}
+
+func (s *service) WatchChallenge(ctx context.Context, in challenge.WatchInput) (<-chan challenge.Event, error) {
+	return s.challengeWatch.Handle(ctx, in)
+}
+
+func (s *service) StartRecovery(ctx context.Context, in recovery.StartInput) (recovery.Output, error) {
+	return s.recoveryStartUC.Handle(ctx, in)
+}
+
+func (s *service) ConfirmRecovery(ctx context.Context, in recovery.ConfirmInput) (recovery.Output, error) {
+	return s.recoveryConfirmUC.Handle(ctx, in)
+}
+
+func (s *service) CancelRecovery(ctx context.Context, in recovery.CancelInput) error {
+	_, err := s.recoveryCancelUC.Handle(ctx, in)
+	return err
+}
+
+func (s *service) CompleteRecovery(ctx context.Context, in recovery.CompleteInput) (recovery.Output, error) {
+	return s.recoveryCompleteUC.Handle(ctx, in)
+}
+
+func (s *service) StartStepUp(ctx context.Context, in challenge.StartStepUpInput) (login.Output, error) {
+	return s.stepUpStartUC.Handle(ctx, in)
+}
+
+func (s *service) VerifyStepUp(ctx context.Context, in challenge.VerifyStepUpInput) (login.Output, error) {
+	return s.stepUpVerifyUC.Handle(ctx, in)
+}
+
 func (s *service) GetMe(ctx context.Context, in profile.GetInput) (profile.Output, error) {
 	return s.meUC.Handle(ctx, in)
 }
@@ -201,7 +360,117 @@ func (s *service) RevokeSession(ctx context.Context, in session.RevokeInput) err
 	return err
 }
 
+func (s *service) RenameSession(ctx context.Context, in session.RenameInput) (session.Session, error) {
+	return s.sessionRenameUC.Handle(ctx, in)
+}
+
 func (s *service) RevokeOtherSessions(ctx context.Context, in session.RevokeOthersInput) error {
 	_, err := s.sessionsPurgeUC.Handle(ctx, in)
 	return err
 }
+
+func (s *service) Logout(ctx context.Context, in session.LogoutInput) error {
+	_, err := s.logoutUC.Handle(ctx, in)
+	return err
+}
+
+func (s *service) LogoutAll(ctx context.Context, in session.LogoutAllInput) error {
+	_, err := s.logoutAllUC.Handle(ctx, in)
+	return err
+}
+
+func (s *service) ListRevocations(ctx context.Context, in session.FeedInput) (session.FeedOutput, error) {
+	return s.revocationsUC.Handle(ctx, in)
+}
+
+func (s *service) InvalidateTokens(ctx context.Context, in epoch.InvalidateInput) (epoch.Output, error) {
+	return s.invalidateUC.Handle(ctx, in)
+}
+
+func (s *service) ListTrustedDevices(ctx context.Context, in device.ListInput) (device.Output, error) {
+	return s.devicesListUC.Handle(ctx, in)
+}
+
+func (s *service) RevokeTrustedDevice(ctx context.Context, in device.RevokeInput) error {
+	_, err := s.deviceRevokeUC.Handle(ctx, in)
+	return err
+}
+
+func (s *service) CreateAccessToken(ctx context.Context, in accesstoken.CreateInput) (accesstoken.CreateOutput, error) {
+	return s.accessTokenCreateUC.Handle(ctx, in)
+}
+
+func (s *service) ListAccessTokens(ctx context.Context, in accesstoken.ListInput) (accesstoken.Output, error) {
+	return s.accessTokenListUC.Handle(ctx, in)
+}
+
+func (s *service) RevokeAccessToken(ctx context.Context, in accesstoken.RevokeInput) error {
+	_, err := s.accessTokenRevokeUC.Handle(ctx, in)
+	return err
+}
+
+func (s *service) RegisterClient(ctx context.Context, in oauth.RegisterClientInput) (oauth.RegisterClientOutput, error) {
+	return s.clientRegisterUC.Handle(ctx, in)
+}
+
+func (s *service) ListClients(ctx context.Context, in oauth.ListClientsInput) (oauth.ClientsOutput, error) {
+	return s.clientListUC.Handle(ctx, in)
+}
+
+func (s *service) DisableClient(ctx context.Context, in oauth.DisableClientInput) error {
+	_, err := s.clientDisableUC.Handle(ctx, in)
+	return err
+}
+
+func (s *service) ClientToken(ctx context.Context, in oauth.TokenInput) (oauth.TokenOutput, error) {
+	return s.clientTokenUC.Handle(ctx, in)
+}
+
+func (s *service) StartAuthorization(ctx context.Context, in oauth.StartAuthorizationInput) (oauth.RedirectOutput, error) {
+	return s.authorizeStartUC.Handle(ctx, in)
+}
+
+func (s *service) Authorize(ctx context.Context, in oauth.AuthorizeInput) (oauth.AuthorizeOutput, error) {
+	return s.authorizeUC.Handle(ctx, in)
+}
+
+func (s *service) UserInfo(ctx context.Context, in oauth.UserInfoInput) (oauth.UserInfoOutput, error) {
+	return s.userInfoUC.Handle(ctx, in)
+}
+
+func (s *service) ProviderMetadata(ctx context.Context, in oauth.DiscoveryInput) (oauth.ProviderMetadata, error) {
+	return s.discoveryUC.Handle(ctx, in)
+}
+
+func (s *service) ProviderKeys(ctx context.Context, in oauth.KeysInput) (oauth.KeySet, error) {
+	return s.keysUC.Handle(ctx, in)
+}
+
+func (s *service) IntrospectToken(ctx context.Context, in oauth.IntrospectInput) (oauth.IntrospectOutput, error) {
+	return s.introspectUC.Handle(ctx, in)
+}
+
+func (s *service) RevokeToken(ctx context.Context, in oauth.RevokeInput) error {
+	_, err := s.revokeTokenUC.Handle(ctx, in)
+	return err
+}
+
+func (s *service) StartDeviceAuthorization(ctx context.Context, in oauth.DeviceAuthorizationInput) (oauth.DeviceAuthorizationOutput, error) {
+	return s.deviceStartUC.Handle(ctx, in)
+}
+
+func (s *service) VerifyDevice(ctx context.Context, in oauth.VerifyDeviceInput) (oauth.VerifyDeviceOutput, error) {
+	return s.deviceVerifyUC.Handle(ctx, in)
+}
+
+func (s *service) StartQRLogin(ctx context.Context, in challenge.StartQRLoginInput) (challenge.StartQRLoginOutput, error) {
+	return s.qrStartUC.Handle(ctx, in)
+}
+
+func (s *service) ScanQRLogin(ctx context.Context, in challenge.ScanQRLoginInput) (challenge.ScanQRLoginOutput, error) {
+	return s.qrScanUC.Handle(ctx, in)
+}
+
+func (s *service) QRLoginSession(ctx context.Context, in challenge.QRSessionInput) (login.Output, error) {
+	return s.qrSessionUC.Handle(ctx, in)
+}
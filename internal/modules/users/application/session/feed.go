@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+const (
+	defaultFeedLimit = 100
+	maxFeedLimit     = 1000
+	// feedSettleDelay holds back the newest revocations: a transaction
+	// that revoked a session a moment ago may commit after a reader moved
+	// its cursor past it.
+	feedSettleDelay = 5 * time.Second
+)
+
+// Feed lists revoked sessions and token epochs to services that verify
+// access tokens without asking this one. Only revocations and epochs
+// younger than the access token lifetime are listed: older ones cannot
+// invalidate a live token.
+type Feed struct {
+	repo      domain.RevocationFeedRepository
+	epochs    domain.TokenEpochRepository
+	accessTTL time.Duration
+	now       func() time.Time
+}
+
+func NewFeed(repo domain.RevocationFeedRepository, epochs domain.TokenEpochRepository, accessTTL time.Duration) *Feed {
+	if accessTTL <= 0 {
+		accessTTL = 15 * time.Minute
+	}
+	return &Feed{repo: repo, epochs: epochs, accessTTL: accessTTL, now: time.Now}
+}
+
+func (f *Feed) List(ctx context.Context, in FeedInput) (FeedOutput, error) {
+	now := f.now().UTC()
+	floor := now.Add(-f.accessTTL)
+	since, afterID := floor, ""
+	if in.Cursor != "" {
+		at, id, err := decodeFeedCursor(in.Cursor)
+		if err != nil {
+			return FeedOutput{}, err
+		}
+		if at.After(floor) {
+			since, afterID = at, id
+		}
+	}
+	limit := in.Limit
+	if limit <= 0 {
+		limit = defaultFeedLimit
+	} else if limit > maxFeedLimit {
+		limit = maxFeedLimit
+	}
+
+	// One extra row tells whether another page is ready.
+	revoked, err := f.repo.ListRevoked(ctx, since, afterID, now.Add(-feedSettleDelay), limit+1)
+	if err != nil {
+		return FeedOutput{}, common.NormalizeError(err)
+	}
+	out := FeedOutput{TTL: f.accessTTL, HasMore: len(revoked) > limit}
+	if out.HasMore {
+		revoked = revoked[:limit]
+	}
+	epochs, err := f.epochs.ListAfter(ctx, floor)
+	if err != nil {
+		return FeedOutput{}, common.NormalizeError(err)
+	}
+	for _, e := range epochs {
+		if e.Global() {
+			out.NotBefore = e.NotBefore
+			continue
+		}
+		out.Epochs = append(out.Epochs, Epoch{UserID: e.UserID.String(), NotBefore: e.NotBefore})
+	}
+	out.Revocations = make([]Revocation, 0, len(revoked))
+	for _, r := range revoked {
+		out.Revocations = append(out.Revocations, Revocation{SessionID: r.SessionID, RevokedAt: r.RevokedAt})
+	}
+	if n := len(revoked); n > 0 {
+		out.NextCursor = encodeFeedCursor(revoked[n-1].RevokedAt, revoked[n-1].SessionID)
+	} else {
+		out.NextCursor = encodeFeedCursor(since, afterID)
+	}
+	return out, nil
+}
+
+// Cursors are opaque to clients: the position of the last revocation
+// returned, as "<unix nanoseconds>:<session id>".
+func encodeFeedCursor(at time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(at.UnixNano(), 10) + ":" + id))
+}
+
+func decodeFeedCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", domain.ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, "", domain.ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", domain.ErrInvalidCursor
+	}
+	return time.Unix(0, n).UTC(), id, nil
+}
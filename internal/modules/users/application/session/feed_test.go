@@ -0,0 +1,112 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+type feedRepoStub struct {
+	revoked []domain.SessionRevocation
+	since   time.Time
+	afterID string
+	until   time.Time
+	limit   int
+}
+
+func (s *feedRepoStub) ListRevoked(_ context.Context, since time.Time, afterID string, until time.Time, limit int) ([]domain.SessionRevocation, error) {
+	s.since, s.afterID, s.until, s.limit = since, afterID, until, limit
+	var out []domain.SessionRevocation
+	for _, r := range s.revoked {
+		if r.RevokedAt.After(since) || (r.RevokedAt.Equal(since) && r.SessionID > afterID) {
+			if !r.RevokedAt.After(until) && len(out) < limit {
+				out = append(out, r)
+			}
+		}
+	}
+	return out, nil
+}
+
+type feedEpochStub struct {
+	epochs []domain.TokenEpoch
+	after  time.Time
+}
+
+func (s *feedEpochStub) Set(context.Context, domain.TokenEpoch) error { return nil }
+
+func (s *feedEpochStub) NotBefore(context.Context, domain.UserID) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (s *feedEpochStub) ListAfter(_ context.Context, t time.Time) ([]domain.TokenEpoch, error) {
+	s.after = t
+	return s.epochs, nil
+}
+
+func TestFeedPagesThroughRecentRevocations(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo := &feedRepoStub{revoked: []domain.SessionRevocation{
+		{SessionID: "a", RevokedAt: now.Add(-20 * time.Minute)},
+		{SessionID: "b", RevokedAt: now.Add(-10 * time.Minute)},
+		{SessionID: "c", RevokedAt: now.Add(-10 * time.Minute)},
+		{SessionID: "d", RevokedAt: now.Add(-time.Minute)},
+		{SessionID: "e", RevokedAt: now.Add(-time.Second)},
+	}}
+	feed := NewFeed(repo, &feedEpochStub{}, 15*time.Minute)
+	feed.now = func() time.Time { return now }
+
+	out, err := feed.List(context.Background(), FeedInput{Limit: 2})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	// a is older than any live access token, e still settling.
+	if !repo.since.Equal(now.Add(-15*time.Minute)) || !repo.until.Equal(now.Add(-feedSettleDelay)) || repo.limit != 3 {
+		t.Fatalf("unexpected window since=%v until=%v limit=%d", repo.since, repo.until, repo.limit)
+	}
+	if len(out.Revocations) != 2 || out.Revocations[0].SessionID != "b" || out.Revocations[1].SessionID != "c" || !out.HasMore || out.TTL != 15*time.Minute {
+		t.Fatalf("unexpected first page: %+v", out)
+	}
+
+	out, err = feed.List(context.Background(), FeedInput{Cursor: out.NextCursor, Limit: 2})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(out.Revocations) != 1 || out.Revocations[0].SessionID != "d" || out.HasMore {
+		t.Fatalf("unexpected second page: %+v", out)
+	}
+
+	// An empty page keeps the position.
+	cursor := out.NextCursor
+	out, err = feed.List(context.Background(), FeedInput{Cursor: cursor})
+	if err != nil || len(out.Revocations) != 0 || out.NextCursor != cursor {
+		t.Fatalf("expected an empty page at the same cursor, got %+v err=%v", out, err)
+	}
+
+	if _, err := feed.List(context.Background(), FeedInput{Cursor: "not a cursor"}); !errors.Is(err, domain.ErrInvalidCursor) {
+		t.Fatalf("expected an invalid cursor, got %v", err)
+	}
+}
+
+func TestFeedListsRecentEpochs(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	epochs := &feedEpochStub{epochs: []domain.TokenEpoch{
+		{NotBefore: now.Add(-time.Minute)},
+		{UserID: "user", NotBefore: now.Add(-2 * time.Minute)},
+	}}
+	feed := NewFeed(&feedRepoStub{}, epochs, 15*time.Minute)
+	feed.now = func() time.Time { return now }
+
+	out, err := feed.List(context.Background(), FeedInput{})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if !epochs.after.Equal(now.Add(-15 * time.Minute)) {
+		t.Fatalf("expected epochs younger than the access token lifetime, got after=%v", epochs.after)
+	}
+	if !out.NotBefore.Equal(now.Add(-time.Minute)) || len(out.Epochs) != 1 || out.Epochs[0].UserID != "user" || !out.Epochs[0].NotBefore.Equal(now.Add(-2*time.Minute)) {
+		t.Fatalf("unexpected epochs: %+v", out)
+	}
+}
@@ -0,0 +1,165 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// LimitPolicy decides what happens when a new session would exceed a limit.
+type LimitPolicy string
+
+const (
+	// LimitPolicyReject fails the login with domain.ErrSessionLimitReached.
+	LimitPolicyReject LimitPolicy = "reject"
+	// LimitPolicyEvictOldest revokes the sessions created first.
+	LimitPolicyEvictOldest LimitPolicy = "evict_oldest"
+	// LimitPolicyEvictLRU revokes the sessions used least recently.
+	LimitPolicyEvictLRU LimitPolicy = "evict_lru"
+)
+
+// Limits caps the number of active sessions of a user. Max applies to all
+// sessions, PerClientType to the sessions of one domain.ClientType*. Zero
+// means unlimited.
+type Limits struct {
+	Max           int
+	PerClientType map[string]int
+	Policy        LimitPolicy
+}
+
+func (l Limits) enabled() bool {
+	if l.Max > 0 {
+		return true
+	}
+	for _, n := range l.PerClientType {
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// UserLocker serialises the session changes of one user until the
+// transaction of ctx ends.
+type UserLocker interface {
+	LockUser(ctx context.Context, userID domain.UserID) error
+}
+
+// Limiter enforces Limits whenever a session is created, so every login
+// flow is covered without knowing about it. All other calls go straight to
+// the wrapped repository.
+type Limiter struct {
+	domain.RefreshTokenRepository
+	locker UserLocker
+	events common.EventPublisher
+	limits Limits
+}
+
+// NewLimiter counts sessions under locker, so that concurrent logins of a
+// user cannot both see room for one more. Without a locker, limits are only
+// enforced for logins that do not overlap.
+func NewLimiter(refresh domain.RefreshTokenRepository, locker UserLocker, publisher common.EventPublisher, limits Limits) *Limiter {
+	if publisher == nil {
+		publisher = common.NopEventPublisher{}
+	}
+	if limits.Policy == "" {
+		limits.Policy = LimitPolicyEvictOldest
+	}
+	return &Limiter{RefreshTokenRepository: refresh, locker: locker, events: publisher, limits: limits}
+}
+
+// Valid reports whether p is one of the known policies.
+func (p LimitPolicy) Valid() bool {
+	switch p {
+	case LimitPolicyReject, LimitPolicyEvictOldest, LimitPolicyEvictLRU:
+		return true
+	}
+	return false
+}
+
+// Create stores t after making room for it, or fails with
+// domain.ErrSessionLimitReached when the policy is reject.
+func (l *Limiter) Create(ctx context.Context, t domain.RefreshToken) error {
+	if !l.limits.enabled() {
+		return l.RefreshTokenRepository.Create(ctx, t)
+	}
+
+	if l.locker != nil {
+		if err := l.locker.LockUser(ctx, t.UserID); err != nil {
+			return common.NormalizeError(err)
+		}
+	}
+	now := time.Now().UTC()
+	active, err := l.ListActiveByUser(ctx, t.UserID, now)
+	if err != nil {
+		return common.NormalizeError(err)
+	}
+
+	var evict []domain.RefreshToken
+	if limit := l.limits.PerClientType[t.ClientType]; t.ClientType != "" && limit > 0 {
+		var sameType, rest []domain.RefreshToken
+		for _, s := range active {
+			if s.ClientType == t.ClientType {
+				sameType = append(sameType, s)
+			} else {
+				rest = append(rest, s)
+			}
+		}
+		victims, kept, err := l.overflow(sameType, limit)
+		if err != nil {
+			return err
+		}
+		evict = append(evict, victims...)
+		active = append(rest, kept...)
+	}
+	if l.limits.Max > 0 {
+		victims, _, err := l.overflow(active, l.limits.Max)
+		if err != nil {
+			return err
+		}
+		evict = append(evict, victims...)
+	}
+
+	ids := make([]string, 0, len(evict))
+	for _, s := range evict {
+		if err := l.Revoke(ctx, s.ID); err != nil {
+			return common.NormalizeError(err)
+		}
+		ids = append(ids, s.ID)
+	}
+	if err := l.RefreshTokenRepository.Create(ctx, t); err != nil {
+		return err
+	}
+	return common.PublishSessionsRevoked(ctx, l.events, t.UserID, ids, events.SessionRevokedEvicted, now)
+}
+
+// overflow picks the sessions to evict so that one more fits under limit and
+// returns them along with the ones that stay.
+func (l *Limiter) overflow(sessions []domain.RefreshToken, limit int) ([]domain.RefreshToken, []domain.RefreshToken, error) {
+	excess := len(sessions) - limit + 1
+	if excess <= 0 {
+		return nil, sessions, nil
+	}
+	if l.limits.Policy == LimitPolicyReject {
+		return nil, nil, domain.ErrSessionLimitReached
+	}
+
+	ordered := append([]domain.RefreshToken(nil), sessions...)
+	key := func(s domain.RefreshToken) time.Time { return s.CreatedAt }
+	if l.limits.Policy == LimitPolicyEvictLRU {
+		key = func(s domain.RefreshToken) time.Time {
+			if s.LastUsedAt.IsZero() {
+				return s.CreatedAt
+			}
+			return s.LastUsedAt
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return key(ordered[i]).Before(key(ordered[j])) })
+	return ordered[:excess], ordered[excess:], nil
+}
+
+var _ domain.RefreshTokenRepository = (*Limiter)(nil)
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func limiterSessions(userID domain.UserID, now time.Time) []domain.RefreshToken {
+	oldest := domain.NewRefreshTokenRecord(userID, "a", now.Add(-3*time.Hour), 24*time.Hour)
+	oldest.LastUsedAt = now.Add(-time.Minute)
+	middle := domain.NewRefreshTokenRecord(userID, "b", now.Add(-2*time.Hour), 24*time.Hour)
+	middle.ClientType = domain.ClientTypeMobile
+	newest := domain.NewRefreshTokenRecord(userID, "c", now.Add(-time.Hour), 24*time.Hour)
+	newest.ClientType = domain.ClientTypeMobile
+	return []domain.RefreshToken{oldest, middle, newest}
+}
+
+func TestLimiterEvictsOldestSession(t *testing.T) {
+	userID := domain.NewUserID()
+	now := time.Now().UTC()
+	existing := limiterSessions(userID, now)
+	repo := &refreshRepoStub{tokens: existing}
+	publisher := &publisherStub{}
+	limiter := NewLimiter(repo, nil, publisher, Limits{Max: 3})
+
+	if err := limiter.Create(context.Background(), domain.NewRefreshTokenRecord(userID, "d", now, time.Hour)); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if len(repo.revoked) != 1 || repo.revoked[0] != existing[0].ID {
+		t.Fatalf("expected the oldest session to be evicted, got %v", repo.revoked)
+	}
+	if len(repo.created) != 1 {
+		t.Fatalf("expected the new session to be stored, got %d", len(repo.created))
+	}
+	if len(publisher.revoked) != 1 || publisher.revoked[0].SessionID != existing[0].ID || publisher.revoked[0].Reason != events.SessionRevokedEvicted {
+		t.Fatalf("expected an eviction event, got %+v", publisher.revoked)
+	}
+}
+
+func TestLimiterEvictsLeastRecentlyUsedSession(t *testing.T) {
+	userID := domain.NewUserID()
+	now := time.Now().UTC()
+	existing := limiterSessions(userID, now)
+	repo := &refreshRepoStub{tokens: existing}
+	limiter := NewLimiter(repo, nil, nil, Limits{Max: 2, Policy: LimitPolicyEvictLRU})
+
+	if err := limiter.Create(context.Background(), domain.NewRefreshTokenRecord(userID, "d", now, time.Hour)); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	// The oldest session was used a minute ago, so the two mobile ones go.
+	if len(repo.revoked) != 2 || repo.revoked[0] != existing[1].ID || repo.revoked[1] != existing[2].ID {
+		t.Fatalf("expected the least recently used sessions to be evicted, got %v", repo.revoked)
+	}
+}
+
+func TestLimiterAppliesClientTypeLimit(t *testing.T) {
+	userID := domain.NewUserID()
+	now := time.Now().UTC()
+	existing := limiterSessions(userID, now)
+	repo := &refreshRepoStub{tokens: existing}
+	limiter := NewLimiter(repo, nil, nil, Limits{Max: 3, PerClientType: map[string]int{domain.ClientTypeMobile: 2}})
+
+	mobile := domain.NewRefreshTokenRecord(userID, "d", now, time.Hour)
+	mobile.ClientType = domain.ClientTypeMobile
+	if err := limiter.Create(context.Background(), mobile); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	// Evicting the oldest mobile session also makes room under Max.
+	if len(repo.revoked) != 1 || repo.revoked[0] != existing[1].ID {
+		t.Fatalf("expected the oldest mobile session to be evicted, got %v", repo.revoked)
+	}
+}
+
+func TestLimiterRejectsOverLimit(t *testing.T) {
+	userID := domain.NewUserID()
+	now := time.Now().UTC()
+	repo := &refreshRepoStub{tokens: limiterSessions(userID, now)}
+	publisher := &publisherStub{}
+	limiter := NewLimiter(repo, nil, publisher, Limits{Max: 3, Policy: LimitPolicyReject})
+
+	err := limiter.Create(context.Background(), domain.NewRefreshTokenRecord(userID, "d", now, time.Hour))
+	if !errors.Is(err, domain.ErrSessionLimitReached) {
+		t.Fatalf("expected the session limit to be reached, got %v", err)
+	}
+	if len(repo.created) != 0 || len(repo.revoked) != 0 || len(publisher.revoked) != 0 {
+		t.Fatalf("expected nothing to change, got created=%d revoked=%v", len(repo.created), repo.revoked)
+	}
+
+	limiter = NewLimiter(repo, nil, publisher, Limits{Max: 4, Policy: LimitPolicyReject})
+	if err := limiter.Create(context.Background(), domain.NewRefreshTokenRecord(userID, "d", now, time.Hour)); err != nil {
+		t.Fatalf("expected a session under the limit to be created, got %v", err)
+	}
+}
@@ -16,18 +16,87 @@ type RevokeInput struct {
 type RevokeOthersInput struct {
 	UserID              string
 	CurrentRefreshToken string
+	// AuthTime is when the caller's session last authenticated.
+	AuthTime time.Time
 }
 
+// LogoutInput identifies the session to end either by the access token's
+// session (SessionID, with UserID) or by its refresh token.
+type LogoutInput struct {
+	UserID       string
+	SessionID    string
+	RefreshToken string
+}
+
+type LogoutAllInput struct {
+	UserID string
+}
+
+// RenameInput sets the name the user gives one of their sessions; an
+// empty Name clears it.
+type RenameInput struct {
+	UserID    string
+	SessionID string
+	Name      string
+}
+
+// Session describes a device the user is signed in on. UserAgent, IP and
+// the location are those of the login; LastUsedAt and LastIP follow the
+// latest refresh.
 type Session struct {
-	ID        string
-	UserAgent string
-	IP        string
-	CreatedAt time.Time
-	ExpiresAt time.Time
-	RevokedAt *time.Time
-	Current   bool
+	ID          string
+	UserAgent   string
+	Browser     string
+	OS          string
+	DeviceType  string
+	ClientType  string
+	DeviceName  string
+	LoginMethod string
+	IP          string
+	Country     string
+	City        string
+	LastIP      string
+	CreatedAt   time.Time
+	LastUsedAt  time.Time
+	ExpiresAt   time.Time
+	RevokedAt   *time.Time
+	Current     bool
 }
 
 type Output struct {
 	Sessions []Session
 }
+
+// FeedInput pages through the revocation feed. An empty Cursor starts at
+// the oldest revocation that can still matter.
+type FeedInput struct {
+	Cursor string
+	Limit  int
+}
+
+type Revocation struct {
+	SessionID string
+	RevokedAt time.Time
+}
+
+// Epoch invalidates the access tokens of UserID issued before NotBefore.
+type Epoch struct {
+	UserID    string
+	NotBefore time.Time
+}
+
+// FeedOutput lists revocations in order. Pass NextCursor back to continue;
+// HasMore means the next page is ready now. Each revocation matters for
+// TTL after RevokedAt, after which every access token of the session has
+// expired.
+//
+// NotBefore (the global epoch) and Epochs (per user) are repeated in full
+// on every page, for as long as tokens issued before them may be alive.
+type FeedOutput struct {
+	Revocations []Revocation
+	NextCursor  string
+	HasMore     bool
+	TTL         time.Duration
+	NotBefore   time.Time
+	Epochs      []Epoch
+}
@@ -5,15 +5,24 @@ import (
 	"time"
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
 type UseCase struct {
-	refresh domain.RefreshTokenRepository
+	refresh      domain.RefreshTokenRepository
+	events       common.EventPublisher
+	reauthMaxAge time.Duration
 }
 
-func New(refresh domain.RefreshTokenRepository) *UseCase {
-	return &UseCase{refresh: refresh}
+func New(refresh domain.RefreshTokenRepository, publisher common.EventPublisher, reauthMaxAge time.Duration) *UseCase {
+	if publisher == nil {
+		publisher = common.NopEventPublisher{}
+	}
+	if reauthMaxAge <= 0 {
+		reauthMaxAge = common.DefaultReauthMaxAge
+	}
+	return &UseCase{refresh: refresh, events: publisher, reauthMaxAge: reauthMaxAge}
 }
 
 func (uc *UseCase) List(ctx context.Context, in ListInput) (Output, error) {
@@ -44,53 +53,39 @@ func (uc *UseCase) List(ctx context.Context, in ListInput) (Output, error) {
 
 	sessions := make([]Session, 0, len(tokens))
 	now := time.Now().UTC()
-	foundCurrent := false
 	for _, t := range tokens {
 		if !t.IsValid(now) {
 			continue
 		}
-		if t.ID == currentID {
-			foundCurrent = true
-		}
-		session := Session{
-			ID:        t.ID,
-			UserAgent: t.UserAgent,
-			IP:        t.IP,
-			CreatedAt: t.CreatedAt,
-			ExpiresAt: t.ExpiresAt,
-			Current:   t.ID == currentID,
-		}
-		if t.RevokedAt != nil {
-			session.RevokedAt = t.RevokedAt
-		}
-		sessions = append(sessions, session)
+		sessions = append(sessions, newSession(t, t.ID == currentID))
 	}
 
-	if currentID != "" && !foundCurrent {
-		current, found, err := uc.refresh.GetByID(ctx, currentID)
-		if err != nil {
-			return Output{}, common.NormalizeError(err)
-		}
-		if found && current.UserID == userID && current.IsValid(now) {
-			session := Session{
-				ID:        current.ID,
-				UserAgent: current.UserAgent,
-				IP:        current.IP,
-				CreatedAt: current.CreatedAt,
-				ExpiresAt: current.ExpiresAt,
-				Current:   true,
-			}
-			if current.RevokedAt != nil {
-				session.RevokedAt = current.RevokedAt
-			}
-			sessions = append([]Session{session}, sessions...)
-			if len(sessions) > 15 {
-				sessions = sessions[:15]
-			}
-		}
+	return Output{Sessions: sessions}, nil
+}
+
+// Rename sets the device name of one of the user's active sessions.
+func (uc *UseCase) Rename(ctx context.Context, in RenameInput) (Session, error) {
+	userID, err := domain.ParseUserID(in.UserID)
+	if err != nil {
+		return Session{}, err
 	}
 
-	return Output{Sessions: sessions}, nil
+	token, found, err := uc.refresh.GetByID(ctx, in.SessionID)
+	if err != nil {
+		return Session{}, common.NormalizeError(err)
+	}
+	if !found || token.UserID != userID || !token.IsValid(time.Now().UTC()) {
+		return Session{}, domain.ErrUnauthorized
+	}
+
+	token, err = token.WithDeviceName(in.Name)
+	if err != nil {
+		return Session{}, err
+	}
+	if err := uc.refresh.Update(ctx, token); err != nil {
+		return Session{}, common.NormalizeError(err)
+	}
+	return newSession(token, false), nil
 }
 
 func (uc *UseCase) Revoke(ctx context.Context, in RevokeInput) (struct{}, error) {
@@ -107,11 +102,7 @@ func (uc *UseCase) Revoke(ctx context.Context, in RevokeInput) (struct{}, error)
 		return struct{}{}, domain.ErrUnauthorized
 	}
 
-	if err := uc.refresh.Revoke(ctx, in.SessionID); err != nil {
-		return struct{}{}, common.NormalizeError(err)
-	}
-
-	return struct{}{}, nil
+	return struct{}{}, uc.revoke(ctx, token, events.SessionRevokedByUser)
 }
 
 func (uc *UseCase) RevokeOthers(ctx context.Context, in RevokeOthersInput) (struct{}, error) {
@@ -122,6 +113,9 @@ func (uc *UseCase) RevokeOthers(ctx context.Context, in RevokeOthersInput) (stru
 	if err != nil {
 		return struct{}{}, err
 	}
+	if err := common.RequireRecentAuth(in.AuthTime, uc.reauthMaxAge); err != nil {
+		return struct{}{}, err
+	}
 
 	hash := common.HashToken(in.CurrentRefreshToken)
 	current, found, err := uc.refresh.GetByHash(ctx, hash)
@@ -132,9 +126,95 @@ func (uc *UseCase) RevokeOthers(ctx context.Context, in RevokeOthersInput) (stru
 		return struct{}{}, domain.ErrRefreshTokenInvalid
 	}
 
-	if err := uc.refresh.RevokeAllExcept(ctx, userID, []string{current.ID}); err != nil {
+	revoked, err := uc.refresh.RevokeAllExcept(ctx, userID, []string{current.ID})
+	if err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+
+	return struct{}{}, common.PublishSessionsRevoked(ctx, uc.events, userID, revoked, events.SessionRevokedOthers, time.Now().UTC())
+}
+
+// Logout ends the caller's session. Logging out of a session that is
+// already revoked succeeds, so clients can retry.
+func (uc *UseCase) Logout(ctx context.Context, in LogoutInput) (struct{}, error) {
+	var (
+		token domain.RefreshToken
+		found bool
+		err   error
+	)
+	switch {
+	case in.SessionID != "":
+		token, found, err = uc.refresh.GetByID(ctx, in.SessionID)
+		if err == nil && found && token.UserID.String() != in.UserID {
+			found = false
+		}
+	case in.RefreshToken != "":
+		token, found, err = uc.refresh.GetByHash(ctx, common.HashToken(in.RefreshToken))
+	default:
+		return struct{}{}, domain.ErrUnauthorized
+	}
+	if err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	if !found {
+		return struct{}{}, domain.ErrRefreshTokenInvalid
+	}
+
+	return struct{}{}, uc.revoke(ctx, token, events.SessionRevokedLogout)
+}
+
+// LogoutAll revokes every session of the user, including the caller's.
+func (uc *UseCase) LogoutAll(ctx context.Context, in LogoutAllInput) (struct{}, error) {
+	userID, err := domain.ParseUserID(in.UserID)
+	if err != nil {
+		return struct{}{}, err
+	}
+
+	revoked, err := uc.refresh.RevokeAllExcept(ctx, userID, nil)
+	if err != nil {
 		return struct{}{}, common.NormalizeError(err)
 	}
 
-	return struct{}{}, nil
+	return struct{}{}, common.PublishSessionsRevoked(ctx, uc.events, userID, revoked, events.SessionRevokedLogoutAll, time.Now().UTC())
+}
+
+func (uc *UseCase) revoke(ctx context.Context, token domain.RefreshToken, reason string) error {
+	if token.RevokedAt != nil {
+		return nil
+	}
+	if err := uc.refresh.Revoke(ctx, token.ID); err != nil {
+		return common.NormalizeError(err)
+	}
+	return common.PublishSessionsRevoked(ctx, uc.events, token.UserID, []string{token.ID}, reason, time.Now().UTC())
+}
+
+func newSession(t domain.RefreshToken, current bool) Session {
+	ua := parseUserAgent(t.UserAgent)
+	lastUsedAt := t.LastUsedAt
+	if lastUsedAt.IsZero() {
+		lastUsedAt = t.CreatedAt
+	}
+	lastIP := t.LastIP
+	if lastIP == "" {
+		lastIP = t.IP
+	}
+	return Session{
+		ID:          t.ID,
+		UserAgent:   t.UserAgent,
+		Browser:     ua.Browser,
+		OS:          ua.OS,
+		DeviceType:  ua.DeviceType,
+		ClientType:  t.ClientType,
+		DeviceName:  t.DeviceName,
+		LoginMethod: t.LoginMethod,
+		IP:          t.IP,
+		Country:     t.Country,
+		City:        t.City,
+		LastIP:      lastIP,
+		CreatedAt:   t.CreatedAt,
+		LastUsedAt:  lastUsedAt,
+		ExpiresAt:   t.ExpiresAt,
+		RevokedAt:   t.RevokedAt,
+		Current:     current,
+	}
 }
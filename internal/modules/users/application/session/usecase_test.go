@@ -0,0 +1,163 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestLogoutRevokesSessionByRefreshToken(t *testing.T) {
+	userID := domain.NewUserID()
+	token := domain.NewRefreshTokenRecord(userID, common.HashToken("refresh"), time.Now().UTC(), time.Hour)
+	repo := &refreshRepoStub{tokens: []domain.RefreshToken{token}}
+	publisher := &publisherStub{}
+	uc := New(repo, publisher, 0)
+
+	if _, err := uc.Logout(context.Background(), LogoutInput{RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	if len(repo.revoked) != 1 || repo.revoked[0] != token.ID {
+		t.Fatalf("expected the session to be revoked, got %v", repo.revoked)
+	}
+	if len(publisher.revoked) != 1 || publisher.revoked[0].SessionID != token.ID || publisher.revoked[0].Reason != events.SessionRevokedLogout {
+		t.Fatalf("expected a session_revoked event, got %+v", publisher.revoked)
+	}
+
+	if _, err := uc.Logout(context.Background(), LogoutInput{RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("expected a repeated logout to succeed, got %v", err)
+	}
+	if len(publisher.revoked) != 1 {
+		t.Fatalf("expected no event for an already revoked session, got %+v", publisher.revoked)
+	}
+
+	if _, err := uc.Logout(context.Background(), LogoutInput{}); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected unauthorized without a session, got %v", err)
+	}
+}
+
+func TestLogoutRejectsForeignSession(t *testing.T) {
+	token := domain.NewRefreshTokenRecord(domain.NewUserID(), "hash", time.Now().UTC(), time.Hour)
+	repo := &refreshRepoStub{tokens: []domain.RefreshToken{token}}
+	uc := New(repo, nil, 0)
+
+	if _, err := uc.Logout(context.Background(), LogoutInput{UserID: domain.NewUserID().String(), SessionID: token.ID}); !errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		t.Fatalf("expected another user's session to be rejected, got %v", err)
+	}
+	if len(repo.revoked) != 0 {
+		t.Fatalf("expected nothing revoked, got %v", repo.revoked)
+	}
+}
+
+func TestLogoutAllPublishesEverySession(t *testing.T) {
+	userID := domain.NewUserID()
+	repo := &refreshRepoStub{revokeAll: []string{"a", "b"}}
+	publisher := &publisherStub{}
+	uc := New(repo, publisher, 0)
+
+	if _, err := uc.LogoutAll(context.Background(), LogoutAllInput{UserID: userID.String()}); err != nil {
+		t.Fatalf("logout all failed: %v", err)
+	}
+	if repo.kept == nil || len(repo.kept) != 0 {
+		t.Fatalf("expected no session to be kept, got %v", repo.kept)
+	}
+	if len(publisher.revoked) != 2 || publisher.revoked[1].Reason != events.SessionRevokedLogoutAll {
+		t.Fatalf("expected an event per session, got %+v", publisher.revoked)
+	}
+}
+
+func TestRenameSetsDeviceName(t *testing.T) {
+	userID := domain.NewUserID()
+	token := domain.NewRefreshTokenRecord(userID, "hash", time.Now().UTC(), time.Hour)
+	token.UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.4; rv:125.0) Gecko/20100101 Firefox/125.0"
+	repo := &refreshRepoStub{tokens: []domain.RefreshToken{token}}
+	uc := New(repo, nil, 0)
+
+	out, err := uc.Rename(context.Background(), RenameInput{UserID: userID.String(), SessionID: token.ID, Name: " Work laptop "})
+	if err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if out.DeviceName != "Work laptop" || out.Browser != "Firefox 125" || out.DeviceType != DeviceTypeDesktop {
+		t.Fatalf("unexpected session: %+v", out)
+	}
+	if len(repo.updated) != 1 || repo.updated[0].DeviceName != "Work laptop" {
+		t.Fatalf("expected the name to be stored, got %+v", repo.updated)
+	}
+
+	if _, err := uc.Rename(context.Background(), RenameInput{UserID: domain.NewUserID().String(), SessionID: token.ID, Name: "x"}); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected another user's session to be rejected, got %v", err)
+	}
+}
+
+// --- test doubles ---
+
+type refreshRepoStub struct {
+	tokens    []domain.RefreshToken
+	revoked   []string
+	revokeAll []string
+	kept      []string
+	updated   []domain.RefreshToken
+	created   []domain.RefreshToken
+}
+
+func (s *refreshRepoStub) Create(_ context.Context, t domain.RefreshToken) error {
+	s.created = append(s.created, t)
+	return nil
+}
+func (s *refreshRepoStub) Update(_ context.Context, t domain.RefreshToken) error {
+	s.updated = append(s.updated, t)
+	return nil
+}
+func (s *refreshRepoStub) GetByHash(_ context.Context, hash string) (domain.RefreshToken, bool, error) {
+	for _, t := range s.tokens {
+		if t.TokenHash == hash {
+			return t, true, nil
+		}
+	}
+	return domain.RefreshToken{}, false, nil
+}
+func (s *refreshRepoStub) GetByID(_ context.Context, id string) (domain.RefreshToken, bool, error) {
+	for _, t := range s.tokens {
+		if t.ID == id {
+			return t, true, nil
+		}
+	}
+	return domain.RefreshToken{}, false, nil
+}
+func (s *refreshRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
+	return s.tokens, nil
+}
+func (s *refreshRepoStub) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
+	return s.tokens, nil
+}
+func (s *refreshRepoStub) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *refreshRepoStub) Revoke(_ context.Context, id string) error {
+	s.revoked = append(s.revoked, id)
+	now := time.Now().UTC()
+	for i, t := range s.tokens {
+		if t.ID == id {
+			s.tokens[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+func (s *refreshRepoStub) RevokeAllExcept(_ context.Context, _ domain.UserID, keep []string) ([]string, error) {
+	s.kept = append([]string{}, keep...)
+	return s.revokeAll, nil
+}
+
+type publisherStub struct {
+	common.NopEventPublisher
+	revoked []events.SessionRevoked
+}
+
+func (s *publisherStub) PublishSessionRevoked(_ context.Context, evt events.SessionRevoked) error {
+	s.revoked = append(s.revoked, evt)
+	return nil
+}
@@ -0,0 +1,109 @@
+package session
+
+import "strings"
+
+// Device types reported for a session.
+const (
+	DeviceTypeDesktop = "desktop"
+	DeviceTypeMobile  = "mobile"
+	DeviceTypeTablet  = "tablet"
+	DeviceTypeBot     = "bot"
+	DeviceTypeUnknown = "unknown"
+)
+
+// userAgentInfo is what a session list shows about the client instead of
+// the raw User-Agent header.
+type userAgentInfo struct {
+	Browser    string
+	OS         string
+	DeviceType string
+}
+
+// browserTokens is checked in order: several browsers also advertise the
+// engine they are based on (Edge and Opera claim Chrome, Chrome claims
+// Safari), so the more specific token must come first.
+var browserTokens = []struct {
+	token string
+	name  string
+}{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"},
+}
+
+var botTokens = []string{"bot", "crawler", "spider", "curl/", "wget/", "python-requests", "go-http-client", "okhttp"}
+
+// parseUserAgent extracts the browser with its major version, the
+// operating system and the device type. Unrecognised parts stay empty.
+func parseUserAgent(ua string) userAgentInfo {
+	if strings.TrimSpace(ua) == "" {
+		return userAgentInfo{DeviceType: DeviceTypeUnknown}
+	}
+	lower := strings.ToLower(ua)
+	for _, token := range botTokens {
+		if strings.Contains(lower, token) {
+			return userAgentInfo{DeviceType: DeviceTypeBot}
+		}
+	}
+
+	info := userAgentInfo{Browser: parseBrowser(ua), OS: parseOS(ua)}
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		info.DeviceType = DeviceTypeTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "iPhone"):
+		info.DeviceType = DeviceTypeMobile
+	case info.OS != "":
+		info.DeviceType = DeviceTypeDesktop
+	default:
+		info.DeviceType = DeviceTypeUnknown
+	}
+	return info
+}
+
+func parseBrowser(ua string) string {
+	for _, b := range browserTokens {
+		idx := strings.Index(ua, b.token)
+		if idx < 0 {
+			continue
+		}
+		if b.name == "Safari" && !strings.Contains(ua, "Safari/") {
+			continue
+		}
+		version := ua[idx+len(b.token):]
+		if end := strings.IndexAny(version, ". ;)"); end >= 0 {
+			version = version[:end]
+		}
+		if version == "" {
+			return b.name
+		}
+		return b.name + " " + version
+	}
+	return ""
+}
+
+func parseOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		return "iOS"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "CrOS"):
+		return "ChromeOS"
+	case strings.Contains(ua, "Mac OS X") || strings.Contains(ua, "Macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	}
+	return ""
+}
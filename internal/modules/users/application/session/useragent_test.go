@@ -0,0 +1,49 @@
+package session
+
+import "testing"
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua   string
+		want userAgentInfo
+	}{
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: userAgentInfo{Browser: "Chrome 124", OS: "Windows", DeviceType: DeviceTypeDesktop},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51",
+			want: userAgentInfo{Browser: "Edge 124", OS: "Windows", DeviceType: DeviceTypeDesktop},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			want: userAgentInfo{Browser: "Safari 17", OS: "iOS", DeviceType: DeviceTypeMobile},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			want: userAgentInfo{Browser: "Safari 17", OS: "iOS", DeviceType: DeviceTypeTablet},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			want: userAgentInfo{Browser: "Chrome 124", OS: "Android", DeviceType: DeviceTypeMobile},
+		},
+		{
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.4; rv:125.0) Gecko/20100101 Firefox/125.0",
+			want: userAgentInfo{Browser: "Firefox 125", OS: "macOS", DeviceType: DeviceTypeDesktop},
+		},
+		{
+			ua:   "curl/8.5.0",
+			want: userAgentInfo{DeviceType: DeviceTypeBot},
+		},
+		{
+			ua:   "",
+			want: userAgentInfo{DeviceType: DeviceTypeUnknown},
+		},
+	}
+
+	for _, tc := range cases {
+		if got := parseUserAgent(tc.ua); got != tc.want {
+			t.Errorf("parseUserAgent(%q) = %+v, want %+v", tc.ua, got, tc.want)
+		}
+	}
+}
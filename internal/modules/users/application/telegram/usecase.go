@@ -28,9 +28,9 @@ type UseCase struct {
 	identities domain.IdentityRepository
 	refresh    domain.RefreshTokenRepository
 
-	access     common.AccessTokenIssuer
-	accessTTL  time.Duration
-	refreshTTL time.Duration
+	access        common.AccessTokenIssuer
+	accessTTL     time.Duration
+	sessionPolicy common.SessionPolicy
 
 	validator validator
 }
@@ -55,7 +55,7 @@ func New(
 	access common.AccessTokenIssuer,
 	botToken string,
 	accessTTL time.Duration,
-	refreshTTL time.Duration,
+	sessionPolicy common.SessionPolicy,
 	initDataTTL time.Duration,
 ) (*UseCase, error) {
 	if botToken = strings.TrimSpace(botToken); botToken == "" {
@@ -65,20 +65,17 @@ func New(
 	if accessTTL == 0 {
 		accessTTL = 15 * time.Minute
 	}
-	if refreshTTL == 0 {
-		refreshTTL = 30 * 24 * time.Hour
-	}
 	if initDataTTL == 0 {
 		initDataTTL = 24 * time.Hour
 	}
 
 	return &UseCase{
-		users:      users,
-		identities: identities,
-		refresh:    refresh,
-		access:     access,
-		accessTTL:  accessTTL,
-		refreshTTL: refreshTTL,
+		users:         users,
+		identities:    identities,
+		refresh:       refresh,
+		access:        access,
+		accessTTL:     accessTTL,
+		sessionPolicy: sessionPolicy,
 		validator: validator{
 			botToken:    botToken,
 			initDataTTL: initDataTTL,
@@ -160,12 +157,12 @@ func (uc *UseCase) issueTokens(ctx context.Context, user domain.User) (login.Out
 	}
 	refreshHash := common.HashToken(refreshRaw)
 	now := time.Now().UTC()
-	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, user.ID, refreshHash, now, uc.refreshTTL)
+	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, user.ID, refreshHash, now, uc.sessionPolicy, domain.LoginMethodTelegram, domain.AMRFederated)
 	if err != nil {
 		return login.Output{}, common.NormalizeError(err)
 	}
 
-	accessToken, err := uc.access.Issue(user.ID.String(), refreshRecord.ID, uc.accessTTL)
+	accessToken, err := uc.access.Issue(common.SessionClaims(refreshRecord), uc.accessTTL)
 	if err != nil {
 		return login.Output{}, common.NormalizeError(err)
 	}
@@ -178,14 +175,15 @@ func (uc *UseCase) issueTokens(ctx context.Context, user domain.User) (login.Out
 	}
 
 	return login.Output{
-		UserID:       user.ID.String(),
-		FirstName:    user.FirstName,
-		LastName:     user.LastName,
-		MiddleName:   user.MiddleName,
-		DisplayName:  user.DisplayName,
-		AvatarURL:    user.AvatarURL,
-		AccessToken:  accessToken,
-		RefreshToken: refreshRaw,
+		UserID:           user.ID.String(),
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		MiddleName:       user.MiddleName,
+		DisplayName:      user.DisplayName,
+		AvatarURL:        user.AvatarURL,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshRaw,
+		RefreshExpiresAt: refreshRecord.ExpiresAt,
 	}, nil
 }
 
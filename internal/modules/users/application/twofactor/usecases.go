@@ -27,18 +27,27 @@ type ConfirmInput struct {
 type DisableInput struct {
 	UserID string
 	Code   string
+	// AuthTime is when the caller's session last authenticated.
+	AuthTime time.Time
 }
 
+// UseCase enrolls and disables TOTP. Both revoke the user's trusted
+// devices, so that no device trusted under an old secret skips the new one.
 type UseCase struct {
-	identities domain.IdentityRepository
-	issuer     string
+	identities   domain.IdentityRepository
+	devices      domain.TrustedDeviceRepository
+	issuer       string
+	reauthMaxAge time.Duration
 }
 
-func NewUseCase(identities domain.IdentityRepository, issuer string) *UseCase {
+func NewUseCase(identities domain.IdentityRepository, devices domain.TrustedDeviceRepository, issuer string, reauthMaxAge time.Duration) *UseCase {
 	if issuer == "" {
 		issuer = "xbackend"
 	}
-	return &UseCase{identities: identities, issuer: issuer}
+	if reauthMaxAge <= 0 {
+		reauthMaxAge = common.DefaultReauthMaxAge
+	}
+	return &UseCase{identities: identities, devices: devices, issuer: issuer, reauthMaxAge: reauthMaxAge}
 }
 
 func (uc *UseCase) Setup(ctx context.Context, in SetupInput) (SetupOutput, error) {
@@ -92,8 +101,12 @@ func (uc *UseCase) Confirm(ctx context.Context, in ConfirmInput) error {
 		return domain.ErrInvalidTwoFactor
 	}
 
-	ident = ident.WithTOTPConfirmed(time.Now().UTC())
-	return uc.identities.Update(ctx, ident)
+	now := time.Now().UTC()
+	ident = ident.WithTOTPConfirmed(now)
+	if err := uc.identities.Update(ctx, ident); err != nil {
+		return err
+	}
+	return common.RevokeTrustedDevices(ctx, uc.devices, userID, now)
 }
 
 func (uc *UseCase) Disable(ctx context.Context, in DisableInput) error {
@@ -101,6 +114,9 @@ func (uc *UseCase) Disable(ctx context.Context, in DisableInput) error {
 	if err != nil {
 		return err
 	}
+	if err := common.RequireRecentAuth(in.AuthTime, uc.reauthMaxAge); err != nil {
+		return err
+	}
 
 	ident, found, err := uc.identities.GetByUserAndProvider(ctx, userID, "email")
 	if err != nil {
@@ -115,5 +131,8 @@ func (uc *UseCase) Disable(ctx context.Context, in DisableInput) error {
 	}
 
 	ident = ident.ClearTOTP()
-	return uc.identities.Update(ctx, ident)
+	if err := uc.identities.Update(ctx, ident); err != nil {
+		return err
+	}
+	return common.RevokeTrustedDevices(ctx, uc.devices, userID, time.Now().UTC())
 }
@@ -0,0 +1,100 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestDisableAndReenrollRevokeTrustedDevices(t *testing.T) {
+	userID := domain.NewUserID()
+	secret := "JBSWY3DPEHPK3PXP"
+	now := time.Now().UTC()
+	identities := &identityRepoStub{identity: domain.Identity{UserID: userID, Provider: "email", ProviderUserID: "user@example.com"}}
+	identities.identity = identities.identity.WithTOTPSecret(secret).WithTOTPConfirmed(now)
+	devices := &trustedDeviceRepoStub{devices: []domain.TrustedDevice{domain.NewTrustedDevice(userID, "device-hash", now, time.Hour)}}
+	uc := NewUseCase(identities, devices, "", time.Minute)
+
+	if err := uc.Disable(context.Background(), DisableInput{UserID: userID.String(), Code: currentCode(t, secret), AuthTime: now}); err != nil {
+		t.Fatalf("disable failed: %v", err)
+	}
+	if identities.identity.IsTwoFactorEnabled() || len(devices.revoked) != 1 {
+		t.Fatalf("expected 2FA off and the trusted device revoked, got enabled=%v revoked=%v", identities.identity.IsTwoFactorEnabled(), devices.revoked)
+	}
+
+	// A device trusted in between is revoked once a new secret is confirmed.
+	devices.devices = append(devices.devices, domain.NewTrustedDevice(userID, "other-hash", now, time.Hour))
+	identities.identity = identities.identity.WithTOTPSecret(secret)
+	if err := uc.Confirm(context.Background(), ConfirmInput{UserID: userID.String(), Code: currentCode(t, secret)}); err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	if !identities.identity.IsTwoFactorEnabled() || len(devices.revoked) != 2 || devices.revoked[1] != devices.devices[1].ID {
+		t.Fatalf("expected 2FA on and the new trusted device revoked, got enabled=%v revoked=%v", identities.identity.IsTwoFactorEnabled(), devices.revoked)
+	}
+}
+
+// currentCode computes the TOTP code of secret for now (RFC 6238).
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("bad secret: %v", err)
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+type identityRepoStub struct {
+	identity domain.Identity
+}
+
+func (s *identityRepoStub) Create(context.Context, domain.Identity) error { return nil }
+func (s *identityRepoStub) GetByProvider(context.Context, string, string) (domain.Identity, bool, error) {
+	return s.identity, true, nil
+}
+func (s *identityRepoStub) GetByUserAndProvider(context.Context, domain.UserID, string) (domain.Identity, bool, error) {
+	return s.identity, true, nil
+}
+func (s *identityRepoStub) Update(_ context.Context, identity domain.Identity) error {
+	s.identity = identity
+	return nil
+}
+
+type trustedDeviceRepoStub struct {
+	devices []domain.TrustedDevice
+	revoked []string
+}
+
+func (s *trustedDeviceRepoStub) Create(context.Context, domain.TrustedDevice) error { return nil }
+func (s *trustedDeviceRepoStub) GetByHash(context.Context, domain.UserID, string) (domain.TrustedDevice, bool, error) {
+	return domain.TrustedDevice{}, false, nil
+}
+func (s *trustedDeviceRepoStub) GetByID(context.Context, string) (domain.TrustedDevice, bool, error) {
+	return domain.TrustedDevice{}, false, nil
+}
+func (s *trustedDeviceRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.TrustedDevice, error) {
+	return s.devices, nil
+}
+func (s *trustedDeviceRepoStub) Touch(context.Context, string, time.Time) error { return nil }
+func (s *trustedDeviceRepoStub) Revoke(_ context.Context, id string) error {
+	s.revoked = append(s.revoked, id)
+	for i := range s.devices {
+		if s.devices[i].ID == id {
+			now := time.Now().UTC()
+			s.devices[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
@@ -18,36 +18,36 @@ type ConfirmEmailUseCase struct {
 	users      domain.UserRepository
 	identities domain.IdentityRepository
 	tokens     domain.VerificationTokenRepository
+	codes      domain.VerificationCodeHasher
 	refresh    domain.RefreshTokenRepository
 	access     common.AccessTokenIssuer
 
-	accessTTL  time.Duration
-	refreshTTL time.Duration
+	accessTTL     time.Duration
+	sessionPolicy common.SessionPolicy
 }
 
 func NewConfirmEmailUseCase(
 	users domain.UserRepository,
 	identities domain.IdentityRepository,
 	tokens domain.VerificationTokenRepository,
+	codes domain.VerificationCodeHasher,
 	refresh domain.RefreshTokenRepository,
 	access common.AccessTokenIssuer,
 	accessTTL time.Duration,
-	refreshTTL time.Duration,
+	sessionPolicy common.SessionPolicy,
 ) *ConfirmEmailUseCase {
 	if accessTTL == 0 {
 		accessTTL = 15 * time.Minute
 	}
-	if refreshTTL == 0 {
-		refreshTTL = 30 * 24 * time.Hour
-	}
 	return &ConfirmEmailUseCase{
-		users:      users,
-		identities: identities,
-		tokens:     tokens,
-		refresh:    refresh,
-		access:     access,
-		accessTTL:  accessTTL,
-		refreshTTL: refreshTTL,
+		users:         users,
+		identities:    identities,
+		tokens:        tokens,
+		codes:         codes,
+		refresh:       refresh,
+		access:        access,
+		accessTTL:     accessTTL,
+		sessionPolicy: sessionPolicy,
 	}
 }
 
@@ -65,11 +65,12 @@ func (uc *ConfirmEmailUseCase) Execute(ctx context.Context, in ConfirmEmailInput
 		return login.Output{}, domain.ErrInvalidCredentials
 	}
 
-	token, found, err := uc.tokens.GetByCode(ctx, ident.ID, domain.TokenTypeEmailConfirmation, in.Code)
+	codeHash := uc.codes.Hash(in.Code)
+	token, found, err := uc.tokens.GetByCode(ctx, ident.ID, domain.TokenTypeEmailConfirmation, codeHash)
 	if err != nil {
 		return login.Output{}, common.NormalizeError(err)
 	}
-	if !found || !token.IsValid(in.Code, time.Now().UTC()) {
+	if !found || !token.IsValid(codeHash, time.Now().UTC()) {
 		return login.Output{}, domain.ErrInvalidCredentials
 	}
 
@@ -96,11 +97,11 @@ func (uc *ConfirmEmailUseCase) Execute(ctx context.Context, in ConfirmEmailInput
 		return login.Output{}, common.NormalizeError(err)
 	}
 	refreshHash := common.HashToken(refreshRaw)
-	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, user.ID, refreshHash, usedAt, uc.refreshTTL)
+	refreshRecord, reuse, err := common.PrepareRefreshRecord(ctx, uc.refresh, user.ID, refreshHash, usedAt, uc.sessionPolicy, domain.LoginMethodEmailCode, domain.AMROTP)
 	if err != nil {
 		return login.Output{}, common.NormalizeError(err)
 	}
-	accessToken, err := uc.access.Issue(user.ID.String(), refreshRecord.ID, uc.accessTTL)
+	accessToken, err := uc.access.Issue(common.SessionClaims(refreshRecord), uc.accessTTL)
 	if err != nil {
 		return login.Output{}, common.NormalizeError(err)
 	}
@@ -113,13 +114,14 @@ func (uc *ConfirmEmailUseCase) Execute(ctx context.Context, in ConfirmEmailInput
 	}
 
 	return login.Output{
-		UserID:       user.ID.String(),
-		FirstName:    user.FirstName,
-		LastName:     user.LastName,
-		MiddleName:   user.MiddleName,
-		DisplayName:  user.DisplayName,
-		AvatarURL:    user.AvatarURL,
-		AccessToken:  accessToken,
-		RefreshToken: refreshRaw,
+		UserID:           user.ID.String(),
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		MiddleName:       user.MiddleName,
+		DisplayName:      user.DisplayName,
+		AvatarURL:        user.AvatarURL,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshRaw,
+		RefreshExpiresAt: refreshRecord.ExpiresAt,
 	}, nil
 }
@@ -20,6 +20,7 @@ type RequestPasswordResetInput struct {
 type RequestUseCase struct {
 	identities domain.IdentityRepository
 	tokens     domain.VerificationTokenRepository
+	codes      domain.VerificationCodeHasher
 	events     common.EventPublisher
 
 	emailTTL          time.Duration
@@ -30,6 +31,7 @@ type RequestUseCase struct {
 func NewRequestUseCase(
 	identities domain.IdentityRepository,
 	tokens domain.VerificationTokenRepository,
+	codes domain.VerificationCodeHasher,
 	events common.EventPublisher,
 	emailTTL time.Duration,
 	passwordTTL time.Duration,
@@ -47,6 +49,7 @@ func NewRequestUseCase(
 	return &RequestUseCase{
 		identities:        identities,
 		tokens:            tokens,
+		codes:             codes,
 		events:            events,
 		emailTTL:          emailTTL,
 		passwordTTL:       passwordTTL,
@@ -62,6 +65,12 @@ func (uc *RequestUseCase) RequestPasswordReset(ctx context.Context, in RequestPa
 	return uc.request(ctx, in.Email, domain.TokenTypePasswordReset)
 }
 
+// RequestLoginCode sends a one-time code that confirms a login the risk
+// policy flagged as unusual.
+func (uc *RequestUseCase) RequestLoginCode(ctx context.Context, in RequestEmailInput) error {
+	return uc.request(ctx, in.Email, domain.TokenTypeLoginOTP)
+}
+
 func (uc *RequestUseCase) request(ctx context.Context, emailRaw string, tokenType domain.TokenType) error {
 	email, err := domain.NewEmail(emailRaw)
 	if err != nil {
@@ -85,19 +94,19 @@ func (uc *RequestUseCase) request(ctx context.Context, emailRaw string, tokenTyp
 	}
 
 	now := time.Now().UTC()
-	code := ""
-	if tokenType == domain.TokenTypeEmailConfirmation {
-		generated, err := domain.GenerateNumericCode(6)
-		if err != nil {
-			return common.NormalizeError(err)
-		}
-		code = generated
-	}
+	var code string
 	ttl := uc.emailTTL
-	if tokenType == domain.TokenTypePasswordReset {
+	switch tokenType {
+	case domain.TokenTypeEmailConfirmation, domain.TokenTypeLoginOTP:
+		code, err = domain.GenerateNumericCode(6)
+	case domain.TokenTypePasswordReset:
+		code, err = domain.GenerateSecretToken()
 		ttl = uc.passwordTTL
 	}
-	token := domain.NewVerificationToken(ident.ID, tokenType, code, now, ttl)
+	if err != nil {
+		return common.NormalizeError(err)
+	}
+	token := domain.NewVerificationToken(ident.ID, tokenType, uc.codes.Hash(code), now, ttl)
 	if err := uc.tokens.Create(ctx, token); err != nil {
 		return common.NormalizeError(err)
 	}
@@ -117,7 +126,21 @@ func (uc *RequestUseCase) request(ctx context.Context, emailRaw string, tokenTyp
 			UserID:     ident.UserID.String(),
 			IdentityID: ident.ID,
 			Email:      email.String(),
-			Token:      token.ID,
+			Token:      code,
+			ExpiresAt:  token.ExpiresAt,
+			OccurredAt: now,
+		})
+	case domain.TokenTypeLoginOTP:
+		meta, _ := common.RequestMetaFromContext(ctx)
+		return uc.events.PublishLoginCodeRequested(ctx, events.LoginCodeRequested{
+			UserID:     ident.UserID.String(),
+			IdentityID: ident.ID,
+			Email:      email.String(),
+			Code:       code,
+			IP:         meta.IP,
+			UserAgent:  meta.UserAgent,
+			Country:    meta.Country,
+			City:       meta.City,
 			ExpiresAt:  token.ExpiresAt,
 			OccurredAt: now,
 		})
@@ -2,10 +2,11 @@ package verification
 
 import (
 	"context"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 )
 
@@ -18,18 +19,36 @@ type ResetPasswordInput struct {
 type ResetPasswordUseCase struct {
 	identities domain.IdentityRepository
 	tokens     domain.VerificationTokenRepository
+	codes      domain.VerificationCodeHasher
 	hasher     domain.PasswordHasher
+	refresh    domain.RefreshTokenRepository
+	pats       domain.PersonalAccessTokenRepository
+	devices    domain.TrustedDeviceRepository
+	events     common.EventPublisher
 }
 
 func NewResetPasswordUseCase(
 	identities domain.IdentityRepository,
 	tokens domain.VerificationTokenRepository,
+	codes domain.VerificationCodeHasher,
 	hasher domain.PasswordHasher,
+	refresh domain.RefreshTokenRepository,
+	pats domain.PersonalAccessTokenRepository,
+	devices domain.TrustedDeviceRepository,
+	publisher common.EventPublisher,
 ) *ResetPasswordUseCase {
+	if publisher == nil {
+		publisher = common.NopEventPublisher{}
+	}
 	return &ResetPasswordUseCase{
 		identities: identities,
 		tokens:     tokens,
+		codes:      codes,
 		hasher:     hasher,
+		refresh:    refresh,
+		pats:       pats,
+		devices:    devices,
+		events:     publisher,
 	}
 }
 
@@ -39,7 +58,7 @@ func (uc *ResetPasswordUseCase) Execute(ctx context.Context, in ResetPasswordInp
 		return struct{}{}, domain.ErrInvalidCredentials
 	}
 
-	if _, err := uuid.Parse(in.Token); err != nil {
+	if strings.TrimSpace(in.Token) == "" {
 		return struct{}{}, domain.ErrInvalidCredentials
 	}
 
@@ -51,12 +70,13 @@ func (uc *ResetPasswordUseCase) Execute(ctx context.Context, in ResetPasswordInp
 		return struct{}{}, domain.ErrInvalidCredentials
 	}
 
-	token, found, err := uc.tokens.GetByID(ctx, in.Token)
+	tokenHash := uc.codes.Hash(in.Token)
+	token, found, err := uc.tokens.GetByCode(ctx, ident.ID, domain.TokenTypePasswordReset, tokenHash)
 	if err != nil {
 		return struct{}{}, common.NormalizeError(err)
 	}
 	now := time.Now().UTC()
-	if !found || token.Type != domain.TokenTypePasswordReset || token.IdentityID != ident.ID || !token.IsActive(now) {
+	if !found || !token.IsValid(tokenHash, now) {
 		return struct{}{}, domain.ErrInvalidCredentials
 	}
 
@@ -73,5 +93,24 @@ func (uc *ResetPasswordUseCase) Execute(ctx context.Context, in ResetPasswordInp
 		return struct{}{}, common.NormalizeError(err)
 	}
 
+	// Whoever knew the old password may hold a session, have created a
+	// personal access token or trusted a device; none survives.
+	revoked, err := uc.refresh.RevokeAllExcept(ctx, ident.UserID, nil)
+	if err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	if err := uc.pats.RevokeByUser(ctx, ident.UserID); err != nil {
+		return struct{}{}, common.NormalizeError(err)
+	}
+	if err := common.RevokeTrustedDevices(ctx, uc.devices, ident.UserID, now); err != nil {
+		return struct{}{}, err
+	}
+	if err := common.PublishSessionsRevoked(ctx, uc.events, ident.UserID, revoked, events.SessionRevokedPasswordReset, now); err != nil {
+		return struct{}{}, err
+	}
+	if err := common.PublishPasswordChanged(ctx, uc.events, ident, events.PasswordChangedByReset, now); err != nil {
+		return struct{}{}, err
+	}
+
 	return struct{}{}, nil
 }
@@ -0,0 +1,216 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/events"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestPasswordResetStoresOnlyTokenHash(t *testing.T) {
+	ident := domain.Identity{ID: "identity", UserID: domain.NewUserID(), Provider: "email", ProviderUserID: "user@example.com", SecretHash: "hashed:old"}
+	identities := &identityRepoStub{identity: ident}
+	tokens := &tokenRepoStub{}
+	publisher := &resetPublisherStub{}
+
+	request := NewRequestUseCase(identities, tokens, codeHasherStub{}, publisher, time.Minute, time.Minute, time.Minute)
+	if err := request.RequestPasswordReset(context.Background(), RequestPasswordResetInput{Email: ident.ProviderUserID}); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	raw := publisher.reset.Token
+	if raw == "" || raw == tokens.stored.ID {
+		t.Fatalf("expected a random reset token distinct from the row id, got %q", raw)
+	}
+	if tokens.stored.CodeHash != "hashed:"+raw {
+		t.Fatalf("expected only the token hash to be stored, got %q", tokens.stored.CodeHash)
+	}
+
+	sessions := &refreshRepoStub{revoked: []string{"a", "b"}}
+	pats := &accessTokenRepoStub{}
+	devices := &trustedDeviceRepoStub{devices: []domain.TrustedDevice{domain.NewTrustedDevice(ident.UserID, "device-hash", time.Now().UTC(), time.Hour)}}
+	reset := NewResetPasswordUseCase(identities, tokens, codeHasherStub{}, hasherStub{}, sessions, pats, devices, publisher)
+	if _, err := reset.Execute(context.Background(), ResetPasswordInput{Email: ident.ProviderUserID, Token: tokens.stored.ID, NewPassword: "newpassword"}); !errors.Is(err, domain.ErrInvalidCredentials) {
+		t.Fatalf("expected row id to be rejected as a reset token, got %v", err)
+	}
+	if _, err := reset.Execute(context.Background(), ResetPasswordInput{Email: ident.ProviderUserID, Token: raw, NewPassword: "newpassword"}); err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if identities.updated.SecretHash != "hashed:newpassword" {
+		t.Fatalf("expected password to be updated, got %q", identities.updated.SecretHash)
+	}
+	if tokens.stored.UsedAt == nil {
+		t.Fatalf("expected token to be marked used")
+	}
+	if sessions.kept == nil || len(sessions.kept) != 0 {
+		t.Fatalf("expected every session to be revoked, kept %v", sessions.kept)
+	}
+	if pats.revokedFor != ident.UserID {
+		t.Fatalf("expected the personal access tokens to be revoked, got %q", pats.revokedFor)
+	}
+	if len(devices.revoked) != 1 || devices.revoked[0] != devices.devices[0].ID {
+		t.Fatalf("expected the trusted device to be revoked, got %v", devices.revoked)
+	}
+	if len(publisher.revoked) != 2 || publisher.revoked[0].Reason != events.SessionRevokedPasswordReset {
+		t.Fatalf("expected session_revoked events, got %+v", publisher.revoked)
+	}
+	if publisher.changed.Method != events.PasswordChangedByReset {
+		t.Fatalf("expected a password_changed event, got %+v", publisher.changed)
+	}
+}
+
+// --- test doubles ---
+
+type identityRepoStub struct {
+	identity domain.Identity
+	updated  domain.Identity
+}
+
+func (s *identityRepoStub) Create(context.Context, domain.Identity) error { return nil }
+func (s *identityRepoStub) GetByProvider(_ context.Context, provider, providerUserID string) (domain.Identity, bool, error) {
+	if s.identity.Provider == provider && s.identity.ProviderUserID == providerUserID {
+		return s.identity, true, nil
+	}
+	return domain.Identity{}, false, nil
+}
+func (s *identityRepoStub) GetByUserAndProvider(context.Context, domain.UserID, string) (domain.Identity, bool, error) {
+	return s.identity, true, nil
+}
+func (s *identityRepoStub) Update(_ context.Context, identity domain.Identity) error {
+	s.updated = identity
+	return nil
+}
+
+type tokenRepoStub struct {
+	stored domain.VerificationToken
+}
+
+func (s *tokenRepoStub) Create(_ context.Context, token domain.VerificationToken) error {
+	s.stored = token
+	return nil
+}
+func (s *tokenRepoStub) GetLatest(context.Context, string, domain.TokenType) (domain.VerificationToken, bool, error) {
+	return domain.VerificationToken{}, false, nil
+}
+func (s *tokenRepoStub) GetByCode(_ context.Context, identityID string, tokenType domain.TokenType, codeHash string) (domain.VerificationToken, bool, error) {
+	if s.stored.IdentityID == identityID && s.stored.Type == tokenType && s.stored.MatchesHash(codeHash) {
+		return s.stored, true, nil
+	}
+	return domain.VerificationToken{}, false, nil
+}
+func (s *tokenRepoStub) MarkUsed(_ context.Context, _ string, usedAt time.Time) error {
+	s.stored = s.stored.MarkUsed(usedAt)
+	return nil
+}
+
+type codeHasherStub struct{}
+
+func (codeHasherStub) Hash(raw string) string { return "hashed:" + raw }
+
+type hasherStub struct{}
+
+func (hasherStub) Hash(_ context.Context, password string) (string, error) {
+	return "hashed:" + password, nil
+}
+func (hasherStub) Compare(_ context.Context, hash, password string) error {
+	if hash != "hashed:"+password {
+		return errors.New("mismatch")
+	}
+	return nil
+}
+
+type accessTokenRepoStub struct {
+	revokedFor domain.UserID
+}
+
+func (s *accessTokenRepoStub) Create(context.Context, domain.PersonalAccessToken) error { return nil }
+func (s *accessTokenRepoStub) GetByHash(context.Context, string) (domain.PersonalAccessToken, bool, error) {
+	return domain.PersonalAccessToken{}, false, nil
+}
+func (s *accessTokenRepoStub) GetByID(context.Context, string) (domain.PersonalAccessToken, bool, error) {
+	return domain.PersonalAccessToken{}, false, nil
+}
+func (s *accessTokenRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.PersonalAccessToken, error) {
+	return nil, nil
+}
+func (s *accessTokenRepoStub) Touch(context.Context, string, time.Time) error { return nil }
+func (s *accessTokenRepoStub) Revoke(context.Context, string) error           { return nil }
+func (s *accessTokenRepoStub) RevokeByUser(_ context.Context, userID domain.UserID) error {
+	s.revokedFor = userID
+	return nil
+}
+
+type trustedDeviceRepoStub struct {
+	devices []domain.TrustedDevice
+	revoked []string
+}
+
+func (s *trustedDeviceRepoStub) Create(context.Context, domain.TrustedDevice) error { return nil }
+func (s *trustedDeviceRepoStub) GetByHash(context.Context, domain.UserID, string) (domain.TrustedDevice, bool, error) {
+	return domain.TrustedDevice{}, false, nil
+}
+func (s *trustedDeviceRepoStub) GetByID(context.Context, string) (domain.TrustedDevice, bool, error) {
+	return domain.TrustedDevice{}, false, nil
+}
+func (s *trustedDeviceRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.TrustedDevice, error) {
+	return s.devices, nil
+}
+func (s *trustedDeviceRepoStub) Touch(context.Context, string, time.Time) error { return nil }
+func (s *trustedDeviceRepoStub) Revoke(_ context.Context, id string) error {
+	s.revoked = append(s.revoked, id)
+	return nil
+}
+
+type refreshRepoStub struct {
+	revoked []string
+	kept    []string
+}
+
+func (s *refreshRepoStub) Create(context.Context, domain.RefreshToken) error { return nil }
+func (s *refreshRepoStub) Update(context.Context, domain.RefreshToken) error { return nil }
+func (s *refreshRepoStub) GetByHash(context.Context, string) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *refreshRepoStub) GetByID(context.Context, string) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *refreshRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
+	return nil, nil
+}
+func (s *refreshRepoStub) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
+	return nil, nil
+}
+func (s *refreshRepoStub) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+func (s *refreshRepoStub) Revoke(context.Context, string) error { return nil }
+func (s *refreshRepoStub) RevokeAllExcept(_ context.Context, _ domain.UserID, keep []string) ([]string, error) {
+	s.kept = append([]string{}, keep...)
+	return s.revoked, nil
+}
+
+type resetPublisherStub struct {
+	common.NopEventPublisher
+	reset   events.PasswordResetRequested
+	revoked []events.SessionRevoked
+	changed events.PasswordChanged
+}
+
+func (s *resetPublisherStub) PublishSessionRevoked(_ context.Context, evt events.SessionRevoked) error {
+	s.revoked = append(s.revoked, evt)
+	return nil
+}
+
+func (s *resetPublisherStub) PublishPasswordChanged(_ context.Context, evt events.PasswordChanged) error {
+	s.changed = evt
+	return nil
+}
+
+func (s *resetPublisherStub) PublishPasswordResetRequested(_ context.Context, evt events.PasswordResetRequested) error {
+	s.reset = evt
+	return nil
+}
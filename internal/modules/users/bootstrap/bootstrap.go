@@ -3,31 +3,45 @@ package bootstrap
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"os"
 	"time"
 
 	usersapp "github.com/vaaxooo/xbackend/internal/modules/users/application"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/accesstoken"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/apple"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/challenge"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/device"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/epoch"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/google"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/link"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/login"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/oauth"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/password"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/profile"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/recovery"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/refresh"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/register"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/risk"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/session"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/telegram"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/twofactor"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/verification"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 	usersauth "github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/auth"
+	"github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/captcha"
 	userscrypto "github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/crypto"
 	usersevents "github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/events"
-	"github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/oauth"
+	"github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/geoip"
+	usersoauth "github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/oauth"
+	"github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/tokens"
 	"github.com/vaaxooo/xbackend/internal/modules/users/public"
 	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
 	usersdb "github.com/vaaxooo/xbackend/internal/platform/db/users"
+	plog "github.com/vaaxooo/xbackend/internal/platform/log"
+	"github.com/vaaxooo/xbackend/internal/platform/secrets"
 )
 
 // Module exposes the Users bounded context public API.
@@ -37,12 +51,44 @@ type Module struct {
 	Service usersapp.Service
 	Auth    public.AuthPort
 	Outbox  *usersevents.OutboxRepository
+	// Geo locates client IPs; nil when no GeoIP database is configured.
+	Geo public.GeoLocator
 }
 
 // Dependencies describes technical components required to assemble
 // the Users bounded context. Only cross-cutting infrastructure goes here.
 type Dependencies struct {
 	DB *sql.DB
+	// Logger records login risk decisions. Nil disables that logging.
+	Logger plog.Logger
+	// Cipher seals sensitive columns (TOTP secrets) at rest. Nil stores
+	// them in plaintext.
+	Cipher secrets.Cipher
+	// ChallengeSteps adds or replaces challenge step handlers. A login only
+	// asks for a custom step when something requires it, e.g. RiskPolicy.
+	ChallengeSteps []ChallengeStep
+	// RiskPolicy replaces the threshold policy built from config.
+	RiskPolicy risk.Policy
+	// ChallengeEvents delivers challenge change notifications from all
+	// instances to event streams. Nil makes the streams poll the database.
+	ChallengeEvents challenge.Subscriber
+	// SessionEvents delivers session revocations from all instances to the
+	// session cache. Nil leaves other instances' revocations to the cache
+	// TTL.
+	SessionEvents Notifications
+}
+
+// Notifications routes the payloads of a NOTIFY channel to fn. fn gets an
+// empty payload when notifications may have been lost.
+type Notifications interface {
+	Handle(channel string, fn func(payload string)) error
+}
+
+// ChallengeStep registers a handler for one challenge step.
+type ChallengeStep struct {
+	Step    domain.ChallengeStep
+	Handler challenge.StepHandler
+	Policy  challenge.StepPolicy
 }
 
 // Init wires all application services and adapters for the Users context.
@@ -50,34 +96,115 @@ type Dependencies struct {
 // root close to the bounded context itself.
 func Init(deps Dependencies, cfg public.Config) (*Module, error) {
 	usersRepo := usersdb.NewUserRepo(deps.DB)
-	identityRepo := usersdb.NewIdentityRepo(deps.DB)
-	refreshRepo := usersdb.NewRefreshRepo(deps.DB, cfg.Auth.RefreshRetentionTTL)
+	identityRepo := usersdb.NewIdentityRepo(deps.DB, deps.Cipher)
+	// Session writes invalidate the verification cache here and, through
+	// NOTIFY, on every other instance.
+	sessionCache := usersauth.NewSessionCache(cfg.Auth.SessionCacheSize, cfg.Auth.SessionCacheTTL)
+	if sessionCache != nil && deps.SessionEvents != nil {
+		if err := deps.SessionEvents.Handle(usersdb.SessionEventsChannel, sessionCache.HandleNotification); err != nil {
+			return nil, err
+		}
+	}
+	revocationFeed := usersdb.NewRefreshRepo(deps.DB, cfg.Auth.RefreshRetentionTTL)
+	refreshRepo := usersauth.NewRevocationNotifier(revocationFeed, usersdb.NewSessionNotifier(deps.DB), sessionCache)
+	// A new epoch purges the cache, whose entries carry the epoch they
+	// were read with.
+	epochRepo := usersauth.NewEpochNotifier(usersdb.NewTokenEpochRepo(deps.DB), usersdb.NewSessionNotifier(deps.DB), sessionCache)
+	auditLog := usersdb.NewAuditLogRepo(deps.DB)
+	accessTokenRepo := usersdb.NewAccessTokenRepo(deps.DB)
+	clientRepo := usersdb.NewOAuthClientRepo(deps.DB)
 	tokenRepo := usersdb.NewVerificationTokenRepo(deps.DB)
 	challengeRepo := usersdb.NewChallengeRepo(deps.DB)
-	outboxRepo := usersevents.NewOutboxRepository(deps.DB)
+	deviceRepo := usersdb.NewTrustedDeviceRepo(deps.DB)
+	attemptRepo := usersdb.NewLoginAttemptRepo(deps.DB)
+	outboxRepo := usersevents.NewOutboxRepository(deps.DB, deps.Cipher)
 	uow := pdb.NewUnitOfWork(deps.DB)
 
 	hasher := userscrypto.NewBcryptHasher(0)
+	tokenHashKey := cfg.Auth.TokenHashKey
+	if tokenHashKey == "" {
+		derived, err := userscrypto.DeriveTokenHashKey(cfg.Auth.JWTSecret)
+		if err != nil {
+			return nil, err
+		}
+		tokenHashKey = derived
+	}
+	codeHasher, err := userscrypto.NewHMACTokenHasher(tokenHashKey)
+	if err != nil {
+		return nil, err
+	}
 
-	authPort, err := usersauth.NewJWTAuth(cfg.Auth.JWTSecret, refreshRepo)
+	var accessTokenSigner *tokens.RS256
+	if cfg.Auth.JWTSigningKeyFile != "" {
+		pemKey, err := os.ReadFile(cfg.Auth.JWTSigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		accessTokenSigner, err = tokens.NewRS256(pemKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	authPort, err := usersauth.NewJWTAuth(cfg.Auth.JWTSecret, accessTokenSigner, refreshRepo, epochRepo, accessTokenRepo, clientRepo, sessionCache)
 	if err != nil {
 		return nil, err
 	}
 
 	eventPublisher := usersevents.NewOutboxPublisher(outboxRepo)
+	sessionPolicy := common.SessionPolicy{
+		IdleTimeout:      cfg.Auth.RefreshTTL,
+		AbsoluteLifetime: cfg.Auth.SessionAbsoluteTTL,
+		PerClientType:    sessionLifetimes(cfg.Auth.SessionIdleTTLPerClient, cfg.Auth.SessionAbsoluteTTLPerClient),
+	}
+	limitPolicy := session.LimitPolicy(cfg.Auth.SessionLimitPolicy)
+	if limitPolicy != "" && !limitPolicy.Valid() {
+		return nil, fmt.Errorf("unknown session limit policy %q", cfg.Auth.SessionLimitPolicy)
+	}
+	// Use cases create sessions through the limiter so that every login flow
+	// honours the session limits.
+	sessionRepo := session.NewLimiter(refreshRepo, revocationFeed, eventPublisher, session.Limits{
+		Max:           cfg.Auth.MaxSessions,
+		PerClientType: cfg.Auth.MaxSessionsPerClient,
+		Policy:        limitPolicy,
+	})
+
+	var geo public.GeoLocator
+	if cfg.GeoIP.DatabasePath != "" {
+		reader, err := geoip.Open(cfg.GeoIP.DatabasePath)
+		if err != nil {
+			return nil, err
+		}
+		geo = reader
+	}
 
-	requestVerification := verification.NewRequestUseCase(identityRepo, tokenRepo, eventPublisher, cfg.Auth.VerificationTTL, cfg.Auth.PasswordResetTTL, time.Minute)
+	requestVerification := verification.NewRequestUseCase(identityRepo, tokenRepo, codeHasher, eventPublisher, cfg.Auth.VerificationTTL, cfg.Auth.PasswordResetTTL, time.Minute)
+
+	var captchaVerifier challenge.CaptchaVerifier
+	if cfg.Captcha.VerifyURL != "" && cfg.Captcha.Secret != "" {
+		captchaVerifier = captcha.NewSiteVerifier(cfg.Captcha.VerifyURL, cfg.Captcha.Secret)
+	}
+	var riskEngine risk.Assessor
+	if cfg.Risk.Enabled {
+		riskEngine = newRiskEngine(refreshRepo, attemptRepo, geo, deps.Logger, deps.RiskPolicy, cfg.Risk, captchaVerifier != nil)
+	}
+	requestLoginCode := func(ctx context.Context, ident domain.Identity) error {
+		return requestVerification.RequestLoginCode(ctx, verification.RequestEmailInput{Email: ident.ProviderUserID})
+	}
 
-	registerUC := common.NewTransactionalUseCase(uow, register.New(usersRepo, identityRepo, refreshRepo, tokenRepo, hasher, authPort, eventPublisher, cfg.Auth.AccessTTL, cfg.Auth.RefreshTTL, cfg.Auth.VerificationTTL, cfg.Auth.RequireEmailConfirmation))
+	registerUC := common.NewTransactionalUseCase(uow, register.New(usersRepo, identityRepo, sessionRepo, tokenRepo, codeHasher, hasher, authPort, eventPublisher, cfg.Auth.AccessTTL, sessionPolicy, cfg.Auth.VerificationTTL, cfg.Auth.RequireEmailConfirmation))
 	loginUC := common.NewTransactionalUseCase(uow, login.New(
 		usersRepo,
 		identityRepo,
-		refreshRepo,
+		sessionRepo,
 		challengeRepo,
 		hasher,
+		deviceRepo,
+		codeHasher,
+		attemptRepo,
 		authPort,
+		riskEngine,
 		cfg.Auth.AccessTTL,
-		cfg.Auth.RefreshTTL,
+		sessionPolicy,
 		cfg.Auth.RequireEmailConfirmation,
 		cfg.Auth.ChallengeTTL,
 		cfg.Auth.TOTPAttempts,
@@ -85,19 +212,22 @@ func Init(deps Dependencies, cfg public.Config) (*Module, error) {
 		func(ctx context.Context, ident domain.Identity) error {
 			return requestVerification.RequestEmailConfirmation(ctx, verification.RequestEmailInput{Email: ident.ProviderUserID})
 		},
+		requestLoginCode,
 	))
-	googleVerifier := oauth.NewIDTokenVerifier("", cfg.Google.ClientID, cfg.Google.JWKSURL)
-	googleUC := common.NewTransactionalUseCase(uow, google.New(usersRepo, identityRepo, refreshRepo, authPort, googleVerifier, cfg.Auth.AccessTTL, cfg.Auth.RefreshTTL))
-	appleVerifier := oauth.NewIDTokenVerifier("https://appleid.apple.com", cfg.Apple.ClientID, cfg.Apple.JWKSURL)
-	appleUC := common.NewTransactionalUseCase(uow, apple.New(usersRepo, identityRepo, refreshRepo, authPort, appleVerifier, cfg.Auth.AccessTTL, cfg.Auth.RefreshTTL))
-	telegramUC, err := telegram.New(usersRepo, identityRepo, refreshRepo, authPort, cfg.Telegram.BotToken, cfg.Auth.AccessTTL, cfg.Auth.RefreshTTL, cfg.Telegram.InitDataTTL)
+	googleVerifier := usersoauth.NewIDTokenVerifier("", cfg.Google.ClientID, cfg.Google.JWKSURL)
+	googleUC := common.NewTransactionalUseCase(uow, google.New(usersRepo, identityRepo, sessionRepo, authPort, googleVerifier, cfg.Auth.AccessTTL, sessionPolicy))
+	appleVerifier := usersoauth.NewIDTokenVerifier("https://appleid.apple.com", cfg.Apple.ClientID, cfg.Apple.JWKSURL)
+	appleUC := common.NewTransactionalUseCase(uow, apple.New(usersRepo, identityRepo, sessionRepo, authPort, appleVerifier, cfg.Auth.AccessTTL, sessionPolicy))
+	telegramUC, err := telegram.New(usersRepo, identityRepo, sessionRepo, authPort, cfg.Telegram.BotToken, cfg.Auth.AccessTTL, sessionPolicy, cfg.Telegram.InitDataTTL)
 	if err != nil {
 		return nil, err
 	}
 	telegramTransactional := common.NewTransactionalUseCase(uow, telegramUC)
-	refreshUC := common.NewTransactionalUseCase(uow, refresh.New(refreshRepo, authPort, cfg.Auth.AccessTTL, cfg.Auth.RefreshTTL))
+	oauthGrantRepo := usersdb.NewOAuthGrantRepo(deps.DB)
+	refreshUseCase := refresh.New(sessionRepo, epochRepo, oauthGrantRepo, authPort, cfg.Auth.AccessTTL, sessionPolicy)
+	refreshUC := common.NewTransactionalUseCase(uow, refreshUseCase)
 
-	confirmEmailUC := common.NewTransactionalUseCase(uow, verification.NewConfirmEmailUseCase(usersRepo, identityRepo, tokenRepo, refreshRepo, authPort, cfg.Auth.AccessTTL, cfg.Auth.RefreshTTL))
+	confirmEmailUC := common.NewTransactionalUseCase(uow, verification.NewConfirmEmailUseCase(usersRepo, identityRepo, tokenRepo, codeHasher, sessionRepo, authPort, cfg.Auth.AccessTTL, sessionPolicy))
 
 	emailVerificationUC := common.NewTransactionalUseCase(uow, funcUseCase[verification.RequestEmailInput, struct{}]{
 		fn: func(ctx context.Context, cmd verification.RequestEmailInput) (struct{}, error) {
@@ -109,12 +239,34 @@ func Init(deps Dependencies, cfg public.Config) (*Module, error) {
 			return struct{}{}, requestVerification.RequestPasswordReset(ctx, cmd)
 		},
 	})
-	resetPasswordUC := common.NewTransactionalUseCase(uow, verification.NewResetPasswordUseCase(identityRepo, tokenRepo, hasher))
-	twoFactorUC := newTwoFactorHandlers(twofactor.NewUseCase(identityRepo, cfg.Auth.TwoFactorIssuer), uow)
+	resetPasswordUC := common.NewTransactionalUseCase(uow, verification.NewResetPasswordUseCase(identityRepo, tokenRepo, codeHasher, hasher, sessionRepo, accessTokenRepo, deviceRepo, eventPublisher))
+	twoFactorUC := newTwoFactorHandlers(twofactor.NewUseCase(identityRepo, deviceRepo, cfg.Auth.TwoFactorIssuer, cfg.Auth.ReauthMaxAge), uow)
 
-	challengeUC := challenge.NewUseCase(challengeRepo, identityRepo, usersRepo, refreshRepo, tokenRepo, authPort, cfg.Auth.AccessTTL, cfg.Auth.RefreshTTL, cfg.Auth.TOTPAttempts, cfg.Auth.TOTPLockDuration, func(ctx context.Context, ident domain.Identity) error {
+	challengeUC := challenge.NewUseCase(challengeRepo, identityRepo, usersRepo, sessionRepo, tokenRepo, codeHasher, deviceRepo, hasher, captchaVerifier, authPort, cfg.Auth.AccessTTL, sessionPolicy, cfg.Auth.TrustedDeviceTTL, cfg.Auth.TOTPAttempts, cfg.Auth.TOTPLockDuration, func(ctx context.Context, ident domain.Identity) error {
 		return requestVerification.RequestEmailConfirmation(ctx, verification.RequestEmailInput{Email: ident.ProviderUserID})
+	}, requestLoginCode, challenge.Dependencies{
+		Notifier:      usersdb.NewChallengeNotifier(deps.DB),
+		QRLogins:      usersdb.NewQRLoginRepo(deps.DB),
+		LoginAttempts: attemptRepo,
 	})
+	for _, step := range deps.ChallengeSteps {
+		challengeUC.RegisterStep(step.Step, step.Handler, step.Policy)
+	}
+	// Streams run outside a transaction: they outlive any single request's unit of work.
+	challengeWatcher := challenge.NewWatcher(challengeRepo, deps.ChallengeEvents, 0)
+	challengeWatch := funcUseCase[challenge.WatchInput, <-chan challenge.Event]{
+		fn: challengeWatcher.Watch,
+	}
+	qrStartUC := common.NewTransactionalUseCase(uow, funcUseCase[challenge.StartQRLoginInput, challenge.StartQRLoginOutput]{
+		fn: challengeUC.StartQRLogin,
+	})
+	qrScanUC := common.NewTransactionalUseCase(uow, funcUseCase[challenge.ScanQRLoginInput, challenge.ScanQRLoginOutput]{
+		fn: challengeUC.ScanQRLogin,
+	})
+	// QR sessions wait like streams and claim in a unit of work of their own.
+	qrSessionUC := funcUseCase[challenge.QRSessionInput, login.Output]{
+		fn: challenge.NewQRSessions(challengeUC, challengeWatcher, uow, 0).Session,
+	}
 	challengeStatusUC := common.NewTransactionalUseCase(uow, funcUseCase[challenge.StatusInput, login.Output]{
 		fn: challengeUC.Status,
 	})
@@ -127,21 +279,172 @@ func Init(deps Dependencies, cfg public.Config) (*Module, error) {
 	challengeConfirmEmail := common.NewTransactionalUseCase(uow, funcUseCase[challenge.ConfirmEmailInput, login.Output]{
 		fn: challengeUC.ConfirmEmail,
 	})
+	challengeVerifyEmailOTP := common.NewTransactionalUseCase(uow, funcUseCase[challenge.VerifyEmailOTPInput, login.Output]{
+		fn: challengeUC.VerifyEmailOTP,
+	})
+	challengeVerifyCaptcha := common.NewTransactionalUseCase(uow, funcUseCase[challenge.VerifyCaptchaInput, login.Output]{
+		fn: challengeUC.VerifyCaptcha,
+	})
+	challengeVerifyStep := common.NewTransactionalUseCase(uow, funcUseCase[challenge.VerifyStepInput, login.Output]{
+		fn: challengeUC.VerifyStep,
+	})
+	stepUpStartUC := common.NewTransactionalUseCase(uow, funcUseCase[challenge.StartStepUpInput, login.Output]{
+		fn: challengeUC.StartStepUp,
+	})
+	stepUpVerifyUC := common.NewTransactionalUseCase(uow, funcUseCase[challenge.VerifyStepUpInput, login.Output]{
+		fn: challengeUC.VerifyStepUp,
+	})
+
+	recoveryUC := recovery.New(identityRepo, challengeRepo, tokenRepo, codeHasher, sessionRepo, accessTokenRepo, deviceRepo, eventPublisher, cfg.Auth.VerificationTTL, cfg.Recovery.Delay, cfg.Recovery.Window, cfg.Auth.TOTPAttempts, cfg.Auth.TOTPLockDuration, cfg.Recovery.CancelURL)
+	recoveryStartUC := common.NewTransactionalUseCase(uow, funcUseCase[recovery.StartInput, recovery.Output]{
+		fn: recoveryUC.Start,
+	})
+	recoveryConfirmUC := common.NewTransactionalUseCase(uow, funcUseCase[recovery.ConfirmInput, recovery.Output]{
+		fn: recoveryUC.Confirm,
+	})
+	recoveryCancelUC := common.NewTransactionalUseCase(uow, funcUseCase[recovery.CancelInput, struct{}]{
+		fn: func(ctx context.Context, in recovery.CancelInput) (struct{}, error) {
+			return struct{}{}, recoveryUC.Cancel(ctx, in)
+		},
+	})
+	recoveryCompleteUC := common.NewTransactionalUseCase(uow, funcUseCase[recovery.CompleteInput, recovery.Output]{
+		fn: recoveryUC.Complete,
+	})
 
 	meUC := common.NewTransactionalUseCase(uow, profile.NewGet(usersRepo, identityRepo))
 	profileUC := common.NewTransactionalUseCase(uow, profile.NewUpdate(usersRepo, identityRepo))
-	changePasswordUC := common.NewTransactionalUseCase(uow, password.NewChange(identityRepo, hasher))
-	linkUC := link.New(identityRepo)
-	sessionsUC := session.New(refreshRepo)
+	changePasswordUC := common.NewTransactionalUseCase(uow, password.NewChange(identityRepo, hasher, sessionRepo, eventPublisher, cfg.Auth.ReauthMaxAge))
+	linkUC := link.New(identityRepo, cfg.Auth.ReauthMaxAge)
+	sessionsUC := session.New(sessionRepo, eventPublisher, cfg.Auth.ReauthMaxAge)
 	sessionsListUC := common.NewTransactionalUseCase(uow, funcUseCase[session.ListInput, session.Output]{
 		fn: sessionsUC.List,
 	})
 	sessionsRevokeUC := common.NewTransactionalUseCase(uow, funcUseCase[session.RevokeInput, struct{}]{
 		fn: sessionsUC.Revoke,
 	})
+	sessionsRenameUC := common.NewTransactionalUseCase(uow, funcUseCase[session.RenameInput, session.Session]{
+		fn: sessionsUC.Rename,
+	})
 	sessionsPurgeUC := common.NewTransactionalUseCase(uow, funcUseCase[session.RevokeOthersInput, struct{}]{
 		fn: sessionsUC.RevokeOthers,
 	})
+	logoutUC := common.NewTransactionalUseCase(uow, funcUseCase[session.LogoutInput, struct{}]{
+		fn: sessionsUC.Logout,
+	})
+	logoutAllUC := common.NewTransactionalUseCase(uow, funcUseCase[session.LogoutAllInput, struct{}]{
+		fn: sessionsUC.LogoutAll,
+	})
+	// The feed only reads, so it runs outside a transaction.
+	revocationsUC := funcUseCase[session.FeedInput, session.FeedOutput]{
+		fn: session.NewFeed(revocationFeed, epochRepo, cfg.Auth.AccessTTL).List,
+	}
+
+	epochUC := epoch.New(epochRepo, usersRepo, auditLog)
+	invalidateTokensUC := common.NewTransactionalUseCase(uow, funcUseCase[epoch.InvalidateInput, epoch.Output]{
+		fn: epochUC.Invalidate,
+	})
+
+	devicesUC := device.New(deviceRepo)
+	devicesListUC := common.NewTransactionalUseCase(uow, funcUseCase[device.ListInput, device.Output]{
+		fn: devicesUC.List,
+	})
+	deviceRevokeUC := common.NewTransactionalUseCase(uow, funcUseCase[device.RevokeInput, struct{}]{
+		fn: devicesUC.Revoke,
+	})
+
+	accessTokensUC := accesstoken.New(accessTokenRepo, cfg.Auth.ReauthMaxAge, cfg.Auth.AccessTokenMaxTTL)
+	accessTokenCreateUC := common.NewTransactionalUseCase(uow, funcUseCase[accesstoken.CreateInput, accesstoken.CreateOutput]{
+		fn: accessTokensUC.Create,
+	})
+	accessTokenListUC := common.NewTransactionalUseCase(uow, funcUseCase[accesstoken.ListInput, accesstoken.Output]{
+		fn: accessTokensUC.List,
+	})
+	accessTokenRevokeUC := common.NewTransactionalUseCase(uow, funcUseCase[accesstoken.RevokeInput, struct{}]{
+		fn: accessTokensUC.Revoke,
+	})
+
+	clientsUC := oauth.NewClients(clientRepo, auditLog)
+	clientRegisterUC := common.NewTransactionalUseCase(uow, funcUseCase[oauth.RegisterClientInput, oauth.RegisterClientOutput]{
+		fn: clientsUC.Register,
+	})
+	clientListUC := common.NewTransactionalUseCase(uow, funcUseCase[oauth.ListClientsInput, oauth.ClientsOutput]{
+		fn: clientsUC.List,
+	})
+	clientDisableUC := common.NewTransactionalUseCase(uow, funcUseCase[oauth.DisableClientInput, struct{}]{
+		fn: clientsUC.Disable,
+	})
+	clientAuthenticator := oauth.NewClientAuthenticator(clientRepo, usersdb.NewClientAssertionRepo(deps.DB), cfg.Auth.OAuthIssuer)
+	authCodeRepo := usersdb.NewAuthorizationCodeRepo(deps.DB)
+	userInfoUseCase := oauth.NewUserInfo(oauthGrantRepo, usersRepo, identityRepo)
+	// The provider's routes are only mounted with a signing key; without
+	// one the token endpoint keeps to client credentials.
+	var idTokenSigner oauth.IDTokenSigner
+	var codeGrant *oauth.CodeGrant
+	if cfg.Auth.OIDCSigningKeyFile != "" {
+		if cfg.Auth.OAuthIssuer == "" || cfg.Auth.OIDCLoginURL == "" {
+			return nil, errors.New("the OpenID Connect provider needs an issuer and a login URL")
+		}
+		pemKey, err := os.ReadFile(cfg.Auth.OIDCSigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := usersoauth.NewIDTokenSigner(pemKey)
+		if err != nil {
+			return nil, err
+		}
+		idTokenSigner = signer
+		codeGrant = oauth.NewCodeGrant(authCodeRepo, oauthGrantRepo, sessionRepo, userInfoUseCase, authPort, idTokenSigner, refreshUseCase.Execute, uow, cfg.Auth.AccessTTL, sessionPolicy, cfg.Auth.OAuthIssuer)
+	}
+	// Without a verification page the device grant is off, and its routes
+	// are not mounted.
+	deviceGrant := oauth.NewDeviceGrant(clientAuthenticator, usersdb.NewDeviceAuthorizationRepo(deps.DB), oauthGrantRepo, sessionRepo, authPort, uow, cfg.Auth.AccessTTL, sessionPolicy, cfg.Auth.DeviceVerificationURL)
+	var tokenDeviceGrant *oauth.DeviceGrant
+	if cfg.Auth.DeviceVerificationURL != "" {
+		tokenDeviceGrant = deviceGrant
+	}
+	tokenUseCase := oauth.NewTokenUseCase(clientAuthenticator, authPort, cfg.Auth.AccessTTL, codeGrant, tokenDeviceGrant)
+	clientTokenUC := common.NewTransactionalUseCase(uow, funcUseCase[oauth.TokenInput, oauth.TokenOutput]{
+		fn: tokenUseCase.Token,
+	})
+	authorizer := oauth.NewAuthorizer(clientRepo, authCodeRepo, usersdb.NewOAuthConsentRepo(deps.DB), refreshRepo, cfg.Auth.OAuthIssuer, cfg.Auth.OIDCLoginURL)
+	// Starting an authorization only reads.
+	authorizeStartUC := funcUseCase[oauth.StartAuthorizationInput, oauth.RedirectOutput]{
+		fn: authorizer.Start,
+	}
+	authorizeUC := common.NewTransactionalUseCase(uow, funcUseCase[oauth.AuthorizeInput, oauth.AuthorizeOutput]{
+		fn: authorizer.Authorize,
+	})
+	userInfoUC := funcUseCase[oauth.UserInfoInput, oauth.UserInfoOutput]{
+		fn: userInfoUseCase.Get,
+	}
+	discovery := oauth.NewDiscovery(cfg.Auth.OAuthIssuer, idTokenSigner)
+	if cfg.Auth.DeviceVerificationURL != "" {
+		discovery.AdvertiseDeviceGrant()
+	}
+	if accessTokenSigner != nil {
+		n, e := tokens.EncodeRSAPublicKey(accessTokenSigner.PublicKey())
+		discovery.PublishAccessTokenKeys(oauth.JSONWebKey{KeyType: "RSA", Use: "sig", KeyID: accessTokenSigner.KeyID(), Algorithm: "RS256", N: n, E: e})
+	}
+	discoveryUC := funcUseCase[oauth.DiscoveryInput, oauth.ProviderMetadata]{
+		fn: discovery.Metadata,
+	}
+	keysUC := funcUseCase[oauth.KeysInput, oauth.KeySet]{
+		fn: discovery.Keys,
+	}
+	// Both authenticate the client, which may record its assertion.
+	introspection := oauth.NewIntrospection(clientAuthenticator, authPort, refreshRepo, oauthGrantRepo, epochRepo, eventPublisher)
+	introspectUC := common.NewTransactionalUseCase(uow, funcUseCase[oauth.IntrospectInput, oauth.IntrospectOutput]{
+		fn: introspection.Introspect,
+	})
+	revokeTokenUC := common.NewTransactionalUseCase(uow, funcUseCase[oauth.RevokeInput, struct{}]{
+		fn: introspection.Revoke,
+	})
+	deviceStartUC := common.NewTransactionalUseCase(uow, funcUseCase[oauth.DeviceAuthorizationInput, oauth.DeviceAuthorizationOutput]{
+		fn: deviceGrant.Authorize,
+	})
+	deviceVerifyUC := common.NewTransactionalUseCase(uow, funcUseCase[oauth.VerifyDeviceInput, oauth.VerifyDeviceOutput]{
+		fn: deviceGrant.Verify,
+	})
 
 	svc := usersapp.NewService(
 		common.UseCaseHandler(registerUC),
@@ -161,22 +464,102 @@ func Init(deps Dependencies, cfg public.Config) (*Module, error) {
 		common.UseCaseHandler(challengeVerifyTOTP),
 		common.UseCaseHandler(challengeResendEmail),
 		common.UseCaseHandler(challengeConfirmEmail),
+		common.UseCaseHandler(challengeVerifyEmailOTP),
+		common.UseCaseHandler(challengeVerifyCaptcha),
+		common.UseCaseHandler(challengeVerifyStep),
+		common.UseCaseHandler(challengeWatch),
+		common.UseCaseHandler(recoveryStartUC),
+		common.UseCaseHandler(recoveryConfirmUC),
+		common.UseCaseHandler(recoveryCancelUC),
+		common.UseCaseHandler(recoveryCompleteUC),
+		common.UseCaseHandler(stepUpStartUC),
+		common.UseCaseHandler(stepUpVerifyUC),
 		common.UseCaseHandler(meUC),
 		common.UseCaseHandler(profileUC),
 		common.UseCaseHandler(changePasswordUC),
 		common.UseCaseHandler(linkUC),
 		common.UseCaseHandler(sessionsListUC),
 		common.UseCaseHandler(sessionsRevokeUC),
+		common.UseCaseHandler(sessionsRenameUC),
 		common.UseCaseHandler(sessionsPurgeUC),
+		common.UseCaseHandler(logoutUC),
+		common.UseCaseHandler(logoutAllUC),
+		common.UseCaseHandler(revocationsUC),
+		common.UseCaseHandler(invalidateTokensUC),
+		common.UseCaseHandler(devicesListUC),
+		common.UseCaseHandler(deviceRevokeUC),
+		common.UseCaseHandler(accessTokenCreateUC),
+		common.UseCaseHandler(accessTokenListUC),
+		common.UseCaseHandler(accessTokenRevokeUC),
+		common.UseCaseHandler(clientRegisterUC),
+		common.UseCaseHandler(clientListUC),
+		common.UseCaseHandler(clientDisableUC),
+		common.UseCaseHandler(clientTokenUC),
+		common.UseCaseHandler(authorizeStartUC),
+		common.UseCaseHandler(authorizeUC),
+		common.UseCaseHandler(userInfoUC),
+		common.UseCaseHandler(discoveryUC),
+		common.UseCaseHandler(keysUC),
+		common.UseCaseHandler(introspectUC),
+		common.UseCaseHandler(revokeTokenUC),
+		common.UseCaseHandler(deviceStartUC),
+		common.UseCaseHandler(deviceVerifyUC),
+		common.UseCaseHandler(qrStartUC),
+		common.UseCaseHandler(qrScanUC),
+		common.UseCaseHandler(qrSessionUC),
 	)
 
 	return &Module{
 		Service: svc,
 		Auth:    authPort,
 		Outbox:  outboxRepo,
+		Geo:     geo,
 	}, nil
 }
 
+func newRiskEngine(sessions domain.RefreshTokenRepository, attempts domain.LoginAttemptRepository, geo risk.GeoLocator, logger plog.Logger, custom risk.Policy, cfg public.RiskConfig, captchaEnabled bool) *risk.Engine {
+	evaluator := risk.NewHistoryEvaluator(sessions, attempts, geo, risk.HistoryConfig{
+		NewIPWeight:            cfg.NewIPWeight,
+		NewUserAgentWeight:     cfg.NewUserAgentWeight,
+		NewCountryWeight:       cfg.NewCountryWeight,
+		ImpossibleTravelWeight: cfg.ImpossibleTravelWeight,
+		FailureWeight:          cfg.FailureWeight,
+		MaxFailures:            cfg.MaxFailures,
+		FailureWindow:          cfg.FailureWindow,
+		MaxTravelSpeed:         cfg.MaxTravelSpeed,
+	})
+	var policy risk.Policy = risk.ThresholdPolicy{
+		CaptchaScore:   cfg.CaptchaScore,
+		EmailOTPScore:  cfg.EmailOTPScore,
+		DenyScore:      cfg.DenyScore,
+		CaptchaEnabled: captchaEnabled,
+	}
+	if custom != nil {
+		policy = custom
+	}
+	var decisionLog risk.Logger
+	if logger != nil {
+		decisionLog = logger
+	}
+	return risk.NewEngine(evaluator, policy, decisionLog)
+}
+
+// sessionLifetimes merges the per client type idle and absolute overrides.
+func sessionLifetimes(idle, absolute map[string]time.Duration) map[string]common.SessionLifetime {
+	out := make(map[string]common.SessionLifetime, len(idle)+len(absolute))
+	for clientType, d := range idle {
+		l := out[clientType]
+		l.IdleTimeout = d
+		out[clientType] = l
+	}
+	for clientType, d := range absolute {
+		l := out[clientType]
+		l.AbsoluteLifetime = d
+		out[clientType] = l
+	}
+	return out
+}
+
 type funcUseCase[Cmd any, Resp any] struct {
 	fn func(context.Context, Cmd) (Resp, error)
 }
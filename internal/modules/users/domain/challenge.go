@@ -15,26 +15,80 @@ const (
 	ChallengeStatusCompleted ChallengeStatus = "completed"
 	ChallengeStatusBlocked   ChallengeStatus = "blocked"
 	ChallengeStatusExpired   ChallengeStatus = "expired"
+	ChallengeStatusCancelled ChallengeStatus = "cancelled"
 
 	ChallengeStepTOTP              ChallengeStep = "totp"
 	ChallengeStepEmailVerification ChallengeStep = "email_verification"
 	ChallengeStepAccountBlocked    ChallengeStep = "account_blocked"
 	ChallengeStepCaptcha           ChallengeStep = "captcha"
+	ChallengeStepEmailOTP          ChallengeStep = "email_otp"
+	ChallengeStepPassword          ChallengeStep = "password"
+	// ChallengeStepRecoveryDelay is the waiting period of an account
+	// recovery. Its step state is locked until the period ends.
+	ChallengeStepRecoveryDelay ChallengeStep = "recovery_delay"
+	// ChallengeStepQRApproval is completed from the mobile app of a signed
+	// in user who scanned the QR code of a QR login.
+	ChallengeStepQRApproval ChallengeStep = "qr_approval"
 )
 
+const (
+	// ChallengeTypeLogin gates a login; completing it issues a session.
+	ChallengeTypeLogin = "auth_challenge"
+	// ChallengeTypeRecovery resets the second factor of an account whose
+	// owner lost it. Completing it never issues a session.
+	ChallengeTypeRecovery = "account_recovery"
+	// ChallengeTypeStepUp re-authenticates the owner of an existing session
+	// (stored in SessionFingerprint). Completing it refreshes that session's
+	// auth time instead of creating a new one.
+	ChallengeTypeStepUp = "step_up"
+	// ChallengeTypeQRLogin gates a QR login (QRLogin). It has no user until
+	// the mobile app approves it; completing it issues a session to the
+	// desktop that started it.
+	ChallengeTypeQRLogin = "qr_login"
+)
+
+// AMR returns the authentication method reference a completed step proves,
+// or "" for steps that do not authenticate the user (captcha).
+func (s ChallengeStep) AMR() string {
+	switch s {
+	case ChallengeStepPassword:
+		return AMRPassword
+	case ChallengeStepTOTP, ChallengeStepEmailOTP, ChallengeStepEmailVerification:
+		return AMROTP
+	default:
+		return ""
+	}
+}
+
+// StepState tracks wrong answers for a single step, so that a locked TOTP
+// step does not also block an emailed code.
+type StepState struct {
+	AttemptsLeft int
+	LockUntil    *time.Time
+}
+
+func (s StepState) IsLocked(now time.Time) bool {
+	return s.LockUntil != nil && s.LockUntil.After(now)
+}
+
 type Challenge struct {
-	ID                 string
-	UserID             UserID
-	Type               string
-	RequiredSteps      []ChallengeStep
-	CompletedSteps     []ChallengeStep
-	Status             ChallengeStatus
-	ExpiresAt          time.Time
+	ID             string
+	UserID         UserID
+	Type           string
+	RequiredSteps  []ChallengeStep
+	CompletedSteps []ChallengeStep
+	Status         ChallengeStatus
+	ExpiresAt      time.Time
+	// SessionFingerprint binds the challenge to an existing session; step-up
+	// challenges store the session id here.
 	SessionFingerprint string
-	AttemptsLeft       int
-	LockUntil          *time.Time
-	CreatedAt          time.Time
-	UpdatedAt          time.Time
+	// AttemptsLeft and LockUntil mirror the state of the step that was
+	// attempted last; StepStates holds the state of every attempted step.
+	AttemptsLeft int
+	LockUntil    *time.Time
+	StepStates   map[ChallengeStep]StepState
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
 func NewChallenge(userID UserID, challengeType string, required []ChallengeStep, expiresAt time.Time) Challenge {
@@ -81,6 +135,16 @@ func (c Challenge) WithCompleted(step ChallengeStep, now time.Time) Challenge {
 	return c
 }
 
+// RecoveryReadyAt returns when the recovery waiting period ends, or nil if
+// it has not started yet.
+func (c Challenge) RecoveryReadyAt() *time.Time {
+	state, ok := c.StepState(ChallengeStepRecoveryDelay)
+	if !ok {
+		return nil
+	}
+	return state.LockUntil
+}
+
 func (c Challenge) WithStatus(status ChallengeStatus, now time.Time) Challenge {
 	c.Status = status
 	c.UpdatedAt = now
@@ -93,6 +157,24 @@ func (c Challenge) WithAttemptsLeft(left int, now time.Time) Challenge {
 	return c
 }
 
+func (c Challenge) StepState(step ChallengeStep) (StepState, bool) {
+	state, ok := c.StepStates[step]
+	return state, ok
+}
+
+func (c Challenge) WithStepState(step ChallengeStep, state StepState, now time.Time) Challenge {
+	states := make(map[ChallengeStep]StepState, len(c.StepStates)+1)
+	for k, v := range c.StepStates {
+		states[k] = v
+	}
+	states[step] = state
+	c.StepStates = states
+	c.AttemptsLeft = state.AttemptsLeft
+	c.LockUntil = state.LockUntil
+	c.UpdatedAt = now
+	return c
+}
+
 func (c Challenge) WithLockUntil(until *time.Time, now time.Time) Challenge {
 	c.LockUntil = until
 	c.UpdatedAt = now
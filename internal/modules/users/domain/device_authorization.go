@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoginMethodDevice marks a session opened by the device authorization
+// grant, on a device the user approved from another signed in browser.
+const LoginMethodDevice = "device"
+
+// Statuses of a device authorization.
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// DeviceSlowDownStep is added to the polling interval of a device that
+// polls too fast (RFC 8628 section 3.5).
+const DeviceSlowDownStep = 5 * time.Second
+
+// DeviceAuthorization is a sign-in started on a device that cannot show the
+// login page, such as a TV or a CLI (RFC 8628). The device polls with the
+// device code while the user enters the user code in a signed in browser;
+// only the hashes of both are stored. IP, UserAgent, Country and City
+// describe the device, so that the user can tell it is theirs. Approval
+// copies UserID and AMR from the browser session; once used, SessionID is
+// the session the device got.
+type DeviceAuthorization struct {
+	ID             string
+	DeviceCodeHash string
+	UserCodeHash   string
+	ClientID       string
+	Status         string
+	UserID         UserID
+	AMR            []string
+	IP             string
+	UserAgent      string
+	Country        string
+	City           string
+	Interval       time.Duration
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	LastPolledAt   *time.Time
+	DecidedAt      *time.Time
+	UsedAt         *time.Time
+	SessionID      string
+}
+
+func NewDeviceAuthorization(deviceCodeHash, userCodeHash, clientID string, now time.Time, ttl, interval time.Duration) DeviceAuthorization {
+	return DeviceAuthorization{
+		ID:             uuid.NewString(),
+		DeviceCodeHash: deviceCodeHash,
+		UserCodeHash:   userCodeHash,
+		ClientID:       clientID,
+		Status:         DeviceAuthorizationPending,
+		Interval:       interval,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+	}
+}
+
+// IsExpired reports whether the device took too long to be approved.
+func (d DeviceAuthorization) IsExpired(now time.Time) bool {
+	return !now.Before(d.ExpiresAt)
+}
+
+// IsPending reports whether the user can still answer the authorization.
+func (d DeviceAuthorization) IsPending(now time.Time) bool {
+	return d.Status == DeviceAuthorizationPending && !d.IsExpired(now)
+}
+
+// Poll records a poll of the device. A device that polls again before its
+// interval passed must slow down, and waits longer from then on.
+func (d DeviceAuthorization) Poll(now time.Time) (DeviceAuthorization, bool) {
+	tooFast := d.LastPolledAt != nil && now.Sub(*d.LastPolledAt) < d.Interval
+	if tooFast {
+		d.Interval += DeviceSlowDownStep
+	}
+	d.LastPolledAt = &now
+	return d, tooFast
+}
+
+// Approve signs the device in as the user of the approving session.
+func (d DeviceAuthorization) Approve(userID UserID, amr []string, now time.Time) DeviceAuthorization {
+	d.Status = DeviceAuthorizationApproved
+	d.UserID = userID
+	d.AMR = amr
+	d.DecidedAt = &now
+	return d
+}
+
+// Deny refuses the device; its next poll learns so.
+func (d DeviceAuthorization) Deny(userID UserID, now time.Time) DeviceAuthorization {
+	d.Status = DeviceAuthorizationDenied
+	d.UserID = userID
+	d.DecidedAt = &now
+	return d
+}
@@ -14,8 +14,75 @@ var (
 	ErrTooManyRequests         = errors.New("too many requests")
 	ErrInvalidDisplayName      = errors.New("invalid display name")
 	ErrInvalidAvatarURL        = errors.New("invalid avatar url")
+	ErrInvalidDeviceName       = errors.New("invalid device name")
 
 	ErrUnauthorized          = errors.New("unauthorized")
 	ErrIdentityAlreadyLinked = errors.New("identity already linked")
 	ErrRefreshTokenInvalid   = errors.New("refresh token invalid")
+	ErrUnknownChallengeStep  = errors.New("unknown challenge step")
+	ErrRecoveryNotReady      = errors.New("recovery waiting period not over")
+	// ErrReauthenticationRequired means the session authenticated too long
+	// ago for the operation; a step-up challenge refreshes it.
+	ErrReauthenticationRequired = errors.New("reauthentication required")
+	ErrStepUpUnavailable        = errors.New("step-up unavailable")
+	// ErrSessionLimitReached rejects a login when the user already has the
+	// maximum number of active sessions and the limit policy is reject.
+	ErrSessionLimitReached = errors.New("session limit reached")
+	// ErrInvalidCursor rejects a revocation feed cursor this server did not
+	// issue.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrUserNotFound  = errors.New("user not found")
+	// ErrReasonRequired rejects administrative actions without a reason for
+	// the audit log.
+	ErrReasonRequired = errors.New("reason required")
+	// ErrInvalidScope rejects scopes that do not exist, or a token without
+	// any.
+	ErrInvalidScope       = errors.New("invalid scope")
+	ErrInvalidTokenName   = errors.New("invalid token name")
+	ErrInvalidTokenExpiry = errors.New("invalid token expiry")
+	// ErrTokenLimitReached rejects a new personal access token when the user
+	// already has MaxPersonalAccessTokens.
+	ErrTokenLimitReached = errors.New("token limit reached")
+	// ErrInvalidClient means an OAuth client is unknown, disabled or failed
+	// to authenticate.
+	ErrInvalidClient           = errors.New("invalid client")
+	ErrClientNotFound          = errors.New("client not found")
+	ErrInvalidClientName       = errors.New("invalid client name")
+	ErrInvalidClientAuthMethod = errors.New("invalid client authentication method")
+	// ErrInvalidClientKey rejects a public key that is not a PEM encoded
+	// RSA, ECDSA P-256 or Ed25519 key.
+	ErrInvalidClientKey = errors.New("invalid client key")
+	// ErrInvalidOAuthRequest and ErrUnsupportedGrantType reject malformed
+	// token requests.
+	ErrInvalidOAuthRequest  = errors.New("invalid oauth request")
+	ErrUnsupportedGrantType = errors.New("unsupported grant type")
+	// ErrUnauthorizedClient refuses a grant the client is not registered
+	// for, such as client credentials to a client without scopes.
+	ErrUnauthorizedClient      = errors.New("unauthorized client")
+	ErrInvalidRedirectURI      = errors.New("invalid redirect uri")
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+	// ErrInvalidGrant rejects an authorization code or refresh token that is
+	// unknown, expired, used or issued to another client.
+	ErrInvalidGrant = errors.New("invalid grant")
+	// ErrInsufficientScope means the token was not granted the scope the
+	// operation needs.
+	ErrInsufficientScope = errors.New("insufficient scope")
+	// ErrUnsupportedTokenType refuses to revoke a token that cannot be
+	// revoked on its own, such as an access token.
+	ErrUnsupportedTokenType = errors.New("unsupported token type")
+	// ErrAuthorizationPending, ErrSlowDown, ErrAccessDenied and
+	// ErrExpiredToken answer a device polling for its tokens before the
+	// user approved it, too often, after the user refused it, or too late
+	// (RFC 8628 section 3.5).
+	ErrAuthorizationPending = errors.New("authorization pending")
+	ErrSlowDown             = errors.New("slow down")
+	ErrAccessDenied         = errors.New("access denied")
+	ErrExpiredToken         = errors.New("expired token")
+	// ErrInvalidUserCode means a user code is unknown, expired or was
+	// answered already.
+	ErrInvalidUserCode = errors.New("invalid user code")
+
+	// ErrInvalidQRCode means a scanned QR code is unknown, expired or was
+	// answered already.
+	ErrInvalidQRCode = errors.New("invalid qr code")
 )
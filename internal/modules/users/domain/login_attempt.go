@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LoginAttempt struct {
+	ID        string
+	UserID    UserID
+	IP        string
+	UserAgent string
+	Succeeded bool
+	CreatedAt time.Time
+}
+
+func NewLoginAttempt(userID UserID, ip, userAgent string, succeeded bool, at time.Time) LoginAttempt {
+	return LoginAttempt{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		IP:        ip,
+		UserAgent: userAgent,
+		Succeeded: succeeded,
+		CreatedAt: at,
+	}
+}
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoginMethodOIDC marks a session created for a client through the
+// authorization endpoint when the browser session it came from recorded
+// no login method.
+const LoginMethodOIDC = "oidc"
+
+// AuthorizationCode is an authorization code issued to a client for a user
+// (RFC 6749 section 4.1). Only the hash of the code is stored. The user's
+// authentication (AuthTime, AMR, LoginMethod) is copied from the browser
+// session that approved it, and CodeChallenge binds the code to the PKCE
+// verifier of the client that asked for it. Once used, SessionID is the
+// session it was exchanged for.
+type AuthorizationCode struct {
+	ID            string
+	CodeHash      string
+	ClientID      string
+	UserID        UserID
+	RedirectURI   string
+	Scopes        []string
+	Nonce         string
+	CodeChallenge string
+	AuthTime      time.Time
+	AMR           []string
+	LoginMethod   string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	SessionID     string
+}
+
+func NewAuthorizationCode(codeHash, clientID string, userID UserID, redirectURI string, scopes []string, nonce, codeChallenge string, now time.Time, ttl time.Duration) AuthorizationCode {
+	return AuthorizationCode{
+		ID:            uuid.NewString(),
+		CodeHash:      codeHash,
+		ClientID:      clientID,
+		UserID:        userID,
+		RedirectURI:   redirectURI,
+		Scopes:        scopes,
+		Nonce:         nonce,
+		CodeChallenge: codeChallenge,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+	}
+}
+
+// IsUsable reports whether the code can still be exchanged.
+func (c AuthorizationCode) IsUsable(now time.Time) bool {
+	return c.UsedAt == nil && now.Before(c.ExpiresAt)
+}
+
+// OAuthConsent records the scopes a user allowed a client, so that the
+// consent screen is only shown again for new scopes.
+type OAuthConsent struct {
+	UserID    UserID
+	ClientID  string
+	Scopes    []string
+	GrantedAt time.Time
+}
+
+// Covers reports whether every scope in scopes was consented to.
+func (c OAuthConsent) Covers(scopes []string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(c.Scopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Grant adds scopes to the consent.
+func (c OAuthConsent) Grant(scopes []string, now time.Time) OAuthConsent {
+	merged := append(append([]string{}, c.Scopes...), scopes...)
+	slices.Sort(merged)
+	c.Scopes = slices.Compact(merged)
+	c.GrantedAt = now
+	return c
+}
+
+// OAuthGrant ties a session to the client it was issued to and the scopes
+// the user granted it. Sessions created by the user's own logins have none.
+type OAuthGrant struct {
+	SessionID string
+	ClientID  string
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+// HasScope reports whether the grant includes scope.
+func (g OAuthGrant) HasScope(scope string) bool {
+	return slices.Contains(g.Scopes, scope)
+}
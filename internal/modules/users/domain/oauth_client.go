@@ -0,0 +1,219 @@
+package domain
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Ways an OAuth client proves who it is at the token endpoint, named as in
+// OAuth client metadata. A secret can be sent with HTTP Basic or in the
+// form; private_key_jwt signs an assertion with the client's key. Public
+// clients (none), such as single-page and mobile apps, TVs and CLIs, cannot
+// keep a secret and only sign users in, proving possession of the
+// authorization request with PKCE instead, or through the device
+// authorization grant.
+const (
+	ClientAuthSecret        = "client_secret"
+	ClientAuthPrivateKeyJWT = "private_key_jwt"
+	ClientAuthNone          = "none"
+)
+
+// OAuthClientSecretPrefix starts every client secret, for secret scanners.
+const OAuthClientSecretPrefix = "xbs_"
+
+// MaxClientNameLength bounds the name of an OAuth client.
+const MaxClientNameLength = 64
+
+// MaxRedirectURIs bounds the redirect URIs of an OAuth client.
+const MaxRedirectURIs = 10
+
+// Client scopes limit what a machine client may do. They are granted to
+// clients only; users' tokens use the scopes in KnownScopes.
+const (
+	ScopeRevocationsRead = "revocations:read"
+)
+
+// KnownClientScopes lists the scopes clients can be granted.
+var KnownClientScopes = []string{ScopeRevocationsRead}
+
+// NormalizeClientScopes is NormalizeScopes for client scopes.
+func NormalizeClientScopes(scopes []string) ([]string, error) {
+	return normalizeScopes(scopes, KnownClientScopes)
+}
+
+// OpenID Connect scopes, which users grant to the clients they sign in to
+// rather than clients being granted them at registration. openid is
+// required in every authorization request.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// KnownOIDCScopes lists the scopes of authorization requests.
+var KnownOIDCScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// NormalizeOIDCScopes is NormalizeScopes for OpenID Connect scopes; openid
+// must be among them.
+func NormalizeOIDCScopes(scopes []string) ([]string, error) {
+	scopes, err := normalizeScopes(scopes, KnownOIDCScopes)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(scopes, ScopeOpenID) {
+		return nil, ErrInvalidScope
+	}
+	return scopes, nil
+}
+
+// Audit actions on OAuth clients.
+const (
+	AuditActionClientRegistered = "oauth_client_registered"
+	AuditActionClientDisabled   = "oauth_client_disabled"
+)
+
+// OAuthClient is a registered client. A machine client calls the API in
+// its own name within Scopes; a client with RedirectURIs signs users in
+// through the authorization endpoint; a client may be both. Any client may
+// sign users in with the device authorization grant. A client
+// authenticates with a secret, of which only the hash is stored, with
+// assertions signed by the key whose PEM is PublicKey, or not at all when
+// it is public.
+type OAuthClient struct {
+	ID           string
+	Name         string
+	AuthMethod   string
+	SecretHash   string
+	PublicKey    string
+	Scopes       []string
+	RedirectURIs []string
+	CreatedAt    time.Time
+	DisabledAt   *time.Time
+}
+
+// NewOAuthClient validates a new client. It needs scopes, redirect URIs or
+// both; public clients only sign users in and so take no scopes, and those
+// without redirect URIs only use the device authorization grant.
+func NewOAuthClient(name, authMethod, secretHash, publicKey string, scopes, redirectURIs []string, now time.Time) (OAuthClient, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxClientNameLength {
+		return OAuthClient{}, ErrInvalidClientName
+	}
+	switch authMethod {
+	case ClientAuthSecret:
+		if secretHash == "" {
+			return OAuthClient{}, ErrInvalidClientAuthMethod
+		}
+	case ClientAuthPrivateKeyJWT:
+		if strings.TrimSpace(publicKey) == "" {
+			return OAuthClient{}, ErrInvalidClientKey
+		}
+	case ClientAuthNone:
+		if len(scopes) > 0 {
+			return OAuthClient{}, ErrInvalidClientAuthMethod
+		}
+	default:
+		return OAuthClient{}, ErrInvalidClientAuthMethod
+	}
+	redirectURIs, err := NormalizeRedirectURIs(redirectURIs)
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	if len(scopes) > 0 || (len(redirectURIs) == 0 && authMethod != ClientAuthNone) {
+		if scopes, err = NormalizeClientScopes(scopes); err != nil {
+			return OAuthClient{}, err
+		}
+	}
+	return OAuthClient{
+		ID:           uuid.NewString(),
+		Name:         name,
+		AuthMethod:   authMethod,
+		SecretHash:   secretHash,
+		PublicKey:    publicKey,
+		Scopes:       scopes,
+		RedirectURIs: redirectURIs,
+		CreatedAt:    now.UTC(),
+	}, nil
+}
+
+// NormalizeRedirectURIs validates the redirect URIs of a client: absolute
+// URIs without a fragment, over https unless they point at the loopback
+// interface or use a private scheme, as native apps do (RFC 8252).
+// Duplicates are dropped.
+func NormalizeRedirectURIs(uris []string) ([]string, error) {
+	if len(uris) > MaxRedirectURIs {
+		return nil, ErrInvalidRedirectURI
+	}
+	out := make([]string, 0, len(uris))
+	for _, raw := range uris {
+		raw = strings.TrimSpace(raw)
+		u, err := url.Parse(raw)
+		if err != nil || !u.IsAbs() || strings.Contains(raw, "#") {
+			return nil, ErrInvalidRedirectURI
+		}
+		switch u.Scheme {
+		case "https":
+			if u.Host == "" {
+				return nil, ErrInvalidRedirectURI
+			}
+		case "http":
+			if host := u.Hostname(); host != "localhost" && host != "127.0.0.1" && host != "::1" {
+				return nil, ErrInvalidRedirectURI
+			}
+		default:
+			// Private schemes are reverse domain names (com.example.app).
+			if !strings.Contains(u.Scheme, ".") {
+				return nil, ErrInvalidRedirectURI
+			}
+		}
+		if !slices.Contains(out, raw) {
+			out = append(out, raw)
+		}
+	}
+	return out, nil
+}
+
+func (c OAuthClient) IsActive() bool {
+	return c.DisabledAt == nil
+}
+
+// AllowsRedirect reports whether uri is one of the client's redirect URIs;
+// they are compared exactly.
+func (c OAuthClient) AllowsRedirect(uri string) bool {
+	return uri != "" && slices.Contains(c.RedirectURIs, uri)
+}
+
+func (c OAuthClient) Disable(now time.Time) OAuthClient {
+	if c.DisabledAt == nil {
+		at := now.UTC()
+		c.DisabledAt = &at
+	}
+	return c
+}
+
+// GrantScopes returns the scopes to put in a token that asked for
+// requested: all of the client's when it asked for none. Asking for a scope
+// the client was not granted fails with ErrInvalidScope; a client without
+// scopes is not a machine client and gets ErrUnauthorizedClient.
+func (c OAuthClient) GrantScopes(requested []string) ([]string, error) {
+	if len(c.Scopes) == 0 {
+		return nil, ErrUnauthorizedClient
+	}
+	if len(requested) == 0 {
+		return c.Scopes, nil
+	}
+	granted := make([]string, 0, len(requested))
+	for _, s := range requested {
+		if !slices.Contains(c.Scopes, s) {
+			return nil, ErrInvalidScope
+		}
+		granted = append(granted, s)
+	}
+	slices.Sort(granted)
+	return slices.Compact(granted), nil
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNormalizeRedirectURIs(t *testing.T) {
+	valid := []string{
+		"https://app.example.com/callback",
+		"http://127.0.0.1:8400/callback",
+		"http://localhost/callback",
+		"com.example.app:/oauth",
+	}
+	out, err := NormalizeRedirectURIs(append(valid, " https://app.example.com/callback "))
+	if err != nil {
+		t.Fatalf("expected valid redirect URIs, got %v", err)
+	}
+	if len(out) != len(valid) {
+		t.Fatalf("expected duplicates to be dropped, got %v", out)
+	}
+
+	for _, uri := range []string{
+		"/callback",
+		"http://app.example.com/callback",
+		"https://app.example.com/callback#frag",
+		"myapp:/oauth",
+		"https:///callback",
+	} {
+		if _, err := NormalizeRedirectURIs([]string{uri}); !errors.Is(err, ErrInvalidRedirectURI) {
+			t.Fatalf("expected %q to be refused, got %v", uri, err)
+		}
+	}
+}
+
+func TestPublicClients(t *testing.T) {
+	now := time.Now()
+	if _, err := NewOAuthClient("app", ClientAuthNone, "", "", []string{ScopeRevocationsRead}, nil, now); !errors.Is(err, ErrInvalidClientAuthMethod) {
+		t.Fatalf("expected a public client with scopes to be refused, got %v", err)
+	}
+	tv, err := NewOAuthClient("tv", ClientAuthNone, "", "", nil, nil, now)
+	if err != nil {
+		t.Fatalf("expected a public client without redirect URIs to be kept for the device grant, got %v", err)
+	}
+	if len(tv.Scopes) != 0 || tv.AllowsRedirect("") {
+		t.Fatalf("unexpected device client: %+v", tv)
+	}
+	c, err := NewOAuthClient("app", ClientAuthNone, "", "", nil, []string{"https://app.example.com/callback"}, now)
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+	if !c.AllowsRedirect("https://app.example.com/callback") || c.AllowsRedirect("https://app.example.com/callback/") {
+		t.Fatalf("expected redirect URIs to be matched exactly")
+	}
+	if _, err := c.GrantScopes(nil); !errors.Is(err, ErrUnauthorizedClient) {
+		t.Fatalf("expected a client without scopes to be kept off client credentials, got %v", err)
+	}
+}
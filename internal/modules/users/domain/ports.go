@@ -24,16 +24,122 @@ type RefreshTokenRepository interface {
 	GetByHash(ctx context.Context, tokenHash string) (RefreshToken, bool, error)
 	GetByID(ctx context.Context, tokenID string) (RefreshToken, bool, error)
 	ListByUser(ctx context.Context, userID UserID) ([]RefreshToken, error)
+	// ListActiveByUser returns every session of the user that is neither
+	// revoked nor expired at now, oldest first.
+	ListActiveByUser(ctx context.Context, userID UserID, now time.Time) ([]RefreshToken, error)
 	FindActiveByFingerprint(ctx context.Context, userID UserID, userAgent, ip string, now time.Time) (RefreshToken, bool, error)
 	Revoke(ctx context.Context, tokenID string) error
-	RevokeAllExcept(ctx context.Context, userID UserID, keepIDs []string) error
+	// RevokeAllExcept revokes every active session of the user except keepIDs
+	// and returns the ids of the sessions it revoked.
+	RevokeAllExcept(ctx context.Context, userID UserID, keepIDs []string) ([]string, error)
+}
+
+// RevocationFeedRepository pages through revoked sessions in the order they
+// were revoked, for services that verify access tokens on their own.
+type RevocationFeedRepository interface {
+	// ListRevoked returns up to limit sessions revoked after (since,
+	// afterID) and no later than until, ordered by revocation time then id.
+	ListRevoked(ctx context.Context, since time.Time, afterID string, until time.Time, limit int) ([]SessionRevocation, error)
+}
+
+// TokenEpochRepository stores "not valid before" epochs. Epochs only move
+// forward: setting an earlier time than the stored one keeps the stored one.
+type TokenEpochRepository interface {
+	Set(ctx context.Context, epoch TokenEpoch) error
+	// NotBefore returns the later of the global epoch and the user's, zero
+	// when neither is set.
+	NotBefore(ctx context.Context, userID UserID) (time.Time, error)
+	// ListAfter returns the epochs, global and per user, later than t.
+	ListAfter(ctx context.Context, t time.Time) ([]TokenEpoch, error)
+}
+
+// AuditLog records administrative actions.
+type AuditLog interface {
+	Record(ctx context.Context, record AuditRecord) error
+}
+
+// PersonalAccessTokenRepository stores personal access tokens. ListByUser
+// leaves out revoked and expired tokens; RevokeByUser revokes every token of
+// the user.
+type PersonalAccessTokenRepository interface {
+	Create(ctx context.Context, token PersonalAccessToken) error
+	GetByHash(ctx context.Context, tokenHash string) (PersonalAccessToken, bool, error)
+	GetByID(ctx context.Context, id string) (PersonalAccessToken, bool, error)
+	ListByUser(ctx context.Context, userID UserID) ([]PersonalAccessToken, error)
+	Touch(ctx context.Context, id string, usedAt time.Time) error
+	Revoke(ctx context.Context, id string) error
+	RevokeByUser(ctx context.Context, userID UserID) error
+}
+
+// OAuthClientRepository stores registered OAuth clients. List includes
+// disabled ones.
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client OAuthClient) error
+	GetByID(ctx context.Context, id string) (OAuthClient, bool, error)
+	List(ctx context.Context) ([]OAuthClient, error)
+	Disable(ctx context.Context, id string, at time.Time) error
+}
+
+// ClientAssertionRepository remembers the ids (jti) of the client
+// assertions that were used, until they expire. Use reports false when the
+// assertion was used before.
+type ClientAssertionRepository interface {
+	Use(ctx context.Context, clientID, jti string, expiresAt time.Time) (bool, error)
+}
+
+// AuthorizationCodeRepository stores authorization codes by hash. MarkUsed
+// records the session a code was exchanged for and reports false when the
+// code had been used already.
+type AuthorizationCodeRepository interface {
+	Create(ctx context.Context, code AuthorizationCode) error
+	GetByHash(ctx context.Context, codeHash string) (AuthorizationCode, bool, error)
+	MarkUsed(ctx context.Context, id, sessionID string, at time.Time) (bool, error)
+}
+
+// OAuthConsentRepository stores what users consented to; Save replaces the
+// consent of the user to the client.
+type OAuthConsentRepository interface {
+	Get(ctx context.Context, userID UserID, clientID string) (OAuthConsent, bool, error)
+	Save(ctx context.Context, consent OAuthConsent) error
+}
+
+// OAuthGrantRepository stores which client each session was issued to.
+type OAuthGrantRepository interface {
+	Create(ctx context.Context, grant OAuthGrant) error
+	GetBySession(ctx context.Context, sessionID string) (OAuthGrant, bool, error)
+}
+
+// DeviceAuthorizationRepository stores device authorizations by the hashes
+// of their codes. Poll saves when the device last polled and its interval.
+// Decide saves the user's answer and MarkUsed the session the device got;
+// they report false when the authorization was answered or used already.
+type DeviceAuthorizationRepository interface {
+	Create(ctx context.Context, d DeviceAuthorization) error
+	GetByDeviceCode(ctx context.Context, deviceCodeHash string) (DeviceAuthorization, bool, error)
+	GetByUserCode(ctx context.Context, userCodeHash string) (DeviceAuthorization, bool, error)
+	Poll(ctx context.Context, id string, at time.Time, interval time.Duration) error
+	Decide(ctx context.Context, d DeviceAuthorization) (bool, error)
+	MarkUsed(ctx context.Context, id, sessionID string, at time.Time) (bool, error)
+}
+
+// QRLoginRepository stores QR logins by their challenge and the hash of
+// their code. Decide saves the mobile app's answer and Claim the session the
+// desktop got; they report false when the login was answered or claimed
+// already.
+type QRLoginRepository interface {
+	Create(ctx context.Context, q QRLogin) error
+	GetByCode(ctx context.Context, codeHash string) (QRLogin, bool, error)
+	GetByChallenge(ctx context.Context, challengeID string) (QRLogin, bool, error)
+	Decide(ctx context.Context, q QRLogin) (bool, error)
+	Claim(ctx context.Context, challengeID, sessionID string, at time.Time) (bool, error)
 }
 
 type VerificationTokenRepository interface {
 	Create(ctx context.Context, token VerificationToken) error
 	GetLatest(ctx context.Context, identityID string, tokenType TokenType) (VerificationToken, bool, error)
-	GetByID(ctx context.Context, tokenID string) (VerificationToken, bool, error)
-	GetByCode(ctx context.Context, identityID string, tokenType TokenType, code string) (VerificationToken, bool, error)
+	// GetByCode returns the newest active token of the given type whose stored
+	// hash matches codeHash. Hashes are compared in constant time.
+	GetByCode(ctx context.Context, identityID string, tokenType TokenType, codeHash string) (VerificationToken, bool, error)
 	MarkUsed(ctx context.Context, tokenID string, usedAt time.Time) error
 }
 
@@ -43,3 +149,21 @@ type ChallengeRepository interface {
 	GetByID(ctx context.Context, id string) (Challenge, bool, error)
 	GetPendingByUser(ctx context.Context, userID UserID) (Challenge, bool, error)
 }
+
+type TrustedDeviceRepository interface {
+	Create(ctx context.Context, device TrustedDevice) error
+	GetByHash(ctx context.Context, userID UserID, tokenHash string) (TrustedDevice, bool, error)
+	GetByID(ctx context.Context, id string) (TrustedDevice, bool, error)
+	ListByUser(ctx context.Context, userID UserID) ([]TrustedDevice, error)
+	Touch(ctx context.Context, id string, usedAt time.Time) error
+	Revoke(ctx context.Context, id string) error
+}
+
+// LoginAttemptRepository keeps a short history of password logins used for
+// risk scoring. Implementations must persist failed attempts even when the
+// surrounding transaction is rolled back. CountFailures counts the failures
+// from ip only, so that someone else's guesses do not lock the user out.
+type LoginAttemptRepository interface {
+	Record(ctx context.Context, attempt LoginAttempt) error
+	CountFailures(ctx context.Context, userID UserID, ip string, since time.Time) (int, error)
+}
@@ -0,0 +1,67 @@
+package domain
+
+import "time"
+
+// LoginMethodQR marks a session opened by scanning a QR code with the
+// mobile app, where the user was already signed in.
+const LoginMethodQR = "qr"
+
+// QRLogin is a cross-device login started on a desktop. The desktop shows
+// Code as a QR code and waits with LoginToken; only the hashes of both are
+// stored. The login is gated by a challenge (ChallengeTypeQRLogin) that the
+// mobile app completes by approving it, so that the desktop can follow it
+// like any other challenge. IP, UserAgent, Country and City describe the
+// desktop, so that the user can tell it is theirs. Approval copies UserID
+// and AMR from the mobile session; once claimed, SessionID is the session
+// the desktop got.
+type QRLogin struct {
+	ChallengeID    string
+	CodeHash       string
+	LoginTokenHash string
+	UserID         UserID
+	AMR            []string
+	IP             string
+	UserAgent      string
+	Country        string
+	City           string
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	DecidedAt      *time.Time
+	ClaimedAt      *time.Time
+	SessionID      string
+}
+
+func NewQRLogin(challengeID, codeHash, loginTokenHash string, now time.Time, ttl time.Duration) QRLogin {
+	return QRLogin{
+		ChallengeID:    challengeID,
+		CodeHash:       codeHash,
+		LoginTokenHash: loginTokenHash,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+	}
+}
+
+// IsExpired reports whether the QR code is too old to be scanned.
+func (q QRLogin) IsExpired(now time.Time) bool {
+	return !now.Before(q.ExpiresAt)
+}
+
+// IsPending reports whether the QR code can still be answered.
+func (q QRLogin) IsPending(now time.Time) bool {
+	return q.DecidedAt == nil && !q.IsExpired(now)
+}
+
+// Approve signs the desktop in as the user of the approving session.
+func (q QRLogin) Approve(userID UserID, amr []string, now time.Time) QRLogin {
+	q.UserID = userID
+	q.AMR = amr
+	q.DecidedAt = &now
+	return q
+}
+
+// Deny refuses the desktop; it learns so from the challenge.
+func (q QRLogin) Deny(userID UserID, now time.Time) QRLogin {
+	q.UserID = userID
+	q.DecidedAt = &now
+	return q
+}
@@ -1,35 +1,167 @@
 package domain
 
 import (
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
 
+// Authentication method references (RFC 8176) recorded on a session.
+// AMRFederated is not registered there; it marks a login through an
+// external identity provider.
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRMultiFactor = "mfa"
+	AMRFederated   = "fed"
+)
+
+// Login methods recorded on the session that a login created.
+const (
+	LoginMethodPassword  = "password"
+	LoginMethodEmailCode = "email_code"
+	LoginMethodGoogle    = "google"
+	LoginMethodApple     = "apple"
+	LoginMethodTelegram  = "telegram"
+)
+
+// Client types a session can be created for. Clients announce theirs at
+// login; anything else is recorded as no particular type.
+const (
+	ClientTypeWeb     = "web"
+	ClientTypeMobile  = "mobile"
+	ClientTypeDesktop = "desktop"
+)
+
+// NormalizeClientType returns the known client type named by s, or "".
+func NormalizeClientType(s string) string {
+	switch t := strings.ToLower(strings.TrimSpace(s)); t {
+	case ClientTypeWeb, ClientTypeMobile, ClientTypeDesktop:
+		return t
+	default:
+		return ""
+	}
+}
+
+// MaxDeviceNameLength bounds the name a user gives a session.
+const MaxDeviceNameLength = 64
+
+// SessionRevocation is an entry of the revocation feed.
+type SessionRevocation struct {
+	SessionID string
+	RevokedAt time.Time
+}
+
+// RefreshToken is a session. UserAgent, IP and the location resolved from
+// it are those of the login that created it; LastUsedAt and LastIP follow
+// its latest refresh.
 type RefreshToken struct {
 	ID        string
 	UserID    UserID
 	TokenHash string
-	ExpiresAt time.Time
-	RevokedAt *time.Time
-	CreatedAt time.Time
-	UserAgent string
-	IP        string
+	// ExpiresAt is when the session ends unless refreshed. It never passes
+	// AbsoluteExpiresAt, the hard end set at login (zero when unbounded).
+	ExpiresAt         time.Time
+	AbsoluteExpiresAt time.Time
+	RevokedAt         *time.Time
+	CreatedAt         time.Time
+	UserAgent         string
+	IP                string
+	// Country (ISO 3166-1 alpha-2) and City are looked up from IP when the
+	// session is created; empty when no GeoIP database is configured.
+	Country string
+	City    string
+	// LoginMethod is how the user signed in when the session was created
+	// (LoginMethod*).
+	LoginMethod string
+	// ClientType is one of ClientType* or empty.
+	ClientType string
+	DeviceName string
+	LastUsedAt time.Time
+	LastIP     string
+	// AuthTime is when the user last proved their identity for this
+	// session (login or step-up); it survives token rotation.
+	AuthTime time.Time
+	AMR      []string
 }
 
 func NewRefreshTokenRecord(userID UserID, tokenHash string, createdAt time.Time, ttl time.Duration) RefreshToken {
 	return RefreshToken{
-		ID:        uuid.NewString(),
-		UserID:    userID,
-		TokenHash: tokenHash,
-		ExpiresAt: createdAt.Add(ttl),
-		CreatedAt: createdAt,
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		TokenHash:  tokenHash,
+		ExpiresAt:  createdAt.Add(ttl),
+		CreatedAt:  createdAt,
+		LastUsedAt: createdAt,
+		AuthTime:   createdAt,
 	}
 }
 
+// WithAbsoluteExpiry ends the session at the latest at at, however often it
+// is refreshed.
+func (t RefreshToken) WithAbsoluteExpiry(at time.Time) RefreshToken {
+	t.AbsoluteExpiresAt = at
+	if !at.IsZero() && t.ExpiresAt.After(at) {
+		t.ExpiresAt = at
+	}
+	return t
+}
+
+// Rotate replaces the token of the session, extends it by ttl up to its
+// absolute expiry and records its use from ip. Everything the login
+// recorded is kept.
+func (t RefreshToken) Rotate(tokenHash string, now time.Time, ttl time.Duration, ip string) RefreshToken {
+	t.TokenHash = tokenHash
+	t.ExpiresAt = now.Add(ttl)
+	t.LastUsedAt = now
+	if ip != "" {
+		t.LastIP = ip
+	}
+	return t.WithAbsoluteExpiry(t.AbsoluteExpiresAt)
+}
+
+// WithDeviceName sets the name the user gave the session; a blank name
+// clears it.
+func (t RefreshToken) WithDeviceName(name string) (RefreshToken, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > MaxDeviceNameLength {
+		return t, ErrInvalidDeviceName
+	}
+	t.DeviceName = name
+	return t, nil
+}
+
 func (t RefreshToken) IsValid(now time.Time) bool {
 	if t.RevokedAt != nil {
 		return false
 	}
 	return !now.After(t.ExpiresAt)
 }
+
+// WithAuthentication records that the user authenticated at now with the
+// given methods, in addition to the ones already on the session.
+func (t RefreshToken) WithAuthentication(now time.Time, methods ...string) RefreshToken {
+	t.AuthTime = now
+	t.AMR = NewAMR(append(append([]string{}, t.AMR...), methods...)...)
+	return t
+}
+
+// NewAMR normalizes a list of methods: duplicates and blanks are dropped and
+// mfa is added when more than one method was used.
+func NewAMR(methods ...string) []string {
+	amr := make([]string, 0, len(methods)+1)
+	seen := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		if m == "" || m == AMRMultiFactor || seen[m] {
+			continue
+		}
+		seen[m] = true
+		amr = append(amr, m)
+	}
+	if len(amr) > 1 {
+		amr = append(amr, AMRMultiFactor)
+	}
+	return amr
+}
@@ -1,6 +1,8 @@
 package domain
 
 import (
+	"errors"
+	"strings"
 	"testing"
 	"time"
 )
@@ -24,3 +26,92 @@ func TestRefreshTokenValidity(t *testing.T) {
 		t.Fatalf("expected expired token to be invalid")
 	}
 }
+
+func TestRefreshTokenWithAuthentication(t *testing.T) {
+	created := time.Now().UTC().Add(-time.Hour)
+	token := NewRefreshTokenRecord("user", "hash", created, time.Hour)
+	if !token.AuthTime.Equal(created) {
+		t.Fatalf("expected auth time to default to creation, got %v", token.AuthTime)
+	}
+	token.AMR = NewAMR(AMRPassword, AMRPassword, "")
+	if len(token.AMR) != 1 || token.AMR[0] != AMRPassword {
+		t.Fatalf("expected a single pwd method, got %v", token.AMR)
+	}
+
+	now := time.Now().UTC()
+	stepped := token.WithAuthentication(now, AMROTP)
+	if !stepped.AuthTime.Equal(now) {
+		t.Fatalf("expected auth time to move forward, got %v", stepped.AuthTime)
+	}
+	if got := stepped.AMR; len(got) != 3 || got[0] != AMRPassword || got[1] != AMROTP || got[2] != AMRMultiFactor {
+		t.Fatalf("expected pwd, otp and mfa, got %v", got)
+	}
+	if len(token.AMR) != 1 {
+		t.Fatalf("expected the original record to stay unchanged, got %v", token.AMR)
+	}
+}
+
+func TestRefreshTokenRotateKeepsLoginDetails(t *testing.T) {
+	created := time.Now().UTC().Add(-time.Hour)
+	token := NewRefreshTokenRecord("user", "hash", created, time.Hour)
+	token.UserAgent = "agent"
+	token.IP = "1.1.1.1"
+	token.LoginMethod = LoginMethodGoogle
+	token.DeviceName = "Phone"
+
+	now := time.Now().UTC()
+	rotated := token.Rotate("new", now, 2*time.Hour, "2.2.2.2")
+	if rotated.ID != token.ID || rotated.TokenHash != "new" || !rotated.ExpiresAt.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("expected the same session with a new token, got %+v", rotated)
+	}
+	if !rotated.CreatedAt.Equal(created) || rotated.IP != "1.1.1.1" || rotated.UserAgent != "agent" || rotated.LoginMethod != LoginMethodGoogle || rotated.DeviceName != "Phone" {
+		t.Fatalf("expected login details to be kept, got %+v", rotated)
+	}
+	if !rotated.LastUsedAt.Equal(now) || rotated.LastIP != "2.2.2.2" {
+		t.Fatalf("expected last use to be recorded, got %+v", rotated)
+	}
+	if again := rotated.Rotate("newer", now, time.Hour, ""); again.LastIP != "2.2.2.2" {
+		t.Fatalf("expected an unknown ip to keep the last one, got %q", again.LastIP)
+	}
+}
+
+func TestRefreshTokenWithDeviceName(t *testing.T) {
+	token := RefreshToken{}
+	named, err := token.WithDeviceName("  Work laptop  ")
+	if err != nil || named.DeviceName != "Work laptop" {
+		t.Fatalf("expected a trimmed name, got %q err=%v", named.DeviceName, err)
+	}
+	if _, err := token.WithDeviceName(strings.Repeat("я", MaxDeviceNameLength+1)); !errors.Is(err, ErrInvalidDeviceName) {
+		t.Fatalf("expected a too long name to be rejected, got %v", err)
+	}
+	cleared, err := named.WithDeviceName(" ")
+	if err != nil || cleared.DeviceName != "" {
+		t.Fatalf("expected a blank name to clear it, got %q err=%v", cleared.DeviceName, err)
+	}
+}
+
+func TestNormalizeClientType(t *testing.T) {
+	for in, want := range map[string]string{"web": ClientTypeWeb, " Mobile ": ClientTypeMobile, "DESKTOP": ClientTypeDesktop, "tv": "", "": ""} {
+		if got := NormalizeClientType(in); got != want {
+			t.Fatalf("NormalizeClientType(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRefreshTokenRotateStopsAtAbsoluteExpiry(t *testing.T) {
+	now := time.Now().UTC()
+	token := NewRefreshTokenRecord("user", "hash", now, time.Hour).WithAbsoluteExpiry(now.Add(90 * time.Minute))
+	if !token.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expected the idle timeout to apply first, got %v", token.ExpiresAt)
+	}
+
+	rotated := token.Rotate("new", now.Add(time.Hour), time.Hour, "")
+	if !rotated.ExpiresAt.Equal(now.Add(90*time.Minute)) || !rotated.AbsoluteExpiresAt.Equal(token.AbsoluteExpiresAt) {
+		t.Fatalf("expected the refresh to stop at the absolute expiry, got %v", rotated.ExpiresAt)
+	}
+
+	unbounded := NewRefreshTokenRecord("user", "hash", now, time.Hour).Rotate("new", now.Add(time.Hour), time.Hour, "")
+	if !unbounded.ExpiresAt.Equal(now.Add(2 * time.Hour)) {
+		t.Fatalf("expected a session without absolute expiry to slide, got %v", unbounded.ExpiresAt)
+	}
+}
@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenEpoch is a "not valid before" time: access tokens issued and
+// sessions created earlier are invalid. An empty UserID is the global epoch
+// that applies to everyone.
+type TokenEpoch struct {
+	UserID    UserID
+	NotBefore time.Time
+}
+
+// NewTokenEpoch starts an epoch at the next whole second after now. Access
+// tokens carry their issue time in whole seconds, so the rounding keeps a
+// token issued just before the epoch from passing as issued at it.
+func NewTokenEpoch(userID UserID, now time.Time) TokenEpoch {
+	return TokenEpoch{UserID: userID, NotBefore: now.UTC().Truncate(time.Second).Add(time.Second)}
+}
+
+// Global reports whether the epoch applies to every user.
+func (e TokenEpoch) Global() bool {
+	return e.UserID == ""
+}
+
+// Audit actions.
+const AuditActionTokensInvalidated = "tokens_invalidated"
+
+// AuditRecord is an entry of the audit log of administrative actions.
+// Actor names who acted (an operator, "admin_api"); UserID is the affected
+// user, empty for actions on everyone.
+type AuditRecord struct {
+	ID        string
+	Action    string
+	Actor     string
+	UserID    UserID
+	IP        string
+	Reason    string
+	Details   map[string]string
+	CreatedAt time.Time
+}
+
+func NewAuditRecord(action, actor string, userID UserID, ip, reason string, details map[string]string, at time.Time) AuditRecord {
+	return AuditRecord{
+		ID:        uuid.NewString(),
+		Action:    action,
+		Actor:     actor,
+		UserID:    userID,
+		IP:        ip,
+		Reason:    reason,
+		Details:   details,
+		CreatedAt: at,
+	}
+}
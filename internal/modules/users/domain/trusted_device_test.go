@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+type prefixSigner struct{ key string }
+
+func (s prefixSigner) Hash(raw string) string { return s.key + ":" + raw }
+
+func TestDeviceTokenIsBoundToUserAndKey(t *testing.T) {
+	signer := prefixSigner{key: "k1"}
+	token, err := NewDeviceToken("user-1", signer)
+	if err != nil {
+		t.Fatalf("token error: %v", err)
+	}
+	if !VerifyDeviceToken(token, "user-1", signer) {
+		t.Fatalf("expected token to verify for its user")
+	}
+	if VerifyDeviceToken(token, "user-2", signer) {
+		t.Fatalf("expected token to be rejected for another user")
+	}
+	if VerifyDeviceToken(token, "user-1", prefixSigner{key: "k2"}) {
+		t.Fatalf("expected token to be rejected under another key")
+	}
+	if VerifyDeviceToken("garbage", "user-1", signer) {
+		t.Fatalf("expected malformed token to be rejected")
+	}
+}
+
+func TestTrustedDeviceValidity(t *testing.T) {
+	now := time.Now().UTC()
+	device := NewTrustedDevice("user-1", "hash", now, time.Hour)
+	if !device.IsValid(now) {
+		t.Fatalf("expected fresh device to be valid")
+	}
+	if device.IsValid(now.Add(2 * time.Hour)) {
+		t.Fatalf("expected expired device to be invalid")
+	}
+	device.RevokedAt = &now
+	if device.IsValid(now) {
+		t.Fatalf("expected revoked device to be invalid")
+	}
+}
@@ -87,6 +87,13 @@ func (id UserID) String() string {
 	return string(id)
 }
 
+// Valid reports whether id is well-formed. Ids from access tokens are
+// trusted; ids typed in by operators are not.
+func (id UserID) Valid() bool {
+	_, err := uuid.Parse(string(id))
+	return err == nil
+}
+
 func isValidEmail(email string) bool {
 	if len(email) < 6 {
 		return false
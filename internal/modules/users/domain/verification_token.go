@@ -2,6 +2,8 @@ package domain
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
 	"math/big"
 	"time"
@@ -14,37 +16,55 @@ type TokenType string
 const (
 	TokenTypeEmailConfirmation TokenType = "email_confirmation"
 	TokenTypePasswordReset     TokenType = "password_reset"
+	TokenTypeLoginOTP          TokenType = "login_otp"
+	TokenTypeRecovery          TokenType = "account_recovery"
+	TokenTypeRecoveryCancel    TokenType = "account_recovery_cancel"
 )
 
+// VerificationCodeHasher derives the value persisted for a verification code
+// or reset token. Implementations must be deterministic and keyed so that a
+// database leak does not reveal usable secrets.
+type VerificationCodeHasher interface {
+	Hash(raw string) string
+}
+
 type VerificationToken struct {
 	ID         string
 	IdentityID string
 	Type       TokenType
-	Code       string
+	CodeHash   string
 	ExpiresAt  time.Time
 	UsedAt     *time.Time
 	CreatedAt  time.Time
 }
 
-func NewVerificationToken(identityID string, tokenType TokenType, code string, issuedAt time.Time, ttl time.Duration) VerificationToken {
+func NewVerificationToken(identityID string, tokenType TokenType, codeHash string, issuedAt time.Time, ttl time.Duration) VerificationToken {
 	return VerificationToken{
 		ID:         uuid.NewString(),
 		IdentityID: identityID,
 		Type:       tokenType,
-		Code:       code,
+		CodeHash:   codeHash,
 		ExpiresAt:  issuedAt.Add(ttl),
 		CreatedAt:  issuedAt,
 	}
 }
 
-func (t VerificationToken) IsValid(code string, now time.Time) bool {
+func (t VerificationToken) IsValid(codeHash string, now time.Time) bool {
 	if t.UsedAt != nil {
 		return false
 	}
 	if now.After(t.ExpiresAt) {
 		return false
 	}
-	return t.Code == code
+	return t.MatchesHash(codeHash)
+}
+
+// MatchesHash compares the stored hash with the candidate in constant time.
+func (t VerificationToken) MatchesHash(codeHash string) bool {
+	if t.CodeHash == "" || codeHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(t.CodeHash), []byte(codeHash)) == 1
 }
 
 func (t VerificationToken) IsActive(now time.Time) bool {
@@ -73,3 +93,13 @@ func GenerateNumericCode(length int) (string, error) {
 	}
 	return string(digits), nil
 }
+
+// GenerateSecretToken returns a URL-safe random token with 256 bits of entropy,
+// suitable for links where the user never types the value by hand.
+func GenerateSecretToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerificationTokenValidity(t *testing.T) {
+	now := time.Now().UTC()
+	token := NewVerificationToken("identity", TokenTypeEmailConfirmation, "hash", now, time.Minute)
+	if !token.IsValid("hash", now) {
+		t.Fatalf("expected token to be valid")
+	}
+	if token.IsValid("other", now) {
+		t.Fatalf("expected mismatched hash to be rejected")
+	}
+	if token.IsValid("", now) {
+		t.Fatalf("expected empty hash to be rejected")
+	}
+	if token.IsValid("hash", now.Add(2*time.Minute)) {
+		t.Fatalf("expected expired token to be invalid")
+	}
+	if token.MarkUsed(now).IsValid("hash", now) {
+		t.Fatalf("expected used token to be invalid")
+	}
+}
+
+func TestGenerateSecretTokenIsRandom(t *testing.T) {
+	a, err := GenerateSecretToken()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	b, err := GenerateSecretToken()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(a) != 43 || a == b {
+		t.Fatalf("expected distinct 256-bit tokens, got %q and %q", a, b)
+	}
+}
@@ -3,47 +3,241 @@ package auth
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 	"github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/tokens"
 	"github.com/vaaxooo/xbackend/internal/modules/users/public"
 )
 
+// accessTokenTouchInterval spaces out the last use updates of a personal
+// access token, so that a busy script does not write on every request.
+const accessTokenTouchInterval = time.Minute
+
 // JWTAuth adapts the JWT driver to the public AuthPort interface,
-// hiding the concrete token implementation from consumers.
+// hiding the concrete token implementation from consumers. It also accepts
+// personal access tokens, told apart by their prefix, and the tokens of
+// OAuth clients; nil pats or clients rejects them. With a signer, Issue
+// signs with it instead of the secret, so that other services verify access
+// tokens with its public key; tokens signed with the secret before stay
+// valid until they expire.
+// Sessions and token epochs are looked up in cache first; a nil cache
+// queries the repositories on every call, and nil epochs skips the epoch
+// check.
 type JWTAuth struct {
 	issuer  *tokens.HS256
+	signer  *tokens.RS256
 	refresh domain.RefreshTokenRepository
+	epochs  domain.TokenEpochRepository
+	pats    domain.PersonalAccessTokenRepository
+	clients domain.OAuthClientRepository
+	cache   *SessionCache
 }
 
-func NewJWTAuth(secret string, refresh domain.RefreshTokenRepository) (*JWTAuth, error) {
+func NewJWTAuth(secret string, signer *tokens.RS256, refresh domain.RefreshTokenRepository, epochs domain.TokenEpochRepository, pats domain.PersonalAccessTokenRepository, clients domain.OAuthClientRepository, cache *SessionCache) (*JWTAuth, error) {
 	issuer, err := tokens.NewHS256(secret)
 	if err != nil {
 		return nil, err
 	}
-	return &JWTAuth{issuer: issuer, refresh: refresh}, nil
+	return &JWTAuth{issuer: issuer, signer: signer, refresh: refresh, epochs: epochs, pats: pats, clients: clients, cache: cache}, nil
 }
 
-func (a *JWTAuth) Issue(userID, sessionID string, ttl time.Duration) (string, error) {
-	return a.issuer.Issue(userID, sessionID, ttl)
+func (a *JWTAuth) Issue(claims common.AccessClaims, ttl time.Duration) (string, error) {
+	driverClaims := tokens.Claims{
+		UserID:    claims.UserID,
+		SessionID: claims.SessionID,
+		AMR:       claims.AMR,
+		ClientID:  claims.ClientID,
+		Scope:     strings.Join(claims.Scopes, " "),
+	}
+	if !claims.AuthTime.IsZero() {
+		driverClaims.AuthTime = jwt.NewNumericDate(claims.AuthTime)
+	}
+	if a.signer != nil {
+		return a.signer.Issue(driverClaims, ttl)
+	}
+	return a.issuer.Issue(driverClaims, ttl)
 }
 
-func (a *JWTAuth) Verify(token string) (public.AuthContext, error) {
-	claims, err := a.issuer.Parse(token)
+func (a *JWTAuth) parse(token string) (tokens.Claims, error) {
+	if a.signer != nil {
+		if claims, err := a.signer.Parse(token); err == nil {
+			return claims, nil
+		}
+	}
+	return a.issuer.Parse(token)
+}
+
+func (a *JWTAuth) Verify(ctx context.Context, token string) (public.AuthContext, error) {
+	v, err := a.verify(ctx, token)
+	return v.auth, err
+}
+
+// Inspect verifies token as Verify does and adds its lifetime, for token
+// introspection.
+func (a *JWTAuth) Inspect(ctx context.Context, token string) (common.AccessTokenInfo, error) {
+	v, err := a.verify(ctx, token)
 	if err != nil {
-		return public.AuthContext{}, err
+		return common.AccessTokenInfo{}, err
 	}
+	return common.AccessTokenInfo{
+		UserID:    v.auth.UserID,
+		SessionID: v.auth.SessionID,
+		TokenID:   v.auth.TokenID,
+		ClientID:  v.auth.ClientID,
+		Scopes:    v.auth.Scopes,
+		IssuedAt:  v.issuedAt,
+		ExpiresAt: v.expiresAt,
+	}, nil
+}
 
-	session, found, err := a.refresh.GetByID(context.Background(), claims.SessionID)
+// verified is a token that passed verification, with its lifetime.
+type verified struct {
+	auth      public.AuthContext
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+func (a *JWTAuth) verify(ctx context.Context, token string) (verified, error) {
+	if strings.HasPrefix(token, domain.PersonalAccessTokenPrefix) {
+		return a.verifyPersonalAccessToken(ctx, token)
+	}
+	claims, err := a.parse(token)
 	if err != nil {
-		return public.AuthContext{}, err
+		return verified{}, err
+	}
+	v := verified{}
+	if claims.IssuedAt != nil {
+		v.issuedAt = claims.IssuedAt.Time
+	}
+	if claims.ExpiresAt != nil {
+		v.expiresAt = claims.ExpiresAt.Time
+	}
+	if claims.ClientID != "" && claims.UserID == "" {
+		v.auth, err = a.verifyClient(ctx, claims)
+		return v, err
+	}
+
+	session, notBefore, found, err := a.session(ctx, claims.SessionID)
+	if err != nil {
+		return verified{}, err
 	}
 	if !found || session.UserID.String() != claims.UserID || !session.IsValid(time.Now().UTC()) {
-		return public.AuthContext{}, errors.New("session revoked")
+		return verified{}, errors.New("session revoked")
+	}
+	if !notBefore.IsZero() && (claims.IssuedAt == nil || claims.IssuedAt.Time.Before(notBefore)) {
+		return verified{}, errors.New("token issued before the current epoch")
+	}
+
+	if claims.ClientID != "" {
+		if err := a.activeClient(ctx, claims.ClientID); err != nil {
+			return verified{}, err
+		}
+		v.auth = public.AuthContext{Kind: public.AuthKindGrant, UserID: claims.UserID, SessionID: claims.SessionID, ClientID: claims.ClientID, Scopes: strings.Fields(claims.Scope), AMR: claims.AMR}
+		return v, nil
 	}
+	v.auth = public.AuthContext{Kind: public.AuthKindSession, UserID: claims.UserID, SessionID: claims.SessionID, AMR: claims.AMR}
+	if claims.AuthTime != nil {
+		v.auth.AuthTime = claims.AuthTime.Time
+	}
+	return v, nil
+}
 
-	return public.AuthContext{UserID: claims.UserID, SessionID: claims.SessionID}, nil
+// verifyPersonalAccessToken looks the token up by its hash; personal access
+// tokens are not cached, so revoking one takes effect at once.
+func (a *JWTAuth) verifyPersonalAccessToken(ctx context.Context, token string) (verified, error) {
+	if a.pats == nil {
+		return verified{}, errors.New("personal access tokens are not accepted")
+	}
+	pat, found, err := a.pats.GetByHash(ctx, common.HashToken(token))
+	if err != nil {
+		return verified{}, err
+	}
+	now := time.Now().UTC()
+	if !found || !pat.IsValid(now) {
+		return verified{}, errors.New("personal access token revoked or expired")
+	}
+	if a.epochs != nil {
+		notBefore, err := a.epochs.NotBefore(ctx, pat.UserID)
+		if err != nil {
+			return verified{}, err
+		}
+		if pat.CreatedAt.Before(notBefore) {
+			return verified{}, errors.New("token issued before the current epoch")
+		}
+	}
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) >= accessTokenTouchInterval {
+		if err := a.pats.Touch(ctx, pat.ID, now); err != nil {
+			return verified{}, err
+		}
+	}
+	return verified{
+		auth:      public.AuthContext{Kind: public.AuthKindPersonalAccessToken, UserID: pat.UserID.String(), TokenID: pat.ID, Scopes: pat.Scopes},
+		issuedAt:  pat.CreatedAt,
+		expiresAt: pat.ExpiresAt,
+	}, nil
+}
+
+// verifyClient checks that the client of a client token is still enabled;
+// like personal access tokens, clients are not cached, so disabling one
+// takes effect at once. Only the global epoch applies to them.
+func (a *JWTAuth) verifyClient(ctx context.Context, claims tokens.Claims) (public.AuthContext, error) {
+	if err := a.activeClient(ctx, claims.ClientID); err != nil {
+		return public.AuthContext{}, err
+	}
+	if a.epochs != nil {
+		notBefore, err := a.epochs.NotBefore(ctx, "")
+		if err != nil {
+			return public.AuthContext{}, err
+		}
+		if !notBefore.IsZero() && (claims.IssuedAt == nil || claims.IssuedAt.Time.Before(notBefore)) {
+			return public.AuthContext{}, errors.New("token issued before the current epoch")
+		}
+	}
+	return public.AuthContext{Kind: public.AuthKindClient, ClientID: claims.ClientID, Scopes: strings.Fields(claims.Scope)}, nil
 }
 
-var _ public.AuthPort = (*JWTAuth)(nil)
+// activeClient checks that the client a token was issued to is still
+// enabled.
+func (a *JWTAuth) activeClient(ctx context.Context, id string) error {
+	if a.clients == nil {
+		return errors.New("client tokens are not accepted")
+	}
+	client, found, err := a.clients.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !found || !client.IsActive() {
+		return errors.New("client disabled")
+	}
+	return nil
+}
+
+// session returns the session with the given id and the epoch of its user.
+func (a *JWTAuth) session(ctx context.Context, id string) (domain.RefreshToken, time.Time, bool, error) {
+	if session, notBefore, ok := a.cache.Get(id); ok {
+		return session, notBefore, true, nil
+	}
+	gen := a.cache.generation()
+	session, found, err := a.refresh.GetByID(ctx, id)
+	if err != nil || !found {
+		return session, time.Time{}, found, err
+	}
+	var notBefore time.Time
+	if a.epochs != nil {
+		if notBefore, err = a.epochs.NotBefore(ctx, session.UserID); err != nil {
+			return domain.RefreshToken{}, time.Time{}, false, err
+		}
+	}
+	a.cache.put(session, notBefore, gen)
+	return session, notBefore, true, nil
+}
+
+var (
+	_ public.AuthPort             = (*JWTAuth)(nil)
+	_ common.AccessTokenInspector = (*JWTAuth)(nil)
+)
@@ -0,0 +1,430 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	"github.com/vaaxooo/xbackend/internal/modules/users/public"
+)
+
+func TestVerifyServesSessionsFromCacheUntilRevoked(t *testing.T) {
+	userID := domain.NewUserID()
+	session := domain.NewRefreshTokenRecord(userID, "hash", time.Now().UTC(), time.Hour)
+	repo := &sessionRepoStub{sessions: map[string]domain.RefreshToken{session.ID: session}}
+	notifier := &notifierStub{}
+	cache := NewSessionCache(10, time.Minute)
+	sessions := NewRevocationNotifier(repo, notifier, cache)
+
+	a, err := NewJWTAuth("0123456789abcdef0123456789abcdef", nil, sessions, nil, nil, nil, cache)
+	if err != nil {
+		t.Fatalf("new auth failed: %v", err)
+	}
+	token, err := a.Issue(common.AccessClaims{UserID: userID.String(), SessionID: session.ID}, time.Minute)
+	if err != nil {
+		t.Fatalf("issue failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := a.Verify(context.Background(), token); err != nil {
+			t.Fatalf("verify failed: %v", err)
+		}
+	}
+	if repo.lookups != 1 {
+		t.Fatalf("expected one lookup for three verifications, got %d", repo.lookups)
+	}
+
+	if err := sessions.Revoke(context.Background(), session.ID); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if len(notifier.ids) != 1 || notifier.ids[0] != session.ID {
+		t.Fatalf("expected the revocation to be announced, got %v", notifier.ids)
+	}
+	if _, err := a.Verify(context.Background(), token); err == nil {
+		t.Fatalf("expected a revoked session to be rejected")
+	}
+	if repo.lookups != 2 {
+		t.Fatalf("expected the revocation to invalidate the cache, got %d lookups", repo.lookups)
+	}
+}
+
+func TestSessionUpdatesAnnounceOnlyWhatCanEndTheSession(t *testing.T) {
+	now := time.Now().UTC()
+	session := domain.NewRefreshTokenRecord(domain.NewUserID(), "hash", now, time.Hour)
+	repo := &sessionRepoStub{sessions: map[string]domain.RefreshToken{session.ID: session}}
+	notifier := &notifierStub{}
+	sessions := NewRevocationNotifier(repo, notifier, NewSessionCache(10, time.Minute))
+
+	rotated := session
+	rotated.ExpiresAt = now.Add(2 * time.Hour)
+	if err := sessions.Update(context.Background(), rotated); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if len(notifier.ids) != 0 {
+		t.Fatalf("expected an extended session not to be announced, got %v", notifier.ids)
+	}
+
+	shortened := rotated
+	shortened.ExpiresAt = now.Add(time.Minute)
+	if err := sessions.Update(context.Background(), shortened); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	revoked := shortened
+	revoked.RevokedAt = &now
+	if err := sessions.Update(context.Background(), revoked); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if len(notifier.ids) != 2 {
+		t.Fatalf("expected a shorter expiry and a revocation to be announced, got %v", notifier.ids)
+	}
+}
+
+func TestVerifyRejectsTokensIssuedBeforeTheEpoch(t *testing.T) {
+	userID := domain.NewUserID()
+	session := domain.NewRefreshTokenRecord(userID, "hash", time.Now().UTC(), time.Hour)
+	repo := &sessionRepoStub{sessions: map[string]domain.RefreshToken{session.ID: session}}
+	notifier := &notifierStub{}
+	cache := NewSessionCache(10, time.Minute)
+	epochs := NewEpochNotifier(&epochRepoStub{}, notifier, cache)
+
+	a, err := NewJWTAuth("0123456789abcdef0123456789abcdef", nil, repo, epochs, nil, nil, cache)
+	if err != nil {
+		t.Fatalf("new auth failed: %v", err)
+	}
+	token, err := a.Issue(common.AccessClaims{UserID: userID.String(), SessionID: session.ID}, time.Minute)
+	if err != nil {
+		t.Fatalf("issue failed: %v", err)
+	}
+	if _, err := a.Verify(context.Background(), token); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+
+	if err := epochs.Set(context.Background(), domain.NewTokenEpoch(userID, time.Now())); err != nil {
+		t.Fatalf("set epoch failed: %v", err)
+	}
+	if len(notifier.ids) != 1 || notifier.ids[0] != "" {
+		t.Fatalf("expected the epoch to purge every cache, got %v", notifier.ids)
+	}
+	if _, err := a.Verify(context.Background(), token); err == nil {
+		t.Fatalf("expected a token from before the epoch to be rejected")
+	}
+	if repo.lookups != 2 {
+		t.Fatalf("expected the epoch to purge the cache, got %d lookups", repo.lookups)
+	}
+}
+
+func TestVerifyAcceptsPersonalAccessTokens(t *testing.T) {
+	userID := domain.NewUserID()
+	raw := domain.PersonalAccessTokenPrefix + "secret"
+	pat, err := domain.NewPersonalAccessToken(userID, "ci", raw[:8], common.HashToken(raw), []string{domain.ScopeProfileRead}, time.Now().Add(-time.Hour), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("new token failed: %v", err)
+	}
+	pats := &accessTokenRepoStub{tokens: map[string]domain.PersonalAccessToken{pat.ID: pat}}
+	epochs := &epochRepoStub{}
+	a, err := NewJWTAuth("0123456789abcdef0123456789abcdef", nil, &sessionRepoStub{}, epochs, pats, nil, nil)
+	if err != nil {
+		t.Fatalf("new auth failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		ctx, err := a.Verify(context.Background(), raw)
+		if err != nil {
+			t.Fatalf("verify failed: %v", err)
+		}
+		if ctx.Kind != public.AuthKindPersonalAccessToken || ctx.UserID != userID.String() || ctx.TokenID != pat.ID || !ctx.HasScope(domain.ScopeProfileRead) || ctx.HasScope(domain.ScopeProfileWrite) {
+			t.Fatalf("unexpected auth context: %+v", ctx)
+		}
+	}
+	if pats.touches != 1 {
+		t.Fatalf("expected the last use to be recorded once a minute, got %d touches", pats.touches)
+	}
+
+	if _, err := a.Verify(context.Background(), raw+"x"); err == nil {
+		t.Fatalf("expected an unknown token to be rejected")
+	}
+	if err := epochs.Set(context.Background(), domain.NewTokenEpoch("", time.Now())); err != nil {
+		t.Fatalf("set epoch failed: %v", err)
+	}
+	if _, err := a.Verify(context.Background(), raw); err == nil {
+		t.Fatalf("expected a token from before the epoch to be rejected")
+	}
+}
+
+func TestVerifyAcceptsClientTokens(t *testing.T) {
+	client, err := domain.NewOAuthClient("billing", domain.ClientAuthSecret, "hash", "", []string{domain.ScopeRevocationsRead}, nil, time.Now())
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+	clients := &clientRepoStub{clients: map[string]domain.OAuthClient{client.ID: client}}
+	epochs := &epochRepoStub{}
+	a, err := NewJWTAuth("0123456789abcdef0123456789abcdef", nil, &sessionRepoStub{}, epochs, nil, clients, nil)
+	if err != nil {
+		t.Fatalf("new auth failed: %v", err)
+	}
+
+	token, err := a.Issue(common.AccessClaims{ClientID: client.ID, Scopes: client.Scopes}, time.Minute)
+	if err != nil {
+		t.Fatalf("issue failed: %v", err)
+	}
+	ctx, err := a.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if ctx.Kind != public.AuthKindClient || ctx.ClientID != client.ID || ctx.UserID != "" || !ctx.HasScope(domain.ScopeRevocationsRead) || ctx.HasScope(domain.ScopeProfileRead) {
+		t.Fatalf("unexpected auth context: %+v", ctx)
+	}
+	info, err := a.Inspect(context.Background(), token)
+	if err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+	if info.ClientID != client.ID || info.IssuedAt.IsZero() || info.ExpiresAt.Sub(info.IssuedAt) != time.Minute {
+		t.Fatalf("unexpected token info: %+v", info)
+	}
+
+	// A user's epoch does not reach clients; the global one does.
+	if err := epochs.Set(context.Background(), domain.NewTokenEpoch(domain.NewUserID(), time.Now())); err != nil {
+		t.Fatalf("set epoch failed: %v", err)
+	}
+	if _, err := a.Verify(context.Background(), token); err != nil {
+		t.Fatalf("expected a user's epoch to leave clients alone, got %v", err)
+	}
+	if err := epochs.Set(context.Background(), domain.NewTokenEpoch("", time.Now())); err != nil {
+		t.Fatalf("set epoch failed: %v", err)
+	}
+	if _, err := a.Verify(context.Background(), token); err == nil {
+		t.Fatalf("expected a token from before the global epoch to be rejected")
+	}
+
+	delete(epochs.epochs, "")
+	disabledAt := time.Now()
+	client.DisabledAt = &disabledAt
+	clients.clients[client.ID] = client
+	if _, err := a.Verify(context.Background(), token); err == nil {
+		t.Fatalf("expected the token of a disabled client to be rejected")
+	}
+}
+
+func TestVerifyLimitsGrantedSessionsToTheirScopes(t *testing.T) {
+	client, err := domain.NewOAuthClient("web", domain.ClientAuthNone, "", "", nil, []string{"https://app.example.com/callback"}, time.Now())
+	if err != nil {
+		t.Fatalf("new client failed: %v", err)
+	}
+	clients := &clientRepoStub{clients: map[string]domain.OAuthClient{client.ID: client}}
+	userID := domain.NewUserID()
+	session := domain.NewRefreshTokenRecord(userID, "hash", time.Now().UTC(), time.Hour)
+	sessions := &sessionRepoStub{sessions: map[string]domain.RefreshToken{session.ID: session}}
+	a, err := NewJWTAuth("0123456789abcdef0123456789abcdef", nil, sessions, nil, nil, clients, nil)
+	if err != nil {
+		t.Fatalf("new auth failed: %v", err)
+	}
+
+	token, err := a.Issue(common.GrantClaims(session, domain.OAuthGrant{SessionID: session.ID, ClientID: client.ID, Scopes: []string{domain.ScopeOpenID}}), time.Minute)
+	if err != nil {
+		t.Fatalf("issue failed: %v", err)
+	}
+	ctx, err := a.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if ctx.Kind != public.AuthKindGrant || ctx.UserID != userID.String() || ctx.ClientID != client.ID || !ctx.AuthTime.IsZero() || !ctx.HasScope(domain.ScopeOpenID) || ctx.HasScope(domain.ScopeProfileRead) {
+		t.Fatalf("unexpected auth context: %+v", ctx)
+	}
+
+	disabledAt := time.Now()
+	client.DisabledAt = &disabledAt
+	clients.clients[client.ID] = client
+	if _, err := a.Verify(context.Background(), token); err == nil {
+		t.Fatalf("expected the token of a disabled client to be rejected")
+	}
+}
+
+func TestSessionCacheIsBoundedAndShortLived(t *testing.T) {
+	now := time.Now()
+	cache := NewSessionCache(2, time.Second)
+	cache.now = func() time.Time { return now }
+	sessions := make([]domain.RefreshToken, 3)
+	for i := range sessions {
+		sessions[i] = domain.NewRefreshTokenRecord(domain.NewUserID(), "hash", now, time.Hour)
+	}
+
+	cache.put(sessions[0], time.Time{}, cache.generation())
+	cache.put(sessions[1], time.Time{}, cache.generation())
+	cache.Get(sessions[0].ID)
+	cache.put(sessions[2], time.Time{}, cache.generation())
+	if _, _, ok := cache.Get(sessions[1].ID); ok {
+		t.Fatalf("expected the least recently used session to be evicted")
+	}
+	if _, _, ok := cache.Get(sessions[0].ID); !ok {
+		t.Fatalf("expected a recently used session to stay")
+	}
+
+	now = now.Add(time.Second)
+	if _, _, ok := cache.Get(sessions[2].ID); ok {
+		t.Fatalf("expected a stale session to be dropped")
+	}
+
+	// A lookup that raced with an invalidation must not cache what it read.
+	gen := cache.generation()
+	cache.HandleNotification(sessions[1].ID)
+	cache.put(sessions[1], time.Time{}, gen)
+	if _, _, ok := cache.Get(sessions[1].ID); ok {
+		t.Fatalf("expected a read from before the invalidation to be ignored")
+	}
+
+	cache.put(sessions[1], time.Time{}, cache.generation())
+	cache.HandleNotification("")
+	if _, _, ok := cache.Get(sessions[1].ID); ok {
+		t.Fatalf("expected an empty notification to purge the cache")
+	}
+
+	if NewSessionCache(0, time.Second) != nil {
+		t.Fatalf("expected a zero size to disable the cache")
+	}
+}
+
+type notifierStub struct {
+	ids []string
+}
+
+func (n *notifierStub) Notify(_ context.Context, sessionID string) error {
+	n.ids = append(n.ids, sessionID)
+	return nil
+}
+
+type epochRepoStub struct {
+	epochs map[domain.UserID]time.Time
+}
+
+func (s *epochRepoStub) Set(_ context.Context, e domain.TokenEpoch) error {
+	if s.epochs == nil {
+		s.epochs = make(map[domain.UserID]time.Time)
+	}
+	s.epochs[e.UserID] = e.NotBefore
+	return nil
+}
+
+func (s *epochRepoStub) NotBefore(_ context.Context, userID domain.UserID) (time.Time, error) {
+	notBefore := s.epochs[""]
+	if t := s.epochs[userID]; t.After(notBefore) {
+		notBefore = t
+	}
+	return notBefore, nil
+}
+
+func (s *epochRepoStub) ListAfter(context.Context, time.Time) ([]domain.TokenEpoch, error) {
+	return nil, nil
+}
+
+type accessTokenRepoStub struct {
+	tokens  map[string]domain.PersonalAccessToken
+	touches int
+}
+
+func (s *accessTokenRepoStub) Create(_ context.Context, t domain.PersonalAccessToken) error {
+	s.tokens[t.ID] = t
+	return nil
+}
+
+func (s *accessTokenRepoStub) GetByHash(_ context.Context, hash string) (domain.PersonalAccessToken, bool, error) {
+	for _, t := range s.tokens {
+		if t.TokenHash == hash {
+			return t, true, nil
+		}
+	}
+	return domain.PersonalAccessToken{}, false, nil
+}
+
+func (s *accessTokenRepoStub) GetByID(_ context.Context, id string) (domain.PersonalAccessToken, bool, error) {
+	t, ok := s.tokens[id]
+	return t, ok, nil
+}
+
+func (s *accessTokenRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.PersonalAccessToken, error) {
+	return nil, nil
+}
+
+func (s *accessTokenRepoStub) Touch(_ context.Context, id string, usedAt time.Time) error {
+	s.touches++
+	t := s.tokens[id]
+	t.LastUsedAt = &usedAt
+	s.tokens[id] = t
+	return nil
+}
+
+func (s *accessTokenRepoStub) Revoke(context.Context, string) error { return nil }
+
+func (s *accessTokenRepoStub) RevokeByUser(context.Context, domain.UserID) error { return nil }
+
+type sessionRepoStub struct {
+	sessions map[string]domain.RefreshToken
+	lookups  int
+}
+
+func (s *sessionRepoStub) Create(_ context.Context, t domain.RefreshToken) error {
+	s.sessions[t.ID] = t
+	return nil
+}
+
+func (s *sessionRepoStub) Update(_ context.Context, t domain.RefreshToken) error {
+	s.sessions[t.ID] = t
+	return nil
+}
+
+func (s *sessionRepoStub) GetByHash(context.Context, string) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+
+func (s *sessionRepoStub) GetByID(_ context.Context, id string) (domain.RefreshToken, bool, error) {
+	s.lookups++
+	t, ok := s.sessions[id]
+	return t, ok, nil
+}
+
+func (s *sessionRepoStub) ListByUser(context.Context, domain.UserID) ([]domain.RefreshToken, error) {
+	return nil, nil
+}
+
+func (s *sessionRepoStub) ListActiveByUser(context.Context, domain.UserID, time.Time) ([]domain.RefreshToken, error) {
+	return nil, nil
+}
+
+func (s *sessionRepoStub) FindActiveByFingerprint(context.Context, domain.UserID, string, string, time.Time) (domain.RefreshToken, bool, error) {
+	return domain.RefreshToken{}, false, nil
+}
+
+func (s *sessionRepoStub) Revoke(_ context.Context, id string) error {
+	t := s.sessions[id]
+	now := time.Now().UTC()
+	t.RevokedAt = &now
+	s.sessions[id] = t
+	return nil
+}
+
+func (s *sessionRepoStub) RevokeAllExcept(context.Context, domain.UserID, []string) ([]string, error) {
+	return nil, nil
+}
+
+type clientRepoStub struct {
+	clients map[string]domain.OAuthClient
+}
+
+func (s *clientRepoStub) Create(_ context.Context, c domain.OAuthClient) error {
+	s.clients[c.ID] = c
+	return nil
+}
+
+func (s *clientRepoStub) GetByID(_ context.Context, id string) (domain.OAuthClient, bool, error) {
+	c, ok := s.clients[id]
+	return c, ok, nil
+}
+
+func (s *clientRepoStub) List(context.Context) ([]domain.OAuthClient, error) {
+	return nil, nil
+}
+
+func (s *clientRepoStub) Disable(context.Context, string, time.Time) error {
+	return nil
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// Notifier announces that a session changed. Implementations must deliver
+// the announcement to every instance (Postgres NOTIFY), not just this one.
+type Notifier interface {
+	Notify(ctx context.Context, sessionID string) error
+}
+
+// RevocationNotifier wraps the session repository so that every write that
+// can end a session drops it from the local cache and announces it to the
+// other instances. Reads go straight to the wrapped repository.
+type RevocationNotifier struct {
+	domain.RefreshTokenRepository
+	notifier Notifier
+	cache    *SessionCache
+}
+
+// NewRevocationNotifier returns refresh unchanged when there is neither a
+// notifier nor a cache.
+func NewRevocationNotifier(refresh domain.RefreshTokenRepository, notifier Notifier, cache *SessionCache) domain.RefreshTokenRepository {
+	if notifier == nil && cache == nil {
+		return refresh
+	}
+	return &RevocationNotifier{RefreshTokenRepository: refresh, notifier: notifier, cache: cache}
+}
+
+// Update covers revocations through the domain (reuse detection, logout)
+// and writes that bring the expiry closer. Other writes, such as a rotation
+// that extends the session, cannot make a cached session wrongly valid: they
+// only drop it here and are not announced, so a refresh costs no NOTIFY.
+func (r *RevocationNotifier) Update(ctx context.Context, t domain.RefreshToken) error {
+	announce := t.RevokedAt != nil
+	if !announce && r.notifier != nil {
+		prev, found, err := r.RefreshTokenRepository.GetByID(ctx, t.ID)
+		if err != nil {
+			return err
+		}
+		announce = found && t.ExpiresAt.Before(prev.ExpiresAt)
+	}
+	if err := r.RefreshTokenRepository.Update(ctx, t); err != nil {
+		return err
+	}
+	if !announce {
+		r.cache.Invalidate(t.ID)
+		return nil
+	}
+	return r.changed(ctx, t.ID)
+}
+
+func (r *RevocationNotifier) Revoke(ctx context.Context, tokenID string) error {
+	if err := r.RefreshTokenRepository.Revoke(ctx, tokenID); err != nil {
+		return err
+	}
+	return r.changed(ctx, tokenID)
+}
+
+func (r *RevocationNotifier) RevokeAllExcept(ctx context.Context, userID domain.UserID, keepIDs []string) ([]string, error) {
+	revoked, err := r.RefreshTokenRepository.RevokeAllExcept(ctx, userID, keepIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range revoked {
+		if err := r.changed(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return revoked, nil
+}
+
+// changed invalidates locally right away; the announcement reaches the
+// other instances (and this one again) once the transaction commits.
+func (r *RevocationNotifier) changed(ctx context.Context, sessionID string) error {
+	r.cache.Invalidate(sessionID)
+	if r.notifier == nil {
+		return nil
+	}
+	return r.notifier.Notify(ctx, sessionID)
+}
+
+var _ domain.RefreshTokenRepository = (*RevocationNotifier)(nil)
+
+// EpochNotifier wraps the epoch repository so that a new epoch purges the
+// session caches of every instance: cached entries carry the old epoch.
+type EpochNotifier struct {
+	domain.TokenEpochRepository
+	notifier Notifier
+	cache    *SessionCache
+}
+
+func NewEpochNotifier(epochs domain.TokenEpochRepository, notifier Notifier, cache *SessionCache) *EpochNotifier {
+	return &EpochNotifier{TokenEpochRepository: epochs, notifier: notifier, cache: cache}
+}
+
+func (e *EpochNotifier) Set(ctx context.Context, epoch domain.TokenEpoch) error {
+	if err := e.TokenEpochRepository.Set(ctx, epoch); err != nil {
+		return err
+	}
+	e.cache.Purge()
+	if e.notifier == nil {
+		return nil
+	}
+	// An empty session id stands for all of them.
+	return e.notifier.Notify(ctx, "")
+}
+
+var _ domain.TokenEpochRepository = (*EpochNotifier)(nil)
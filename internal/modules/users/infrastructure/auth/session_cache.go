@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// DefaultSessionCacheTTL bounds how long a cached session may be served
+// when no TTL is configured. Without cross-instance invalidation it is also
+// how long a revocation on another instance can go unnoticed.
+const DefaultSessionCacheTTL = 5 * time.Second
+
+// SessionCache keeps recently verified sessions in memory, along with the
+// token epoch of their user, so that access tokens do not cost a database
+// query on every request. It holds at most
+// size sessions, evicting the least recently used, and serves each one for
+// ttl at most. A nil *SessionCache caches nothing.
+type SessionCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	// gen changes on every invalidation, so a lookup that raced with one
+	// does not store what it read before it.
+	gen uint64
+}
+
+type cachedSession struct {
+	session   domain.RefreshToken
+	notBefore time.Time
+	cachedAt  time.Time
+}
+
+// NewSessionCache returns nil when size is not positive.
+func NewSessionCache(size int, ttl time.Duration) *SessionCache {
+	if size <= 0 {
+		return nil
+	}
+	if ttl <= 0 {
+		ttl = DefaultSessionCacheTTL
+	}
+	return &SessionCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// Get returns the cached session with the given id and the epoch of its
+// user unless they are stale.
+func (c *SessionCache) Get(id string) (domain.RefreshToken, time.Time, bool) {
+	if c == nil {
+		return domain.RefreshToken{}, time.Time{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[id]
+	if !ok {
+		return domain.RefreshToken{}, time.Time{}, false
+	}
+	entry := el.Value.(*cachedSession)
+	if c.now().Sub(entry.cachedAt) >= c.ttl {
+		c.remove(el)
+		return domain.RefreshToken{}, time.Time{}, false
+	}
+	c.order.MoveToFront(el)
+	return entry.session, entry.notBefore, true
+}
+
+// generation returns the token to pass to put after reading a session.
+func (c *SessionCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// put stores s unless something was invalidated since gen was taken.
+func (c *SessionCache) put(s domain.RefreshToken, notBefore time.Time, gen uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	entry := &cachedSession{session: s, notBefore: notBefore, cachedAt: c.now()}
+	if el, ok := c.entries[s.ID]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[s.ID] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Invalidate drops the session with the given id.
+func (c *SessionCache) Invalidate(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if el, ok := c.entries[id]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge drops every session, e.g. after a new token epoch or when
+// invalidations may have been lost.
+func (c *SessionCache) Purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.entries = make(map[string]*list.Element, c.size)
+	c.order.Init()
+}
+
+// HandleNotification applies an announcement: the payload is a session id,
+// and an empty one means that any session may be stale.
+func (c *SessionCache) HandleNotification(payload string) {
+	if payload == "" {
+		c.Purge()
+		return
+	}
+	c.Invalidate(payload)
+}
+
+func (c *SessionCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*cachedSession).session.ID)
+}
@@ -19,6 +19,16 @@ type emailTemplates struct {
 	confirmationHTML *htmpl.Template
 	resetText        *ttmpl.Template
 	resetHTML        *htmpl.Template
+	loginCodeText    *ttmpl.Template
+	loginCodeHTML    *htmpl.Template
+	recoveryText     *ttmpl.Template
+	recoveryHTML     *htmpl.Template
+	scheduledText    *ttmpl.Template
+	scheduledHTML    *htmpl.Template
+	recoveredText    *ttmpl.Template
+	recoveredHTML    *htmpl.Template
+	changedText      *ttmpl.Template
+	changedHTML      *htmpl.Template
 }
 
 func mustLoadEmailTemplates() emailTemplates {
@@ -27,6 +37,16 @@ func mustLoadEmailTemplates() emailTemplates {
 		confirmationHTML: htmpl.Must(htmpl.ParseFS(emailTemplateFS, "templates/confirm_email.html")),
 		resetText:        ttmpl.Must(ttmpl.ParseFS(emailTemplateFS, "templates/reset_password.txt")),
 		resetHTML:        htmpl.Must(htmpl.ParseFS(emailTemplateFS, "templates/reset_password.html")),
+		loginCodeText:    ttmpl.Must(ttmpl.ParseFS(emailTemplateFS, "templates/login_code.txt")),
+		loginCodeHTML:    htmpl.Must(htmpl.ParseFS(emailTemplateFS, "templates/login_code.html")),
+		recoveryText:     ttmpl.Must(ttmpl.ParseFS(emailTemplateFS, "templates/recovery_code.txt")),
+		recoveryHTML:     htmpl.Must(htmpl.ParseFS(emailTemplateFS, "templates/recovery_code.html")),
+		scheduledText:    ttmpl.Must(ttmpl.ParseFS(emailTemplateFS, "templates/recovery_scheduled.txt")),
+		scheduledHTML:    htmpl.Must(htmpl.ParseFS(emailTemplateFS, "templates/recovery_scheduled.html")),
+		recoveredText:    ttmpl.Must(ttmpl.ParseFS(emailTemplateFS, "templates/recovery_completed.txt")),
+		recoveredHTML:    htmpl.Must(htmpl.ParseFS(emailTemplateFS, "templates/recovery_completed.html")),
+		changedText:      ttmpl.Must(ttmpl.ParseFS(emailTemplateFS, "templates/password_changed.txt")),
+		changedHTML:      htmpl.Must(htmpl.ParseFS(emailTemplateFS, "templates/password_changed.html")),
 	}
 }
 
@@ -52,6 +72,87 @@ func (t emailTemplates) renderPasswordReset(evt userevents.PasswordResetRequeste
 	return renderTemplates(t.resetText, t.resetHTML, data)
 }
 
+func (t emailTemplates) renderLoginCode(evt userevents.LoginCodeRequested) (string, string, error) {
+	data := struct {
+		Code      string
+		Expires   string
+		IP        string
+		UserAgent string
+		Location  string
+	}{
+		Code:      evt.Code,
+		Expires:   evt.ExpiresAt.Format(emailTemplateDateFormat),
+		IP:        evt.IP,
+		UserAgent: evt.UserAgent,
+		Location:  formatLocation(evt.City, evt.Country),
+	}
+	return renderTemplates(t.loginCodeText, t.loginCodeHTML, data)
+}
+
+func (t emailTemplates) renderRecoveryCode(evt userevents.AccountRecoveryRequested) (string, string, error) {
+	data := struct {
+		Code    string
+		Expires string
+	}{
+		Code:    evt.Code,
+		Expires: evt.ExpiresAt.Format(emailTemplateDateFormat),
+	}
+	return renderTemplates(t.recoveryText, t.recoveryHTML, data)
+}
+
+func (t emailTemplates) renderRecoveryScheduled(evt userevents.AccountRecoveryScheduled) (string, string, error) {
+	data := struct {
+		Ready       string
+		CancelURL   string
+		CancelToken string
+		IP          string
+		UserAgent   string
+		Location    string
+	}{
+		Ready:       evt.ReadyAt.Format(emailTemplateDateFormat),
+		CancelURL:   evt.CancelURL,
+		CancelToken: evt.CancelToken,
+		IP:          evt.IP,
+		UserAgent:   evt.UserAgent,
+		Location:    formatLocation(evt.City, evt.Country),
+	}
+	return renderTemplates(t.scheduledText, t.scheduledHTML, data)
+}
+
+func (t emailTemplates) renderRecoveryCompleted(userevents.AccountRecoveryCompleted) (string, string, error) {
+	return renderTemplates(t.recoveredText, t.recoveredHTML, nil)
+}
+
+func (t emailTemplates) renderPasswordChanged(evt userevents.PasswordChanged) (string, string, error) {
+	data := struct {
+		Reset     bool
+		When      string
+		IP        string
+		UserAgent string
+		Location  string
+	}{
+		Reset:     evt.Method == userevents.PasswordChangedByReset,
+		When:      evt.OccurredAt.Format(emailTemplateDateFormat),
+		IP:        evt.IP,
+		UserAgent: evt.UserAgent,
+		Location:  formatLocation(evt.City, evt.Country),
+	}
+	return renderTemplates(t.changedText, t.changedHTML, data)
+}
+
+// formatLocation joins the parts of a GeoIP location that are known, e.g.
+// "Berlin, DE".
+func formatLocation(city, country string) string {
+	switch {
+	case city != "" && country != "":
+		return city + ", " + country
+	case city != "":
+		return city
+	default:
+		return country
+	}
+}
+
 func renderTemplates(textTpl *ttmpl.Template, htmlTpl *htmpl.Template, data any) (string, string, error) {
 	var textBuf bytes.Buffer
 	if err := textTpl.Execute(&textBuf, data); err != nil {
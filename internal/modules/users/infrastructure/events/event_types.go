@@ -6,4 +6,10 @@ const (
 	EventTypeUserRegistered             EventType = "users.user_registered"
 	EventTypeEmailConfirmationRequested EventType = "users.email_confirmation_requested"
 	EventTypePasswordResetRequested     EventType = "users.password_reset_requested"
+	EventTypeLoginCodeRequested         EventType = "users.login_code_requested"
+	EventTypeAccountRecoveryRequested   EventType = "users.account_recovery_requested"
+	EventTypeAccountRecoveryScheduled   EventType = "users.account_recovery_scheduled"
+	EventTypeAccountRecoveryCompleted   EventType = "users.account_recovery_completed"
+	EventTypeSessionRevoked             EventType = "users.session_revoked"
+	EventTypePasswordChanged            EventType = "users.password_changed"
 )
@@ -54,5 +54,69 @@ func (p *LoggerPublisher) PublishPasswordResetRequested(ctx context.Context, eve
 	return nil
 }
 
+func (p *LoggerPublisher) PublishLoginCodeRequested(ctx context.Context, event userevents.LoginCodeRequested) error {
+	event.Code = ""
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Info(ctx, "user.login_code_requested", "event", string(payload), "published_at", p.clock().UTC())
+	return nil
+}
+
+func (p *LoggerPublisher) PublishAccountRecoveryRequested(ctx context.Context, event userevents.AccountRecoveryRequested) error {
+	event.Code = ""
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Info(ctx, "user.account_recovery_requested", "event", string(payload), "published_at", p.clock().UTC())
+	return nil
+}
+
+func (p *LoggerPublisher) PublishAccountRecoveryScheduled(ctx context.Context, event userevents.AccountRecoveryScheduled) error {
+	event.CancelToken = ""
+	event.CancelURL = ""
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Info(ctx, "user.account_recovery_scheduled", "event", string(payload), "published_at", p.clock().UTC())
+	return nil
+}
+
+func (p *LoggerPublisher) PublishAccountRecoveryCompleted(ctx context.Context, event userevents.AccountRecoveryCompleted) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Info(ctx, "user.account_recovery_completed", "event", string(payload), "published_at", p.clock().UTC())
+	return nil
+}
+
+func (p *LoggerPublisher) PublishSessionRevoked(ctx context.Context, event userevents.SessionRevoked) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Info(ctx, "user.session_revoked", "event", string(payload), "published_at", p.clock().UTC())
+	return nil
+}
+
+func (p *LoggerPublisher) PublishPasswordChanged(ctx context.Context, event userevents.PasswordChanged) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Info(ctx, "user.password_changed", "event", string(payload), "published_at", p.clock().UTC())
+	return nil
+}
+
 // Ensure LoggerPublisher implements the application contract.
 var _ common.EventPublisher = (*LoggerPublisher)(nil)
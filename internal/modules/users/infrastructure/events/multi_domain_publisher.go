@@ -24,4 +24,21 @@ func (p *MultiDomainPublisher) Publish(ctx context.Context, eventID string, even
 	return nil
 }
 
-var _ common.DomainEventPublisher = (*MultiDomainPublisher)(nil)
+// PublishSensitive forwards sensitive fields only to publishers implementing
+// common.SensitiveDomainEventPublisher; the rest receive the public payload.
+func (p *MultiDomainPublisher) PublishSensitive(ctx context.Context, eventID string, eventType string, payload []byte, sensitive []byte) error {
+	for _, pub := range p.publishers {
+		var err error
+		if sp, ok := pub.(common.SensitiveDomainEventPublisher); ok {
+			err = sp.PublishSensitive(ctx, eventID, eventType, payload, sensitive)
+		} else {
+			err = pub.Publish(ctx, eventID, eventType, payload)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ common.SensitiveDomainEventPublisher = (*MultiDomainPublisher)(nil)
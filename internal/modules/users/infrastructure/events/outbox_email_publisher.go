@@ -2,7 +2,7 @@ package events
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
 	userevents "github.com/vaaxooo/xbackend/internal/modules/users/application/events"
@@ -21,13 +21,22 @@ func NewOutboxEmailPublisher(mailer Mailer, logger plog.Logger) *OutboxEmailPubl
 	return &OutboxEmailPublisher{mailer: mailer, logger: logger, templates: defaultEmailTemplates}
 }
 
-func (p *OutboxEmailPublisher) Publish(ctx context.Context, _ string, eventType string, payload []byte) error {
+func (p *OutboxEmailPublisher) Publish(ctx context.Context, eventID string, eventType string, payload []byte) error {
+	return p.PublishSensitive(ctx, eventID, eventType, payload, nil)
+}
+
+// PublishSensitive renders emails from the public payload merged with the
+// sensitive fields (verification code, reset token).
+func (p *OutboxEmailPublisher) PublishSensitive(ctx context.Context, _ string, eventType string, payload []byte, sensitive []byte) error {
 	switch eventType {
 	case string(EventTypeEmailConfirmationRequested):
 		var evt userevents.EmailConfirmationRequested
-		if err := json.Unmarshal(payload, &evt); err != nil {
+		if err := mergeSensitive(&evt, payload, sensitive); err != nil {
 			return err
 		}
+		if evt.Code == "" {
+			return errors.New("email confirmation event has no code")
+		}
 		text, html, err := p.templates.renderConfirmation(evt)
 		if err != nil {
 			return err
@@ -35,18 +44,80 @@ func (p *OutboxEmailPublisher) Publish(ctx context.Context, _ string, eventType
 		return p.mailer.Send(ctx, evt.Email, "Подтверждение почты", text, html)
 	case string(EventTypePasswordResetRequested):
 		var evt userevents.PasswordResetRequested
-		if err := json.Unmarshal(payload, &evt); err != nil {
+		if err := mergeSensitive(&evt, payload, sensitive); err != nil {
 			return err
 		}
+		if evt.Token == "" {
+			return errors.New("password reset event has no token")
+		}
 		text, html, err := p.templates.renderPasswordReset(evt)
 		if err != nil {
 			return err
 		}
 		return p.mailer.Send(ctx, evt.Email, "Сброс пароля", text, html)
+	case string(EventTypeLoginCodeRequested):
+		var evt userevents.LoginCodeRequested
+		if err := mergeSensitive(&evt, payload, sensitive); err != nil {
+			return err
+		}
+		if evt.Code == "" {
+			return errors.New("login code event has no code")
+		}
+		text, html, err := p.templates.renderLoginCode(evt)
+		if err != nil {
+			return err
+		}
+		return p.mailer.Send(ctx, evt.Email, "Код для входа", text, html)
+	case string(EventTypeAccountRecoveryRequested):
+		var evt userevents.AccountRecoveryRequested
+		if err := mergeSensitive(&evt, payload, sensitive); err != nil {
+			return err
+		}
+		if evt.Code == "" {
+			return errors.New("account recovery event has no code")
+		}
+		text, html, err := p.templates.renderRecoveryCode(evt)
+		if err != nil {
+			return err
+		}
+		return p.mailer.Send(ctx, evt.Email, "Восстановление доступа", text, html)
+	case string(EventTypeAccountRecoveryScheduled):
+		var evt userevents.AccountRecoveryScheduled
+		if err := mergeSensitive(&evt, payload, sensitive); err != nil {
+			return err
+		}
+		if evt.CancelToken == "" {
+			return errors.New("account recovery event has no cancel token")
+		}
+		text, html, err := p.templates.renderRecoveryScheduled(evt)
+		if err != nil {
+			return err
+		}
+		return p.mailer.Send(ctx, evt.Email, "Запрошено восстановление доступа", text, html)
+	case string(EventTypeAccountRecoveryCompleted):
+		var evt userevents.AccountRecoveryCompleted
+		if err := mergeSensitive(&evt, payload, sensitive); err != nil {
+			return err
+		}
+		text, html, err := p.templates.renderRecoveryCompleted(evt)
+		if err != nil {
+			return err
+		}
+		return p.mailer.Send(ctx, evt.Email, "Доступ восстановлен", text, html)
+	case string(EventTypePasswordChanged):
+		var evt userevents.PasswordChanged
+		if err := mergeSensitive(&evt, payload, sensitive); err != nil {
+			return err
+		}
+		text, html, err := p.templates.renderPasswordChanged(evt)
+		if err != nil {
+			return err
+		}
+		return p.mailer.Send(ctx, evt.Email, "Пароль изменён", text, html)
 	default:
 		p.logger.Debug(ctx, "outbox event ignored", "event_type", eventType)
 		return nil
 	}
 }
 
-var _ common.DomainEventPublisher = (*OutboxEmailPublisher)(nil)
+var _ common.SensitiveDomainEventPublisher = (*OutboxEmailPublisher)(nil)
@@ -10,9 +10,13 @@ import (
 // It is persisted by application use-cases inside the same transaction as
 // domain changes so it can be retried later by a background worker.
 type OutboxMessage struct {
-	ID          uuid.UUID
-	EventType   string
-	Payload     []byte
+	ID        uuid.UUID
+	EventType string
+	Payload   []byte
+	// Sensitive holds the fields split out of Payload because they must not
+	// reach generic publishers. It is encrypted at rest and cleared once the
+	// message is published.
+	Sensitive   []byte
 	OccurredAt  time.Time
 	CreatedAt   time.Time
 	PublishedAt *time.Time
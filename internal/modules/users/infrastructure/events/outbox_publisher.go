@@ -2,7 +2,6 @@ package events
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -37,11 +36,35 @@ func (p *OutboxPublisher) PublishPasswordResetRequested(ctx context.Context, eve
 	return p.publish(ctx, EventTypePasswordResetRequested, event.OccurredAt, event)
 }
 
+func (p *OutboxPublisher) PublishLoginCodeRequested(ctx context.Context, event userevents.LoginCodeRequested) error {
+	return p.publish(ctx, EventTypeLoginCodeRequested, event.OccurredAt, event)
+}
+
+func (p *OutboxPublisher) PublishAccountRecoveryRequested(ctx context.Context, event userevents.AccountRecoveryRequested) error {
+	return p.publish(ctx, EventTypeAccountRecoveryRequested, event.OccurredAt, event)
+}
+
+func (p *OutboxPublisher) PublishAccountRecoveryScheduled(ctx context.Context, event userevents.AccountRecoveryScheduled) error {
+	return p.publish(ctx, EventTypeAccountRecoveryScheduled, event.OccurredAt, event)
+}
+
+func (p *OutboxPublisher) PublishAccountRecoveryCompleted(ctx context.Context, event userevents.AccountRecoveryCompleted) error {
+	return p.publish(ctx, EventTypeAccountRecoveryCompleted, event.OccurredAt, event)
+}
+
+func (p *OutboxPublisher) PublishSessionRevoked(ctx context.Context, event userevents.SessionRevoked) error {
+	return p.publish(ctx, EventTypeSessionRevoked, event.OccurredAt, event)
+}
+
+func (p *OutboxPublisher) PublishPasswordChanged(ctx context.Context, event userevents.PasswordChanged) error {
+	return p.publish(ctx, EventTypePasswordChanged, event.OccurredAt, event)
+}
+
 // Ensure OutboxPublisher conforms to application contract.
 var _ common.EventPublisher = (*OutboxPublisher)(nil)
 
 func (p *OutboxPublisher) publish(ctx context.Context, eventType EventType, occurredAt time.Time, event any) error {
-	payload, err := json.Marshal(event)
+	payload, sensitive, err := splitSensitive(event)
 	if err != nil {
 		return err
 	}
@@ -50,6 +73,7 @@ func (p *OutboxPublisher) publish(ctx context.Context, eventType EventType, occu
 		ID:         uuid.New(),
 		EventType:  string(eventType),
 		Payload:    payload,
+		Sensitive:  sensitive,
 		OccurredAt: occurredAt,
 	})
 }
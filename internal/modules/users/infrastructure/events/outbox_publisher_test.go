@@ -3,6 +3,7 @@ package events
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -51,3 +52,68 @@ func TestOutboxPublisherPublishUserRegistered(t *testing.T) {
 		t.Fatalf("payload mismatch: %#v", decoded)
 	}
 }
+
+func TestOutboxPublisherSplitsSensitiveFields(t *testing.T) {
+	repo := &recordingOutboxRepo{}
+	publisher := NewOutboxPublisher(repo)
+
+	evt := userevents.PasswordResetRequested{
+		UserID:     "user-id",
+		IdentityID: "identity-id",
+		Email:      "test@example.com",
+		Token:      "reset-token",
+		ExpiresAt:  time.Now().UTC().Add(time.Hour),
+		OccurredAt: time.Now().UTC(),
+	}
+	if err := publisher.PublishPasswordResetRequested(context.Background(), evt); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	if strings.Contains(string(repo.msg.Payload), "reset-token") {
+		t.Fatalf("token leaked into public payload: %s", repo.msg.Payload)
+	}
+	if string(repo.msg.Sensitive) != `{"token":"reset-token"}` {
+		t.Fatalf("unexpected sensitive payload: %s", repo.msg.Sensitive)
+	}
+
+	var decoded userevents.PasswordResetRequested
+	if err := mergeSensitive(&decoded, repo.msg.Payload, repo.msg.Sensitive); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if decoded.Token != evt.Token || decoded.Email != evt.Email {
+		t.Fatalf("unexpected merged event: %#v", decoded)
+	}
+}
+
+type plainPublisher struct{ payload []byte }
+
+func (p *plainPublisher) Publish(_ context.Context, _ string, _ string, payload []byte) error {
+	p.payload = payload
+	return nil
+}
+
+type trustedPublisher struct{ sensitive []byte }
+
+func (p *trustedPublisher) Publish(context.Context, string, string, []byte) error { return nil }
+
+func (p *trustedPublisher) PublishSensitive(_ context.Context, _ string, _ string, _ []byte, sensitive []byte) error {
+	p.sensitive = sensitive
+	return nil
+}
+
+func TestMultiDomainPublisherWithholdsSensitiveFromGenericPublishers(t *testing.T) {
+	plain := &plainPublisher{}
+	trusted := &trustedPublisher{}
+	multi := NewMultiDomainPublisher(trusted, plain)
+
+	err := multi.PublishSensitive(context.Background(), "id", string(EventTypeEmailConfirmationRequested), []byte(`{"email":"a@b.c"}`), []byte(`{"code":"123456"}`))
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	if strings.Contains(string(plain.payload), "123456") {
+		t.Fatalf("generic publisher received sensitive fields: %s", plain.payload)
+	}
+	if string(trusted.sensitive) != `{"code":"123456"}` {
+		t.Fatalf("trusted publisher did not receive sensitive fields: %s", trusted.sensitive)
+	}
+}
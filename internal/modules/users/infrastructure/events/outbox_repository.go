@@ -10,17 +10,24 @@ import (
 	"github.com/google/uuid"
 
 	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+	"github.com/vaaxooo/xbackend/internal/platform/secrets"
 )
 
 // OutboxRepository persists integration events in the same transaction as the
 // application use-case. It also exposes helpers for background delivery.
+// Sensitive fields are sealed with cipher; a nil cipher keeps them in
+// plaintext.
 type OutboxRepository struct {
-	db    *sql.DB
-	clock func() time.Time
+	db     *sql.DB
+	cipher secrets.Cipher
+	clock  func() time.Time
 }
 
-func NewOutboxRepository(db *sql.DB) *OutboxRepository {
-	return &OutboxRepository{db: db, clock: time.Now}
+func NewOutboxRepository(db *sql.DB, cipher secrets.Cipher) *OutboxRepository {
+	if cipher == nil {
+		cipher = secrets.Plaintext{}
+	}
+	return &OutboxRepository{db: db, cipher: cipher, clock: time.Now}
 }
 
 // Add stores a new outbox record. If the ID is zero, a new UUID is generated.
@@ -33,13 +40,22 @@ func (r *OutboxRepository) Add(ctx context.Context, msg OutboxMessage) error {
 		msg.CreatedAt = now
 	}
 
+	var sensitive any
+	if len(msg.Sensitive) > 0 {
+		sealed, err := r.cipher.Encrypt(string(msg.Sensitive), sensitiveAssociatedData(msg.ID))
+		if err != nil {
+			return err
+		}
+		sensitive = sealed
+	}
+
 	const query = `
-                INSERT INTO user_events_outbox (id, event_type, payload, occurred_at, created_at)
-                VALUES ($1::uuid, $2, $3, $4, $5)
+                INSERT INTO user_events_outbox (id, event_type, payload, sensitive_payload, occurred_at, created_at)
+                VALUES ($1::uuid, $2, $3, $4, $5, $6)
         `
 
 	exec := pdb.Executor(ctx, r.db)
-	_, err := exec.ExecContext(ctx, query, msg.ID.String(), msg.EventType, msg.Payload, msg.OccurredAt, msg.CreatedAt)
+	_, err := exec.ExecContext(ctx, query, msg.ID.String(), msg.EventType, msg.Payload, sensitive, msg.OccurredAt, msg.CreatedAt)
 	return err
 }
 
@@ -50,7 +66,7 @@ func (r *OutboxRepository) GetPending(ctx context.Context, limit int) ([]OutboxM
 	}
 
 	const query = `
-                SELECT id::text, event_type, payload, occurred_at, created_at, published_at, attempts, last_error
+                SELECT id::text, event_type, payload, sensitive_payload, occurred_at, created_at, published_at, attempts, last_error
                 FROM user_events_outbox
                 WHERE published_at IS NULL
                 ORDER BY created_at
@@ -69,8 +85,9 @@ func (r *OutboxRepository) GetPending(ctx context.Context, limit int) ([]OutboxM
 		var id string
 		var publishedAt sql.NullTime
 		var lastError sql.NullString
+		var sensitive sql.NullString
 
-		if err := rows.Scan(&id, &m.EventType, &m.Payload, &m.OccurredAt, &m.CreatedAt, &publishedAt, &m.Attempts, &lastError); err != nil {
+		if err := rows.Scan(&id, &m.EventType, &m.Payload, &sensitive, &m.OccurredAt, &m.CreatedAt, &publishedAt, &m.Attempts, &lastError); err != nil {
 			return nil, err
 		}
 		parsedID, err := uuid.Parse(id)
@@ -78,6 +95,13 @@ func (r *OutboxRepository) GetPending(ctx context.Context, limit int) ([]OutboxM
 			return nil, fmt.Errorf("invalid outbox id %q: %w", id, err)
 		}
 		m.ID = parsedID
+		if sensitive.Valid && sensitive.String != "" {
+			plain, err := r.cipher.Decrypt(sensitive.String, sensitiveAssociatedData(m.ID))
+			if err != nil {
+				return nil, fmt.Errorf("outbox %s: decrypt sensitive payload: %w", id, err)
+			}
+			m.Sensitive = []byte(plain)
+		}
 		if publishedAt.Valid {
 			m.PublishedAt = &publishedAt.Time
 		}
@@ -94,10 +118,11 @@ func (r *OutboxRepository) GetPending(ctx context.Context, limit int) ([]OutboxM
 
 // MarkPublished records a successful publication attempt. Attempts counter is
 // incremented alongside the published timestamp to make retries idempotent.
+// Sensitive fields are scrubbed since they are no longer needed.
 func (r *OutboxRepository) MarkPublished(ctx context.Context, id uuid.UUID, publishedAt time.Time) error {
 	const query = `
                 UPDATE user_events_outbox
-                SET published_at = $2, attempts = attempts + 1, last_error = NULL
+                SET published_at = $2, attempts = attempts + 1, last_error = NULL, sensitive_payload = NULL
                 WHERE id = $1::uuid
         `
 	_, err := r.db.ExecContext(ctx, query, id.String(), publishedAt.UTC())
@@ -131,6 +156,93 @@ func (r *OutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, publish
 	return nil
 }
 
+// ReencryptSensitivePayloads seals the sensitive fields of pending messages
+// that are still in plaintext or sealed with a retired key using keyring's
+// primary key. Published messages carry no sensitive fields. It returns the
+// number of rows rewritten.
+func (r *OutboxRepository) ReencryptSensitivePayloads(ctx context.Context, keyring *secrets.Keyring, batchSize int) (int, error) {
+	const selectQ = `
+                SELECT id::text, sensitive_payload
+                FROM user_events_outbox
+                WHERE sensitive_payload IS NOT NULL AND id > $1::uuid
+                ORDER BY id
+                LIMIT $2
+        `
+	const updateQ = `
+                UPDATE user_events_outbox
+                SET sensitive_payload = $2
+                WHERE id = $1::uuid AND sensitive_payload = $3
+        `
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	type row struct {
+		id    uuid.UUID
+		value string
+	}
+	var (
+		after     = uuid.Nil
+		rewritten int
+	)
+	for {
+		rows, err := r.db.QueryContext(ctx, selectQ, after.String(), batchSize)
+		if err != nil {
+			return rewritten, err
+		}
+		var batch []row
+		for rows.Next() {
+			var id string
+			var rw row
+			if err := rows.Scan(&id, &rw.value); err != nil {
+				rows.Close()
+				return rewritten, err
+			}
+			if rw.id, err = uuid.Parse(id); err != nil {
+				rows.Close()
+				return rewritten, fmt.Errorf("invalid outbox id %q: %w", id, err)
+			}
+			batch = append(batch, rw)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return rewritten, err
+		}
+		rows.Close()
+
+		for _, rw := range batch {
+			if !keyring.NeedsRotation(rw.value) {
+				continue
+			}
+			aad := sensitiveAssociatedData(rw.id)
+			plain, err := keyring.Decrypt(rw.value, aad)
+			if err != nil {
+				return rewritten, err
+			}
+			sealed, err := keyring.Encrypt(plain, aad)
+			if err != nil {
+				return rewritten, err
+			}
+			res, err := r.db.ExecContext(ctx, updateQ, rw.id.String(), sealed, rw.value)
+			if err != nil {
+				return rewritten, err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				rewritten++
+			}
+		}
+
+		if len(batch) < batchSize {
+			return rewritten, nil
+		}
+		after = batch[len(batch)-1].id
+	}
+}
+
+func sensitiveAssociatedData(id uuid.UUID) string {
+	return "user_events_outbox.sensitive_payload:" + id.String()
+}
+
 // Ensure the repository can be used by the outbox worker.
 var _ interface {
 	GetPending(context.Context, int) ([]OutboxMessage, error)
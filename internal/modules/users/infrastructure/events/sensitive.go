@@ -0,0 +1,75 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// splitSensitive marshals event and moves every field tagged
+// `sensitive:"true"` out of the public payload into a separate JSON object.
+// sensitive is nil when the event has no such fields.
+func splitSensitive(event any) (payload []byte, sensitive []byte, err error) {
+	payload, err = json.Marshal(event)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := sensitiveFieldNames(reflect.TypeOf(event))
+	if len(names) == 0 {
+		return payload, nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, nil, err
+	}
+	secret := make(map[string]json.RawMessage, len(names))
+	for _, name := range names {
+		if v, ok := fields[name]; ok {
+			secret[name] = v
+			delete(fields, name)
+		}
+	}
+
+	if payload, err = json.Marshal(fields); err != nil {
+		return nil, nil, err
+	}
+	if sensitive, err = json.Marshal(secret); err != nil {
+		return nil, nil, err
+	}
+	return payload, sensitive, nil
+}
+
+// mergeSensitive decodes payload and then sensitive into dst so that trusted
+// publishers see the complete event.
+func mergeSensitive(dst any, payload, sensitive []byte) error {
+	if err := json.Unmarshal(payload, dst); err != nil {
+		return err
+	}
+	if len(sensitive) == 0 {
+		return nil
+	}
+	return json.Unmarshal(sensitive, dst)
+}
+
+func sensitiveFieldNames(t reflect.Type) []string {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("sensitive") != "true" {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
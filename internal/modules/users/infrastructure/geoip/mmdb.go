@@ -0,0 +1,393 @@
+// Package geoip resolves IP addresses from a local MaxMind DB (.mmdb) file,
+// such as GeoLite2-City, without any network calls.
+//
+// Only the parts of the format needed for lookups are implemented: the
+// binary search tree with 24, 28 and 32 bit records and the data section
+// types used by MaxMind and compatible city databases.
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+)
+
+var (
+	metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+	ErrInvalidDatabase = errors.New("geoip: invalid database")
+)
+
+// dataSectionSeparator is the run of zero bytes between the search tree and
+// the data section.
+const dataSectionSeparator = 16
+
+// maxDecodeDepth bounds nesting and pointer chains so a corrupt file cannot
+// recurse forever.
+const maxDecodeDepth = 32
+
+// Data section field types.
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+)
+
+// Reader looks addresses up in an in-memory copy of the database. It is
+// safe for concurrent use.
+type Reader struct {
+	tree       []byte
+	data       decoder
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// Open reads the database at path into memory.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: %w", err)
+	}
+	return New(buf)
+}
+
+// New parses a database held in buf.
+func New(buf []byte) (*Reader, error) {
+	idx := bytes.LastIndex(buf, metadataMarker)
+	if idx < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalidDatabase)
+	}
+	raw, _, err := decoder{buf: buf[idx+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+
+	r := &Reader{
+		nodeCount:  metaUint(meta, "node_count"),
+		recordSize: metaUint(meta, "record_size"),
+		ipVersion:  metaUint(meta, "ip_version"),
+	}
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported ip version %d", ErrInvalidDatabase, r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(idx) {
+		return nil, fmt.Errorf("%w: search tree exceeds file", ErrInvalidDatabase)
+	}
+	r.tree = buf[:treeSize]
+	r.data = decoder{buf: buf[treeSize+dataSectionSeparator : idx]}
+
+	// IPv4 addresses live under ::/96 in IPv6 databases.
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Locate returns the country, city and coordinates recorded for ip.
+func (r *Reader) Locate(ip string) (common.Location, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return common.Location{}, false
+	}
+	offset, found, err := r.lookup(parsed)
+	if err != nil || !found {
+		return common.Location{}, false
+	}
+	raw, _, err := r.data.decode(offset, 0)
+	if err != nil {
+		return common.Location{}, false
+	}
+	record, ok := raw.(map[string]any)
+	if !ok {
+		return common.Location{}, false
+	}
+
+	loc := common.Location{
+		Country: stringAt(record, "country", "iso_code"),
+		City:    stringAt(record, "city", "names", "en"),
+	}
+	if loc.Country == "" {
+		loc.Country = stringAt(record, "registered_country", "iso_code")
+	}
+	lat, hasLat := lookupPath(record, "location", "latitude").(float64)
+	lon, hasLon := lookupPath(record, "location", "longitude").(float64)
+	if hasLat && hasLon {
+		loc.Latitude, loc.Longitude = lat, lon
+	}
+	if loc.Country == "" && loc.City == "" && !(hasLat && hasLon) {
+		return common.Location{}, false
+	}
+	return loc, true
+}
+
+// lookup walks the search tree and returns the data section offset of the
+// record covering ip.
+func (r *Reader) lookup(ip net.IP) (uint, bool, error) {
+	node := uint(0)
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		return 0, false, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i&7))) & 1
+		node = r.readNode(node, bit)
+	}
+	switch {
+	case node == r.nodeCount:
+		return 0, false, nil
+	case node > r.nodeCount:
+		offset := node - r.nodeCount - dataSectionSeparator
+		if offset >= uint(len(r.data.buf)) {
+			return 0, false, fmt.Errorf("%w: record points outside the data section", ErrInvalidDatabase)
+		}
+		return offset, true, nil
+	default:
+		return 0, false, fmt.Errorf("%w: search tree ends in a node", ErrInvalidDatabase)
+	}
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) readNode(node, bit uint) uint {
+	b := r.tree
+	switch r.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		return uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+	case 28:
+		off := node * 7
+		if bit == 0 {
+			return uint(b[off+3]&0xF0)<<20 | uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+		}
+		return uint(b[off+3]&0x0F)<<24 | uint(b[off+4])<<16 | uint(b[off+5])<<8 | uint(b[off+6])
+	default:
+		off := node*8 + bit*4
+		return uint(b[off])<<24 | uint(b[off+1])<<16 | uint(b[off+2])<<8 | uint(b[off+3])
+	}
+}
+
+// decoder reads values of the MaxMind DB data format. Pointers are offsets
+// from the start of buf.
+type decoder struct {
+	buf []byte
+}
+
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, fmt.Errorf("%w: data nested too deeply", ErrInvalidDatabase)
+	}
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	typ := uint(ctrl >> 5)
+	if typ == typePointer {
+		target, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", ErrInvalidDatabase)
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		values := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, value)
+			offset = next
+		}
+		return values, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	payload, next, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case typeString:
+		return string(payload), next, nil
+	case typeBytes:
+		return append([]byte(nil), payload...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of size %d", ErrInvalidDatabase, size)
+		}
+		return math.Float64frombits(uint64(beUint(payload))), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of size %d", ErrInvalidDatabase, size)
+		}
+		return float64(math.Float32frombits(uint32(beUint(payload)))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("%w: integer of size %d", ErrInvalidDatabase, size)
+		}
+		return uint64(beUint(payload)), next, nil
+	case typeUint128:
+		// Not needed for locations; keep the raw big-endian bytes.
+		return append([]byte(nil), payload...), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: int32 of size %d", ErrInvalidDatabase, size)
+		}
+		return int64(int32(uint32(beUint(payload)))), next, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unsupported data type %d", ErrInvalidDatabase, typ)
+	}
+}
+
+// size decodes the payload size from the control byte and the bytes that
+// may follow it.
+func (d decoder) size(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+	n := size - 28
+	b, next, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch n {
+	case 1:
+		return 29 + beUint(b), next, nil
+	case 2:
+		return 285 + beUint(b), next, nil
+	default:
+		return 65821 + beUint(b), next, nil
+	}
+}
+
+func (d decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint((ctrl>>3)&0x3) + 1
+	b, next, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	prefix := uint(ctrl & 0x7)
+	switch n {
+	case 1:
+		return prefix<<8 | beUint(b), next, nil
+	case 2:
+		return (prefix<<16 | beUint(b)) + 2048, next, nil
+	case 3:
+		return (prefix<<24 | beUint(b)) + 526336, next, nil
+	default:
+		return beUint(b), next, nil
+	}
+}
+
+func (d decoder) bytes(offset, n uint) ([]byte, uint, error) {
+	end := offset + n
+	if end < offset || end > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("%w: unexpected end of data", ErrInvalidDatabase)
+	}
+	return d.buf[offset:end], end, nil
+}
+
+func beUint(b []byte) uint {
+	var v uint
+	for _, c := range b {
+		v = v<<8 | uint(c)
+	}
+	return v
+}
+
+func metaUint(meta map[string]any, key string) uint {
+	v, _ := meta[key].(uint64)
+	return uint(v)
+}
+
+func lookupPath(record map[string]any, path ...string) any {
+	var current any = record
+	for _, key := range path {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+func stringAt(record map[string]any, path ...string) string {
+	s, _ := lookupPath(record, path...).(string)
+	return s
+}
+
+var _ common.GeoLocator = (*Reader)(nil)
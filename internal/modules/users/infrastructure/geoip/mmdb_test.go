@@ -0,0 +1,192 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"testing"
+)
+
+func TestReaderLocatesIPv4AndIPv6(t *testing.T) {
+	w := newTestWriter()
+	berlin := w.add(record{"country": record{"iso_code": "DE"}, "city": record{"names": record{"en": "Berlin", "de": "Berlin"}}, "location": record{"latitude": 52.52, "longitude": 13.40}})
+	// The second record reuses the first one's country map through a pointer.
+	munich := w.add(record{"country": pointer(w.offsetOf(berlin, "country")), "city": record{"names": record{"en": "Munich"}}})
+	w.insert("81.2.69.0/24", berlin)
+	w.insert("81.2.70.0/23", munich)
+	w.insert("2001:db8::/32", w.add(record{"registered_country": record{"iso_code": "US"}}))
+
+	r, err := New(w.build())
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	loc, ok := r.Locate("81.2.69.160")
+	if !ok || loc.Country != "DE" || loc.City != "Berlin" || loc.Latitude != 52.52 || loc.Longitude != 13.40 {
+		t.Fatalf("unexpected location %+v ok=%v", loc, ok)
+	}
+	loc, ok = r.Locate("81.2.71.1")
+	if !ok || loc.Country != "DE" || loc.City != "Munich" {
+		t.Fatalf("expected a location through a pointer, got %+v ok=%v", loc, ok)
+	}
+	loc, ok = r.Locate("2001:db8::1")
+	if !ok || loc.Country != "US" || loc.City != "" {
+		t.Fatalf("expected the registered country, got %+v ok=%v", loc, ok)
+	}
+	for _, ip := range []string{"10.0.0.1", "2001:db9::1", "not-an-ip"} {
+		if loc, ok := r.Locate(ip); ok {
+			t.Fatalf("expected %s to be unknown, got %+v", ip, loc)
+		}
+	}
+}
+
+func TestReaderRejectsInvalidDatabase(t *testing.T) {
+	if _, err := New([]byte("not a database")); !errors.Is(err, ErrInvalidDatabase) {
+		t.Fatalf("expected invalid database, got %v", err)
+	}
+
+	w := newTestWriter()
+	w.insert("81.2.69.0/24", w.add(record{"country": record{"iso_code": "DE"}}))
+	buf := w.build()
+	// Without the tree the metadata promises more nodes than the file holds.
+	if _, err := New(buf[bytes.LastIndex(buf, metadataMarker):]); !errors.Is(err, ErrInvalidDatabase) {
+		t.Fatalf("expected a truncated database to be rejected, got %v", err)
+	}
+}
+
+// --- test database writer ---
+
+type record map[string]any
+
+type pointer uint
+
+// testWriter builds an IPv6 database with 24 bit records.
+type testWriter struct {
+	data    []byte
+	offsets map[int]map[string]uint
+	nodes   [][2]int // 0 = empty, >0 = node index, <0 = -(data offset + 1)
+}
+
+func newTestWriter() *testWriter {
+	return &testWriter{offsets: map[int]map[string]uint{}, nodes: [][2]int{{}}}
+}
+
+// add appends a record to the data section and returns its offset.
+func (w *testWriter) add(r record) int {
+	offset := len(w.data)
+	w.offsets[offset] = map[string]uint{}
+	w.data = w.encode(w.data, r, w.offsets[offset])
+	return offset
+}
+
+func (w *testWriter) offsetOf(recordOffset int, key string) uint {
+	return w.offsets[recordOffset][key]
+}
+
+func (w *testWriter) insert(cidr string, dataOffset int) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	ip := network.IP.To16()
+	ones, bits := network.Mask.Size()
+	if bits == 32 {
+		// IPv4 networks live under ::/96, not under the ::ffff:0:0/96 form
+		// that To16 returns.
+		ip = append(make(net.IP, 12), network.IP.To4()...)
+		ones += 96
+	}
+	node := 0
+	for i := 0; i < ones; i++ {
+		bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+		if i == ones-1 {
+			w.nodes[node][bit] = -(dataOffset + 1)
+			return
+		}
+		next := w.nodes[node][bit]
+		if next <= 0 {
+			w.nodes = append(w.nodes, [2]int{})
+			next = len(w.nodes) - 1
+			w.nodes[node][bit] = next
+		}
+		node = next
+	}
+}
+
+func (w *testWriter) build() []byte {
+	count := len(w.nodes)
+	var buf []byte
+	for _, n := range w.nodes {
+		for _, child := range n {
+			v := count
+			switch {
+			case child > 0:
+				v = child
+			case child < 0:
+				v = count + dataSectionSeparator + (-child - 1)
+			}
+			buf = append(buf, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	buf = append(buf, make([]byte, dataSectionSeparator)...)
+	buf = append(buf, w.data...)
+	buf = append(buf, metadataMarker...)
+	return w.encode(buf, record{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(6),
+		"database_type":               "Test-City",
+		"binary_format_major_version": uint16(2),
+	}, nil)
+}
+
+// encode appends v; when keys is set it records where each top-level map
+// value starts so tests can point at it.
+func (w *testWriter) encode(buf []byte, v any, keys map[string]uint) []byte {
+	switch v := v.(type) {
+	case record:
+		buf = appendControl(buf, typeMap, len(v))
+		names := make([]string, 0, len(v))
+		for k := range v {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			buf = w.encode(buf, k, nil)
+			if keys != nil {
+				keys[k] = uint(len(buf))
+			}
+			buf = w.encode(buf, v[k], nil)
+		}
+	case string:
+		buf = appendControl(buf, typeString, len(v))
+		buf = append(buf, v...)
+	case float64:
+		buf = appendControl(buf, typeDouble, 8)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(v))
+	case uint16:
+		buf = appendControl(buf, typeUint16, 2)
+		buf = binary.BigEndian.AppendUint16(buf, v)
+	case uint32:
+		buf = appendControl(buf, typeUint32, 4)
+		buf = binary.BigEndian.AppendUint32(buf, v)
+	case pointer:
+		buf = append(buf, byte(typePointer<<5|(v>>8)&0x7), byte(v))
+	default:
+		panic("unsupported test value")
+	}
+	return buf
+}
+
+func appendControl(buf []byte, typ, size int) []byte {
+	if size >= 29 {
+		panic("test values are short")
+	}
+	if typ <= 7 {
+		return append(buf, byte(typ<<5|size))
+	}
+	return append(buf, byte(size), byte(typ-7))
+}
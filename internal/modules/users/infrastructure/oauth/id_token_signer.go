@@ -0,0 +1,97 @@
+package oauth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	oauthapp "github.com/vaaxooo/xbackend/internal/modules/users/application/oauth"
+	"github.com/vaaxooo/xbackend/internal/modules/users/infrastructure/tokens"
+)
+
+// IDTokenSigner signs the ID tokens of the OpenID Connect provider with an
+// RSA key (RS256). The key id is the RFC 7638 thumbprint of the public key,
+// so that it changes with the key.
+type IDTokenSigner struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// NewIDTokenSigner reads a PEM encoded RSA private key, PKCS #1 or #8, of
+// at least 2048 bits.
+func NewIDTokenSigner(pemKey []byte) (*IDTokenSigner, error) {
+	key, err := tokens.ParseRSAKey(pemKey)
+	if err != nil {
+		return nil, err
+	}
+	return &IDTokenSigner{key: key, kid: tokens.RSAKeyID(&key.PublicKey)}, nil
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	AuthTime        *jwt.NumericDate `json:"auth_time,omitempty"`
+	Nonce           string           `json:"nonce,omitempty"`
+	AMR             []string         `json:"amr,omitempty"`
+	SessionID       string           `json:"sid,omitempty"`
+	AccessTokenHash string           `json:"at_hash,omitempty"`
+	Name            string           `json:"name,omitempty"`
+	GivenName       string           `json:"given_name,omitempty"`
+	FamilyName      string           `json:"family_name,omitempty"`
+	MiddleName      string           `json:"middle_name,omitempty"`
+	Picture         string           `json:"picture,omitempty"`
+	Email           string           `json:"email,omitempty"`
+	EmailVerified   *bool            `json:"email_verified,omitempty"`
+}
+
+func (s *IDTokenSigner) SignIDToken(c oauthapp.IDTokenClaims) (string, error) {
+	claims := idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    c.Issuer,
+			Subject:   c.User.Subject,
+			Audience:  jwt.ClaimStrings{c.Audience},
+			IssuedAt:  jwt.NewNumericDate(c.IssuedAt),
+			ExpiresAt: jwt.NewNumericDate(c.ExpiresAt),
+		},
+		Nonce:         c.Nonce,
+		AMR:           c.AMR,
+		SessionID:     c.SessionID,
+		Name:          c.User.Name,
+		GivenName:     c.User.GivenName,
+		FamilyName:    c.User.FamilyName,
+		MiddleName:    c.User.MiddleName,
+		Picture:       c.User.Picture,
+		Email:         c.User.Email,
+		EmailVerified: c.User.EmailVerified,
+	}
+	if !c.AuthTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(c.AuthTime)
+	}
+	if c.AccessToken != "" {
+		// The left half of the hash used by the signing algorithm (OpenID
+		// Connect Core 3.1.3.6).
+		sum := sha256.Sum256([]byte(c.AccessToken))
+		claims.AccessTokenHash = base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.key)
+}
+
+func (s *IDTokenSigner) Algorithm() string {
+	return jwt.SigningMethodRS256.Alg()
+}
+
+func (s *IDTokenSigner) PublicKeys() []oauthapp.JSONWebKey {
+	n, e := tokens.EncodeRSAPublicKey(&s.key.PublicKey)
+	return []oauthapp.JSONWebKey{{
+		KeyType:   "RSA",
+		Use:       "sig",
+		KeyID:     s.kid,
+		Algorithm: s.Algorithm(),
+		N:         n,
+		E:         e,
+	}}
+}
@@ -18,22 +18,28 @@ func NewHS256(secret string) (*HS256, error) {
 	return &HS256{secret: []byte(secret)}, nil
 }
 
+// Claims are the access token claims. AuthTime and AMR follow OpenID
+// Connect: when and how the user last authenticated for the session.
+// Tokens of OAuth clients carry ClientID and the space separated Scope
+// instead of a user and session. Tokens of sessions a user granted to a
+// client carry all of them and are limited to Scope.
 type Claims struct {
-	UserID    string `json:"uid"`
-	SessionID string `json:"sid"`
+	UserID    string           `json:"uid,omitempty"`
+	SessionID string           `json:"sid,omitempty"`
+	ClientID  string           `json:"cid,omitempty"`
+	Scope     string           `json:"scope,omitempty"`
+	AuthTime  *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR       []string         `json:"amr,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func (c *HS256) Issue(userID, sessionID string, ttl time.Duration) (string, error) {
+// Issue signs claims valid for ttl from now; registered claims are set here.
+func (c *HS256) Issue(claims Claims, ttl time.Duration) (string, error) {
 	now := time.Now().UTC()
 
-	claims := Claims{
-		UserID:    userID,
-		SessionID: sessionID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
-		},
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 	}
 
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -51,10 +57,19 @@ func (c *HS256) Parse(token string) (Claims, error) {
 		return Claims{}, err
 	}
 
+	return checkClaims(parsed)
+}
+
+// checkClaims accepts a token of a user session, of an OAuth client, or of
+// a session granted to a client.
+func checkClaims(parsed *jwt.Token) (Claims, error) {
 	claims, ok := parsed.Claims.(*Claims)
 	if !ok || !parsed.Valid {
 		return Claims{}, errors.New("invalid token")
 	}
+	if claims.ClientID != "" && claims.UserID == "" && claims.SessionID == "" {
+		return *claims, nil
+	}
 	if claims.UserID == "" || claims.SessionID == "" {
 		return Claims{}, errors.New("missing uid or sid")
 	}
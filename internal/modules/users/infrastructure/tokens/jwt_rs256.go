@@ -0,0 +1,65 @@
+package tokens
+
+import (
+	"crypto/rsa"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RS256 signs access tokens with an RSA key, so that other services can
+// verify them with the public key alone. Tokens name the key in their kid
+// header.
+type RS256 struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// NewRS256 reads a PEM encoded RSA private key, as ParseRSAKey does.
+func NewRS256(pemKey []byte) (*RS256, error) {
+	key, err := ParseRSAKey(pemKey)
+	if err != nil {
+		return nil, err
+	}
+	return &RS256{key: key, kid: RSAKeyID(&key.PublicKey)}, nil
+}
+
+// Issue signs claims valid for ttl from now; registered claims are set here.
+func (c *RS256) Issue(claims Claims, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = c.kid
+	return t.SignedString(c.key)
+}
+
+func (c *RS256) Parse(token string) (Claims, error) {
+	parsed, err := jwt.ParseWithClaims(token, &Claims{}, func(t *jwt.Token) (any, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		if kid, _ := t.Header["kid"].(string); kid != c.kid {
+			return nil, errors.New("unknown key id")
+		}
+		return &c.key.PublicKey, nil
+	})
+	if err != nil {
+		return Claims{}, err
+	}
+	return checkClaims(parsed)
+}
+
+// KeyID and PublicKey describe the key for a JSON Web Key Set.
+func (c *RS256) KeyID() string {
+	return c.kid
+}
+
+func (c *RS256) PublicKey() *rsa.PublicKey {
+	return &c.key.PublicKey
+}
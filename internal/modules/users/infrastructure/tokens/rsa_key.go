@@ -0,0 +1,57 @@
+package tokens
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for signing tokens.
+const minRSAKeyBits = 2048
+
+// ParseRSAKey reads a PEM encoded RSA private key, PKCS #1 or #8, of at
+// least 2048 bits.
+func ParseRSAKey(pemKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("signing key: no PEM block")
+	}
+	var key *rsa.PrivateKey
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = k
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		k, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("signing key: not an RSA key")
+		}
+		key = k
+	}
+	if key.N.BitLen() < minRSAKeyBits {
+		return nil, errors.New("signing key: RSA key too short")
+	}
+	return key, nil
+}
+
+// EncodeRSAPublicKey returns the modulus and exponent of key as JWK members
+// (RFC 7518 section 6.3.1).
+func EncodeRSAPublicKey(key *rsa.PublicKey) (n, e string) {
+	return base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+}
+
+// RSAKeyID is the RFC 7638 thumbprint of key, so that the key id changes
+// with the key.
+func RSAKeyID(key *rsa.PublicKey) string {
+	n, e := EncodeRSAPublicKey(key)
+	// Members in lexicographic order, without whitespace (RFC 7638 3).
+	thumbprint := sha256.Sum256([]byte(`{"e":"` + e + `","kty":"RSA","n":"` + n + `"}`))
+	return base64.RawURLEncoding.EncodeToString(thumbprint[:])
+}
@@ -1,16 +1,24 @@
 package public
 
 import (
+	"context"
+	"slices"
 	"time"
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/application"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/accesstoken"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/apple"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/challenge"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/device"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/epoch"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/google"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/link"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/login"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/oauth"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/password"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/profile"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/recovery"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/refresh"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/register"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/session"
@@ -23,13 +31,22 @@ type Service = application.Service
 
 type Config struct {
 	Auth     AuthConfig
+	Risk     RiskConfig
+	GeoIP    GeoIPConfig
+	Captcha  CaptchaConfig
+	Recovery RecoveryConfig
 	Telegram TelegramConfig
 	Google   GoogleConfig
 	Apple    AppleConfig
 }
 
 type AuthConfig struct {
-	JWTSecret                string
+	JWTSecret    string
+	TokenHashKey string
+	// JWTSigningKeyFile is the PEM file of the RSA key access tokens are
+	// signed with, so that other services verify them without the secret.
+	// Empty signs them with JWTSecret.
+	JWTSigningKeyFile        string
 	AccessTTL                time.Duration
 	RefreshTTL               time.Duration
 	RefreshRetentionTTL      time.Duration
@@ -40,6 +57,75 @@ type AuthConfig struct {
 	ChallengeTTL             time.Duration
 	TOTPLockDuration         time.Duration
 	TOTPAttempts             int
+	TrustedDeviceTTL         time.Duration
+	// ReauthMaxAge is how recent a login or step-up must be for sensitive
+	// operations (password change, disabling 2FA, linking, revoking others).
+	ReauthMaxAge time.Duration
+	// MaxSessions caps active sessions per user and MaxSessionsPerClient
+	// per client type (web, mobile, desktop); zero is unlimited.
+	// SessionLimitPolicy is reject, evict_oldest (default) or evict_lru.
+	MaxSessions          int
+	MaxSessionsPerClient map[string]int
+	SessionLimitPolicy   string
+	// RefreshTTL is the idle timeout: each refresh extends the session by
+	// it. SessionAbsoluteTTL ends a session that long after login however
+	// active it is (zero disables it). Both can be overridden per client
+	// type.
+	SessionAbsoluteTTL          time.Duration
+	SessionIdleTTLPerClient     map[string]time.Duration
+	SessionAbsoluteTTLPerClient map[string]time.Duration
+	// SessionCacheSize bounds how many sessions access token verification
+	// keeps in memory for SessionCacheTTL; zero queries the database on
+	// every request.
+	SessionCacheSize int
+	SessionCacheTTL  time.Duration
+	// AccessTokenMaxTTL bounds the lifetime users may give a personal
+	// access token.
+	AccessTokenMaxTTL time.Duration
+	// OAuthIssuer is the public URL of the API, the audience of OAuth
+	// client assertions; empty refuses private_key_jwt.
+	OAuthIssuer string
+	// OIDCSigningKeyFile is the PEM file of the RSA key ID tokens are signed
+	// with; setting it enables the OpenID Connect provider, which also
+	// needs OAuthIssuer and OIDCLoginURL, the login page authorization
+	// requests are sent to.
+	OIDCSigningKeyFile string
+	OIDCLoginURL       string
+	// DeviceVerificationURL is the page where users enter the user code
+	// of the device authorization grant; setting it enables the grant.
+	DeviceVerificationURL string
+}
+
+type RiskConfig struct {
+	Enabled                bool
+	NewIPWeight            int
+	NewUserAgentWeight     int
+	NewCountryWeight       int
+	ImpossibleTravelWeight int
+	FailureWeight          int
+	MaxFailures            int
+	FailureWindow          time.Duration
+	MaxTravelSpeed         float64
+	CaptchaScore           int
+	EmailOTPScore          int
+	DenyScore              int
+}
+
+// GeoIPConfig locates sessions and logins from a local .mmdb file; an
+// empty DatabasePath disables it.
+type GeoIPConfig struct {
+	DatabasePath string
+}
+
+type CaptchaConfig struct {
+	VerifyURL string
+	Secret    string
+}
+
+type RecoveryConfig struct {
+	Delay     time.Duration
+	Window    time.Duration
+	CancelURL string
 }
 
 type TelegramConfig struct {
@@ -58,16 +144,57 @@ type AppleConfig struct {
 }
 
 type AuthPort interface {
-	Issue(userID, sessionID string, ttl time.Duration) (string, error)
-	Verify(token string) (AuthContext, error)
+	Issue(claims AccessClaims, ttl time.Duration) (string, error)
+	Verify(ctx context.Context, token string) (AuthContext, error)
 }
 
+// Kinds of callers an AuthContext describes.
+const (
+	// AuthKindSession is a user's session, which may do anything the user
+	// may.
+	AuthKindSession = "session"
+	// AuthKindPersonalAccessToken is a personal access token, limited to its
+	// scopes.
+	AuthKindPersonalAccessToken = "personal_access_token"
+	// AuthKindClient is an OAuth client acting in its own name, limited to
+	// the scopes of its token.
+	AuthKindClient = "client"
+	// AuthKindGrant is a session a user granted to an OAuth client through
+	// the authorization endpoint, limited to the scopes of the grant.
+	AuthKindGrant = "grant"
+)
+
+// AuthContext describes the caller of a verified access token. AuthTime is
+// when the session last authenticated (login or step-up); it is zero for
+// tokens issued before it was recorded. Personal access tokens have no
+// session: TokenID identifies them and Scopes limits them. OAuth clients
+// have no user either: ClientID identifies them. Sessions granted to a
+// client have both, and Scopes limits them.
 type AuthContext struct {
+	Kind      string
 	UserID    string
 	SessionID string
+	TokenID   string
+	ClientID  string
 	Roles     []string
+	Scopes    []string
+	AuthTime  time.Time
+	AMR       []string
 }
 
+// HasScope reports whether the caller may act within scope. Sessions are
+// not scoped and may.
+func (c AuthContext) HasScope(scope string) bool {
+	return c.Kind == AuthKindSession || slices.Contains(c.Scopes, scope)
+}
+
+type AccessClaims = common.AccessClaims
+
+// GeoLocator resolves client IPs to locations; transports use it to fill
+// the request metadata that sessions and security events record.
+type GeoLocator = common.GeoLocator
+type Location = common.Location
+
 // Re-export DTOs and commands used by transports.
 type RegisterInput = register.Input
 type LoginInput = login.Input
@@ -94,8 +221,69 @@ type LinkProviderOutput = link.Output
 type ListSessionsInput = session.ListInput
 type SessionsOutput = session.Output
 type RevokeSessionInput = session.RevokeInput
+type RenameSessionInput = session.RenameInput
+type Session = session.Session
 type RevokeOtherSessionsInput = session.RevokeOthersInput
+type LogoutInput = session.LogoutInput
+type LogoutAllInput = session.LogoutAllInput
+type RevocationFeedInput = session.FeedInput
+type RevocationFeedOutput = session.FeedOutput
+type InvalidateTokensInput = epoch.InvalidateInput
+type CreateAccessTokenInput = accesstoken.CreateInput
+type CreateAccessTokenOutput = accesstoken.CreateOutput
+type ListAccessTokensInput = accesstoken.ListInput
+type AccessTokensOutput = accesstoken.Output
+type RevokeAccessTokenInput = accesstoken.RevokeInput
+type AccessToken = accesstoken.AccessToken
+type RegisterClientInput = oauth.RegisterClientInput
+type RegisterClientOutput = oauth.RegisterClientOutput
+type ListClientsInput = oauth.ListClientsInput
+type ClientsOutput = oauth.ClientsOutput
+type DisableClientInput = oauth.DisableClientInput
+type OAuthClient = oauth.Client
+type ClientTokenInput = oauth.TokenInput
+type ClientTokenOutput = oauth.TokenOutput
+type ClientCredentials = oauth.ClientCredentials
+type AuthorizationRequest = oauth.AuthorizationRequest
+type StartAuthorizationInput = oauth.StartAuthorizationInput
+type AuthorizationRedirect = oauth.RedirectOutput
+type AuthorizeInput = oauth.AuthorizeInput
+type AuthorizeOutput = oauth.AuthorizeOutput
+type UserInfoInput = oauth.UserInfoInput
+type UserInfoOutput = oauth.UserInfoOutput
+type ProviderMetadataInput = oauth.DiscoveryInput
+type ProviderMetadata = oauth.ProviderMetadata
+type ProviderKeysInput = oauth.KeysInput
+type ProviderKeySet = oauth.KeySet
+type IntrospectTokenInput = oauth.IntrospectInput
+type IntrospectTokenOutput = oauth.IntrospectOutput
+type RevokeTokenInput = oauth.RevokeInput
+type DeviceAuthorizationInput = oauth.DeviceAuthorizationInput
+type DeviceAuthorizationOutput = oauth.DeviceAuthorizationOutput
+type VerifyDeviceInput = oauth.VerifyDeviceInput
+type VerifyDeviceOutput = oauth.VerifyDeviceOutput
+type StartQRLoginInput = challenge.StartQRLoginInput
+type StartQRLoginOutput = challenge.StartQRLoginOutput
+type ScanQRLoginInput = challenge.ScanQRLoginInput
+type ScanQRLoginOutput = challenge.ScanQRLoginOutput
+type QRLoginSessionInput = challenge.QRSessionInput
+type TokenEpochOutput = epoch.Output
 type ChallengeStatusInput = challenge.StatusInput
 type ChallengeVerifyTOTPInput = challenge.VerifyTOTPInput
 type ChallengeResendEmailInput = challenge.ResendEmailInput
 type ChallengeConfirmEmailInput = challenge.ConfirmEmailInput
+type ChallengeVerifyEmailOTPInput = challenge.VerifyEmailOTPInput
+type ChallengeVerifyCaptchaInput = challenge.VerifyCaptchaInput
+type ChallengeVerifyStepInput = challenge.VerifyStepInput
+type ChallengeWatchInput = challenge.WatchInput
+type ChallengeEvent = challenge.Event
+type RecoveryStartInput = recovery.StartInput
+type RecoveryConfirmInput = recovery.ConfirmInput
+type RecoveryCancelInput = recovery.CancelInput
+type RecoveryCompleteInput = recovery.CompleteInput
+type RecoveryOutput = recovery.Output
+type StepUpStartInput = challenge.StartStepUpInput
+type StepUpVerifyInput = challenge.VerifyStepUpInput
+type ListTrustedDevicesInput = device.ListInput
+type TrustedDevicesOutput = device.Output
+type RevokeTrustedDeviceInput = device.RevokeInput
@@ -3,14 +3,20 @@ package config
 import "time"
 
 type Config struct {
-	App      AppConfig
-	HTTP     HTTPConfig
-	DB       DBConfig
-	Auth     AuthConfig
-	Telegram TelegramConfig
-	Google   GoogleConfig
-	Apple    AppleConfig
-	SMTP     SMTPConfig
+	App        AppConfig
+	HTTP       HTTPConfig
+	DB         DBConfig
+	Auth       AuthConfig
+	Encryption EncryptionConfig
+	Risk       RiskConfig
+	GeoIP      GeoIPConfig
+	Cookie     CookieConfig
+	Captcha    CaptchaConfig
+	Recovery   RecoveryConfig
+	Telegram   TelegramConfig
+	Google     GoogleConfig
+	Apple      AppleConfig
+	SMTP       SMTPConfig
 }
 
 type AppConfig struct {
@@ -38,7 +44,11 @@ type DBConfig struct {
 }
 
 type AuthConfig struct {
-	JWTSecret                string
+	JWTSecret    string
+	TokenHashKey string
+	// JWTSigningKeyFile is the PEM file of an RSA key that signs access
+	// tokens instead of JWTSecret; its public key is served at /oauth/jwks.
+	JWTSigningKeyFile        string
 	AccessTTL                time.Duration
 	RefreshTTL               time.Duration
 	RefreshRetentionTTL      time.Duration
@@ -46,6 +56,112 @@ type AuthConfig struct {
 	VerificationTTL          time.Duration
 	PasswordResetTTL         time.Duration
 	TwoFactorIssuer          string
+	TrustedDeviceTTL         time.Duration
+	ReauthMaxAge             time.Duration
+	// MaxSessions caps active sessions per user, MaxSessionsPerClient per
+	// client type ("mobile=3,web=5"); zero is unlimited. SessionLimitPolicy
+	// is reject, evict_oldest or evict_lru.
+	MaxSessions          int
+	MaxSessionsPerClient map[string]int
+	SessionLimitPolicy   string
+	// RefreshTTL is the sliding idle timeout of a session and
+	// SessionAbsoluteTTL its hard lifetime from login; both can be set per
+	// client type ("mobile=2160h,web=24h").
+	SessionAbsoluteTTL          time.Duration
+	SessionIdleTTLPerClient     map[string]time.Duration
+	SessionAbsoluteTTLPerClient map[string]time.Duration
+	// SessionCacheSize sessions are kept for SessionCacheTTL when verifying
+	// access tokens; zero disables the cache.
+	SessionCacheSize int
+	SessionCacheTTL  time.Duration
+	// RevocationFeedToken lets other services read the session revocation
+	// feed; empty leaves it to OAuth clients, or disables it when they are
+	// disabled.
+	RevocationFeedToken string
+	// AccessTokenMaxTTL bounds the lifetime of personal access tokens.
+	AccessTokenMaxTTL time.Duration
+	// AdminToken guards the admin routes (token invalidation); empty
+	// disables them.
+	AdminToken string
+	// OAuthClientsEnabled serves the OAuth token endpoint to registered
+	// machine clients.
+	OAuthClientsEnabled bool
+	// OAuthIssuer is the public URL of the API (".../api/v1"); OAuth client
+	// assertions must be addressed to it or its token endpoint. Empty
+	// refuses private_key_jwt.
+	OAuthIssuer string
+	// OIDCSigningKeyFile is the PEM file of the RSA key that signs ID
+	// tokens; setting it turns on the OpenID Connect provider, which needs
+	// OAuthIssuer and OIDCLoginURL, the login page of authorization
+	// requests, as well.
+	OIDCSigningKeyFile string
+	OIDCLoginURL       string
+	// DeviceVerificationURL is the signed in page where users enter the
+	// code shown by a TV or CLI; setting it turns on the device
+	// authorization grant.
+	DeviceVerificationURL string
+}
+
+// EncryptionConfig lists the keys used to encrypt sensitive columns at rest.
+// Keys may be given inline ("id:base64key" entries) or as files in KeysDir
+// (file name = key id). PrimaryKeyID selects the key for new writes.
+type EncryptionConfig struct {
+	PrimaryKeyID string
+	Keys         []string
+	KeysDir      string
+}
+
+// RiskConfig tunes login risk scoring. Signal weights add up to a score;
+// the score thresholds pick extra challenge steps or deny the login. A zero
+// threshold disables that outcome.
+type RiskConfig struct {
+	Enabled                bool
+	NewIPWeight            int
+	NewUserAgentWeight     int
+	NewCountryWeight       int
+	ImpossibleTravelWeight int
+	FailureWeight          int
+	MaxFailures            int
+	FailureWindow          time.Duration
+	MaxTravelSpeed         int // km/h
+	CaptchaScore           int
+	EmailOTPScore          int
+	DenyScore              int
+}
+
+// GeoIPConfig points at a local MaxMind DB file (e.g. GeoLite2-City.mmdb)
+// used to locate sessions and logins. Empty disables lookups.
+type GeoIPConfig struct {
+	DatabasePath string
+}
+
+// CookieConfig enables the cookie mode, where browser clients keep the
+// refresh token in an HttpOnly cookie. SameSite is strict, lax or none.
+type CookieConfig struct {
+	Enabled  bool
+	Name     string
+	CSRFName string
+	Domain   string
+	Path     string
+	SameSite string
+	Secure   bool
+}
+
+// CaptchaConfig points at a siteverify-compatible captcha API. Captcha steps
+// are only requested when VerifyURL and Secret are set.
+type CaptchaConfig struct {
+	VerifyURL string
+	Secret    string
+}
+
+// RecoveryConfig controls resetting a lost second factor. Delay is the
+// waiting period during which the owner can cancel; Window is how long after
+// it the reset can still be completed. CancelURL is the page opened by the
+// cancel link in the notification email.
+type RecoveryConfig struct {
+	Delay     time.Duration
+	Window    time.Duration
+	CancelURL string
 }
 
 type TelegramConfig struct {
@@ -31,14 +31,74 @@ func Load() (*Config, error) {
 			ConnMaxLife:     getDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
 		},
 		Auth: AuthConfig{
-			JWTSecret:                getEnv("AUTH_JWT_SECRET", ""),
-			AccessTTL:                getDuration("AUTH_ACCESS_TTL", 15*time.Minute),
-			RefreshTTL:               getDuration("AUTH_REFRESH_TTL", 30*24*time.Hour),
-			RefreshRetentionTTL:      getDuration("AUTH_REFRESH_RETENTION_TTL", 90*24*time.Hour),
-			RequireEmailConfirmation: getBool("AUTH_REQUIRE_EMAIL_CONFIRMATION", false),
-			VerificationTTL:          getDuration("AUTH_VERIFICATION_TTL", 15*time.Minute),
-			PasswordResetTTL:         getDuration("AUTH_PASSWORD_RESET_TTL", 15*time.Minute),
-			TwoFactorIssuer:          getEnv("AUTH_TWO_FACTOR_ISSUER", "xbackend"),
+			JWTSecret:                   getEnv("AUTH_JWT_SECRET", ""),
+			TokenHashKey:                getEnv("AUTH_TOKEN_HASH_KEY", ""),
+			JWTSigningKeyFile:           getEnv("AUTH_JWT_SIGNING_KEY_FILE", ""),
+			AccessTTL:                   getDuration("AUTH_ACCESS_TTL", 15*time.Minute),
+			RefreshTTL:                  getDuration("AUTH_REFRESH_TTL", 30*24*time.Hour),
+			RefreshRetentionTTL:         getDuration("AUTH_REFRESH_RETENTION_TTL", 90*24*time.Hour),
+			RequireEmailConfirmation:    getBool("AUTH_REQUIRE_EMAIL_CONFIRMATION", false),
+			VerificationTTL:             getDuration("AUTH_VERIFICATION_TTL", 15*time.Minute),
+			PasswordResetTTL:            getDuration("AUTH_PASSWORD_RESET_TTL", 15*time.Minute),
+			TwoFactorIssuer:             getEnv("AUTH_TWO_FACTOR_ISSUER", "xbackend"),
+			TrustedDeviceTTL:            getDuration("AUTH_TRUSTED_DEVICE_TTL", 30*24*time.Hour),
+			ReauthMaxAge:                getDuration("AUTH_REAUTH_MAX_AGE", 10*time.Minute),
+			MaxSessions:                 getInt("AUTH_MAX_SESSIONS", 0),
+			MaxSessionsPerClient:        getIntMap("AUTH_MAX_SESSIONS_PER_CLIENT"),
+			SessionLimitPolicy:          getEnv("AUTH_SESSION_LIMIT_POLICY", "evict_oldest"),
+			SessionAbsoluteTTL:          getDuration("AUTH_SESSION_ABSOLUTE_TTL", 90*24*time.Hour),
+			SessionIdleTTLPerClient:     getDurationMap("AUTH_SESSION_IDLE_TTL_PER_CLIENT"),
+			SessionAbsoluteTTLPerClient: getDurationMap("AUTH_SESSION_ABSOLUTE_TTL_PER_CLIENT"),
+			SessionCacheSize:            getInt("AUTH_SESSION_CACHE_SIZE", 10000),
+			SessionCacheTTL:             getDuration("AUTH_SESSION_CACHE_TTL", 5*time.Second),
+			RevocationFeedToken:         getEnv("AUTH_REVOCATION_FEED_TOKEN", ""),
+			AdminToken:                  getEnv("AUTH_ADMIN_TOKEN", ""),
+			AccessTokenMaxTTL:           getDuration("AUTH_ACCESS_TOKEN_MAX_TTL", 365*24*time.Hour),
+			OAuthClientsEnabled:         getBool("AUTH_OAUTH_CLIENTS_ENABLED", true),
+			OAuthIssuer:                 getEnv("AUTH_OAUTH_ISSUER", ""),
+			OIDCSigningKeyFile:          getEnv("AUTH_OIDC_SIGNING_KEY_FILE", ""),
+			OIDCLoginURL:                getEnv("AUTH_OIDC_LOGIN_URL", ""),
+			DeviceVerificationURL:       getEnv("AUTH_DEVICE_VERIFICATION_URL", ""),
+		},
+		Encryption: EncryptionConfig{
+			PrimaryKeyID: getEnv("ENCRYPTION_PRIMARY_KEY_ID", ""),
+			Keys:         getStringSlice("ENCRYPTION_KEYS"),
+			KeysDir:      getEnv("ENCRYPTION_KEYS_DIR", ""),
+		},
+		Risk: RiskConfig{
+			Enabled:                getBool("AUTH_RISK_ENABLED", false),
+			NewIPWeight:            getInt("AUTH_RISK_NEW_IP_WEIGHT", 20),
+			NewUserAgentWeight:     getInt("AUTH_RISK_NEW_USER_AGENT_WEIGHT", 10),
+			NewCountryWeight:       getInt("AUTH_RISK_NEW_COUNTRY_WEIGHT", 30),
+			ImpossibleTravelWeight: getInt("AUTH_RISK_IMPOSSIBLE_TRAVEL_WEIGHT", 60),
+			FailureWeight:          getInt("AUTH_RISK_FAILURE_WEIGHT", 10),
+			MaxFailures:            getInt("AUTH_RISK_MAX_FAILURES", 5),
+			FailureWindow:          getDuration("AUTH_RISK_FAILURE_WINDOW", time.Hour),
+			MaxTravelSpeed:         getInt("AUTH_RISK_MAX_TRAVEL_SPEED", 1000),
+			CaptchaScore:           getInt("AUTH_RISK_CAPTCHA_SCORE", 30),
+			EmailOTPScore:          getInt("AUTH_RISK_EMAIL_OTP_SCORE", 40),
+			DenyScore:              getInt("AUTH_RISK_DENY_SCORE", 100),
+		},
+		GeoIP: GeoIPConfig{
+			DatabasePath: getEnv("GEOIP_DATABASE_PATH", ""),
+		},
+		Cookie: CookieConfig{
+			Enabled:  getBool("AUTH_COOKIE_ENABLED", false),
+			Name:     getEnv("AUTH_COOKIE_NAME", "refresh_token"),
+			CSRFName: getEnv("AUTH_COOKIE_CSRF_NAME", "csrf_token"),
+			Domain:   getEnv("AUTH_COOKIE_DOMAIN", ""),
+			Path:     getEnv("AUTH_COOKIE_PATH", "/api/v1/auth"),
+			SameSite: getEnv("AUTH_COOKIE_SAMESITE", "strict"),
+			Secure:   getBool("AUTH_COOKIE_SECURE", true),
+		},
+		Captcha: CaptchaConfig{
+			VerifyURL: getEnv("CAPTCHA_VERIFY_URL", ""),
+			Secret:    getEnv("CAPTCHA_SECRET", ""),
+		},
+		Recovery: RecoveryConfig{
+			Delay:     getDuration("AUTH_RECOVERY_DELAY", 72*time.Hour),
+			Window:    getDuration("AUTH_RECOVERY_WINDOW", 7*24*time.Hour),
+			CancelURL: getEnv("AUTH_RECOVERY_CANCEL_URL", ""),
 		},
 		Telegram: TelegramConfig{
 			BotToken:    getEnv("TELEGRAM_BOT_TOKEN", ""),
@@ -66,6 +126,14 @@ func Load() (*Config, error) {
 	if cfg.DB.DSN == "" {
 		return nil, fmt.Errorf("DB_DSN is required")
 	}
+	if cfg.App.Env == "prod" && len(cfg.Encryption.Keys) == 0 && cfg.Encryption.KeysDir == "" {
+		return nil, fmt.Errorf("ENCRYPTION_KEYS or ENCRYPTION_KEYS_DIR is required in prod")
+	}
+	switch cfg.Auth.SessionLimitPolicy {
+	case "reject", "evict_oldest", "evict_lru":
+	default:
+		return nil, fmt.Errorf("AUTH_SESSION_LIMIT_POLICY must be reject, evict_oldest or evict_lru, got %q", cfg.Auth.SessionLimitPolicy)
+	}
 
 	return cfg, nil
 }
@@ -128,3 +196,39 @@ func getStringSlice(key string) []string {
 	}
 	return out
 }
+
+// getIntMap parses "key=value" pairs separated by commas, skipping entries
+// that are malformed or not integers.
+func getIntMap(key string) map[string]int {
+	out := map[string]int{}
+	for _, pair := range getStringSlice(key) {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		out[strings.TrimSpace(k)] = i
+	}
+	return out
+}
+
+// getDurationMap parses "key=duration" pairs separated by commas, skipping
+// entries that are malformed.
+func getDurationMap(key string) map[string]time.Duration {
+	out := map[string]time.Duration{}
+	for _, pair := range getStringSlice(key) {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+		out[strings.TrimSpace(k)] = d
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	plog "github.com/vaaxooo/xbackend/internal/platform/log"
+)
+
+// Listener keeps one LISTEN connection per process and fans notifications
+// out to in-process subscribers keyed by the notification payload. Further
+// channels can be routed to a handler with Handle.
+type Listener struct {
+	conn    *pq.Listener
+	logger  plog.Logger
+	channel string
+
+	mu       sync.Mutex
+	subs     map[string]map[chan struct{}]struct{}
+	handlers map[string]func(payload string)
+}
+
+// NewListener starts listening on channel. The connection is (re)opened in
+// the background; call Run to dispatch notifications.
+func NewListener(dsn, channel string, logger plog.Logger) (*Listener, error) {
+	l := &Listener{
+		logger:   logger,
+		channel:  channel,
+		subs:     make(map[string]map[chan struct{}]struct{}),
+		handlers: make(map[string]func(string)),
+	}
+	l.conn = pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil && l.logger != nil {
+			l.logger.Warn(context.Background(), "postgres listener connection problem", "channel", channel, "error", err)
+		}
+	})
+	if err := l.conn.Listen(channel); err != nil {
+		_ = l.conn.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Subscribe returns a channel that receives a value whenever a notification
+// with the given payload arrives. Wake-ups are coalesced: a slow subscriber
+// sees at most one pending value.
+func (l *Listener) Subscribe(key string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	l.mu.Lock()
+	if l.subs[key] == nil {
+		l.subs[key] = make(map[chan struct{}]struct{})
+	}
+	l.subs[key][ch] = struct{}{}
+	l.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.subs[key], ch)
+			if len(l.subs[key]) == 0 {
+				delete(l.subs, key)
+			}
+			l.mu.Unlock()
+		})
+	}
+}
+
+// Handle listens on another channel and calls fn with the payload of each
+// of its notifications. After a reconnect fn is called with an empty
+// payload, since notifications may have been lost in between.
+func (l *Listener) Handle(channel string, fn func(payload string)) error {
+	l.mu.Lock()
+	l.handlers[channel] = fn
+	l.mu.Unlock()
+	if err := l.conn.Listen(channel); err != nil {
+		l.mu.Lock()
+		delete(l.handlers, channel)
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run dispatches notifications until ctx is done.
+func (l *Listener) Run(ctx context.Context) {
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-l.conn.Notify:
+			if n == nil {
+				// Reconnected: notifications may have been lost, so
+				// every subscriber has to re-read its state.
+				l.wakeAll()
+				for _, fn := range l.allHandlers() {
+					fn("")
+				}
+				continue
+			}
+			if n.Channel != l.channel {
+				if fn := l.handler(n.Channel); fn != nil {
+					fn(n.Extra)
+				}
+				continue
+			}
+			l.wake(n.Extra)
+		case <-ping.C:
+			_ = l.conn.Ping()
+		}
+	}
+}
+
+func (l *Listener) Close() error {
+	return l.conn.Close()
+}
+
+func (l *Listener) wake(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.subs[key] {
+		signal(ch)
+	}
+}
+
+func (l *Listener) wakeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, subs := range l.subs {
+		for ch := range subs {
+			signal(ch)
+		}
+	}
+}
+
+func (l *Listener) handler(channel string) func(string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.handlers[channel]
+}
+
+func (l *Listener) allHandlers() []func(string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fns := make([]func(string), 0, len(l.handlers))
+	for _, fn := range l.handlers {
+		fns = append(fns, fn)
+	}
+	return fns
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,149 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+)
+
+type AccessTokenRepo struct {
+	db *sql.DB
+}
+
+func NewAccessTokenRepo(db *sql.DB) *AccessTokenRepo {
+	return &AccessTokenRepo{db: db}
+}
+
+func (r *AccessTokenRepo) Create(ctx context.Context, t domain.PersonalAccessToken) error {
+	const q = `
+        INSERT INTO auth_personal_access_tokens (id, user_id, name, prefix, token_hash, scopes, created_at, expires_at)
+        VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6, $7, $8)
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q,
+		t.ID,
+		t.UserID.String(),
+		t.Name,
+		t.Prefix,
+		t.TokenHash,
+		pq.Array(t.Scopes),
+		t.CreatedAt,
+		t.ExpiresAt,
+	)
+	return err
+}
+
+func (r *AccessTokenRepo) GetByHash(ctx context.Context, tokenHash string) (domain.PersonalAccessToken, bool, error) {
+	const q = `
+        SELECT id::text, user_id::text, name, prefix, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at
+        FROM auth_personal_access_tokens
+        WHERE token_hash = $1
+        LIMIT 1
+    `
+	return r.get(ctx, q, tokenHash)
+}
+
+func (r *AccessTokenRepo) GetByID(ctx context.Context, id string) (domain.PersonalAccessToken, bool, error) {
+	const q = `
+        SELECT id::text, user_id::text, name, prefix, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at
+        FROM auth_personal_access_tokens
+        WHERE id = $1::uuid
+        LIMIT 1
+    `
+	return r.get(ctx, q, id)
+}
+
+func (r *AccessTokenRepo) get(ctx context.Context, q string, arg string) (domain.PersonalAccessToken, bool, error) {
+	row := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, arg)
+	t, err := scanAccessToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.PersonalAccessToken{}, false, nil
+	}
+	if err != nil {
+		return domain.PersonalAccessToken{}, false, err
+	}
+	return t, true, nil
+}
+
+func (r *AccessTokenRepo) ListByUser(ctx context.Context, userID domain.UserID) ([]domain.PersonalAccessToken, error) {
+	const q = `
+        SELECT id::text, user_id::text, name, prefix, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at
+        FROM auth_personal_access_tokens
+        WHERE user_id = $1::uuid AND revoked_at IS NULL AND expires_at > $2
+        ORDER BY created_at DESC
+    `
+	rows, err := pdb.Executor(ctx, r.db).QueryContext(ctx, q, userID.String(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]domain.PersonalAccessToken, 0)
+	for rows.Next() {
+		t, scanErr := scanAccessToken(rows)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *AccessTokenRepo) Touch(ctx context.Context, id string, usedAt time.Time) error {
+	const q = `
+        UPDATE auth_personal_access_tokens
+        SET last_used_at = $2
+        WHERE id = $1::uuid
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, id, usedAt)
+	return err
+}
+
+func (r *AccessTokenRepo) Revoke(ctx context.Context, id string) error {
+	const q = `
+        UPDATE auth_personal_access_tokens
+        SET revoked_at = $2
+        WHERE id = $1::uuid AND revoked_at IS NULL
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, id, time.Now().UTC())
+	return err
+}
+
+func (r *AccessTokenRepo) RevokeByUser(ctx context.Context, userID domain.UserID) error {
+	const q = `
+        UPDATE auth_personal_access_tokens
+        SET revoked_at = $2
+        WHERE user_id = $1::uuid AND revoked_at IS NULL
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, userID.String(), time.Now().UTC())
+	return err
+}
+
+func scanAccessToken(scanner refreshScanner) (domain.PersonalAccessToken, error) {
+	var t domain.PersonalAccessToken
+	var userID string
+	var lastUsedAt, revokedAt sql.NullTime
+
+	if err := scanner.Scan(&t.ID, &userID, &t.Name, &t.Prefix, &t.TokenHash, pq.Array(&t.Scopes), &t.CreatedAt, &t.ExpiresAt, &lastUsedAt, &revokedAt); err != nil {
+		return domain.PersonalAccessToken{}, err
+	}
+	t.UserID = domain.UserID(userID)
+	if lastUsedAt.Valid {
+		v := lastUsedAt.Time
+		t.LastUsedAt = &v
+	}
+	if revokedAt.Valid {
+		v := revokedAt.Time
+		t.RevokedAt = &v
+	}
+	return t, nil
+}
+
+var _ domain.PersonalAccessTokenRepository = (*AccessTokenRepo)(nil)
@@ -0,0 +1,60 @@
+//go:build integration
+
+package usersdb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestAccessTokenRepoCreateAndGetByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAccessTokenRepo(db)
+	now := time.Unix(0, 0).UTC()
+	token, err := domain.NewPersonalAccessToken("user", "ci", "xbp_abcdef", "hash", []string{domain.ScopeProfileRead, domain.ScopeSessionsRead}, now, time.Hour)
+	if err != nil {
+		t.Fatalf("new token failed: %v", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO auth_personal_access_tokens")).
+		WithArgs(token.ID, "user", "ci", "xbp_abcdef", "hash", sqlmock.AnyArg(), now, now.Add(time.Hour)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := repo.Create(context.Background(), token); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM auth_personal_access_tokens")).
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "token_hash", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at"}).
+			AddRow(token.ID, "user", "ci", "xbp_abcdef", "hash", []byte("{profile:read,sessions:read}"), now, now.Add(time.Hour), now, nil))
+	got, found, err := repo.GetByHash(context.Background(), "hash")
+	if err != nil || !found {
+		t.Fatalf("get failed: found=%v err=%v", found, err)
+	}
+	if got.ID != token.ID || got.UserID != "user" || len(got.Scopes) != 2 || got.Scopes[1] != domain.ScopeSessionsRead || got.LastUsedAt == nil || got.RevokedAt != nil {
+		t.Fatalf("unexpected token: %+v", got)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_personal_access_tokens
+        SET revoked_at = $2
+        WHERE user_id = $1::uuid AND revoked_at IS NULL`)).
+		WithArgs("user", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	if err := repo.RevokeByUser(context.Background(), "user"); err != nil {
+		t.Fatalf("revoke by user failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
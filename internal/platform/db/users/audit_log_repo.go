@@ -0,0 +1,46 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+)
+
+// AuditLogRepo writes to the transaction in ctx, so an action and its audit
+// record commit together.
+type AuditLogRepo struct {
+	db *sql.DB
+}
+
+func NewAuditLogRepo(db *sql.DB) *AuditLogRepo {
+	return &AuditLogRepo{db: db}
+}
+
+func (r *AuditLogRepo) Record(ctx context.Context, rec domain.AuditRecord) error {
+	details := rec.Details
+	if details == nil {
+		details = map[string]string{}
+	}
+	payload, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	const q = `
+        INSERT INTO auth_audit_log (id, action, actor, user_id, ip, reason, details, created_at)
+        VALUES ($1::uuid, $2, $3, $4::uuid, $5, $6, $7::jsonb, $8)
+    `
+	_, err = pdb.Executor(ctx, r.db).ExecContext(ctx, q,
+		rec.ID,
+		rec.Action,
+		rec.Actor,
+		nullIfEmpty(rec.UserID.String()),
+		nullIfEmpty(rec.IP),
+		nullIfEmpty(rec.Reason),
+		string(payload),
+		rec.CreatedAt,
+	)
+	return err
+}
@@ -0,0 +1,27 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+)
+
+// ChallengeEventsChannel is the NOTIFY channel carrying ids of changed
+// challenges.
+const ChallengeEventsChannel = "auth_challenge_events"
+
+// ChallengeNotifier announces challenge changes with pg_notify. Inside a
+// transaction Postgres delivers the notification only on commit.
+type ChallengeNotifier struct {
+	db *sql.DB
+}
+
+func NewChallengeNotifier(db *sql.DB) *ChallengeNotifier {
+	return &ChallengeNotifier{db: db}
+}
+
+func (n *ChallengeNotifier) Notify(ctx context.Context, challengeID string) error {
+	_, err := pdb.Executor(ctx, n.db).ExecContext(ctx, `SELECT pg_notify($1, $2)`, ChallengeEventsChannel, challengeID)
+	return err
+}
@@ -3,7 +3,9 @@ package usersdb
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
@@ -22,14 +24,18 @@ func (r *ChallengeRepo) Create(ctx context.Context, challenge domain.Challenge)
 	const q = `
         INSERT INTO auth_challenges (
             id, user_id, challenge_type, required_steps, completed_steps, status, expires_at, session_fingerprint,
-            attempts_left, lock_until, created_at, updated_at
-        ) VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+            attempts_left, lock_until, step_state, created_at, updated_at
+        ) VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
     `
-	_, err := pdb.Executor(ctx, r.db).ExecContext(
+	stepState, err := marshalStepStates(challenge.StepStates)
+	if err != nil {
+		return err
+	}
+	_, err = pdb.Executor(ctx, r.db).ExecContext(
 		ctx,
 		q,
 		challenge.ID,
-		challenge.UserID.String(),
+		nullIfEmpty(challenge.UserID.String()),
 		challenge.Type,
 		pq.Array(challenge.RequiredSteps),
 		pq.Array(challenge.CompletedSteps),
@@ -38,6 +44,7 @@ func (r *ChallengeRepo) Create(ctx context.Context, challenge domain.Challenge)
 		nullIfEmpty(challenge.SessionFingerprint),
 		challenge.AttemptsLeft,
 		challenge.LockUntil,
+		stepState,
 		challenge.CreatedAt,
 		challenge.UpdatedAt,
 	)
@@ -48,10 +55,14 @@ func (r *ChallengeRepo) Update(ctx context.Context, challenge domain.Challenge)
 	const q = `
         UPDATE auth_challenges
         SET required_steps=$2, completed_steps=$3, status=$4, expires_at=$5, session_fingerprint=$6,
-            attempts_left=$7, lock_until=$8, updated_at=$9
+            attempts_left=$7, lock_until=$8, step_state=$9, updated_at=$10, user_id=$11::uuid
         WHERE id=$1::uuid
     `
-	_, err := pdb.Executor(ctx, r.db).ExecContext(
+	stepState, err := marshalStepStates(challenge.StepStates)
+	if err != nil {
+		return err
+	}
+	_, err = pdb.Executor(ctx, r.db).ExecContext(
 		ctx,
 		q,
 		challenge.ID,
@@ -62,15 +73,17 @@ func (r *ChallengeRepo) Update(ctx context.Context, challenge domain.Challenge)
 		nullIfEmpty(challenge.SessionFingerprint),
 		challenge.AttemptsLeft,
 		challenge.LockUntil,
+		stepState,
 		challenge.UpdatedAt,
+		nullIfEmpty(challenge.UserID.String()),
 	)
 	return err
 }
 
 func (r *ChallengeRepo) GetByID(ctx context.Context, id string) (domain.Challenge, bool, error) {
 	const q = `
-        SELECT id::text, user_id::text, challenge_type, required_steps, completed_steps, status, expires_at,
-               COALESCE(session_fingerprint, ''), attempts_left, lock_until, created_at, updated_at
+        SELECT id::text, COALESCE(user_id::text, ''), challenge_type, required_steps, completed_steps, status, expires_at,
+               COALESCE(session_fingerprint, ''), attempts_left, lock_until, step_state, created_at, updated_at
         FROM auth_challenges
         WHERE id=$1::uuid
         LIMIT 1
@@ -78,6 +91,7 @@ func (r *ChallengeRepo) GetByID(ctx context.Context, id string) (domain.Challeng
 	var c domain.Challenge
 	var required, completed []string
 	var status string
+	var stepState []byte
 	err := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, id).Scan(
 		&c.ID,
 		&c.UserID,
@@ -89,6 +103,7 @@ func (r *ChallengeRepo) GetByID(ctx context.Context, id string) (domain.Challeng
 		&c.SessionFingerprint,
 		&c.AttemptsLeft,
 		&c.LockUntil,
+		&stepState,
 		&c.CreatedAt,
 		&c.UpdatedAt,
 	)
@@ -101,6 +116,9 @@ func (r *ChallengeRepo) GetByID(ctx context.Context, id string) (domain.Challeng
 	c.RequiredSteps = toChallengeSteps(required)
 	c.CompletedSteps = toChallengeSteps(completed)
 	c.Status = domain.ChallengeStatus(status)
+	if c.StepStates, err = unmarshalStepStates(stepState); err != nil {
+		return domain.Challenge{}, false, err
+	}
 	if strings.TrimSpace(c.SessionFingerprint) == "" {
 		c.SessionFingerprint = ""
 	}
@@ -110,7 +128,7 @@ func (r *ChallengeRepo) GetByID(ctx context.Context, id string) (domain.Challeng
 func (r *ChallengeRepo) GetPendingByUser(ctx context.Context, userID domain.UserID) (domain.Challenge, bool, error) {
 	const q = `
         SELECT id::text, user_id::text, challenge_type, required_steps, completed_steps, status, expires_at,
-               COALESCE(session_fingerprint, ''), attempts_left, lock_until, created_at, updated_at
+               COALESCE(session_fingerprint, ''), attempts_left, lock_until, step_state, created_at, updated_at
         FROM auth_challenges
         WHERE user_id=$1::uuid AND status='pending'
         ORDER BY created_at DESC
@@ -119,6 +137,7 @@ func (r *ChallengeRepo) GetPendingByUser(ctx context.Context, userID domain.User
 	var c domain.Challenge
 	var required, completed []string
 	var status string
+	var stepState []byte
 	err := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, userID.String()).Scan(
 		&c.ID,
 		&c.UserID,
@@ -130,6 +149,7 @@ func (r *ChallengeRepo) GetPendingByUser(ctx context.Context, userID domain.User
 		&c.SessionFingerprint,
 		&c.AttemptsLeft,
 		&c.LockUntil,
+		&stepState,
 		&c.CreatedAt,
 		&c.UpdatedAt,
 	)
@@ -142,6 +162,9 @@ func (r *ChallengeRepo) GetPendingByUser(ctx context.Context, userID domain.User
 	c.RequiredSteps = toChallengeSteps(required)
 	c.CompletedSteps = toChallengeSteps(completed)
 	c.Status = domain.ChallengeStatus(status)
+	if c.StepStates, err = unmarshalStepStates(stepState); err != nil {
+		return domain.Challenge{}, false, err
+	}
 	if strings.TrimSpace(c.SessionFingerprint) == "" {
 		c.SessionFingerprint = ""
 	}
@@ -156,4 +179,35 @@ func toChallengeSteps(values []string) []domain.ChallengeStep {
 	return steps
 }
 
+type stepStateRecord struct {
+	AttemptsLeft int        `json:"attempts_left"`
+	LockUntil    *time.Time `json:"lock_until,omitempty"`
+}
+
+func marshalStepStates(states map[domain.ChallengeStep]domain.StepState) ([]byte, error) {
+	records := make(map[string]stepStateRecord, len(states))
+	for step, state := range states {
+		records[string(step)] = stepStateRecord{AttemptsLeft: state.AttemptsLeft, LockUntil: state.LockUntil}
+	}
+	return json.Marshal(records)
+}
+
+func unmarshalStepStates(raw []byte) (map[domain.ChallengeStep]domain.StepState, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var records map[string]stepStateRecord
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	states := make(map[domain.ChallengeStep]domain.StepState, len(records))
+	for step, r := range records {
+		states[domain.ChallengeStep(step)] = domain.StepState{AttemptsLeft: r.AttemptsLeft, LockUntil: r.LockUntil}
+	}
+	return states, nil
+}
+
 var _ domain.ChallengeRepository = (*ChallengeRepo)(nil)
@@ -0,0 +1,175 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+)
+
+type DeviceAuthorizationRepo struct {
+	db *sql.DB
+}
+
+func NewDeviceAuthorizationRepo(db *sql.DB) *DeviceAuthorizationRepo {
+	return &DeviceAuthorizationRepo{db: db}
+}
+
+// Create drops expired authorizations before storing d, which also frees
+// their user codes.
+func (r *DeviceAuthorizationRepo) Create(ctx context.Context, d domain.DeviceAuthorization) error {
+	const cleanup = `
+        DELETE FROM auth_device_authorizations
+        WHERE expires_at < $1
+    `
+	const insert = `
+        INSERT INTO auth_device_authorizations (id, device_code_hash, user_code_hash, client_id, status, ip, user_agent, country, city, interval_seconds, created_at, expires_at)
+        VALUES ($1::uuid, $2, $3, $4::uuid, $5, $6, $7, $8, $9, $10, $11, $12)
+    `
+	exec := pdb.Executor(ctx, r.db)
+	if _, err := exec.ExecContext(ctx, cleanup, d.CreatedAt); err != nil {
+		return err
+	}
+	_, err := exec.ExecContext(ctx, insert,
+		d.ID,
+		d.DeviceCodeHash,
+		d.UserCodeHash,
+		d.ClientID,
+		d.Status,
+		nullIfEmpty(d.IP),
+		nullIfEmpty(d.UserAgent),
+		nullIfEmpty(d.Country),
+		nullIfEmpty(d.City),
+		int(d.Interval/time.Second),
+		d.CreatedAt,
+		d.ExpiresAt,
+	)
+	return err
+}
+
+func (r *DeviceAuthorizationRepo) GetByDeviceCode(ctx context.Context, deviceCodeHash string) (domain.DeviceAuthorization, bool, error) {
+	return r.get(ctx, "device_code_hash", deviceCodeHash)
+}
+
+func (r *DeviceAuthorizationRepo) GetByUserCode(ctx context.Context, userCodeHash string) (domain.DeviceAuthorization, bool, error) {
+	return r.get(ctx, "user_code_hash", userCodeHash)
+}
+
+func (r *DeviceAuthorizationRepo) get(ctx context.Context, column, hash string) (domain.DeviceAuthorization, bool, error) {
+	q := `
+        SELECT id::text, device_code_hash, user_code_hash, client_id::text, status, COALESCE(user_id::text, ''),
+               amr, COALESCE(ip, ''), COALESCE(user_agent, ''), COALESCE(country, ''), COALESCE(city, ''),
+               interval_seconds, created_at, expires_at, last_polled_at, decided_at, used_at, COALESCE(session_id::text, '')
+        FROM auth_device_authorizations
+        WHERE ` + column + ` = $1
+        LIMIT 1
+    `
+	var d domain.DeviceAuthorization
+	var userID string
+	var interval int
+	var lastPolledAt, decidedAt, usedAt sql.NullTime
+	err := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, hash).Scan(
+		&d.ID,
+		&d.DeviceCodeHash,
+		&d.UserCodeHash,
+		&d.ClientID,
+		&d.Status,
+		&userID,
+		pq.Array(&d.AMR),
+		&d.IP,
+		&d.UserAgent,
+		&d.Country,
+		&d.City,
+		&interval,
+		&d.CreatedAt,
+		&d.ExpiresAt,
+		&lastPolledAt,
+		&decidedAt,
+		&usedAt,
+		&d.SessionID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.DeviceAuthorization{}, false, nil
+	}
+	if err != nil {
+		return domain.DeviceAuthorization{}, false, err
+	}
+	d.UserID = domain.UserID(userID)
+	d.Interval = time.Duration(interval) * time.Second
+	d.LastPolledAt = nullTimePtr(lastPolledAt)
+	d.DecidedAt = nullTimePtr(decidedAt)
+	d.UsedAt = nullTimePtr(usedAt)
+	return d, true, nil
+}
+
+func (r *DeviceAuthorizationRepo) Poll(ctx context.Context, id string, at time.Time, interval time.Duration) error {
+	const q = `
+        UPDATE auth_device_authorizations
+        SET last_polled_at = $2, interval_seconds = $3
+        WHERE id = $1::uuid
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, id, at, int(interval/time.Second))
+	return err
+}
+
+// Decide only answers an authorization that is still pending, so that a
+// user code cannot be answered twice.
+func (r *DeviceAuthorizationRepo) Decide(ctx context.Context, d domain.DeviceAuthorization) (bool, error) {
+	const q = `
+        UPDATE auth_device_authorizations
+        SET status = $2, user_id = $3::uuid, amr = $4, decided_at = $5
+        WHERE id = $1::uuid AND status = 'pending' AND expires_at > $5
+    `
+	var decidedAt time.Time
+	if d.DecidedAt != nil {
+		decidedAt = *d.DecidedAt
+	}
+	res, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q,
+		d.ID,
+		d.Status,
+		d.UserID.String(),
+		textArray(d.AMR),
+		decidedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// MarkUsed only succeeds once per approved authorization, so that two
+// concurrent polls cannot both get a session.
+func (r *DeviceAuthorizationRepo) MarkUsed(ctx context.Context, id, sessionID string, at time.Time) (bool, error) {
+	const q = `
+        UPDATE auth_device_authorizations
+        SET used_at = $3, session_id = $2::uuid
+        WHERE id = $1::uuid AND status = 'approved' AND used_at IS NULL
+    `
+	res, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, id, sessionID, at)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
+
+var _ domain.DeviceAuthorizationRepository = (*DeviceAuthorizationRepo)(nil)
@@ -0,0 +1,73 @@
+//go:build integration
+
+package usersdb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestDeviceAuthorizationRepoGetByUserCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewDeviceAuthorizationRepo(db)
+	now := time.Unix(0, 0).UTC()
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE user_code_hash = $1")).
+		WithArgs("user-hash").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "device_code_hash", "user_code_hash", "client_id", "status", "user_id",
+			"amr", "ip", "user_agent", "country", "city",
+			"interval_seconds", "created_at", "expires_at", "last_polled_at", "decided_at", "used_at", "session_id",
+		}).AddRow(
+			"device-1", "device-hash", "user-hash", "client-1", "pending", "",
+			[]byte("{}"), "203.0.113.7", "tv/1.0", "", "",
+			10, now, now.Add(10*time.Minute), now, nil, nil, "",
+		))
+
+	d, found, err := repo.GetByUserCode(context.Background(), "user-hash")
+	if err != nil || !found {
+		t.Fatalf("get failed: found=%v err=%v", found, err)
+	}
+	if d.Status != domain.DeviceAuthorizationPending || d.Interval != 10*time.Second || d.LastPolledAt == nil || d.DecidedAt != nil || d.IP != "203.0.113.7" {
+		t.Fatalf("unexpected device authorization: %+v", d)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestDeviceAuthorizationRepoMarkUsedOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewDeviceAuthorizationRepo(db)
+	at := time.Now()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE auth_device_authorizations")).
+		WithArgs("device-1", "session-1", at).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE auth_device_authorizations")).
+		WithArgs("device-1", "session-2", at).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if used, err := repo.MarkUsed(context.Background(), "device-1", "session-1", at); err != nil || !used {
+		t.Fatalf("expected the first use to succeed, got used=%v err=%v", used, err)
+	}
+	if used, err := repo.MarkUsed(context.Background(), "device-1", "session-2", at); err != nil || used {
+		t.Fatalf("expected the second use to fail, got used=%v err=%v", used, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
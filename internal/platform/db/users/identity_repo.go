@@ -8,14 +8,21 @@ import (
 
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+	"github.com/vaaxooo/xbackend/internal/platform/secrets"
 )
 
 type IdentityRepo struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher secrets.Cipher
 }
 
-func NewIdentityRepo(db *sql.DB) *IdentityRepo {
-	return &IdentityRepo{db: db}
+// NewIdentityRepo stores TOTP secrets sealed by cipher. A nil cipher keeps
+// them in plaintext.
+func NewIdentityRepo(db *sql.DB, cipher secrets.Cipher) *IdentityRepo {
+	if cipher == nil {
+		cipher = secrets.Plaintext{}
+	}
+	return &IdentityRepo{db: db, cipher: cipher}
 }
 
 func (r *IdentityRepo) Create(ctx context.Context, identity domain.Identity) error {
@@ -23,15 +30,19 @@ func (r *IdentityRepo) Create(ctx context.Context, identity domain.Identity) err
         INSERT INTO auth_identities (id, user_id, provider, provider_user_id, secret_hash, email_confirmed_at, totp_secret, totp_confirmed_at, created_at)
         VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6, $7, $8, $9)
     `
+	totpSecret, err := r.sealTOTPSecret(identity.ID, identity.TOTPSecret)
+	if err != nil {
+		return err
+	}
 	exec := pdb.Executor(ctx, r.db)
-	_, err := exec.ExecContext(ctx, q,
+	_, err = exec.ExecContext(ctx, q,
 		identity.ID,
 		identity.UserID.String(),
 		identity.Provider,
 		identity.ProviderUserID,
 		nullIfEmpty(identity.SecretHash.String()),
 		identity.EmailVerifiedAt,
-		nullIfEmpty(identity.TOTPSecret),
+		nullIfEmpty(totpSecret),
 		identity.TOTPConfirmedAt,
 		identity.CreatedAt,
 	)
@@ -79,6 +90,9 @@ func (r *IdentityRepo) GetByProvider(ctx context.Context, provider string, provi
 	}
 	i.UserID = domain.UserID(userID)
 	i.SecretHash = domain.PasswordHash(secretHash)
+	if i.TOTPSecret, err = r.openTOTPSecret(i.ID, i.TOTPSecret); err != nil {
+		return domain.Identity{}, false, err
+	}
 	if confirmedAt.Valid {
 		t := confirmedAt.Time
 		i.EmailVerifiedAt = &t
@@ -122,6 +136,9 @@ func (r *IdentityRepo) GetByUserAndProvider(ctx context.Context, userID domain.U
 	}
 	i.UserID = domain.UserID(id)
 	i.SecretHash = domain.PasswordHash(secretHash)
+	if i.TOTPSecret, err = r.openTOTPSecret(i.ID, i.TOTPSecret); err != nil {
+		return domain.Identity{}, false, err
+	}
 	if confirmedAt.Valid {
 		t := confirmedAt.Time
 		i.EmailVerifiedAt = &t
@@ -142,16 +159,115 @@ func (r *IdentityRepo) Update(ctx context.Context, identity domain.Identity) err
             totp_confirmed_at = $5
         WHERE id = $1::uuid
     `
-	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q,
+	totpSecret, err := r.sealTOTPSecret(identity.ID, identity.TOTPSecret)
+	if err != nil {
+		return err
+	}
+	_, err = pdb.Executor(ctx, r.db).ExecContext(ctx, q,
 		identity.ID,
 		nullIfEmpty(identity.SecretHash.String()),
 		identity.EmailVerifiedAt,
-		nullIfEmpty(identity.TOTPSecret),
+		nullIfEmpty(totpSecret),
 		identity.TOTPConfirmedAt,
 	)
 	return err
 }
 
+// ReencryptTOTPSecrets seals every stored TOTP secret that is still in
+// plaintext or sealed with a retired key using keyring's primary key. It
+// walks the table in batches of batchSize and returns the number of rows
+// rewritten.
+func (r *IdentityRepo) ReencryptTOTPSecrets(ctx context.Context, keyring *secrets.Keyring, batchSize int) (int, error) {
+	const selectQ = `
+        SELECT id::text, totp_secret
+        FROM auth_identities
+        WHERE totp_secret IS NOT NULL AND id > $1::uuid
+        ORDER BY id
+        LIMIT $2
+    `
+	const updateQ = `
+        UPDATE auth_identities
+        SET totp_secret = $2
+        WHERE id = $1::uuid AND totp_secret = $3
+    `
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	type row struct{ id, value string }
+	var (
+		after     = "00000000-0000-0000-0000-000000000000"
+		rewritten int
+	)
+	for {
+		rows, err := r.db.QueryContext(ctx, selectQ, after, batchSize)
+		if err != nil {
+			return rewritten, err
+		}
+		var batch []row
+		for rows.Next() {
+			var rw row
+			if err := rows.Scan(&rw.id, &rw.value); err != nil {
+				rows.Close()
+				return rewritten, err
+			}
+			batch = append(batch, rw)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return rewritten, err
+		}
+		rows.Close()
+
+		for _, rw := range batch {
+			if !keyring.NeedsRotation(rw.value) {
+				continue
+			}
+			aad := totpSecretAssociatedData(rw.id)
+			plain, err := keyring.Decrypt(rw.value, aad)
+			if err != nil {
+				return rewritten, err
+			}
+			sealed, err := keyring.Encrypt(plain, aad)
+			if err != nil {
+				return rewritten, err
+			}
+			// The compare-and-set on the old value skips rows that changed
+			// concurrently; they were written with the current key anyway.
+			res, err := r.db.ExecContext(ctx, updateQ, rw.id, sealed, rw.value)
+			if err != nil {
+				return rewritten, err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				rewritten++
+			}
+		}
+
+		if len(batch) < batchSize {
+			return rewritten, nil
+		}
+		after = batch[len(batch)-1].id
+	}
+}
+
+func (r *IdentityRepo) sealTOTPSecret(identityID, secret string) (string, error) {
+	if secret == "" {
+		return "", nil
+	}
+	return r.cipher.Encrypt(secret, totpSecretAssociatedData(identityID))
+}
+
+func (r *IdentityRepo) openTOTPSecret(identityID, stored string) (string, error) {
+	if stored == "" {
+		return "", nil
+	}
+	return r.cipher.Decrypt(stored, totpSecretAssociatedData(identityID))
+}
+
+func totpSecretAssociatedData(identityID string) string {
+	return "auth_identities.totp_secret:" + identityID
+}
+
 func isUniqueViolation(err error) bool {
 	msg := err.Error()
 	return strings.Contains(msg, "duplicate key") || strings.Contains(msg, "unique constraint")
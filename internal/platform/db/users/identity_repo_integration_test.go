@@ -4,12 +4,14 @@ package usersdb
 
 import (
 	"context"
+	"database/sql/driver"
 	"regexp"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	"github.com/vaaxooo/xbackend/internal/platform/secrets"
 )
 
 func TestIdentityRepoCreateAndGet(t *testing.T) {
@@ -19,7 +21,7 @@ func TestIdentityRepoCreateAndGet(t *testing.T) {
 	}
 	defer db.Close()
 
-	repo := NewIdentityRepo(db)
+	repo := NewIdentityRepo(db, nil)
 	identity := domain.NewEmailIdentity("user", mustEmail(t, "user@example.com"), "hash", time.Unix(0, 0))
 
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO auth_identities")).
@@ -49,6 +51,64 @@ func TestIdentityRepoCreateAndGet(t *testing.T) {
 	}
 }
 
+func TestIdentityRepoEncryptsTOTPSecret(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	keyring, err := secrets.NewKeyring("k1", map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")})
+	if err != nil {
+		t.Fatalf("keyring error: %v", err)
+	}
+	repo := NewIdentityRepo(db, keyring)
+	identity := domain.NewEmailIdentity("user", mustEmail(t, "user@example.com"), "hash", time.Unix(0, 0))
+	identity.TOTPSecret = "JBSWY3DPEHPK3PXP"
+
+	var stored string
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE auth_identities")).
+		WithArgs(identity.ID, identity.SecretHash.String(), nil, capture(&stored), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := repo.Update(context.Background(), identity); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if !secrets.IsEncrypted(stored) {
+		t.Fatalf("expected encrypted totp secret, got %q", stored)
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "provider", "provider_user_id", "secret_hash", "email_confirmed_at", "totp_secret", "totp_confirmed_at", "created_at"}).
+		AddRow(identity.ID, identity.UserID.String(), identity.Provider, identity.ProviderUserID, "hash", nil, stored, nil, identity.CreatedAt)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT\n            id::text,")).
+		WithArgs(identity.UserID.String(), identity.Provider).
+		WillReturnRows(rows)
+
+	got, found, err := repo.GetByUserAndProvider(context.Background(), identity.UserID, identity.Provider)
+	if err != nil || !found {
+		t.Fatalf("expected identity found, err=%v found=%v", err, found)
+	}
+	if got.TOTPSecret != identity.TOTPSecret {
+		t.Fatalf("expected decrypted secret, got %q", got.TOTPSecret)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+type captureArg struct{ dst *string }
+
+func capture(dst *string) captureArg { return captureArg{dst: dst} }
+
+func (c captureArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if ok {
+		*c.dst = s
+	}
+	return ok
+}
+
 func mustEmail(t *testing.T, raw string) domain.Email {
 	t.Helper()
 	e, err := domain.NewEmail(raw)
@@ -0,0 +1,58 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+// LoginAttemptRepo writes straight to the pool instead of the transaction in
+// ctx: a failed login rolls its transaction back, but the failure must still
+// count towards risk scoring.
+type LoginAttemptRepo struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepo(db *sql.DB) *LoginAttemptRepo {
+	return &LoginAttemptRepo{db: db}
+}
+
+func (r *LoginAttemptRepo) Record(ctx context.Context, a domain.LoginAttempt) error {
+	const q = `
+        INSERT INTO auth_login_attempts (id, user_id, ip, user_agent, succeeded, created_at)
+        VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6)
+    `
+	_, err := r.db.ExecContext(ctx, q,
+		a.ID,
+		a.UserID.String(),
+		nullIfEmpty(a.IP),
+		nullIfEmpty(a.UserAgent),
+		a.Succeeded,
+		a.CreatedAt,
+	)
+	return err
+}
+
+// CountFailures counts failed attempts from ip after since and after the
+// latest successful one, so a successful login resets the counter.
+func (r *LoginAttemptRepo) CountFailures(ctx context.Context, userID domain.UserID, ip string, since time.Time) (int, error) {
+	const q = `
+        SELECT COUNT(*)
+        FROM auth_login_attempts
+        WHERE user_id = $1::uuid
+          AND ip IS NOT DISTINCT FROM $3
+          AND succeeded = FALSE
+          AND created_at > GREATEST($2::timestamptz, COALESCE((
+              SELECT MAX(created_at) FROM auth_login_attempts WHERE user_id = $1::uuid AND succeeded = TRUE
+          ), $2::timestamptz))
+    `
+	var n int
+	if err := r.db.QueryRowContext(ctx, q, userID.String(), since, nullIfEmpty(ip)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+var _ domain.LoginAttemptRepository = (*LoginAttemptRepo)(nil)
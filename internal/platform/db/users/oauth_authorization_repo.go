@@ -0,0 +1,200 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+)
+
+// authorizationCodeRetention is how long codes are kept after they
+// expire, so that a replayed code still finds the session to end.
+const authorizationCodeRetention = 24 * time.Hour
+
+type AuthorizationCodeRepo struct {
+	db *sql.DB
+}
+
+func NewAuthorizationCodeRepo(db *sql.DB) *AuthorizationCodeRepo {
+	return &AuthorizationCodeRepo{db: db}
+}
+
+// Create drops codes that expired long ago before storing c.
+func (r *AuthorizationCodeRepo) Create(ctx context.Context, c domain.AuthorizationCode) error {
+	const cleanup = `
+        DELETE FROM auth_oauth_codes
+        WHERE expires_at < $1
+    `
+	const insert = `
+        INSERT INTO auth_oauth_codes (id, code_hash, client_id, user_id, redirect_uri, scopes, nonce, code_challenge, auth_time, amr, login_method, created_at, expires_at)
+        VALUES ($1::uuid, $2, $3::uuid, $4::uuid, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+    `
+	exec := pdb.Executor(ctx, r.db)
+	if _, err := exec.ExecContext(ctx, cleanup, c.CreatedAt.Add(-authorizationCodeRetention)); err != nil {
+		return err
+	}
+	_, err := exec.ExecContext(ctx, insert,
+		c.ID,
+		c.CodeHash,
+		c.ClientID,
+		c.UserID.String(),
+		c.RedirectURI,
+		textArray(c.Scopes),
+		nullIfEmpty(c.Nonce),
+		c.CodeChallenge,
+		nullIfZeroTime(c.AuthTime),
+		textArray(c.AMR),
+		nullIfEmpty(c.LoginMethod),
+		c.CreatedAt,
+		c.ExpiresAt,
+	)
+	return err
+}
+
+func (r *AuthorizationCodeRepo) GetByHash(ctx context.Context, codeHash string) (domain.AuthorizationCode, bool, error) {
+	const q = `
+        SELECT id::text, code_hash, client_id::text, user_id::text, redirect_uri, scopes, COALESCE(nonce, ''), code_challenge,
+               auth_time, amr, COALESCE(login_method, ''), created_at, expires_at, used_at, COALESCE(session_id::text, '')
+        FROM auth_oauth_codes
+        WHERE code_hash = $1
+        LIMIT 1
+    `
+	var c domain.AuthorizationCode
+	var userID string
+	var authTime, usedAt sql.NullTime
+	err := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, codeHash).Scan(
+		&c.ID,
+		&c.CodeHash,
+		&c.ClientID,
+		&userID,
+		&c.RedirectURI,
+		pq.Array(&c.Scopes),
+		&c.Nonce,
+		&c.CodeChallenge,
+		&authTime,
+		pq.Array(&c.AMR),
+		&c.LoginMethod,
+		&c.CreatedAt,
+		&c.ExpiresAt,
+		&usedAt,
+		&c.SessionID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.AuthorizationCode{}, false, nil
+	}
+	if err != nil {
+		return domain.AuthorizationCode{}, false, err
+	}
+	c.UserID = domain.UserID(userID)
+	if authTime.Valid {
+		c.AuthTime = authTime.Time
+	}
+	if usedAt.Valid {
+		v := usedAt.Time
+		c.UsedAt = &v
+	}
+	return c, true, nil
+}
+
+// MarkUsed only succeeds for a code that was not used yet, so that two
+// concurrent exchanges cannot both redeem it.
+func (r *AuthorizationCodeRepo) MarkUsed(ctx context.Context, id, sessionID string, at time.Time) (bool, error) {
+	const q = `
+        UPDATE auth_oauth_codes
+        SET used_at = $3, session_id = $2::uuid
+        WHERE id = $1::uuid AND used_at IS NULL
+    `
+	res, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, id, sessionID, at)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+var _ domain.AuthorizationCodeRepository = (*AuthorizationCodeRepo)(nil)
+
+type OAuthConsentRepo struct {
+	db *sql.DB
+}
+
+func NewOAuthConsentRepo(db *sql.DB) *OAuthConsentRepo {
+	return &OAuthConsentRepo{db: db}
+}
+
+func (r *OAuthConsentRepo) Get(ctx context.Context, userID domain.UserID, clientID string) (domain.OAuthConsent, bool, error) {
+	const q = `
+        SELECT scopes, granted_at
+        FROM auth_oauth_consents
+        WHERE user_id = $1::uuid AND client_id = $2::uuid
+    `
+	c := domain.OAuthConsent{UserID: userID, ClientID: clientID}
+	err := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, userID.String(), clientID).Scan(pq.Array(&c.Scopes), &c.GrantedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.OAuthConsent{}, false, nil
+	}
+	if err != nil {
+		return domain.OAuthConsent{}, false, err
+	}
+	return c, true, nil
+}
+
+func (r *OAuthConsentRepo) Save(ctx context.Context, c domain.OAuthConsent) error {
+	const q = `
+        INSERT INTO auth_oauth_consents (user_id, client_id, scopes, granted_at)
+        VALUES ($1::uuid, $2::uuid, $3, $4)
+        ON CONFLICT (user_id, client_id) DO UPDATE
+        SET scopes = EXCLUDED.scopes, granted_at = EXCLUDED.granted_at
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, c.UserID.String(), c.ClientID, textArray(c.Scopes), c.GrantedAt)
+	return err
+}
+
+var _ domain.OAuthConsentRepository = (*OAuthConsentRepo)(nil)
+
+type OAuthGrantRepo struct {
+	db *sql.DB
+}
+
+func NewOAuthGrantRepo(db *sql.DB) *OAuthGrantRepo {
+	return &OAuthGrantRepo{db: db}
+}
+
+func (r *OAuthGrantRepo) Create(ctx context.Context, g domain.OAuthGrant) error {
+	const q = `
+        INSERT INTO auth_oauth_grants (session_id, client_id, scopes, created_at)
+        VALUES ($1::uuid, $2::uuid, $3, $4)
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, g.SessionID, g.ClientID, textArray(g.Scopes), g.CreatedAt)
+	return err
+}
+
+func (r *OAuthGrantRepo) GetBySession(ctx context.Context, sessionID string) (domain.OAuthGrant, bool, error) {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return domain.OAuthGrant{}, false, nil
+	}
+	const q = `
+        SELECT client_id::text, scopes, created_at
+        FROM auth_oauth_grants
+        WHERE session_id = $1::uuid
+    `
+	g := domain.OAuthGrant{SessionID: sessionID}
+	err := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, sessionID).Scan(&g.ClientID, pq.Array(&g.Scopes), &g.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.OAuthGrant{}, false, nil
+	}
+	if err != nil {
+		return domain.OAuthGrant{}, false, err
+	}
+	return g, true, nil
+}
+
+var _ domain.OAuthGrantRepository = (*OAuthGrantRepo)(nil)
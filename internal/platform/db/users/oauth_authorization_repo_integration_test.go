@@ -0,0 +1,69 @@
+//go:build integration
+
+package usersdb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAuthorizationCodeRepoMarkUsedOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAuthorizationCodeRepo(db)
+	at := time.Now()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE auth_oauth_codes")).
+		WithArgs("code-1", "session-1", at).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE auth_oauth_codes")).
+		WithArgs("code-1", "session-2", at).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if used, err := repo.MarkUsed(context.Background(), "code-1", "session-1", at); err != nil || !used {
+		t.Fatalf("expected the first use to succeed, got used=%v err=%v", used, err)
+	}
+	if used, err := repo.MarkUsed(context.Background(), "code-1", "session-2", at); err != nil || used {
+		t.Fatalf("expected the second use to fail, got used=%v err=%v", used, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestOAuthGrantRepoGetBySession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewOAuthGrantRepo(db)
+	if _, found, err := repo.GetBySession(context.Background(), "not-a-uuid"); err != nil || found {
+		t.Fatalf("expected ids that are not uuids to miss without a query, got found=%v err=%v", found, err)
+	}
+
+	id := "11111111-1111-1111-1111-111111111111"
+	now := time.Unix(0, 0).UTC()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM auth_oauth_grants")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "scopes", "created_at"}).
+			AddRow("client-1", []byte("{email,openid}"), now))
+	grant, found, err := repo.GetBySession(context.Background(), id)
+	if err != nil || !found {
+		t.Fatalf("get failed: found=%v err=%v", found, err)
+	}
+	if grant.ClientID != "client-1" || !grant.HasScope("openid") || grant.SessionID != id {
+		t.Fatalf("unexpected grant: %+v", grant)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+//go:build integration
+
+package usersdb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestOAuthClientRepoGetByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewOAuthClientRepo(db)
+	if _, found, err := repo.GetByID(context.Background(), "not-a-uuid"); err != nil || found {
+		t.Fatalf("expected ids that are not uuids to miss without a query, got found=%v err=%v", found, err)
+	}
+
+	id := "11111111-1111-1111-1111-111111111111"
+	now := time.Unix(0, 0).UTC()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM auth_oauth_clients")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "auth_method", "secret_hash", "public_key", "scopes", "redirect_uris", "created_at", "disabled_at"}).
+			AddRow(id, "billing", domain.ClientAuthSecret, "hash", nil, []byte("{revocations:read}"), []byte("{https://app.example.com/callback}"), now, nil))
+	client, found, err := repo.GetByID(context.Background(), id)
+	if err != nil || !found {
+		t.Fatalf("get failed: found=%v err=%v", found, err)
+	}
+	if client.SecretHash != "hash" || client.PublicKey != "" || len(client.Scopes) != 1 || !client.AllowsRedirect("https://app.example.com/callback") || !client.IsActive() {
+		t.Fatalf("unexpected client: %+v", client)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestClientAssertionRepoRefusesReuse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewClientAssertionRepo(db)
+	expiresAt := time.Now().Add(time.Minute)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM auth_oauth_client_assertions")).
+		WithArgs("client", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO auth_oauth_client_assertions")).
+		WithArgs("client", "jti", expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	fresh, err := repo.Use(context.Background(), "client", "jti", expiresAt)
+	if err != nil || fresh {
+		t.Fatalf("expected a known jti to be refused, got fresh=%v err=%v", fresh, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
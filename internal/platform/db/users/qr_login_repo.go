@@ -0,0 +1,146 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+)
+
+type QRLoginRepo struct {
+	db *sql.DB
+}
+
+func NewQRLoginRepo(db *sql.DB) *QRLoginRepo {
+	return &QRLoginRepo{db: db}
+}
+
+// Create drops expired QR logins before storing q. Their challenges stay,
+// like those of any other login.
+func (r *QRLoginRepo) Create(ctx context.Context, q domain.QRLogin) error {
+	const cleanup = `
+        DELETE FROM auth_qr_logins
+        WHERE expires_at < $1
+    `
+	const insert = `
+        INSERT INTO auth_qr_logins (challenge_id, code_hash, login_token_hash, ip, user_agent, country, city, created_at, expires_at)
+        VALUES ($1::uuid, $2, $3, $4, $5, $6, $7, $8, $9)
+    `
+	exec := pdb.Executor(ctx, r.db)
+	if _, err := exec.ExecContext(ctx, cleanup, q.CreatedAt); err != nil {
+		return err
+	}
+	_, err := exec.ExecContext(ctx, insert,
+		q.ChallengeID,
+		q.CodeHash,
+		q.LoginTokenHash,
+		nullIfEmpty(q.IP),
+		nullIfEmpty(q.UserAgent),
+		nullIfEmpty(q.Country),
+		nullIfEmpty(q.City),
+		q.CreatedAt,
+		q.ExpiresAt,
+	)
+	return err
+}
+
+func (r *QRLoginRepo) GetByCode(ctx context.Context, codeHash string) (domain.QRLogin, bool, error) {
+	return r.get(ctx, "code_hash = $1", codeHash)
+}
+
+func (r *QRLoginRepo) GetByChallenge(ctx context.Context, challengeID string) (domain.QRLogin, bool, error) {
+	return r.get(ctx, "challenge_id = $1::uuid", challengeID)
+}
+
+func (r *QRLoginRepo) get(ctx context.Context, where, arg string) (domain.QRLogin, bool, error) {
+	q := `
+        SELECT challenge_id::text, code_hash, login_token_hash, COALESCE(user_id::text, ''), amr,
+               COALESCE(ip, ''), COALESCE(user_agent, ''), COALESCE(country, ''), COALESCE(city, ''),
+               created_at, expires_at, decided_at, claimed_at, COALESCE(session_id::text, '')
+        FROM auth_qr_logins
+        WHERE ` + where + `
+        LIMIT 1
+    `
+	var l domain.QRLogin
+	var userID string
+	var decidedAt, claimedAt sql.NullTime
+	err := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, arg).Scan(
+		&l.ChallengeID,
+		&l.CodeHash,
+		&l.LoginTokenHash,
+		&userID,
+		pq.Array(&l.AMR),
+		&l.IP,
+		&l.UserAgent,
+		&l.Country,
+		&l.City,
+		&l.CreatedAt,
+		&l.ExpiresAt,
+		&decidedAt,
+		&claimedAt,
+		&l.SessionID,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.QRLogin{}, false, nil
+	}
+	if err != nil {
+		return domain.QRLogin{}, false, err
+	}
+	l.UserID = domain.UserID(userID)
+	l.DecidedAt = nullTimePtr(decidedAt)
+	l.ClaimedAt = nullTimePtr(claimedAt)
+	return l, true, nil
+}
+
+// Decide only answers a QR login that is still unanswered, so that two
+// phones cannot both answer the same code.
+func (r *QRLoginRepo) Decide(ctx context.Context, q domain.QRLogin) (bool, error) {
+	const stmt = `
+        UPDATE auth_qr_logins
+        SET user_id = $2::uuid, amr = $3, decided_at = $4
+        WHERE challenge_id = $1::uuid AND decided_at IS NULL AND expires_at > $4
+    `
+	var decidedAt time.Time
+	if q.DecidedAt != nil {
+		decidedAt = *q.DecidedAt
+	}
+	res, err := pdb.Executor(ctx, r.db).ExecContext(ctx, stmt,
+		q.ChallengeID,
+		q.UserID.String(),
+		textArray(q.AMR),
+		decidedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Claim only succeeds once per approved QR login, so that two concurrent
+// polls cannot both get a session.
+func (r *QRLoginRepo) Claim(ctx context.Context, challengeID, sessionID string, at time.Time) (bool, error) {
+	const stmt = `
+        UPDATE auth_qr_logins
+        SET claimed_at = $3, session_id = $2::uuid
+        WHERE challenge_id = $1::uuid AND decided_at IS NOT NULL AND claimed_at IS NULL
+    `
+	res, err := pdb.Executor(ctx, r.db).ExecContext(ctx, stmt, challengeID, sessionID, at)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+var _ domain.QRLoginRepository = (*QRLoginRepo)(nil)
@@ -0,0 +1,73 @@
+//go:build integration
+
+package usersdb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestQRLoginRepoGetByChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewQRLoginRepo(db)
+	now := time.Unix(0, 0).UTC()
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE challenge_id = $1::uuid")).
+		WithArgs("challenge-1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"challenge_id", "code_hash", "login_token_hash", "user_id", "amr",
+			"ip", "user_agent", "country", "city",
+			"created_at", "expires_at", "decided_at", "claimed_at", "session_id",
+		}).AddRow(
+			"challenge-1", "code-hash", "token-hash", "user-1", []byte("{pwd,otp}"),
+			"198.51.100.7", "desktop/1.0", "NL", "",
+			now, now.Add(2*time.Minute), now, nil, "",
+		))
+
+	q, found, err := repo.GetByChallenge(context.Background(), "challenge-1")
+	if err != nil || !found {
+		t.Fatalf("get failed: found=%v err=%v", found, err)
+	}
+	if q.UserID != domain.UserID("user-1") || len(q.AMR) != 2 || q.DecidedAt == nil || q.ClaimedAt != nil || q.IP != "198.51.100.7" {
+		t.Fatalf("unexpected QR login: %+v", q)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
+
+func TestQRLoginRepoClaimOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewQRLoginRepo(db)
+	at := time.Now()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE auth_qr_logins")).
+		WithArgs("challenge-1", "session-1", at).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE auth_qr_logins")).
+		WithArgs("challenge-1", "session-2", at).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if claimed, err := repo.Claim(context.Background(), "challenge-1", "session-1", at); err != nil || !claimed {
+		t.Fatalf("expected the first claim to succeed, got claimed=%v err=%v", claimed, err)
+	}
+	if claimed, err := repo.Claim(context.Background(), "challenge-1", "session-2", at); err != nil || claimed {
+		t.Fatalf("expected the second claim to fail, got claimed=%v err=%v", claimed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
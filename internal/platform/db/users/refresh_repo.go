@@ -29,8 +29,8 @@ func NewRefreshRepo(db *sql.DB, cleanupTTL time.Duration) *RefreshRepo {
 func (r *RefreshRepo) Create(ctx context.Context, t domain.RefreshToken) error {
 	r.cleanupStale(ctx, time.Now().UTC())
 	const q = `
-        INSERT INTO auth_refresh_tokens (id, user_id, token_hash, expires_at, revoked_at, created_at, user_agent, ip)
-        VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6, $7, $8)
+        INSERT INTO auth_refresh_tokens (id, user_id, token_hash, expires_at, revoked_at, created_at, user_agent, ip, auth_time, amr, login_method, device_name, last_used_at, last_ip, country, city, client_type, absolute_expires_at)
+        VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
     `
 	exec := pdb.Executor(ctx, r.db)
 	_, err := exec.ExecContext(ctx, q,
@@ -42,6 +42,16 @@ func (r *RefreshRepo) Create(ctx context.Context, t domain.RefreshToken) error {
 		t.CreatedAt,
 		nullIfEmpty(t.UserAgent),
 		nullIfEmpty(t.IP),
+		nullIfZeroTime(t.AuthTime),
+		pq.Array(amrOrEmpty(t.AMR)),
+		nullIfEmpty(t.LoginMethod),
+		nullIfEmpty(t.DeviceName),
+		nullIfZeroTime(t.LastUsedAt),
+		nullIfEmpty(t.LastIP),
+		nullIfEmpty(t.Country),
+		nullIfEmpty(t.City),
+		nullIfEmpty(t.ClientType),
+		nullIfZeroTime(t.AbsoluteExpiresAt),
 	)
 	return err
 }
@@ -55,7 +65,17 @@ func (r *RefreshRepo) Update(ctx context.Context, t domain.RefreshToken) error {
             revoked_at = $4,
             created_at = $5,
             user_agent = $6,
-            ip = $7
+            ip = $7,
+            auth_time = $8,
+            amr = $9,
+            login_method = $10,
+            device_name = $11,
+            last_used_at = $12,
+            last_ip = $13,
+            country = $14,
+            city = $15,
+            client_type = $16,
+            absolute_expires_at = $17
         WHERE id = $1::uuid
     `
 	exec := pdb.Executor(ctx, r.db)
@@ -67,6 +87,16 @@ func (r *RefreshRepo) Update(ctx context.Context, t domain.RefreshToken) error {
 		t.CreatedAt,
 		nullIfEmpty(t.UserAgent),
 		nullIfEmpty(t.IP),
+		nullIfZeroTime(t.AuthTime),
+		pq.Array(amrOrEmpty(t.AMR)),
+		nullIfEmpty(t.LoginMethod),
+		nullIfEmpty(t.DeviceName),
+		nullIfZeroTime(t.LastUsedAt),
+		nullIfEmpty(t.LastIP),
+		nullIfEmpty(t.Country),
+		nullIfEmpty(t.City),
+		nullIfEmpty(t.ClientType),
+		nullIfZeroTime(t.AbsoluteExpiresAt),
 	)
 	return err
 }
@@ -81,7 +111,17 @@ func (r *RefreshRepo) GetByHash(ctx context.Context, tokenHash string) (domain.R
             revoked_at,
             created_at,
             COALESCE(user_agent, ''),
-            COALESCE(ip, '')
+            COALESCE(ip, ''),
+            auth_time,
+            amr,
+            COALESCE(login_method, ''),
+            COALESCE(device_name, ''),
+            last_used_at,
+            COALESCE(last_ip, ''),
+            COALESCE(country, ''),
+            COALESCE(city, ''),
+            COALESCE(client_type, ''),
+            absolute_expires_at
         FROM auth_refresh_tokens
         WHERE token_hash = $1
         LIMIT 1
@@ -97,6 +137,14 @@ func (r *RefreshRepo) GetByHash(ctx context.Context, tokenHash string) (domain.R
 	return t, true, nil
 }
 
+// LockUser holds a transaction-scoped advisory lock on the sessions of
+// userID, so that concurrent logins of the user are counted one at a time.
+func (r *RefreshRepo) LockUser(ctx context.Context, userID domain.UserID) error {
+	const q = `SELECT pg_advisory_xact_lock(hashtext('auth_refresh_tokens:' || $1))`
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, userID.String())
+	return err
+}
+
 func (r *RefreshRepo) Revoke(ctx context.Context, tokenID string) error {
 	now := time.Now().UTC()
 	const q = `
@@ -118,7 +166,17 @@ func (r *RefreshRepo) GetByID(ctx context.Context, tokenID string) (domain.Refre
             revoked_at,
             created_at,
             COALESCE(user_agent, ''),
-            COALESCE(ip, '')
+            COALESCE(ip, ''),
+            auth_time,
+            amr,
+            COALESCE(login_method, ''),
+            COALESCE(device_name, ''),
+            last_used_at,
+            COALESCE(last_ip, ''),
+            COALESCE(country, ''),
+            COALESCE(city, ''),
+            COALESCE(client_type, ''),
+            absolute_expires_at
         FROM auth_refresh_tokens
         WHERE id = $1::uuid
         LIMIT 1
@@ -145,11 +203,20 @@ func (r *RefreshRepo) ListByUser(ctx context.Context, userID domain.UserID) ([]d
             revoked_at,
             created_at,
             COALESCE(user_agent, ''),
-            COALESCE(ip, '')
+            COALESCE(ip, ''),
+            auth_time,
+            amr,
+            COALESCE(login_method, ''),
+            COALESCE(device_name, ''),
+            last_used_at,
+            COALESCE(last_ip, ''),
+            COALESCE(country, ''),
+            COALESCE(city, ''),
+            COALESCE(client_type, ''),
+            absolute_expires_at
         FROM auth_refresh_tokens
         WHERE user_id = $1::uuid AND revoked_at IS NULL AND expires_at > $2
-        ORDER BY created_at DESC
-        LIMIT 15
+        ORDER BY COALESCE(last_used_at, created_at) DESC
     `
 	rows, err := pdb.Executor(ctx, r.db).QueryContext(ctx, q, userID.String(), time.Now().UTC())
 	if err != nil {
@@ -171,6 +238,51 @@ func (r *RefreshRepo) ListByUser(ctx context.Context, userID domain.UserID) ([]d
 	return tokens, nil
 }
 
+func (r *RefreshRepo) ListActiveByUser(ctx context.Context, userID domain.UserID, now time.Time) ([]domain.RefreshToken, error) {
+	const q = `
+        SELECT
+            id::text,
+            user_id::text,
+            token_hash,
+            expires_at,
+            revoked_at,
+            created_at,
+            COALESCE(user_agent, ''),
+            COALESCE(ip, ''),
+            auth_time,
+            amr,
+            COALESCE(login_method, ''),
+            COALESCE(device_name, ''),
+            last_used_at,
+            COALESCE(last_ip, ''),
+            COALESCE(country, ''),
+            COALESCE(city, ''),
+            COALESCE(client_type, ''),
+            absolute_expires_at
+        FROM auth_refresh_tokens
+        WHERE user_id = $1::uuid AND revoked_at IS NULL AND expires_at > $2
+        ORDER BY created_at ASC
+    `
+	rows, err := pdb.Executor(ctx, r.db).QueryContext(ctx, q, userID.String(), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]domain.RefreshToken, 0)
+	for rows.Next() {
+		t, scanErr := scanRefreshToken(rows)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
 func (r *RefreshRepo) FindActiveByFingerprint(ctx context.Context, userID domain.UserID, userAgent, ip string, now time.Time) (domain.RefreshToken, bool, error) {
 	r.cleanupStale(ctx, now)
 	const q = `
@@ -182,7 +294,17 @@ func (r *RefreshRepo) FindActiveByFingerprint(ctx context.Context, userID domain
             revoked_at,
             created_at,
             COALESCE(user_agent, ''),
-            COALESCE(ip, '')
+            COALESCE(ip, ''),
+            auth_time,
+            amr,
+            COALESCE(login_method, ''),
+            COALESCE(device_name, ''),
+            last_used_at,
+            COALESCE(last_ip, ''),
+            COALESCE(country, ''),
+            COALESCE(city, ''),
+            COALESCE(client_type, ''),
+            absolute_expires_at
         FROM auth_refresh_tokens
         WHERE user_id = $1::uuid
           AND revoked_at IS NULL
@@ -203,7 +325,7 @@ func (r *RefreshRepo) FindActiveByFingerprint(ctx context.Context, userID domain
 	return t, true, nil
 }
 
-func (r *RefreshRepo) RevokeAllExcept(ctx context.Context, userID domain.UserID, keepIDs []string) error {
+func (r *RefreshRepo) RevokeAllExcept(ctx context.Context, userID domain.UserID, keepIDs []string) ([]string, error) {
 	ids := keepIDs
 	if ids == nil {
 		ids = []string{}
@@ -214,9 +336,49 @@ func (r *RefreshRepo) RevokeAllExcept(ctx context.Context, userID domain.UserID,
         UPDATE auth_refresh_tokens
         SET revoked_at = $3
         WHERE user_id = $1::uuid AND revoked_at IS NULL AND id <> ALL($2::uuid[])
+        RETURNING id
     `
-	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, userID.String(), pq.Array(ids), now)
-	return err
+	rows, err := pdb.Executor(ctx, r.db).QueryContext(ctx, q, userID.String(), pq.Array(ids), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revoked []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		revoked = append(revoked, id)
+	}
+	return revoked, rows.Err()
+}
+
+func (r *RefreshRepo) ListRevoked(ctx context.Context, since time.Time, afterID string, until time.Time, limit int) ([]domain.SessionRevocation, error) {
+	const q = `
+        SELECT id::text, revoked_at
+        FROM auth_refresh_tokens
+        WHERE revoked_at IS NOT NULL AND revoked_at <= $3 AND (revoked_at, id::text) > ($1, $2)
+        ORDER BY revoked_at, id::text
+        LIMIT $4
+    `
+	rows, err := pdb.Executor(ctx, r.db).QueryContext(ctx, q, since, afterID, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revoked []domain.SessionRevocation
+	for rows.Next() {
+		var rev domain.SessionRevocation
+		if err := rows.Scan(&rev.SessionID, &rev.RevokedAt); err != nil {
+			return nil, err
+		}
+		rev.RevokedAt = rev.RevokedAt.UTC()
+		revoked = append(revoked, rev)
+	}
+	return revoked, rows.Err()
 }
 
 func (r *RefreshRepo) cleanupStale(ctx context.Context, now time.Time) {
@@ -238,7 +400,7 @@ type refreshScanner interface {
 
 func scanRefreshToken(scanner refreshScanner) (domain.RefreshToken, error) {
 	var t domain.RefreshToken
-	var revokedAt sql.NullTime
+	var revokedAt, authTime, lastUsedAt, absoluteExpiresAt sql.NullTime
 	var userID string
 
 	err := scanner.Scan(
@@ -250,6 +412,16 @@ func scanRefreshToken(scanner refreshScanner) (domain.RefreshToken, error) {
 		&t.CreatedAt,
 		&t.UserAgent,
 		&t.IP,
+		&authTime,
+		pq.Array(&t.AMR),
+		&t.LoginMethod,
+		&t.DeviceName,
+		&lastUsedAt,
+		&t.LastIP,
+		&t.Country,
+		&t.City,
+		&t.ClientType,
+		&absoluteExpiresAt,
 	)
 	if err != nil {
 		return domain.RefreshToken{}, err
@@ -258,6 +430,29 @@ func scanRefreshToken(scanner refreshScanner) (domain.RefreshToken, error) {
 		v := revokedAt.Time
 		t.RevokedAt = &v
 	}
+	if authTime.Valid {
+		t.AuthTime = authTime.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = lastUsedAt.Time
+	}
+	if absoluteExpiresAt.Valid {
+		t.AbsoluteExpiresAt = absoluteExpiresAt.Time
+	}
 	t.UserID = domain.UserID(userID)
 	return t, nil
 }
+
+func nullIfZeroTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func amrOrEmpty(amr []string) []string {
+	if amr == nil {
+		return []string{}
+	}
+	return amr
+}
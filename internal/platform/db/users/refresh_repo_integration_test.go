@@ -24,15 +24,15 @@ func TestRefreshRepoLifecycle(t *testing.T) {
 	token := domain.NewRefreshTokenRecord("user", "hash", now, time.Hour)
 
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO auth_refresh_tokens")).
-		WithArgs(token.ID, token.UserID.String(), token.TokenHash, token.ExpiresAt, token.RevokedAt, token.CreatedAt, nil, nil).
+		WithArgs(token.ID, token.UserID.String(), token.TokenHash, token.ExpiresAt, token.RevokedAt, token.CreatedAt, nil, nil, token.AuthTime, sqlmock.AnyArg(), nil, nil, token.LastUsedAt, nil, nil, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	if err := repo.Create(context.Background(), token); err != nil {
 		t.Fatalf("create failed: %v", err)
 	}
 
-	rows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at", "user_agent", "ip"}).
-		AddRow(token.ID, token.UserID.String(), token.TokenHash, token.ExpiresAt, nil, token.CreatedAt, "", "")
+	rows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at", "user_agent", "ip", "auth_time", "amr", "login_method", "device_name", "last_used_at", "last_ip", "country", "city", "client_type", "absolute_expires_at"}).
+		AddRow(token.ID, token.UserID.String(), token.TokenHash, token.ExpiresAt, nil, token.CreatedAt, "", "", nil, "{}", "", "", nil, "", "", "", "", nil)
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT\n            id::text,")).
 		WithArgs(token.TokenHash).
 		WillReturnRows(rows)
@@ -45,9 +45,9 @@ func TestRefreshRepoLifecycle(t *testing.T) {
 		t.Fatalf("unexpected token returned")
 	}
 
-	listRows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at", "user_agent", "ip"}).
-		AddRow(token.ID, token.UserID.String(), token.TokenHash, token.ExpiresAt, nil, token.CreatedAt, "agent", "1.1.1.1")
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT\n            id::text,\n            user_id::text,\n            token_hash,\n            expires_at,\n            revoked_at,\n            created_at,\n            COALESCE(user_agent, ''),\n            COALESCE(ip, '')\n        FROM auth_refresh_tokens\n        WHERE user_id = $1::uuid AND revoked_at IS NULL AND expires_at > $2\n        ORDER BY created_at DESC\n        LIMIT 15")).
+	listRows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at", "user_agent", "ip", "auth_time", "amr", "login_method", "device_name", "last_used_at", "last_ip", "country", "city", "client_type", "absolute_expires_at"}).
+		AddRow(token.ID, token.UserID.String(), token.TokenHash, token.ExpiresAt, nil, token.CreatedAt, "agent", "1.1.1.1", token.AuthTime, "{pwd,otp,mfa}", "password", "Work laptop", now.Add(time.Minute), "2.2.2.2", "DE", "Berlin", "mobile", now.Add(24*time.Hour))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT\n            id::text,\n            user_id::text,\n            token_hash,\n            expires_at,\n            revoked_at,\n            created_at,\n            COALESCE(user_agent, ''),\n            COALESCE(ip, ''),\n            auth_time,\n            amr,\n            COALESCE(login_method, ''),\n            COALESCE(device_name, ''),\n            last_used_at,\n            COALESCE(last_ip, ''),\n            COALESCE(country, ''),\n            COALESCE(city, ''),\n            COALESCE(client_type, ''),\n            absolute_expires_at\n        FROM auth_refresh_tokens\n        WHERE user_id = $1::uuid AND revoked_at IS NULL AND expires_at > $2\n        ORDER BY COALESCE(last_used_at, created_at) DESC")).
 		WithArgs(token.UserID.String(), sqlmock.AnyArg()).
 		WillReturnRows(listRows)
 
@@ -55,13 +55,27 @@ func TestRefreshRepoLifecycle(t *testing.T) {
 	if err != nil {
 		t.Fatalf("list failed: %v", err)
 	}
-	if len(tokens) != 1 || tokens[0].UserAgent != "agent" || tokens[0].IP != "1.1.1.1" {
+	if len(tokens) != 1 || tokens[0].UserAgent != "agent" || tokens[0].IP != "1.1.1.1" || !tokens[0].AuthTime.Equal(token.AuthTime) || len(tokens[0].AMR) != 3 {
 		t.Fatalf("unexpected list result: %+v", tokens)
 	}
+	if tokens[0].LoginMethod != "password" || tokens[0].DeviceName != "Work laptop" || !tokens[0].LastUsedAt.Equal(now.Add(time.Minute)) || tokens[0].LastIP != "2.2.2.2" || tokens[0].Country != "DE" || tokens[0].City != "Berlin" || tokens[0].ClientType != "mobile" || !tokens[0].AbsoluteExpiresAt.Equal(now.Add(24*time.Hour)) {
+		t.Fatalf("unexpected list result: %+v", tokens)
+	}
+
+	activeRows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at", "user_agent", "ip", "auth_time", "amr", "login_method", "device_name", "last_used_at", "last_ip", "country", "city", "client_type", "absolute_expires_at"}).
+		AddRow(token.ID, token.UserID.String(), token.TokenHash, token.ExpiresAt, nil, token.CreatedAt, "", "", nil, "{}", "", "", nil, "", "", "", "web", nil)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM auth_refresh_tokens\n        WHERE user_id = $1::uuid AND revoked_at IS NULL AND expires_at > $2\n        ORDER BY created_at ASC")).
+		WithArgs(token.UserID.String(), now).
+		WillReturnRows(activeRows)
+
+	active, err := repo.ListActiveByUser(context.Background(), token.UserID, now)
+	if err != nil || len(active) != 1 || active[0].ClientType != "web" {
+		t.Fatalf("unexpected active sessions: %+v err=%v", active, err)
+	}
 
-	getByIDRows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at", "user_agent", "ip"}).
-		AddRow(token.ID, token.UserID.String(), token.TokenHash, token.ExpiresAt, nil, token.CreatedAt, "", "")
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT\n            id::text,\n            user_id::text,\n            token_hash,\n            expires_at,\n            revoked_at,\n            created_at,\n            COALESCE(user_agent, ''),\n            COALESCE(ip, '')\n        FROM auth_refresh_tokens\n        WHERE id = $1::uuid\n        LIMIT 1")).
+	getByIDRows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at", "user_agent", "ip", "auth_time", "amr", "login_method", "device_name", "last_used_at", "last_ip", "country", "city", "client_type", "absolute_expires_at"}).
+		AddRow(token.ID, token.UserID.String(), token.TokenHash, token.ExpiresAt, nil, token.CreatedAt, "", "", nil, "{}", "", "", nil, "", "", "", "", nil)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT\n            id::text,\n            user_id::text,\n            token_hash,\n            expires_at,\n            revoked_at,\n            created_at,\n            COALESCE(user_agent, ''),\n            COALESCE(ip, ''),\n            auth_time,\n            amr,\n            COALESCE(login_method, ''),\n            COALESCE(device_name, ''),\n            last_used_at,\n            COALESCE(last_ip, ''),\n            COALESCE(country, ''),\n            COALESCE(city, ''),\n            COALESCE(client_type, ''),\n            absolute_expires_at\n        FROM auth_refresh_tokens\n        WHERE id = $1::uuid\n        LIMIT 1")).
 		WithArgs(token.ID).
 		WillReturnRows(getByIDRows)
 
@@ -78,15 +92,34 @@ func TestRefreshRepoLifecycle(t *testing.T) {
 		t.Fatalf("revoke failed: %v", err)
 	}
 
-	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_refresh_tokens
+	otherID := "6f1c1a8e-3f9e-4b55-9a53-8f4b1d2e7c10"
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE auth_refresh_tokens
         SET revoked_at = $3
-        WHERE user_id = $1::uuid AND revoked_at IS NULL AND id <> ALL($2::uuid[])`)).
+        WHERE user_id = $1::uuid AND revoked_at IS NULL AND id <> ALL($2::uuid[])
+        RETURNING id`)).
 		WithArgs(token.UserID.String(), sqlmock.AnyArg(), sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(otherID))
 
-	if err := repo.RevokeAllExcept(context.Background(), token.UserID, []string{token.ID}); err != nil {
+	revoked, err := repo.RevokeAllExcept(context.Background(), token.UserID, []string{token.ID})
+	if err != nil {
 		t.Fatalf("revoke others failed: %v", err)
 	}
+	if len(revoked) != 1 || revoked[0] != otherID {
+		t.Fatalf("expected revoked ids, got %v", revoked)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id::text, revoked_at
+        FROM auth_refresh_tokens
+        WHERE revoked_at IS NOT NULL AND revoked_at <= $3 AND (revoked_at, id::text) > ($1, $2)
+        ORDER BY revoked_at, id::text
+        LIMIT $4`)).
+		WithArgs(now, "", now.Add(time.Hour), 101).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "revoked_at"}).AddRow(otherID, now.Add(time.Minute)))
+
+	feed, err := repo.ListRevoked(context.Background(), now, "", now.Add(time.Hour), 101)
+	if err != nil || len(feed) != 1 || feed[0].SessionID != otherID || !feed[0].RevokedAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected revocation feed: %+v err=%v", feed, err)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("unmet expectations: %v", err)
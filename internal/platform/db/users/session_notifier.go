@@ -0,0 +1,28 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+)
+
+// SessionEventsChannel is the NOTIFY channel carrying ids of revoked or
+// otherwise changed sessions.
+const SessionEventsChannel = "auth_session_events"
+
+// SessionNotifier announces session changes with pg_notify so that every
+// instance drops them from its session cache. Inside a transaction Postgres
+// delivers the notification only on commit.
+type SessionNotifier struct {
+	db *sql.DB
+}
+
+func NewSessionNotifier(db *sql.DB) *SessionNotifier {
+	return &SessionNotifier{db: db}
+}
+
+func (n *SessionNotifier) Notify(ctx context.Context, sessionID string) error {
+	_, err := pdb.Executor(ctx, n.db).ExecContext(ctx, `SELECT pg_notify($1, $2)`, SessionEventsChannel, sessionID)
+	return err
+}
@@ -0,0 +1,84 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+)
+
+// globalEpochID keys the global epoch in auth_token_epochs.
+const globalEpochID = "00000000-0000-0000-0000-000000000000"
+
+type TokenEpochRepo struct {
+	db *sql.DB
+}
+
+func NewTokenEpochRepo(db *sql.DB) *TokenEpochRepo {
+	return &TokenEpochRepo{db: db}
+}
+
+func (r *TokenEpochRepo) Set(ctx context.Context, epoch domain.TokenEpoch) error {
+	const q = `
+        INSERT INTO auth_token_epochs (user_id, not_before, updated_at)
+        VALUES ($1::uuid, $2, NOW())
+        ON CONFLICT (user_id) DO UPDATE
+        SET not_before = GREATEST(auth_token_epochs.not_before, EXCLUDED.not_before),
+            updated_at = NOW()
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, epochKey(epoch.UserID), epoch.NotBefore)
+	return err
+}
+
+func (r *TokenEpochRepo) NotBefore(ctx context.Context, userID domain.UserID) (time.Time, error) {
+	const q = `
+        SELECT MAX(not_before)
+        FROM auth_token_epochs
+        WHERE user_id IN ($1::uuid, $2::uuid)
+    `
+	var notBefore sql.NullTime
+	if err := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, globalEpochID, epochKey(userID)).Scan(&notBefore); err != nil {
+		return time.Time{}, err
+	}
+	if !notBefore.Valid {
+		return time.Time{}, nil
+	}
+	return notBefore.Time.UTC(), nil
+}
+
+func (r *TokenEpochRepo) ListAfter(ctx context.Context, t time.Time) ([]domain.TokenEpoch, error) {
+	const q = `
+        SELECT user_id::text, not_before
+        FROM auth_token_epochs
+        WHERE not_before > $1
+    `
+	rows, err := pdb.Executor(ctx, r.db).QueryContext(ctx, q, t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var epochs []domain.TokenEpoch
+	for rows.Next() {
+		var userID string
+		var epoch domain.TokenEpoch
+		if err := rows.Scan(&userID, &epoch.NotBefore); err != nil {
+			return nil, err
+		}
+		if userID != globalEpochID {
+			epoch.UserID = domain.UserID(userID)
+		}
+		epoch.NotBefore = epoch.NotBefore.UTC()
+		epochs = append(epochs, epoch)
+	}
+	return epochs, rows.Err()
+}
+
+func epochKey(userID domain.UserID) string {
+	if userID == "" {
+		return globalEpochID
+	}
+	return userID.String()
+}
@@ -0,0 +1,63 @@
+//go:build integration
+
+package usersdb
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+)
+
+func TestTokenEpochRepoKeysTheGlobalEpoch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("mock error: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewTokenEpochRepo(db)
+	now := time.Unix(100, 0).UTC()
+	userID := domain.UserID("11111111-1111-1111-1111-111111111111")
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO auth_token_epochs")).
+		WithArgs(globalEpochID, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Set(context.Background(), domain.TokenEpoch{NotBefore: now}); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT MAX(not_before)")).
+		WithArgs(globalEpochID, userID.String()).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(now))
+	notBefore, err := repo.NotBefore(context.Background(), userID)
+	if err != nil || !notBefore.Equal(now) {
+		t.Fatalf("unexpected epoch %v err=%v", notBefore, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT user_id::text, not_before")).
+		WithArgs(now.Add(-time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "not_before"}).
+			AddRow(globalEpochID, now).
+			AddRow(userID.String(), now))
+	epochs, err := repo.ListAfter(context.Background(), now.Add(-time.Hour))
+	if err != nil || len(epochs) != 2 || !epochs[0].Global() || epochs[1].UserID != userID {
+		t.Fatalf("unexpected epochs %+v err=%v", epochs, err)
+	}
+
+	audit := NewAuditLogRepo(db)
+	record := domain.NewAuditRecord(domain.AuditActionTokensInvalidated, "ops", "", "", "incident", map[string]string{"not_before": "x"}, now)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO auth_audit_log")).
+		WithArgs(record.ID, record.Action, "ops", nil, nil, "incident", `{"not_before":"x"}`, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := audit.Record(context.Background(), record); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations: %v", err)
+	}
+}
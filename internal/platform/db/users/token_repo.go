@@ -20,14 +20,14 @@ func NewVerificationTokenRepo(db *sql.DB) *VerificationTokenRepo {
 
 func (r *VerificationTokenRepo) Create(ctx context.Context, token domain.VerificationToken) error {
 	const q = `
-        INSERT INTO auth_verification_tokens (id, identity_id, token_type, token_code, expires_at, used_at, created_at)
+        INSERT INTO auth_verification_tokens (id, identity_id, token_type, token_hash, expires_at, used_at, created_at)
         VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6, $7)
     `
 	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q,
 		token.ID,
 		token.IdentityID,
 		string(token.Type),
-		token.Code,
+		token.CodeHash,
 		token.ExpiresAt,
 		token.UsedAt,
 		token.CreatedAt,
@@ -37,68 +37,95 @@ func (r *VerificationTokenRepo) Create(ctx context.Context, token domain.Verific
 
 func (r *VerificationTokenRepo) GetLatest(ctx context.Context, identityID string, tokenType domain.TokenType) (domain.VerificationToken, bool, error) {
 	const q = `
-        SELECT id::text, identity_id::text, token_type, token_code, expires_at, used_at, created_at
+        SELECT id::text, identity_id::text, token_type, token_hash, expires_at, used_at, created_at
         FROM auth_verification_tokens
         WHERE identity_id = $1::uuid AND token_type = $2
         ORDER BY created_at DESC
         LIMIT 1
     `
-	return r.fetch(ctx, q, identityID, string(tokenType))
+	row := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, identityID, string(tokenType))
+	t, err := scanVerificationToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.VerificationToken{}, false, nil
+	}
+	if err != nil {
+		return domain.VerificationToken{}, false, err
+	}
+	return t, true, nil
 }
 
-func (r *VerificationTokenRepo) GetByID(ctx context.Context, tokenID string) (domain.VerificationToken, bool, error) {
+// GetByCode loads the active candidates for the identity and compares their
+// hashes in Go rather than in SQL, so lookup timing does not depend on how
+// much of the hash matched.
+func (r *VerificationTokenRepo) GetByCode(ctx context.Context, identityID string, tokenType domain.TokenType, codeHash string) (domain.VerificationToken, bool, error) {
 	const q = `
-        SELECT id::text, identity_id::text, token_type, token_code, expires_at, used_at, created_at
+        SELECT id::text, identity_id::text, token_type, token_hash, expires_at, used_at, created_at
         FROM auth_verification_tokens
-        WHERE id = $1::uuid
+        WHERE identity_id = $1::uuid AND token_type = $2 AND used_at IS NULL AND expires_at > $3
+        ORDER BY created_at DESC
+        LIMIT 10
     `
-	return r.fetch(ctx, q, tokenID)
+	rows, err := pdb.Executor(ctx, r.db).QueryContext(ctx, q, identityID, string(tokenType), time.Now().UTC())
+	if err != nil {
+		return domain.VerificationToken{}, false, err
+	}
+	defer rows.Close()
+
+	var (
+		match domain.VerificationToken
+		found bool
+	)
+	for rows.Next() {
+		t, scanErr := scanVerificationToken(rows)
+		if scanErr != nil {
+			return domain.VerificationToken{}, false, scanErr
+		}
+		// Keep scanning after a match so every candidate costs the same.
+		if t.MatchesHash(codeHash) && !found {
+			match = t
+			found = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return domain.VerificationToken{}, false, err
+	}
+	return match, found, nil
 }
 
-func (r *VerificationTokenRepo) GetByCode(ctx context.Context, identityID string, tokenType domain.TokenType, code string) (domain.VerificationToken, bool, error) {
+func (r *VerificationTokenRepo) MarkUsed(ctx context.Context, tokenID string, usedAt time.Time) error {
 	const q = `
-        SELECT id::text, identity_id::text, token_type, token_code, expires_at, used_at, created_at
-        FROM auth_verification_tokens
-        WHERE identity_id = $1::uuid AND token_type = $2 AND token_code = $3
-        ORDER BY created_at DESC
-        LIMIT 1
+        UPDATE auth_verification_tokens
+        SET used_at = $2
+        WHERE id = $1::uuid
     `
-	return r.fetch(ctx, q, identityID, string(tokenType), code)
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, tokenID, usedAt)
+	return err
+}
+
+type verificationTokenScanner interface {
+	Scan(dest ...any) error
 }
 
-func (r *VerificationTokenRepo) fetch(ctx context.Context, query string, args ...any) (domain.VerificationToken, bool, error) {
+func scanVerificationToken(scanner verificationTokenScanner) (domain.VerificationToken, error) {
 	var t domain.VerificationToken
 	var usedAt sql.NullTime
-	err := pdb.Executor(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(
+	err := scanner.Scan(
 		&t.ID,
 		&t.IdentityID,
 		&t.Type,
-		&t.Code,
+		&t.CodeHash,
 		&t.ExpiresAt,
 		&usedAt,
 		&t.CreatedAt,
 	)
-	if errors.Is(err, sql.ErrNoRows) {
-		return domain.VerificationToken{}, false, nil
-	}
 	if err != nil {
-		return domain.VerificationToken{}, false, err
+		return domain.VerificationToken{}, err
 	}
 	if usedAt.Valid {
 		v := usedAt.Time
 		t.UsedAt = &v
 	}
-	return t, true, nil
-}
-
-func (r *VerificationTokenRepo) MarkUsed(ctx context.Context, tokenID string, usedAt time.Time) error {
-	const q = `
-        UPDATE auth_verification_tokens
-        SET used_at = $2
-        WHERE id = $1::uuid
-    `
-	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, tokenID, usedAt)
-	return err
+	return t, nil
 }
 
 var _ domain.VerificationTokenRepository = (*VerificationTokenRepo)(nil)
@@ -0,0 +1,142 @@
+package usersdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	pdb "github.com/vaaxooo/xbackend/internal/platform/db"
+)
+
+type TrustedDeviceRepo struct {
+	db *sql.DB
+}
+
+func NewTrustedDeviceRepo(db *sql.DB) *TrustedDeviceRepo {
+	return &TrustedDeviceRepo{db: db}
+}
+
+func (r *TrustedDeviceRepo) Create(ctx context.Context, d domain.TrustedDevice) error {
+	const q = `
+        INSERT INTO auth_trusted_devices (id, user_id, token_hash, user_agent, ip, created_at, expires_at)
+        VALUES ($1::uuid, $2::uuid, $3, $4, $5, $6, $7)
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q,
+		d.ID,
+		d.UserID.String(),
+		d.TokenHash,
+		nullIfEmpty(d.UserAgent),
+		nullIfEmpty(d.IP),
+		d.CreatedAt,
+		d.ExpiresAt,
+	)
+	return err
+}
+
+func (r *TrustedDeviceRepo) GetByHash(ctx context.Context, userID domain.UserID, tokenHash string) (domain.TrustedDevice, bool, error) {
+	const q = `
+        SELECT id::text, user_id::text, token_hash, COALESCE(user_agent, ''), COALESCE(ip, ''), created_at, expires_at, last_used_at, revoked_at
+        FROM auth_trusted_devices
+        WHERE user_id = $1::uuid AND token_hash = $2
+        LIMIT 1
+    `
+	row := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, userID.String(), tokenHash)
+	d, err := scanTrustedDevice(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.TrustedDevice{}, false, nil
+	}
+	if err != nil {
+		return domain.TrustedDevice{}, false, err
+	}
+	return d, true, nil
+}
+
+func (r *TrustedDeviceRepo) GetByID(ctx context.Context, id string) (domain.TrustedDevice, bool, error) {
+	const q = `
+        SELECT id::text, user_id::text, token_hash, COALESCE(user_agent, ''), COALESCE(ip, ''), created_at, expires_at, last_used_at, revoked_at
+        FROM auth_trusted_devices
+        WHERE id = $1::uuid
+        LIMIT 1
+    `
+	row := pdb.Executor(ctx, r.db).QueryRowContext(ctx, q, id)
+	d, err := scanTrustedDevice(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.TrustedDevice{}, false, nil
+	}
+	if err != nil {
+		return domain.TrustedDevice{}, false, err
+	}
+	return d, true, nil
+}
+
+func (r *TrustedDeviceRepo) ListByUser(ctx context.Context, userID domain.UserID) ([]domain.TrustedDevice, error) {
+	const q = `
+        SELECT id::text, user_id::text, token_hash, COALESCE(user_agent, ''), COALESCE(ip, ''), created_at, expires_at, last_used_at, revoked_at
+        FROM auth_trusted_devices
+        WHERE user_id = $1::uuid AND revoked_at IS NULL AND expires_at > $2
+        ORDER BY created_at DESC
+        LIMIT 50
+    `
+	rows, err := pdb.Executor(ctx, r.db).QueryContext(ctx, q, userID.String(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := make([]domain.TrustedDevice, 0)
+	for rows.Next() {
+		d, scanErr := scanTrustedDevice(rows)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		devices = append(devices, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (r *TrustedDeviceRepo) Touch(ctx context.Context, id string, usedAt time.Time) error {
+	const q = `
+        UPDATE auth_trusted_devices
+        SET last_used_at = $2
+        WHERE id = $1::uuid
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, id, usedAt)
+	return err
+}
+
+func (r *TrustedDeviceRepo) Revoke(ctx context.Context, id string) error {
+	const q = `
+        UPDATE auth_trusted_devices
+        SET revoked_at = $2
+        WHERE id = $1::uuid AND revoked_at IS NULL
+    `
+	_, err := pdb.Executor(ctx, r.db).ExecContext(ctx, q, id, time.Now().UTC())
+	return err
+}
+
+func scanTrustedDevice(scanner refreshScanner) (domain.TrustedDevice, error) {
+	var d domain.TrustedDevice
+	var userID string
+	var lastUsedAt, revokedAt sql.NullTime
+
+	if err := scanner.Scan(&d.ID, &userID, &d.TokenHash, &d.UserAgent, &d.IP, &d.CreatedAt, &d.ExpiresAt, &lastUsedAt, &revokedAt); err != nil {
+		return domain.TrustedDevice{}, err
+	}
+	d.UserID = domain.UserID(userID)
+	if lastUsedAt.Valid {
+		v := lastUsedAt.Time
+		d.LastUsedAt = &v
+	}
+	if revokedAt.Valid {
+		v := revokedAt.Time
+		d.RevokedAt = &v
+	}
+	return d, nil
+}
+
+var _ domain.TrustedDeviceRepository = (*TrustedDeviceRepo)(nil)
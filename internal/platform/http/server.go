@@ -29,6 +29,10 @@ func NewServer(cfg ServerConfig, handler http.Handler) *Server {
 		cfg.MaxHeaderBytes = 1 << 20 // 1 MB
 	}
 
+	// Long-lived responses (event streams) watch the request context; it is
+	// cancelled when shutdown begins so they do not hold the server open.
+	base, cancel := context.WithCancel(context.Background())
+
 	srv := &http.Server{
 		Addr:              cfg.Addr,
 		Handler:           handler,
@@ -41,9 +45,10 @@ func NewServer(cfg ServerConfig, handler http.Handler) *Server {
 		// BaseContext sets the base context for incoming requests.
 		// It helps to tie request contexts to a predictable root context.
 		BaseContext: func(_ net.Listener) context.Context {
-			return context.Background()
+			return base
 		},
 	}
+	srv.RegisterOnShutdown(cancel)
 
 	return &Server{srv: srv}
 }
@@ -25,9 +25,11 @@ func (f UseCaseFunc[Cmd, Resp]) Handle(ctx context.Context, cmd Cmd) (Resp, erro
 }
 
 // UseCaseMiddleware enriches the request context with deadlines and metadata
-// before invoking the application layer.
+// before invoking the application layer. Geo, when set, adds the location
+// of the client IP to the metadata.
 type UseCaseMiddleware struct {
 	Timeout time.Duration
+	Geo     common.GeoLocator
 }
 
 func HandleUseCase[Cmd any, Resp any](m UseCaseMiddleware, r *http.Request, handler UseCaseHandler[Cmd, Resp], cmd Cmd) (Resp, error) {
@@ -36,14 +38,26 @@ func HandleUseCase[Cmd any, Resp any](m UseCaseMiddleware, r *http.Request, hand
 		defer cancel()
 	}
 
-	ctx = common.WithRequestMeta(ctx, common.RequestMeta{
-		UserAgent: r.UserAgent(),
-		IP:        clientIP(r),
-	})
+	ctx = common.WithRequestMeta(ctx, m.requestMeta(r))
 
 	return handler.Handle(ctx, cmd)
 }
 
+func (m UseCaseMiddleware) requestMeta(r *http.Request) common.RequestMeta {
+	meta := common.RequestMeta{
+		UserAgent:  r.UserAgent(),
+		IP:         clientIP(r),
+		ClientType: r.Header.Get("X-Client-Type"),
+	}
+	if m.Geo != nil && meta.IP != "" {
+		if loc, ok := m.Geo.Locate(meta.IP); ok {
+			meta.Country = loc.Country
+			meta.City = loc.City
+		}
+	}
+	return meta
+}
+
 func (m UseCaseMiddleware) contextWithTimeout(r *http.Request) (context.Context, context.CancelFunc) {
 	ctx := r.Context()
 
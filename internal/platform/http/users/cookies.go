@@ -0,0 +1,150 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// authModeHeader selects how a client receives its refresh token. Clients
+// sending "cookie" get it in an HttpOnly cookie and send it back the same
+// way; everyone else keeps getting it in JSON bodies.
+const (
+	authModeHeader = "X-Auth-Mode"
+	authModeCookie = "cookie"
+	csrfHeader     = "X-CSRF-Token"
+)
+
+// CookieConfig enables the cookie mode for browser clients. Name is the
+// HttpOnly refresh token cookie, scoped to Path; CSRFName is a readable
+// cookie the client echoes in the X-CSRF-Token header (double submit).
+// Requests with an Origin must come from TrustedOrigins or the API's own
+// host. The cookie lives as long as the refresh token it carries; MaxAge is
+// only used when a response does not say when that is.
+type CookieConfig struct {
+	Enabled        bool
+	Name           string
+	CSRFName       string
+	Domain         string
+	Path           string
+	SameSite       http.SameSite
+	Secure         bool
+	MaxAge         time.Duration
+	TrustedOrigins []string
+}
+
+type tokenCookies struct {
+	cfg     CookieConfig
+	origins map[string]struct{}
+}
+
+func newTokenCookies(cfg CookieConfig) tokenCookies {
+	if cfg.Name == "" {
+		cfg.Name = "refresh_token"
+	}
+	if cfg.CSRFName == "" {
+		cfg.CSRFName = "csrf_token"
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.SameSite == 0 {
+		cfg.SameSite = http.SameSiteStrictMode
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 30 * 24 * time.Hour
+	}
+	origins := make(map[string]struct{}, len(cfg.TrustedOrigins))
+	for _, o := range cfg.TrustedOrigins {
+		if o = normalizeOrigin(o); o != "" {
+			origins[o] = struct{}{}
+		}
+	}
+	return tokenCookies{cfg: cfg, origins: origins}
+}
+
+// requested reports whether the client asked for the cookie mode.
+func (c tokenCookies) requested(r *http.Request) bool {
+	return c.cfg.Enabled && strings.EqualFold(r.Header.Get(authModeHeader), authModeCookie)
+}
+
+// refreshToken returns the refresh token cookie of a cookie mode request.
+func (c tokenCookies) refreshToken(r *http.Request) string {
+	if !c.requested(r) {
+		return ""
+	}
+	cookie, err := r.Cookie(c.cfg.Name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// checkCSRF guards requests authenticated by the refresh token cookie: the
+// Origin, when sent, must be trusted and the CSRF header must match the
+// CSRF cookie.
+func (c tokenCookies) checkCSRF(r *http.Request) bool {
+	if origin := r.Header.Get("Origin"); origin != "" && !c.trustedOrigin(r, origin) {
+		return false
+	}
+	cookie, err := r.Cookie(c.cfg.CSRFName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(csrfHeader))) == 1
+}
+
+func (c tokenCookies) trustedOrigin(r *http.Request, origin string) bool {
+	origin = normalizeOrigin(origin)
+	if _, ok := c.origins[origin]; ok {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// set stores the refresh token and a fresh CSRF token and returns the
+// latter. A zero expiresAt uses MaxAge.
+func (c tokenCookies) set(w http.ResponseWriter, refreshToken string, expiresAt time.Time) string {
+	csrf := rand.Text()
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(c.cfg.MaxAge)
+	}
+	http.SetCookie(w, c.cookie(c.cfg.Name, refreshToken, c.cfg.Path, true, expiresAt))
+	// The CSRF cookie is read by scripts on any page, so it is not limited
+	// to the API path.
+	http.SetCookie(w, c.cookie(c.cfg.CSRFName, csrf, "/", false, expiresAt))
+	return csrf
+}
+
+// clear expires both cookies.
+func (c tokenCookies) clear(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie(c.cfg.Name, "", c.cfg.Path, true, time.Time{}))
+	http.SetCookie(w, c.cookie(c.cfg.CSRFName, "", "/", false, time.Time{}))
+}
+
+func (c tokenCookies) cookie(name, value, path string, httpOnly bool, expiresAt time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.cfg.Domain,
+		Secure:   c.cfg.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.cfg.SameSite,
+	}
+	if expiresAt.IsZero() {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Expires = expiresAt.UTC()
+		cookie.MaxAge = int(time.Until(expiresAt).Seconds())
+	}
+	return cookie
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.TrimRight(strings.TrimSpace(origin), "/")
+}
@@ -12,6 +12,8 @@ type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	OTP      string `json:"otp_code"`
+	// DeviceToken may also be sent in the X-Device-Token header.
+	DeviceToken string `json:"device_token"`
 }
 
 type TelegramLoginRequest struct {
@@ -26,9 +28,20 @@ type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// TokensResponse carries issued tokens. In cookie mode RefreshToken is
+// empty and CSRFToken holds the value to echo in X-CSRF-Token.
 type TokensResponse struct {
 	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"`
+}
+
+// RefreshResponse tells, next to the new tokens, when the refresh token
+// lapses unless used and when the session ends and needs a new login.
+type RefreshResponse struct {
+	TokensResponse
+	RefreshExpiresAt time.Time  `json:"refresh_expires_at"`
+	ReloginAt        *time.Time `json:"relogin_at,omitempty"`
 }
 
 type ConfirmEmailRequest struct {
@@ -40,6 +53,29 @@ type PasswordResetRequest struct {
 	Email string `json:"email"`
 }
 
+type RecoveryStartRequest struct {
+	Email string `json:"email"`
+}
+
+type RecoveryConfirmRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Code        string `json:"code"`
+}
+
+type RecoveryCancelRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Token       string `json:"token"`
+}
+
+type RecoveryResponse struct {
+	ChallengeID  string     `json:"challenge_id"`
+	Status       string     `json:"status"`
+	ExpiresIn    int64      `json:"expires_in"`
+	AttemptsLeft int        `json:"attempts_left,omitempty"`
+	LockUntil    *time.Time `json:"lock_until,omitempty"`
+	ReadyAt      *time.Time `json:"ready_at,omitempty"`
+}
+
 type PasswordResetConfirmRequest struct {
 	Email    string `json:"email"`
 	Token    string `json:"token"`
@@ -79,7 +115,8 @@ type LoginSettingsResponse struct {
 type LoginResponse struct {
 	UserProfileResponse
 	TokensResponse
-	Challenge *ChallengeResponse `json:"challenge,omitempty"`
+	Challenge   *ChallengeResponse `json:"challenge,omitempty"`
+	DeviceToken string             `json:"device_token,omitempty"`
 }
 
 type ChallengeResponse struct {
@@ -92,6 +129,36 @@ type ChallengeResponse struct {
 	MaskedEmail    string     `json:"masked_email,omitempty"`
 	AttemptsLeft   int        `json:"attempts_left,omitempty"`
 	LockUntil      *time.Time `json:"lock_until,omitempty"`
+	// Steps reports attempt and lock state per step that has been tried.
+	Steps []ChallengeStepState `json:"steps,omitempty"`
+}
+
+type ChallengeStepState struct {
+	Step         string     `json:"step"`
+	AttemptsLeft int        `json:"attempts_left"`
+	LockUntil    *time.Time `json:"lock_until,omitempty"`
+}
+
+// ChallengeEvent is the data of an event on GET /auth/challenge/{id}/events.
+type ChallengeEvent struct {
+	Status         string               `json:"status"`
+	RequiredSteps  []string             `json:"required_steps"`
+	CompletedSteps []string             `json:"completed_steps"`
+	ExpiresIn      int64                `json:"expires_in"`
+	Steps          []ChallengeStepState `json:"steps,omitempty"`
+}
+
+// ChallengeStepRequest is the body of POST /auth/challenge/{id}/steps/{step}.
+type ChallengeStepRequest struct {
+	Value       string `json:"value"`
+	TrustDevice bool   `json:"trust_device"`
+}
+
+// StepUpResponse is returned once a step-up challenge is completed. The
+// session and its refresh token stay the same.
+type StepUpResponse struct {
+	Status      string `json:"status"`
+	AccessToken string `json:"access_token"`
 }
 
 type ChallengeRequest struct {
@@ -101,9 +168,57 @@ type ChallengeRequest struct {
 type ChallengeTOTPRequest struct {
 	ChallengeID string `json:"challenge_id"`
 	Code        string `json:"otp_code"`
+	TrustDevice bool   `json:"trust_device"`
 }
 
 type ChallengeConfirmEmailRequest struct {
 	ChallengeID string `json:"challenge_id"`
 	Token       string `json:"token"`
+	TrustDevice bool   `json:"trust_device"`
+}
+
+type ChallengeEmailOTPRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Code        string `json:"code"`
+	TrustDevice bool   `json:"trust_device"`
+}
+
+type ChallengeCaptchaRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Token       string `json:"captcha_token"`
+}
+
+// QRLoginStartResponse is shown by the desktop: QRCode is rendered as the
+// QR code, while ChallengeID and LoginToken stay with the desktop to pick
+// up its session.
+type QRLoginStartResponse struct {
+	ChallengeID string `json:"challenge_id"`
+	QRCode      string `json:"qr_code"`
+	LoginToken  string `json:"login_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// QRLoginScanRequest is sent by the mobile app for the signed in user: the
+// scanned code and, once the user was shown the desktop, their answer
+// (approve or deny).
+type QRLoginScanRequest struct {
+	QRCode  string `json:"qr_code"`
+	Consent string `json:"consent"`
+}
+
+// QRLoginScanResponse describes the desktop waiting for the user; Status is
+// pending until the user answers, then completed or cancelled.
+type QRLoginScanResponse struct {
+	Status      string    `json:"status"`
+	IP          string    `json:"ip,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	City        string    `json:"city,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// QRLoginSessionRequest is the long poll of the desktop for its session.
+type QRLoginSessionRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	LoginToken  string `json:"login_token"`
 }
@@ -0,0 +1,183 @@
+package dto
+
+import "time"
+
+// OAuthTokenResponse follows RFC 6749 section 5.1; ExpiresIn is in seconds.
+// Grants that sign a user in add RefreshToken, and IDToken when redeeming
+// an authorization code.
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// OAuthErrorResponse is the error body of the OAuth endpoints (RFC 6749
+// section 5.2), which differs from the rest of the API.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// IntrospectResponse follows RFC 7662 section 2.2: inactive tokens only
+// report active false. Times are seconds since the epoch; sid is the
+// session of user tokens.
+type IntrospectResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+// DeviceAuthorizationResponse follows RFC 8628 section 3.2; ExpiresIn and
+// Interval are in seconds.
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// VerifyDeviceRequest is sent by the verification page for the signed in
+// user: the code the device shows and, once the user was shown the device,
+// their answer (approve or deny).
+type VerifyDeviceRequest struct {
+	UserCode string `json:"user_code"`
+	Consent  string `json:"consent"`
+}
+
+// VerifyDeviceResponse describes the device waiting for the user; Status
+// is pending until the user answers, then approved or denied.
+type VerifyDeviceResponse struct {
+	Status      string    `json:"status"`
+	ClientID    string    `json:"client_id"`
+	ClientName  string    `json:"client_name"`
+	IP          string    `json:"ip,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	City        string    `json:"city,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// RegisterClientRequest registers an OAuth client. AuthMethod is
+// client_secret (default), private_key_jwt, which needs the PEM encoded
+// PublicKey, or none for public clients. Clients that sign users in list
+// their RedirectURIs.
+type RegisterClientRequest struct {
+	Name         string   `json:"name"`
+	AuthMethod   string   `json:"auth_method"`
+	PublicKey    string   `json:"public_key"`
+	Scopes       []string `json:"scopes"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+type OAuthClientResponse struct {
+	ClientID     string     `json:"client_id"`
+	Name         string     `json:"name"`
+	AuthMethod   string     `json:"auth_method"`
+	Scopes       []string   `json:"scopes"`
+	RedirectURIs []string   `json:"redirect_uris,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+}
+
+// RegisterClientResponse carries the client secret, shown only once.
+type RegisterClientResponse struct {
+	ClientSecret string `json:"client_secret,omitempty"`
+	OAuthClientResponse
+}
+
+type OAuthClientsResponse struct {
+	Clients []OAuthClientResponse `json:"clients"`
+}
+
+type DisableClientRequest struct {
+	ClientID string `json:"client_id"`
+}
+
+// AuthorizeRequest is sent by the login page for the signed in user: the
+// parameters of the client's authorization request, unchanged, and the
+// user's answer on the consent screen (approve or deny) once shown.
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Prompt              string `json:"prompt"`
+	MaxAge              string `json:"max_age"`
+	Consent             string `json:"consent"`
+}
+
+// AuthorizeResponse tells the login page what to do: follow RedirectTo
+// (redirect), show the consent screen (consent_required) or have the user
+// authenticate again (login_required).
+type AuthorizeResponse struct {
+	Status     string           `json:"status"`
+	RedirectTo string           `json:"redirect_to,omitempty"`
+	Consent    *ConsentResponse `json:"consent,omitempty"`
+}
+
+type ConsentResponse struct {
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name"`
+	Scopes     []string `json:"scopes"`
+}
+
+// UserInfoResponse holds the standard claims of OpenID Connect Core
+// section 5.1 released by the granted scopes.
+type UserInfoResponse struct {
+	Subject       string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	MiddleName    string `json:"middle_name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// ProviderMetadataResponse is the OpenID Connect discovery document.
+type ProviderMetadataResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type JSONWebKeyResponse struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+type JSONWebKeySetResponse struct {
+	Keys []JSONWebKeyResponse `json:"keys"`
+}
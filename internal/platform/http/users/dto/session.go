@@ -3,13 +3,23 @@ package dto
 import "time"
 
 type SessionResponse struct {
-	ID        string     `json:"id"`
-	UserAgent string     `json:"user_agent"`
-	IP        string     `json:"ip"`
-	CreatedAt time.Time  `json:"created_at"`
-	ExpiresAt time.Time  `json:"expires_at"`
-	RevokedAt *time.Time `json:"revoked_at,omitempty"`
-	Current   bool       `json:"current"`
+	ID          string     `json:"id"`
+	UserAgent   string     `json:"user_agent"`
+	Browser     string     `json:"browser,omitempty"`
+	OS          string     `json:"os,omitempty"`
+	DeviceType  string     `json:"device_type"`
+	ClientType  string     `json:"client_type,omitempty"`
+	DeviceName  string     `json:"device_name,omitempty"`
+	LoginMethod string     `json:"login_method,omitempty"`
+	IP          string     `json:"ip"`
+	Country     string     `json:"country,omitempty"`
+	City        string     `json:"city,omitempty"`
+	LastIP      string     `json:"last_ip"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  time.Time  `json:"last_used_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	Current     bool       `json:"current"`
 }
 
 type SessionsResponse struct {
@@ -20,6 +30,96 @@ type RevokeSessionRequest struct {
 	SessionID string `json:"session_id"`
 }
 
+type RenameSessionRequest struct {
+	SessionID string `json:"session_id"`
+	Name      string `json:"name"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type RevokeOtherSessionsRequest struct {
 	CurrentRefreshToken string `json:"current_refresh_token"`
 }
+
+type RevocationResponse struct {
+	SessionID string    `json:"session_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// InvalidateTokensRequest starts a new token epoch; an empty UserID
+// invalidates the tokens of everyone.
+type InvalidateTokensRequest struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+// TokenEpochResponse is a token epoch; user_id is omitted for the global
+// one.
+type TokenEpochResponse struct {
+	UserID    string    `json:"user_id,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+}
+
+// RevocationsResponse is a page of the revocation feed. TTL is how many
+// seconds after revoked_at an entry still matters. Access tokens issued
+// before not_before, or before their user's entry in user_epochs, are
+// invalid.
+type RevocationsResponse struct {
+	Revocations []RevocationResponse `json:"revocations"`
+	NextCursor  string               `json:"next_cursor"`
+	HasMore     bool                 `json:"has_more"`
+	TTL         int64                `json:"ttl"`
+	NotBefore   *time.Time           `json:"not_before,omitempty"`
+	UserEpochs  []TokenEpochResponse `json:"user_epochs"`
+}
+
+type TrustedDeviceResponse struct {
+	ID         string     `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type TrustedDevicesResponse struct {
+	Devices []TrustedDeviceResponse `json:"devices"`
+}
+
+type RevokeTrustedDeviceRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+// CreateAccessTokenRequest asks for a personal access token. ExpiresInDays
+// defaults to 30.
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type AccessTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateAccessTokenResponse carries the token itself, shown only here.
+type CreateAccessTokenResponse struct {
+	Token string `json:"token"`
+	AccessTokenResponse
+}
+
+type AccessTokensResponse struct {
+	Tokens []AccessTokenResponse `json:"tokens"`
+}
+
+type RevokeAccessTokenRequest struct {
+	TokenID string `json:"token_id"`
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/link"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/login"
@@ -21,6 +26,7 @@ import (
 
 type Handler struct {
 	middleware phttp.UseCaseMiddleware
+	cookies    tokenCookies
 
 	register              phttp.UseCaseHandler[usersapi.RegisterInput, login.Output]
 	login                 phttp.UseCaseHandler[usersapi.LoginInput, login.Output]
@@ -39,6 +45,20 @@ type Handler struct {
 	challengeVerifyTOTP   phttp.UseCaseHandler[usersapi.ChallengeVerifyTOTPInput, login.Output]
 	challengeResendEmail  phttp.UseCaseHandler[usersapi.ChallengeResendEmailInput, login.Output]
 	challengeConfirmEmail phttp.UseCaseHandler[usersapi.ChallengeConfirmEmailInput, login.Output]
+	challengeEmailOTP     phttp.UseCaseHandler[usersapi.ChallengeVerifyEmailOTPInput, login.Output]
+	challengeCaptcha      phttp.UseCaseHandler[usersapi.ChallengeVerifyCaptchaInput, login.Output]
+	challengeStep         phttp.UseCaseHandler[usersapi.ChallengeVerifyStepInput, login.Output]
+	challengeWatch        phttp.UseCaseHandler[usersapi.ChallengeWatchInput, <-chan usersapi.ChallengeEvent]
+	// heartbeat is how often an idle event stream sends a comment line.
+	heartbeat time.Duration
+
+	recoveryStart    phttp.UseCaseHandler[usersapi.RecoveryStartInput, usersapi.RecoveryOutput]
+	recoveryConfirm  phttp.UseCaseHandler[usersapi.RecoveryConfirmInput, usersapi.RecoveryOutput]
+	recoveryCancel   phttp.UseCaseHandler[usersapi.RecoveryCancelInput, struct{}]
+	recoveryComplete phttp.UseCaseHandler[usersapi.RecoveryCompleteInput, usersapi.RecoveryOutput]
+
+	stepUpStart  phttp.UseCaseHandler[usersapi.StepUpStartInput, login.Output]
+	stepUpVerify phttp.UseCaseHandler[usersapi.StepUpVerifyInput, login.Output]
 
 	getMe          phttp.UseCaseHandler[usersapi.GetProfileInput, profile.Output]
 	update         phttp.UseCaseHandler[usersapi.UpdateProfileInput, profile.Output]
@@ -47,12 +67,43 @@ type Handler struct {
 
 	listSessions       phttp.UseCaseHandler[usersapi.ListSessionsInput, usersapi.SessionsOutput]
 	revokeSession      phttp.UseCaseHandler[usersapi.RevokeSessionInput, struct{}]
+	renameSession      phttp.UseCaseHandler[usersapi.RenameSessionInput, usersapi.Session]
 	revokeOtherSession phttp.UseCaseHandler[usersapi.RevokeOtherSessionsInput, struct{}]
+	logout             phttp.UseCaseHandler[usersapi.LogoutInput, struct{}]
+	logoutAll          phttp.UseCaseHandler[usersapi.LogoutAllInput, struct{}]
+	revocations        phttp.UseCaseHandler[usersapi.RevocationFeedInput, usersapi.RevocationFeedOutput]
+	invalidateTokens   phttp.UseCaseHandler[usersapi.InvalidateTokensInput, usersapi.TokenEpochOutput]
+
+	listDevices  phttp.UseCaseHandler[usersapi.ListTrustedDevicesInput, usersapi.TrustedDevicesOutput]
+	revokeDevice phttp.UseCaseHandler[usersapi.RevokeTrustedDeviceInput, struct{}]
+
+	createAccessToken phttp.UseCaseHandler[usersapi.CreateAccessTokenInput, usersapi.CreateAccessTokenOutput]
+	listAccessTokens  phttp.UseCaseHandler[usersapi.ListAccessTokensInput, usersapi.AccessTokensOutput]
+	revokeAccessToken phttp.UseCaseHandler[usersapi.RevokeAccessTokenInput, struct{}]
+
+	registerClient phttp.UseCaseHandler[usersapi.RegisterClientInput, usersapi.RegisterClientOutput]
+	listClients    phttp.UseCaseHandler[usersapi.ListClientsInput, usersapi.ClientsOutput]
+	disableClient  phttp.UseCaseHandler[usersapi.DisableClientInput, struct{}]
+	clientToken    phttp.UseCaseHandler[usersapi.ClientTokenInput, usersapi.ClientTokenOutput]
+
+	startAuthorization phttp.UseCaseHandler[usersapi.StartAuthorizationInput, usersapi.AuthorizationRedirect]
+	authorize          phttp.UseCaseHandler[usersapi.AuthorizeInput, usersapi.AuthorizeOutput]
+	userInfo           phttp.UseCaseHandler[usersapi.UserInfoInput, usersapi.UserInfoOutput]
+	providerMetadata   phttp.UseCaseHandler[usersapi.ProviderMetadataInput, usersapi.ProviderMetadata]
+	providerKeys       phttp.UseCaseHandler[usersapi.ProviderKeysInput, usersapi.ProviderKeySet]
+	introspectToken    phttp.UseCaseHandler[usersapi.IntrospectTokenInput, usersapi.IntrospectTokenOutput]
+	revokeToken        phttp.UseCaseHandler[usersapi.RevokeTokenInput, struct{}]
+	startDevice        phttp.UseCaseHandler[usersapi.DeviceAuthorizationInput, usersapi.DeviceAuthorizationOutput]
+	verifyDevice       phttp.UseCaseHandler[usersapi.VerifyDeviceInput, usersapi.VerifyDeviceOutput]
+	startQRLogin       phttp.UseCaseHandler[usersapi.StartQRLoginInput, usersapi.StartQRLoginOutput]
+	scanQRLogin        phttp.UseCaseHandler[usersapi.ScanQRLoginInput, usersapi.ScanQRLoginOutput]
+	qrLoginSession     phttp.UseCaseHandler[usersapi.QRLoginSessionInput, login.Output]
 }
 
 func NewHandler(svc usersapi.Service, middleware phttp.UseCaseMiddleware) *Handler {
 	return &Handler{
 		middleware: middleware,
+		heartbeat:  15 * time.Second,
 		register: phttp.UseCaseFunc[usersapi.RegisterInput, login.Output](func(ctx context.Context, cmd usersapi.RegisterInput) (login.Output, error) {
 			return svc.Register(ctx, cmd)
 		}),
@@ -104,6 +155,36 @@ func NewHandler(svc usersapi.Service, middleware phttp.UseCaseMiddleware) *Handl
 		challengeConfirmEmail: phttp.UseCaseFunc[usersapi.ChallengeConfirmEmailInput, login.Output](func(ctx context.Context, cmd usersapi.ChallengeConfirmEmailInput) (login.Output, error) {
 			return svc.ConfirmChallengeEmail(ctx, cmd)
 		}),
+		challengeEmailOTP: phttp.UseCaseFunc[usersapi.ChallengeVerifyEmailOTPInput, login.Output](func(ctx context.Context, cmd usersapi.ChallengeVerifyEmailOTPInput) (login.Output, error) {
+			return svc.VerifyChallengeEmailOTP(ctx, cmd)
+		}),
+		challengeCaptcha: phttp.UseCaseFunc[usersapi.ChallengeVerifyCaptchaInput, login.Output](func(ctx context.Context, cmd usersapi.ChallengeVerifyCaptchaInput) (login.Output, error) {
+			return svc.VerifyChallengeCaptcha(ctx, cmd)
+		}),
+		challengeStep: phttp.UseCaseFunc[usersapi.ChallengeVerifyStepInput, login.Output](func(ctx context.Context, cmd usersapi.ChallengeVerifyStepInput) (login.Output, error) {
+			return svc.VerifyChallengeStep(ctx, cmd)
+		}),
+		challengeWatch: phttp.UseCaseFunc[usersapi.ChallengeWatchInput, <-chan usersapi.ChallengeEvent](func(ctx context.Context, cmd usersapi.ChallengeWatchInput) (<-chan usersapi.ChallengeEvent, error) {
+			return svc.WatchChallenge(ctx, cmd)
+		}),
+		stepUpStart: phttp.UseCaseFunc[usersapi.StepUpStartInput, login.Output](func(ctx context.Context, cmd usersapi.StepUpStartInput) (login.Output, error) {
+			return svc.StartStepUp(ctx, cmd)
+		}),
+		stepUpVerify: phttp.UseCaseFunc[usersapi.StepUpVerifyInput, login.Output](func(ctx context.Context, cmd usersapi.StepUpVerifyInput) (login.Output, error) {
+			return svc.VerifyStepUp(ctx, cmd)
+		}),
+		recoveryStart: phttp.UseCaseFunc[usersapi.RecoveryStartInput, usersapi.RecoveryOutput](func(ctx context.Context, cmd usersapi.RecoveryStartInput) (usersapi.RecoveryOutput, error) {
+			return svc.StartRecovery(ctx, cmd)
+		}),
+		recoveryConfirm: phttp.UseCaseFunc[usersapi.RecoveryConfirmInput, usersapi.RecoveryOutput](func(ctx context.Context, cmd usersapi.RecoveryConfirmInput) (usersapi.RecoveryOutput, error) {
+			return svc.ConfirmRecovery(ctx, cmd)
+		}),
+		recoveryCancel: phttp.UseCaseFunc[usersapi.RecoveryCancelInput, struct{}](func(ctx context.Context, cmd usersapi.RecoveryCancelInput) (struct{}, error) {
+			return struct{}{}, svc.CancelRecovery(ctx, cmd)
+		}),
+		recoveryComplete: phttp.UseCaseFunc[usersapi.RecoveryCompleteInput, usersapi.RecoveryOutput](func(ctx context.Context, cmd usersapi.RecoveryCompleteInput) (usersapi.RecoveryOutput, error) {
+			return svc.CompleteRecovery(ctx, cmd)
+		}),
 		getMe: phttp.UseCaseFunc[usersapi.GetProfileInput, profile.Output](func(ctx context.Context, cmd usersapi.GetProfileInput) (profile.Output, error) {
 			return svc.GetMe(ctx, cmd)
 		}),
@@ -122,9 +203,87 @@ func NewHandler(svc usersapi.Service, middleware phttp.UseCaseMiddleware) *Handl
 		revokeSession: phttp.UseCaseFunc[usersapi.RevokeSessionInput, struct{}](func(ctx context.Context, cmd usersapi.RevokeSessionInput) (struct{}, error) {
 			return struct{}{}, svc.RevokeSession(ctx, cmd)
 		}),
+		renameSession: phttp.UseCaseFunc[usersapi.RenameSessionInput, usersapi.Session](func(ctx context.Context, cmd usersapi.RenameSessionInput) (usersapi.Session, error) {
+			return svc.RenameSession(ctx, cmd)
+		}),
 		revokeOtherSession: phttp.UseCaseFunc[usersapi.RevokeOtherSessionsInput, struct{}](func(ctx context.Context, cmd usersapi.RevokeOtherSessionsInput) (struct{}, error) {
 			return struct{}{}, svc.RevokeOtherSessions(ctx, cmd)
 		}),
+		logout: phttp.UseCaseFunc[usersapi.LogoutInput, struct{}](func(ctx context.Context, cmd usersapi.LogoutInput) (struct{}, error) {
+			return struct{}{}, svc.Logout(ctx, cmd)
+		}),
+		logoutAll: phttp.UseCaseFunc[usersapi.LogoutAllInput, struct{}](func(ctx context.Context, cmd usersapi.LogoutAllInput) (struct{}, error) {
+			return struct{}{}, svc.LogoutAll(ctx, cmd)
+		}),
+		revocations: phttp.UseCaseFunc[usersapi.RevocationFeedInput, usersapi.RevocationFeedOutput](func(ctx context.Context, cmd usersapi.RevocationFeedInput) (usersapi.RevocationFeedOutput, error) {
+			return svc.ListRevocations(ctx, cmd)
+		}),
+		invalidateTokens: phttp.UseCaseFunc[usersapi.InvalidateTokensInput, usersapi.TokenEpochOutput](func(ctx context.Context, cmd usersapi.InvalidateTokensInput) (usersapi.TokenEpochOutput, error) {
+			return svc.InvalidateTokens(ctx, cmd)
+		}),
+		listDevices: phttp.UseCaseFunc[usersapi.ListTrustedDevicesInput, usersapi.TrustedDevicesOutput](func(ctx context.Context, cmd usersapi.ListTrustedDevicesInput) (usersapi.TrustedDevicesOutput, error) {
+			return svc.ListTrustedDevices(ctx, cmd)
+		}),
+		revokeDevice: phttp.UseCaseFunc[usersapi.RevokeTrustedDeviceInput, struct{}](func(ctx context.Context, cmd usersapi.RevokeTrustedDeviceInput) (struct{}, error) {
+			return struct{}{}, svc.RevokeTrustedDevice(ctx, cmd)
+		}),
+		createAccessToken: phttp.UseCaseFunc[usersapi.CreateAccessTokenInput, usersapi.CreateAccessTokenOutput](func(ctx context.Context, cmd usersapi.CreateAccessTokenInput) (usersapi.CreateAccessTokenOutput, error) {
+			return svc.CreateAccessToken(ctx, cmd)
+		}),
+		listAccessTokens: phttp.UseCaseFunc[usersapi.ListAccessTokensInput, usersapi.AccessTokensOutput](func(ctx context.Context, cmd usersapi.ListAccessTokensInput) (usersapi.AccessTokensOutput, error) {
+			return svc.ListAccessTokens(ctx, cmd)
+		}),
+		revokeAccessToken: phttp.UseCaseFunc[usersapi.RevokeAccessTokenInput, struct{}](func(ctx context.Context, cmd usersapi.RevokeAccessTokenInput) (struct{}, error) {
+			return struct{}{}, svc.RevokeAccessToken(ctx, cmd)
+		}),
+		registerClient: phttp.UseCaseFunc[usersapi.RegisterClientInput, usersapi.RegisterClientOutput](func(ctx context.Context, cmd usersapi.RegisterClientInput) (usersapi.RegisterClientOutput, error) {
+			return svc.RegisterClient(ctx, cmd)
+		}),
+		listClients: phttp.UseCaseFunc[usersapi.ListClientsInput, usersapi.ClientsOutput](func(ctx context.Context, cmd usersapi.ListClientsInput) (usersapi.ClientsOutput, error) {
+			return svc.ListClients(ctx, cmd)
+		}),
+		disableClient: phttp.UseCaseFunc[usersapi.DisableClientInput, struct{}](func(ctx context.Context, cmd usersapi.DisableClientInput) (struct{}, error) {
+			return struct{}{}, svc.DisableClient(ctx, cmd)
+		}),
+		clientToken: phttp.UseCaseFunc[usersapi.ClientTokenInput, usersapi.ClientTokenOutput](func(ctx context.Context, cmd usersapi.ClientTokenInput) (usersapi.ClientTokenOutput, error) {
+			return svc.ClientToken(ctx, cmd)
+		}),
+		startAuthorization: phttp.UseCaseFunc[usersapi.StartAuthorizationInput, usersapi.AuthorizationRedirect](func(ctx context.Context, cmd usersapi.StartAuthorizationInput) (usersapi.AuthorizationRedirect, error) {
+			return svc.StartAuthorization(ctx, cmd)
+		}),
+		authorize: phttp.UseCaseFunc[usersapi.AuthorizeInput, usersapi.AuthorizeOutput](func(ctx context.Context, cmd usersapi.AuthorizeInput) (usersapi.AuthorizeOutput, error) {
+			return svc.Authorize(ctx, cmd)
+		}),
+		userInfo: phttp.UseCaseFunc[usersapi.UserInfoInput, usersapi.UserInfoOutput](func(ctx context.Context, cmd usersapi.UserInfoInput) (usersapi.UserInfoOutput, error) {
+			return svc.UserInfo(ctx, cmd)
+		}),
+		providerMetadata: phttp.UseCaseFunc[usersapi.ProviderMetadataInput, usersapi.ProviderMetadata](func(ctx context.Context, cmd usersapi.ProviderMetadataInput) (usersapi.ProviderMetadata, error) {
+			return svc.ProviderMetadata(ctx, cmd)
+		}),
+		providerKeys: phttp.UseCaseFunc[usersapi.ProviderKeysInput, usersapi.ProviderKeySet](func(ctx context.Context, cmd usersapi.ProviderKeysInput) (usersapi.ProviderKeySet, error) {
+			return svc.ProviderKeys(ctx, cmd)
+		}),
+		introspectToken: phttp.UseCaseFunc[usersapi.IntrospectTokenInput, usersapi.IntrospectTokenOutput](func(ctx context.Context, cmd usersapi.IntrospectTokenInput) (usersapi.IntrospectTokenOutput, error) {
+			return svc.IntrospectToken(ctx, cmd)
+		}),
+		revokeToken: phttp.UseCaseFunc[usersapi.RevokeTokenInput, struct{}](func(ctx context.Context, cmd usersapi.RevokeTokenInput) (struct{}, error) {
+			return struct{}{}, svc.RevokeToken(ctx, cmd)
+		}),
+		startDevice: phttp.UseCaseFunc[usersapi.DeviceAuthorizationInput, usersapi.DeviceAuthorizationOutput](func(ctx context.Context, cmd usersapi.DeviceAuthorizationInput) (usersapi.DeviceAuthorizationOutput, error) {
+			return svc.StartDeviceAuthorization(ctx, cmd)
+		}),
+		verifyDevice: phttp.UseCaseFunc[usersapi.VerifyDeviceInput, usersapi.VerifyDeviceOutput](func(ctx context.Context, cmd usersapi.VerifyDeviceInput) (usersapi.VerifyDeviceOutput, error) {
+			return svc.VerifyDevice(ctx, cmd)
+		}),
+		startQRLogin: phttp.UseCaseFunc[usersapi.StartQRLoginInput, usersapi.StartQRLoginOutput](func(ctx context.Context, cmd usersapi.StartQRLoginInput) (usersapi.StartQRLoginOutput, error) {
+			return svc.StartQRLogin(ctx, cmd)
+		}),
+		scanQRLogin: phttp.UseCaseFunc[usersapi.ScanQRLoginInput, usersapi.ScanQRLoginOutput](func(ctx context.Context, cmd usersapi.ScanQRLoginInput) (usersapi.ScanQRLoginOutput, error) {
+			return svc.ScanQRLogin(ctx, cmd)
+		}),
+		qrLoginSession: phttp.UseCaseFunc[usersapi.QRLoginSessionInput, login.Output](func(ctx context.Context, cmd usersapi.QRLoginSessionInput) (login.Output, error) {
+			return svc.QRLoginSession(ctx, cmd)
+		}),
 	}
 }
 
@@ -156,10 +315,7 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 			DisplayName: out.DisplayName,
 			AvatarURL:   out.AvatarURL,
 		},
-		TokensResponse: dto.TokensResponse{
-			AccessToken:  out.AccessToken,
-			RefreshToken: out.RefreshToken,
-		},
+		TokensResponse: h.tokens(w, r, out.AccessToken, out.RefreshToken, out.RefreshExpiresAt),
 	})
 }
 
@@ -170,17 +326,22 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.DeviceToken == "" {
+		req.DeviceToken = r.Header.Get("X-Device-Token")
+	}
+
 	out, err := phttp.HandleUseCase(h.middleware, r, h.login, usersapi.LoginInput{
-		Email:    req.Email,
-		Password: req.Password,
-		OTP:      req.OTP,
+		Email:       req.Email,
+		Password:    req.Password,
+		OTP:         req.OTP,
+		DeviceToken: req.DeviceToken,
 	})
 	if err != nil {
 		status, code, msg := mapError(err)
 		phttp.WriteError(w, status, code, msg)
 		return
 	}
-	writeAuthResponse(w, out)
+	h.writeAuthResponse(w, r, out)
 }
 
 func (h *Handler) ChallengeStatus(w http.ResponseWriter, r *http.Request) {
@@ -196,7 +357,7 @@ func (h *Handler) ChallengeStatus(w http.ResponseWriter, r *http.Request) {
 		phttp.WriteError(w, status, code, msg)
 		return
 	}
-	writeAuthResponse(w, out)
+	h.writeAuthResponse(w, r, out)
 }
 
 func (h *Handler) VerifyChallengeTOTP(w http.ResponseWriter, r *http.Request) {
@@ -205,13 +366,13 @@ func (h *Handler) VerifyChallengeTOTP(w http.ResponseWriter, r *http.Request) {
 		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
 		return
 	}
-	out, err := phttp.HandleUseCase(h.middleware, r, h.challengeVerifyTOTP, usersapi.ChallengeVerifyTOTPInput{ChallengeID: req.ChallengeID, Code: req.Code})
+	out, err := phttp.HandleUseCase(h.middleware, r, h.challengeVerifyTOTP, usersapi.ChallengeVerifyTOTPInput{ChallengeID: req.ChallengeID, Code: req.Code, TrustDevice: req.TrustDevice})
 	if err != nil {
 		status, code, msg := mapError(err)
 		phttp.WriteError(w, status, code, msg)
 		return
 	}
-	writeAuthResponse(w, out)
+	h.writeAuthResponse(w, r, out)
 }
 
 func (h *Handler) ResendChallengeEmail(w http.ResponseWriter, r *http.Request) {
@@ -226,7 +387,7 @@ func (h *Handler) ResendChallengeEmail(w http.ResponseWriter, r *http.Request) {
 		phttp.WriteError(w, status, code, msg)
 		return
 	}
-	writeAuthResponse(w, out)
+	h.writeAuthResponse(w, r, out)
 }
 
 func (h *Handler) ConfirmChallengeEmail(w http.ResponseWriter, r *http.Request) {
@@ -235,19 +396,157 @@ func (h *Handler) ConfirmChallengeEmail(w http.ResponseWriter, r *http.Request)
 		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
 		return
 	}
-	out, err := phttp.HandleUseCase(h.middleware, r, h.challengeConfirmEmail, usersapi.ChallengeConfirmEmailInput{ChallengeID: req.ChallengeID, Token: req.Token})
+	out, err := phttp.HandleUseCase(h.middleware, r, h.challengeConfirmEmail, usersapi.ChallengeConfirmEmailInput{ChallengeID: req.ChallengeID, Token: req.Token, TrustDevice: req.TrustDevice})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+	h.writeAuthResponse(w, r, out)
+}
+
+func (h *Handler) VerifyChallengeEmailOTP(w http.ResponseWriter, r *http.Request) {
+	var req dto.ChallengeEmailOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	out, err := phttp.HandleUseCase(h.middleware, r, h.challengeEmailOTP, usersapi.ChallengeVerifyEmailOTPInput{ChallengeID: req.ChallengeID, Code: req.Code, TrustDevice: req.TrustDevice})
 	if err != nil {
 		status, code, msg := mapError(err)
 		phttp.WriteError(w, status, code, msg)
 		return
 	}
-	writeAuthResponse(w, out)
+	h.writeAuthResponse(w, r, out)
+}
+
+func (h *Handler) VerifyChallengeCaptcha(w http.ResponseWriter, r *http.Request) {
+	var req dto.ChallengeCaptchaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	out, err := phttp.HandleUseCase(h.middleware, r, h.challengeCaptcha, usersapi.ChallengeVerifyCaptchaInput{ChallengeID: req.ChallengeID, Token: req.Token})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+	h.writeAuthResponse(w, r, out)
+}
+
+// VerifyChallengeStep answers any registered step:
+// POST /auth/challenge/{id}/steps/{step}.
+func (h *Handler) VerifyChallengeStep(w http.ResponseWriter, r *http.Request) {
+	var req dto.ChallengeStepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	in := usersapi.ChallengeVerifyStepInput{
+		ChallengeID: chi.URLParam(r, "id"),
+		Step:        chi.URLParam(r, "step"),
+		Value:       req.Value,
+		TrustDevice: req.TrustDevice,
+	}
+	out, err := phttp.HandleUseCase(h.middleware, r, h.challengeStep, in)
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+	h.writeAuthResponse(w, r, out)
+}
+
+// ChallengeEvents streams challenge changes as Server-Sent Events:
+// GET /auth/challenge/{id}/events. Reconnecting clients send Last-Event-ID
+// and only get the current state if it changed since.
+func (h *Handler) ChallengeEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		phttp.WriteError(w, http.StatusInternalServerError, "internal_error", "Streaming unsupported")
+		return
+	}
+	in := usersapi.ChallengeWatchInput{
+		ChallengeID: chi.URLParam(r, "id"),
+		LastEventID: r.Header.Get("Last-Event-ID"),
+	}
+	// The stream outlives the use-case timeout, so it is bound to the request
+	// context only. It ends shortly before the router deadline so the client
+	// reconnects cleanly instead of getting a 504 mid-stream.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok {
+		var stop context.CancelFunc
+		ctx, stop = context.WithDeadline(ctx, deadline.Add(-time.Until(deadline)/10))
+		defer stop()
+	}
+	events, err := h.challengeWatch.Handle(ctx, in)
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	// Lift the server write timeout for this response only.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(toChallengeEventDTO(event))
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: challenge\ndata: %s\n\n", event.ID, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func toChallengeEventDTO(event usersapi.ChallengeEvent) dto.ChallengeEvent {
+	var steps []dto.ChallengeStepState
+	for _, s := range event.Steps {
+		steps = append(steps, dto.ChallengeStepState{Step: s.Step, AttemptsLeft: s.AttemptsLeft, LockUntil: s.LockUntil})
+	}
+	return dto.ChallengeEvent{
+		Status:         event.Status,
+		RequiredSteps:  event.RequiredSteps,
+		CompletedSteps: event.CompletedSteps,
+		ExpiresIn:      event.ExpiresIn,
+		Steps:          steps,
+	}
 }
 
 func toChallengeDTO(info *login.ChallengeInfo, status string) *dto.ChallengeResponse {
 	if info == nil {
 		return nil
 	}
+	var steps []dto.ChallengeStepState
+	for _, s := range info.Steps {
+		steps = append(steps, dto.ChallengeStepState{Step: s.Step, AttemptsLeft: s.AttemptsLeft, LockUntil: s.LockUntil})
+	}
 	return &dto.ChallengeResponse{
 		Status:         status,
 		ChallengeID:    info.ID,
@@ -258,6 +557,7 @@ func toChallengeDTO(info *login.ChallengeInfo, status string) *dto.ChallengeResp
 		MaskedEmail:    info.MaskedEmail,
 		AttemptsLeft:   info.AttemptsLeft,
 		LockUntil:      info.LockUntil,
+		Steps:          steps,
 	}
 }
 
@@ -277,7 +577,17 @@ func toProfileDTO(out profile.Output) dto.UserProfileResponse {
 	}
 }
 
-func writeAuthResponse(w http.ResponseWriter, out login.Output) {
+// tokens builds the token part of a response. For cookie mode clients the
+// refresh token goes into the cookie instead of the body; a zero expiresAt
+// keeps the cookie for the configured maximum age.
+func (h *Handler) tokens(w http.ResponseWriter, r *http.Request, accessToken, refreshToken string, expiresAt time.Time) dto.TokensResponse {
+	if refreshToken == "" || !h.cookies.requested(r) {
+		return dto.TokensResponse{AccessToken: accessToken, RefreshToken: refreshToken}
+	}
+	return dto.TokensResponse{AccessToken: accessToken, CSRFToken: h.cookies.set(w, refreshToken, expiresAt)}
+}
+
+func (h *Handler) writeAuthResponse(w http.ResponseWriter, r *http.Request, out login.Output) {
 	if out.Status == "challenge_required" && out.Challenge != nil {
 		phttp.WriteJSON(w, http.StatusOK, toChallengeDTO(out.Challenge, out.Status))
 		return
@@ -293,11 +603,9 @@ func writeAuthResponse(w http.ResponseWriter, out login.Output) {
 			DisplayName: out.DisplayName,
 			AvatarURL:   out.AvatarURL,
 		},
-		TokensResponse: dto.TokensResponse{
-			AccessToken:  out.AccessToken,
-			RefreshToken: out.RefreshToken,
-		},
-		Challenge: toChallengeDTO(out.Challenge, out.Status),
+		TokensResponse: h.tokens(w, r, out.AccessToken, out.RefreshToken, out.RefreshExpiresAt),
+		Challenge:      toChallengeDTO(out.Challenge, out.Status),
+		DeviceToken:    out.DeviceToken,
 	})
 }
 
@@ -327,10 +635,7 @@ func (h *Handler) TelegramLogin(w http.ResponseWriter, r *http.Request) {
 			DisplayName: out.DisplayName,
 			AvatarURL:   out.AvatarURL,
 		},
-		TokensResponse: dto.TokensResponse{
-			AccessToken:  out.AccessToken,
-			RefreshToken: out.RefreshToken,
-		},
+		TokensResponse: h.tokens(w, r, out.AccessToken, out.RefreshToken, out.RefreshExpiresAt),
 	})
 }
 
@@ -347,7 +652,7 @@ func (h *Handler) GoogleLogin(w http.ResponseWriter, r *http.Request) {
 		phttp.WriteError(w, status, code, msg)
 		return
 	}
-	writeAuthResponse(w, out)
+	h.writeAuthResponse(w, r, out)
 }
 
 func (h *Handler) AppleLogin(w http.ResponseWriter, r *http.Request) {
@@ -363,12 +668,20 @@ func (h *Handler) AppleLogin(w http.ResponseWriter, r *http.Request) {
 		phttp.WriteError(w, status, code, msg)
 		return
 	}
-	writeAuthResponse(w, out)
+	h.writeAuthResponse(w, r, out)
 }
 
+// Refresh rotates the refresh token from the body or, for cookie mode
+// clients, from the cookie after a CSRF check.
 func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 	var req dto.RefreshRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if h.cookies.requested(r) {
+		if !h.cookies.checkCSRF(r) {
+			phttp.WriteError(w, http.StatusForbidden, "csrf_failed", "CSRF check failed")
+			return
+		}
+		req.RefreshToken = h.cookies.refreshToken(r)
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
 		return
 	}
@@ -377,14 +690,18 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 		RefreshToken: req.RefreshToken,
 	})
 	if err != nil {
+		if h.cookies.requested(r) && errors.Is(err, domain.ErrRefreshTokenInvalid) {
+			h.cookies.clear(w)
+		}
 		status, code, msg := mapError(err)
 		phttp.WriteError(w, status, code, msg)
 		return
 	}
 
-	phttp.WriteJSON(w, http.StatusOK, dto.TokensResponse{
-		AccessToken:  out.AccessToken,
-		RefreshToken: out.RefreshToken,
+	phttp.WriteJSON(w, http.StatusOK, dto.RefreshResponse{
+		TokensResponse:   h.tokens(w, r, out.AccessToken, out.RefreshToken, out.RefreshExpiresAt),
+		RefreshExpiresAt: out.RefreshExpiresAt,
+		ReloginAt:        out.ReloginAt,
 	})
 }
 
@@ -415,7 +732,7 @@ func (h *Handler) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
 			DisplayName: out.DisplayName,
 			AvatarURL:   out.AvatarURL,
 		},
-		TokensResponse: dto.TokensResponse{AccessToken: out.AccessToken, RefreshToken: out.RefreshToken},
+		TokensResponse: h.tokens(w, r, out.AccessToken, out.RefreshToken, out.RefreshExpiresAt),
 	})
 }
 
@@ -461,6 +778,136 @@ func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	phttp.WriteSuccess(w, http.StatusOK, "Password reset completed")
 }
 
+// StartRecovery begins resetting a lost second factor: POST /auth/recovery/start.
+func (h *Handler) StartRecovery(w http.ResponseWriter, r *http.Request) {
+	var req dto.RecoveryStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	out, err := phttp.HandleUseCase(h.middleware, r, h.recoveryStart, usersapi.RecoveryStartInput{Email: req.Email})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+	phttp.WriteJSON(w, http.StatusOK, toRecoveryDTO(out))
+}
+
+func (h *Handler) ConfirmRecovery(w http.ResponseWriter, r *http.Request) {
+	var req dto.RecoveryConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	out, err := phttp.HandleUseCase(h.middleware, r, h.recoveryConfirm, usersapi.RecoveryConfirmInput{ChallengeID: req.ChallengeID, Code: req.Code})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+	phttp.WriteJSON(w, http.StatusOK, toRecoveryDTO(out))
+}
+
+func (h *Handler) CancelRecovery(w http.ResponseWriter, r *http.Request) {
+	var req dto.RecoveryCancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	if _, err := phttp.HandleUseCase(h.middleware, r, h.recoveryCancel, usersapi.RecoveryCancelInput{ChallengeID: req.ChallengeID, Token: req.Token}); err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+	phttp.WriteSuccess(w, http.StatusOK, "Recovery cancelled")
+}
+
+func (h *Handler) CompleteRecovery(w http.ResponseWriter, r *http.Request) {
+	var req dto.ChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	out, err := phttp.HandleUseCase(h.middleware, r, h.recoveryComplete, usersapi.RecoveryCompleteInput{ChallengeID: req.ChallengeID})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+	phttp.WriteJSON(w, http.StatusOK, toRecoveryDTO(out))
+}
+
+func toRecoveryDTO(out usersapi.RecoveryOutput) dto.RecoveryResponse {
+	return dto.RecoveryResponse{
+		ChallengeID:  out.ChallengeID,
+		Status:       out.Status,
+		ExpiresIn:    out.ExpiresIn,
+		AttemptsLeft: out.AttemptsLeft,
+		LockUntil:    out.LockUntil,
+		ReadyAt:      out.ReadyAt,
+	}
+}
+
+// StartStepUp opens a step-up challenge for the caller's session:
+// POST /auth/reauth.
+func (h *Handler) StartStepUp(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+	sid, _ := httpctx.SessionIDFromContext(r.Context())
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.stepUpStart, usersapi.StepUpStartInput{UserID: uid, SessionID: sid})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+	writeStepUpResponse(w, out)
+}
+
+// VerifyStepUp answers a step of the caller's step-up challenge:
+// POST /auth/reauth/{id}/steps/{step}.
+func (h *Handler) VerifyStepUp(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+	sid, _ := httpctx.SessionIDFromContext(r.Context())
+
+	var req dto.ChallengeStepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	out, err := phttp.HandleUseCase(h.middleware, r, h.stepUpVerify, usersapi.StepUpVerifyInput{
+		UserID:      uid,
+		SessionID:   sid,
+		ChallengeID: chi.URLParam(r, "id"),
+		Step:        chi.URLParam(r, "step"),
+		Value:       req.Value,
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+	writeStepUpResponse(w, out)
+}
+
+// writeStepUpResponse returns the challenge until it is completed, then only
+// the new access token.
+func writeStepUpResponse(w http.ResponseWriter, out login.Output) {
+	if out.AccessToken == "" {
+		phttp.WriteJSON(w, http.StatusOK, toChallengeDTO(out.Challenge, out.Status))
+		return
+	}
+	phttp.WriteJSON(w, http.StatusOK, dto.StepUpResponse{Status: out.Status, AccessToken: out.AccessToken})
+}
+
 func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
 	uid, ok := httpctx.UserIDFromContext(r.Context())
 	if !ok || uid == "" {
@@ -523,7 +970,14 @@ func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := phttp.HandleUseCase(h.middleware, r, h.changePassword, usersapi.ChangePasswordInput{UserID: uid, CurrentPassword: req.CurrentPassword, NewPassword: req.NewPassword}); err != nil {
+	sid, _ := httpctx.SessionIDFromContext(r.Context())
+	if _, err := phttp.HandleUseCase(h.middleware, r, h.changePassword, usersapi.ChangePasswordInput{
+		UserID:          uid,
+		SessionID:       sid,
+		CurrentPassword: req.CurrentPassword,
+		NewPassword:     req.NewPassword,
+		AuthTime:        httpctx.AuthTimeFromContext(r.Context()),
+	}); err != nil {
 		status, code, msg := mapError(err)
 		phttp.WriteError(w, status, code, msg)
 		return
@@ -549,6 +1003,7 @@ func (h *Handler) LinkProvider(w http.ResponseWriter, r *http.Request) {
 		UserID:         uid,
 		Provider:       req.Provider,
 		ProviderUserID: req.ProviderUserID,
+		AuthTime:       httpctx.AuthTimeFromContext(r.Context()),
 	})
 	if err != nil {
 		status, code, msg := mapError(err)
@@ -573,6 +1028,9 @@ func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
 	if current == "" {
 		current = r.Header.Get("X-Refresh-Token")
 	}
+	if current == "" {
+		current = h.cookies.refreshToken(r)
+	}
 
 	out, err := phttp.HandleUseCase(h.middleware, r, h.listSessions, usersapi.ListSessionsInput{
 		UserID:              uid,
@@ -587,20 +1045,63 @@ func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
 
 	resp := dto.SessionsResponse{Sessions: make([]dto.SessionResponse, 0, len(out.Sessions))}
 	for _, s := range out.Sessions {
-		resp.Sessions = append(resp.Sessions, dto.SessionResponse{
-			ID:        s.ID,
-			UserAgent: s.UserAgent,
-			IP:        s.IP,
-			CreatedAt: s.CreatedAt,
-			ExpiresAt: s.ExpiresAt,
-			RevokedAt: s.RevokedAt,
-			Current:   s.Current,
-		})
+		resp.Sessions = append(resp.Sessions, toSessionDTO(s))
 	}
 
 	phttp.WriteJSON(w, http.StatusOK, resp)
 }
 
+func (h *Handler) RenameSession(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+	currentSessionID, _ := httpctx.SessionIDFromContext(r.Context())
+
+	var req dto.RenameSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	if req.SessionID == "" {
+		phttp.WriteError(w, http.StatusBadRequest, "validation_error", "session_id is required")
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.renameSession, usersapi.RenameSessionInput{UserID: uid, SessionID: req.SessionID, Name: req.Name})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	out.Current = currentSessionID != "" && out.ID == currentSessionID
+	phttp.WriteJSON(w, http.StatusOK, toSessionDTO(out))
+}
+
+func toSessionDTO(s usersapi.Session) dto.SessionResponse {
+	return dto.SessionResponse{
+		ID:          s.ID,
+		UserAgent:   s.UserAgent,
+		Browser:     s.Browser,
+		OS:          s.OS,
+		DeviceType:  s.DeviceType,
+		ClientType:  s.ClientType,
+		DeviceName:  s.DeviceName,
+		LoginMethod: s.LoginMethod,
+		IP:          s.IP,
+		Country:     s.Country,
+		City:        s.City,
+		LastIP:      s.LastIP,
+		CreatedAt:   s.CreatedAt,
+		LastUsedAt:  s.LastUsedAt,
+		ExpiresAt:   s.ExpiresAt,
+		RevokedAt:   s.RevokedAt,
+		Current:     s.Current,
+	}
+}
+
 func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
 	uid, ok := httpctx.UserIDFromContext(r.Context())
 	if !ok {
@@ -642,6 +1143,9 @@ func (h *Handler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
 	if req.CurrentRefreshToken == "" {
 		req.CurrentRefreshToken = r.Header.Get("X-Refresh-Token")
 	}
+	if req.CurrentRefreshToken == "" {
+		req.CurrentRefreshToken = h.cookies.refreshToken(r)
+	}
 	if req.CurrentRefreshToken == "" {
 		phttp.WriteError(w, http.StatusBadRequest, "validation_error", "current_refresh_token is required")
 		return
@@ -650,6 +1154,7 @@ func (h *Handler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
 	if _, err := phttp.HandleUseCase(h.middleware, r, h.revokeOtherSession, usersapi.RevokeOtherSessionsInput{
 		UserID:              uid,
 		CurrentRefreshToken: req.CurrentRefreshToken,
+		AuthTime:            httpctx.AuthTimeFromContext(r.Context()),
 	}); err != nil {
 		status, code, msg := mapError(err)
 		phttp.WriteError(w, status, code, msg)
@@ -659,6 +1164,353 @@ func (h *Handler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
 	phttp.WriteSuccess(w, http.StatusOK, "Other sessions revoked")
 }
 
+// clearSiteData asks the browser to drop what it stored for the site once
+// the session is gone.
+const clearSiteData = `"cache", "cookies", "storage"`
+
+// Logout ends the current session, identified by the access token or, when
+// that is missing or already expired, by the refresh token in the body or
+// the cookie.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req dto.LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken = r.Header.Get("X-Refresh-Token")
+	}
+	uid, _ := httpctx.UserIDFromContext(r.Context())
+	sid, _ := httpctx.SessionIDFromContext(r.Context())
+	if req.RefreshToken == "" && sid == "" && h.cookies.refreshToken(r) != "" {
+		if !h.cookies.checkCSRF(r) {
+			phttp.WriteError(w, http.StatusForbidden, "csrf_failed", "CSRF check failed")
+			return
+		}
+		req.RefreshToken = h.cookies.refreshToken(r)
+	}
+
+	if _, err := phttp.HandleUseCase(h.middleware, r, h.logout, usersapi.LogoutInput{
+		UserID:       uid,
+		SessionID:    sid,
+		RefreshToken: req.RefreshToken,
+	}); err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	if h.cookies.requested(r) {
+		h.cookies.clear(w)
+	}
+	w.Header().Set("Clear-Site-Data", clearSiteData)
+	phttp.WriteSuccess(w, http.StatusOK, "Logged out")
+}
+
+// LogoutAll revokes every session of the caller, including the current one.
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	if _, err := phttp.HandleUseCase(h.middleware, r, h.logoutAll, usersapi.LogoutAllInput{UserID: uid}); err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	if h.cookies.requested(r) {
+		h.cookies.clear(w)
+	}
+	w.Header().Set("Clear-Site-Data", clearSiteData)
+	phttp.WriteSuccess(w, http.StatusOK, "Logged out everywhere")
+}
+
+// ListRevocations serves the revocation feed to other services; the route
+// is guarded by a service token, not a user's access token.
+func (h *Handler) ListRevocations(w http.ResponseWriter, r *http.Request) {
+	in := usersapi.RevocationFeedInput{Cursor: r.URL.Query().Get("cursor")}
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			phttp.WriteError(w, http.StatusBadRequest, "invalid_limit", "Invalid limit")
+			return
+		}
+		in.Limit = limit
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.revocations, in)
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	resp := dto.RevocationsResponse{
+		Revocations: make([]dto.RevocationResponse, 0, len(out.Revocations)),
+		NextCursor:  out.NextCursor,
+		HasMore:     out.HasMore,
+		TTL:         int64(out.TTL.Seconds()),
+		UserEpochs:  make([]dto.TokenEpochResponse, 0, len(out.Epochs)),
+	}
+	for _, rev := range out.Revocations {
+		resp.Revocations = append(resp.Revocations, dto.RevocationResponse{SessionID: rev.SessionID, RevokedAt: rev.RevokedAt})
+	}
+	if !out.NotBefore.IsZero() {
+		notBefore := out.NotBefore
+		resp.NotBefore = &notBefore
+	}
+	for _, e := range out.Epochs {
+		resp.UserEpochs = append(resp.UserEpochs, dto.TokenEpochResponse{UserID: e.UserID, NotBefore: e.NotBefore})
+	}
+	phttp.WriteJSON(w, http.StatusOK, resp)
+}
+
+// InvalidateTokens starts a new token epoch for one user or everyone; the
+// route is guarded by the admin token.
+func (h *Handler) InvalidateTokens(w http.ResponseWriter, r *http.Request) {
+	var req dto.InvalidateTokensRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.invalidateTokens, usersapi.InvalidateTokensInput{UserID: req.UserID, Reason: req.Reason, Actor: "admin_api"})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	phttp.WriteJSON(w, http.StatusOK, dto.TokenEpochResponse{UserID: out.UserID, NotBefore: out.NotBefore})
+}
+
+// RegisterClient registers an OAuth client; a client secret is in this
+// response only.
+func (h *Handler) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	var req dto.RegisterClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.registerClient, usersapi.RegisterClientInput{
+		Name:         req.Name,
+		AuthMethod:   req.AuthMethod,
+		PublicKey:    req.PublicKey,
+		Scopes:       req.Scopes,
+		RedirectURIs: req.RedirectURIs,
+		Actor:        "admin_api",
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	phttp.WriteJSON(w, http.StatusCreated, dto.RegisterClientResponse{
+		ClientSecret:        out.Secret,
+		OAuthClientResponse: toClientDTO(out.Client),
+	})
+}
+
+func (h *Handler) ListClients(w http.ResponseWriter, r *http.Request) {
+	out, err := phttp.HandleUseCase(h.middleware, r, h.listClients, usersapi.ListClientsInput{})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	resp := dto.OAuthClientsResponse{Clients: make([]dto.OAuthClientResponse, 0, len(out.Clients))}
+	for _, c := range out.Clients {
+		resp.Clients = append(resp.Clients, toClientDTO(c))
+	}
+	phttp.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) DisableClient(w http.ResponseWriter, r *http.Request) {
+	var req dto.DisableClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+
+	if _, err := phttp.HandleUseCase(h.middleware, r, h.disableClient, usersapi.DisableClientInput{ClientID: req.ClientID, Actor: "admin_api"}); err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	phttp.WriteSuccess(w, http.StatusOK, "Client disabled")
+}
+
+func (h *Handler) ListTrustedDevices(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.listDevices, usersapi.ListTrustedDevicesInput{UserID: uid})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	resp := dto.TrustedDevicesResponse{Devices: make([]dto.TrustedDeviceResponse, 0, len(out.Devices))}
+	for _, d := range out.Devices {
+		resp.Devices = append(resp.Devices, dto.TrustedDeviceResponse{
+			ID:         d.ID,
+			UserAgent:  d.UserAgent,
+			IP:         d.IP,
+			CreatedAt:  d.CreatedAt,
+			ExpiresAt:  d.ExpiresAt,
+			LastUsedAt: d.LastUsedAt,
+		})
+	}
+
+	phttp.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) RevokeTrustedDevice(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	var req dto.RevokeTrustedDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	if req.DeviceID == "" {
+		phttp.WriteError(w, http.StatusBadRequest, "validation_error", "device_id is required")
+		return
+	}
+
+	if _, err := phttp.HandleUseCase(h.middleware, r, h.revokeDevice, usersapi.RevokeTrustedDeviceInput{UserID: uid, DeviceID: req.DeviceID}); err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	phttp.WriteSuccess(w, http.StatusOK, "Device revoked")
+}
+
+// CreateAccessToken returns a new personal access token; the token itself is
+// in this response only.
+func (h *Handler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	var req dto.CreateAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		phttp.WriteError(w, http.StatusBadRequest, "validation_error", "expires_in_days must be positive")
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.createAccessToken, usersapi.CreateAccessTokenInput{
+		UserID:    uid,
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresIn: time.Duration(req.ExpiresInDays) * 24 * time.Hour,
+		AuthTime:  httpctx.AuthTimeFromContext(r.Context()),
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	phttp.WriteJSON(w, http.StatusCreated, dto.CreateAccessTokenResponse{
+		Token:               out.Token,
+		AccessTokenResponse: toAccessTokenDTO(out.AccessToken),
+	})
+}
+
+func (h *Handler) ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.listAccessTokens, usersapi.ListAccessTokensInput{UserID: uid})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	resp := dto.AccessTokensResponse{Tokens: make([]dto.AccessTokenResponse, 0, len(out.Tokens))}
+	for _, t := range out.Tokens {
+		resp.Tokens = append(resp.Tokens, toAccessTokenDTO(t))
+	}
+	phttp.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	var req dto.RevokeAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+	if req.TokenID == "" {
+		phttp.WriteError(w, http.StatusBadRequest, "validation_error", "token_id is required")
+		return
+	}
+
+	if _, err := phttp.HandleUseCase(h.middleware, r, h.revokeAccessToken, usersapi.RevokeAccessTokenInput{UserID: uid, TokenID: req.TokenID}); err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	phttp.WriteSuccess(w, http.StatusOK, "Token revoked")
+}
+
+func toAccessTokenDTO(t usersapi.AccessToken) dto.AccessTokenResponse {
+	return dto.AccessTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
+
+func toClientDTO(c usersapi.OAuthClient) dto.OAuthClientResponse {
+	return dto.OAuthClientResponse{
+		ClientID:     c.ID,
+		Name:         c.Name,
+		AuthMethod:   c.AuthMethod,
+		Scopes:       c.Scopes,
+		RedirectURIs: c.RedirectURIs,
+		CreatedAt:    c.CreatedAt,
+		DisabledAt:   c.DisabledAt,
+	}
+}
+
 func (h *Handler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
 	uid, ok := httpctx.UserIDFromContext(r.Context())
 	if !ok {
@@ -704,7 +1556,7 @@ func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
 		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
 		return
 	}
-	if _, err := phttp.HandleUseCase(h.middleware, r, h.disableTwoFactor, usersapi.TwoFactorDisableInput{UserID: uid, Code: req.Code}); err != nil {
+	if _, err := phttp.HandleUseCase(h.middleware, r, h.disableTwoFactor, usersapi.TwoFactorDisableInput{UserID: uid, Code: req.Code, AuthTime: httpctx.AuthTimeFromContext(r.Context())}); err != nil {
 		status, code, msg := mapError(err)
 		phttp.WriteError(w, status, code, msg)
 		return
@@ -713,7 +1565,7 @@ func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
 }
 
 func mapError(err error) (status int, code string, message string) {
-	if errors.Is(err, domain.ErrInvalidEmail) || errors.Is(err, domain.ErrWeakPassword) || errors.Is(err, domain.ErrInvalidDisplayName) || errors.Is(err, domain.ErrInvalidAvatarURL) {
+	if errors.Is(err, domain.ErrInvalidEmail) || errors.Is(err, domain.ErrWeakPassword) || errors.Is(err, domain.ErrInvalidDisplayName) || errors.Is(err, domain.ErrInvalidAvatarURL) || errors.Is(err, domain.ErrInvalidDeviceName) || errors.Is(err, domain.ErrInvalidTokenName) || errors.Is(err, domain.ErrInvalidTokenExpiry) || errors.Is(err, domain.ErrInvalidClientName) || errors.Is(err, domain.ErrInvalidClientAuthMethod) || errors.Is(err, domain.ErrInvalidOAuthRequest) {
 		return http.StatusBadRequest, "validation_error", "Validation error"
 	}
 	if errors.Is(err, domain.ErrEmailAlreadyUsed) {
@@ -728,6 +1580,54 @@ func mapError(err error) (status int, code string, message string) {
 	if errors.Is(err, domain.ErrRefreshTokenInvalid) {
 		return http.StatusUnauthorized, "refresh_token_invalid", "Refresh token invalid"
 	}
+	if errors.Is(err, domain.ErrUnknownChallengeStep) {
+		return http.StatusNotFound, "unknown_step", "Unknown challenge step"
+	}
+	if errors.Is(err, domain.ErrRecoveryNotReady) {
+		return http.StatusConflict, "recovery_not_ready", "Recovery waiting period is not over"
+	}
+	if errors.Is(err, domain.ErrReauthenticationRequired) {
+		return http.StatusForbidden, "reauthentication_required", "Recent authentication required"
+	}
+	if errors.Is(err, domain.ErrStepUpUnavailable) {
+		return http.StatusConflict, "step_up_unavailable", "Sign in again to continue"
+	}
+	if errors.Is(err, domain.ErrSessionLimitReached) {
+		return http.StatusConflict, "session_limit_reached", "Too many active sessions"
+	}
+	if errors.Is(err, domain.ErrInvalidCursor) {
+		return http.StatusBadRequest, "invalid_cursor", "Invalid cursor"
+	}
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return http.StatusNotFound, "user_not_found", "User not found"
+	}
+	if errors.Is(err, domain.ErrReasonRequired) {
+		return http.StatusBadRequest, "reason_required", "Reason is required"
+	}
+	if errors.Is(err, domain.ErrInvalidScope) {
+		return http.StatusBadRequest, "invalid_scope", "Invalid scope"
+	}
+	if errors.Is(err, domain.ErrTokenLimitReached) {
+		return http.StatusConflict, "token_limit_reached", "Too many access tokens"
+	}
+	if errors.Is(err, domain.ErrClientNotFound) {
+		return http.StatusNotFound, "client_not_found", "Client not found"
+	}
+	if errors.Is(err, domain.ErrInvalidClient) {
+		return http.StatusBadRequest, "invalid_client", "Unknown or disabled client"
+	}
+	if errors.Is(err, domain.ErrInvalidRedirectURI) {
+		return http.StatusBadRequest, "invalid_redirect_uri", "Redirect URIs must be absolute https, loopback http or private-use scheme URIs without a fragment"
+	}
+	if errors.Is(err, domain.ErrInvalidUserCode) {
+		return http.StatusBadRequest, "invalid_user_code", "Unknown, expired or already answered code"
+	}
+	if errors.Is(err, domain.ErrInvalidQRCode) {
+		return http.StatusBadRequest, "invalid_qr_code", "Unknown, expired or already answered QR code"
+	}
+	if errors.Is(err, domain.ErrInvalidClientKey) {
+		return http.StatusBadRequest, "invalid_public_key", "Public key must be a PEM encoded RSA (2048 bits or more), P-256 or Ed25519 key"
+	}
 	if errors.Is(err, domain.ErrEmailNotVerified) {
 		return http.StatusForbidden, "email_not_verified", "Email not verified"
 	}
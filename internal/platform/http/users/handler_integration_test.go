@@ -9,19 +9,27 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	usersapp "github.com/vaaxooo/xbackend/internal/modules/users/application"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/accesstoken"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/apple"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/challenge"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/common"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/device"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/epoch"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/google"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/link"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/login"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/oauth"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/password"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/profile"
+	"github.com/vaaxooo/xbackend/internal/modules/users/application/recovery"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/refresh"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/register"
 	"github.com/vaaxooo/xbackend/internal/modules/users/application/session"
@@ -65,8 +73,9 @@ type fakeService struct {
 	appleOut    login.Output
 	appleErr    error
 
-	refreshOut refresh.Output
-	refreshErr error
+	refreshOut  refresh.Output
+	refreshErr  error
+	lastRefresh refresh.Input
 
 	requestEmailErr  error
 	requestResetErr  error
@@ -81,6 +90,42 @@ type fakeService struct {
 	listSessionsErr  error
 	revokeSessionErr error
 	revokeOthersErr  error
+	renameSessionErr error
+	lastRename       session.RenameInput
+	lastRenameMeta   common.RequestMeta
+
+	listDevicesOut  device.Output
+	listDevicesErr  error
+	revokeDeviceErr error
+
+	revocationsOut session.FeedOutput
+	lastFeed       session.FeedInput
+	lastInvalidate epoch.InvalidateInput
+	lastTokenIn    accesstoken.CreateInput
+	invalidateErr  error
+
+	lastClientReg   oauth.RegisterClientInput
+	lastClientToken oauth.TokenInput
+	clientTokenErr  error
+
+	startAuthErr  error
+	lastAuthorize oauth.AuthorizeInput
+	authorizeOut  oauth.AuthorizeOutput
+	userInfoErr   error
+
+	lastIntrospect oauth.IntrospectInput
+	introspectOut  oauth.IntrospectOutput
+	lastRevoke     oauth.RevokeInput
+	revokeErr      error
+
+	lastDeviceStart  oauth.DeviceAuthorizationInput
+	lastVerifyDevice oauth.VerifyDeviceInput
+	verifyDeviceErr  error
+
+	lastQRScan    challenge.ScanQRLoginInput
+	qrScanErr     error
+	lastQRSession challenge.QRSessionInput
+	qrSessionOut  login.Output
 
 	getOut profile.Output
 	getErr error
@@ -93,8 +138,25 @@ type fakeService struct {
 	linkOut link.Output
 	linkErr error
 
-	challengeOut login.Output
-	challengeErr error
+	challengeOut  login.Output
+	challengeErr  error
+	lastStepInput challenge.VerifyStepInput
+
+	watchEvents    []challenge.Event
+	watchErr       error
+	lastWatchInput challenge.WatchInput
+
+	recoveryOut        recovery.Output
+	recoveryErr        error
+	lastRecoveryCancel recovery.CancelInput
+
+	logoutErr     error
+	lastLogout    session.LogoutInput
+	lastLogoutAll session.LogoutAllInput
+
+	stepUpOut        login.Output
+	stepUpErr        error
+	lastStepUpVerify challenge.VerifyStepUpInput
 }
 
 func (f *fakeService) Register(context.Context, register.Input) (login.Output, error) {
@@ -115,7 +177,8 @@ func (f *fakeService) LoginWithGoogle(context.Context, google.Input) (login.Outp
 func (f *fakeService) LoginWithApple(context.Context, apple.Input) (login.Output, error) {
 	return f.appleOut, f.appleErr
 }
-func (f *fakeService) Refresh(context.Context, refresh.Input) (refresh.Output, error) {
+func (f *fakeService) Refresh(_ context.Context, in refresh.Input) (refresh.Output, error) {
+	f.lastRefresh = in
 	return f.refreshOut, f.refreshErr
 }
 func (f *fakeService) RequestEmailConfirmation(context.Context, verification.RequestEmailInput) error {
@@ -165,6 +228,176 @@ func (f *fakeService) ConfirmChallengeEmail(context.Context, challenge.ConfirmEm
 	return f.challengeOut, f.challengeErr
 }
 
+func (f *fakeService) VerifyChallengeEmailOTP(context.Context, challenge.VerifyEmailOTPInput) (login.Output, error) {
+	return f.challengeOut, f.challengeErr
+}
+
+func (f *fakeService) VerifyChallengeCaptcha(context.Context, challenge.VerifyCaptchaInput) (login.Output, error) {
+	return f.challengeOut, f.challengeErr
+}
+
+func (f *fakeService) VerifyChallengeStep(_ context.Context, in challenge.VerifyStepInput) (login.Output, error) {
+	f.lastStepInput = in
+	return f.challengeOut, f.challengeErr
+}
+
+func (f *fakeService) WatchChallenge(_ context.Context, in challenge.WatchInput) (<-chan challenge.Event, error) {
+	f.lastWatchInput = in
+	if f.watchErr != nil {
+		return nil, f.watchErr
+	}
+	events := make(chan challenge.Event, len(f.watchEvents))
+	for _, e := range f.watchEvents {
+		events <- e
+	}
+	close(events)
+	return events, nil
+}
+
+func (f *fakeService) StartRecovery(context.Context, recovery.StartInput) (recovery.Output, error) {
+	return f.recoveryOut, f.recoveryErr
+}
+
+func (f *fakeService) ConfirmRecovery(context.Context, recovery.ConfirmInput) (recovery.Output, error) {
+	return f.recoveryOut, f.recoveryErr
+}
+
+func (f *fakeService) CancelRecovery(_ context.Context, in recovery.CancelInput) error {
+	f.lastRecoveryCancel = in
+	return f.recoveryErr
+}
+
+func (f *fakeService) CompleteRecovery(context.Context, recovery.CompleteInput) (recovery.Output, error) {
+	return f.recoveryOut, f.recoveryErr
+}
+
+func (f *fakeService) Logout(_ context.Context, in session.LogoutInput) error {
+	f.lastLogout = in
+	return f.logoutErr
+}
+
+func (f *fakeService) ListRevocations(_ context.Context, in session.FeedInput) (session.FeedOutput, error) {
+	f.lastFeed = in
+	return f.revocationsOut, nil
+}
+func (f *fakeService) InvalidateTokens(_ context.Context, in epoch.InvalidateInput) (epoch.Output, error) {
+	f.lastInvalidate = in
+	if f.invalidateErr != nil {
+		return epoch.Output{}, f.invalidateErr
+	}
+	return epoch.Output{UserID: in.UserID, NotBefore: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}, nil
+}
+func (f *fakeService) CreateAccessToken(_ context.Context, in accesstoken.CreateInput) (accesstoken.CreateOutput, error) {
+	f.lastTokenIn = in
+	return accesstoken.CreateOutput{Token: "xbp_secret", AccessToken: accesstoken.AccessToken{ID: "pat-1", Name: in.Name, Prefix: "xbp_secret", Scopes: in.Scopes}}, nil
+}
+func (f *fakeService) ListAccessTokens(context.Context, accesstoken.ListInput) (accesstoken.Output, error) {
+	return accesstoken.Output{Tokens: []accesstoken.AccessToken{{ID: "pat-1", Name: "ci", Prefix: "xbp_secret"}}}, nil
+}
+func (f *fakeService) RevokeAccessToken(context.Context, accesstoken.RevokeInput) error {
+	return nil
+}
+func (f *fakeService) RegisterClient(_ context.Context, in oauth.RegisterClientInput) (oauth.RegisterClientOutput, error) {
+	f.lastClientReg = in
+	return oauth.RegisterClientOutput{Client: oauth.Client{ID: "client-1", Name: in.Name, AuthMethod: domain.ClientAuthSecret, Scopes: in.Scopes}, Secret: "xbs_secret"}, nil
+}
+func (f *fakeService) ListClients(context.Context, oauth.ListClientsInput) (oauth.ClientsOutput, error) {
+	return oauth.ClientsOutput{Clients: []oauth.Client{{ID: "client-1", Name: "billing"}}}, nil
+}
+func (f *fakeService) DisableClient(context.Context, oauth.DisableClientInput) error {
+	return nil
+}
+func (f *fakeService) ClientToken(_ context.Context, in oauth.TokenInput) (oauth.TokenOutput, error) {
+	f.lastClientToken = in
+	if f.clientTokenErr != nil {
+		return oauth.TokenOutput{}, f.clientTokenErr
+	}
+	return oauth.TokenOutput{AccessToken: "client-token", TokenType: "Bearer", ExpiresIn: 15 * time.Minute, Scope: "revocations:read"}, nil
+}
+func (f *fakeService) StartAuthorization(_ context.Context, in oauth.StartAuthorizationInput) (oauth.RedirectOutput, error) {
+	if f.startAuthErr != nil {
+		return oauth.RedirectOutput{}, f.startAuthErr
+	}
+	return oauth.RedirectOutput{RedirectTo: "https://login.example.com/?client_id=" + in.Request.ClientID}, nil
+}
+func (f *fakeService) Authorize(_ context.Context, in oauth.AuthorizeInput) (oauth.AuthorizeOutput, error) {
+	f.lastAuthorize = in
+	return f.authorizeOut, nil
+}
+func (f *fakeService) UserInfo(_ context.Context, in oauth.UserInfoInput) (oauth.UserInfoOutput, error) {
+	if f.userInfoErr != nil {
+		return oauth.UserInfoOutput{}, f.userInfoErr
+	}
+	return oauth.UserInfoOutput{Subject: in.UserID, Email: "user@example.com"}, nil
+}
+func (f *fakeService) ProviderMetadata(context.Context, oauth.DiscoveryInput) (oauth.ProviderMetadata, error) {
+	return oauth.ProviderMetadata{Issuer: "https://api.example.com/api/v1", JWKSURI: "https://api.example.com/api/v1/oauth/jwks"}, nil
+}
+func (f *fakeService) ProviderKeys(context.Context, oauth.KeysInput) (oauth.KeySet, error) {
+	return oauth.KeySet{Keys: []oauth.JSONWebKey{{KeyType: "RSA", KeyID: "kid-1", Algorithm: "RS256"}}}, nil
+}
+func (f *fakeService) IntrospectToken(_ context.Context, in oauth.IntrospectInput) (oauth.IntrospectOutput, error) {
+	f.lastIntrospect = in
+	return f.introspectOut, nil
+}
+func (f *fakeService) RevokeToken(_ context.Context, in oauth.RevokeInput) error {
+	f.lastRevoke = in
+	return f.revokeErr
+}
+func (f *fakeService) StartDeviceAuthorization(_ context.Context, in oauth.DeviceAuthorizationInput) (oauth.DeviceAuthorizationOutput, error) {
+	f.lastDeviceStart = in
+	return oauth.DeviceAuthorizationOutput{
+		DeviceCode:              "device-code",
+		UserCode:                "BCDF-GHJK",
+		VerificationURI:         "https://example.com/device",
+		VerificationURIComplete: "https://example.com/device?user_code=BCDF-GHJK",
+		ExpiresIn:               10 * time.Minute,
+		Interval:                5 * time.Second,
+	}, nil
+}
+func (f *fakeService) VerifyDevice(_ context.Context, in oauth.VerifyDeviceInput) (oauth.VerifyDeviceOutput, error) {
+	f.lastVerifyDevice = in
+	if f.verifyDeviceErr != nil {
+		return oauth.VerifyDeviceOutput{}, f.verifyDeviceErr
+	}
+	status := domain.DeviceAuthorizationPending
+	if in.Consent == oauth.ConsentApprove {
+		status = domain.DeviceAuthorizationApproved
+	}
+	return oauth.VerifyDeviceOutput{Status: status, ClientID: "client-1", ClientName: "TV", IP: "203.0.113.7", City: "Kyiv"}, nil
+}
+func (f *fakeService) StartQRLogin(context.Context, challenge.StartQRLoginInput) (challenge.StartQRLoginOutput, error) {
+	return challenge.StartQRLoginOutput{ChallengeID: "challenge-1", Code: "qr-code", LoginToken: "login-token", ExpiresIn: 2 * time.Minute}, nil
+}
+func (f *fakeService) ScanQRLogin(_ context.Context, in challenge.ScanQRLoginInput) (challenge.ScanQRLoginOutput, error) {
+	f.lastQRScan = in
+	if f.qrScanErr != nil {
+		return challenge.ScanQRLoginOutput{}, f.qrScanErr
+	}
+	status := domain.ChallengeStatusPending
+	if in.Consent == challenge.QRConsentApprove {
+		status = domain.ChallengeStatusCompleted
+	}
+	return challenge.ScanQRLoginOutput{Status: string(status), IP: "198.51.100.7", UserAgent: "Desktop", City: "Kyiv"}, nil
+}
+func (f *fakeService) QRLoginSession(_ context.Context, in challenge.QRSessionInput) (login.Output, error) {
+	f.lastQRSession = in
+	return f.qrSessionOut, nil
+}
+func (f *fakeService) LogoutAll(_ context.Context, in session.LogoutAllInput) error {
+	f.lastLogoutAll = in
+	return f.logoutErr
+}
+
+func (f *fakeService) StartStepUp(context.Context, challenge.StartStepUpInput) (login.Output, error) {
+	return f.stepUpOut, f.stepUpErr
+}
+
+func (f *fakeService) VerifyStepUp(_ context.Context, in challenge.VerifyStepUpInput) (login.Output, error) {
+	f.lastStepUpVerify = in
+	return f.stepUpOut, f.stepUpErr
+}
+
 func (f *fakeService) ListSessions(context.Context, session.ListInput) (session.Output, error) {
 	return f.listSessionsOut, f.listSessionsErr
 }
@@ -173,25 +406,57 @@ func (f *fakeService) RevokeSession(context.Context, session.RevokeInput) error
 	return f.revokeSessionErr
 }
 
+func (f *fakeService) RenameSession(ctx context.Context, in session.RenameInput) (session.Session, error) {
+	f.lastRename = in
+	f.lastRenameMeta, _ = common.RequestMetaFromContext(ctx)
+	if f.renameSessionErr != nil {
+		return session.Session{}, f.renameSessionErr
+	}
+	return session.Session{ID: in.SessionID, DeviceName: in.Name, DeviceType: "desktop"}, nil
+}
+
 func (f *fakeService) RevokeOtherSessions(context.Context, session.RevokeOthersInput) error {
 	return f.revokeOthersErr
 }
 
+func (f *fakeService) ListTrustedDevices(context.Context, device.ListInput) (device.Output, error) {
+	return f.listDevicesOut, f.listDevicesErr
+}
+
+func (f *fakeService) RevokeTrustedDevice(context.Context, device.RevokeInput) error {
+	return f.revokeDeviceErr
+}
+
 type fakeTokenParser struct {
 	userID    string
 	sessionID string
-	err       error
+	authTime  time.Time
+	// scopes makes the caller a personal access token, or with clientID
+	// an OAuth client, or with clientID and sessionID a session granted to
+	// one.
+	scopes   []string
+	clientID string
+	err      error
 }
 
 func (f *fakeTokenParser) Parse(string) (string, error) { return f.userID, f.err }
-func (f *fakeTokenParser) Issue(string, string, time.Duration) (string, error) {
+func (f *fakeTokenParser) Issue(public.AccessClaims, time.Duration) (string, error) {
 	return "token", nil
 }
-func (f *fakeTokenParser) Verify(string) (public.AuthContext, error) {
+func (f *fakeTokenParser) Verify(context.Context, string) (public.AuthContext, error) {
 	if f.err != nil {
 		return public.AuthContext{}, f.err
 	}
-	return public.AuthContext{UserID: f.userID, SessionID: f.sessionID}, nil
+	if f.clientID != "" && f.sessionID != "" {
+		return public.AuthContext{Kind: public.AuthKindGrant, UserID: f.userID, SessionID: f.sessionID, ClientID: f.clientID, Scopes: f.scopes}, nil
+	}
+	if f.clientID != "" {
+		return public.AuthContext{Kind: public.AuthKindClient, ClientID: f.clientID, Scopes: f.scopes}, nil
+	}
+	if f.scopes != nil {
+		return public.AuthContext{Kind: public.AuthKindPersonalAccessToken, UserID: f.userID, TokenID: "pat-1", Scopes: f.scopes}, nil
+	}
+	return public.AuthContext{Kind: public.AuthKindSession, UserID: f.userID, SessionID: f.sessionID, AuthTime: f.authTime}, nil
 }
 
 type noopUseCase[Cmd any, Resp any] struct{}
@@ -214,7 +479,7 @@ func (stubTelegramUseCase) Execute(context.Context, telegram.Input) (login.Outpu
 
 func newTestServer(svc usersapp.Service, tp *fakeTokenParser) *httptest.Server {
 	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
-		RegisterV1(r, svc, tp)
+		RegisterV1(r, svc, tp, Options{})
 	})
 	return httptest.NewServer(router)
 }
@@ -277,6 +542,287 @@ func TestLoginUnauthorized(t *testing.T) {
 	decodeBody[httputil.ErrorBody](t, resp)
 }
 
+func TestChallengeStepEndpoint(t *testing.T) {
+	svc := &fakeService{challengeOut: login.Output{
+		Status:    "challenge_required",
+		Challenge: &login.ChallengeInfo{ID: "ch-1", RequiredSteps: []string{"totp"}, Steps: []login.StepInfo{{Step: "totp", AttemptsLeft: 2}}},
+	}}
+	server := newTestServer(svc, &fakeTokenParser{})
+	defer server.Close()
+
+	body, _ := json.Marshal(map[string]any{"value": "123456", "trust_device": true})
+	resp, err := http.Post(server.URL+"/api/v1/auth/challenge/ch-1/steps/totp", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if in := svc.lastStepInput; in.ChallengeID != "ch-1" || in.Step != "totp" || in.Value != "123456" || !in.TrustDevice {
+		t.Fatalf("unexpected step input: %+v", in)
+	}
+	out := decodeBody[dto.ChallengeResponse](t, resp)
+	if len(out.Steps) != 1 || out.Steps[0].AttemptsLeft != 2 {
+		t.Fatalf("expected per-step state, got %+v", out)
+	}
+
+	svc.challengeErr = domain.ErrUnknownChallengeStep
+	resp2, err := http.Post(server.URL+"/api/v1/auth/challenge/ch-1/steps/webauthn", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown step, got %d", resp2.StatusCode)
+	}
+}
+
+func TestChallengeEventsStream(t *testing.T) {
+	svc := &fakeService{watchEvents: []challenge.Event{
+		{ID: "100", Status: "pending", RequiredSteps: []string{"email_verification"}, CompletedSteps: []string{}, ExpiresIn: 60},
+		{ID: "200", Status: "completed", RequiredSteps: []string{"email_verification"}, CompletedSteps: []string{"email_verification"}},
+	}}
+	server := newTestServer(svc, &fakeTokenParser{})
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/auth/challenge/ch-1/events", nil)
+	req.Header.Set("Last-Event-ID", "50")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %q", ct)
+	}
+	if in := svc.lastWatchInput; in.ChallengeID != "ch-1" || in.LastEventID != "50" {
+		t.Fatalf("unexpected watch input: %+v", in)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	body := string(raw)
+	for _, want := range []string{
+		"id: 100\nevent: challenge\ndata: {\"status\":\"pending\"",
+		"id: 200\nevent: challenge\ndata: {\"status\":\"completed\"",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in stream, got %q", want, body)
+		}
+	}
+
+	svc.watchErr = domain.ErrUnauthorized
+	resp2, err := http.Get(server.URL + "/api/v1/auth/challenge/unknown/events")
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown challenge, got %d", resp2.StatusCode)
+	}
+}
+
+func TestRecoveryEndpoints(t *testing.T) {
+	readyAt := time.Now().UTC().Add(72 * time.Hour)
+	svc := &fakeService{recoveryOut: recovery.Output{ChallengeID: "ch-1", Status: recovery.StatusWaiting, ExpiresIn: 60, ReadyAt: &readyAt}}
+	server := newTestServer(svc, &fakeTokenParser{})
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/v1/auth/recovery/confirm", "application/json", bytes.NewBufferString(`{"challenge_id":"ch-1","code":"123456"}`))
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	out := decodeBody[dto.RecoveryResponse](t, resp)
+	if out.Status != recovery.StatusWaiting || out.ReadyAt == nil {
+		t.Fatalf("unexpected recovery response: %+v", out)
+	}
+
+	resp2, err := http.Post(server.URL+"/api/v1/auth/recovery/cancel", "application/json", bytes.NewBufferString(`{"challenge_id":"ch-1","token":"cancel"}`))
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusOK || svc.lastRecoveryCancel.Token != "cancel" {
+		t.Fatalf("expected cancel to pass the token, got %d %+v", resp2.StatusCode, svc.lastRecoveryCancel)
+	}
+
+	svc.recoveryErr = domain.ErrRecoveryNotReady
+	resp3, err := http.Post(server.URL+"/api/v1/auth/recovery/complete", "application/json", bytes.NewBufferString(`{"challenge_id":"ch-1"}`))
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp3.Body.Close()
+	if resp3.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 before the waiting period ends, got %d", resp3.StatusCode)
+	}
+}
+
+func TestStepUpEndpoints(t *testing.T) {
+	svc := &fakeService{changePasswordErr: domain.ErrReauthenticationRequired}
+	tp := &fakeTokenParser{userID: "user", sessionID: "sess"}
+	server := newTestServer(svc, tp)
+	defer server.Close()
+
+	post := func(path, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		return resp
+	}
+
+	resp := post("/api/v1/auth/password/change", `{"current_password":"old","new_password":"newpassword"}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", resp.StatusCode)
+	}
+	if body := decodeBody[httputil.ErrorBody](t, resp); body.Error.Code != "reauthentication_required" {
+		t.Fatalf("unexpected error body: %+v", body)
+	}
+
+	svc.stepUpOut = login.Output{Status: "challenge_required", Challenge: &login.ChallengeInfo{ID: "ch-1", Type: domain.ChallengeTypeStepUp, RequiredSteps: []string{"password"}}}
+	resp2 := post("/api/v1/auth/reauth", ``)
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp2.StatusCode)
+	}
+	if out := decodeBody[dto.ChallengeResponse](t, resp2); out.ChallengeID != "ch-1" || out.Status != "challenge_required" {
+		t.Fatalf("unexpected challenge: %+v", out)
+	}
+
+	svc.stepUpOut = login.Output{Status: "completed", AccessToken: "acc"}
+	resp3 := post("/api/v1/auth/reauth/ch-1/steps/password", `{"value":"secret"}`)
+	defer resp3.Body.Close()
+	if resp3.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp3.StatusCode)
+	}
+	if out := decodeBody[dto.StepUpResponse](t, resp3); out.AccessToken != "acc" || out.Status != "completed" {
+		t.Fatalf("unexpected step-up response: %+v", out)
+	}
+	if in := svc.lastStepUpVerify; in.SessionID != "sess" || in.ChallengeID != "ch-1" || in.Step != "password" || in.Value != "secret" {
+		t.Fatalf("unexpected step-up input: %+v", in)
+	}
+}
+
+func TestLogoutEndpoints(t *testing.T) {
+	svc := &fakeService{}
+	tp := &fakeTokenParser{userID: "user", sessionID: "sess"}
+	server := newTestServer(svc, tp)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Clear-Site-Data") == "" {
+		t.Fatal("expected Clear-Site-Data header")
+	}
+	if svc.lastLogout.UserID != "user" || svc.lastLogout.SessionID != "sess" {
+		t.Fatalf("expected the access token's session, got %+v", svc.lastLogout)
+	}
+
+	tp.err = errors.New("expired")
+	resp2, err := http.Post(server.URL+"/api/v1/auth/logout", "application/json", bytes.NewBufferString(`{"refresh_token":"ref"}`))
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusOK || svc.lastLogout.RefreshToken != "ref" || svc.lastLogout.SessionID != "" {
+		t.Fatalf("expected logout by refresh token, got %d %+v", resp2.StatusCode, svc.lastLogout)
+	}
+
+	tp.err = nil
+	req3, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/logout/all", nil)
+	req3.Header.Set("Authorization", "Bearer token")
+	resp3, err := http.DefaultClient.Do(req3)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp3.Body.Close()
+	if resp3.StatusCode != http.StatusOK || resp3.Header.Get("Clear-Site-Data") == "" || svc.lastLogoutAll.UserID != "user" {
+		t.Fatalf("expected logout everywhere, got %d %+v", resp3.StatusCode, svc.lastLogoutAll)
+	}
+}
+
+func TestRenameSessionEndpoint(t *testing.T) {
+	svc := &fakeService{}
+	tp := &fakeTokenParser{userID: "user", sessionID: "sess"}
+	server := newTestServer(svc, tp)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/sessions/rename", bytes.NewBufferString(`{"session_id":"sess","name":"Work laptop"}`))
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	body := decodeBody[dto.SessionResponse](t, resp)
+	if body.DeviceName != "Work laptop" || !body.Current || svc.lastRename.UserID != "user" {
+		t.Fatalf("unexpected rename response %+v for %+v", body, svc.lastRename)
+	}
+
+	svc.renameSessionErr = domain.ErrInvalidDeviceName
+	req2, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/sessions/rename", bytes.NewBufferString(`{"session_id":"sess","name":"x"}`))
+	req2.Header.Set("Authorization", "Bearer token")
+	resp2, err := http.DefaultClient.Do(req2)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp2.StatusCode)
+	}
+}
+
+type geoStub struct{}
+
+func (geoStub) Locate(ip string) (public.Location, bool) {
+	if ip != "81.2.69.160" {
+		return public.Location{}, false
+	}
+	return public.Location{Country: "DE", City: "Berlin"}, true
+}
+
+func TestRequestMetaIncludesLocation(t *testing.T) {
+	svc := &fakeService{}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, &fakeTokenParser{userID: "user", sessionID: "sess"}, Options{Geo: geoStub{}})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/sessions/rename", bytes.NewBufferString(`{"session_id":"sess","name":"Laptop"}`))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-Forwarded-For", "81.2.69.160")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp.Body.Close()
+	if meta := svc.lastRenameMeta; meta.IP != "81.2.69.160" || meta.Country != "DE" || meta.City != "Berlin" {
+		t.Fatalf("expected the client location in the request metadata, got %+v", meta)
+	}
+}
+
 func TestProfileEndpoints(t *testing.T) {
 	svc := &fakeService{
 		getOut:    profile.Output{UserID: "user", DisplayName: "User"},
@@ -359,44 +905,326 @@ func TestRefreshUnauthorized(t *testing.T) {
 	decodeBody[httputil.ErrorBody](t, resp)
 }
 
-func TestLinkConflict(t *testing.T) {
-	svc := &fakeService{linkErr: domain.ErrIdentityAlreadyLinked}
-	tp := &fakeTokenParser{userID: "user"}
-	server := newTestServer(svc, tp)
+func TestRefreshReportsSessionExpiry(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	relogin := expires.Add(24 * time.Hour)
+	svc := &fakeService{refreshOut: refresh.Output{AccessToken: "access", RefreshToken: "next", RefreshExpiresAt: expires, ReloginAt: &relogin}}
+	server := newTestServer(svc, &fakeTokenParser{})
 	defer server.Close()
 
-	body, _ := json.Marshal(map[string]string{"provider": "github", "provider_user_id": "gh-1"})
-	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/link", bytes.NewReader(body))
-	req.Header.Set("Authorization", "Bearer token")
-	resp, _ := http.DefaultClient.Do(req)
-	if resp.StatusCode != http.StatusConflict {
-		t.Fatalf("expected 409, got %d", resp.StatusCode)
+	body, _ := json.Marshal(map[string]string{"refresh_token": "old"})
+	resp, _ := http.Post(server.URL+"/api/v1/auth/refresh", "application/json", bytes.NewReader(body))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
 	}
 	defer resp.Body.Close()
-	decodeBody[httputil.ErrorBody](t, resp)
+	out := decodeBody[dto.RefreshResponse](t, resp)
+	if out.RefreshToken != "next" || !out.RefreshExpiresAt.Equal(expires) || out.ReloginAt == nil || !out.ReloginAt.Equal(relogin) {
+		t.Fatalf("unexpected refresh response: %+v", out)
+	}
 }
 
-func TestRegisterEndpointTransactionalCommit(t *testing.T) {
-	svc := &fakeService{registerOut: login.Output{UserID: "id", AccessToken: "access", RefreshToken: "refresh"}}
-	server := newTestServer(svc, &fakeTokenParser{})
+func TestCookieModeKeepsRefreshTokenOutOfBody(t *testing.T) {
+	svc := &fakeService{
+		loginOut:   login.Output{UserID: "id", AccessToken: "access", RefreshToken: "refresh"},
+		refreshOut: refresh.Output{AccessToken: "access2", RefreshToken: "refresh2", RefreshExpiresAt: time.Now().Add(time.Hour)},
+	}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, &fakeTokenParser{}, Options{Cookies: CookieConfig{Enabled: true, Secure: true, TrustedOrigins: []string{"https://app.example.com"}}})
+	})
+	server := httptest.NewServer(router)
 	defer server.Close()
 
-	body, _ := json.Marshal(map[string]string{"email": "user@example.com", "password": "password123", "display_name": "User"})
-	resp, err := http.Post(server.URL+"/api/v1/auth/register", "application/json", bytes.NewReader(body))
+	body, _ := json.Marshal(map[string]string{"email": "user@example.com", "password": "password123"})
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/login", bytes.NewReader(body))
+	req.Header.Set("X-Auth-Mode", "cookie")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("http error: %v", err)
 	}
 	defer resp.Body.Close()
+	out := decodeBody[dto.LoginResponse](t, resp)
+	if out.AccessToken != "access" || out.RefreshToken != "" || out.CSRFToken == "" {
+		t.Fatalf("expected the refresh token to stay out of the body, got %+v", out.TokensResponse)
+	}
+	cookies := map[string]*http.Cookie{}
+	for _, c := range resp.Cookies() {
+		cookies[c.Name] = c
+	}
+	refreshCookie, csrfCookie := cookies["refresh_token"], cookies["csrf_token"]
+	if refreshCookie == nil || refreshCookie.Value != "refresh" || !refreshCookie.HttpOnly || !refreshCookie.Secure || refreshCookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected an HttpOnly refresh cookie, got %+v", refreshCookie)
+	}
+	if csrfCookie == nil || csrfCookie.Value != out.CSRFToken || csrfCookie.HttpOnly {
+		t.Fatalf("expected a readable csrf cookie, got %+v", csrfCookie)
+	}
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		t.Fatalf("expected 201, got %d: %s", resp.StatusCode, string(body))
+	refreshWith := func(csrf, origin string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/refresh", nil)
+		req.Header.Set("X-Auth-Mode", "cookie")
+		req.AddCookie(refreshCookie)
+		req.AddCookie(csrfCookie)
+		if csrf != "" {
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		return resp
 	}
 
-	decodeBody[dto.LoginResponse](t, resp)
-}
+	for _, tc := range []struct{ csrf, origin string }{{"", ""}, {"wrong", ""}, {out.CSRFToken, "https://evil.example.com"}} {
+		resp := refreshWith(tc.csrf, tc.origin)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected csrf failure for %+v, got %d", tc, resp.StatusCode)
+		}
+	}
 
-func TestRegisterEndpointRollbackOnFailure(t *testing.T) {
+	resp = refreshWith(out.CSRFToken, "https://app.example.com")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || svc.lastRefresh.RefreshToken != "refresh" {
+		t.Fatalf("expected a refresh from the cookie, got %d %+v", resp.StatusCode, svc.lastRefresh)
+	}
+	refreshed := decodeBody[dto.RefreshResponse](t, resp)
+	if refreshed.RefreshToken != "" || refreshed.CSRFToken == "" || refreshed.CSRFToken == out.CSRFToken {
+		t.Fatalf("expected a rotated csrf token and no refresh token, got %+v", refreshed.TokensResponse)
+	}
+
+	// Clients that do not ask for cookies keep the JSON mode.
+	resp2, err := http.Post(server.URL+"/api/v1/auth/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp2.Body.Close()
+	if plain := decodeBody[dto.LoginResponse](t, resp2); plain.RefreshToken != "refresh" || len(resp2.Cookies()) != 0 {
+		t.Fatalf("expected the json mode, got %+v cookies=%v", plain.TokensResponse, resp2.Cookies())
+	}
+}
+
+func TestRevocationFeedRequiresServiceToken(t *testing.T) {
+	revokedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	svc := &fakeService{revocationsOut: session.FeedOutput{
+		Revocations: []session.Revocation{{SessionID: "s-1", RevokedAt: revokedAt}},
+		NextCursor:  "next",
+		TTL:         15 * time.Minute,
+	}}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, &fakeTokenParser{}, Options{RevocationFeedToken: "feed-token"})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	get := func(query, token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/auth/revocations"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		return resp
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		resp := get("", token)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected 401 for token %q, got %d", token, resp.StatusCode)
+		}
+	}
+	resp := get("?limit=zero", "feed-token")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad limit, got %d", resp.StatusCode)
+	}
+
+	resp = get("?cursor=abc&limit=50", "feed-token")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || svc.lastFeed.Cursor != "abc" || svc.lastFeed.Limit != 50 {
+		t.Fatalf("unexpected feed call: %d %+v", resp.StatusCode, svc.lastFeed)
+	}
+	out := decodeBody[dto.RevocationsResponse](t, resp)
+	if len(out.Revocations) != 1 || out.Revocations[0].SessionID != "s-1" || !out.Revocations[0].RevokedAt.Equal(revokedAt) || out.NextCursor != "next" || out.TTL != 900 {
+		t.Fatalf("unexpected feed: %+v", out)
+	}
+
+	// Without a token the feed is not mounted at all.
+	plain := newTestServer(svc, &fakeTokenParser{})
+	defer plain.Close()
+	resp2, err := http.Get(plain.URL + "/api/v1/auth/revocations")
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected the feed to be disabled, got %d", resp2.StatusCode)
+	}
+}
+
+func TestInvalidateTokensRequiresAdminToken(t *testing.T) {
+	svc := &fakeService{}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, &fakeTokenParser{}, Options{AdminToken: "admin-token"})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	post := func(body map[string]string, token string) *http.Response {
+		payload, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/admin/tokens/invalidate", bytes.NewReader(payload))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		return resp
+	}
+
+	resp := post(map[string]string{"reason": "incident"}, "wrong")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || svc.lastInvalidate.Reason != "" {
+		t.Fatalf("expected 401 without the admin token, got %d", resp.StatusCode)
+	}
+
+	resp = post(map[string]string{"user_id": "user-1", "reason": "stolen laptop"}, "admin-token")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if svc.lastInvalidate.UserID != "user-1" || svc.lastInvalidate.Reason != "stolen laptop" || svc.lastInvalidate.Actor != "admin_api" {
+		t.Fatalf("unexpected invalidation: %+v", svc.lastInvalidate)
+	}
+	out := decodeBody[dto.TokenEpochResponse](t, resp)
+	if out.UserID != "user-1" || out.NotBefore.IsZero() {
+		t.Fatalf("unexpected epoch: %+v", out)
+	}
+
+	svc.invalidateErr = domain.ErrReasonRequired
+	resp2 := post(map[string]string{}, "admin-token")
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a reason, got %d", resp2.StatusCode)
+	}
+}
+
+func TestPersonalAccessTokensStayWithinTheirScopes(t *testing.T) {
+	svc := &fakeService{}
+	tp := &fakeTokenParser{userID: "user", scopes: []string{"profile:read"}}
+	server := newTestServer(svc, tp)
+	defer server.Close()
+
+	do := func(method, path string, body any) *http.Response {
+		payload, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+"/api/v1"+path, bytes.NewReader(payload))
+		req.Header.Set("Authorization", "Bearer xbp_token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := do(http.MethodGet, "/me", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the granted scope to pass, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPatch, "/me", map[string]string{"display_name": "x"}); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a missing scope to be refused, got %d", resp.StatusCode)
+	}
+	// Session-only routes refuse personal access tokens whatever their scopes.
+	if resp := do(http.MethodPost, "/auth/tokens", map[string]any{"name": "ci", "scopes": []string{"profile:read"}}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a session-only route to refuse the token, got %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, "/auth/password/change", map[string]string{}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a session-only route to refuse the token, got %d", resp.StatusCode)
+	}
+}
+
+func TestCreateAccessTokenShowsTheTokenOnce(t *testing.T) {
+	svc := &fakeService{}
+	authTime := time.Now()
+	tp := &fakeTokenParser{userID: "user", sessionID: "s-1", authTime: authTime}
+	server := newTestServer(svc, tp)
+	defer server.Close()
+
+	body, _ := json.Marshal(map[string]any{"name": "ci", "scopes": []string{"profile:read"}, "expires_in_days": 7})
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/tokens", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	if svc.lastTokenIn.ExpiresIn != 7*24*time.Hour || !svc.lastTokenIn.AuthTime.Equal(authTime) || svc.lastTokenIn.Name != "ci" {
+		t.Fatalf("unexpected input: %+v", svc.lastTokenIn)
+	}
+	out := decodeBody[dto.CreateAccessTokenResponse](t, resp)
+	if out.Token != "xbp_secret" || out.ID != "pat-1" || len(out.Scopes) != 1 {
+		t.Fatalf("unexpected token: %+v", out)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/api/v1/auth/tokens", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp2.Body.Close()
+	raw, _ := io.ReadAll(resp2.Body)
+	if resp2.StatusCode != http.StatusOK || strings.Contains(string(raw), `"token"`) || !strings.Contains(string(raw), `"prefix":"xbp_secret"`) {
+		t.Fatalf("expected listed tokens without the token itself, got %d %s", resp2.StatusCode, raw)
+	}
+}
+
+func TestLinkConflict(t *testing.T) {
+	svc := &fakeService{linkErr: domain.ErrIdentityAlreadyLinked}
+	tp := &fakeTokenParser{userID: "user"}
+	server := newTestServer(svc, tp)
+	defer server.Close()
+
+	body, _ := json.Marshal(map[string]string{"provider": "github", "provider_user_id": "gh-1"})
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/link", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	resp, _ := http.DefaultClient.Do(req)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", resp.StatusCode)
+	}
+	defer resp.Body.Close()
+	decodeBody[httputil.ErrorBody](t, resp)
+}
+
+func TestRegisterEndpointTransactionalCommit(t *testing.T) {
+	svc := &fakeService{registerOut: login.Output{UserID: "id", AccessToken: "access", RefreshToken: "refresh"}}
+	server := newTestServer(svc, &fakeTokenParser{})
+	defer server.Close()
+
+	body, _ := json.Marshal(map[string]string{"email": "user@example.com", "password": "password123", "display_name": "User"})
+	resp, err := http.Post(server.URL+"/api/v1/auth/register", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 201, got %d: %s", resp.StatusCode, string(body))
+	}
+
+	decodeBody[dto.LoginResponse](t, resp)
+}
+
+func TestRegisterEndpointRollbackOnFailure(t *testing.T) {
 	svc := &fakeService{registerErr: errors.New("fail")}
 	auth := &fakeTokenParser{}
 	server := newTestServer(svc, auth)
@@ -431,3 +1259,496 @@ func decodeBody[T any](t *testing.T, resp *http.Response) T {
 
 	return payload
 }
+
+func TestOAuthTokenEndpoint(t *testing.T) {
+	svc := &fakeService{}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, &fakeTokenParser{}, Options{OAuthClients: true})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	post := func(form url.Values, user, pass string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if user != "" {
+			req.SetBasicAuth(url.QueryEscape(user), url.QueryEscape(pass))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		return resp
+	}
+
+	resp := post(url.Values{"grant_type": {"client_credentials"}, "scope": {"revocations:read"}}, "client-1", "xbs_a+b")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected 200 with no-store, got %d %q", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+	out := decodeBody[dto.OAuthTokenResponse](t, resp)
+	resp.Body.Close()
+	if out.AccessToken != "client-token" || out.TokenType != "Bearer" || out.ExpiresIn != 900 || out.Scope != "revocations:read" {
+		t.Fatalf("unexpected token response: %+v", out)
+	}
+	if in := svc.lastClientToken; in.GrantType != "client_credentials" || in.Scope != "revocations:read" || in.Credentials.ClientID != "client-1" || in.Credentials.ClientSecret != "xbs_a+b" {
+		t.Fatalf("unexpected token request: %+v", in)
+	}
+
+	resp = post(url.Values{"grant_type": {"client_credentials"}, "client_assertion_type": {oauth.AssertionTypeJWTBearer}, "client_assertion": {"jwt"}}, "", "")
+	resp.Body.Close()
+	if creds := svc.lastClientToken.Credentials; resp.StatusCode != http.StatusOK || creds.Assertion != "jwt" || creds.AssertionType != oauth.AssertionTypeJWTBearer {
+		t.Fatalf("expected assertions to be read from the form, got %d %+v", resp.StatusCode, creds)
+	}
+
+	resp = post(url.Values{"grant_type": {"client_credentials"}, "client_secret": {"other"}}, "client-1", "secret")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for two authentication methods, got %d", resp.StatusCode)
+	}
+	errBody := decodeBody[dto.OAuthErrorResponse](t, resp)
+	resp.Body.Close()
+	if errBody.Error != "invalid_request" {
+		t.Fatalf("unexpected error: %+v", errBody)
+	}
+
+	svc.clientTokenErr = domain.ErrInvalidClient
+	resp = post(url.Values{"grant_type": {"client_credentials"}}, "client-1", "wrong")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected 401 with a Basic challenge, got %d", resp.StatusCode)
+	}
+
+	svc.clientTokenErr = domain.ErrUnsupportedGrantType
+	resp = post(url.Values{"grant_type": {"password"}}, "client-1", "secret")
+	errBody = decodeBody[dto.OAuthErrorResponse](t, resp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || errBody.Error != "unsupported_grant_type" {
+		t.Fatalf("expected unsupported_grant_type, got %d %+v", resp.StatusCode, errBody)
+	}
+
+	// Without OAuth clients the endpoint is not mounted.
+	plain := newTestServer(svc, &fakeTokenParser{})
+	defer plain.Close()
+	resp, err := http.PostForm(plain.URL+"/api/v1/oauth/token", url.Values{"grant_type": {"client_credentials"}})
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected the token endpoint to be disabled, got %d", resp.StatusCode)
+	}
+}
+
+func TestRevocationFeedAcceptsClientsWithTheScope(t *testing.T) {
+	svc := &fakeService{}
+	tp := &fakeTokenParser{clientID: "client-1", scopes: []string{domain.ScopeRevocationsRead}}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, tp, Options{OAuthClients: true, RevocationFeedToken: "feed-token"})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	get := func(path, token string) int {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get("/api/v1/auth/revocations", "client-token"); status != http.StatusOK {
+		t.Fatalf("expected a client with the scope to read the feed, got %d", status)
+	}
+	if status := get("/api/v1/auth/revocations", "feed-token"); status != http.StatusOK {
+		t.Fatalf("expected the service token to keep working, got %d", status)
+	}
+	// Client tokens are not user tokens.
+	if status := get("/api/v1/me", "client-token"); status != http.StatusForbidden {
+		t.Fatalf("expected a client to be kept off user routes, got %d", status)
+	}
+	if status := get("/api/v1/auth/devices", "client-token"); status != http.StatusUnauthorized {
+		t.Fatalf("expected a client to be refused by session routes, got %d", status)
+	}
+
+	tp.scopes = []string{"other"}
+	if status := get("/api/v1/auth/revocations", "client-token"); status != http.StatusForbidden {
+		t.Fatalf("expected 403 without the scope, got %d", status)
+	}
+	tp.clientID = ""
+	tp.scopes = nil
+	if status := get("/api/v1/auth/revocations", "session-token"); status != http.StatusUnauthorized {
+		t.Fatalf("expected user sessions to be refused, got %d", status)
+	}
+}
+
+func TestRegisterClientShowsTheSecretOnce(t *testing.T) {
+	svc := &fakeService{}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, &fakeTokenParser{}, Options{AdminToken: "admin-token"})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	payload, _ := json.Marshal(map[string]any{"name": "billing", "scopes": []string{"revocations:read"}})
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/admin/oauth/clients", bytes.NewReader(payload))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	out := decodeBody[dto.RegisterClientResponse](t, resp)
+	if out.ClientID != "client-1" || out.ClientSecret != "xbs_secret" || out.Name != "billing" {
+		t.Fatalf("unexpected client: %+v", out)
+	}
+	if svc.lastClientReg.Actor != "admin_api" || len(svc.lastClientReg.Scopes) != 1 {
+		t.Fatalf("unexpected registration: %+v", svc.lastClientReg)
+	}
+}
+
+func TestOAuthIntrospectAndRevokeEndpoints(t *testing.T) {
+	expires := time.Unix(1700000000, 0)
+	svc := &fakeService{introspectOut: oauth.IntrospectOutput{Active: true, TokenType: oauth.TokenTypeAccessToken, Subject: "user-1", SessionID: "session-1", Scopes: []string{"openid", "email"}, ExpiresAt: expires}}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, &fakeTokenParser{}, Options{OAuthClients: true})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	post := func(path string, form url.Values) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("client-1", "xbs_secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		return resp
+	}
+
+	resp := post("/api/v1/oauth/introspect", url.Values{"token": {"access"}, "token_type_hint": {"access_token"}})
+	out := decodeBody[map[string]any](t, resp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || out["active"] != true || out["sub"] != "user-1" || out["sid"] != "session-1" || out["scope"] != "openid email" || out["exp"] != float64(expires.Unix()) {
+		t.Fatalf("unexpected introspection: %d %v", resp.StatusCode, out)
+	}
+	if _, ok := out["iat"]; ok {
+		t.Fatalf("expected unknown times to be left out, got %v", out)
+	}
+	if in := svc.lastIntrospect; in.Token != "access" || in.TokenTypeHint != "access_token" || in.Credentials.ClientID != "client-1" {
+		t.Fatalf("unexpected introspection input: %+v", in)
+	}
+
+	svc.introspectOut = oauth.IntrospectOutput{Active: false, Subject: "ignored"}
+	resp = post("/api/v1/oauth/introspect", url.Values{"token": {"expired"}})
+	out = decodeBody[map[string]any](t, resp)
+	resp.Body.Close()
+	if len(out) != 1 || out["active"] != false {
+		t.Fatalf("expected inactive tokens to only report active, got %v", out)
+	}
+
+	resp = post("/api/v1/oauth/revoke", url.Values{"token": {"refresh"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || svc.lastRevoke.Token != "refresh" {
+		t.Fatalf("expected 200 for a revocation, got %d %+v", resp.StatusCode, svc.lastRevoke)
+	}
+	svc.revokeErr = domain.ErrUnsupportedTokenType
+	resp = post("/api/v1/oauth/revoke", url.Values{"token": {"access"}})
+	if errOut := decodeBody[dto.OAuthErrorResponse](t, resp); resp.StatusCode != http.StatusBadRequest || errOut.Error != "unsupported_token_type" {
+		t.Fatalf("expected unsupported_token_type, got %d %+v", resp.StatusCode, errOut)
+	}
+	resp.Body.Close()
+	svc.revokeErr = domain.ErrInvalidClient
+	resp = post("/api/v1/oauth/revoke", url.Values{"token": {"refresh"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected a Basic challenge for a refused client, got %d", resp.StatusCode)
+	}
+}
+
+func TestDeviceFlowEndpoints(t *testing.T) {
+	svc := &fakeService{}
+	tp := &fakeTokenParser{userID: "user-1", sessionID: "session-1"}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, tp, Options{DeviceFlow: true})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.PostForm(server.URL+"/api/v1/oauth/device_authorization", url.Values{"client_id": {"client-1"}})
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	out := decodeBody[dto.DeviceAuthorizationResponse](t, resp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || out.DeviceCode != "device-code" || out.UserCode != "BCDF-GHJK" || out.ExpiresIn != 600 || out.Interval != 5 || out.VerificationURIComplete == "" {
+		t.Fatalf("unexpected device authorization: %d %+v", resp.StatusCode, out)
+	}
+	if svc.lastDeviceStart.Credentials.ClientID != "client-1" {
+		t.Fatalf("expected the client id to be passed, got %+v", svc.lastDeviceStart)
+	}
+
+	svc.clientTokenErr = domain.ErrAuthorizationPending
+	resp, err = http.PostForm(server.URL+"/api/v1/oauth/token", url.Values{"grant_type": {oauth.GrantTypeDeviceCode}, "device_code": {"device-code"}, "client_id": {"client-1"}})
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	if errOut := decodeBody[dto.OAuthErrorResponse](t, resp); resp.StatusCode != http.StatusBadRequest || errOut.Error != "authorization_pending" {
+		t.Fatalf("expected authorization_pending, got %d %+v", resp.StatusCode, errOut)
+	}
+	resp.Body.Close()
+	if svc.lastClientToken.DeviceCode != "device-code" {
+		t.Fatalf("expected the device code to be passed, got %+v", svc.lastClientToken)
+	}
+
+	verify := func(body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/oauth/device", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		return resp
+	}
+	resp = verify(`{"user_code":"bcdf-ghjk"}`)
+	device := decodeBody[dto.VerifyDeviceResponse](t, resp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || device.Status != "pending" || device.ClientName != "TV" || device.IP != "203.0.113.7" {
+		t.Fatalf("unexpected device lookup: %d %+v", resp.StatusCode, device)
+	}
+	if in := svc.lastVerifyDevice; in.UserID != "user-1" || in.SessionID != "session-1" || in.UserCode != "bcdf-ghjk" {
+		t.Fatalf("unexpected verification input: %+v", in)
+	}
+	resp = verify(`{"user_code":"bcdf-ghjk","consent":"approve"}`)
+	device = decodeBody[dto.VerifyDeviceResponse](t, resp)
+	resp.Body.Close()
+	if device.Status != "approved" {
+		t.Fatalf("expected the device to be approved, got %+v", device)
+	}
+
+	svc.verifyDeviceErr = domain.ErrInvalidUserCode
+	resp = verify(`{"user_code":"XXXX-XXXX"}`)
+	if errOut := decodeBody[httputil.ErrorBody](t, resp); resp.StatusCode != http.StatusBadRequest || errOut.Error.Code != "invalid_user_code" {
+		t.Fatalf("expected invalid_user_code, got %d %+v", resp.StatusCode, errOut)
+	}
+	resp.Body.Close()
+
+	tp.err = errors.New("no token")
+	resp = verify(`{"user_code":"bcdf-ghjk"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the verification route to require a login, got %d", resp.StatusCode)
+	}
+}
+
+func TestQRLoginEndpoints(t *testing.T) {
+	svc := &fakeService{qrSessionOut: login.Output{
+		Status:    "challenge_required",
+		Challenge: &login.ChallengeInfo{ID: "challenge-1", Type: domain.ChallengeTypeQRLogin, RequiredSteps: []string{"qr_approval"}, Status: "pending", ExpiresIn: 90},
+	}}
+	tp := &fakeTokenParser{userID: "user-1", sessionID: "session-1"}
+	server := newTestServer(svc, tp)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/v1/auth/qr/start", "application/json", nil)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	start := decodeBody[dto.QRLoginStartResponse](t, resp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || start.ChallengeID != "challenge-1" || start.QRCode != "qr-code" || start.LoginToken != "login-token" || start.ExpiresIn != 120 {
+		t.Fatalf("unexpected QR login: %d %+v", resp.StatusCode, start)
+	}
+
+	poll := func() *http.Response {
+		resp, err := http.Post(server.URL+"/api/v1/auth/qr/session", "application/json", strings.NewReader(`{"challenge_id":"challenge-1","login_token":"login-token"}`))
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		return resp
+	}
+	resp = poll()
+	pending := decodeBody[dto.ChallengeResponse](t, resp)
+	resp.Body.Close()
+	if pending.Status != "challenge_required" || pending.ChallengeID != "challenge-1" || pending.Type != "qr_login" {
+		t.Fatalf("expected the pending challenge, got %+v", pending)
+	}
+	if svc.lastQRSession.LoginToken != "login-token" {
+		t.Fatalf("expected the login token to be passed, got %+v", svc.lastQRSession)
+	}
+
+	scan := func(body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/auth/qr/scan", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		return resp
+	}
+	resp = scan(`{"qr_code":"qr-code"}`)
+	desktop := decodeBody[dto.QRLoginScanResponse](t, resp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || desktop.Status != "pending" || desktop.IP != "198.51.100.7" || desktop.UserAgent != "Desktop" {
+		t.Fatalf("unexpected desktop lookup: %d %+v", resp.StatusCode, desktop)
+	}
+	if in := svc.lastQRScan; in.UserID != "user-1" || in.SessionID != "session-1" || in.Code != "qr-code" {
+		t.Fatalf("unexpected scan input: %+v", in)
+	}
+	resp = scan(`{"qr_code":"qr-code","consent":"approve"}`)
+	desktop = decodeBody[dto.QRLoginScanResponse](t, resp)
+	resp.Body.Close()
+	if desktop.Status != "completed" {
+		t.Fatalf("expected the login to be approved, got %+v", desktop)
+	}
+
+	svc.qrSessionOut = login.Output{UserID: "user-1", AccessToken: "access", RefreshToken: "refresh", Status: "completed"}
+	resp = poll()
+	session := decodeBody[dto.LoginResponse](t, resp)
+	resp.Body.Close()
+	if session.AccessToken != "access" || session.RefreshToken != "refresh" || session.UserID != "user-1" {
+		t.Fatalf("expected the desktop session, got %+v", session)
+	}
+
+	svc.qrScanErr = domain.ErrInvalidQRCode
+	resp = scan(`{"qr_code":"stale"}`)
+	if errOut := decodeBody[httputil.ErrorBody](t, resp); resp.StatusCode != http.StatusBadRequest || errOut.Error.Code != "invalid_qr_code" {
+		t.Fatalf("expected invalid_qr_code, got %d %+v", resp.StatusCode, errOut)
+	}
+	resp.Body.Close()
+
+	tp.err = errors.New("no token")
+	resp = scan(`{"qr_code":"qr-code"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the scan route to require a login, got %d", resp.StatusCode)
+	}
+}
+
+func TestOIDCEndpoints(t *testing.T) {
+	svc := &fakeService{authorizeOut: oauth.AuthorizeOutput{
+		Status:  oauth.AuthorizationConsentRequired,
+		Consent: &oauth.ConsentRequest{ClientID: "client-1", ClientName: "Web", Scopes: []string{"openid"}},
+	}}
+	tp := &fakeTokenParser{userID: "user-1", sessionID: "session-1"}
+	router := phttp.NewRouter(phttp.RouterDeps{Logger: stubLogger{}, Timeout: time.Second}, func(r chi.Router) {
+		RegisterV1(r, svc, tp, Options{OIDC: true})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := noRedirect.Get(server.URL + "/api/v1/oauth/authorize?client_id=client-1&response_type=code")
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "https://login.example.com/?client_id=client-1" {
+		t.Fatalf("expected a redirect to the login page, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	svc.startAuthErr = domain.ErrInvalidRedirectURI
+	resp, err = noRedirect.Get(server.URL + "/api/v1/oauth/authorize?client_id=client-1")
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	if out := decodeBody[dto.OAuthErrorResponse](t, resp); resp.StatusCode != http.StatusBadRequest || out.Error != "invalid_request" {
+		t.Fatalf("expected an untrusted redirect URI to be answered here, got %d %+v", resp.StatusCode, out)
+	}
+	resp.Body.Close()
+
+	body, _ := json.Marshal(map[string]string{"client_id": "client-1", "scope": "openid", "consent": "approve"})
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/oauth/authorize", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer session-token")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	out := decodeBody[dto.AuthorizeResponse](t, resp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || out.Status != "consent_required" || out.Consent == nil || out.Consent.ClientName != "Web" {
+		t.Fatalf("unexpected authorize response: %d %+v", resp.StatusCode, out)
+	}
+	if in := svc.lastAuthorize; in.UserID != "user-1" || in.SessionID != "session-1" || in.Consent != "approve" || in.Request.Scope != "openid" {
+		t.Fatalf("unexpected authorize input: %+v", in)
+	}
+
+	// Tokens of sessions granted to a client reach userinfo with openid,
+	// but not the user's own routes.
+	tp.clientID, tp.scopes = "client-1", []string{"openid"}
+	req, _ = http.NewRequest(http.MethodPost, server.URL+"/api/v1/oauth/authorize", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer granted-token")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a granted token to be refused by RequireJWT, got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/api/v1/oauth/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer granted-token")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	info := decodeBody[dto.UserInfoResponse](t, resp)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || info.Subject != "user-1" || info.Email != "user@example.com" {
+		t.Fatalf("unexpected userinfo response: %d %+v", resp.StatusCode, info)
+	}
+
+	svc.userInfoErr = domain.ErrInsufficientScope
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(resp.Header.Get("WWW-Authenticate"), "insufficient_scope") {
+		t.Fatalf("expected a bearer insufficient_scope error, got %d %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+
+	resp, err = http.Get(server.URL + "/api/v1/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	meta := decodeBody[dto.ProviderMetadataResponse](t, resp)
+	resp.Body.Close()
+	if meta.Issuer != "https://api.example.com/api/v1" || meta.JWKSURI == "" {
+		t.Fatalf("unexpected discovery document: %+v", meta)
+	}
+
+	resp, err = http.Get(server.URL + "/api/v1/oauth/jwks")
+	if err != nil {
+		t.Fatalf("http error: %v", err)
+	}
+	keys := decodeBody[dto.JSONWebKeySetResponse](t, resp)
+	resp.Body.Close()
+	if len(keys.Keys) != 1 || keys.Keys[0].KeyID != "kid-1" {
+		t.Fatalf("unexpected key set: %+v", keys)
+	}
+}
+
+func TestOIDCEndpointsUnmountedByDefault(t *testing.T) {
+	server := newTestServer(&fakeService{}, &fakeTokenParser{})
+	defer server.Close()
+
+	for _, path := range []string{"/api/v1/oauth/authorize", "/api/v1/oauth/jwks", "/api/v1/.well-known/openid-configuration"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("http error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected %s to be unmounted, got %d", path, resp.StatusCode)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package httpctx
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // ctxKey is unexported to avoid collisions with other packages.
 type ctxKey string
@@ -8,6 +11,7 @@ type ctxKey string
 const (
 	userIDKey    ctxKey = "user_id"
 	sessionIDKey ctxKey = "session_id"
+	authTimeKey  ctxKey = "auth_time"
 )
 
 // WithUserID stores the authenticated user id in the context.
@@ -20,6 +24,11 @@ func WithSessionID(ctx context.Context, sessionID string) context.Context {
 	return context.WithValue(ctx, sessionIDKey, sessionID)
 }
 
+// WithAuthTime stores when the caller's session last authenticated.
+func WithAuthTime(ctx context.Context, authTime time.Time) context.Context {
+	return context.WithValue(ctx, authTimeKey, authTime)
+}
+
 // UserIDFromContext extracts the authenticated user id from the context.
 func UserIDFromContext(ctx context.Context) (string, bool) {
 	v := ctx.Value(userIDKey)
@@ -33,3 +42,10 @@ func SessionIDFromContext(ctx context.Context) (string, bool) {
 	s, ok := v.(string)
 	return s, ok && s != ""
 }
+
+// AuthTimeFromContext returns when the caller's session last authenticated,
+// or the zero time if unknown.
+func AuthTimeFromContext(ctx context.Context) time.Time {
+	t, _ := ctx.Value(authTimeKey).(time.Time)
+	return t
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
@@ -9,6 +11,9 @@ import (
 	"github.com/vaaxooo/xbackend/internal/platform/http/users/httpctx"
 )
 
+// RequireJWT admits only callers with a session access token. Personal
+// access tokens and the tokens of sessions granted to OAuth clients are
+// refused: routes open to them use RequireToken.
 func RequireJWT(auth public.AuthPort) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -19,15 +24,117 @@ func RequireJWT(auth public.AuthPort) func(http.Handler) http.Handler {
 			}
 
 			token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
-			ctx, err := auth.Verify(token)
+			ctx, err := auth.Verify(r.Context(), token)
+			if err != nil || ctx.Kind != public.AuthKindSession {
+				phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withAuthContext(r, ctx)))
+		})
+	}
+}
+
+// RequireToken admits session access tokens like RequireJWT, and personal
+// access tokens and granted sessions with scope.
+func RequireToken(auth public.AuthPort, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+				phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+				return
+			}
+
+			token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+			ctx, err := auth.Verify(r.Context(), token)
 			if err != nil {
 				phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
 				return
 			}
+			if !ctx.HasScope(scope) {
+				phttp.WriteError(w, http.StatusForbidden, "insufficient_scope", "Token lacks the "+scope+" scope")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withAuthContext(r, ctx)))
+		})
+	}
+}
+
+// OptionalJWT stores the caller's identity when the request carries a valid
+// bearer token and passes every other request through unchanged.
+func OptionalJWT(auth public.AuthPort) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if !strings.HasPrefix(authHeader, "Bearer ") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+			ctx, err := auth.Verify(r.Context(), token)
+			if err != nil || ctx.Kind != public.AuthKindSession {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withAuthContext(r, ctx)))
+		})
+	}
+}
+
+// RequireServiceToken admits only requests whose bearer token is token,
+// for endpoints other services call rather than users.
+func RequireServiceToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			got := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+			if !strings.HasPrefix(authHeader, "Bearer ") || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-			reqCtx := httpctx.WithUserID(r.Context(), ctx.UserID)
-			reqCtx = httpctx.WithSessionID(reqCtx, ctx.SessionID)
-			next.ServeHTTP(w, r.WithContext(reqCtx))
+// RequireClient admits OAuth clients whose token was granted scope. A
+// non-empty serviceToken is accepted too, for services that authenticate
+// with a static token instead.
+func RequireClient(auth public.AuthPort, scope string, serviceToken string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+				phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+				return
+			}
+
+			token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+			if serviceToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(serviceToken)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, err := auth.Verify(r.Context(), token)
+			if err != nil || ctx.Kind != public.AuthKindClient {
+				phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+				return
+			}
+			if !ctx.HasScope(scope) {
+				phttp.WriteError(w, http.StatusForbidden, "insufficient_scope", "Token lacks the "+scope+" scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+func withAuthContext(r *http.Request, ctx public.AuthContext) context.Context {
+	reqCtx := httpctx.WithUserID(r.Context(), ctx.UserID)
+	reqCtx = httpctx.WithSessionID(reqCtx, ctx.SessionID)
+	return httpctx.WithAuthTime(reqCtx, ctx.AuthTime)
+}
@@ -0,0 +1,213 @@
+package users
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	usersapi "github.com/vaaxooo/xbackend/internal/modules/users/public"
+	"github.com/vaaxooo/xbackend/internal/platform/http/users/dto"
+
+	phttp "github.com/vaaxooo/xbackend/internal/platform/http"
+)
+
+// OAuthToken is the token endpoint of the client credentials grant and,
+// when the OpenID Connect provider is on, of the authorization code and
+// refresh token grants, and of device codes when the device grant is. It speaks OAuth rather than the API's JSON conventions: requests are form
+// encoded, clients authenticate with HTTP Basic, client_secret_post or a
+// client assertion, and errors use the RFC 6749 error body.
+func (h *Handler) OAuthToken(w http.ResponseWriter, r *http.Request) {
+	creds, basic, ok := clientCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.clientToken, usersapi.ClientTokenInput{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Scope:        r.PostForm.Get("scope"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		DeviceCode:   r.PostForm.Get("device_code"),
+		Credentials:  creds,
+	})
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	phttp.WriteJSON(w, http.StatusOK, dto.OAuthTokenResponse{
+		AccessToken:  out.AccessToken,
+		TokenType:    out.TokenType,
+		ExpiresIn:    int(out.ExpiresIn.Seconds()),
+		Scope:        out.Scope,
+		RefreshToken: out.RefreshToken,
+		IDToken:      out.IDToken,
+	})
+}
+
+// OAuthIntrospect is the token introspection endpoint (RFC 7662). Like the
+// token endpoint it takes form requests from authenticated clients.
+func (h *Handler) OAuthIntrospect(w http.ResponseWriter, r *http.Request) {
+	creds, basic, ok := clientCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.introspectToken, usersapi.IntrospectTokenInput{
+		Token:         r.PostForm.Get("token"),
+		TokenTypeHint: r.PostForm.Get("token_type_hint"),
+		Credentials:   creds,
+	})
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	resp := dto.IntrospectResponse{Active: out.Active}
+	if out.Active {
+		resp.Scope = strings.Join(out.Scopes, " ")
+		resp.ClientID = out.ClientID
+		resp.TokenType = out.TokenType
+		resp.Subject = out.Subject
+		resp.SessionID = out.SessionID
+		resp.Issuer = out.Issuer
+		if !out.ExpiresAt.IsZero() {
+			resp.ExpiresAt = out.ExpiresAt.Unix()
+		}
+		if !out.IssuedAt.IsZero() {
+			resp.IssuedAt = out.IssuedAt.Unix()
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	phttp.WriteJSON(w, http.StatusOK, resp)
+}
+
+// OAuthRevoke is the token revocation endpoint (RFC 7009). It answers 200
+// with an empty body whether or not the token was known.
+func (h *Handler) OAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	creds, basic, ok := clientCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := phttp.HandleUseCase(h.middleware, r, h.revokeToken, usersapi.RevokeTokenInput{
+		Token:         r.PostForm.Get("token"),
+		TokenTypeHint: r.PostForm.Get("token_type_hint"),
+		Credentials:   creds,
+	}); err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// OAuthDeviceAuthorization is the device authorization endpoint (RFC 8628
+// section 3.1), a form request like the token endpoint. Public clients
+// send their id alone; scope is not read, as devices get a session like
+// any login.
+func (h *Handler) OAuthDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	creds, basic, ok := clientCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.startDevice, usersapi.DeviceAuthorizationInput{Credentials: creds})
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	phttp.WriteJSON(w, http.StatusOK, dto.DeviceAuthorizationResponse{
+		DeviceCode:              out.DeviceCode,
+		UserCode:                out.UserCode,
+		VerificationURI:         out.VerificationURI,
+		VerificationURIComplete: out.VerificationURIComplete,
+		ExpiresIn:               int(out.ExpiresIn.Seconds()),
+		Interval:                int(out.Interval.Seconds()),
+	})
+}
+
+// clientCredentials reads how the client authenticates from a form
+// request. basic reports HTTP Basic, whose failures must be answered with
+// a challenge. Using Basic along with credentials in the form is refused,
+// as a client must use a single method.
+func clientCredentials(w http.ResponseWriter, r *http.Request) (creds usersapi.ClientCredentials, basic bool, ok bool) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, domain.ErrInvalidOAuthRequest, false)
+		return creds, false, false
+	}
+	creds = usersapi.ClientCredentials{
+		ClientID:      r.PostForm.Get("client_id"),
+		ClientSecret:  r.PostForm.Get("client_secret"),
+		AssertionType: r.PostForm.Get("client_assertion_type"),
+		Assertion:     r.PostForm.Get("client_assertion"),
+	}
+
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		return creds, false, true
+	}
+	if creds.ClientSecret != "" || creds.Assertion != "" {
+		writeOAuthError(w, domain.ErrInvalidOAuthRequest, false)
+		return creds, true, false
+	}
+	// Basic credentials are form encoded before base64 (RFC 6749 2.3.1).
+	var errID, errSecret error
+	creds.ClientID, errID = url.QueryUnescape(id)
+	creds.ClientSecret, errSecret = url.QueryUnescape(secret)
+	if errID != nil || errSecret != nil {
+		writeOAuthError(w, domain.ErrInvalidClient, true)
+		return creds, true, false
+	}
+	return creds, true, true
+}
+
+func writeOAuthError(w http.ResponseWriter, err error, basic bool) {
+	status, code := mapOAuthError(err)
+	if code == "invalid_client" && basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	phttp.WriteJSON(w, status, dto.OAuthErrorResponse{Error: code})
+}
+
+func mapOAuthError(err error) (status int, code string) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidClient):
+		return http.StatusUnauthorized, "invalid_client"
+	case errors.Is(err, domain.ErrInvalidOAuthRequest):
+		return http.StatusBadRequest, "invalid_request"
+	case errors.Is(err, domain.ErrUnsupportedGrantType):
+		return http.StatusBadRequest, "unsupported_grant_type"
+	case errors.Is(err, domain.ErrInvalidScope):
+		return http.StatusBadRequest, "invalid_scope"
+	case errors.Is(err, domain.ErrInvalidGrant), errors.Is(err, domain.ErrSessionLimitReached):
+		// A code that cannot open a session is as good as spent.
+		return http.StatusBadRequest, "invalid_grant"
+	case errors.Is(err, domain.ErrUnauthorizedClient):
+		return http.StatusBadRequest, "unauthorized_client"
+	case errors.Is(err, domain.ErrUnsupportedTokenType):
+		return http.StatusBadRequest, "unsupported_token_type"
+	case errors.Is(err, domain.ErrAuthorizationPending):
+		return http.StatusBadRequest, "authorization_pending"
+	case errors.Is(err, domain.ErrSlowDown):
+		return http.StatusBadRequest, "slow_down"
+	case errors.Is(err, domain.ErrAccessDenied):
+		return http.StatusBadRequest, "access_denied"
+	case errors.Is(err, domain.ErrExpiredToken):
+		return http.StatusBadRequest, "expired_token"
+	default:
+		return http.StatusInternalServerError, "server_error"
+	}
+}
@@ -0,0 +1,236 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
+	usersapi "github.com/vaaxooo/xbackend/internal/modules/users/public"
+	"github.com/vaaxooo/xbackend/internal/platform/http/users/dto"
+	"github.com/vaaxooo/xbackend/internal/platform/http/users/httpctx"
+
+	phttp "github.com/vaaxooo/xbackend/internal/platform/http"
+)
+
+// StartAuthorization is the authorization endpoint of the OpenID Connect
+// provider. The browser is sent on to the login page with the request, or
+// back to the client with an error. Requests whose client or redirect URI
+// cannot be trusted are answered here, as nothing may be redirected to
+// them (RFC 6749 section 4.1.2.1).
+func (h *Handler) StartAuthorization(w http.ResponseWriter, r *http.Request) {
+	out, err := phttp.HandleUseCase(h.middleware, r, h.startAuthorization, usersapi.StartAuthorizationInput{
+		Request: authorizationRequest(r.URL.Query()),
+	})
+	if err != nil {
+		status, code := http.StatusInternalServerError, "server_error"
+		switch {
+		case errors.Is(err, domain.ErrInvalidClient):
+			status, code = http.StatusBadRequest, "invalid_client"
+		case errors.Is(err, domain.ErrInvalidRedirectURI):
+			status, code = http.StatusBadRequest, "invalid_request"
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		phttp.WriteJSON(w, status, dto.OAuthErrorResponse{Error: code})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, out.RedirectTo, http.StatusFound)
+}
+
+// Authorize is called by the login page once the user is signed in, with
+// the parameters it was started with. It answers with where to send the
+// browser, or asks for the consent screen or a fresh login first.
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+	sid, _ := httpctx.SessionIDFromContext(r.Context())
+
+	var req dto.AuthorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.authorize, usersapi.AuthorizeInput{
+		Request: usersapi.AuthorizationRequest{
+			ResponseType:        req.ResponseType,
+			ClientID:            req.ClientID,
+			RedirectURI:         req.RedirectURI,
+			Scope:               req.Scope,
+			State:               req.State,
+			Nonce:               req.Nonce,
+			CodeChallenge:       req.CodeChallenge,
+			CodeChallengeMethod: req.CodeChallengeMethod,
+			Prompt:              req.Prompt,
+			MaxAge:              req.MaxAge,
+		},
+		UserID:    uid,
+		SessionID: sid,
+		Consent:   req.Consent,
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	resp := dto.AuthorizeResponse{Status: out.Status, RedirectTo: out.RedirectTo}
+	if out.Consent != nil {
+		resp.Consent = &dto.ConsentResponse{
+			ClientID:   out.Consent.ClientID,
+			ClientName: out.Consent.ClientName,
+			Scopes:     out.Consent.Scopes,
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	phttp.WriteJSON(w, http.StatusOK, resp)
+}
+
+// VerifyDevice is called by the device verification page for the signed
+// in user with the code a device shows. Without consent it describes the
+// device, so that the user can check it is theirs; with approve or deny it
+// answers the device's next poll.
+func (h *Handler) VerifyDevice(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+	sid, _ := httpctx.SessionIDFromContext(r.Context())
+
+	var req dto.VerifyDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.verifyDevice, usersapi.VerifyDeviceInput{
+		UserCode:  req.UserCode,
+		UserID:    uid,
+		SessionID: sid,
+		Consent:   req.Consent,
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	phttp.WriteJSON(w, http.StatusOK, dto.VerifyDeviceResponse{
+		Status:      out.Status,
+		ClientID:    out.ClientID,
+		ClientName:  out.ClientName,
+		IP:          out.IP,
+		UserAgent:   out.UserAgent,
+		Country:     out.Country,
+		City:        out.City,
+		RequestedAt: out.RequestedAt,
+	})
+}
+
+// UserInfo is the userinfo endpoint. Tokens whose session was not granted
+// the openid scope get the bearer token error of RFC 6750 section 3.1.
+func (h *Handler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+	sid, _ := httpctx.SessionIDFromContext(r.Context())
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.userInfo, usersapi.UserInfoInput{UserID: uid, SessionID: sid})
+	if errors.Is(err, domain.ErrInsufficientScope) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		phttp.WriteJSON(w, http.StatusForbidden, dto.OAuthErrorResponse{Error: "insufficient_scope"})
+		return
+	}
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	phttp.WriteJSON(w, http.StatusOK, dto.UserInfoResponse{
+		Subject:       out.Subject,
+		Name:          out.Name,
+		GivenName:     out.GivenName,
+		FamilyName:    out.FamilyName,
+		MiddleName:    out.MiddleName,
+		Picture:       out.Picture,
+		Email:         out.Email,
+		EmailVerified: out.EmailVerified,
+	})
+}
+
+func (h *Handler) ProviderMetadata(w http.ResponseWriter, r *http.Request) {
+	out, err := phttp.HandleUseCase(h.middleware, r, h.providerMetadata, usersapi.ProviderMetadataInput{})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	phttp.WriteJSON(w, http.StatusOK, dto.ProviderMetadataResponse{
+		Issuer:                            out.Issuer,
+		AuthorizationEndpoint:             out.AuthorizationEndpoint,
+		TokenEndpoint:                     out.TokenEndpoint,
+		UserinfoEndpoint:                  out.UserinfoEndpoint,
+		JWKSURI:                           out.JWKSURI,
+		IntrospectionEndpoint:             out.IntrospectionEndpoint,
+		RevocationEndpoint:                out.RevocationEndpoint,
+		DeviceAuthorizationEndpoint:       out.DeviceAuthorizationEndpoint,
+		ScopesSupported:                   out.ScopesSupported,
+		ResponseTypesSupported:            out.ResponseTypesSupported,
+		GrantTypesSupported:               out.GrantTypesSupported,
+		SubjectTypesSupported:             out.SubjectTypesSupported,
+		IDTokenSigningAlgValuesSupported:  out.IDTokenSigningAlgValuesSupported,
+		TokenEndpointAuthMethodsSupported: out.TokenEndpointAuthMethodsSupported,
+		CodeChallengeMethodsSupported:     out.CodeChallengeMethodsSupported,
+		ClaimsSupported:                   out.ClaimsSupported,
+	})
+}
+
+func (h *Handler) ProviderKeys(w http.ResponseWriter, r *http.Request) {
+	out, err := phttp.HandleUseCase(h.middleware, r, h.providerKeys, usersapi.ProviderKeysInput{})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	resp := dto.JSONWebKeySetResponse{Keys: make([]dto.JSONWebKeyResponse, 0, len(out.Keys))}
+	for _, k := range out.Keys {
+		resp.Keys = append(resp.Keys, dto.JSONWebKeyResponse{
+			KeyType:   k.KeyType,
+			Use:       k.Use,
+			KeyID:     k.KeyID,
+			Algorithm: k.Algorithm,
+			N:         k.N,
+			E:         k.E,
+		})
+	}
+	phttp.WriteJSON(w, http.StatusOK, resp)
+}
+
+func authorizationRequest(q url.Values) usersapi.AuthorizationRequest {
+	return usersapi.AuthorizationRequest{
+		ResponseType:        q.Get("response_type"),
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		Nonce:               q.Get("nonce"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+		Prompt:              q.Get("prompt"),
+		MaxAge:              q.Get("max_age"),
+	}
+}
@@ -0,0 +1,97 @@
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	usersapi "github.com/vaaxooo/xbackend/internal/modules/users/public"
+	"github.com/vaaxooo/xbackend/internal/platform/http/users/dto"
+	"github.com/vaaxooo/xbackend/internal/platform/http/users/httpctx"
+
+	phttp "github.com/vaaxooo/xbackend/internal/platform/http"
+)
+
+// StartQRLogin opens a QR login for the desktop: POST /auth/qr/start.
+func (h *Handler) StartQRLogin(w http.ResponseWriter, r *http.Request) {
+	out, err := phttp.HandleUseCase(h.middleware, r, h.startQRLogin, usersapi.StartQRLoginInput{})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	phttp.WriteJSON(w, http.StatusOK, dto.QRLoginStartResponse{
+		ChallengeID: out.ChallengeID,
+		QRCode:      out.Code,
+		LoginToken:  out.LoginToken,
+		ExpiresIn:   int64(out.ExpiresIn / time.Second),
+	})
+}
+
+// ScanQRLogin is called by the mobile app of the signed in user with a
+// scanned QR code: POST /auth/qr/scan. Without consent it describes the
+// desktop, so that the user can tell it is theirs.
+func (h *Handler) ScanQRLogin(w http.ResponseWriter, r *http.Request) {
+	uid, ok := httpctx.UserIDFromContext(r.Context())
+	if !ok {
+		phttp.WriteError(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+	sid, _ := httpctx.SessionIDFromContext(r.Context())
+
+	var req dto.QRLoginScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+
+	out, err := phttp.HandleUseCase(h.middleware, r, h.scanQRLogin, usersapi.ScanQRLoginInput{
+		UserID:    uid,
+		SessionID: sid,
+		Code:      req.QRCode,
+		Consent:   req.Consent,
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	phttp.WriteJSON(w, http.StatusOK, dto.QRLoginScanResponse{
+		Status:      out.Status,
+		IP:          out.IP,
+		UserAgent:   out.UserAgent,
+		Country:     out.Country,
+		City:        out.City,
+		RequestedAt: out.RequestedAt,
+	})
+}
+
+// QRLoginSession is the long poll of the desktop: POST /auth/qr/session.
+// It answers once the QR login was answered or the wait ran out, with the
+// session, or the challenge to poll again with.
+func (h *Handler) QRLoginSession(w http.ResponseWriter, r *http.Request) {
+	var req dto.QRLoginSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		phttp.WriteError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON")
+		return
+	}
+
+	// The wait outlasts the server write timeout, like an event stream.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	out, err := phttp.HandleUseCase(h.middleware, r, h.qrLoginSession, usersapi.QRLoginSessionInput{
+		ChallengeID: req.ChallengeID,
+		LoginToken:  req.LoginToken,
+	})
+	if err != nil {
+		status, code, msg := mapError(err)
+		phttp.WriteError(w, status, code, msg)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeAuthResponse(w, r, out)
+}
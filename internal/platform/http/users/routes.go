@@ -4,14 +4,44 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/vaaxooo/xbackend/internal/modules/users/domain"
 	"github.com/vaaxooo/xbackend/internal/modules/users/public"
 	phttp "github.com/vaaxooo/xbackend/internal/platform/http"
 	"github.com/vaaxooo/xbackend/internal/platform/http/users/middleware"
 	pmiddleware "github.com/vaaxooo/xbackend/internal/platform/middleware"
 )
 
-func RegisterV1(r chi.Router, svc public.Service, auth public.AuthPort) {
-	h := NewHandler(svc, phttp.UseCaseMiddleware{Timeout: 30 * time.Second})
+// Options tunes the users routes.
+type Options struct {
+	// Geo locates client IPs; it may be nil.
+	Geo public.GeoLocator
+	// Cookies enables the cookie mode for browser clients.
+	Cookies CookieConfig
+	// RevocationFeedToken is the bearer token services present to read the
+	// revocation feed.
+	RevocationFeedToken string
+	// OAuthClients mounts the OAuth token, introspection and revocation
+	// endpoints, and lets client tokens with the revocations:read scope
+	// read the feed. Without it or RevocationFeedToken the feed is not
+	// mounted.
+	OAuthClients bool
+	// OIDC mounts the OpenID Connect provider: the OAuth endpoints, the
+	// authorization, userinfo and key endpoints and the discovery document.
+	OIDC bool
+	// DeviceFlow mounts the OAuth endpoints, the device authorization
+	// endpoint and the route the signed in page posts user codes to.
+	DeviceFlow bool
+	// AccessTokenKeys serves /oauth/jwks for services that verify access
+	// tokens with the public key they are signed with.
+	AccessTokenKeys bool
+	// AdminToken guards the admin routes; empty leaves them unmounted.
+	AdminToken string
+}
+
+// RegisterV1 mounts the users routes.
+func RegisterV1(r chi.Router, svc public.Service, auth public.AuthPort, opts Options) {
+	h := NewHandler(svc, phttp.UseCaseMiddleware{Timeout: 30 * time.Second, Geo: opts.Geo})
+	h.cookies = newTokenCookies(opts.Cookies)
 
 	r.Route("/auth", func(r chi.Router) {
 		// Auth endpoints are brute-force targets.
@@ -21,6 +51,7 @@ func RegisterV1(r chi.Router, svc public.Service, auth public.AuthPort) {
 		r.With(pmiddleware.RateLimit(10, time.Minute)).Post("/google", h.GoogleLogin)
 		r.With(pmiddleware.RateLimit(10, time.Minute)).Post("/apple", h.AppleLogin)
 		r.With(pmiddleware.RateLimit(20, time.Minute)).Post("/refresh", h.Refresh)
+		r.With(pmiddleware.RateLimit(20, time.Minute), middleware.OptionalJWT(auth)).Post("/logout", h.Logout)
 		r.With(pmiddleware.RateLimit(20, time.Minute)).Post("/confirm", h.ConfirmEmail)
 		r.With(pmiddleware.RateLimit(10, time.Minute)).Post("/confirm/request", h.RequestEmailConfirmation)
 		r.With(pmiddleware.RateLimit(10, time.Minute)).Post("/password/reset", h.RequestPasswordReset)
@@ -29,24 +60,87 @@ func RegisterV1(r chi.Router, svc public.Service, auth public.AuthPort) {
 		r.With(pmiddleware.RateLimit(20, time.Minute)).Post("/challenge/verify-totp", h.VerifyChallengeTOTP)
 		r.With(pmiddleware.RateLimit(20, time.Minute)).Post("/challenge/resend-email", h.ResendChallengeEmail)
 		r.With(pmiddleware.RateLimit(20, time.Minute)).Post("/challenge/confirm-email", h.ConfirmChallengeEmail)
+		r.With(pmiddleware.RateLimit(20, time.Minute)).Post("/challenge/verify-email-otp", h.VerifyChallengeEmailOTP)
+		r.With(pmiddleware.RateLimit(20, time.Minute)).Post("/challenge/verify-captcha", h.VerifyChallengeCaptcha)
+		r.With(pmiddleware.RateLimit(20, time.Minute)).Post("/challenge/{id}/steps/{step}", h.VerifyChallengeStep)
+		r.With(pmiddleware.RateLimit(30, time.Minute)).Get("/challenge/{id}/events", h.ChallengeEvents)
+		r.With(pmiddleware.RateLimit(10, time.Minute)).Post("/qr/start", h.StartQRLogin)
+		r.With(pmiddleware.RateLimit(60, time.Minute)).Post("/qr/session", h.QRLoginSession)
+		r.With(pmiddleware.RateLimit(10, time.Minute), middleware.RequireJWT(auth)).Post("/qr/scan", h.ScanQRLogin)
+		r.With(pmiddleware.RateLimit(5, time.Minute)).Post("/recovery/start", h.StartRecovery)
+		r.With(pmiddleware.RateLimit(10, time.Minute)).Post("/recovery/confirm", h.ConfirmRecovery)
+		r.With(pmiddleware.RateLimit(10, time.Minute)).Post("/recovery/cancel", h.CancelRecovery)
+		r.With(pmiddleware.RateLimit(10, time.Minute)).Post("/recovery/complete", h.CompleteRecovery)
+		switch {
+		case opts.OAuthClients:
+			r.With(middleware.RequireClient(auth, domain.ScopeRevocationsRead, opts.RevocationFeedToken)).Get("/revocations", h.ListRevocations)
+		case opts.RevocationFeedToken != "":
+			r.With(middleware.RequireServiceToken(opts.RevocationFeedToken)).Get("/revocations", h.ListRevocations)
+		}
 
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.RequireJWT(auth))
+			r.With(pmiddleware.RateLimit(10, time.Minute)).Post("/reauth", h.StartStepUp)
+			r.With(pmiddleware.RateLimit(20, time.Minute)).Post("/reauth/{id}/steps/{step}", h.VerifyStepUp)
 			r.Post("/link", h.LinkProvider)
 			r.Post("/password/change", h.ChangePassword)
 			r.Post("/2fa/setup", h.SetupTwoFactor)
 			r.Post("/2fa/confirm", h.ConfirmTwoFactor)
 			r.Post("/2fa/disable", h.DisableTwoFactor)
-			r.Get("/sessions", h.ListSessions)
 			r.Post("/sessions/revoke", h.RevokeSession)
+			r.Post("/sessions/rename", h.RenameSession)
 			r.Post("/sessions/revoke-others", h.RevokeOtherSessions)
+			r.Post("/logout/all", h.LogoutAll)
+			r.Get("/devices", h.ListTrustedDevices)
+			r.Post("/devices/revoke", h.RevokeTrustedDevice)
+			r.Post("/tokens", h.CreateAccessToken)
+			r.Get("/tokens", h.ListAccessTokens)
+			r.Post("/tokens/revoke", h.RevokeAccessToken)
 		})
+		// Personal access tokens reach these routes within their scopes.
+		r.With(middleware.RequireToken(auth, domain.ScopeSessionsRead)).Get("/sessions", h.ListSessions)
 	})
 
-	r.Group(func(r chi.Router) {
-		r.Use(middleware.RequireJWT(auth))
-		r.Get("/me", h.GetMe)
-		r.Patch("/me", h.UpdateProfile)
-	})
+	r.With(middleware.RequireToken(auth, domain.ScopeProfileRead)).Get("/me", h.GetMe)
+	r.With(middleware.RequireToken(auth, domain.ScopeProfileWrite)).Patch("/me", h.UpdateProfile)
+
+	if opts.OAuthClients || opts.OIDC || opts.DeviceFlow || opts.AccessTokenKeys {
+		r.Route("/oauth", func(r chi.Router) {
+			if opts.OIDC || opts.AccessTokenKeys {
+				r.Get("/jwks", h.ProviderKeys)
+			}
+			if !opts.OAuthClients && !opts.OIDC && !opts.DeviceFlow {
+				return
+			}
+			r.With(pmiddleware.RateLimit(60, time.Minute)).Post("/token", h.OAuthToken)
+			r.With(pmiddleware.RateLimit(600, time.Minute)).Post("/introspect", h.OAuthIntrospect)
+			r.With(pmiddleware.RateLimit(60, time.Minute)).Post("/revoke", h.OAuthRevoke)
+			if opts.DeviceFlow {
+				r.With(pmiddleware.RateLimit(30, time.Minute)).Post("/device_authorization", h.OAuthDeviceAuthorization)
+				// User codes are short enough to guess without a limit.
+				r.With(pmiddleware.RateLimit(10, time.Minute), middleware.RequireJWT(auth)).Post("/device", h.VerifyDevice)
+			}
+			if !opts.OIDC {
+				return
+			}
+			r.With(pmiddleware.RateLimit(30, time.Minute)).Get("/authorize", h.StartAuthorization)
+			r.With(pmiddleware.RateLimit(30, time.Minute), middleware.RequireJWT(auth)).Post("/authorize", h.Authorize)
+			r.With(middleware.RequireToken(auth, domain.ScopeOpenID)).Get("/userinfo", h.UserInfo)
+			r.With(middleware.RequireToken(auth, domain.ScopeOpenID)).Post("/userinfo", h.UserInfo)
+		})
+	}
+	if opts.OIDC {
+		r.Get("/.well-known/openid-configuration", h.ProviderMetadata)
+	}
+
+	if opts.AdminToken != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middleware.RequireServiceToken(opts.AdminToken))
+			r.Post("/tokens/invalidate", h.InvalidateTokens)
+			r.Post("/oauth/clients", h.RegisterClient)
+			r.Get("/oauth/clients", h.ListClients)
+			r.Post("/oauth/clients/disable", h.DisableClient)
+		})
+	}
 
 }
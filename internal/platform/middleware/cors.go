@@ -28,7 +28,14 @@ func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 					w.Header().Set("Vary", "Origin")
 					w.Header().Set("Access-Control-Allow-Credentials", "true")
-					w.Header().Set("Access-Control-Allow-Headers", "*")
+					// Browsers take "*" literally on credentialed requests, so
+					// echo what the preflight asks for (X-CSRF-Token and the
+					// like).
+					allowHeaders := r.Header.Get("Access-Control-Request-Headers")
+					if allowHeaders == "" {
+						allowHeaders = "*"
+					}
+					w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
 					w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
 					w.Header().Set("Access-Control-Expose-Headers", "*")
 					if r.Method == http.MethodOptions {
@@ -75,7 +75,7 @@ func (w *Worker) ProcessOnce(ctx context.Context) error {
 	}
 
 	for _, msg := range messages {
-		if err := w.publisher.Publish(ctx, msg.ID.String(), msg.EventType, msg.Payload); err != nil {
+		if err := w.publish(ctx, msg); err != nil {
 			if markErr := w.repo.MarkFailed(ctx, msg.ID, err); markErr != nil {
 				w.logger.Error(ctx, "failed to mark outbox message as failed", markErr, "event_id", msg.ID.String())
 			}
@@ -90,3 +90,14 @@ func (w *Worker) ProcessOnce(ctx context.Context) error {
 
 	return nil
 }
+
+// publish hands sensitive fields only to publishers that explicitly accept
+// them; everyone else receives the public payload.
+func (w *Worker) publish(ctx context.Context, msg userevents.OutboxMessage) error {
+	if len(msg.Sensitive) > 0 {
+		if sp, ok := w.publisher.(common.SensitiveDomainEventPublisher); ok {
+			return sp.PublishSensitive(ctx, msg.ID.String(), msg.EventType, msg.Payload, msg.Sensitive)
+		}
+	}
+	return w.publisher.Publish(ctx, msg.ID.String(), msg.EventType, msg.Payload)
+}
@@ -22,23 +22,23 @@ func TestWorkerIsIdempotentAcrossRetries(t *testing.T) {
 	}
 	defer db.Close()
 
-	repo := events.NewOutboxRepository(db)
+	repo := events.NewOutboxRepository(db, nil)
 	publisher := &recordingPublisher{}
 	worker := NewWorker(repo, publisher, plog.New("dev"), Config{})
 
 	eventID := uuid.New().String()
-	rows := sqlmock.NewRows([]string{"id", "event_type", "payload", "occurred_at", "created_at", "published_at", "attempts", "last_error"}).
-		AddRow(eventID, "test.event", []byte(`{"key":"value"}`), time.Unix(0, 0), time.Unix(0, 0), nil, 0, nil)
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id::text, event_type, payload, occurred_at, created_at, published_at, attempts, last_error\n                FROM user_events_outbox\n                WHERE published_at IS NULL\n                ORDER BY created_at\n                LIMIT $1")).
+	rows := sqlmock.NewRows([]string{"id", "event_type", "payload", "sensitive_payload", "occurred_at", "created_at", "published_at", "attempts", "last_error"}).
+		AddRow(eventID, "test.event", []byte(`{"key":"value"}`), nil, time.Unix(0, 0), time.Unix(0, 0), nil, 0, nil)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id::text, event_type, payload, sensitive_payload, occurred_at, created_at, published_at, attempts, last_error\n                FROM user_events_outbox\n                WHERE published_at IS NULL\n                ORDER BY created_at\n                LIMIT $1")).
 		WithArgs(32).
 		WillReturnRows(rows)
-	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_events_outbox\n                SET published_at = $2, attempts = attempts + 1, last_error = NULL\n                WHERE id = $1::uuid\n        ")).
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_events_outbox\n                SET published_at = $2, attempts = attempts + 1, last_error = NULL, sensitive_payload = NULL\n                WHERE id = $1::uuid\n        ")).
 		WithArgs(eventID, sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id::text, event_type, payload, occurred_at, created_at, published_at, attempts, last_error\n                FROM user_events_outbox\n                WHERE published_at IS NULL\n                ORDER BY created_at\n                LIMIT $1")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id::text, event_type, payload, sensitive_payload, occurred_at, created_at, published_at, attempts, last_error\n                FROM user_events_outbox\n                WHERE published_at IS NULL\n                ORDER BY created_at\n                LIMIT $1")).
 		WithArgs(32).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "event_type", "payload", "occurred_at", "created_at", "published_at", "attempts", "last_error"}))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "event_type", "payload", "sensitive_payload", "occurred_at", "created_at", "published_at", "attempts", "last_error"}))
 
 	if err := worker.ProcessOnce(context.Background()); err != nil {
 		t.Fatalf("first iteration failed: %v", err)
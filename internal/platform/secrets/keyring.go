@@ -0,0 +1,223 @@
+// Package secrets provides envelope encryption for sensitive values that
+// must be recoverable (unlike passwords or tokens, which are hashed).
+//
+// Every value is sealed with a fresh random data key using AES-256-GCM. The
+// data key is then wrapped by a named key-encryption key (KEK) from the
+// keyring. The sealed form records the KEK id, so older keys can stay in the
+// keyring for decryption while new writes always use the primary key.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	envelopePrefix = "enc:v1:"
+	keySize        = 32
+)
+
+var (
+	ErrUnknownKey       = errors.New("secrets: unknown key id")
+	ErrMalformed        = errors.New("secrets: malformed ciphertext")
+	ErrDecryptionFailed = errors.New("secrets: decryption failed")
+)
+
+// Cipher encrypts and decrypts individual values. The associated data binds
+// a ciphertext to its location (e.g. table, column and row id) so that sealed
+// values cannot be swapped between rows.
+type Cipher interface {
+	Encrypt(plaintext, associatedData string) (string, error)
+	Decrypt(value, associatedData string) (string, error)
+}
+
+// Keyring is a set of key-encryption keys with a single primary key used for
+// new writes.
+type Keyring struct {
+	keys    map[string]cipher.AEAD
+	primary string
+}
+
+// NewKeyring builds a keyring from raw 32-byte keys indexed by key id.
+func NewKeyring(primaryID string, keys map[string][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("secrets: at least one key is required")
+	}
+	if primaryID == "" {
+		if len(keys) != 1 {
+			return nil, errors.New("secrets: primary key id is required when several keys are configured")
+		}
+		for id := range keys {
+			primaryID = id
+		}
+	}
+	if _, ok := keys[primaryID]; !ok {
+		return nil, fmt.Errorf("secrets: primary key %q is not configured", primaryID)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("secrets: invalid key id %q", id)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("secrets: key %q must be %d bytes", id, keySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		aeads[id] = aead
+	}
+	return &Keyring{keys: aeads, primary: primaryID}, nil
+}
+
+// PrimaryKeyID reports the id of the key used for new encryptions.
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary
+}
+
+// Encrypt seals plaintext under a fresh data key wrapped by the primary key.
+// The result has the form enc:v1:<key id>:<wrapped data key>:<ciphertext>.
+func (k *Keyring) Encrypt(plaintext, associatedData string) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataAEAD, []byte(plaintext), []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + k.primary + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt. Values without the envelope
+// prefix are returned unchanged so rows written before encryption was enabled
+// stay readable until they are re-encrypted.
+func (k *Keyring) Decrypt(value, associatedData string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	keyID, wrapped, sealed, err := parseEnvelope(value)
+	if err != nil {
+		return "", err
+	}
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	dataKey, err := open(kek, wrapped, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, sealed, []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether value is plaintext or sealed with a key other
+// than the current primary.
+func (k *Keyring) NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	keyID, _, _, err := parseEnvelope(value)
+	if err != nil {
+		return true
+	}
+	return keyID != k.primary
+}
+
+// IsEncrypted reports whether value carries the envelope prefix.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+// Plaintext is a Cipher that stores values as-is. It is used when no keys are
+// configured (local development) and keeps the call sites identical.
+type Plaintext struct{}
+
+func (Plaintext) Encrypt(plaintext, _ string) (string, error) { return plaintext, nil }
+
+func (Plaintext) Decrypt(value, _ string) (string, error) {
+	if IsEncrypted(value) {
+		return "", fmt.Errorf("%w: encryption keys are not configured", ErrUnknownKey)
+	}
+	return value, nil
+}
+
+var (
+	_ Cipher = (*Keyring)(nil)
+	_ Cipher = Plaintext{}
+)
+
+func parseEnvelope(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", nil, nil, ErrMalformed
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[0], wrapped, sealed, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+func open(aead cipher.AEAD, sealed, associatedData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, associatedData)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
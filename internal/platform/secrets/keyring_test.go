@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keySize)
+}
+
+func TestKeyringRoundTripAndRotation(t *testing.T) {
+	old, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatalf("keyring error: %v", err)
+	}
+	sealed, err := old.Encrypt("JBSWY3DPEHPK3PXP", "auth_identities.totp_secret:id-1")
+	if err != nil {
+		t.Fatalf("encrypt error: %v", err)
+	}
+	if !strings.HasPrefix(sealed, "enc:v1:k1:") || strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("unexpected envelope: %s", sealed)
+	}
+
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatalf("keyring error: %v", err)
+	}
+	if !rotated.NeedsRotation(sealed) {
+		t.Fatalf("expected value sealed with old key to need rotation")
+	}
+	plain, err := rotated.Decrypt(sealed, "auth_identities.totp_secret:id-1")
+	if err != nil || plain != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("decrypt with rotated keyring: %q %v", plain, err)
+	}
+
+	resealed, err := rotated.Encrypt(plain, "auth_identities.totp_secret:id-1")
+	if err != nil {
+		t.Fatalf("encrypt error: %v", err)
+	}
+	if rotated.NeedsRotation(resealed) {
+		t.Fatalf("expected value sealed with primary key to be current")
+	}
+	if _, err := old.Decrypt(resealed, "auth_identities.totp_secret:id-1"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestKeyringRejectsMismatchedAssociatedData(t *testing.T) {
+	k, err := NewKeyring("", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatalf("keyring error: %v", err)
+	}
+	sealed, err := k.Encrypt("secret", "row-1")
+	if err != nil {
+		t.Fatalf("encrypt error: %v", err)
+	}
+	if _, err := k.Decrypt(sealed, "row-2"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("expected decryption failure, got %v", err)
+	}
+}
+
+func TestKeyringPassesLegacyPlaintextThrough(t *testing.T) {
+	k, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatalf("keyring error: %v", err)
+	}
+	got, err := k.Decrypt("legacy", "row-1")
+	if err != nil || got != "legacy" {
+		t.Fatalf("expected plaintext passthrough, got %q %v", got, err)
+	}
+	if !k.NeedsRotation("legacy") {
+		t.Fatalf("expected plaintext to need encryption")
+	}
+}
+
+func TestNewKeyringValidation(t *testing.T) {
+	if _, err := NewKeyring("", map[string][]byte{"a": testKey(1), "b": testKey(2)}); err == nil {
+		t.Fatalf("expected error when primary is ambiguous")
+	}
+	if _, err := NewKeyring("a", map[string][]byte{"a": []byte("short")}); err == nil {
+		t.Fatalf("expected error for short key")
+	}
+}
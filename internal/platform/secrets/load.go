@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadKeyring assembles a keyring from inline "id:base64key" entries and from
+// a directory holding one file per key (the file name is the key id and the
+// content is the base64-encoded key). It returns nil when no keys are
+// configured at all.
+func LoadKeyring(primaryID string, inline []string, dir string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+
+	for _, entry := range inline {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("secrets: key entry must be id:base64key")
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: key %q: %w", id, err)
+		}
+		keys[strings.TrimSpace(id)] = key
+	}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: read keys dir: %w", err)
+		}
+		for _, e := range entries {
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			raw, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("secrets: read key %q: %w", e.Name(), err)
+			}
+			key, err := decodeKey(string(raw))
+			if err != nil {
+				return nil, fmt.Errorf("secrets: key %q: %w", e.Name(), err)
+			}
+			if _, dup := keys[e.Name()]; dup {
+				return nil, fmt.Errorf("secrets: key %q configured twice", e.Name())
+			}
+			keys[e.Name()] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return NewKeyring(primaryID, keys)
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.RawStdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	return key, nil
+}
@@ -340,6 +340,12 @@ func compareArgs(expected []any, actual []driver.Value) error {
 		if _, ok := expected[i].(anyArg); ok {
 			continue
 		}
+		if m, ok := expected[i].(Argument); ok {
+			if !m.Match(actual[i]) {
+				return fmt.Errorf("argument %d mismatch: matcher rejected %v", i, actual[i])
+			}
+			continue
+		}
 		if !valuesEqual(expected[i], actual[i]) {
 			return fmt.Errorf("argument %d mismatch: expected %v got %v", i, expected[i], actual[i])
 		}
@@ -357,5 +363,10 @@ func valuesEqual(exp any, act any) bool {
 	return fmt.Sprint(exp) == fmt.Sprint(act)
 }
 
+// Argument is a custom matcher for a single query argument.
+type Argument interface {
+	Match(driver.Value) bool
+}
+
 // AnyArg returns a wildcard argument matcher.
 func AnyArg() anyArg { return anyArg{} }
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_auth_verification_tokens_active;
+
+DELETE FROM auth_verification_tokens;
+
+ALTER TABLE auth_verification_tokens RENAME COLUMN token_hash TO token_code;
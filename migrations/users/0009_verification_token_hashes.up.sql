@@ -0,0 +1,9 @@
+-- Verification codes and reset tokens are stored as keyed hashes only.
+-- Outstanding plaintext rows cannot be matched anymore, so drop them.
+DELETE FROM auth_verification_tokens;
+
+ALTER TABLE auth_verification_tokens RENAME COLUMN token_code TO token_hash;
+
+CREATE INDEX IF NOT EXISTS idx_auth_verification_tokens_active
+    ON auth_verification_tokens(identity_id, token_type, created_at DESC)
+    WHERE used_at IS NULL;
@@ -0,0 +1,6 @@
+-- Only plaintext values can be merged back; sealed ones are dropped.
+UPDATE user_events_outbox
+SET payload = payload || sensitive_payload::jsonb
+WHERE sensitive_payload IS NOT NULL AND sensitive_payload NOT LIKE 'enc:%';
+
+ALTER TABLE user_events_outbox DROP COLUMN IF EXISTS sensitive_payload;
@@ -0,0 +1,17 @@
+ALTER TABLE user_events_outbox ADD COLUMN IF NOT EXISTS sensitive_payload TEXT NULL;
+
+-- Undelivered messages keep their secrets in the new column (plaintext until
+-- cmd/reencrypt seals them); delivered ones lose them altogether.
+UPDATE user_events_outbox
+SET sensitive_payload = (
+    CASE event_type
+        WHEN 'users.email_confirmation_requested' THEN jsonb_build_object('code', payload->'code')
+        ELSE jsonb_build_object('token', payload->'token')
+    END
+)::text
+WHERE published_at IS NULL
+  AND event_type IN ('users.email_confirmation_requested', 'users.password_reset_requested');
+
+UPDATE user_events_outbox
+SET payload = payload - 'code' - 'token'
+WHERE event_type IN ('users.email_confirmation_requested', 'users.password_reset_requested');
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS auth_trusted_devices (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    token_hash TEXT NOT NULL,
+    user_agent TEXT NULL,
+    ip TEXT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ NULL,
+    revoked_at TIMESTAMPTZ NULL,
+
+    UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_trusted_devices_user_id ON auth_trusted_devices(user_id);
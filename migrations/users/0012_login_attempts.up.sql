@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS auth_login_attempts (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    ip TEXT NULL,
+    user_agent TEXT NULL,
+    succeeded BOOLEAN NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_login_attempts_user_created ON auth_login_attempts(user_id, created_at DESC);
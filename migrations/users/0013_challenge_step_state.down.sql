@@ -0,0 +1,2 @@
+ALTER TABLE auth_challenges
+    DROP COLUMN IF EXISTS step_state;
@@ -0,0 +1,2 @@
+ALTER TABLE auth_challenges
+    ADD COLUMN IF NOT EXISTS step_state JSONB NOT NULL DEFAULT '{}'::jsonb;
@@ -0,0 +1,3 @@
+ALTER TABLE auth_refresh_tokens
+    DROP COLUMN IF EXISTS amr,
+    DROP COLUMN IF EXISTS auth_time;
@@ -0,0 +1,3 @@
+ALTER TABLE auth_refresh_tokens
+    ADD COLUMN IF NOT EXISTS auth_time TIMESTAMPTZ NULL,
+    ADD COLUMN IF NOT EXISTS amr TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,5 @@
+ALTER TABLE auth_refresh_tokens
+    DROP COLUMN IF EXISTS last_ip,
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS device_name,
+    DROP COLUMN IF EXISTS login_method;
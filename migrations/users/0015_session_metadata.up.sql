@@ -0,0 +1,5 @@
+ALTER TABLE auth_refresh_tokens
+    ADD COLUMN IF NOT EXISTS login_method TEXT NULL,
+    ADD COLUMN IF NOT EXISTS device_name TEXT NULL,
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ NULL,
+    ADD COLUMN IF NOT EXISTS last_ip TEXT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE auth_refresh_tokens
+    DROP COLUMN IF EXISTS city,
+    DROP COLUMN IF EXISTS country;
@@ -0,0 +1,3 @@
+ALTER TABLE auth_refresh_tokens
+    ADD COLUMN IF NOT EXISTS country TEXT NULL,
+    ADD COLUMN IF NOT EXISTS city TEXT NULL;
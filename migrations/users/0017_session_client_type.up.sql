@@ -0,0 +1,2 @@
+ALTER TABLE auth_refresh_tokens
+    ADD COLUMN IF NOT EXISTS client_type TEXT NULL;
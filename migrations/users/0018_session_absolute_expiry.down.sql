@@ -0,0 +1,2 @@
+ALTER TABLE auth_refresh_tokens
+    DROP COLUMN IF EXISTS absolute_expires_at;
@@ -0,0 +1,2 @@
+ALTER TABLE auth_refresh_tokens
+    ADD COLUMN IF NOT EXISTS absolute_expires_at TIMESTAMPTZ NULL;
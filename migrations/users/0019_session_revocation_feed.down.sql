@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_auth_refresh_tokens_revoked_at;
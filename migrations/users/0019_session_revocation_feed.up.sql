@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS idx_auth_refresh_tokens_revoked_at
+    ON auth_refresh_tokens (revoked_at)
+    WHERE revoked_at IS NOT NULL;
@@ -0,0 +1,20 @@
+-- One row per scope: the nil uuid is the global epoch, any other id a user's.
+CREATE TABLE IF NOT EXISTS auth_token_epochs (
+    user_id UUID PRIMARY KEY,
+    not_before TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS auth_audit_log (
+    id UUID PRIMARY KEY,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    user_id UUID NULL,
+    ip TEXT NULL,
+    reason TEXT NULL,
+    details JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_audit_log_created_at ON auth_audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_auth_audit_log_user ON auth_audit_log(user_id) WHERE user_id IS NOT NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS auth_personal_access_tokens;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS auth_personal_access_tokens (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    name TEXT NOT NULL,
+    -- The start of the token, shown to tell tokens apart; the token itself
+    -- is only stored hashed.
+    prefix TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ NULL,
+    revoked_at TIMESTAMPTZ NULL,
+
+    UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_personal_access_tokens_user_id ON auth_personal_access_tokens(user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS auth_oauth_client_assertions;
+DROP TABLE IF EXISTS auth_oauth_clients;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS auth_oauth_clients (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+
+    -- client_secret or private_key_jwt. Secrets are only stored hashed;
+    -- private_key_jwt clients have a PEM encoded public key instead.
+    auth_method TEXT NOT NULL,
+    secret_hash TEXT NULL,
+    public_key TEXT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    disabled_at TIMESTAMPTZ NULL
+);
+
+-- Ids of used client assertions, kept until they expire so that none is
+-- accepted twice.
+CREATE TABLE IF NOT EXISTS auth_oauth_client_assertions (
+    client_id UUID NOT NULL REFERENCES auth_oauth_clients(id) ON DELETE CASCADE,
+    jti TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (client_id, jti)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_oauth_client_assertions_expires_at ON auth_oauth_client_assertions(expires_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS auth_oauth_grants;
+DROP TABLE IF EXISTS auth_oauth_consents;
+DROP TABLE IF EXISTS auth_oauth_codes;
+ALTER TABLE auth_oauth_clients DROP COLUMN IF EXISTS redirect_uris;
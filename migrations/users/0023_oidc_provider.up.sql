@@ -0,0 +1,46 @@
+-- Clients that sign users in list the URIs the authorization endpoint may
+-- redirect to; public clients (auth_method none) have no credentials.
+ALTER TABLE auth_oauth_clients ADD COLUMN IF NOT EXISTS redirect_uris TEXT[] NOT NULL DEFAULT '{}';
+
+-- Authorization codes, stored hashed. They live for minutes; a used code
+-- keeps the session it was exchanged for, which is ended if the code comes
+-- back.
+CREATE TABLE IF NOT EXISTS auth_oauth_codes (
+    id UUID PRIMARY KEY,
+    code_hash TEXT NOT NULL UNIQUE,
+    client_id UUID NOT NULL REFERENCES auth_oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    nonce TEXT NULL,
+    code_challenge TEXT NOT NULL,
+    auth_time TIMESTAMPTZ NULL,
+    amr TEXT[] NOT NULL DEFAULT '{}',
+    login_method TEXT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ NULL,
+    session_id UUID NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_oauth_codes_expires_at ON auth_oauth_codes(expires_at);
+
+-- Scopes each user allowed each client on the consent screen.
+CREATE TABLE IF NOT EXISTS auth_oauth_consents (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id UUID NOT NULL REFERENCES auth_oauth_clients(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, client_id)
+);
+
+-- The client and scopes of sessions created through the authorization
+-- endpoint; they go with the session.
+CREATE TABLE IF NOT EXISTS auth_oauth_grants (
+    session_id UUID PRIMARY KEY REFERENCES auth_refresh_tokens(id) ON DELETE CASCADE,
+    client_id UUID NOT NULL REFERENCES auth_oauth_clients(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
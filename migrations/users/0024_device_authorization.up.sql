@@ -0,0 +1,27 @@
+-- Device authorization grant (RFC 8628): a TV or CLI polls with the device
+-- code while the user enters the user code in a signed in browser. Both
+-- codes are stored hashed; the device's address and user agent are shown
+-- to the user before they approve it.
+CREATE TABLE IF NOT EXISTS auth_device_authorizations (
+    id UUID PRIMARY KEY,
+    device_code_hash TEXT NOT NULL UNIQUE,
+    user_code_hash TEXT NOT NULL UNIQUE,
+    client_id UUID NOT NULL REFERENCES auth_oauth_clients(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    user_id UUID NULL REFERENCES users(id) ON DELETE CASCADE,
+    amr TEXT[] NOT NULL DEFAULT '{}',
+    ip TEXT NULL,
+    user_agent TEXT NULL,
+    country TEXT NULL,
+    city TEXT NULL,
+    interval_seconds INTEGER NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_polled_at TIMESTAMPTZ NULL,
+    decided_at TIMESTAMPTZ NULL,
+    used_at TIMESTAMPTZ NULL,
+    session_id UUID NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_device_authorizations_expires_at ON auth_device_authorizations(expires_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS auth_qr_logins;
+
+DELETE FROM auth_challenges WHERE user_id IS NULL;
+ALTER TABLE auth_challenges ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,26 @@
+-- QR cross-device login: a desktop shows a QR code that the mobile app of a
+-- signed in user scans and approves. The login is gated by a challenge that
+-- has no user until it is approved. The code and the desktop's login token
+-- are stored hashed; the desktop's address and user agent are shown to the
+-- user before they approve it.
+ALTER TABLE auth_challenges ALTER COLUMN user_id DROP NOT NULL;
+
+CREATE TABLE IF NOT EXISTS auth_qr_logins (
+    challenge_id UUID PRIMARY KEY REFERENCES auth_challenges(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL UNIQUE,
+    login_token_hash TEXT NOT NULL,
+    user_id UUID NULL REFERENCES users(id) ON DELETE CASCADE,
+    amr TEXT[] NOT NULL DEFAULT '{}',
+    ip TEXT NULL,
+    user_agent TEXT NULL,
+    country TEXT NULL,
+    city TEXT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    decided_at TIMESTAMPTZ NULL,
+    claimed_at TIMESTAMPTZ NULL,
+    session_id UUID NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_qr_logins_expires_at ON auth_qr_logins(expires_at);
@@ -0,0 +1,361 @@
+// Package authverify lets other services check access tokens issued by the
+// users service on their own. The service signs access tokens with an RSA
+// key (AUTH_JWT_SIGNING_KEY_FILE) whose public half it serves as a JSON Web
+// Key Set, so verifiers hold no secret and cannot mint tokens. Signatures
+// and expiry are checked locally; sessions revoked before their tokens
+// expire, and token epochs, are learned from the revocation feed
+// (GET /api/v1/auth/revocations). Run polls both.
+package authverify
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultPollInterval is how often Run reads the feed when no interval is
+// configured. It bounds how long a revoked session keeps working.
+const DefaultPollInterval = 5 * time.Second
+
+// keyRefreshInterval is how often Sync reloads the key set. A token signed
+// with a key not seen yet reloads it on the next sync.
+const keyRefreshInterval = 10 * time.Minute
+
+var (
+	// ErrSessionRevoked means the token is well-formed but its session was
+	// revoked.
+	ErrSessionRevoked = errors.New("session revoked")
+	// ErrTokenInvalidated means the token was issued before the current
+	// epoch of everyone or of its user.
+	ErrTokenInvalidated = errors.New("token issued before the current epoch")
+	// ErrNotSynced is returned by Verify until the feed and the key set
+	// were read once, so that a fresh instance does not accept revoked
+	// sessions.
+	ErrNotSynced = errors.New("revocation feed not synced")
+	// ErrClientToken means the token belongs to an OAuth client, or to a
+	// session a user granted one, rather than to a user. Disabling a client
+	// is not in the feed, so only the users service can verify them.
+	ErrClientToken = errors.New("client tokens are not accepted")
+)
+
+// Config points the verifier at the users service. KeysURL is the full URL
+// of its key set (/api/v1/oauth/jwks), FeedURL that of the revocation feed
+// and FeedToken its AUTH_REVOCATION_FEED_TOKEN.
+type Config struct {
+	KeysURL      string
+	FeedURL      string
+	FeedToken    string
+	PollInterval time.Duration
+	HTTPClient   *http.Client
+	// OnError is told about failed polls; Run keeps polling either way.
+	OnError func(error)
+}
+
+// Claims describes the caller of a verified access token.
+type Claims struct {
+	UserID    string
+	SessionID string
+	// AuthTime is when the session last authenticated; zero for tokens
+	// issued before it was recorded.
+	AuthTime  time.Time
+	AMR       []string
+	ExpiresAt time.Time
+}
+
+// tokenClaims are the claims of the access tokens of the users service.
+type tokenClaims struct {
+	UserID    string           `json:"uid,omitempty"`
+	SessionID string           `json:"sid,omitempty"`
+	ClientID  string           `json:"cid,omitempty"`
+	AuthTime  *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR       []string         `json:"amr,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type Verifier struct {
+	cfg Config
+
+	mu sync.RWMutex
+	// keys maps key ids to the public keys of the key set.
+	keys       map[string]*rsa.PublicKey
+	keysLoaded time.Time
+	unknownKey bool
+
+	revoked map[string]time.Time // session id -> when it stops mattering
+	// notBefore and epochs (user id -> not before) are replaced on every
+	// sync; the feed lists them in full.
+	notBefore time.Time
+	epochs    map[string]time.Time
+	cursor    string
+	lastSync  time.Time
+}
+
+func New(cfg Config) (*Verifier, error) {
+	if cfg.KeysURL == "" {
+		return nil, errors.New("authverify: keys url is required")
+	}
+	if cfg.FeedURL == "" {
+		return nil, errors.New("authverify: feed url is required")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Verifier{cfg: cfg, revoked: make(map[string]time.Time)}, nil
+}
+
+// Verify checks the signature and expiry of token and that its session was
+// not revoked as of the last sync.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	v.mu.RLock()
+	synced := !v.lastSync.IsZero() && v.keys != nil
+	v.mu.RUnlock()
+	if !synced {
+		return Claims{}, ErrNotSynced
+	}
+	parsed, err := v.parse(token)
+	if err != nil {
+		return Claims{}, err
+	}
+	if parsed.ClientID != "" {
+		return Claims{}, ErrClientToken
+	}
+
+	v.mu.RLock()
+	_, revoked := v.revoked[parsed.SessionID]
+	notBefore := v.notBefore
+	if userEpoch := v.epochs[parsed.UserID]; userEpoch.After(notBefore) {
+		notBefore = userEpoch
+	}
+	v.mu.RUnlock()
+	if revoked {
+		return Claims{}, ErrSessionRevoked
+	}
+	if !notBefore.IsZero() && (parsed.IssuedAt == nil || parsed.IssuedAt.Time.Before(notBefore)) {
+		return Claims{}, ErrTokenInvalidated
+	}
+
+	claims := Claims{UserID: parsed.UserID, SessionID: parsed.SessionID, AMR: parsed.AMR}
+	if parsed.AuthTime != nil {
+		claims.AuthTime = parsed.AuthTime.Time
+	}
+	if parsed.ExpiresAt != nil {
+		claims.ExpiresAt = parsed.ExpiresAt.Time
+	}
+	return claims, nil
+}
+
+// parse checks the signature against the key named by the token, and the
+// expiry. Only RS256 is accepted, so that no key is taken for a secret.
+func (v *Verifier) parse(token string) (tokenClaims, error) {
+	parsed, err := jwt.ParseWithClaims(token, &tokenClaims{}, func(t *jwt.Token) (any, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ := t.Header["kid"].(string)
+		v.mu.RLock()
+		key, ok := v.keys[kid]
+		v.mu.RUnlock()
+		if !ok {
+			v.mu.Lock()
+			v.unknownKey = true
+			v.mu.Unlock()
+			return nil, errors.New("unknown key id")
+		}
+		return key, nil
+	})
+	if err != nil {
+		return tokenClaims{}, err
+	}
+	claims, ok := parsed.Claims.(*tokenClaims)
+	if !ok || !parsed.Valid {
+		return tokenClaims{}, errors.New("invalid token")
+	}
+	if claims.ClientID == "" && (claims.UserID == "" || claims.SessionID == "") {
+		return tokenClaims{}, errors.New("missing uid or sid")
+	}
+	return *claims, nil
+}
+
+// LastSync is when the feed was last read completely; callers may refuse
+// tokens when it falls too far behind.
+func (v *Verifier) LastSync() time.Time {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.lastSync
+}
+
+// Run syncs right away and then every PollInterval until ctx is done.
+func (v *Verifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(v.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := v.Sync(ctx); err != nil && ctx.Err() == nil && v.cfg.OnError != nil {
+			v.cfg.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync reloads the key set when it is due, reads the feed up to its
+// current end and forgets revocations whose tokens have all expired.
+func (v *Verifier) Sync(ctx context.Context) error {
+	v.mu.RLock()
+	cursor := v.cursor
+	reload := v.unknownKey || time.Since(v.keysLoaded) >= keyRefreshInterval
+	v.mu.RUnlock()
+	if reload {
+		if err := v.loadKeys(ctx); err != nil {
+			return err
+		}
+	}
+
+	for {
+		page, err := v.fetch(ctx, cursor)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		v.mu.Lock()
+		for _, r := range page.Revocations {
+			v.revoked[r.SessionID] = r.RevokedAt.Add(time.Duration(page.TTL) * time.Second)
+		}
+		cursor = page.NextCursor
+		v.cursor = cursor
+		v.notBefore = time.Time{}
+		if page.NotBefore != nil {
+			v.notBefore = *page.NotBefore
+		}
+		v.epochs = make(map[string]time.Time, len(page.UserEpochs))
+		for _, e := range page.UserEpochs {
+			v.epochs[e.UserID] = e.NotBefore
+		}
+		if !page.HasMore {
+			for id, until := range v.revoked {
+				if now.After(until) {
+					delete(v.revoked, id)
+				}
+			}
+			v.lastSync = now
+		}
+		v.mu.Unlock()
+		if !page.HasMore {
+			return nil
+		}
+	}
+}
+
+type feedPage struct {
+	Revocations []struct {
+		SessionID string    `json:"session_id"`
+		RevokedAt time.Time `json:"revoked_at"`
+	} `json:"revocations"`
+	NextCursor string     `json:"next_cursor"`
+	HasMore    bool       `json:"has_more"`
+	TTL        int64      `json:"ttl"`
+	NotBefore  *time.Time `json:"not_before"`
+	UserEpochs []struct {
+		UserID    string    `json:"user_id"`
+		NotBefore time.Time `json:"not_before"`
+	} `json:"user_epochs"`
+}
+
+type keySet struct {
+	Keys []struct {
+		KeyType string `json:"kty"`
+		KeyID   string `json:"kid"`
+		Use     string `json:"use"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+	} `json:"keys"`
+}
+
+// loadKeys replaces the keys with the RSA signing keys of the key set.
+func (v *Verifier) loadKeys(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.KeysURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("authverify: key set returned %s", resp.Status)
+	}
+	var set keySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return fmt.Errorf("authverify: key %q: %w", k.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return fmt.Errorf("authverify: key %q: %w", k.KeyID, err)
+		}
+		keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return errors.New("authverify: no RSA keys in the key set")
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.keysLoaded = time.Now()
+	v.unknownKey = false
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *Verifier) fetch(ctx context.Context, cursor string) (feedPage, error) {
+	u, err := url.Parse(v.cfg.FeedURL)
+	if err != nil {
+		return feedPage{}, err
+	}
+	if cursor != "" {
+		q := u.Query()
+		q.Set("cursor", cursor)
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return feedPage{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+v.cfg.FeedToken)
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return feedPage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return feedPage{}, fmt.Errorf("authverify: revocation feed returned %s", resp.Status)
+	}
+	var page feedPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return feedPage{}, err
+	}
+	return page, nil
+}
@@ -0,0 +1,195 @@
+package authverify
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeys signs tokens the way the users service does and serves the
+// public half as its key set.
+type testKeys struct {
+	t   *testing.T
+	key *rsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return testKeys{t: t, key: key}
+}
+
+func (k testKeys) serve(w http.ResponseWriter, _ *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{{
+		"kty": "RSA", "use": "sig", "alg": "RS256", "kid": "test",
+		"n": base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+	}}})
+}
+
+func (k testKeys) issue(claims tokenClaims) string {
+	k.t.Helper()
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(k.key)
+	if err != nil {
+		k.t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func TestVerifierRejectsSessionsFromTheFeed(t *testing.T) {
+	now := time.Now().UTC()
+	pages := map[string]map[string]any{
+		"": {
+			"revocations": []map[string]any{{"session_id": "revoked", "revoked_at": now}},
+			"next_cursor": "1", "has_more": true, "ttl": 900,
+		},
+		"1": {
+			"revocations": []map[string]any{{"session_id": "long-gone", "revoked_at": now.Add(-time.Hour)}},
+			"next_cursor": "2", "has_more": false, "ttl": 900,
+		},
+	}
+	keys := newTestKeys(t)
+	var cursors []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", keys.serve)
+	mux.HandleFunc("/revocations", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer feed-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		cursor := r.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		page, ok := pages[cursor]
+		if !ok {
+			page = map[string]any{"revocations": []any{}, "next_cursor": cursor, "has_more": false, "ttl": 900}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	v, err := New(Config{KeysURL: server.URL + "/jwks", FeedURL: server.URL + "/revocations", FeedToken: "feed-token"})
+	if err != nil {
+		t.Fatalf("new verifier failed: %v", err)
+	}
+	active := keys.issue(tokenClaims{UserID: "user", SessionID: "active", AMR: []string{"pwd"}})
+	revoked := keys.issue(tokenClaims{UserID: "user", SessionID: "revoked"})
+
+	if _, err := v.Verify(active); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("expected tokens to wait for the first sync, got %v", err)
+	}
+	if err := v.Sync(context.Background()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	claims, err := v.Verify(active)
+	if err != nil || claims.UserID != "user" || claims.SessionID != "active" || len(claims.AMR) != 1 || claims.ExpiresAt.IsZero() {
+		t.Fatalf("expected an active session, got %+v err=%v", claims, err)
+	}
+	if _, err := v.Verify(revoked); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected a revoked session, got %v", err)
+	}
+	v.mu.RLock()
+	_, kept := v.revoked["long-gone"]
+	v.mu.RUnlock()
+	if kept {
+		t.Fatalf("expected revocations past their ttl to be forgotten")
+	}
+
+	if err := v.Sync(context.Background()); err != nil {
+		t.Fatalf("second sync failed: %v", err)
+	}
+	if len(cursors) != 3 || cursors[2] != "2" {
+		t.Fatalf("expected the next sync to resume at the cursor, got %v", cursors)
+	}
+
+	if _, err := New(Config{FeedURL: server.URL + "/revocations"}); err == nil {
+		t.Fatalf("expected a missing key set url to be rejected")
+	}
+}
+
+func TestVerifierRejectsTokensNotSignedWithTheKeySet(t *testing.T) {
+	keys := newTestKeys(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", keys.serve)
+	mux.HandleFunc("/revocations", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"revocations": []any{}, "next_cursor": "1", "has_more": false, "ttl": 900})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	v, err := New(Config{KeysURL: server.URL + "/jwks", FeedURL: server.URL + "/revocations"})
+	if err != nil {
+		t.Fatalf("new verifier failed: %v", err)
+	}
+	if err := v.Sync(context.Background()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	other := newTestKeys(t)
+	if _, err := v.Verify(other.issue(tokenClaims{UserID: "user", SessionID: "s"})); err == nil {
+		t.Fatalf("expected a token signed with another key to fail")
+	}
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{
+		UserID: "user", SessionID: "s",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	hs.Header["kid"] = "test"
+	secret, _ := hs.SignedString([]byte("0123456789abcdef0123456789abcdef"))
+	if _, err := v.Verify(secret); err == nil {
+		t.Fatalf("expected a token signed with a secret to fail")
+	}
+}
+
+func TestVerifierRejectsTokensBeforeTheEpoch(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	keys := newTestKeys(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", keys.serve)
+	mux.HandleFunc("/revocations", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"revocations": []any{}, "next_cursor": "1", "has_more": false, "ttl": 900,
+			"not_before":  now.Add(-time.Hour),
+			"user_epochs": []map[string]any{{"user_id": "reset", "not_before": now.Add(time.Second)}},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	v, err := New(Config{KeysURL: server.URL + "/jwks", FeedURL: server.URL + "/revocations"})
+	if err != nil {
+		t.Fatalf("new verifier failed: %v", err)
+	}
+	if err := v.Sync(context.Background()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	other := keys.issue(tokenClaims{UserID: "other", SessionID: "a"})
+	reset := keys.issue(tokenClaims{UserID: "reset", SessionID: "b"})
+
+	if _, err := v.Verify(other); err != nil {
+		t.Fatalf("expected tokens after the global epoch to pass, got %v", err)
+	}
+	if _, err := v.Verify(reset); !errors.Is(err, ErrTokenInvalidated) {
+		t.Fatalf("expected a token before the user's epoch to fail, got %v", err)
+	}
+	client := keys.issue(tokenClaims{ClientID: "client"})
+	if _, err := v.Verify(client); !errors.Is(err, ErrClientToken) {
+		t.Fatalf("expected client tokens to be refused, got %v", err)
+	}
+}